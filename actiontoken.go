@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"aigo_service_auth/errorcodes"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 操作确认Token错误定义
+var (
+	ErrInvalidActionToken = errors.New("无效的操作确认Token")
+	ErrActionTokenExpired = errors.New("操作确认Token已过期")
+	ErrActionTokenUsed    = errors.New("操作确认Token已使用")
+	ErrInvalidActionTTL   = errors.New("操作确认Token有效期无效")
+)
+
+const (
+	// ConfirmTokenHeader 携带操作确认Token的请求头
+	ConfirmTokenHeader = "X-Confirm-Token"
+	// MaxActionTokenTTL 操作确认Token的最长有效期
+	MaxActionTokenTTL = 15 * time.Minute
+)
+
+// ActionTokenService 敏感操作确认Token服务
+//
+// 确认Token与会话Token相互独立，绑定用户和操作名，只能使用一次，用于清除用户、覆盖导入权限等破坏性操作。
+type ActionTokenService interface {
+	// 为用户签发执行action的确认Token，ttl不能超过MaxActionTokenTTL
+	IssueActionToken(userID uint, action string, ttl time.Duration) (string, error)
+	// 验证确认Token属于该用户和操作，验证通过即消费，同一Token不能再次使用
+	VerifyActionToken(userID uint, action, token string) error
+}
+
+// actionClaims 操作确认Token声明
+type actionClaims struct {
+	UserID uint   `json:"uid"`
+	Action string `json:"act"`
+	jwt.RegisteredClaims
+}
+
+// actionTokenService 操作确认Token服务实现
+type actionTokenService struct {
+	secretKey []byte
+	store     RateLimitStore // 已使用的nonce，计数在Token过期后失效
+	clock     Clock
+}
+
+// NewActionTokenService 创建操作确认Token服务，store为nil时使用内存存储；多实例部署时应使用共享存储。clock为nil时使用系统时间
+//
+// secretKey应与会话Token的密钥不同，会话Token即使使用相同密钥也因缺少操作名而无法通过验证；secretKey为空时返回配置错误。
+func NewActionTokenService(secretKey string, store RateLimitStore, clock Clock) (ActionTokenService, error) {
+	if secretKey == "" {
+		return nil, fmt.Errorf("%w: 操作确认Token密钥不能为空", ErrInvalidConfiguration)
+	}
+	clock = clockOrDefault(clock)
+	if store == nil {
+		store = NewMemoryRateLimitStoreWithClock(clock)
+	}
+	return &actionTokenService{
+		secretKey: []byte(secretKey),
+		store:     store,
+		clock:     clock,
+	}, nil
+}
+
+// IssueActionToken 签发操作确认Token，Token的JTI作为一次性nonce
+func (s *actionTokenService) IssueActionToken(userID uint, action string, ttl time.Duration) (string, error) {
+	if userID == 0 {
+		return "", errors.New("用户ID不能为0")
+	}
+	if action == "" {
+		return "", errors.New("操作名不能为空")
+	}
+	if ttl <= 0 || ttl > MaxActionTokenTTL {
+		return "", fmt.Errorf("%w: 必须大于0且不超过%s", ErrInvalidActionTTL, MaxActionTokenTTL)
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	now := s.clock.Now()
+	claims := &actionClaims{
+		UserID: userID,
+		Action: action,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        hex.EncodeToString(nonce),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secretKey)
+}
+
+// VerifyActionToken 验证并消费操作确认Token
+//
+// 签名、有效期、用户和操作都匹配后才消费nonce，冒用他人或其他操作的Token不会使其失效。
+// nonce的消费通过存储的原子计数完成，并发验证同一Token时只有一个成功。
+func (s *actionTokenService) VerifyActionToken(userID uint, action, token string) error {
+	if token == "" || len(token) > DefaultMaxTokenLength {
+		return ErrInvalidActionToken
+	}
+
+	claims := &actionClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return s.secretKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired(), jwt.WithTimeFunc(s.clock.Now))
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return ErrActionTokenExpired
+	}
+	if err != nil || claims.ID == "" {
+		return ErrInvalidActionToken
+	}
+	if claims.UserID != userID || claims.Action != action {
+		return ErrInvalidActionToken
+	}
+
+	// 计数保留到Token过期，之后Token本身已无法通过验证
+	uses, err := s.store.Increment("action_token:"+claims.ID, claims.ExpiresAt.Sub(s.clock.Now())+time.Second)
+	if err != nil {
+		return fmt.Errorf("记录操作确认Token使用失败: %w", err)
+	}
+	if uses > 1 {
+		return ErrActionTokenUsed
+	}
+	return nil
+}
+
+// RequireActionToken 要求请求携带action操作确认Token的中间件，需在RequireAuth之后使用
+//
+// 从X-Confirm-Token请求头读取Token，缺少时返回403和confirmation_required，无效、过期或已使用时返回403和invalid_confirmation，
+// 记录使用失败时返回500。
+func (m *AuthMiddleware) RequireActionToken(actionTokens ActionTokenService, action string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// 从上下文获取用户
+			user, ok := GetUserFromContext(r.Context())
+			if !ok {
+				m.unauthorized(w, r, errorcodes.ErrCodeUnauthenticated, "缺少认证信息")
+				return
+			}
+
+			token := r.Header.Get(ConfirmTokenHeader)
+			if token == "" {
+				writeErrorCode(w, errorcodes.ErrCodeConfirmationRequired, "该操作需要确认")
+				return
+			}
+			err := actionTokens.VerifyActionToken(user.ID, action, token)
+			switch {
+			case errors.Is(err, ErrInvalidActionToken), errors.Is(err, ErrActionTokenExpired), errors.Is(err, ErrActionTokenUsed):
+				writeErrorCode(w, errorcodes.ErrCodeInvalidConfirmation, err.Error())
+				return
+			case err != nil:
+				writeErrorCode(w, errorcodes.ErrCodeInternal, "操作确认失败")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingRateLimitStore 测试用限流存储，计数总是失败
+type failingRateLimitStore struct {
+	RateLimitStore
+}
+
+func (failingRateLimitStore) Increment(key string, window time.Duration) (int, error) {
+	return 0, errors.New("存储不可用")
+}
+
+// newTestActionTokenService 创建测试用操作确认Token服务
+func newTestActionTokenService(t *testing.T, secretKey string, store RateLimitStore, clock Clock) ActionTokenService {
+	service, err := NewActionTokenService(secretKey, store, clock)
+	assert.NoError(t, err)
+	return service
+}
+
+func TestActionTokenService(t *testing.T) {
+	t.Run("密钥不能为空", func(t *testing.T) {
+		service, err := NewActionTokenService("", nil, nil)
+		assert.Nil(t, service)
+		assert.True(t, errors.Is(err, ErrInvalidConfiguration))
+	})
+
+	t.Run("验证通过后不能再次使用", func(t *testing.T) {
+		service := newTestActionTokenService(t, "action-secret", nil, nil)
+		token, err := service.IssueActionToken(1, "user.purge", time.Minute)
+		assert.NoError(t, err)
+
+		assert.NoError(t, service.VerifyActionToken(1, "user.purge", token))
+		assert.True(t, errors.Is(service.VerifyActionToken(1, "user.purge", token), ErrActionTokenUsed))
+	})
+
+	t.Run("并发验证同一Token只有一个成功", func(t *testing.T) {
+		service := newTestActionTokenService(t, "action-secret", nil, nil)
+		token, err := service.IssueActionToken(1, "user.purge", time.Minute)
+		assert.NoError(t, err)
+
+		var succeeded atomic.Int32
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if service.VerifyActionToken(1, "user.purge", token) == nil {
+					succeeded.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int32(1), succeeded.Load())
+	})
+
+	t.Run("操作或用户不匹配时拒绝且不消费", func(t *testing.T) {
+		service := newTestActionTokenService(t, "action-secret", nil, nil)
+		token, err := service.IssueActionToken(1, "user.purge", time.Minute)
+		assert.NoError(t, err)
+
+		assert.True(t, errors.Is(service.VerifyActionToken(1, "rbac.import_replace", token), ErrInvalidActionToken))
+		assert.True(t, errors.Is(service.VerifyActionToken(2, "user.purge", token), ErrInvalidActionToken))
+
+		// 冒用失败后本人仍可使用
+		assert.NoError(t, service.VerifyActionToken(1, "user.purge", token))
+	})
+
+	t.Run("过期后拒绝", func(t *testing.T) {
+		clock := NewFakeClock(time.Time{})
+		service := newTestActionTokenService(t, "action-secret", nil, clock)
+		token, err := service.IssueActionToken(1, "user.purge", time.Minute)
+		assert.NoError(t, err)
+
+		clock.Advance(2 * time.Minute)
+		assert.True(t, errors.Is(service.VerifyActionToken(1, "user.purge", token), ErrActionTokenExpired))
+	})
+
+	t.Run("拒绝其他密钥签发的Token和会话Token", func(t *testing.T) {
+		service := newTestActionTokenService(t, "action-secret", nil, nil)
+		other := newTestActionTokenService(t, "other-secret", nil, nil)
+		token, err := other.IssueActionToken(1, "user.purge", time.Minute)
+		assert.NoError(t, err)
+		assert.True(t, errors.Is(service.VerifyActionToken(1, "user.purge", token), ErrInvalidActionToken))
+
+		// 即使密钥相同，会话Token也缺少操作名
+		sessionToken, err := NewTokenService("action-secret", time.Hour).GenerateToken(1)
+		assert.NoError(t, err)
+		assert.True(t, errors.Is(service.VerifyActionToken(1, "", sessionToken), ErrInvalidActionToken))
+		assert.True(t, errors.Is(service.VerifyActionToken(1, "user.purge", "not-a-token"), ErrInvalidActionToken))
+	})
+
+	t.Run("签发参数校验", func(t *testing.T) {
+		service := newTestActionTokenService(t, "action-secret", nil, nil)
+		_, err := service.IssueActionToken(0, "user.purge", time.Minute)
+		assert.Error(t, err)
+		_, err = service.IssueActionToken(1, "", time.Minute)
+		assert.Error(t, err)
+		_, err = service.IssueActionToken(1, "user.purge", 0)
+		assert.True(t, errors.Is(err, ErrInvalidActionTTL))
+		_, err = service.IssueActionToken(1, "user.purge", MaxActionTokenTTL+time.Second)
+		assert.True(t, errors.Is(err, ErrInvalidActionTTL))
+	})
+
+	t.Run("共享存储的实例间只能使用一次", func(t *testing.T) {
+		store := NewMemoryRateLimitStore()
+		first := newTestActionTokenService(t, "action-secret", store, nil)
+		second := newTestActionTokenService(t, "action-secret", store, nil)
+
+		token, err := first.IssueActionToken(1, "user.purge", time.Minute)
+		assert.NoError(t, err)
+		assert.NoError(t, second.VerifyActionToken(1, "user.purge", token))
+		assert.True(t, errors.Is(first.VerifyActionToken(1, "user.purge", token), ErrActionTokenUsed))
+	})
+}
+
+func TestRequireActionToken(t *testing.T) {
+	user := &User{Username: "admin"}
+	user.ID = 1
+	service := newTestActionTokenService(t, "action-secret", nil, nil)
+	middleware := NewAuthMiddleware(nil)
+
+	serve := func(actionTokens ActionTokenService, token string, withUser bool) (*httptest.ResponseRecorder, bool) {
+		called := false
+		handler := middleware.RequireActionToken(actionTokens, "user.purge")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			w.WriteHeader(http.StatusOK)
+		}))
+		req := httptest.NewRequest(http.MethodDelete, "/admin/users/2", nil)
+		if token != "" {
+			req.Header.Set(ConfirmTokenHeader, token)
+		}
+		if withUser {
+			req = req.WithContext(context.WithValue(req.Context(), UserContextKey, user))
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder, called
+	}
+	code := func(recorder *httptest.ResponseRecorder) string {
+		var body map[string]string
+		json.Unmarshal(recorder.Body.Bytes(), &body)
+		return body["code"]
+	}
+
+	token, err := service.IssueActionToken(1, "user.purge", time.Minute)
+	assert.NoError(t, err)
+
+	recorder, called := serve(service, "", true)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Equal(t, "confirmation_required", code(recorder))
+	assert.False(t, called)
+
+	recorder, called = serve(service, token, true)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.True(t, called)
+
+	// 重放
+	recorder, called = serve(service, token, true)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Equal(t, "invalid_confirmation", code(recorder))
+	assert.False(t, called)
+
+	recorder, _ = serve(service, token, false)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	failing := newTestActionTokenService(t, "action-secret", failingRateLimitStore{}, nil)
+	token, err = failing.IssueActionToken(1, "user.purge", time.Minute)
+	assert.NoError(t, err)
+	recorder, called = serve(failing, token, true)
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.False(t, called)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// 审计事件类型
+const (
+	AuditEventUserSuspended             = "user.suspended"
+	AuditEventSuspensionLifted          = "user.suspension_lifted"
+	AuditEventResetCodeIssued           = "password.reset_requested"
+	AuditEventResetCodeConsumed         = "password.reset_completed"
+	AuditEventLoginNewDevice            = "user.login_new_device"
+	AuditEventPasswordChanged           = "password.changed"
+	AuditEventAccountSecured            = "user.account_secured"
+	AuditEventLoginRiskAssessed         = "user.login_risk_assessed"
+	AuditEventAccountLocked             = "user.account_locked"
+	AuditEventAccountUnlocked           = "user.account_unlocked"
+	AuditEventTokenIssuanceAnomaly      = "token.issuance_anomaly"
+	AuditEventTenantSeatLimitReached    = "tenant.seat_limit_reached"
+	AuditEventTenantSessionLimitReached = "tenant.session_limit_reached"
+	AuditEventPasswordEvaluateThrottled = "password.evaluate_throttled"
+	AuditEventUserDataExported          = "user.data_exported"
+	AuditEventDormancyWarned            = "user.dormancy_warned"
+	AuditEventDormantDisabled           = "user.dormant_disabled"
+	AuditEventDormantDeleted            = "user.dormant_deleted"
+	AuditEventTOTPEnabled               = "user.totp_enabled"
+	AuditEventTOTPDisabled              = "user.totp_disabled"
+	AuditEventRecoveryCodeUsed          = "user.recovery_code_used"
+	AuditEventBackupCodesGenerated      = "user.backup_codes_generated"
+)
+
+// AuditEvent 审计事件
+type AuditEvent struct {
+	Type      string    `json:"type"`
+	UserID    uint      `json:"user_id"`
+	Detail    string    `json:"detail,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AuditLogger 审计日志接口
+type AuditLogger interface {
+	Log(event AuditEvent) error
+}
+
+// AuditEventSource 可按用户查询审计事件的审计日志，导出用户数据时使用
+type AuditEventSource interface {
+	// 获取与用户相关的审计事件，按记录顺序排列
+	EventsForUser(userID uint) ([]AuditEvent, error)
+}
+
+// noopAuditLogger 不记录任何事件的审计日志实现
+type noopAuditLogger struct{}
+
+// Log 忽略审计事件
+func (noopAuditLogger) Log(event AuditEvent) error {
+	return nil
+}
+
+// MemoryAuditLogger 内存审计日志实现
+type MemoryAuditLogger struct {
+	events []AuditEvent
+	mutex  sync.RWMutex
+}
+
+// NewMemoryAuditLogger 创建内存审计日志
+func NewMemoryAuditLogger() *MemoryAuditLogger {
+	return &MemoryAuditLogger{}
+}
+
+// Log 记录审计事件
+func (l *MemoryAuditLogger) Log(event AuditEvent) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.events = append(l.events, event)
+	return nil
+}
+
+// Events 获取已记录的审计事件
+func (l *MemoryAuditLogger) Events() []AuditEvent {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	result := make([]AuditEvent, len(l.events))
+	copy(result, l.events)
+	return result
+}
+
+// EventsForUser 获取与用户相关的审计事件
+func (l *MemoryAuditLogger) EventsForUser(userID uint) ([]AuditEvent, error) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	var result []AuditEvent
+	for _, event := range l.events {
+		if event.UserID == userID {
+			result = append(result, event)
+		}
+	}
+	return result, nil
+}
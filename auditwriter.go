@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrAuditWriterClosed 异步审计写入器已关闭
+var ErrAuditWriterClosed = errors.New("审计写入器已关闭")
+
+// AuditBatchLogger 支持批量写入的审计日志，如单条INSERT写入多行的数据库实现
+//
+// AsyncAuditWriter在下游实现该接口时按批写入，否则逐条调用Log。events在调用返回后会被复用，实现不应保留。
+type AuditBatchLogger interface {
+	LogBatch(events []AuditEvent) error
+}
+
+// AuditOverflowPolicy 缓冲区已满时的处理方式
+type AuditOverflowPolicy string
+
+// 缓冲区溢出处理方式
+const (
+	AuditOverflowBlock AuditOverflowPolicy = "block" // 阻塞调用方直到有空位，不丢失事件
+	AuditOverflowDrop  AuditOverflowPolicy = "drop"  // 丢弃新事件并计数，不影响请求延迟
+)
+
+// AsyncAuditWriterConfig 异步审计写入器配置
+type AsyncAuditWriterConfig struct {
+	BufferSize    int                 // 缓冲区容量
+	BatchSize     int                 // 攒够该数量立即写入
+	FlushInterval time.Duration       // 未攒够时的最长写入间隔
+	Overflow      AuditOverflowPolicy // 缓冲区已满时的处理方式
+}
+
+// DefaultAsyncAuditWriterConfig 默认异步审计写入器配置
+func DefaultAsyncAuditWriterConfig() *AsyncAuditWriterConfig {
+	return &AsyncAuditWriterConfig{
+		BufferSize:    1024,
+		BatchSize:     100,
+		FlushInterval: time.Second,
+		Overflow:      AuditOverflowBlock,
+	}
+}
+
+// AsyncAuditWriter 异步审计写入器，将审计事件放入有界缓冲区，由后台协程批量写入下游
+//
+// 所有事件经同一个缓冲区按入队顺序写入，同一用户的事件保持顺序。
+// 低流量部署和测试可直接使用下游AuditLogger同步写入。
+// 服务退出前应调用Close，否则缓冲区中的事件会丢失。
+type AsyncAuditWriter struct {
+	sink    AuditLogger
+	config  *AsyncAuditWriterConfig
+	events  chan AuditEvent
+	flushes chan chan error
+	done    chan struct{}
+	dropped atomic.Uint64
+
+	mutex     sync.RWMutex // 保护closed，防止向已关闭的缓冲区发送
+	closed    bool
+	closeOnce sync.Once
+
+	err error // 最近一次Flush以来的首个写入错误，仅由后台协程读写
+}
+
+// NewAsyncAuditWriter 创建异步审计写入器并启动后台写入协程
+func NewAsyncAuditWriter(sink AuditLogger, config *AsyncAuditWriterConfig) *AsyncAuditWriter {
+	if config == nil {
+		config = DefaultAsyncAuditWriterConfig()
+	}
+
+	w := &AsyncAuditWriter{
+		sink:    sink,
+		config:  config,
+		events:  make(chan AuditEvent, config.BufferSize),
+		flushes: make(chan chan error),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Log 将审计事件放入缓冲区
+//
+// 缓冲区已满时按Overflow处理：block阻塞等待，drop丢弃事件并返回nil，丢弃数量通过Dropped获取。
+// 写入下游的错误不会返回给调用方，由Flush或Close报告。
+func (w *AsyncAuditWriter) Log(event AuditEvent) error {
+	// 按入队时间记录，而不是写入下游的时间
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	if w.closed {
+		return ErrAuditWriterClosed
+	}
+
+	if w.config.Overflow == AuditOverflowDrop {
+		select {
+		case w.events <- event:
+		default:
+			w.dropped.Add(1)
+		}
+		return nil
+	}
+
+	w.events <- event
+	return nil
+}
+
+// Dropped 获取因缓冲区已满被丢弃的事件数量
+func (w *AsyncAuditWriter) Dropped() uint64 {
+	return w.dropped.Load()
+}
+
+// Flush 将调用前已入队的事件写入下游，返回上次Flush以来的首个写入错误
+func (w *AsyncAuditWriter) Flush(ctx context.Context) error {
+	reply := make(chan error, 1)
+	select {
+	case w.flushes <- reply:
+	case <-w.done:
+		return ErrAuditWriterClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close 停止接收新事件，写入缓冲区中剩余的全部事件后返回，可重复调用，每次返回相同结果
+func (w *AsyncAuditWriter) Close() error {
+	w.closeOnce.Do(func() {
+		w.mutex.Lock()
+		w.closed = true
+		close(w.events)
+		w.mutex.Unlock()
+	})
+
+	<-w.done
+	return w.err
+}
+
+// run 后台写入协程，攒够BatchSize或到达FlushInterval时写入
+func (w *AsyncAuditWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]AuditEvent, 0, w.config.BatchSize)
+	add := func(event AuditEvent) {
+		batch = append(batch, event)
+		if len(batch) >= w.config.BatchSize {
+			w.write(batch)
+			batch = batch[:0]
+		}
+	}
+
+	for {
+		select {
+		case event, ok := <-w.events:
+			if !ok {
+				w.write(batch)
+				return
+			}
+			add(event)
+		case <-ticker.C:
+			w.write(batch)
+			batch = batch[:0]
+		case reply := <-w.flushes:
+			// 只取Flush调用时已在缓冲区中的事件，避免持续写入时Flush无法返回
+			for n := len(w.events); n > 0; n-- {
+				event, ok := <-w.events
+				if !ok {
+					break
+				}
+				add(event)
+			}
+			w.write(batch)
+			batch = batch[:0]
+
+			reply <- w.err
+			w.err = nil
+		}
+	}
+}
+
+// write 将一批事件写入下游，失败时记录日志并保留首个错误
+func (w *AsyncAuditWriter) write(batch []AuditEvent) {
+	if len(batch) == 0 {
+		return
+	}
+
+	var err error
+	if batchLogger, ok := w.sink.(AuditBatchLogger); ok {
+		err = batchLogger.LogBatch(batch)
+	} else {
+		for _, event := range batch {
+			if logErr := w.sink.Log(event); logErr != nil && err == nil {
+				err = logErr
+			}
+		}
+	}
+
+	if err != nil {
+		log.Printf("写入审计事件失败: count=%d err=%v", len(batch), err)
+		if w.err == nil {
+			w.err = err
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingBatchLogger 记录每次批量写入的下游，可在写入时阻塞
+type recordingBatchLogger struct {
+	mutex   sync.Mutex
+	batches [][]AuditEvent
+	entered chan struct{} // 每次开始写入时通知
+	release chan struct{} // 非nil时写入前等待放行
+	err     error
+}
+
+func (l *recordingBatchLogger) Log(event AuditEvent) error {
+	return l.LogBatch([]AuditEvent{event})
+}
+
+func (l *recordingBatchLogger) LogBatch(events []AuditEvent) error {
+	if l.entered != nil {
+		l.entered <- struct{}{}
+	}
+	if l.release != nil {
+		<-l.release
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.batches = append(l.batches, append([]AuditEvent(nil), events...))
+	return l.err
+}
+
+func (l *recordingBatchLogger) sizes() []int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	sizes := make([]int, 0, len(l.batches))
+	for _, batch := range l.batches {
+		sizes = append(sizes, len(batch))
+	}
+	return sizes
+}
+
+func (l *recordingBatchLogger) events() []AuditEvent {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var events []AuditEvent
+	for _, batch := range l.batches {
+		events = append(events, batch...)
+	}
+	return events
+}
+
+func TestAsyncAuditWriter(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("攒够批量大小时写入，Flush写入剩余事件", func(t *testing.T) {
+		sink := &recordingBatchLogger{}
+		config := DefaultAsyncAuditWriterConfig()
+		config.BatchSize = 3
+		config.FlushInterval = time.Hour
+		writer := NewAsyncAuditWriter(sink, config)
+		defer writer.Close()
+
+		for i := 0; i < 7; i++ {
+			assert.NoError(t, writer.Log(AuditEvent{Type: AuditEventPasswordChanged, UserID: uint(i)}))
+		}
+		assert.NoError(t, writer.Flush(ctx))
+		assert.Equal(t, []int{3, 3, 1}, sink.sizes())
+
+		for _, event := range sink.events() {
+			assert.False(t, event.CreatedAt.IsZero())
+		}
+	})
+
+	t.Run("未攒够时按间隔写入", func(t *testing.T) {
+		sink := &recordingBatchLogger{}
+		config := DefaultAsyncAuditWriterConfig()
+		config.FlushInterval = 10 * time.Millisecond
+		writer := NewAsyncAuditWriter(sink, config)
+		defer writer.Close()
+
+		assert.NoError(t, writer.Log(AuditEvent{Type: AuditEventPasswordChanged, UserID: 1}))
+		assert.Eventually(t, func() bool {
+			return len(sink.events()) == 1
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("下游不支持批量时逐条写入", func(t *testing.T) {
+		sink := NewMemoryAuditLogger()
+		writer := NewAsyncAuditWriter(sink, nil)
+
+		assert.NoError(t, writer.Log(AuditEvent{Type: AuditEventPasswordChanged, UserID: 1}))
+		assert.NoError(t, writer.Log(AuditEvent{Type: AuditEventAccountSecured, UserID: 1}))
+		assert.NoError(t, writer.Close())
+		assert.Len(t, sink.Events(), 2)
+	})
+
+	t.Run("缓冲区已满时按drop策略丢弃并计数", func(t *testing.T) {
+		sink := &recordingBatchLogger{entered: make(chan struct{}, 1), release: make(chan struct{})}
+		config := DefaultAsyncAuditWriterConfig()
+		config.BufferSize = 2
+		config.BatchSize = 1
+		config.Overflow = AuditOverflowDrop
+		writer := NewAsyncAuditWriter(sink, config)
+
+		// 第一条事件被取出后阻塞在下游
+		assert.NoError(t, writer.Log(AuditEvent{UserID: 1}))
+		<-sink.entered
+		sink.entered = nil
+
+		for i := 2; i <= 5; i++ {
+			assert.NoError(t, writer.Log(AuditEvent{UserID: uint(i)}))
+		}
+		assert.Equal(t, uint64(2), writer.Dropped())
+
+		close(sink.release)
+		assert.NoError(t, writer.Close())
+
+		var userIDs []uint
+		for _, event := range sink.events() {
+			userIDs = append(userIDs, event.UserID)
+		}
+		assert.Equal(t, []uint{1, 2, 3}, userIDs)
+	})
+
+	t.Run("缓冲区已满时按block策略阻塞调用方", func(t *testing.T) {
+		sink := &recordingBatchLogger{entered: make(chan struct{}, 1), release: make(chan struct{})}
+		config := DefaultAsyncAuditWriterConfig()
+		config.BufferSize = 1
+		config.BatchSize = 1
+		writer := NewAsyncAuditWriter(sink, config)
+
+		assert.NoError(t, writer.Log(AuditEvent{UserID: 1}))
+		<-sink.entered
+		sink.entered = nil
+		assert.NoError(t, writer.Log(AuditEvent{UserID: 2}))
+
+		logged := make(chan struct{})
+		go func() {
+			writer.Log(AuditEvent{UserID: 3})
+			close(logged)
+		}()
+
+		select {
+		case <-logged:
+			t.Fatal("缓冲区已满时Log应阻塞")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(sink.release)
+		<-logged
+		assert.NoError(t, writer.Close())
+		assert.Len(t, sink.events(), 3)
+		assert.Zero(t, writer.Dropped())
+	})
+
+	t.Run("关闭时写入全部事件并保持同一用户的顺序", func(t *testing.T) {
+		sink := &recordingBatchLogger{}
+		config := DefaultAsyncAuditWriterConfig()
+		config.BufferSize = 16
+		config.BatchSize = 7
+		writer := NewAsyncAuditWriter(sink, config)
+
+		const users, perUser = 8, 200
+		var wg sync.WaitGroup
+		for user := 1; user <= users; user++ {
+			wg.Add(1)
+			go func(userID uint) {
+				defer wg.Done()
+				for seq := 0; seq < perUser; seq++ {
+					writer.Log(AuditEvent{UserID: userID, CreatedAt: time.Unix(int64(seq), 0)})
+				}
+			}(uint(user))
+		}
+		wg.Wait()
+		assert.NoError(t, writer.Close())
+
+		events := sink.events()
+		assert.Len(t, events, users*perUser)
+
+		next := make(map[uint]int64)
+		for _, event := range events {
+			assert.Equal(t, next[event.UserID], event.CreatedAt.Unix())
+			next[event.UserID]++
+		}
+	})
+
+	t.Run("关闭后拒绝新事件，写入错误由Flush和Close报告", func(t *testing.T) {
+		sinkErr := errors.New("数据库不可用")
+		sink := &recordingBatchLogger{err: sinkErr}
+		writer := NewAsyncAuditWriter(sink, nil)
+
+		assert.NoError(t, writer.Log(AuditEvent{UserID: 1}))
+		assert.True(t, errors.Is(writer.Flush(ctx), sinkErr))
+
+		// 错误只报告一次
+		assert.NoError(t, writer.Flush(ctx))
+
+		assert.NoError(t, writer.Log(AuditEvent{UserID: 2}))
+		assert.True(t, errors.Is(writer.Close(), sinkErr))
+
+		// 重复关闭返回相同结果
+		assert.True(t, errors.Is(writer.Close(), sinkErr))
+
+		assert.True(t, errors.Is(writer.Log(AuditEvent{UserID: 3}), ErrAuditWriterClosed))
+		assert.True(t, errors.Is(writer.Flush(ctx), ErrAuditWriterClosed))
+	})
+}
@@ -1,14 +1,16 @@
 package main
 
 import (
-	"crypto/rand"
-	"crypto/subtle"
-	"encoding/base64"
+	"bufio"
 	"errors"
 	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
-	"golang.org/x/crypto/argon2"
 	"gorm.io/gorm"
 )
 
@@ -16,8 +18,14 @@ import (
 type AuthService interface {
 	// 用户注册
 	Register(username, email, password, invitationCode string) (*User, string, error)
+	// 按选项注册用户，记录用户同意的服务条款版本
+	RegisterWithOptions(username, email, password string, options RegisterOptions) (*User, string, error)
 	// 用户登录
 	Login(username, password string) (*User, string, error)
+	// 携带客户端信息登录，用于识别新设备
+	LoginWithClient(username, password string, client ClientInfo) (*User, string, error)
+	// 使用TOTP验证码或恢复码完成二次验证登录，用于Login返回ErrTOTPRequired之后
+	LoginWithTOTP(username, password, code string) (*User, string, error)
 	// 验证Token
 	ValidateToken(token string) (*User, error)
 	// 刷新Token
@@ -30,6 +38,85 @@ type AuthService interface {
 	ResetPassword(email string) (string, error)
 	// 验证重置码并设置新密码
 	ConfirmPasswordReset(resetCode, newPassword string) error
+	// 通过安全通知中的锁定码锁定账户：撤销所有Token并使当前密码失效，返回用于设置新密码的重置码
+	SecureAccount(secureCode string) (string, error)
+	// 清理已过期或已使用的重置码，返回删除的数量
+	CleanupResetCodes() (int, error)
+	// 暂停用户直到指定时间，并撤销其所有Token
+	SuspendUser(userID uint, until time.Time, reason string) error
+	// 解除用户暂停
+	LiftSuspension(userID uint) error
+	// 重新发送邮箱验证码，邮箱不存在或已验证时不做任何操作
+	ResendVerification(email string) error
+	// 验证邮箱验证码并将邮箱标记为已验证
+	ConfirmEmailVerification(email, code string) error
+	// 向锁定账户的邮箱发送自助解锁验证码，用户不存在或未锁定时不做任何操作
+	RequestUnlockCode(username string) error
+	// 验证解锁验证码并解锁账户
+	UnlockWithCode(username, code string) error
+	// 管理员解锁账户
+	UnlockUser(userID uint) error
+	// 获取用户当前计入锁定的连续密码错误次数
+	GetFailedAttempts(userID uint) (int, error)
+}
+
+// 认证错误定义
+var (
+	ErrInvalidCredentials = errors.New("用户名或密码错误")
+	ErrUserDisabled       = errors.New("用户已被禁用")
+	ErrUserSuspended      = errors.New("用户已被暂停使用")
+	ErrStaleCredentials   = errors.New("密码已修改，请重新登录")
+)
+
+// AuthConfig 认证服务配置
+type AuthConfig struct {
+	ShowSuspensionExpiry     bool            // 暂停期内以正确密码登录时是否在错误信息中提示解除时间，默认不提示
+	RejectStaleCredentials   bool            // 拒绝在最近一次修改密码之前签发的Token，每次验证多一次比较
+	AuditLogger              AuditLogger     // 审计日志记录器
+	ResetCodeTTL             time.Duration   // 密码重置码有效期
+	MaxOutstandingResetCodes int             // 每个用户最多保留的未使用重置码数量，超出时较早的失效
+	DeviceTracker            *DeviceTracker  // 登录设备跟踪器，为nil时不跟踪设备
+	Mailer                   AuthMailer      // 安全通知邮件发送器，为nil时不发送
+	PasswordManager          PasswordManager // 新密码校验规则，为nil时不校验
+	SecurityNotifications    SecurityNotificationConfig
+	VerificationCodes        VerificationCodeService // 邮箱验证码服务，为nil时不支持邮箱验证
+	RateLimitStore           RateLimitStore          // 重发验证邮件的限流计数存储，为nil时不限流
+	EmailVerification        EmailVerificationConfig
+	// 登录风险评估器，为nil时不评估；要求挑战时需通过启用挑战的LoginService完成邮箱验证码后重新登录
+	RiskAssessor LoginRiskAssessor
+	// 连续密码错误后的账户锁定配置，为nil时不锁定
+	AccountLockout *AccountLockoutConfig
+	// 要求用户同意的服务条款版本，为空时不要求；与用户已同意的版本不同时注册和登录返回TermsAcceptanceRequiredError
+	RequiredTermsVersion string
+	// 租户限额，设置后租户未过期会话数达到上限时登录返回ErrSessionLimitReached
+	TenantLimits TenantLimitService
+	// 二次验证服务，设置后已启用TOTP的用户登录时返回ErrTOTPRequired，需通过LoginWithTOTP提供验证码
+	TwoFactor TwoFactorService
+	// 时间来源，用于暂停期、账户锁定、失败计数窗口、重置码有效期和密码修改时间，为nil时使用系统时间；
+	// 应与TokenService使用同一个时钟，否则密码修改时间与Token签发时间无法比较。测试中可使用FakeClock
+	Clock Clock
+	// 修改和重置密码时按用户获取新密码的最低强度分数，为nil时使用PasswordManager配置的MinStrengthScore；
+	// 可用RoleStrengthScores按角色设置
+	PasswordStrengthScore func(user *User) (int, error)
+	// 邮箱规范化器，为nil时不启用；启用后重发验证邮件按规范形式限流，同一邮箱的别名共用次数。
+	// 应与UserServiceConfig.EmailCanonicalizer使用同一个规范化器
+	EmailCanonicalizer EmailCanonicalizer
+}
+
+// now 按配置的时钟获取当前时间
+func (c *AuthConfig) now() time.Time {
+	return clockOrDefault(c.Clock).Now()
+}
+
+// DefaultAuthConfig 默认认证服务配置
+func DefaultAuthConfig() *AuthConfig {
+	return &AuthConfig{
+		AuditLogger:              noopAuditLogger{},
+		ResetCodeTTL:             15 * time.Minute,
+		MaxOutstandingResetCodes: 1,
+		SecurityNotifications:    DefaultSecurityNotificationConfig(),
+		EmailVerification:        DefaultEmailVerificationConfig(),
+	}
 }
 
 // PasswordConfig 密码配置
@@ -39,9 +126,18 @@ type PasswordConfig struct {
 	Threads uint8
 	KeyLen  uint32
 	SaltLen uint32
+	// 密码的pepper，哈希前先计算 HMAC-SHA256(Pepper, 密码)，为空时不使用。pepper不记录在哈希中，应与数据库分开保管
+	Pepper []byte
+	// 轮换前的pepper，只用于验证，在Pepper之后依次尝试；通过验证的用户登录时改用Pepper重新哈希。
+	// 首次启用pepper时加入一个空值，未使用pepper的哈希仍可验证。密码错误时每个pepper都要计算一次哈希，轮换完成后应及时移除
+	PreviousPeppers [][]byte
 }
 
 // DefaultPasswordConfig 默认密码配置
+//
+// Memory 的单位为KiB，每次哈希都会分配这么多内存：64MB × 并发登录数 很容易超出小容器的内存限制。
+// 资源受限的环境可在创建服务前设置 DefaultPasswordConfig = RecommendedPasswordConfig()。
+// 参数记录在哈希中，修改后只影响新哈希，已有的哈希在用户下次登录时按新参数重新哈希。
 var DefaultPasswordConfig = &PasswordConfig{
 	Time:    1,
 	Memory:  64 * 1024,
@@ -50,81 +146,290 @@ var DefaultPasswordConfig = &PasswordConfig{
 	SaltLen: 16,
 }
 
+// argon2内存参数边界（KiB）
+const (
+	minArgon2Memory = 19 * 1024  // OWASP建议的argon2id最低内存
+	maxArgon2Memory = 128 * 1024 // 超过该值对安全性提升有限
+)
+
+// RecommendedPasswordConfig 根据可用内存和并发能力推荐argon2参数
+//
+// 假设最多 GOMAXPROCS×2 个哈希同时进行，并只使用可用内存的四分之一，
+// 避免登录高峰时因哈希内存占用导致OOM。内存较低时增加迭代次数以弥补强度。
+func RecommendedPasswordConfig() *PasswordConfig {
+	return recommendPasswordConfig(availableMemory(), runtime.GOMAXPROCS(0))
+}
+
+// recommendPasswordConfig 根据可用内存（字节）和CPU并发数计算argon2参数
+func recommendPasswordConfig(availableBytes uint64, procs int) *PasswordConfig {
+	if procs < 1 {
+		procs = 1
+	}
+
+	config := &PasswordConfig{
+		Time:    DefaultPasswordConfig.Time,
+		Memory:  DefaultPasswordConfig.Memory,
+		Threads: uint8(min(procs, 4)),
+		KeyLen:  DefaultPasswordConfig.KeyLen,
+		SaltLen: DefaultPasswordConfig.SaltLen,
+		// pepper与资源无关，沿用默认配置
+		Pepper:          DefaultPasswordConfig.Pepper,
+		PreviousPeppers: DefaultPasswordConfig.PreviousPeppers,
+	}
+
+	// 无法检测可用内存时沿用默认内存参数
+	if availableBytes == 0 {
+		return config
+	}
+
+	concurrentHashes := uint64(procs * 2)
+	memory := availableBytes / 4 / concurrentHashes / 1024
+	memory = max(memory, minArgon2Memory)
+	memory = min(memory, maxArgon2Memory)
+	config.Memory = uint32(memory)
+
+	// 内存低于默认值时增加迭代次数
+	if config.Memory < DefaultPasswordConfig.Memory {
+		config.Time = 2
+	}
+
+	return config
+}
+
+// availableMemory 获取可用内存（字节），优先使用cgroup内存限制，无法检测时返回0
+func availableMemory() uint64 {
+	var available uint64
+
+	// /proc/meminfo 中的 MemAvailable 单位为kB
+	if file, err := os.Open("/proc/meminfo"); err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+				if kb, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+					available = kb * 1024
+				}
+				break
+			}
+		}
+	}
+
+	// 容器内以cgroup限制为准（v2 与 v1）
+	for _, path := range []string{"/sys/fs/cgroup/memory.max", "/sys/fs/cgroup/memory/memory.limit_in_bytes"} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		limit, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			continue // "max" 表示不限制
+		}
+		if available == 0 || limit < available {
+			available = limit
+		}
+		break
+	}
+
+	return available
+}
+
 // authService 认证服务实现
 type authService struct {
 	db             *gorm.DB
 	userService    UserService
 	tokenService   TokenService
 	passwordConfig *PasswordConfig
+	config         *AuthConfig
 }
 
 // NewAuthService 创建认证服务实例
 func NewAuthService(db *gorm.DB, userService UserService, tokenService TokenService) AuthService {
+	return NewAuthServiceWithConfig(db, userService, tokenService, nil)
+}
+
+// NewAuthServiceWithConfig 使用自定义配置创建认证服务实例
+func NewAuthServiceWithConfig(db *gorm.DB, userService UserService, tokenService TokenService, config *AuthConfig) AuthService {
+	if config == nil {
+		config = DefaultAuthConfig()
+	}
+	if config.AuditLogger == nil {
+		config.AuditLogger = noopAuditLogger{}
+	}
+	if config.ResetCodeTTL <= 0 {
+		config.ResetCodeTTL = 15 * time.Minute
+	}
+	if config.MaxOutstandingResetCodes <= 0 {
+		config.MaxOutstandingResetCodes = 1
+	}
+	if config.SecurityNotifications.SecureAccountCodeTTL <= 0 {
+		config.SecurityNotifications.SecureAccountCodeTTL = DefaultSecurityNotificationConfig().SecureAccountCodeTTL
+	}
+	if config.AccountLockout != nil && config.AccountLockout.Store == nil {
+		config.AccountLockout.Store = NewMemoryLockoutStore(config.AccountLockout, config.Clock)
+	}
+	if config.AccountLockout != nil && config.AccountLockout.MaxFailedAttemptsPerIP > 0 && config.AccountLockout.IPStore == nil {
+		config.AccountLockout.IPStore = newIPLockoutStore(config.AccountLockout, config.Clock)
+	}
+
 	return &authService{
 		db:             db,
 		userService:    userService,
 		tokenService:   tokenService,
 		passwordConfig: DefaultPasswordConfig,
+		config:         config,
 	}
 }
 
-// HashPassword 哈希密码
-func (s *authService) HashPassword(password string) (string, error) {
-	salt := make([]byte, s.passwordConfig.SaltLen)
-	if _, err := rand.Read(salt); err != nil {
-		return "", err
+// checkUserStatus 检查用户状态是否允许登录和访问
+func checkUserStatus(user *User, showSuspensionExpiry bool, now time.Time) error {
+	if user.Status != 1 {
+		return ErrUserDisabled
 	}
 
-	hash := argon2.IDKey([]byte(password), salt, s.passwordConfig.Time, s.passwordConfig.Memory, s.passwordConfig.Threads, s.passwordConfig.KeyLen)
+	// 暂停期按时间判断，到期后自动恢复，无需定时任务
+	if user.IsSuspended(now) {
+		if showSuspensionExpiry {
+			return fmt.Errorf("%w，解除时间: %s", ErrUserSuspended, user.SuspendedUntil.Format("2006-01-02 15:04:05"))
+		}
+		return ErrUserSuspended
+	}
 
-	// 编码为base64字符串
-	encoded := base64.RawStdEncoding.EncodeToString(salt) + "$" + base64.RawStdEncoding.EncodeToString(hash)
-	return encoded, nil
+	return nil
 }
 
-// VerifyPassword 验证密码
-func (s *authService) VerifyPassword(password, hashedPassword string) (bool, error) {
-	parts := []byte(hashedPassword)
-
-	// 查找分隔符
-	sepIndex := -1
-	for i, b := range parts {
-		if b == '$' {
-			sepIndex = i
-			break
-		}
+// validateNewPassword 使用密码管理器校验新密码，未配置时不校验
+func validateNewPassword(pm PasswordManager, userID uint, password string, userInputs ...string) error {
+	if pm == nil {
+		return nil
 	}
+	return pm.ValidatePassword(userID, password, userInputs...)
+}
 
-	if sepIndex == -1 {
-		return false, errors.New("invalid hash format")
+// validateUserPassword 校验user的新密码，配置了PasswordStrengthScore时按其返回的分数要求强度
+func (s *authService) validateUserPassword(user *User, password string) error {
+	pm := s.config.PasswordManager
+	if pm == nil {
+		return nil
+	}
+	if s.config.PasswordStrengthScore == nil {
+		return pm.ValidatePassword(user.ID, password, user.Username, user.Email)
 	}
 
-	salt, err := base64.RawStdEncoding.DecodeString(string(parts[:sepIndex]))
+	minScore, err := s.config.PasswordStrengthScore(user)
 	if err != nil {
-		return false, err
+		return err
+	}
+	return pm.ValidatePasswordForLevel(user.ID, password, minScore, user.Username, user.Email)
+}
+
+// RoleStrengthScores 按角色要求密码强度，用户有多个角色时取最高分数，没有配置分数的角色使用defaultScore
+//
+// 如RoleStrengthScores(rs, map[string]int{"admin": 80}, 60)要求管理员80分、其他用户60分。
+func RoleStrengthScores(rs RoleService, scores map[string]int, defaultScore int) func(user *User) (int, error) {
+	return func(user *User) (int, error) {
+		roles, err := rs.GetUserRoles(user.ID)
+		if err != nil {
+			return 0, err
+		}
+
+		minScore := defaultScore
+		for _, role := range roles {
+			if score, ok := scores[role.Name]; ok && score > minScore {
+				minScore = score
+			}
+		}
+		return minScore, nil
+	}
+}
+
+// recordPasswordHistory 将新密码记入历史以防止重复使用，失败时只记录日志，不影响已完成的修改
+func recordPasswordHistory(pm PasswordManager, userID uint, password string) {
+	if pm == nil {
+		return
 	}
 
-	hash, err := base64.RawStdEncoding.DecodeString(string(parts[sepIndex+1:]))
+	hash, err := pm.HashPassword(password)
+	if err == nil {
+		err = pm.AddToHistory(userID, hash)
+	}
+	if err == nil {
+		err = pm.CleanupHistory(userID, pm.GetConfig().HistoryCount)
+	}
 	if err != nil {
-		return false, err
+		log.Printf("记录密码历史失败: user_id=%d err=%v", userID, err)
 	}
+}
+
+// checkCredentialFreshness 检查Token是否在用户最近一次修改密码之后签发
+func checkCredentialFreshness(claims *Claims, user *User) error {
+	if user.PasswordChangedAt != nil && claims.PasswordChangedAt < user.PasswordChangedAt.Unix() {
+		return ErrStaleCredentials
+	}
+	return nil
+}
+
+// HashPassword 哈希密码，使用PHC格式记录argon2参数
+func (s *authService) HashPassword(password string) (string, error) {
+	return encodeArgon2Hash(password, s.passwordConfig)
+}
+
+// VerifyPassword 验证密码，兼容未记录参数的旧格式哈希和轮换前的pepper
+func (s *authService) VerifyPassword(password, hashedPassword string) (bool, error) {
+	return verifyArgon2Hash(password, hashedPassword, s.passwordConfig)
+}
 
-	// 计算提供密码的哈希
-	computedHash := argon2.IDKey([]byte(password), salt, s.passwordConfig.Time, s.passwordConfig.Memory, s.passwordConfig.Threads, s.passwordConfig.KeyLen)
+// NeedsRehash 检查哈希是否为旧格式或argon2参数与当前配置不同，调用方可在验证通过后用HashPassword重新哈希
+//
+// 只检查哈希本身，无法发现pepper轮换；登录时的自动升级同时检查两者。
+func (s *authService) NeedsRehash(hashedPassword string) bool {
+	return argon2NeedsRehash(hashedPassword, s.passwordConfig)
+}
 
-	// 使用constant time比较防止时序攻击
-	return subtle.ConstantTimeCompare(hash, computedHash) == 1, nil
+// verifyPassword 验证密码，needsRehash表示哈希为旧格式、参数已变更或使用了轮换前的pepper
+func (s *authService) verifyPassword(password, hashedPassword string) (valid, needsRehash bool, err error) {
+	valid, previousPepper, err := verifyArgon2HashWithPeppers(password, hashedPassword, s.passwordConfig)
+	if err != nil || !valid {
+		return false, false, err
+	}
+	return true, previousPepper || argon2NeedsRehash(hashedPassword, s.passwordConfig), nil
+}
+
+// upgradePasswordHash 登录成功后按当前配置重新哈希密码，失败时只记录日志
+func (s *authService) upgradePasswordHash(user *User, password string) {
+	hash, err := s.HashPassword(password)
+	if err == nil {
+		err = s.db.Model(&User{}).Where("id = ?", user.ID).UpdateColumns(map[string]interface{}{
+			"password_hash": hash,
+			"hash_algo":     passwordHashAlgo(hash),
+		}).Error
+	}
+	if err != nil {
+		log.Printf("升级密码哈希失败: user_id=%d err=%v", user.ID, err)
+		return
+	}
+	invalidateUserCache(s.userService, user.ID)
+	user.PasswordHash = hash
+	user.HashAlgo = passwordHashAlgo(hash)
 }
 
 // Register 用户注册
 func (s *authService) Register(username, email, password, invitationCode string) (*User, string, error) {
+	return s.RegisterWithOptions(username, email, password, RegisterOptions{InvitationCode: invitationCode})
+}
+
+// RegisterWithOptions 按选项注册用户，配置了RequiredTermsVersion时用户必须同意该版本的服务条款
+func (s *authService) RegisterWithOptions(username, email, password string, options RegisterOptions) (*User, string, error) {
+	if required := s.config.RequiredTermsVersion; required != "" && options.AcceptedTermsVersion != required {
+		return nil, "", &TermsAcceptanceRequiredError{RequiredVersion: required}
+	}
+
 	// 创建用户对象
-	user := &User{
-		Username:       username,
-		Email:          email,
-		PasswordHash:   password, // UserService会自动哈希
-		Status:         1,
-		InvitationCode: invitationCode,
+	user := newRegistrationUser(username, email, password, options)
+
+	// 一次校验全部字段，CreateUser仍会再次检查以防并发注册
+	if err := validateRegistration(s.userService, s.config.PasswordManager, user, password); err != nil {
+		return nil, "", err
 	}
 
 	// 创建用户
@@ -132,97 +437,182 @@ func (s *authService) Register(username, email, password, invitationCode string)
 	if err != nil {
 		return nil, "", err
 	}
+	recordPasswordHistory(s.config.PasswordManager, user.ID, password)
 
 	// 生成Token
-	token, err := s.tokenService.GenerateToken(user.ID)
+	token, err := s.tokenService.GenerateTokenForUser(user)
 	if err != nil {
 		return nil, "", err
 	}
 
 	// 设置注册时间为最后登录时间
-	now := time.Now()
+	now := s.config.now()
 	user.LastLoginAt = &now
-	s.userService.UpdateUser(user)
+	s.userService.UpdateLastLogin(user.ID, now)
 
 	return user, token, nil
 }
 
 // Login 用户登录
 func (s *authService) Login(username, password string) (*User, string, error) {
+	return s.LoginWithClient(username, password, ClientInfo{})
+}
+
+// LoginWithClient 携带客户端信息登录
+func (s *authService) LoginWithClient(username, password string, client ClientInfo) (*User, string, error) {
+	return s.login(username, password, "", client)
+}
+
+// LoginWithTOTP 使用TOTP验证码或恢复码登录，用户未启用二次验证时忽略验证码
+func (s *authService) LoginWithTOTP(username, password, code string) (*User, string, error) {
+	return s.login(username, password, code, ClientInfo{})
+}
+
+// login 执行登录流程，totpCode为空且用户启用了二次验证时返回ErrTOTPRequired
+func (s *authService) login(username, password, totpCode string, client ClientInfo) (*User, string, error) {
+	// 在查询用户之前检查，IP锁定的结果与用户名是否存在无关
+	if err := checkIPLock(s.config, client.IP); err != nil {
+		return nil, "", err
+	}
+
 	// 获取用户
 	user, err := s.userService.GetUserByUsername(username)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, "", errors.New("用户名或密码错误")
+		if errors.Is(err, ErrUserNotFound) {
+			recordIPFailure(s.config, client.IP)
+			if err := recordUnknownUserFailure(s.config, username); err != nil {
+				return nil, "", err
+			}
+			return nil, "", ErrInvalidCredentials
 		}
 		return nil, "", err
 	}
 
-	// 检查用户状态
-	if user.Status != 1 {
-		return nil, "", errors.New("用户已被禁用")
+	if err := checkAccountLock(s.config, user); err != nil {
+		return nil, "", err
 	}
 
 	// 验证密码
-	valid, err := s.VerifyPassword(password, user.PasswordHash)
+	valid, needsRehash, err := s.verifyPassword(password, user.PasswordHash)
 	if err != nil {
 		return nil, "", err
 	}
 	if !valid {
-		return nil, "", errors.New("用户名或密码错误")
+		recordIPFailure(s.config, client.IP)
+		if err := recordFailedLogin(s.db, s.config, user); err != nil {
+			return nil, "", err
+		}
+		return nil, "", ErrInvalidCredentials
 	}
 
-	// 生成Token
-	token, err := s.tokenService.GenerateToken(user.ID)
+	// 密码正确后才检查用户状态，不知道密码的调用方无法得知账户是否被禁用或暂停
+	if err := checkUserStatus(user, s.config.ShowSuspensionExpiry, s.config.now()); err != nil {
+		return nil, "", err
+	}
+	if needsRehash {
+		s.upgradePasswordHash(user, password)
+	}
+	amr, err := checkTwoFactor(s.db, s.config, user, totpCode, client)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// 评估登录风险，AuthService没有挑战流程，需要挑战时直接返回
+	action, err := assessLoginRisk(s.config, user, client)
+	if err != nil {
+		return nil, "", err
+	}
+	if action == RiskChallenge {
+		return nil, "", &ChallengeRequiredError{Challenge: ChallengeEmailCode}
+	}
+	if err := checkTermsAcceptance(s.userService, s.config.RequiredTermsVersion, user, client.AcceptedTermsVersion); err != nil {
+		return nil, "", err
+	}
+	if err := checkTenantSessions(s.config.TenantLimits, user); err != nil {
+		return nil, "", err
+	}
+
+	// 生成Token，记录本次登录完成的认证方式，通过二次验证的会话可以通过RequireMFA
+	token, err := s.tokenService.GenerateTokenForUserWithAMR(user, amr)
 	if err != nil {
 		return nil, "", err
 	}
 
+	if err := clearFailedLogins(s.db, s.config, user); err != nil {
+		return nil, "", err
+	}
+
 	// 更新最后登录时间
-	now := time.Now()
+	now := s.config.now()
 	user.LastLoginAt = &now
-	s.userService.UpdateUser(user)
+	s.userService.UpdateLastLogin(user.ID, now)
+
+	recordLoginDevice(s.config.DeviceTracker, user, client)
 
 	return user, token, nil
 }
 
+// recordLoginDevice 记录登录设备，失败时只记录日志，不影响登录
+func recordLoginDevice(tracker *DeviceTracker, user *User, client ClientInfo) {
+	if tracker == nil {
+		return
+	}
+	if _, err := tracker.RecordLogin(user, client); err != nil {
+		log.Printf("记录登录设备失败: user_id=%d err=%v", user.ID, err)
+	}
+}
+
 // ValidateToken 验证Token
 func (s *authService) ValidateToken(token string) (*User, error) {
-	userID, err := s.tokenService.ValidateToken(token)
+	user, _, err := s.validateToken(token)
+	return user, err
+}
+
+// validateToken 验证Token并检查用户状态，返回用户及Claims
+func (s *authService) validateToken(token string) (*User, *Claims, error) {
+	claims, err := s.tokenService.ParseClaims(token)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	user, err := s.userService.GetUserByID(userID)
+	user, err := s.userService.GetUserByID(claims.UserID)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// 检查用户状态
-	if user.Status != 1 {
-		return nil, errors.New("用户已被禁用")
+	if err := checkUserStatus(user, s.config.ShowSuspensionExpiry, s.config.now()); err != nil {
+		return nil, nil, err
 	}
 
-	return user, nil
+	// 检查Token是否早于最近一次修改密码
+	if s.config.RejectStaleCredentials {
+		if err := checkCredentialFreshness(claims, user); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return user, claims, nil
 }
 
 // RefreshToken 刷新Token
 func (s *authService) RefreshToken(token string) (string, error) {
-	userID, err := s.tokenService.ValidateToken(token)
+	user, claims, err := s.validateToken(token)
 	if err != nil {
 		return "", err
 	}
 
-	// 生成新Token
-	newToken, err := s.tokenService.GenerateToken(userID)
+	// 签发新Token前先消费旧Token，并发刷新同一Token时只有一个成功
+	consumed, err := s.tokenService.ConsumeToken(token)
 	if err != nil {
 		return "", err
 	}
+	if !consumed {
+		return "", errors.New("Token已被撤销")
+	}
 
-	// 使旧Token失效
-	s.tokenService.RevokeToken(token)
-
-	return newToken, nil
+	// 生成新Token，保留登录时完成的认证方式；失败时旧Token已失效，需要重新登录
+	return s.tokenService.GenerateTokenForUserWithAMR(user, claims.AMR)
 }
 
 // Logout 用户登出
@@ -237,13 +627,22 @@ func (s *authService) ChangePassword(userID uint, oldPassword, newPassword strin
 		return err
 	}
 
-	// 验证旧密码
+	// 验证旧密码和新密码，一次返回全部字段错误
+	validationErr := &ValidationError{}
 	valid, err := s.VerifyPassword(oldPassword, user.PasswordHash)
 	if err != nil {
 		return err
 	}
 	if !valid {
-		return errors.New("原密码错误")
+		validationErr.addCause(FieldOldPassword, ValidationCodeIncorrect, ErrOldPasswordIncorrect)
+	}
+	if newPassword == "" {
+		validationErr.addCause(FieldNewPassword, ValidationCodeRequired, ErrPasswordEmpty)
+	} else if err := validationErr.addPasswordError(FieldNewPassword, s.validateUserPassword(user, newPassword)); err != nil {
+		return err
+	}
+	if err := validationErr.Err(); err != nil {
+		return err
 	}
 
 	// 哈希新密码
@@ -252,51 +651,61 @@ func (s *authService) ChangePassword(userID uint, oldPassword, newPassword strin
 		return err
 	}
 
-	// 更新密码
+	// 更新密码并记录修改时间，使之前签发的Token失效
+	now := s.config.now()
 	user.PasswordHash = hashedPassword
-	return s.userService.UpdateUser(user)
-}
-
-// ResetPassword 重置密码
-func (s *authService) ResetPassword(email string) (string, error) {
-	_, err := s.userService.GetUserByEmail(email)
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return "", errors.New("邮箱不存在")
-		}
-		return "", err
+	user.PasswordChangedAt = &now
+	if err := s.userService.UpdateUser(user); err != nil {
+		return err
 	}
+	recordPasswordHistory(s.config.PasswordManager, user.ID, newPassword)
 
-	// 生成重置码
-	resetCode := s.generateResetCode()
-
-	// 存储重置码（这里简化处理，实际应该存储到缓存或数据库中）
-	// TODO: 实现重置码存储逻辑
+	if err := s.config.AuditLogger.Log(AuditEvent{
+		Type:      AuditEventPasswordChanged,
+		UserID:    user.ID,
+		CreatedAt: now,
+	}); err != nil {
+		return err
+	}
 
-	return resetCode, nil
+	if s.config.SecurityNotifications.PasswordChanged {
+		s.notifySecurityChange(user.ID, MailTemplatePasswordChanged, now)
+	}
+	return nil
 }
 
-// ConfirmPasswordReset 验证重置码并设置新密码
-func (s *authService) ConfirmPasswordReset(resetCode, newPassword string) error {
-	// TODO: 实现重置码验证逻辑
-	// 这里应该从缓存或数据库中验证重置码的有效性
-
-	// 哈希新密码
-	hashedPassword, err := s.HashPassword(newPassword)
-	if err != nil {
+// SuspendUser 暂停用户直到指定时间，并撤销其所有Token
+func (s *authService) SuspendUser(userID uint, until time.Time, reason string) error {
+	now := s.config.now()
+	if !until.After(now) {
+		return errors.New("暂停截止时间必须晚于当前时间")
+	}
+	if err := s.userService.SuspendUser(userID, until, reason); err != nil {
 		return err
 	}
 
-	// 更新用户密码
-	// TODO: 根据重置码找到对应用户并更新密码
-	_ = hashedPassword
+	// 撤销已签发的Token，强制用户重新登录
+	if err := s.tokenService.RevokeAllUserTokens(userID); err != nil {
+		return err
+	}
 
-	return errors.New("功能待实现")
+	return s.config.AuditLogger.Log(AuditEvent{
+		Type:      AuditEventUserSuspended,
+		UserID:    userID,
+		Detail:    fmt.Sprintf("until=%s reason=%s", until.Format(time.RFC3339), reason),
+		CreatedAt: now,
+	})
 }
 
-// generateResetCode 生成重置码
-func (s *authService) generateResetCode() string {
-	bytes := make([]byte, 32)
-	rand.Read(bytes)
-	return fmt.Sprintf("%x", bytes)
+// LiftSuspension 解除用户暂停
+func (s *authService) LiftSuspension(userID uint) error {
+	if err := s.userService.LiftSuspension(userID); err != nil {
+		return err
+	}
+
+	return s.config.AuditLogger.Log(AuditEvent{
+		Type:      AuditEventSuspensionLifted,
+		UserID:    userID,
+		CreatedAt: s.config.now(),
+	})
 }
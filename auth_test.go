@@ -1,6 +1,12 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -14,7 +20,8 @@ func TestAuthService(t *testing.T) {
 
 	// 创建服务实例
 	userService := NewUserService(testDB.DB)
-	tokenService := NewTokenService("test-secret-key", time.Hour)
+	clock := NewFakeClock(time.Time{})
+	tokenService := NewTokenServiceWithClock("test-secret-key", time.Hour, clock)
 	authService := NewAuthService(testDB.DB, userService, tokenService)
 
 	t.Run("用户注册成功", func(t *testing.T) {
@@ -61,7 +68,7 @@ func TestAuthService(t *testing.T) {
 		// 尝试注册相同用户名的用户
 		_, _, err = authService.Register("existinguser", "different@example.com", "password123", "")
 		assert.Error(t, err)
-		assert.Equal(t, "用户名已存在", err.Error())
+		assertValidationCode(t, err, FieldUsername, ValidationCodeTaken)
 	})
 
 	t.Run("用户注册失败-邮箱已存在", func(t *testing.T) {
@@ -75,7 +82,7 @@ func TestAuthService(t *testing.T) {
 		// 尝试注册相同邮箱的用户
 		_, _, err = authService.Register("user2", "same@example.com", "password123", "")
 		assert.Error(t, err)
-		assert.Equal(t, "邮箱已存在", err.Error())
+		assertValidationCode(t, err, FieldEmail, ValidationCodeTaken)
 	})
 
 	t.Run("用户注册失败-无效邀请码", func(t *testing.T) {
@@ -85,7 +92,7 @@ func TestAuthService(t *testing.T) {
 		// 尝试使用无效邀请码注册
 		_, _, err := authService.Register("user", "user@example.com", "password123", "invalid")
 		assert.Error(t, err)
-		assert.Equal(t, "邀请码无效", err.Error())
+		assertValidationCode(t, err, FieldInvitationCode, ValidationCodeInvalid)
 	})
 
 	t.Run("注册后可以正常登录", func(t *testing.T) {
@@ -97,8 +104,8 @@ func TestAuthService(t *testing.T) {
 		assert.NoError(t, err)
 		assert.NotEmpty(t, registerToken)
 
-		// 等待1秒确保时间戳不同
-		time.Sleep(time.Second)
+		// 推进1秒确保时间戳不同
+		clock.Advance(time.Second)
 
 		// 使用注册的用户名和密码登录
 		loginUser, loginToken, err := authService.Login("logintest", "password123")
@@ -174,8 +181,8 @@ func TestAuthService(t *testing.T) {
 		_, token, err := authService.Login("testuser", password)
 		assert.NoError(t, err)
 
-		// 等待1秒确保时间戳不同
-		time.Sleep(time.Second)
+		// 推进1秒确保时间戳不同
+		clock.Advance(time.Second)
 
 		// 测试Token刷新
 		newToken, err := authService.RefreshToken(token)
@@ -221,6 +228,101 @@ func TestAuthService(t *testing.T) {
 		assert.Error(t, err)
 	})
 
+	t.Run("修改密码一次返回全部字段错误", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		config := DefaultPasswordManagerConfig()
+		config.BcryptCost = 4
+		service := NewAuthServiceWithConfig(testDB.DB, userService, tokenService, &AuthConfig{
+			PasswordManager: NewPasswordManager(config),
+		})
+
+		password := "testpassword123"
+		user := testDB.CreateTestUser("testuser", "test@example.com", password)
+
+		err := service.ChangePassword(user.ID, "wrongpassword", "password123")
+		assertValidationCode(t, err, FieldOldPassword, ValidationCodeIncorrect)
+		assertValidationCode(t, err, FieldNewPassword, ValidationCodePasswordPolicy)
+		assert.True(t, errors.Is(err, ErrOldPasswordIncorrect))
+		assert.True(t, errors.Is(err, ErrPasswordPolicyViolation))
+
+		err = service.ChangePassword(user.ID, password, "")
+		assertValidationCode(t, err, FieldNewPassword, ValidationCodeRequired)
+
+		// 密码未被修改
+		_, _, err = service.Login("testuser", password)
+		assert.NoError(t, err)
+	})
+
+	t.Run("按角色要求新密码强度", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		config := DefaultPasswordManagerConfig()
+		config.BcryptCost = 4
+		roleService := NewRoleService(testDB.DB)
+		service := NewAuthServiceWithConfig(testDB.DB, userService, tokenService, &AuthConfig{
+			PasswordManager:       NewPasswordManager(config),
+			PasswordStrengthScore: RoleStrengthScores(roleService, map[string]int{"admin": 80}, 60),
+		})
+
+		password := "testpassword123"
+		admin := testDB.CreateTestUser("admin", "admin@example.com", password)
+		role := &Role{Name: "admin", DisplayName: "管理员", Status: 1}
+		assert.NoError(t, roleService.CreateRole(role))
+		assert.NoError(t, roleService.AssignRoleToUser(admin.ID, role.ID))
+		member := testDB.CreateTestUser("member", "member@example.com", password)
+
+		// 70分的密码满足普通用户的要求，不满足管理员的要求
+		assert.NoError(t, service.ChangePassword(member.ID, password, "Blue7Horse!"))
+		err := service.ChangePassword(admin.ID, password, "Blue7Horse!")
+		assertValidationCode(t, err, FieldNewPassword, ValidationCodePasswordTooWeak)
+		assert.NoError(t, service.ChangePassword(admin.ID, password, "Kx9#mQ2$vL7p"))
+	})
+
+	t.Run("修改密码后旧Token失效", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		service := NewAuthServiceWithConfig(testDB.DB, userService, tokenService, &AuthConfig{
+			RejectStaleCredentials: true,
+			Clock:                  clock,
+		})
+
+		password := "testpassword123"
+		user := testDB.CreateTestUser("testuser", "test@example.com", password)
+
+		_, oldToken, err := service.Login("testuser", password)
+		assert.NoError(t, err)
+		_, err = service.ValidateToken(oldToken)
+		assert.NoError(t, err)
+
+		newPassword := "newpassword123"
+		clock.Advance(time.Second) // 密码修改时间精确到秒
+		err = service.ChangePassword(user.ID, password, newPassword)
+		assert.NoError(t, err)
+
+		// 密码修改时间取自注入的时钟，与Token签发时间可比较
+		changed, err := userService.GetUserByID(user.ID)
+		assert.NoError(t, err)
+		if assert.NotNil(t, changed.PasswordChangedAt) {
+			assert.Equal(t, clock.Now().Unix(), changed.PasswordChangedAt.Unix())
+		}
+
+		// 旧Token被拒绝
+		_, err = service.ValidateToken(oldToken)
+		assert.True(t, errors.Is(err, ErrStaleCredentials))
+		_, err = service.RefreshToken(oldToken)
+		assert.True(t, errors.Is(err, ErrStaleCredentials))
+
+		// 新登录的Token有效
+		_, newToken, err := service.Login("testuser", newPassword)
+		assert.NoError(t, err)
+		_, err = service.ValidateToken(newToken)
+		assert.NoError(t, err)
+	})
+
 	t.Run("用户状态检查", func(t *testing.T) {
 		// 清理数据
 		testDB.ClearAllData()
@@ -237,4 +339,549 @@ func TestAuthService(t *testing.T) {
 		assert.Error(t, err)
 		assert.Equal(t, "用户已被禁用", err.Error())
 	})
+
+	t.Run("暂停用户并自动到期", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		auditLogger := NewMemoryAuditLogger()
+		service := NewAuthServiceWithConfig(testDB.DB, userService, tokenService, &AuthConfig{
+			ShowSuspensionExpiry: false,
+			AuditLogger:          auditLogger,
+			Clock:                clock,
+		})
+
+		password := "testpassword123"
+		_, token, err := service.Register("suspended", "suspended@example.com", password, "")
+		assert.NoError(t, err)
+		user, err := service.ValidateToken(token)
+		assert.NoError(t, err)
+
+		// 暂停用户
+		until := clock.Now().Add(2 * time.Second)
+		err = service.SuspendUser(user.ID, until, "违规操作")
+		assert.NoError(t, err)
+
+		// 已签发的Token被撤销
+		_, err = service.ValidateToken(token)
+		assert.Error(t, err)
+
+		// 暂停期内无法登录
+		_, _, err = service.Login("suspended", password)
+		assert.True(t, errors.Is(err, ErrUserSuspended))
+		assert.Equal(t, ErrUserSuspended.Error(), err.Error())
+
+		// 产生审计事件
+		events := auditLogger.Events()
+		assert.Len(t, events, 1)
+		assert.Equal(t, AuditEventUserSuspended, events[0].Type)
+		assert.Equal(t, user.ID, events[0].UserID)
+
+		// 到期后自动恢复
+		clock.Advance(3 * time.Second)
+		_, _, err = service.Login("suspended", password)
+		assert.NoError(t, err)
+	})
+
+	t.Run("解除用户暂停", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		password := "testpassword123"
+		user := testDB.CreateTestUser("testuser", "test@example.com", password)
+
+		service := NewAuthServiceWithConfig(testDB.DB, userService, tokenService, &AuthConfig{
+			ShowSuspensionExpiry: true,
+		})
+		err := service.SuspendUser(user.ID, time.Now().Add(time.Hour), "调查中")
+		assert.NoError(t, err)
+
+		_, _, err = service.Login("testuser", password)
+		assert.True(t, errors.Is(err, ErrUserSuspended))
+		assert.Contains(t, err.Error(), "解除时间")
+
+		err = service.LiftSuspension(user.ID)
+		assert.NoError(t, err)
+
+		_, _, err = service.Login("testuser", password)
+		assert.NoError(t, err)
+	})
+
+	t.Run("密码错误时不暴露暂停状态", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		password := "testpassword123"
+		user := testDB.CreateTestUser("testuser", "test@example.com", password)
+		service := NewAuthServiceWithConfig(testDB.DB, userService, tokenService, &AuthConfig{
+			ShowSuspensionExpiry: true,
+		})
+		assert.NoError(t, service.SuspendUser(user.ID, time.Now().Add(time.Hour), "调查中"))
+
+		_, _, err := service.Login("testuser", "wrongpassword")
+		assert.Equal(t, ErrInvalidCredentials, err)
+
+		// 默认配置下即使密码正确也不提示解除时间
+		_, _, err = authService.Login("testuser", password)
+		assert.True(t, errors.Is(err, ErrUserSuspended))
+		assert.NotContains(t, err.Error(), "解除时间")
+	})
+
+	t.Run("重置密码成功且重置码只能使用一次", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		auditLogger := NewMemoryAuditLogger()
+		service := NewAuthServiceWithConfig(testDB.DB, userService, tokenService, &AuthConfig{
+			AuditLogger: auditLogger,
+		})
+
+		password := "testpassword123"
+		testDB.CreateTestUser("testuser", "test@example.com", password)
+		_, oldToken, err := service.Login("testuser", password)
+		assert.NoError(t, err)
+
+		code, err := service.ResetPassword("test@example.com")
+		assert.NoError(t, err)
+		assert.NotEmpty(t, code)
+
+		newPassword := "resetpassword123"
+		err = service.ConfirmPasswordReset(code, newPassword)
+		assert.NoError(t, err)
+
+		// 新密码可以登录，旧密码和旧Token失效
+		_, _, err = service.Login("testuser", newPassword)
+		assert.NoError(t, err)
+		_, _, err = service.Login("testuser", password)
+		assert.Error(t, err)
+		_, err = service.ValidateToken(oldToken)
+		assert.Error(t, err)
+
+		// 重置码不能再次使用
+		err = service.ConfirmPasswordReset(code, "anotherpassword123")
+		assert.True(t, errors.Is(err, ErrResetCodeUsed))
+
+		events := auditLogger.Events()
+		assert.Len(t, events, 2)
+		assert.Equal(t, AuditEventResetCodeIssued, events[0].Type)
+		assert.Equal(t, AuditEventResetCodeConsumed, events[1].Type)
+	})
+
+	t.Run("数据库中不保存原始重置码", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		testDB.CreateTestUser("testuser", "test@example.com", "testpassword123")
+		code, err := authService.ResetPassword("test@example.com")
+		assert.NoError(t, err)
+		_, verifier, err := splitResetCode(code)
+		assert.NoError(t, err)
+
+		var rows []map[string]interface{}
+		err = testDB.DB.Table(PasswordResetCode{}.TableName()).Find(&rows).Error
+		assert.NoError(t, err)
+		assert.Len(t, rows, 1)
+		for _, value := range rows[0] {
+			text := fmt.Sprintf("%s", value)
+			assert.NotContains(t, text, code)
+			assert.NotContains(t, text, verifier)
+		}
+	})
+
+	t.Run("无效和过期的重置码", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		clock := NewFakeClock(time.Time{})
+		service := NewAuthServiceWithConfig(testDB.DB, userService, tokenService, &AuthConfig{
+			ResetCodeTTL: 50 * time.Millisecond,
+			Clock:        clock,
+		})
+
+		testDB.CreateTestUser("testuser", "test@example.com", "testpassword123")
+		code, err := service.ResetPassword("test@example.com")
+		assert.NoError(t, err)
+
+		// 格式错误
+		err = service.ConfirmPasswordReset("invalid-code", "newpassword123")
+		assert.True(t, errors.Is(err, ErrInvalidResetCode))
+
+		// 选择器正确但验证器错误
+		selector, _, _ := splitResetCode(code)
+		forged := selector + "." + strings.Repeat("0", resetVerifierBytes*2)
+		err = service.ConfirmPasswordReset(forged, "newpassword123")
+		assert.True(t, errors.Is(err, ErrInvalidResetCode))
+
+		// 邮箱不存在
+		_, err = service.ResetPassword("missing@example.com")
+		assert.Error(t, err)
+
+		// 过期
+		clock.Advance(100 * time.Millisecond)
+		err = service.ConfirmPasswordReset(code, "newpassword123")
+		assert.True(t, errors.Is(err, ErrResetCodeExpired))
+	})
+
+	t.Run("新的重置请求使较早的重置码失效", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		service := NewAuthServiceWithConfig(testDB.DB, userService, tokenService, &AuthConfig{
+			MaxOutstandingResetCodes: 2,
+		})
+
+		testDB.CreateTestUser("testuser", "test@example.com", "testpassword123")
+		first, err := service.ResetPassword("test@example.com")
+		assert.NoError(t, err)
+		second, err := service.ResetPassword("test@example.com")
+		assert.NoError(t, err)
+		third, err := service.ResetPassword("test@example.com")
+		assert.NoError(t, err)
+
+		var count int64
+		testDB.DB.Model(&PasswordResetCode{}).Count(&count)
+		assert.Equal(t, int64(2), count)
+
+		err = service.ConfirmPasswordReset(first, "newpassword123")
+		assert.True(t, errors.Is(err, ErrInvalidResetCode))
+		err = service.ConfirmPasswordReset(second, "newpassword123")
+		assert.NoError(t, err)
+		err = service.ConfirmPasswordReset(third, "newpassword456")
+		assert.NoError(t, err)
+	})
+
+	t.Run("并发使用同一重置码只有一次成功", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		testDB.CreateTestUser("testuser", "test@example.com", "testpassword123")
+		code, err := authService.ResetPassword("test@example.com")
+		assert.NoError(t, err)
+
+		const attempts = 8
+		var wg sync.WaitGroup
+		var succeeded atomic.Int32
+		errs := make(chan error, attempts)
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if err := authService.ConfirmPasswordReset(code, fmt.Sprintf("newpassword%d", i)); err != nil {
+					errs <- err
+					return
+				}
+				succeeded.Add(1)
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+
+		assert.Equal(t, int32(1), succeeded.Load())
+		for err := range errs {
+			assert.True(t, errors.Is(err, ErrResetCodeUsed))
+		}
+	})
+
+	t.Run("清理过期和已使用的重置码", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		service := NewAuthServiceWithConfig(testDB.DB, userService, tokenService, &AuthConfig{
+			MaxOutstandingResetCodes: 3,
+		})
+
+		testDB.CreateTestUser("testuser", "test@example.com", "testpassword123")
+		used, err := service.ResetPassword("test@example.com")
+		assert.NoError(t, err)
+		assert.NoError(t, service.ConfirmPasswordReset(used, "newpassword123"))
+
+		_, err = service.ResetPassword("test@example.com")
+		assert.NoError(t, err)
+		expired, err := service.ResetPassword("test@example.com")
+		assert.NoError(t, err)
+		selector, _, _ := splitResetCode(expired)
+		testDB.DB.Model(&PasswordResetCode{}).Where("selector = ?", selector).Update("expires_at", time.Now().Add(-time.Minute))
+
+		_, err = service.CleanupResetCodes()
+		assert.NoError(t, err)
+
+		var count int64
+		testDB.DB.Model(&PasswordResetCode{}).Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("清理重置码返回删除数量", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		service := NewAuthServiceWithConfig(testDB.DB, userService, tokenService, &AuthConfig{
+			MaxOutstandingResetCodes: 3,
+		})
+
+		testDB.CreateTestUser("testuser", "test@example.com", "testpassword123")
+		used, err := service.ResetPassword("test@example.com")
+		assert.NoError(t, err)
+		assert.NoError(t, service.ConfirmPasswordReset(used, "newpassword123"))
+
+		valid, err := service.ResetPassword("test@example.com")
+		assert.NoError(t, err)
+		expired, err := service.ResetPassword("test@example.com")
+		assert.NoError(t, err)
+		selector, _, _ := splitResetCode(expired)
+		testDB.DB.Model(&PasswordResetCode{}).Where("selector = ?", selector).Update("expires_at", time.Now().Add(-time.Minute))
+
+		removed, err := service.CleanupResetCodes()
+		assert.NoError(t, err)
+		assert.Equal(t, 2, removed)
+
+		// 未过期的重置码仍然可用
+		assert.NoError(t, service.ConfirmPasswordReset(valid, "newpassword456"))
+
+		removed, err = service.CleanupResetCodes()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, removed)
+	})
+}
+
+// countingCleanupService 测试用认证服务，只记录重置码清理次数
+type countingCleanupService struct {
+	AuthService
+	calls atomic.Int32
+}
+
+func (s *countingCleanupService) CleanupResetCodes() (int, error) {
+	s.calls.Add(1)
+	return 0, nil
+}
+
+// slowMintTokens 测试用Token服务，签发前等待片刻，扩大并发刷新的竞争窗口
+type slowMintTokens struct {
+	TokenService
+}
+
+func (s *slowMintTokens) GenerateTokenForUserWithAMR(user *User, amr []string) (string, error) {
+	time.Sleep(50 * time.Millisecond)
+	return s.TokenService.GenerateTokenForUserWithAMR(user, amr)
+}
+
+func TestRefreshTokenConcurrent(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	config := DefaultAuthConfig()
+	config.Clock = clock
+
+	user := &User{Username: "alice", Email: "alice@example.com", Status: 1}
+	user.ID = 1
+	userService := &totpUserService{user: user}
+	tokens := NewTokenServiceWithClock("test-secret-key", time.Hour, clock)
+	service := NewAuthServiceWithConfig(nil, userService, &slowMintTokens{tokens}, config)
+	loginService := NewLoginService(nil, userService, &slowMintTokens{tokens}, service)
+
+	for name, refresh := range map[string]func(string) (string, error){
+		"AuthService":  service.RefreshToken,
+		"LoginService": loginService.RefreshToken,
+	} {
+		t.Run(name+"并发刷新同一Token时只有一个成功", func(t *testing.T) {
+			token, err := tokens.GenerateTokenForUser(user)
+			assert.NoError(t, err)
+
+			var wg sync.WaitGroup
+			var succeeded atomic.Int32
+			refreshed := make([]string, 8)
+			for i := range refreshed {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					if newToken, err := refresh(token); err == nil {
+						succeeded.Add(1)
+						refreshed[i] = newToken
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			assert.Equal(t, int32(1), succeeded.Load())
+			_, err = tokens.ValidateToken(token)
+			assert.Error(t, err, "旧Token已被消费")
+			for _, newToken := range refreshed {
+				if newToken != "" {
+					_, err := tokens.ValidateToken(newToken)
+					assert.NoError(t, err)
+				}
+			}
+		})
+	}
+}
+
+func TestResetCodeCleaner(t *testing.T) {
+	t.Run("定期清理直到取消", func(t *testing.T) {
+		service := &countingCleanupService{}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := StartResetCodeCleaner(ctx, service, 5*time.Millisecond)
+
+		assert.Eventually(t, func() bool { return service.calls.Load() >= 2 }, time.Second, 5*time.Millisecond)
+
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("取消后清理协程应退出")
+		}
+
+		// 退出后不再清理
+		calls := service.calls.Load()
+		time.Sleep(20 * time.Millisecond)
+		assert.Equal(t, calls, service.calls.Load())
+	})
+
+	t.Run("间隔无效时不启动", func(t *testing.T) {
+		service := &countingCleanupService{}
+		for _, interval := range []time.Duration{0, -time.Second} {
+			select {
+			case <-StartResetCodeCleaner(context.Background(), service, interval):
+			default:
+				t.Fatal("应返回已关闭的通道")
+			}
+		}
+		assert.Equal(t, int32(0), service.calls.Load())
+	})
+}
+
+func TestSplitResetCode(t *testing.T) {
+	code, selector, verifierHash, err := generateResetCode()
+	assert.NoError(t, err)
+
+	t.Run("拆分生成的重置码", func(t *testing.T) {
+		gotSelector, verifier, err := splitResetCode(code)
+		assert.NoError(t, err)
+		assert.Equal(t, selector, gotSelector)
+		assert.Equal(t, verifierHash, hashResetVerifier(verifier))
+		assert.NotContains(t, verifierHash, verifier)
+	})
+
+	t.Run("拒绝格式错误的重置码", func(t *testing.T) {
+		for _, invalid := range []string{"", "abc", selector, selector + ".", "." + strings.Repeat("a", resetVerifierBytes*2), code + "x"} {
+			_, _, err := splitResetCode(invalid)
+			assert.True(t, errors.Is(err, ErrInvalidResetCode), invalid)
+		}
+	})
+}
+
+func TestCheckUserStatus(t *testing.T) {
+	clock := NewFakeClock(time.Time{})
+	until := clock.Now().Add(time.Hour)
+
+	t.Run("正常用户", func(t *testing.T) {
+		user := &User{Status: 1}
+		assert.NoError(t, checkUserStatus(user, true, clock.Now()))
+	})
+
+	t.Run("禁用用户", func(t *testing.T) {
+		user := &User{Status: 2}
+		err := checkUserStatus(user, true, clock.Now())
+		assert.Error(t, err)
+		assert.Equal(t, "用户已被禁用", err.Error())
+	})
+
+	t.Run("暂停期内", func(t *testing.T) {
+		user := &User{Status: 1, SuspendedUntil: &until}
+		err := checkUserStatus(user, true, clock.Now())
+		assert.True(t, errors.Is(err, ErrUserSuspended))
+		assert.Contains(t, err.Error(), until.Format("2006-01-02 15:04:05"))
+
+		err = checkUserStatus(user, false, clock.Now())
+		assert.Equal(t, ErrUserSuspended, err)
+	})
+
+	t.Run("暂停到期边界", func(t *testing.T) {
+		user := &User{Status: 1, SuspendedUntil: &until}
+		assert.True(t, user.IsSuspended(until.Add(-time.Nanosecond)))
+		assert.False(t, user.IsSuspended(until))
+		assert.False(t, user.IsSuspended(until.Add(time.Nanosecond)))
+
+		// 时钟越过暂停期后自动恢复
+		assert.Error(t, checkUserStatus(user, true, clock.Now()))
+		clock.Advance(time.Hour)
+		assert.NoError(t, checkUserStatus(user, true, clock.Now()))
+	})
+}
+
+func TestCheckCredentialFreshness(t *testing.T) {
+	changedAt := time.Now()
+	user := &User{PasswordChangedAt: &changedAt}
+
+	// 未修改过密码的用户
+	assert.NoError(t, checkCredentialFreshness(&Claims{}, &User{}))
+
+	// 签发时携带的修改时间与当前一致
+	assert.NoError(t, checkCredentialFreshness(&Claims{PasswordChangedAt: changedAt.Unix()}, user))
+
+	// 在修改密码之前签发
+	err := checkCredentialFreshness(&Claims{PasswordChangedAt: changedAt.Add(-time.Hour).Unix()}, user)
+	assert.Equal(t, ErrStaleCredentials, err)
+	assert.Equal(t, ErrStaleCredentials, checkCredentialFreshness(&Claims{}, user))
+}
+
+func TestRecommendedPasswordConfig(t *testing.T) {
+	t.Run("小容器降低内存并增加迭代次数", func(t *testing.T) {
+		// 512MB内存、4核
+		config := recommendPasswordConfig(512*1024*1024, 4)
+		assert.Equal(t, uint32(minArgon2Memory), config.Memory)
+		assert.Equal(t, uint32(2), config.Time)
+		assert.Equal(t, uint8(4), config.Threads)
+	})
+
+	t.Run("大内存主机使用较高内存", func(t *testing.T) {
+		// 64GB内存、8核
+		config := recommendPasswordConfig(64*1024*1024*1024, 8)
+		assert.Equal(t, uint32(maxArgon2Memory), config.Memory)
+		assert.Equal(t, DefaultPasswordConfig.Time, config.Time)
+		assert.Equal(t, uint8(4), config.Threads)
+	})
+
+	t.Run("单核限制线程数", func(t *testing.T) {
+		config := recommendPasswordConfig(8*1024*1024*1024, 1)
+		assert.Equal(t, uint8(1), config.Threads)
+		// 并发哈希总内存不超过可用内存的四分之一
+		assert.LessOrEqual(t, uint64(config.Memory)*1024*2, uint64(8*1024*1024*1024)/4)
+	})
+
+	t.Run("无法检测内存时使用默认内存参数", func(t *testing.T) {
+		config := recommendPasswordConfig(0, 2)
+		assert.Equal(t, DefaultPasswordConfig.Memory, config.Memory)
+		assert.Equal(t, DefaultPasswordConfig.KeyLen, config.KeyLen)
+		assert.Equal(t, DefaultPasswordConfig.SaltLen, config.SaltLen)
+	})
+
+	t.Run("推荐配置在合理范围内", func(t *testing.T) {
+		config := RecommendedPasswordConfig()
+		assert.GreaterOrEqual(t, config.Memory, uint32(minArgon2Memory))
+		assert.LessOrEqual(t, config.Memory, uint32(maxArgon2Memory))
+		assert.GreaterOrEqual(t, config.Threads, uint8(1))
+	})
+}
+
+func TestRoleStrengthScores(t *testing.T) {
+	scores := map[string]int{"admin": 80, "auditor": 70}
+	user := &User{}
+	user.ID = 1
+
+	t.Run("取用户角色中最高的分数", func(t *testing.T) {
+		rs := &stubRoleService{roles: []*Role{{Name: "auditor"}, {Name: "admin"}, {Name: "user"}}}
+		score, err := RoleStrengthScores(rs, scores, 60)(user)
+		assert.NoError(t, err)
+		assert.Equal(t, 80, score)
+	})
+
+	t.Run("没有配置分数的角色使用默认分数", func(t *testing.T) {
+		rs := &stubRoleService{roles: []*Role{{Name: "user"}}}
+		score, err := RoleStrengthScores(rs, scores, 60)(user)
+		assert.NoError(t, err)
+		assert.Equal(t, 60, score)
+	})
+
+	t.Run("加载角色失败", func(t *testing.T) {
+		rs := &stubRoleService{err: errors.New("查询超时")}
+		_, err := RoleStrengthScores(rs, scores, 60)(user)
+		assert.Error(t, err)
+	})
 }
@@ -0,0 +1,12 @@
+//go:build authctl
+
+package main
+
+import "os"
+
+// main authctl命令行入口，使用 go build -tags authctl -o authctl . 构建
+//
+// 本模块的根包即为main包，其他目录无法导入，因此入口以构建标签放在根包中，不影响作为库使用时的构建。
+func main() {
+	os.Exit(RunAuthCtl(os.Args[1:], os.Stdout, os.Stderr, os.Getenv))
+}
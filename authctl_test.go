@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunAuthCtl(t *testing.T) {
+	noEnv := func(string) string { return "" }
+
+	t.Run("参数错误", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, authCtlExitUsage, RunAuthCtl(nil, &stdout, &stderr, noEnv))
+		assert.Contains(t, stderr.String(), "用法")
+
+		stderr.Reset()
+		assert.Equal(t, authCtlExitUsage, RunAuthCtl([]string{"drop-everything"}, &stdout, &stderr, noEnv))
+		assert.Contains(t, stderr.String(), ErrUnknownCommand.Error())
+
+		stderr.Reset()
+		assert.Equal(t, authCtlExitUsage, RunAuthCtl([]string{"list-users"}, &stdout, &stderr, noEnv))
+		assert.Contains(t, stderr.String(), "AUTHCTL_DSN")
+
+		env := func(key string) string {
+			if key == "AUTHCTL_DRIVER" {
+				return "oracle"
+			}
+			return "dsn"
+		}
+		assert.Equal(t, authCtlExitError, RunAuthCtl([]string{"list-users"}, &stdout, &stderr, env))
+		assert.Empty(t, stdout.String())
+	})
+
+	t.Run("生成邀请码", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, authCtlExitOK, RunAuthCtl([]string{"--json", "generate-invite", "--count", "3"}, &stdout, &stderr, noEnv))
+
+		var result struct {
+			Codes []string `json:"codes"`
+		}
+		assert.NoError(t, json.Unmarshal(stdout.Bytes(), &result))
+		assert.Len(t, result.Codes, 3)
+		for _, code := range result.Codes {
+			valid, err := NewUserService(nil).ValidateInvitationCode(code)
+			assert.NoError(t, err)
+			assert.True(t, valid)
+			assert.Equal(t, strings.ToUpper(code), code)
+		}
+
+		stdout.Reset()
+		assert.Equal(t, authCtlExitOK, RunAuthCtl([]string{"generate-invite"}, &stdout, &stderr, noEnv))
+		assert.Len(t, strings.TrimSpace(stdout.String()), 8)
+
+		assert.Equal(t, authCtlExitUsage, RunAuthCtl([]string{"generate-invite", "--count", "0"}, &stdout, &stderr, noEnv))
+	})
+}
+
+func TestAuthCtlArguments(t *testing.T) {
+	ctl := NewAuthCtl(nil, &bytes.Buffer{})
+
+	t.Run("覆盖数据的命令需要确认", func(t *testing.T) {
+		err := ctl.Execute([]string{"set-password", "--user", "alice", "--password", "N3w#Passw0rd"})
+		assert.True(t, errors.Is(err, ErrConfirmationRequired))
+
+		err = ctl.Execute([]string{"revoke-tokens", "--user", "alice"})
+		assert.True(t, errors.Is(err, ErrConfirmationRequired))
+	})
+
+	t.Run("缺少必需参数", func(t *testing.T) {
+		err := ctl.Execute([]string{"create-user", "--username", "alice"})
+		assert.True(t, errors.Is(err, ErrMissingArgument))
+		assert.Contains(t, err.Error(), "--email")
+
+		err = ctl.Execute([]string{"assign-role", "--user", "alice"})
+		assert.True(t, errors.Is(err, ErrMissingArgument))
+
+		err = ctl.Execute(nil)
+		assert.True(t, errors.Is(err, ErrMissingArgument))
+	})
+}
+
+func TestAuthCtl(t *testing.T) {
+	// 设置测试数据库
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	userService := NewUserService(testDB.DB)
+	roleService := NewRoleService(testDB.DB)
+	authService := NewAuthService(testDB.DB, userService, NewTokenService("test-secret-key", time.Hour))
+
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := NewAuthCtl(testDB.DB, &out).Execute(args)
+		return out.String(), err
+	}
+
+	t.Run("初始化角色权限可重复执行", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		out, err := run("seed-rbac", "--json")
+		assert.NoError(t, err)
+		var result authCtlSeedResult
+		assert.NoError(t, json.Unmarshal([]byte(out), &result))
+		assert.Equal(t, authCtlSeedResult{RolesCreated: 2, PermissionsCreated: len(DefaultPermissions()), AssignmentsCreated: len(DefaultPermissions()) + 1}, result)
+
+		out, err = run("seed-rbac", "--json")
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal([]byte(out), &result))
+		assert.Equal(t, authCtlSeedResult{}, result)
+	})
+
+	t.Run("创建管理员并登录", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+		_, err := run("seed-rbac")
+		assert.NoError(t, err)
+
+		out, err := run("create-user", "--username", "root", "--email", "root@example.com", "--role", "admin", "--verified", "--json")
+		assert.NoError(t, err)
+		var result authCtlUserResult
+		assert.NoError(t, json.Unmarshal([]byte(out), &result))
+		assert.NotEmpty(t, result.Password)
+		assert.Equal(t, []string{"admin"}, result.Roles)
+
+		user, _, err := authService.Login("root", result.Password)
+		assert.NoError(t, err)
+		assert.True(t, user.EmailVerified)
+
+		hasPermission, err := roleService.HasPermission(user.ID, PermissionResourceUser, PermissionActionReadPII)
+		assert.NoError(t, err)
+		assert.True(t, hasPermission)
+
+		// 角色不存在时不创建用户
+		_, err = run("create-user", "--username", "ghost", "--email", "ghost@example.com", "--role", "missing")
+		assert.True(t, errors.Is(err, ErrRoleNotFound))
+		_, err = userService.GetUserByUsername("ghost")
+		assert.True(t, errors.Is(err, ErrUserNotFound))
+	})
+
+	t.Run("重置密码和撤销Token", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+		user := testDB.CreateTestUser("alice", "alice@example.com", "Old#Passw0rd")
+
+		out, err := run("set-password", "--user", "alice@example.com", "--password", "N3w#Passw0rd!", "--yes")
+		assert.NoError(t, err)
+		assert.Contains(t, out, "alice")
+		assert.NotContains(t, out, "N3w#Passw0rd!")
+
+		_, _, err = authService.Login("alice", "Old#Passw0rd")
+		assert.Error(t, err)
+		_, _, err = authService.Login("alice", "N3w#Passw0rd!")
+		assert.NoError(t, err)
+
+		// 使用数据库水位线和盐值的JWTService，签发在撤销之前的Token失效
+		jwtService := NewJWTService(&JWTConfig{
+			SecretKey:         "test-secret-key",
+			DefaultExpiration: time.Hour,
+			WatermarkStorage:  NewGormTokenWatermarkStorage(testDB.DB),
+			TokenSalts:        NewGormTokenSaltStorage(testDB.DB),
+		})
+		token, err := jwtService.GenerateToken(user.ID)
+		assert.NoError(t, err)
+		saltBefore, err := NewGormTokenSaltStorage(testDB.DB).Get(user.ID)
+		assert.NoError(t, err)
+
+		before := time.Now().Add(-time.Second)
+		var revokeOut, warning bytes.Buffer
+		ctl := NewAuthCtl(testDB.DB, &revokeOut)
+		ctl.errOut = &warning
+		assert.NoError(t, ctl.Execute([]string{"revoke-tokens", "--user", "alice", "--yes"}))
+		assert.Contains(t, warning.String(), "RejectStaleCredentials")
+		assert.Contains(t, revokeOut.String(), "Token水位线")
+
+		updated, err := userService.GetUserByID(user.ID)
+		assert.NoError(t, err)
+		assert.NotNil(t, updated.PasswordChangedAt)
+		assert.True(t, updated.PasswordChangedAt.After(before))
+		cutoff, err := NewGormTokenWatermarkStorage(testDB.DB).Get(user.ID)
+		assert.NoError(t, err)
+		assert.True(t, cutoff.After(before))
+		saltAfter, err := NewGormTokenSaltStorage(testDB.DB).Get(user.ID)
+		assert.NoError(t, err)
+		assert.NotEqual(t, saltBefore, saltAfter)
+		_, err = jwtService.ValidateToken(token)
+		assert.Error(t, err)
+	})
+
+	t.Run("分配角色和列出用户", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+		_, err := run("seed-rbac")
+		assert.NoError(t, err)
+		alice := testDB.CreateTestUser("alice", "alice@example.com", "password")
+		bob := testDB.CreateTestUser("bob", "bob@example.com", "password")
+		assert.NoError(t, userService.DeleteUser(bob.ID))
+
+		_, err = run("assign-role", "--user", alice.Username, "--role", "user")
+		assert.NoError(t, err)
+		hasRole, err := roleService.HasRole(alice.ID, "user")
+		assert.NoError(t, err)
+		assert.True(t, hasRole)
+
+		out, err := run("list-users")
+		assert.NoError(t, err)
+		assert.Contains(t, out, "alice@example.com")
+		assert.NotContains(t, out, "bob")
+
+		out, err = run("list-users", "--deleted", "--json")
+		assert.NoError(t, err)
+		var result authCtlListResult
+		assert.NoError(t, json.Unmarshal([]byte(out), &result))
+		assert.Equal(t, int64(2), result.Total)
+		assert.Len(t, result.Users, 2)
+	})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// AuthorizationContextKey 实时角色权限上下文键
+	AuthorizationContextKey ContextKey = "authorization"
+)
+
+// AuthorizationClaims 从数据库加载的用户实时角色和权限
+type AuthorizationClaims struct {
+	UserID      uint                `json:"user_id"`
+	Roles       []string            `json:"roles"`
+	Permissions map[string][]string `json:"permissions"` // 资源 -> 操作列表
+	LoadedAt    time.Time           `json:"loaded_at"`
+}
+
+// HasRole 检查是否拥有指定角色
+func (c *AuthorizationClaims) HasRole(roleName string) bool {
+	for _, role := range c.Roles {
+		if role == roleName {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission 检查是否拥有指定权限，与RoleService.HasPermission一样不区分大小写
+func (c *AuthorizationClaims) HasPermission(resource, action string) bool {
+	action = normalizePermissionPart(action)
+	for _, allowed := range c.Permissions[normalizePermissionPart(resource)] {
+		if allowed == action {
+			return true
+		}
+	}
+	return false
+}
+
+// loadAuthorizationClaims 从角色服务加载用户的角色和权限
+func loadAuthorizationClaims(rs RoleService, userID uint) (*AuthorizationClaims, error) {
+	roles, err := rs.GetUserRoles(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &AuthorizationClaims{
+		UserID:      userID,
+		Roles:       make([]string, 0, len(roles)),
+		Permissions: make(map[string][]string),
+		LoadedAt:    time.Now(),
+	}
+
+	roleIDs := make([]uint, 0, len(roles))
+	for _, role := range roles {
+		claims.Roles = append(claims.Roles, role.Name)
+		roleIDs = append(roleIDs, role.ID)
+	}
+
+	// 一次查询获取所有角色的权限
+	rolePermissions, err := rs.GetPermissionsForRoles(roleIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[uint]bool)
+	for _, role := range roles {
+		for _, permission := range rolePermissions[role.ID] {
+			if seen[permission.ID] {
+				continue
+			}
+			seen[permission.ID] = true
+			claims.Permissions[permission.Resource] = append(claims.Permissions[permission.Resource], permission.Action)
+		}
+	}
+
+	return claims, nil
+}
+
+// authorizationCache 按用户缓存实时角色权限，缓存期内的角色变更需调用Invalidate立即生效
+type authorizationCache struct {
+	ttl     time.Duration
+	entries map[uint]*AuthorizationClaims
+	mutex   sync.RWMutex
+}
+
+// newAuthorizationCache 创建角色权限缓存
+func newAuthorizationCache(ttl time.Duration) *authorizationCache {
+	return &authorizationCache{
+		ttl:     ttl,
+		entries: make(map[uint]*AuthorizationClaims),
+	}
+}
+
+// Get 获取未过期的缓存
+func (c *authorizationCache) Get(userID uint) (*AuthorizationClaims, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	claims, exists := c.entries[userID]
+	if !exists || time.Since(claims.LoadedAt) >= c.ttl {
+		return nil, false
+	}
+	return claims, true
+}
+
+// Set 写入缓存
+func (c *authorizationCache) Set(claims *AuthorizationClaims) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries[claims.UserID] = claims
+}
+
+// Invalidate 清除用户的缓存
+func (c *authorizationCache) Invalidate(userID uint) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.entries, userID)
+}
+
+// GetAuthorizationFromContext 从上下文获取实时角色权限
+func GetAuthorizationFromContext(ctx context.Context) (*AuthorizationClaims, bool) {
+	claims, ok := ctx.Value(AuthorizationContextKey).(*AuthorizationClaims)
+	return claims, ok
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubRoleService 测试用角色服务，只实现加载角色权限所需的方法
+type stubRoleService struct {
+	RoleService
+	roles       []*Role
+	permissions map[uint][]*Permission
+	err         error
+	loads       atomic.Int32
+}
+
+func (s *stubRoleService) GetUserRoles(userID uint) ([]*Role, error) {
+	s.loads.Add(1)
+	return s.roles, s.err
+}
+
+func (s *stubRoleService) GetPermissionsForRoles(roleIDs []uint) (map[uint][]*Permission, error) {
+	result := make(map[uint][]*Permission)
+	for _, roleID := range roleIDs {
+		if permissions, ok := s.permissions[roleID]; ok {
+			result[roleID] = permissions
+		}
+	}
+	return result, nil
+}
+
+func TestRefreshClaimsFromDB(t *testing.T) {
+	editor := &Role{Name: "editor"}
+	editor.ID = 1
+	viewer := &Role{Name: "viewer"}
+	viewer.ID = 2
+	read := &Permission{Resource: "article", Action: "read"}
+	read.ID = 10
+	write := &Permission{Resource: "article", Action: "write"}
+	write.ID = 11
+
+	user := &User{Username: "alice"}
+	user.ID = 7
+
+	serve := func(handler http.Handler, withUser bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/articles", nil)
+		if withUser {
+			req = req.WithContext(context.WithValue(req.Context(), UserContextKey, user))
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	newHandler := func(middleware *AuthMiddleware, rs RoleService, seen **AuthorizationClaims) http.Handler {
+		return middleware.RefreshClaimsFromDB(rs)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*seen, _ = GetAuthorizationFromContext(r.Context())
+			w.WriteHeader(http.StatusOK)
+		}))
+	}
+
+	t.Run("写入实时角色权限", func(t *testing.T) {
+		rs := &stubRoleService{
+			roles:       []*Role{editor, viewer},
+			permissions: map[uint][]*Permission{1: {read, write}, 2: {read}},
+		}
+		var claims *AuthorizationClaims
+		recorder := serve(newHandler(NewAuthMiddleware(nil), rs, &claims), true)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, uint(7), claims.UserID)
+		assert.Equal(t, []string{"editor", "viewer"}, claims.Roles)
+		assert.True(t, claims.HasRole("editor"))
+		assert.False(t, claims.HasRole("admin"))
+		assert.True(t, claims.HasPermission("article", "write"))
+		assert.False(t, claims.HasPermission("article", "delete"))
+		assert.True(t, claims.HasPermission("Article", "WRITE"))
+		// 多个角色共有的权限只记录一次
+		assert.Equal(t, []string{"read", "write"}, claims.Permissions["article"])
+	})
+
+	t.Run("未开启缓存时每次请求都重新加载", func(t *testing.T) {
+		rs := &stubRoleService{roles: []*Role{editor}}
+		var claims *AuthorizationClaims
+		handler := newHandler(NewAuthMiddleware(nil), rs, &claims)
+
+		serve(handler, true)
+		assert.True(t, claims.HasRole("editor"))
+
+		// 角色变更在下一次请求立即生效
+		rs.roles = []*Role{viewer}
+		serve(handler, true)
+		assert.False(t, claims.HasRole("editor"))
+		assert.True(t, claims.HasRole("viewer"))
+		assert.Equal(t, int32(2), rs.loads.Load())
+	})
+
+	t.Run("开启缓存", func(t *testing.T) {
+		rs := &stubRoleService{roles: []*Role{editor}}
+		middleware := NewAuthMiddleware(nil)
+		middleware.SetClaimsCacheTTL(50 * time.Millisecond)
+		var claims *AuthorizationClaims
+		handler := newHandler(middleware, rs, &claims)
+
+		serve(handler, true)
+		rs.roles = []*Role{viewer}
+		serve(handler, true)
+		assert.True(t, claims.HasRole("editor"))
+		assert.Equal(t, int32(1), rs.loads.Load())
+
+		// 主动失效后立即重新加载
+		middleware.InvalidateClaims(user.ID)
+		serve(handler, true)
+		assert.True(t, claims.HasRole("viewer"))
+		assert.Equal(t, int32(2), rs.loads.Load())
+
+		// 缓存过期后重新加载
+		rs.roles = []*Role{editor}
+		time.Sleep(60 * time.Millisecond)
+		serve(handler, true)
+		assert.True(t, claims.HasRole("editor"))
+		assert.Equal(t, int32(3), rs.loads.Load())
+	})
+
+	t.Run("加载失败和缺少认证上下文", func(t *testing.T) {
+		rs := &stubRoleService{err: errors.New("数据库不可用")}
+		var claims *AuthorizationClaims
+		handler := newHandler(NewAuthMiddleware(nil), rs, &claims)
+
+		recorder := serve(handler, true)
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+
+		recorder = serve(handler, false)
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		assert.Nil(t, claims)
+	})
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 登录挑战类型
+const (
+	ChallengeNone      = "none"
+	ChallengeCaptcha   = "captcha"
+	ChallengeEmailCode = "email_code"
+)
+
+// VerificationPurposeLoginChallenge 登录挑战邮箱验证码的用途
+const VerificationPurposeLoginChallenge = "login_challenge"
+
+// 登录挑战错误定义
+var (
+	ErrChallengeRequired   = errors.New("需要完成登录验证")
+	ErrCaptchaInvalid      = errors.New("人机验证未通过")
+	ErrChallengeNotEnabled = errors.New("未启用登录挑战")
+)
+
+// ChallengeRequiredError 登录前需要完成的挑战，可用errors.Is匹配ErrChallengeRequired
+type ChallengeRequiredError struct {
+	Challenge string // 需要完成的挑战类型：captcha/email_code
+	Failures  int    // 当前连续失败次数
+}
+
+// Error 实现error接口
+func (e *ChallengeRequiredError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrChallengeRequired.Error(), e.Challenge)
+}
+
+// Is 支持errors.Is(err, ErrChallengeRequired)
+func (e *ChallengeRequiredError) Is(target error) bool {
+	return target == ErrChallengeRequired
+}
+
+// LoginChallengePolicy 登录挑战策略，按用户名的连续失败次数逐级升级挑战
+type LoginChallengePolicy struct {
+	CaptchaAfter      int           // 连续失败达到该次数后需要人机验证
+	EmailCodeAfter    int           // 连续失败达到该次数后需要邮箱验证码
+	FailureWindow     time.Duration // 失败计数有效期，期满后自动清零
+	ChallengeValidity time.Duration // 完成挑战后允许尝试密码的有效期
+	EmailCodeTTL      time.Duration // 邮箱验证码有效期
+	EmailCodeDigits   int           // 邮箱验证码位数
+}
+
+// DefaultLoginChallengePolicy 默认登录挑战策略：前3次失败不挑战，之后需要人机验证，10次后需要邮箱验证码
+func DefaultLoginChallengePolicy() *LoginChallengePolicy {
+	return &LoginChallengePolicy{
+		CaptchaAfter:      3,
+		EmailCodeAfter:    10,
+		FailureWindow:     time.Hour,
+		ChallengeValidity: 5 * time.Minute,
+		EmailCodeTTL:      10 * time.Minute,
+		EmailCodeDigits:   6,
+	}
+}
+
+// RequiredChallenge 根据连续失败次数返回需要完成的挑战
+func (p *LoginChallengePolicy) RequiredChallenge(failures int) string {
+	if p.EmailCodeAfter > 0 && failures >= p.EmailCodeAfter {
+		return ChallengeEmailCode
+	}
+	if p.CaptchaAfter > 0 && failures >= p.CaptchaAfter {
+		return ChallengeCaptcha
+	}
+	return ChallengeNone
+}
+
+// CaptchaVerifier 人机验证接口，由接入方对接具体的验证码服务
+type CaptchaVerifier interface {
+	Verify(captchaToken string) (bool, error)
+}
+
+// LoginChallenger 登录挑战管理器，失败计数和挑战状态保存在限流存储中
+type LoginChallenger struct {
+	policy  *LoginChallengePolicy
+	store   RateLimitStore
+	captcha CaptchaVerifier
+	codes   VerificationCodeService
+}
+
+// NewLoginChallenger 创建登录挑战管理器
+func NewLoginChallenger(policy *LoginChallengePolicy, store RateLimitStore, captcha CaptchaVerifier, codes VerificationCodeService) *LoginChallenger {
+	if policy == nil {
+		policy = DefaultLoginChallengePolicy()
+	}
+
+	return &LoginChallenger{
+		policy:  policy,
+		store:   store,
+		captcha: captcha,
+		codes:   codes,
+	}
+}
+
+// RequiredChallenge 获取用户名当前需要完成的挑战
+func (c *LoginChallenger) RequiredChallenge(username string) (string, error) {
+	failures, err := c.store.Get(c.failureKey(username))
+	if err != nil {
+		return "", err
+	}
+	return c.policy.RequiredChallenge(failures), nil
+}
+
+// CheckChallenge 检查是否允许尝试密码，需要挑战且尚未完成时返回*ChallengeRequiredError
+func (c *LoginChallenger) CheckChallenge(username string) error {
+	failures, err := c.store.Get(c.failureKey(username))
+	if err != nil {
+		return err
+	}
+
+	challenge := c.policy.RequiredChallenge(failures)
+	if challenge == ChallengeNone {
+		return nil
+	}
+
+	passed, err := c.store.Get(c.passedKey(username, challenge))
+	if err != nil {
+		return err
+	}
+	if passed == 0 {
+		return &ChallengeRequiredError{Challenge: challenge, Failures: failures}
+	}
+	return nil
+}
+
+// RecordFailure 记录一次登录失败，已完成的挑战只能用于一次密码尝试
+func (c *LoginChallenger) RecordFailure(username string) error {
+	if _, err := c.store.Increment(c.failureKey(username), c.policy.FailureWindow); err != nil {
+		return err
+	}
+	return c.resetPassed(username)
+}
+
+// RecordSuccess 登录成功后清除失败计数和挑战状态
+func (c *LoginChallenger) RecordSuccess(username string) error {
+	if err := c.store.Reset(c.failureKey(username)); err != nil {
+		return err
+	}
+	return c.resetPassed(username)
+}
+
+// VerifyCaptcha 完成人机验证
+func (c *LoginChallenger) VerifyCaptcha(username, captchaToken string) error {
+	if c.captcha == nil {
+		return ErrChallengeNotEnabled
+	}
+
+	valid, err := c.captcha.Verify(captchaToken)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return ErrCaptchaInvalid
+	}
+
+	return c.markPassed(username, ChallengeCaptcha)
+}
+
+// IssueEmailCode 为用户签发登录挑战邮箱验证码，由调用方负责发送
+func (c *LoginChallenger) IssueEmailCode(userID uint) (string, error) {
+	if c.codes == nil {
+		return "", ErrChallengeNotEnabled
+	}
+	return c.codes.Issue(userID, VerificationPurposeLoginChallenge, c.policy.EmailCodeTTL, c.policy.EmailCodeDigits)
+}
+
+// VerifyEmailCode 完成邮箱验证码挑战，同时满足人机验证的要求
+func (c *LoginChallenger) VerifyEmailCode(username string, userID uint, code string) error {
+	if c.codes == nil {
+		return ErrChallengeNotEnabled
+	}
+
+	if err := c.codes.Verify(userID, VerificationPurposeLoginChallenge, code); err != nil {
+		return err
+	}
+
+	if err := c.markPassed(username, ChallengeEmailCode); err != nil {
+		return err
+	}
+	return c.markPassed(username, ChallengeCaptcha)
+}
+
+// ChallengePassed 检查用户名是否已完成指定挑战且仍在有效期内
+func (c *LoginChallenger) ChallengePassed(username, challenge string) (bool, error) {
+	passed, err := c.store.Get(c.passedKey(username, challenge))
+	return passed > 0, err
+}
+
+// markPassed 标记用户名已完成指定挑战
+func (c *LoginChallenger) markPassed(username, challenge string) error {
+	_, err := c.store.Increment(c.passedKey(username, challenge), c.policy.ChallengeValidity)
+	return err
+}
+
+// resetPassed 清除用户名已完成的挑战
+func (c *LoginChallenger) resetPassed(username string) error {
+	for _, challenge := range []string{ChallengeCaptcha, ChallengeEmailCode} {
+		if err := c.store.Reset(c.passedKey(username, challenge)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// failureKey 用户名失败计数的存储键
+func (c *LoginChallenger) failureKey(username string) string {
+	return "login_failures:" + strings.ToLower(username)
+}
+
+// passedKey 用户名已完成挑战的存储键
+func (c *LoginChallenger) passedKey(username, challenge string) string {
+	return "login_challenge_passed:" + challenge + ":" + strings.ToLower(username)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubCaptchaVerifier 测试用人机验证，只接受固定的token
+type stubCaptchaVerifier struct {
+	validToken string
+}
+
+func (v *stubCaptchaVerifier) Verify(captchaToken string) (bool, error) {
+	return captchaToken == v.validToken, nil
+}
+
+func TestLoginChallengePolicy(t *testing.T) {
+	policy := DefaultLoginChallengePolicy()
+
+	for failures := 0; failures < 3; failures++ {
+		assert.Equal(t, ChallengeNone, policy.RequiredChallenge(failures))
+	}
+	for failures := 3; failures < 10; failures++ {
+		assert.Equal(t, ChallengeCaptcha, policy.RequiredChallenge(failures))
+	}
+	assert.Equal(t, ChallengeEmailCode, policy.RequiredChallenge(10))
+	assert.Equal(t, ChallengeEmailCode, policy.RequiredChallenge(50))
+
+	// 阈值为0时不启用对应挑战
+	disabled := &LoginChallengePolicy{}
+	assert.Equal(t, ChallengeNone, disabled.RequiredChallenge(100))
+}
+
+func TestLoginChallenger(t *testing.T) {
+	newChallenger := func() *LoginChallenger {
+		codes := NewVerificationCodeService(NewMemoryVerificationCodeStorage(), nil)
+		return NewLoginChallenger(nil, NewMemoryRateLimitStore(), &stubCaptchaVerifier{validToken: "human"}, codes)
+	}
+
+	t.Run("按失败次数逐级升级挑战", func(t *testing.T) {
+		challenger := newChallenger()
+
+		// 前3次失败不需要挑战
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, challenger.CheckChallenge("alice"))
+			assert.NoError(t, challenger.RecordFailure("alice"))
+		}
+
+		// 之后需要人机验证
+		err := challenger.CheckChallenge("alice")
+		var challengeErr *ChallengeRequiredError
+		assert.True(t, errors.As(err, &challengeErr))
+		assert.True(t, errors.Is(err, ErrChallengeRequired))
+		assert.Equal(t, ChallengeCaptcha, challengeErr.Challenge)
+		assert.Equal(t, 3, challengeErr.Failures)
+
+		assert.True(t, errors.Is(challenger.VerifyCaptcha("alice", "robot"), ErrCaptchaInvalid))
+		for i := 3; i < 10; i++ {
+			assert.NoError(t, challenger.VerifyCaptcha("alice", "human"))
+			assert.NoError(t, challenger.CheckChallenge("alice"))
+			assert.NoError(t, challenger.RecordFailure("alice"))
+
+			// 每次完成挑战只能尝试一次密码
+			assert.True(t, errors.Is(challenger.CheckChallenge("alice"), ErrChallengeRequired))
+		}
+
+		// 10次失败后需要邮箱验证码，人机验证不再足够
+		challenge, err := challenger.RequiredChallenge("alice")
+		assert.NoError(t, err)
+		assert.Equal(t, ChallengeEmailCode, challenge)
+		assert.NoError(t, challenger.VerifyCaptcha("alice", "human"))
+		err = challenger.CheckChallenge("alice")
+		assert.True(t, errors.As(err, &challengeErr))
+		assert.Equal(t, ChallengeEmailCode, challengeErr.Challenge)
+
+		code, err := challenger.IssueEmailCode(1)
+		assert.NoError(t, err)
+		assert.Error(t, challenger.VerifyEmailCode("alice", 1, wrongVerificationCode(code)))
+		assert.NoError(t, challenger.VerifyEmailCode("alice", 1, code))
+		assert.NoError(t, challenger.CheckChallenge("alice"))
+	})
+
+	t.Run("登录成功后重置", func(t *testing.T) {
+		challenger := newChallenger()
+
+		for i := 0; i < 5; i++ {
+			assert.NoError(t, challenger.RecordFailure("bob"))
+		}
+		assert.True(t, errors.Is(challenger.CheckChallenge("bob"), ErrChallengeRequired))
+
+		assert.NoError(t, challenger.RecordSuccess("bob"))
+		challenge, err := challenger.RequiredChallenge("bob")
+		assert.NoError(t, err)
+		assert.Equal(t, ChallengeNone, challenge)
+		assert.NoError(t, challenger.CheckChallenge("bob"))
+	})
+
+	t.Run("用户名不区分大小写且互相隔离", func(t *testing.T) {
+		challenger := newChallenger()
+
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, challenger.RecordFailure("Carol"))
+		}
+		assert.True(t, errors.Is(challenger.CheckChallenge("carol"), ErrChallengeRequired))
+		assert.NoError(t, challenger.CheckChallenge("dave"))
+	})
+
+	t.Run("未配置验证方式", func(t *testing.T) {
+		challenger := NewLoginChallenger(nil, NewMemoryRateLimitStore(), nil, nil)
+
+		assert.True(t, errors.Is(challenger.VerifyCaptcha("alice", "human"), ErrChallengeNotEnabled))
+		_, err := challenger.IssueEmailCode(1)
+		assert.True(t, errors.Is(err, ErrChallengeNotEnabled))
+	})
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+
+	count, err := store.Increment("key", 50*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	count, _ = store.Increment("key", 50*time.Millisecond)
+	assert.Equal(t, 2, count)
+
+	count, err = store.Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	// 窗口期结束后自动清零
+	time.Sleep(100 * time.Millisecond)
+	count, _ = store.Get("key")
+	assert.Equal(t, 0, count)
+	count, _ = store.Increment("key", time.Minute)
+	assert.Equal(t, 1, count)
+
+	assert.NoError(t, store.Reset("key"))
+	count, _ = store.Get("key")
+	assert.Equal(t, 0, count)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock 时间来源，Token、限流、账户锁定和密码历史等组件通过它获取当前时间，测试中可替换为FakeClock
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock 使用系统时间的时钟
+type systemClock struct{}
+
+// Now 获取系统当前时间
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// clockOrDefault 未配置时钟时使用系统时间
+func clockOrDefault(clock Clock) Clock {
+	if clock == nil {
+		return systemClock{}
+	}
+	return clock
+}
+
+// FakeClock 手动推进的时钟，用于测试过期、刷新窗口和锁定时长等与时间相关的行为，无需等待
+type FakeClock struct {
+	now   time.Time
+	mutex sync.RWMutex
+}
+
+// NewFakeClock 创建从指定时间开始的时钟，now为零值时从当前系统时间开始
+func NewFakeClock(now time.Time) *FakeClock {
+	if now.IsZero() {
+		now = time.Now()
+	}
+	return &FakeClock{now: now}
+}
+
+// Now 获取时钟当前时间
+func (c *FakeClock) Now() time.Time {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.now
+}
+
+// Advance 将时钟向后推进d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set 将时钟设置为指定时间
+func (c *FakeClock) Set(now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = now
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	assert.Equal(t, start, clock.Now())
+
+	clock.Advance(90 * time.Minute)
+	assert.Equal(t, start.Add(90*time.Minute), clock.Now())
+
+	clock.Set(start)
+	assert.Equal(t, start, clock.Now())
+
+	// 零值从当前系统时间开始
+	assert.WithinDuration(t, time.Now(), NewFakeClock(time.Time{}).Now(), time.Second)
+	assert.IsType(t, systemClock{}, clockOrDefault(nil))
+	assert.Equal(t, clock, clockOrDefault(clock))
+}
+
+func TestMemoryRateLimitStoreClock(t *testing.T) {
+	clock := NewFakeClock(time.Time{})
+	store := NewMemoryRateLimitStoreWithClock(clock)
+
+	count, err := store.Increment("login:alice", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	count, _ = store.Increment("login:alice", time.Minute)
+	assert.Equal(t, 2, count)
+
+	// 窗口期结束后重新计数
+	clock.Advance(time.Minute)
+	count, _ = store.Get("login:alice")
+	assert.Equal(t, 0, count)
+	count, _ = store.Increment("login:alice", time.Minute)
+	assert.Equal(t, 1, count)
+}
+
+func TestMemoryHistoryStorageClock(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	storage := NewMemoryHistoryStorageWithClock(clock)
+
+	assert.NoError(t, storage.Add(1, "hash-1"))
+	clock.Advance(24 * time.Hour)
+	assert.NoError(t, storage.Add(1, "hash-2"))
+
+	histories, err := storage.GetHistory(1, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, histories, 2) {
+		assert.Equal(t, clock.Now(), histories[0].CreatedAt)
+		assert.Equal(t, clock.Now().Add(-24*time.Hour), histories[1].CreatedAt)
+	}
+}
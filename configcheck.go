@@ -0,0 +1,269 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidConfiguration 配置自检未通过
+var ErrInvalidConfiguration = errors.New("配置自检未通过")
+
+// ConfigSeverity 配置问题的严重程度
+type ConfigSeverity string
+
+// 配置问题严重程度
+const (
+	ConfigSeverityWarning ConfigSeverity = "warning" // 可以运行，但行为可能与预期不符
+	ConfigSeverityError   ConfigSeverity = "error"   // 相关功能无法正常工作
+)
+
+// ConfigWarning 配置自检发现的问题
+type ConfigWarning struct {
+	Config   string         `json:"config"` // 配置类型，如JWTConfig
+	Field    string         `json:"field"`  // 相关字段，涉及多个字段时以逗号分隔
+	Severity ConfigSeverity `json:"severity"`
+	Message  string         `json:"message"`
+}
+
+// String 格式化为一行日志
+func (w ConfigWarning) String() string {
+	return fmt.Sprintf("[%s] %s.%s: %s", w.Severity, w.Config, w.Field, w.Message)
+}
+
+// ConfigValidator 可自检的配置
+type ConfigValidator interface {
+	Validate() []ConfigWarning
+}
+
+// ValidateConfiguration 依次自检各项配置，返回发现的全部问题
+func ValidateConfiguration(configs ...ConfigValidator) []ConfigWarning {
+	var warnings []ConfigWarning
+	for _, config := range configs {
+		warnings = append(warnings, config.Validate()...)
+	}
+	return warnings
+}
+
+// CheckConfiguration 自检配置，存在错误时返回包装ErrInvalidConfiguration的错误
+//
+// strictConfig为true时警告同样视为失败，否则警告只记录日志。
+func CheckConfiguration(strictConfig bool, configs ...ConfigValidator) error {
+	var failures []string
+	for _, warning := range ValidateConfiguration(configs...) {
+		if warning.Severity == ConfigSeverityError || strictConfig {
+			failures = append(failures, warning.String())
+			continue
+		}
+		log.Printf("配置自检: %s", warning)
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidConfiguration, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// Validate 自检JWT配置，重点检查刷新窗口与Token有效期的关系
+func (c *JWTConfig) Validate() []ConfigWarning {
+	var warnings []ConfigWarning
+	add := func(field string, severity ConfigSeverity, format string, args ...any) {
+		warnings = append(warnings, ConfigWarning{Config: "JWTConfig", Field: field, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case c.SecretKey == "":
+		add("SecretKey", ConfigSeverityError, "签名密钥为空")
+	case c.SecretKey == DefaultJWTConfig().SecretKey:
+		add("SecretKey", ConfigSeverityWarning, "仍在使用默认签名密钥")
+	case len(c.SecretKey) < 32:
+		add("SecretKey", ConfigSeverityWarning, "签名密钥只有%d字节，HMAC密钥建议至少32字节", len(c.SecretKey))
+	}
+	for i, key := range c.PreviousSecretKeys {
+		if string(key) == c.SecretKey {
+			add("PreviousSecretKeys", ConfigSeverityWarning, "第%d个旧密钥与当前密钥相同", i+1)
+		}
+	}
+
+	if _, err := resolveSigningMethod(c.SigningMethod); err != nil {
+		add("SigningMethod", ConfigSeverityError, "不支持的签名算法%q，只支持HS256、HS384和HS512，服务将无法签发和验证Token", c.SigningMethod)
+	}
+
+	if c.DefaultExpiration <= 0 {
+		add("DefaultExpiration", ConfigSeverityError, "Token有效期必须大于0，否则无法签发Token")
+	}
+	if c.MaxSessionLifetime > 0 && c.MaxSessionLifetime < c.DefaultExpiration {
+		add("MaxSessionLifetime,DefaultExpiration", ConfigSeverityWarning,
+			"会话最长有效期%s短于Token有效期%s，Token会在过期前被拒绝", c.MaxSessionLifetime, c.DefaultExpiration)
+	}
+
+	if c.AllowRefresh {
+		// Token在到期前RefreshExpiration内才能刷新，即 签发时间+DefaultExpiration-RefreshExpiration 之后
+		switch {
+		case c.RefreshExpiration <= 0:
+			add("RefreshExpiration", ConfigSeverityError, "刷新窗口必须大于0，否则只有过期的Token才到刷新时间，而过期的Token无法刷新")
+		case c.DefaultExpiration > 0 && c.RefreshExpiration >= c.DefaultExpiration:
+			add("RefreshExpiration,DefaultExpiration", ConfigSeverityWarning,
+				"刷新窗口%s不短于Token有效期%s，Token签发后随时可以刷新，不会出现\"Token还未到刷新时间\"", c.RefreshExpiration, c.DefaultExpiration)
+		}
+		if c.MaxRefreshCount <= 0 {
+			add("MaxRefreshCount", ConfigSeverityError, "已允许刷新但刷新次数上限为%d，任何刷新都会失败", c.MaxRefreshCount)
+		}
+	}
+
+	if c.MaxTokensIssuedPerUserPerHour > 0 && c.TokenIssueSoftThreshold >= c.MaxTokensIssuedPerUserPerHour {
+		add("TokenIssueSoftThreshold,MaxTokensIssuedPerUserPerHour", ConfigSeverityWarning,
+			"签发异常阈值%d不低于每小时上限%d，达到上限前不会产生告警", c.TokenIssueSoftThreshold, c.MaxTokensIssuedPerUserPerHour)
+	}
+
+	return warnings
+}
+
+// Validate 自检密码管理配置，重点检查默认生成的密码能否满足默认策略
+func (c *PasswordManagerConfig) Validate() []ConfigWarning {
+	var warnings []ConfigWarning
+	add := func(field string, severity ConfigSeverity, format string, args ...any) {
+		warnings = append(warnings, ConfigWarning{Config: "PasswordManagerConfig", Field: field, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+		add("BcryptCost", ConfigSeverityWarning, "bcrypt代价%d超出[%d, %d]，将被重置为%d",
+			c.BcryptCost, bcrypt.MinCost, bcrypt.MaxCost, bcrypt.DefaultCost)
+	}
+
+	if c.MinStrengthScore > 100 {
+		add("MinStrengthScore", ConfigSeverityError, "强度分数最高为100，要求%d分的密码永远无法通过", c.MinStrengthScore)
+	}
+
+	policy := c.DefaultPolicy
+	if policy.MaxLength > 0 && policy.MinLength > policy.MaxLength {
+		add("DefaultPolicy.MinLength,DefaultPolicy.MaxLength", ConfigSeverityError,
+			"最小长度%d大于最大长度%d，任何密码都无法通过", policy.MinLength, policy.MaxLength)
+	}
+
+	// GenerateWithDefaults按DefaultLength生成包含全部字符类型的密码
+	switch {
+	case c.DefaultLength <= 0 || c.DefaultLength > 256:
+		add("DefaultLength", ConfigSeverityError, "默认生成长度%d超出(0, 256]，无法生成密码", c.DefaultLength)
+	case c.DefaultLength < policy.MinLength:
+		add("DefaultLength,DefaultPolicy.MinLength", ConfigSeverityError,
+			"默认生成长度%d小于策略最小长度%d，生成的密码不满足默认策略", c.DefaultLength, policy.MinLength)
+	case policy.MaxLength > 0 && c.DefaultLength > policy.MaxLength:
+		add("DefaultLength,DefaultPolicy.MaxLength", ConfigSeverityError,
+			"默认生成长度%d大于策略最大长度%d，生成的密码不满足默认策略", c.DefaultLength, policy.MaxLength)
+	case c.DefaultLength < policy.MinUniqueChars:
+		add("DefaultLength,DefaultPolicy.MinUniqueChars", ConfigSeverityError,
+			"默认生成长度%d小于策略要求的不同字符数%d，生成的密码不满足默认策略", c.DefaultLength, policy.MinUniqueChars)
+	}
+
+	if c.HistoryCount < 0 {
+		add("HistoryCount", ConfigSeverityError, "密码历史数量%d小于0，修改密码后清理历史记录时会越界", c.HistoryCount)
+	}
+
+	return warnings
+}
+
+// Validate 自检argon2参数
+func (c *PasswordConfig) Validate() []ConfigWarning {
+	var warnings []ConfigWarning
+	add := func(field string, severity ConfigSeverity, format string, args ...any) {
+		warnings = append(warnings, ConfigWarning{Config: "PasswordConfig", Field: field, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if c.Time == 0 {
+		add("Time", ConfigSeverityError, "迭代次数为0，argon2无法计算哈希")
+	}
+	if c.Threads == 0 {
+		add("Threads", ConfigSeverityError, "并行度为0，argon2无法计算哈希")
+	}
+
+	switch {
+	case c.Memory < minArgon2Memory:
+		add("Memory", ConfigSeverityWarning, "内存参数%dKiB低于OWASP建议的%dKiB", c.Memory, minArgon2Memory)
+	case c.Memory > maxArgon2Memory:
+		add("Memory", ConfigSeverityWarning, "内存参数%dKiB超过%dKiB，并发登录时容易耗尽内存", c.Memory, maxArgon2Memory)
+	}
+
+	if c.KeyLen < 16 {
+		add("KeyLen", ConfigSeverityWarning, "哈希长度%d字节过短，建议至少16字节", c.KeyLen)
+	}
+	if c.SaltLen < 16 {
+		add("SaltLen", ConfigSeverityWarning, "盐长度%d字节过短，建议至少16字节", c.SaltLen)
+	}
+	for i, pepper := range c.PreviousPeppers {
+		if len(c.Pepper) > 0 && string(pepper) == string(c.Pepper) {
+			add("PreviousPeppers", ConfigSeverityWarning, "第%d个旧pepper与当前pepper相同", i+1)
+		}
+	}
+
+	return warnings
+}
+
+// Validate 自检长期未登录策略的各阶段时长顺序
+func (c *DormancyConfig) Validate() []ConfigWarning {
+	var warnings []ConfigWarning
+	add := func(field string, severity ConfigSeverity, format string, args ...any) {
+		warnings = append(warnings, ConfigWarning{Config: "DormancyConfig", Field: field, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if c.WarnAfter <= 0 {
+		add("WarnAfter", ConfigSeverityError, "预警时长%s不大于0，所有用户都会被视为长期未登录", c.WarnAfter)
+	}
+	if c.DisableAfter <= c.WarnAfter {
+		add("WarnAfter,DisableAfter", ConfigSeverityError, "禁用时长%s不大于预警时长%s，用户收到预警后没有时间登录", c.DisableAfter, c.WarnAfter)
+	}
+	if c.DeleteAfter != 0 && c.DeleteAfter <= c.DisableAfter {
+		add("DisableAfter,DeleteAfter", ConfigSeverityError, "删除时长%s不大于禁用时长%s，账号禁用后会被立即删除", c.DeleteAfter, c.DisableAfter)
+	}
+
+	return warnings
+}
+
+// Validate 自检二次验证配置，检查发行方名称、时钟偏差和密钥加密
+func (c *TwoFactorConfig) Validate() []ConfigWarning {
+	var warnings []ConfigWarning
+	add := func(field string, severity ConfigSeverity, format string, args ...any) {
+		warnings = append(warnings, ConfigWarning{Config: "TwoFactorConfig", Field: field, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case c.Issuer == "":
+		add("Issuer", ConfigSeverityWarning, "发行方名称为空，用户在身份验证器应用中无法区分账户")
+	case strings.Contains(c.Issuer, ":"):
+		add("Issuer", ConfigSeverityError, "发行方名称%q包含冒号，身份验证器应用无法正确解析配置URI", c.Issuer)
+	}
+	if c.Skew > 2 {
+		add("Skew", ConfigSeverityWarning, "容许前后各%d个时间步，验证码在%s内有效，被截获后可用的时间变长", c.Skew, time.Duration(2*c.Skew+1)*totpPeriod)
+	}
+	if GetFieldEncryptor() == nil {
+		add("Secret", ConfigSeverityWarning, "未配置字段加密器，TOTP密钥将以明文保存在数据库中")
+	}
+
+	return warnings
+}
+
+// NewJWTServiceWithConfigCheck 自检配置后创建JWT服务，自检未通过时返回错误
+func NewJWTServiceWithConfigCheck(config *JWTConfig, strictConfig bool) (JWTService, error) {
+	if config == nil {
+		config = DefaultJWTConfig()
+	}
+	if err := CheckConfiguration(strictConfig, config); err != nil {
+		return nil, err
+	}
+	return NewJWTService(config), nil
+}
+
+// NewPasswordManagerWithConfigCheck 自检配置后创建密码管理器，自检未通过时返回错误
+func NewPasswordManagerWithConfigCheck(config *PasswordManagerConfig, strictConfig bool) (PasswordManager, error) {
+	if config == nil {
+		config = DefaultPasswordManagerConfig()
+	}
+	if err := CheckConfiguration(strictConfig, config); err != nil {
+		return nil, err
+	}
+	return NewPasswordManager(config), nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// configFields 提取自检结果中的字段和严重程度，便于断言
+func configFields(warnings []ConfigWarning) map[string]ConfigSeverity {
+	fields := make(map[string]ConfigSeverity, len(warnings))
+	for _, warning := range warnings {
+		fields[warning.Field] = warning.Severity
+	}
+	return fields
+}
+
+func TestJWTConfigValidate(t *testing.T) {
+	t.Run("默认配置", func(t *testing.T) {
+		// 默认密钥，且默认刷新窗口7天长于有效期24小时
+		fields := configFields(DefaultJWTConfig().Validate())
+		assert.Equal(t, map[string]ConfigSeverity{
+			"SecretKey":                           ConfigSeverityWarning,
+			"RefreshExpiration,DefaultExpiration": ConfigSeverityWarning,
+		}, fields)
+	})
+
+	t.Run("合理配置", func(t *testing.T) {
+		config := DefaultJWTConfig()
+		config.SecretKey = "0123456789abcdef0123456789abcdef"
+		config.RefreshExpiration = time.Hour
+		assert.Empty(t, config.Validate())
+	})
+
+	cases := []struct {
+		name     string
+		modify   func(c *JWTConfig)
+		field    string
+		severity ConfigSeverity
+	}{
+		{"空密钥", func(c *JWTConfig) { c.SecretKey = "" }, "SecretKey", ConfigSeverityError},
+		{"短密钥", func(c *JWTConfig) { c.SecretKey = "short" }, "SecretKey", ConfigSeverityWarning},
+		{"旧密钥与当前密钥相同", func(c *JWTConfig) { c.PreviousSecretKeys = [][]byte{[]byte(c.SecretKey)} }, "PreviousSecretKeys", ConfigSeverityWarning},
+		{"不支持的签名算法", func(c *JWTConfig) { c.SigningMethod = "RS256" }, "SigningMethod", ConfigSeverityError},
+		{"有效期为0", func(c *JWTConfig) { c.DefaultExpiration = 0 }, "DefaultExpiration", ConfigSeverityError},
+		{"会话最长有效期短于Token有效期", func(c *JWTConfig) { c.MaxSessionLifetime = 10 * time.Minute }, "MaxSessionLifetime,DefaultExpiration", ConfigSeverityWarning},
+		{"刷新窗口为0", func(c *JWTConfig) { c.RefreshExpiration = 0 }, "RefreshExpiration", ConfigSeverityError},
+		{"刷新次数上限为0", func(c *JWTConfig) { c.MaxRefreshCount = 0 }, "MaxRefreshCount", ConfigSeverityError},
+		{"签发异常阈值不低于上限", func(c *JWTConfig) { c.MaxTokensIssuedPerUserPerHour, c.TokenIssueSoftThreshold = 10, 10 }, "TokenIssueSoftThreshold,MaxTokensIssuedPerUserPerHour", ConfigSeverityWarning},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := DefaultJWTConfig()
+			config.SecretKey = "0123456789abcdef0123456789abcdef"
+			config.RefreshExpiration = time.Hour
+			tc.modify(config)
+
+			fields := configFields(config.Validate())
+			assert.Len(t, fields, 1)
+			assert.Equal(t, tc.severity, fields[tc.field])
+		})
+	}
+
+	t.Run("未允许刷新时不检查刷新参数", func(t *testing.T) {
+		config := DefaultJWTConfig()
+		config.SecretKey = "0123456789abcdef0123456789abcdef"
+		config.AllowRefresh = false
+		config.RefreshExpiration = 0
+		config.MaxRefreshCount = 0
+		assert.Empty(t, config.Validate())
+	})
+}
+
+func TestPasswordManagerConfigValidate(t *testing.T) {
+	t.Run("默认配置", func(t *testing.T) {
+		assert.Empty(t, DefaultPasswordManagerConfig().Validate())
+	})
+
+	cases := []struct {
+		name     string
+		modify   func(c *PasswordManagerConfig)
+		field    string
+		severity ConfigSeverity
+	}{
+		{"bcrypt代价超出范围", func(c *PasswordManagerConfig) { c.BcryptCost = 50 }, "BcryptCost", ConfigSeverityWarning},
+		{"强度分数超过100", func(c *PasswordManagerConfig) { c.MinStrengthScore = 101 }, "MinStrengthScore", ConfigSeverityError},
+		{"默认生成长度为0", func(c *PasswordManagerConfig) { c.DefaultLength = 0 }, "DefaultLength", ConfigSeverityError},
+		{"默认生成长度小于最小长度", func(c *PasswordManagerConfig) { c.DefaultLength = 6 }, "DefaultLength,DefaultPolicy.MinLength", ConfigSeverityError},
+		{"默认生成长度大于最大长度", func(c *PasswordManagerConfig) { c.DefaultPolicy.MaxLength = 10 }, "DefaultLength,DefaultPolicy.MaxLength", ConfigSeverityError},
+		{"默认生成长度小于不同字符数", func(c *PasswordManagerConfig) { c.DefaultPolicy.MinUniqueChars = 16 }, "DefaultLength,DefaultPolicy.MinUniqueChars", ConfigSeverityError},
+		{"历史数量为负数", func(c *PasswordManagerConfig) { c.HistoryCount = -1 }, "HistoryCount", ConfigSeverityError},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := DefaultPasswordManagerConfig()
+			tc.modify(config)
+
+			fields := configFields(config.Validate())
+			assert.Len(t, fields, 1)
+			assert.Equal(t, tc.severity, fields[tc.field])
+		})
+	}
+
+	t.Run("最小长度大于最大长度", func(t *testing.T) {
+		config := DefaultPasswordManagerConfig()
+		config.DefaultPolicy.MinLength = 200
+
+		// 默认生成长度同时小于最小长度
+		fields := configFields(config.Validate())
+		assert.Equal(t, ConfigSeverityError, fields["DefaultPolicy.MinLength,DefaultPolicy.MaxLength"])
+		assert.Equal(t, ConfigSeverityError, fields["DefaultLength,DefaultPolicy.MinLength"])
+	})
+}
+
+func TestPasswordConfigValidate(t *testing.T) {
+	t.Run("默认配置", func(t *testing.T) {
+		assert.Empty(t, DefaultPasswordConfig.Validate())
+	})
+
+	t.Run("推荐配置", func(t *testing.T) {
+		assert.Empty(t, recommendPasswordConfig(1<<30, 4).Validate())
+	})
+
+	t.Run("参数错误", func(t *testing.T) {
+		config := &PasswordConfig{Time: 0, Memory: 1024, Threads: 0, KeyLen: 8, SaltLen: 8}
+		assert.Equal(t, map[string]ConfigSeverity{
+			"Time":    ConfigSeverityError,
+			"Threads": ConfigSeverityError,
+			"Memory":  ConfigSeverityWarning,
+			"KeyLen":  ConfigSeverityWarning,
+			"SaltLen": ConfigSeverityWarning,
+		}, configFields(config.Validate()))
+	})
+}
+
+func TestTwoFactorConfigValidate(t *testing.T) {
+	t.Run("配置了字段加密器的默认配置", func(t *testing.T) {
+		SetFieldEncryptor(newTestFieldEncryptor(t, "k1"))
+		defer SetFieldEncryptor(nil)
+
+		assert.Empty(t, DefaultTwoFactorConfig().Validate())
+	})
+
+	t.Run("参数错误", func(t *testing.T) {
+		config := &TwoFactorConfig{Issuer: "Example:App", Skew: 3}
+		assert.Equal(t, map[string]ConfigSeverity{
+			"Issuer": ConfigSeverityError,
+			"Skew":   ConfigSeverityWarning,
+			"Secret": ConfigSeverityWarning,
+		}, configFields(config.Validate()))
+
+		assert.Equal(t, ConfigSeverityWarning, configFields((&TwoFactorConfig{}).Validate())["Issuer"])
+	})
+}
+
+func TestCheckConfiguration(t *testing.T) {
+	t.Run("只有警告时非严格模式通过", func(t *testing.T) {
+		assert.NoError(t, CheckConfiguration(false, DefaultJWTConfig(), DefaultPasswordManagerConfig()))
+	})
+
+	t.Run("严格模式下警告视为失败", func(t *testing.T) {
+		err := CheckConfiguration(true, DefaultJWTConfig(), DefaultPasswordManagerConfig())
+		assert.True(t, errors.Is(err, ErrInvalidConfiguration))
+		assert.Contains(t, err.Error(), "JWTConfig.SecretKey")
+	})
+
+	t.Run("存在错误时非严格模式同样失败", func(t *testing.T) {
+		config := DefaultJWTConfig()
+		config.RefreshExpiration = 0
+		err := CheckConfiguration(false, config)
+		assert.True(t, errors.Is(err, ErrInvalidConfiguration))
+		assert.Contains(t, err.Error(), "JWTConfig.RefreshExpiration")
+	})
+
+	t.Run("汇总全部问题", func(t *testing.T) {
+		jwtConfig := DefaultJWTConfig()
+		jwtConfig.MaxRefreshCount = 0
+		passwordConfig := DefaultPasswordManagerConfig()
+		passwordConfig.DefaultLength = 4
+
+		warnings := ValidateConfiguration(jwtConfig, passwordConfig, DefaultPasswordConfig)
+		fields := configFields(warnings)
+		assert.Contains(t, fields, "MaxRefreshCount")
+		assert.Contains(t, fields, "DefaultLength,DefaultPolicy.MinLength")
+	})
+}
+
+func TestNewWithConfigCheck(t *testing.T) {
+	t.Run("JWT服务", func(t *testing.T) {
+		service, err := NewJWTServiceWithConfigCheck(nil, false)
+		assert.NoError(t, err)
+		assert.NotNil(t, service)
+
+		service, err = NewJWTServiceWithConfigCheck(nil, true)
+		assert.True(t, errors.Is(err, ErrInvalidConfiguration))
+		assert.Nil(t, service)
+	})
+
+	t.Run("密码管理器", func(t *testing.T) {
+		manager, err := NewPasswordManagerWithConfigCheck(nil, true)
+		assert.NoError(t, err)
+		assert.NotNil(t, manager)
+
+		config := DefaultPasswordManagerConfig()
+		config.DefaultLength = 4
+		manager, err = NewPasswordManagerWithConfigCheck(config, false)
+		assert.True(t, errors.Is(err, ErrInvalidConfiguration))
+		assert.Nil(t, manager)
+	})
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"aigo_service_auth/errorcodes"
+)
+
+// RefreshCookieConfig 刷新Token Cookie配置
+type RefreshCookieConfig struct {
+	Name   string        // 刷新Token Cookie名称
+	Domain string        // Cookie域名，为空时仅限当前主机
+	Path   string        // Cookie路径，只有该路径下的请求会携带刷新Token
+	MaxAge time.Duration // Cookie有效期，应与刷新Token的有效期一致
+	// CSRF Token的请求头名称，刷新时必须携带与Cookie配对的值
+	CSRFHeader string
+	// 可被JavaScript读取的CSRF Token Cookie名称，供SPA刷新页面后取回；为空时只在响应体中返回
+	CSRFCookieName string
+	// 设备ID请求头名称，登录时携带的设备ID会与刷新Token绑定
+	DeviceIDHeader string
+	// 计算CSRF Token的密钥，为空时每个进程随机生成；多实例部署时必须配置相同的值
+	CSRFSecret string
+	// 时间来源，用于刷新时判断用户是否处于暂停期，为nil时使用系统时间；测试中可使用FakeClock
+	Clock Clock
+}
+
+// DefaultRefreshCookieConfig 默认刷新Token Cookie配置，有效期取JWT默认的RefreshExpiration
+func DefaultRefreshCookieConfig() *RefreshCookieConfig {
+	return &RefreshCookieConfig{
+		Name:           "refresh_token",
+		Path:           "/auth/refresh",
+		MaxAge:         DefaultJWTConfig().RefreshExpiration,
+		CSRFHeader:     "X-CSRF-Token",
+		CSRFCookieName: "csrf_token",
+		DeviceIDHeader: "X-Device-ID",
+	}
+}
+
+// CookieAuthResponse 登录和刷新的响应体，刷新Token只通过Cookie下发
+type CookieAuthResponse struct {
+	AccessToken string `json:"access_token"`
+	CSRFToken   string `json:"csrf_token"`
+}
+
+// CookieAuthHandler 浏览器SPA的认证处理器
+//
+// 登录后访问Token在响应体中返回，刷新Token写入HttpOnly、Secure、SameSite=Strict的Cookie，
+// JavaScript无法读取。刷新时除Cookie外还需在请求头中携带配对的CSRF Token，每次刷新都会轮换刷新Token。
+// 刷新Token的Cookie只在Path下发送，Logout也必须挂载在Path之下，如/auth/refresh/logout，才能撤销刷新Token。
+type CookieAuthHandler struct {
+	loginService  LoginService
+	userService   UserService
+	accessTokens  TokenService // 签发访问Token，应与loginService使用同一个服务
+	refreshTokens TokenService // 签发刷新Token，有效期应与MaxAge一致
+	config        *RefreshCookieConfig
+	csrfKey       []byte
+}
+
+// NewCookieAuthHandler 创建浏览器SPA的认证处理器
+func NewCookieAuthHandler(loginService LoginService, userService UserService, accessTokens, refreshTokens TokenService, config *RefreshCookieConfig) *CookieAuthHandler {
+	if config == nil {
+		config = DefaultRefreshCookieConfig()
+	}
+
+	csrfKey := []byte(config.CSRFSecret)
+	if len(csrfKey) == 0 {
+		csrfKey = make([]byte, 32)
+		rand.Read(csrfKey)
+	}
+
+	return &CookieAuthHandler{
+		loginService:  loginService,
+		userService:   userService,
+		accessTokens:  accessTokens,
+		refreshTokens: refreshTokens,
+		config:        config,
+		csrfKey:       csrfKey,
+	}
+}
+
+// Login 处理登录请求，请求体为{"username": "...", "password": "..."}
+func (h *CookieAuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorCode(w, errorcodes.ErrCodeMethodNotAllowed, "不支持的请求方法")
+		return
+	}
+
+	var credentials struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
+		writeErrorCode(w, errorcodes.ErrCodeInvalidRequest, "无效的请求体")
+		return
+	}
+
+	client := h.clientInfo(r)
+	user, accessToken, err := h.loginService.LoginWithClient(credentials.Username, credentials.Password, client)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	refreshToken, err := h.refreshTokens.GenerateTokenForUser(user)
+	if err != nil {
+		writeErrorCode(w, errorcodes.ErrCodeInternal, "生成刷新Token失败")
+		return
+	}
+
+	h.writeTokens(w, accessToken, refreshToken, client.DeviceID)
+}
+
+// Refresh 处理刷新请求：校验Cookie与CSRF Token配对后轮换刷新Token并签发新的访问Token
+func (h *CookieAuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorCode(w, errorcodes.ErrCodeMethodNotAllowed, "不支持的请求方法")
+		return
+	}
+
+	cookie, err := r.Cookie(h.config.Name)
+	if err != nil || cookie.Value == "" {
+		writeErrorCode(w, errorcodes.ErrCodeUnauthenticated, "缺少刷新Token")
+		return
+	}
+
+	csrfToken := r.Header.Get(h.config.CSRFHeader)
+	if csrfToken == "" {
+		writeErrorCode(w, errorcodes.ErrCodeCSRFFailed, "缺少CSRF Token")
+		return
+	}
+	// 设备ID参与计算，其他设备拿到Cookie和CSRF Token也无法刷新
+	deviceID := h.clientInfo(r).DeviceID
+	if !hmac.Equal([]byte(csrfToken), []byte(h.csrfToken(cookie.Value, deviceID))) {
+		writeErrorCode(w, errorcodes.ErrCodeCSRFFailed, "CSRF Token不匹配")
+		return
+	}
+
+	user, err := h.refreshUser(cookie.Value)
+	if err != nil {
+		h.clearCookies(w)
+		writeErrorCode(w, errorcodes.ErrCodeTokenInvalid, "刷新Token无效")
+		return
+	}
+
+	// 轮换：签发新Token前先消费旧刷新Token，撤销失败时不签发；并发使用同一Cookie时只有一个请求成功
+	consumed, err := h.refreshTokens.ConsumeToken(cookie.Value)
+	if err != nil {
+		writeErrorCode(w, errorcodes.ErrCodeInternal, "撤销刷新Token失败")
+		return
+	}
+	if !consumed {
+		h.clearCookies(w)
+		writeErrorCode(w, errorcodes.ErrCodeTokenInvalid, "刷新Token无效")
+		return
+	}
+
+	accessToken, err := h.accessTokens.GenerateTokenForUser(user)
+	if err != nil {
+		writeErrorCode(w, errorcodes.ErrCodeInternal, "生成访问Token失败")
+		return
+	}
+	refreshToken, err := h.refreshTokens.GenerateTokenForUser(user)
+	if err != nil {
+		writeErrorCode(w, errorcodes.ErrCodeInternal, "生成刷新Token失败")
+		return
+	}
+
+	h.writeTokens(w, accessToken, refreshToken, deviceID)
+}
+
+// Logout 处理登出请求：撤销当前刷新Token和请求头中的访问Token并清除Cookie
+//
+// 此前轮换过的刷新Token在轮换时已撤销，撤销当前刷新Token即终止整条刷新链。
+func (h *CookieAuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorCode(w, errorcodes.ErrCodeMethodNotAllowed, "不支持的请求方法")
+		return
+	}
+
+	if cookie, err := r.Cookie(h.config.Name); err == nil && cookie.Value != "" {
+		h.refreshTokens.RevokeToken(cookie.Value)
+	}
+	if accessToken, ok := bearerToken(r); ok {
+		h.loginService.Logout(accessToken)
+	}
+
+	h.clearCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// refreshUser 验证刷新Token并返回其用户，用户被禁用或在签发后修改过密码时拒绝
+func (h *CookieAuthHandler) refreshUser(refreshToken string) (*User, error) {
+	claims, err := h.refreshTokens.ParseClaims(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := h.userService.GetUserByID(claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkUserStatus(user, false, clockOrDefault(h.config.Clock).Now()); err != nil {
+		return nil, err
+	}
+	if err := checkCredentialFreshness(claims, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// writeTokens 写入刷新Token和CSRF Token的Cookie，并在响应体中返回访问Token和CSRF Token
+func (h *CookieAuthHandler) writeTokens(w http.ResponseWriter, accessToken, refreshToken, deviceID string) {
+	csrfToken := h.csrfToken(refreshToken, deviceID)
+	maxAge := int(h.config.MaxAge.Seconds())
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     h.config.Name,
+		Value:    refreshToken,
+		Domain:   h.config.Domain,
+		Path:     h.config.Path,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	if h.config.CSRFCookieName != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     h.config.CSRFCookieName,
+			Value:    csrfToken,
+			Domain:   h.config.Domain,
+			Path:     "/",
+			MaxAge:   maxAge,
+			Secure:   true,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(CookieAuthResponse{AccessToken: accessToken, CSRFToken: csrfToken})
+}
+
+// clearCookies 清除刷新Token和CSRF Token的Cookie
+func (h *CookieAuthHandler) clearCookies(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     h.config.Name,
+		Domain:   h.config.Domain,
+		Path:     h.config.Path,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	if h.config.CSRFCookieName != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     h.config.CSRFCookieName,
+			Domain:   h.config.Domain,
+			Path:     "/",
+			MaxAge:   -1,
+			Secure:   true,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+}
+
+// csrfToken 计算与刷新Token和设备ID配对的CSRF Token
+func (h *CookieAuthHandler) csrfToken(refreshToken, deviceID string) string {
+	mac := hmac.New(sha256.New, h.csrfKey)
+	mac.Write([]byte(refreshToken + "\n" + deviceID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// clientInfo 从请求中提取客户端信息，IP取自连接地址，不信任转发头
+func (h *CookieAuthHandler) clientInfo(r *http.Request) ClientInfo {
+	client := ClientInfo{IP: remoteIP(r), UserAgent: r.UserAgent()}
+	if h.config.DeviceIDHeader != "" {
+		client.DeviceID = r.Header.Get(h.config.DeviceIDHeader)
+	}
+	return client
+}
+
+// bearerToken 从Authorization请求头中取出Bearer Token
+func bearerToken(r *http.Request) (string, bool) {
+	return parseBearerToken(r.Header.Get("Authorization"))
+}
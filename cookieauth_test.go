@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubLoginService 测试用登录服务，只接受预设的用户名和密码
+type stubLoginService struct {
+	LoginService
+	user         *User
+	password     string
+	tokens       TokenService
+	loggedOut    []string
+	lastClientIP string
+}
+
+func (s *stubLoginService) LoginWithClient(username, password string, client ClientInfo) (*User, string, error) {
+	s.lastClientIP = client.IP
+	if username != s.user.Username || password != s.password {
+		return nil, "", ErrInvalidCredentials
+	}
+	token, err := s.tokens.GenerateTokenForUser(s.user)
+	return s.user, token, err
+}
+
+func (s *stubLoginService) Logout(token string) error {
+	s.loggedOut = append(s.loggedOut, token)
+	return nil
+}
+
+// fixedUserService 测试用用户服务，按ID返回预设用户
+type fixedUserService struct {
+	UserService
+	user *User
+}
+
+func (s *fixedUserService) GetUserByID(id uint) (*User, error) {
+	if id != s.user.ID {
+		return nil, ErrUserNotFound
+	}
+	return s.user, nil
+}
+
+// memoryRefreshTokens 测试用刷新Token服务，每次签发不同的随机Token
+type memoryRefreshTokens struct {
+	TokenService
+	mutex  sync.Mutex
+	tokens map[string]*Claims
+	issued int
+	// consumeErr 非空时模拟存储故障，ConsumeToken直接返回该错误
+	consumeErr error
+}
+
+func newMemoryRefreshTokens() *memoryRefreshTokens {
+	return &memoryRefreshTokens{tokens: make(map[string]*Claims)}
+}
+
+func (s *memoryRefreshTokens) GenerateTokenForUser(user *User) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.issued++
+	token := fmt.Sprintf("refresh-%d", s.issued)
+	claims := &Claims{UserID: user.ID}
+	if user.PasswordChangedAt != nil {
+		claims.PasswordChangedAt = user.PasswordChangedAt.Unix()
+	}
+	s.tokens[token] = claims
+	return token, nil
+}
+
+func (s *memoryRefreshTokens) ParseClaims(token string) (*Claims, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	claims, ok := s.tokens[token]
+	if !ok {
+		return nil, ErrInvalidSessionToken
+	}
+	return claims, nil
+}
+
+func (s *memoryRefreshTokens) RevokeToken(token string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.tokens, token)
+	return nil
+}
+
+func (s *memoryRefreshTokens) ConsumeToken(token string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.consumeErr != nil {
+		return false, s.consumeErr
+	}
+	if _, ok := s.tokens[token]; !ok {
+		return false, nil
+	}
+	delete(s.tokens, token)
+	return true, nil
+}
+
+func TestCookieAuthHandler(t *testing.T) {
+	user := &User{Username: "testuser", Status: 1}
+	user.ID = 1
+	accessTokens := NewTokenService("test-secret-key", time.Hour)
+	config := DefaultRefreshCookieConfig()
+
+	// newHandler 创建使用内存刷新Token的处理器
+	newHandler := func() (*CookieAuthHandler, *stubLoginService, *memoryRefreshTokens) {
+		loginService := &stubLoginService{user: user, password: "password", tokens: accessTokens}
+		refreshTokens := newMemoryRefreshTokens()
+		return NewCookieAuthHandler(loginService, &fixedUserService{user: user}, accessTokens, refreshTokens, config), loginService, refreshTokens
+	}
+
+	// login 登录并返回响应体和刷新Token Cookie
+	login := func(t *testing.T, handler *CookieAuthHandler, deviceID string) (CookieAuthResponse, *http.Cookie) {
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(`{"username":"testuser","password":"password"}`))
+		req.Header.Set(config.DeviceIDHeader, deviceID)
+		rec := httptest.NewRecorder()
+		handler.Login(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var body CookieAuthResponse
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		return body, findCookie(rec, config.Name)
+	}
+
+	// refresh 携带Cookie和CSRF请求头调用刷新接口
+	refresh := func(handler *CookieAuthHandler, cookie *http.Cookie, csrfToken, deviceID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/refresh", nil)
+		if cookie != nil {
+			req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+		}
+		if csrfToken != "" {
+			req.Header.Set(config.CSRFHeader, csrfToken)
+		}
+		req.Header.Set(config.DeviceIDHeader, deviceID)
+		rec := httptest.NewRecorder()
+		handler.Refresh(rec, req)
+		return rec
+	}
+
+	t.Run("登录时刷新Token只写入HttpOnly Cookie", func(t *testing.T) {
+		handler, loginService, _ := newHandler()
+		body, cookie := login(t, handler, "device-1")
+
+		assert.NotEmpty(t, body.AccessToken)
+		assert.NotEmpty(t, body.CSRFToken)
+		assert.Equal(t, "192.0.2.1", loginService.lastClientIP)
+
+		assert.NotNil(t, cookie)
+		assert.NotContains(t, body.AccessToken, cookie.Value)
+		assert.True(t, cookie.HttpOnly)
+		assert.True(t, cookie.Secure)
+		assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
+		assert.Equal(t, "/auth/refresh", cookie.Path)
+		assert.Equal(t, int(config.MaxAge.Seconds()), cookie.MaxAge)
+
+		// 登录失败时不写入Cookie
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(`{"username":"testuser","password":"wrong"}`))
+		rec := httptest.NewRecorder()
+		handler.Login(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"code":"invalid_credentials"`)
+		assert.Nil(t, findCookie(rec, config.Name))
+	})
+
+	t.Run("缺少Cookie时拒绝刷新", func(t *testing.T) {
+		handler, _, _ := newHandler()
+		body, _ := login(t, handler, "device-1")
+
+		rec := refresh(handler, nil, body.CSRFToken, "device-1")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("缺少或不匹配CSRF请求头时拒绝刷新", func(t *testing.T) {
+		handler, _, refreshTokens := newHandler()
+		body, cookie := login(t, handler, "device-1")
+
+		rec := refresh(handler, cookie, "", "device-1")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+
+		rec = refresh(handler, cookie, strings.Repeat("0", len(body.CSRFToken)), "device-1")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+
+		// 其他设备无法使用
+		rec = refresh(handler, cookie, body.CSRFToken, "device-2")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+
+		// 被拒绝的请求不会使刷新Token失效
+		_, err := refreshTokens.ParseClaims(cookie.Value)
+		assert.NoError(t, err)
+	})
+
+	t.Run("刷新成功时轮换刷新Token并重新写入Cookie", func(t *testing.T) {
+		handler, _, _ := newHandler()
+		body, cookie := login(t, handler, "device-1")
+
+		rec := refresh(handler, cookie, body.CSRFToken, "device-1")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var refreshed CookieAuthResponse
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&refreshed))
+		assert.NotEmpty(t, refreshed.AccessToken)
+		assert.NotEqual(t, body.CSRFToken, refreshed.CSRFToken)
+
+		rotated := findCookie(rec, config.Name)
+		assert.NotNil(t, rotated)
+		assert.NotEqual(t, cookie.Value, rotated.Value)
+		assert.True(t, rotated.HttpOnly)
+
+		userID, err := accessTokens.ValidateToken(refreshed.AccessToken)
+		assert.NoError(t, err)
+		assert.Equal(t, user.ID, userID)
+
+		// 旧刷新Token已失效
+		rec = refresh(handler, cookie, body.CSRFToken, "device-1")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		// 新刷新Token可继续使用
+		rec = refresh(handler, rotated, refreshed.CSRFToken, "device-1")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("撤销旧刷新Token失败时不签发新Token", func(t *testing.T) {
+		handler, _, refreshTokens := newHandler()
+		body, cookie := login(t, handler, "device-1")
+		refreshTokens.consumeErr = errors.New("store unavailable")
+
+		rec := refresh(handler, cookie, body.CSRFToken, "device-1")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Nil(t, findCookie(rec, config.Name))
+		assert.Equal(t, 1, refreshTokens.issued)
+	})
+
+	t.Run("并发使用同一Cookie刷新时只有一个成功", func(t *testing.T) {
+		handler, _, _ := newHandler()
+		body, cookie := login(t, handler, "device-1")
+
+		const workers = 8
+		var wg sync.WaitGroup
+		codes := make(chan int, workers)
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				codes <- refresh(handler, cookie, body.CSRFToken, "device-1").Code
+			}()
+		}
+		wg.Wait()
+		close(codes)
+
+		succeeded := 0
+		for code := range codes {
+			if code == http.StatusOK {
+				succeeded++
+			} else {
+				assert.Equal(t, http.StatusUnauthorized, code)
+			}
+		}
+		assert.Equal(t, 1, succeeded)
+	})
+
+	t.Run("登出时撤销刷新Token并清除Cookie", func(t *testing.T) {
+		handler, loginService, _ := newHandler()
+		body, cookie := login(t, handler, "device-1")
+
+		req := httptest.NewRequest(http.MethodPost, "/auth/refresh/logout", nil)
+		req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+		req.Header.Set("Authorization", "Bearer "+body.AccessToken)
+		rec := httptest.NewRecorder()
+		handler.Logout(rec, req)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+
+		cleared := findCookie(rec, config.Name)
+		assert.NotNil(t, cleared)
+		assert.Empty(t, cleared.Value)
+		assert.True(t, cleared.MaxAge < 0)
+		assert.Equal(t, []string{body.AccessToken}, loginService.loggedOut)
+
+		rec = refresh(handler, cookie, body.CSRFToken, "device-1")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
+
+// findCookie 从响应中查找指定名称的Cookie
+func findCookie(rec *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrDeviceNotFound 设备不存在
+var ErrDeviceNotFound = errors.New("设备不存在")
+
+// ClientInfo 登录请求的客户端信息
+type ClientInfo struct {
+	IP        string // 客户端IP
+	UserAgent string // User-Agent请求头
+	DeviceID  string // 客户端提示或Cookie下发的设备ID
+	// 用户在本次登录时同意的服务条款版本，与AuthConfig.RequiredTermsVersion相同时登录并记录同意
+	AcceptedTermsVersion string
+}
+
+// Fingerprint 计算设备指纹，User-Agent和设备ID都为空时返回空字符串
+func (c ClientInfo) Fingerprint() string {
+	if c.UserAgent == "" && c.DeviceID == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(c.UserAgent + "\n" + c.DeviceID))
+	return hex.EncodeToString(sum[:])
+}
+
+// KnownDevice 用户登录过的设备
+type KnownDevice struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      uint      `gorm:"not null;uniqueIndex:idx_known_device_user_fingerprint" json:"user_id"`
+	Fingerprint string    `gorm:"size:64;not null;uniqueIndex:idx_known_device_user_fingerprint" json:"-"`
+	UserAgent   string    `gorm:"size:512" json:"user_agent"`
+	LastIP      string    `gorm:"size:64" json:"last_ip"`
+	FirstSeenAt time.Time `gorm:"not null" json:"first_seen_at"`
+	LastSeenAt  time.Time `gorm:"not null" json:"last_seen_at"`
+}
+
+// TableName 设置表名
+func (KnownDevice) TableName() string {
+	return "sys_known_devices"
+}
+
+// KnownDeviceStorage 已知设备存储接口
+type KnownDeviceStorage interface {
+	// 记录设备登录，设备不存在时创建并返回true，已存在时更新最后登录信息并返回false
+	Record(device *KnownDevice) (bool, error)
+	// 获取用户的已知设备，按最后登录时间倒序
+	List(userID uint) ([]*KnownDevice, error)
+	// 删除用户的设备，不存在时返回ErrDeviceNotFound
+	Delete(userID, id uint) error
+}
+
+// GeoResolver IP地理位置解析接口，返回大致位置描述
+type GeoResolver interface {
+	Locate(ip string) (string, error)
+}
+
+// DeviceTracker 登录设备跟踪器，发现新设备时记录审计事件并发送通知邮件
+type DeviceTracker struct {
+	storage     KnownDeviceStorage
+	mailer      AuthMailer
+	geo         GeoResolver
+	auditLogger AuditLogger
+}
+
+// NewDeviceTracker 创建登录设备跟踪器，mailer为nil时不发送通知，geo为nil时不解析位置
+func NewDeviceTracker(storage KnownDeviceStorage, mailer AuthMailer, geo GeoResolver, auditLogger AuditLogger) *DeviceTracker {
+	if auditLogger == nil {
+		auditLogger = noopAuditLogger{}
+	}
+
+	return &DeviceTracker{
+		storage:     storage,
+		mailer:      mailer,
+		geo:         geo,
+		auditLogger: auditLogger,
+	}
+}
+
+// RecordLogin 记录用户的登录设备，返回是否为新设备
+//
+// 新设备的通知邮件异步发送，发送失败只记录日志，不影响登录。
+func (t *DeviceTracker) RecordLogin(user *User, client ClientInfo) (bool, error) {
+	fingerprint := client.Fingerprint()
+	if fingerprint == "" {
+		return false, nil
+	}
+
+	now := time.Now()
+	created, err := t.storage.Record(&KnownDevice{
+		UserID:      user.ID,
+		Fingerprint: fingerprint,
+		UserAgent:   truncate(client.UserAgent, 512),
+		LastIP:      client.IP,
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+	})
+	if err != nil || !created {
+		return false, err
+	}
+
+	if err := t.auditLogger.Log(AuditEvent{
+		Type:      AuditEventLoginNewDevice,
+		UserID:    user.ID,
+		Detail:    fmt.Sprintf("ip=%s user_agent=%s", client.IP, client.UserAgent),
+		CreatedAt: now,
+	}); err != nil {
+		return true, err
+	}
+
+	if t.mailer != nil && user.Email != "" {
+		go t.notifyNewDevice(user.Email, client, now)
+	}
+
+	return true, nil
+}
+
+// notifyNewDevice 发送新设备登录通知
+func (t *DeviceTracker) notifyNewDevice(email string, client ClientInfo, loginAt time.Time) {
+	location := ""
+	if t.geo != nil && client.IP != "" {
+		resolved, err := t.geo.Locate(client.IP)
+		if err != nil {
+			log.Printf("解析登录位置失败: ip=%s err=%v", client.IP, err)
+		} else {
+			location = resolved
+		}
+	}
+
+	err := t.mailer.Send(MailMessage{
+		To:       email,
+		Template: MailTemplateNewDeviceLogin,
+		Data: map[string]string{
+			"time":       loginAt.Format(time.RFC3339),
+			"ip":         client.IP,
+			"location":   location,
+			"user_agent": client.UserAgent,
+		},
+	})
+	if err != nil {
+		log.Printf("发送新设备登录通知失败: to=%s err=%v", email, err)
+	}
+}
+
+// ListKnownDevices 获取用户的已知设备
+func (t *DeviceTracker) ListKnownDevices(userID uint) ([]*KnownDevice, error) {
+	return t.storage.List(userID)
+}
+
+// ForgetDevice 删除用户的已知设备，之后从该设备登录会重新发送通知
+func (t *DeviceTracker) ForgetDevice(userID, id uint) error {
+	return t.storage.Delete(userID, id)
+}
+
+// truncate 截断字符串到指定字节数以内
+func truncate(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
+	}
+	return s[:maxLen]
+}
+
+// gormKnownDeviceStorage 基于GORM的已知设备存储实现
+type gormKnownDeviceStorage struct {
+	db *gorm.DB
+}
+
+// NewGormKnownDeviceStorage 创建基于数据库的已知设备存储
+func NewGormKnownDeviceStorage(db *gorm.DB) KnownDeviceStorage {
+	return &gormKnownDeviceStorage{db: db}
+}
+
+// Record 记录设备登录，依赖唯一索引保证并发登录时只有一个调用返回true
+func (s *gormKnownDeviceStorage) Record(device *KnownDevice) (bool, error) {
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(device)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+
+	err := s.db.Model(&KnownDevice{}).
+		Where("user_id = ? AND fingerprint = ?", device.UserID, device.Fingerprint).
+		Updates(map[string]interface{}{
+			"last_ip":      device.LastIP,
+			"last_seen_at": device.LastSeenAt,
+		}).Error
+	return false, err
+}
+
+// List 获取用户的已知设备
+func (s *gormKnownDeviceStorage) List(userID uint) ([]*KnownDevice, error) {
+	var devices []*KnownDevice
+	err := s.db.Where("user_id = ?", userID).Order("last_seen_at DESC").Find(&devices).Error
+	return devices, err
+}
+
+// Delete 删除用户的设备
+func (s *gormKnownDeviceStorage) Delete(userID, id uint) error {
+	result := s.db.Where("id = ? AND user_id = ?", id, userID).Delete(&KnownDevice{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDeviceNotFound
+	}
+	return nil
+}
+
+// MemoryKnownDeviceStorage 内存已知设备存储实现
+type MemoryKnownDeviceStorage struct {
+	devices map[uint]*KnownDevice
+	nextID  uint
+	mutex   sync.Mutex
+}
+
+// NewMemoryKnownDeviceStorage 创建内存已知设备存储
+func NewMemoryKnownDeviceStorage() *MemoryKnownDeviceStorage {
+	return &MemoryKnownDeviceStorage{
+		devices: make(map[uint]*KnownDevice),
+	}
+}
+
+// Record 记录设备登录
+func (s *MemoryKnownDeviceStorage) Record(device *KnownDevice) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, existing := range s.devices {
+		if existing.UserID == device.UserID && existing.Fingerprint == device.Fingerprint {
+			existing.LastIP = device.LastIP
+			existing.LastSeenAt = device.LastSeenAt
+			return false, nil
+		}
+	}
+
+	s.nextID++
+	stored := *device
+	stored.ID = s.nextID
+	s.devices[stored.ID] = &stored
+	device.ID = stored.ID
+	return true, nil
+}
+
+// List 获取用户的已知设备
+func (s *MemoryKnownDeviceStorage) List(userID uint) ([]*KnownDevice, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var devices []*KnownDevice
+	for _, device := range s.devices {
+		if device.UserID == userID {
+			copied := *device
+			devices = append(devices, &copied)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].LastSeenAt.After(devices[j].LastSeenAt)
+	})
+	return devices, nil
+}
+
+// Delete 删除用户的设备
+func (s *MemoryKnownDeviceStorage) Delete(userID, id uint) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	device, exists := s.devices[id]
+	if !exists || device.UserID != userID {
+		return ErrDeviceNotFound
+	}
+	delete(s.devices, id)
+	return nil
+}
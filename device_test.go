@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubGeoResolver 测试用地理位置解析，返回固定位置
+type stubGeoResolver struct {
+	location string
+	err      error
+}
+
+func (g *stubGeoResolver) Locate(ip string) (string, error) {
+	return g.location, g.err
+}
+
+// failingMailer 测试用邮件发送器，总是发送失败
+type failingMailer struct{}
+
+func (failingMailer) Send(message MailMessage) error {
+	return errors.New("邮件服务不可用")
+}
+
+func TestClientInfoFingerprint(t *testing.T) {
+	browser := ClientInfo{IP: "1.1.1.1", UserAgent: "Mozilla/5.0", DeviceID: "device-1"}
+
+	// IP变化不影响指纹
+	assert.Equal(t, browser.Fingerprint(), ClientInfo{IP: "2.2.2.2", UserAgent: "Mozilla/5.0", DeviceID: "device-1"}.Fingerprint())
+	assert.NotEqual(t, browser.Fingerprint(), ClientInfo{UserAgent: "Mozilla/5.0", DeviceID: "device-2"}.Fingerprint())
+	assert.Len(t, browser.Fingerprint(), 64)
+
+	// 没有可识别信息时不计算指纹
+	assert.Empty(t, ClientInfo{IP: "1.1.1.1"}.Fingerprint())
+}
+
+func TestDeviceTracker(t *testing.T) {
+	user := &User{Email: "alice@example.com"}
+	user.ID = 1
+	client := ClientInfo{IP: "203.0.113.7", UserAgent: "Mozilla/5.0", DeviceID: "device-1"}
+
+	t.Run("新设备记录事件并发送通知", func(t *testing.T) {
+		mailer := NewCaptureMailer()
+		auditLogger := NewMemoryAuditLogger()
+		tracker := NewDeviceTracker(NewMemoryKnownDeviceStorage(), mailer, &stubGeoResolver{location: "上海, 中国"}, auditLogger)
+
+		isNew, err := tracker.RecordLogin(user, client)
+		assert.NoError(t, err)
+		assert.True(t, isNew)
+
+		assert.Eventually(t, func() bool { return len(mailer.Messages()) == 1 }, time.Second, 10*time.Millisecond)
+		message := mailer.Messages()[0]
+		assert.Equal(t, "alice@example.com", message.To)
+		assert.Equal(t, MailTemplateNewDeviceLogin, message.Template)
+		assert.Equal(t, "203.0.113.7", message.Data["ip"])
+		assert.Equal(t, "上海, 中国", message.Data["location"])
+		assert.NotEmpty(t, message.Data["time"])
+
+		events := auditLogger.Events()
+		assert.Len(t, events, 1)
+		assert.Equal(t, AuditEventLoginNewDevice, events[0].Type)
+		assert.Equal(t, uint(1), events[0].UserID)
+
+		// 已知设备换IP登录不再通知
+		isNew, err = tracker.RecordLogin(user, ClientInfo{IP: "198.51.100.1", UserAgent: "Mozilla/5.0", DeviceID: "device-1"})
+		assert.NoError(t, err)
+		assert.False(t, isNew)
+		time.Sleep(50 * time.Millisecond)
+		assert.Len(t, mailer.Messages(), 1)
+		assert.Len(t, auditLogger.Events(), 1)
+
+		devices, err := tracker.ListKnownDevices(1)
+		assert.NoError(t, err)
+		assert.Len(t, devices, 1)
+		assert.Equal(t, "198.51.100.1", devices[0].LastIP)
+	})
+
+	t.Run("删除设备后再次登录视为新设备", func(t *testing.T) {
+		tracker := NewDeviceTracker(NewMemoryKnownDeviceStorage(), nil, nil, nil)
+
+		_, err := tracker.RecordLogin(user, client)
+		assert.NoError(t, err)
+		_, err = tracker.RecordLogin(user, ClientInfo{UserAgent: "curl/8.0"})
+		assert.NoError(t, err)
+
+		devices, err := tracker.ListKnownDevices(1)
+		assert.NoError(t, err)
+		assert.Len(t, devices, 2)
+
+		var forgotten *KnownDevice
+		for _, device := range devices {
+			if device.UserAgent == client.UserAgent {
+				forgotten = device
+			}
+		}
+		assert.NotNil(t, forgotten)
+
+		// 不能删除其他用户的设备
+		assert.True(t, errors.Is(tracker.ForgetDevice(2, forgotten.ID), ErrDeviceNotFound))
+
+		assert.NoError(t, tracker.ForgetDevice(1, forgotten.ID))
+		assert.True(t, errors.Is(tracker.ForgetDevice(1, forgotten.ID), ErrDeviceNotFound))
+
+		devices, err = tracker.ListKnownDevices(1)
+		assert.NoError(t, err)
+		assert.Len(t, devices, 1)
+
+		isNew, err := tracker.RecordLogin(user, client)
+		assert.NoError(t, err)
+		assert.True(t, isNew)
+	})
+
+	t.Run("位置解析和发送失败不影响记录", func(t *testing.T) {
+		tracker := NewDeviceTracker(NewMemoryKnownDeviceStorage(), failingMailer{}, &stubGeoResolver{err: errors.New("查询超时")}, nil)
+
+		isNew, err := tracker.RecordLogin(user, client)
+		assert.NoError(t, err)
+		assert.True(t, isNew)
+	})
+
+	t.Run("位置解析失败时仍发送通知", func(t *testing.T) {
+		mailer := NewCaptureMailer()
+		tracker := NewDeviceTracker(NewMemoryKnownDeviceStorage(), mailer, &stubGeoResolver{err: errors.New("查询超时")}, nil)
+
+		_, err := tracker.RecordLogin(user, client)
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool { return len(mailer.Messages()) == 1 }, time.Second, 10*time.Millisecond)
+		assert.Empty(t, mailer.Messages()[0].Data["location"])
+	})
+
+	t.Run("缺少客户端信息时不跟踪", func(t *testing.T) {
+		mailer := NewCaptureMailer()
+		tracker := NewDeviceTracker(NewMemoryKnownDeviceStorage(), mailer, nil, nil)
+
+		isNew, err := tracker.RecordLogin(user, ClientInfo{IP: "203.0.113.7"})
+		assert.NoError(t, err)
+		assert.False(t, isNew)
+
+		devices, err := tracker.ListKnownDevices(1)
+		assert.NoError(t, err)
+		assert.Empty(t, devices)
+	})
+}
+
+func TestLoginWithClientNewDevice(t *testing.T) {
+	// 设置测试数据库
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	mailer := NewCaptureMailer()
+	config := DefaultAuthConfig()
+	config.DeviceTracker = NewDeviceTracker(NewGormKnownDeviceStorage(testDB.DB), mailer, &stubGeoResolver{location: "北京, 中国"}, nil)
+
+	userService := NewUserService(testDB.DB)
+	tokenService := NewTokenService("test-secret-key", time.Hour)
+	authService := NewAuthServiceWithConfig(testDB.DB, userService, tokenService, config)
+
+	password := "testpassword123"
+	user := testDB.CreateTestUser("testuser", "test@example.com", password)
+	client := ClientInfo{IP: "203.0.113.7", UserAgent: "Mozilla/5.0", DeviceID: "device-1"}
+
+	_, token, err := authService.LoginWithClient("testuser", password, client)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, token)
+	assert.Eventually(t, func() bool { return len(mailer.Messages()) == 1 }, time.Second, 10*time.Millisecond)
+
+	// 同一设备再次登录不通知
+	_, _, err = authService.LoginWithClient("testuser", password, client)
+	assert.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, mailer.Messages(), 1)
+
+	devices, err := config.DeviceTracker.ListKnownDevices(user.ID)
+	assert.NoError(t, err)
+	assert.Len(t, devices, 1)
+	assert.NoError(t, config.DeviceTracker.ForgetDevice(user.ID, devices[0].ID))
+
+	// 设备存储不可用时登录仍然成功
+	testDB.DB.Exec("DROP TABLE sys_known_devices")
+	_, token, err = authService.LoginWithClient("testuser", password, client)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, token)
+}
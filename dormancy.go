@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// DormancyConfig 长期未登录账号处理策略配置
+type DormancyConfig struct {
+	WarnAfter    time.Duration // 未登录达到该时长时发邮件预警
+	DisableAfter time.Duration // 未登录达到该时长时禁用账号并撤销全部Token
+	DeleteAfter  time.Duration // 未登录达到该时长时删除已禁用的账号，0表示不删除
+	BatchSize    int           // 每次分页查询的用户数
+	Clock        Clock         // 时钟，为nil时使用系统时间
+}
+
+// DefaultDormancyConfig 默认配置：335天预警，365天禁用，不自动删除
+func DefaultDormancyConfig() *DormancyConfig {
+	return &DormancyConfig{
+		WarnAfter:    335 * 24 * time.Hour,
+		DisableAfter: 365 * 24 * time.Hour,
+		BatchSize:    100,
+	}
+}
+
+// DormancyReport 一次执行的处理结果
+type DormancyReport struct {
+	Warned   int `json:"warned"`
+	Disabled int `json:"disabled"`
+	Deleted  int `json:"deleted"`
+	Skipped  int `json:"skipped"` // 豁免的服务账号和外部管理账号
+}
+
+// DormancyPolicy 长期未登录账号处理策略
+//
+// 每次执行时按最近一次登录时间（从未登录的按注册时间）依次预警、禁用、删除。
+// 各步骤记录在用户上，重复执行不会重复发信或重复禁用；用户再次登录后之前的记录失效。
+// 管理员重新启用的账号不会再被本策略禁用或删除，直到用户再次登录后重新开始计时。
+type DormancyPolicy struct {
+	userService  UserService
+	tokenService TokenService
+	mailer       AuthMailer
+	auditLogger  AuditLogger
+	config       *DormancyConfig
+}
+
+// NewDormancyPolicy 创建长期未登录账号处理策略，mailer为nil时只记录预警不发信
+func NewDormancyPolicy(userService UserService, tokenService TokenService, mailer AuthMailer, auditLogger AuditLogger, config *DormancyConfig) *DormancyPolicy {
+	if config == nil {
+		config = DefaultDormancyConfig()
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if auditLogger == nil {
+		auditLogger = noopAuditLogger{}
+	}
+	return &DormancyPolicy{
+		userService:  userService,
+		tokenService: tokenService,
+		mailer:       mailer,
+		auditLogger:  auditLogger,
+		config:       config,
+	}
+}
+
+// Run 执行一次策略，单个用户处理失败只记录日志并继续处理其他用户
+func (p *DormancyPolicy) Run(ctx context.Context) (*DormancyReport, error) {
+	now := clockOrDefault(p.config.Clock).Now()
+
+	// 先取出全部候选用户再处理，避免处理过程中的更新影响分页
+	var candidates []*User
+	for page := 1; ; page++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		users, total, err := p.userService.ListInactiveUsers(now.Add(-p.config.WarnAfter), page, p.config.BatchSize)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, users...)
+		if len(users) == 0 || int64(page*p.config.BatchSize) >= total {
+			break
+		}
+	}
+
+	report := &DormancyReport{}
+	for _, user := range candidates {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if err := p.apply(user, now, report); err != nil {
+			log.Printf("处理长期未登录账号失败: user_id=%d err=%v", user.ID, err)
+		}
+	}
+	return report, nil
+}
+
+// apply 按用户当前所处阶段执行下一步
+func (p *DormancyPolicy) apply(user *User, now time.Time, report *DormancyReport) error {
+	if user.DormancyExempt {
+		report.Skipped++
+		return nil
+	}
+
+	lastActive := user.LastActiveAt()
+	inactive := now.Sub(lastActive)
+	// 早于最近一次登录的记录属于上一轮未登录周期
+	warned := user.DormancyWarnedAt != nil && !user.DormancyWarnedAt.Before(lastActive)
+	disabled := user.DormancyDisabledAt != nil && !user.DormancyDisabledAt.Before(lastActive)
+
+	switch {
+	case disabled:
+		if p.config.DeleteAfter <= 0 || user.Status == 1 || inactive < p.config.DeleteAfter {
+			return nil
+		}
+		// 禁用后至少保留DeleteAfter-DisableAfter，给用户申诉恢复的时间
+		if now.Sub(*user.DormancyDisabledAt) < p.config.DeleteAfter-p.config.DisableAfter {
+			return nil
+		}
+		if err := p.userService.DeleteUser(user.ID); err != nil {
+			return err
+		}
+		p.auditLogger.Log(AuditEvent{
+			Type:      AuditEventDormantDeleted,
+			UserID:    user.ID,
+			Detail:    fmt.Sprintf("last_active=%s", lastActive.UTC().Format(time.RFC3339)),
+			CreatedAt: now,
+		})
+		report.Deleted++
+
+	case warned:
+		if inactive < p.config.DisableAfter {
+			return nil
+		}
+		// 预警后至少保留DisableAfter-WarnAfter，避免补发预警后立即禁用
+		if now.Sub(*user.DormancyWarnedAt) < p.config.DisableAfter-p.config.WarnAfter {
+			return nil
+		}
+		// 先撤销Token，失败时下次执行重试
+		if p.tokenService != nil {
+			if err := p.tokenService.RevokeAllUserTokens(user.ID); err != nil {
+				return err
+			}
+		}
+		user.Status = 2
+		user.DormancyDisabledAt = &now
+		if err := p.userService.UpdateUser(user); err != nil {
+			return err
+		}
+		p.auditLogger.Log(AuditEvent{
+			Type:      AuditEventDormantDisabled,
+			UserID:    user.ID,
+			Detail:    fmt.Sprintf("last_active=%s", lastActive.UTC().Format(time.RFC3339)),
+			CreatedAt: now,
+		})
+		report.Disabled++
+
+	default:
+		if user.Status != 1 {
+			return nil
+		}
+		if p.mailer != nil && user.Email != "" {
+			disableAt := now.Add(p.config.DisableAfter - p.config.WarnAfter)
+			if err := p.mailer.Send(MailMessage{
+				To:       user.Email,
+				Template: MailTemplateDormancyWarning,
+				Data:     map[string]string{"username": user.Username, "disable_at": disableAt.UTC().Format(time.RFC3339)},
+			}); err != nil {
+				return err
+			}
+		}
+		user.DormancyWarnedAt = &now
+		if err := p.userService.UpdateUser(user); err != nil {
+			return err
+		}
+		p.auditLogger.Log(AuditEvent{
+			Type:      AuditEventDormancyWarned,
+			UserID:    user.ID,
+			Detail:    fmt.Sprintf("last_active=%s", lastActive.UTC().Format(time.RFC3339)),
+			CreatedAt: now,
+		})
+		report.Warned++
+	}
+	return nil
+}
+
+// DormancyEnforcer 定期执行长期未登录账号处理策略的后台任务
+type DormancyEnforcer struct {
+	policy   *DormancyPolicy
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// StartDormancyEnforcer 启动后台任务，每隔interval执行一次策略
+//
+// 多实例部署时只需在一个实例上启动。服务退出前应调用Stop。
+func StartDormancyEnforcer(policy *DormancyPolicy, interval time.Duration) *DormancyEnforcer {
+	e := &DormancyEnforcer{
+		policy: policy,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go e.run(interval)
+	return e
+}
+
+// Stop 停止后台任务并等待正在进行的处理完成，可重复调用
+func (e *DormancyEnforcer) Stop() {
+	e.stopOnce.Do(func() {
+		close(e.stop)
+	})
+	<-e.done
+}
+
+// run 后台协程，执行失败只记录日志，下一周期重试
+func (e *DormancyEnforcer) run(interval time.Duration) {
+	defer close(e.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-e.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		select {
+		case <-ticker.C:
+			if report, err := e.policy.Run(ctx); err != nil {
+				log.Printf("执行长期未登录账号策略失败: %v", err)
+			} else if report.Warned+report.Disabled+report.Deleted > 0 {
+				log.Printf("长期未登录账号策略: warned=%d disabled=%d deleted=%d", report.Warned, report.Disabled, report.Deleted)
+			}
+		case <-e.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// dormancyUserService 测试用内存用户服务，只实现策略用到的方法
+type dormancyUserService struct {
+	UserService
+	users map[uint]*User
+}
+
+func (s *dormancyUserService) ListInactiveUsers(since time.Time, page, pageSize int) ([]*User, int64, error) {
+	var matched []*User
+	for _, user := range s.users {
+		if !user.LastActiveAt().After(since) {
+			copied := *user
+			matched = append(matched, &copied)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].ID < matched[j].ID })
+
+	total := int64(len(matched))
+	start := (page - 1) * pageSize
+	if start >= len(matched) {
+		return nil, total, nil
+	}
+	end := min(start+pageSize, len(matched))
+	return matched[start:end], total, nil
+}
+
+func (s *dormancyUserService) UpdateUser(user *User) error {
+	copied := *user
+	s.users[user.ID] = &copied
+	return nil
+}
+
+func (s *dormancyUserService) DeleteUser(id uint) error {
+	delete(s.users, id)
+	return nil
+}
+
+// revokingTokenService 记录被撤销Token的用户
+type revokingTokenService struct {
+	TokenService
+	revoked []uint
+}
+
+func (s *revokingTokenService) RevokeAllUserTokens(userID uint) error {
+	s.revoked = append(s.revoked, userID)
+	return nil
+}
+
+func TestDormancyPolicy(t *testing.T) {
+	day := 24 * time.Hour
+	clock := NewFakeClock(time.Time{})
+	start := clock.Now()
+
+	newUser := func(id uint, username string) *User {
+		user := &User{Username: username, Email: username + "@example.com", Status: 1}
+		user.ID = id
+		user.CreatedAt = start
+		return user
+	}
+	users := &dormancyUserService{users: map[uint]*User{}}
+	users.users[1] = newUser(1, "alice")
+	service := newUser(2, "ci-bot")
+	service.DormancyExempt = true
+	users.users[2] = service
+	active := newUser(3, "bob")
+	users.users[3] = active
+
+	tokens := &revokingTokenService{}
+	mailer := NewCaptureMailer()
+	auditLogger := NewMemoryAuditLogger()
+	config := &DormancyConfig{
+		WarnAfter:    30 * day,
+		DisableAfter: 60 * day,
+		DeleteAfter:  90 * day,
+		BatchSize:    1,
+		Clock:        clock,
+	}
+	policy := NewDormancyPolicy(users, tokens, mailer, auditLogger, config)
+
+	run := func() *DormancyReport {
+		report, err := policy.Run(context.Background())
+		assert.NoError(t, err)
+		return report
+	}
+	eventTypes := func() []string {
+		var types []string
+		for _, event := range auditLogger.Events() {
+			types = append(types, event.Type)
+		}
+		return types
+	}
+
+	t.Run("未达到预警时长时不处理", func(t *testing.T) {
+		clock.Advance(29 * day)
+		assert.Equal(t, &DormancyReport{}, run())
+		assert.Empty(t, mailer.Messages())
+	})
+
+	t.Run("达到预警时长时发邮件", func(t *testing.T) {
+		clock.Advance(day)
+		// bob在此之前登录过
+		loginAt := clock.Now().Add(-day)
+		users.users[3].LastLoginAt = &loginAt
+
+		assert.Equal(t, &DormancyReport{Warned: 1, Skipped: 1}, run())
+		messages := mailer.Messages()
+		if assert.Len(t, messages, 1) {
+			assert.Equal(t, "alice@example.com", messages[0].To)
+			assert.Equal(t, MailTemplateDormancyWarning, messages[0].Template)
+			assert.Equal(t, clock.Now().Add(30*day).UTC().Format(time.RFC3339), messages[0].Data["disable_at"])
+		}
+		assert.NotNil(t, users.users[1].DormancyWarnedAt)
+		assert.Nil(t, users.users[2].DormancyWarnedAt, "豁免账号不预警")
+
+		// 重复执行不重复发信
+		assert.Equal(t, &DormancyReport{Skipped: 1}, run())
+		assert.Len(t, mailer.Messages(), 1)
+	})
+
+	t.Run("达到禁用时长时禁用并撤销Token", func(t *testing.T) {
+		clock.Advance(29 * day)
+		run()
+		assert.Equal(t, uint8(1), users.users[1].Status)
+
+		clock.Advance(day)
+		assert.Equal(t, &DormancyReport{Disabled: 1, Skipped: 1}, run())
+		assert.Equal(t, uint8(2), users.users[1].Status)
+		assert.NotNil(t, users.users[1].DormancyDisabledAt)
+		assert.Equal(t, []uint{1}, tokens.revoked)
+		assert.Equal(t, uint8(1), users.users[2].Status)
+
+		// bob收到预警（登录后第30天）
+		assert.Len(t, mailer.Messages(), 2)
+
+		// 重复执行不重复禁用
+		run()
+		assert.Equal(t, []uint{1}, tokens.revoked)
+		assert.Equal(t, []string{AuditEventDormancyWarned, AuditEventDormancyWarned, AuditEventDormantDisabled}, eventTypes())
+	})
+
+	t.Run("达到删除时长时删除", func(t *testing.T) {
+		clock.Advance(29 * day)
+		run()
+		assert.Contains(t, users.users, uint(1))
+
+		clock.Advance(day)
+		report := run()
+		assert.Equal(t, 1, report.Deleted)
+		assert.NotContains(t, users.users, uint(1))
+		assert.Contains(t, users.users, uint(2), "豁免账号不删除")
+		assert.Equal(t, AuditEventDormantDeleted, eventTypes()[len(eventTypes())-1])
+
+		run()
+		assert.Equal(t, 1, countString(eventTypes(), AuditEventDormantDeleted))
+	})
+
+	t.Run("管理员重新启用的账号不再处理", func(t *testing.T) {
+		// bob已被禁用，管理员重新启用
+		bob := users.users[3]
+		assert.Equal(t, uint8(2), bob.Status)
+		bob.Status = 1
+
+		clock.Advance(60 * day)
+		run()
+		assert.Contains(t, users.users, uint(3))
+		assert.Equal(t, uint8(1), users.users[3].Status)
+	})
+
+	t.Run("再次登录后重新计时", func(t *testing.T) {
+		loginAt := clock.Now()
+		users.users[3].LastLoginAt = &loginAt
+		before := len(mailer.Messages())
+
+		clock.Advance(30 * day)
+		assert.Equal(t, 1, run().Warned)
+		assert.Len(t, mailer.Messages(), before+1)
+	})
+}
+
+// countString 统计切片中等于s的元素个数
+func countString(values []string, s string) int {
+	count := 0
+	for _, value := range values {
+		if value == s {
+			count++
+		}
+	}
+	return count
+}
+
+func TestDormancyConfigValidate(t *testing.T) {
+	assert.Empty(t, DefaultDormancyConfig().Validate())
+
+	config := DefaultDormancyConfig()
+	config.DisableAfter = config.WarnAfter
+	config.DeleteAfter = config.WarnAfter
+	warnings := config.Validate()
+	assert.Len(t, warnings, 2)
+	for _, warning := range warnings {
+		assert.Equal(t, ConfigSeverityError, warning.Severity)
+	}
+}
+
+func TestListInactiveUsersWithDB(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	// 清理数据
+	testDB.ClearAllData()
+
+	userService := NewUserService(testDB.DB)
+	never := testDB.CreateTestUser("neverlogin", "never@example.com", "Password123!")
+	old := testDB.CreateTestUser("oldlogin", "old@example.com", "Password123!")
+	recent := testDB.CreateTestUser("recentlogin", "recent@example.com", "Password123!")
+
+	longAgo := time.Now().Add(-400 * 24 * time.Hour)
+	testDB.DB.Model(&User{}).Where("id = ?", never.ID).UpdateColumn("created_at", longAgo)
+	testDB.DB.Model(&User{}).Where("id = ?", old.ID).UpdateColumn("last_login_at", longAgo)
+	testDB.DB.Model(&User{}).Where("id = ?", recent.ID).UpdateColumn("created_at", longAgo)
+	now := time.Now()
+	testDB.DB.Model(&User{}).Where("id = ?", recent.ID).UpdateColumn("last_login_at", now)
+
+	users, total, err := userService.ListInactiveUsers(time.Now().Add(-365*24*time.Hour), 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	if assert.Len(t, users, 2) {
+		assert.Equal(t, never.ID, users[0].ID)
+		assert.Equal(t, old.ID, users[1].ID)
+	}
+
+	users, _, err = userService.ListInactiveUsers(time.Now().Add(-365*24*time.Hour), 2, 1)
+	assert.NoError(t, err)
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, old.ID, users[0].ID)
+	}
+}
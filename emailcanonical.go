@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// EmailCanonicalizer 邮箱规范化接口，规范形式相同的邮箱视为同一个邮箱
+//
+// 用于防止同一个人用别名（如user+1@gmail.com）注册多个账户；用户仍保存原始邮箱，发信使用原始邮箱。
+// 通过UserServiceConfig.EmailCanonicalizer启用，默认不启用。
+type EmailCanonicalizer interface {
+	Canonicalize(email string) string
+}
+
+// gmailDomains 忽略点号和+标签的Gmail域名
+var gmailDomains = map[string]bool{
+	"gmail.com":      true,
+	"googlemail.com": true,
+}
+
+// GmailCanonicalizer 识别Gmail别名的邮箱规范化器
+//
+// gmail.com和googlemail.com的邮箱去掉本地部分的点号和+之后的标签、转为小写，域名统一为gmail.com；
+// 其他域名的本地部分保持不变（各邮件服务商对点号、+和大小写的处理不同），只将域名转为小写。
+type GmailCanonicalizer struct{}
+
+// NewGmailCanonicalizer 创建识别Gmail别名的邮箱规范化器
+func NewGmailCanonicalizer() *GmailCanonicalizer {
+	return &GmailCanonicalizer{}
+}
+
+// Canonicalize 获取邮箱的规范形式，无法解析的邮箱只去除首尾空白
+func (GmailCanonicalizer) Canonicalize(email string) string {
+	email = strings.TrimSpace(email)
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return email
+	}
+	local, domain := email[:at], strings.ToLower(email[at+1:])
+
+	if !gmailDomains[domain] {
+		return local + "@" + domain
+	}
+	if plus := strings.Index(local, "+"); plus >= 0 {
+		local = local[:plus]
+	}
+	local = strings.ToLower(strings.ReplaceAll(local, ".", ""))
+	if local == "" {
+		// 如"+tag@gmail.com"、".@gmail.com"，不是有效的Gmail地址，保持原样以免与其他地址冲突
+		return strings.ToLower(email)
+	}
+	return local + "@gmail.com"
+}
+
+// canonicalEmail 按规范化器获取邮箱的规范形式，规范化器为nil时返回空字符串
+func canonicalEmail(canonicalizer EmailCanonicalizer, email string) string {
+	if canonicalizer != nil && email != "" {
+		return canonicalizer.Canonicalize(email)
+	}
+	return ""
+}
+
+// whereEmail 按邮箱查询的条件，启用规范化时同时匹配规范形式，尚未补齐规范形式的用户按原始邮箱匹配
+func whereEmail(db *gorm.DB, canonicalizer EmailCanonicalizer, email string) *gorm.DB {
+	if canonical := canonicalEmail(canonicalizer, email); canonical != "" {
+		return db.Where("email_canonical = ? OR email = ?", canonical, email)
+	}
+	return db.Where("email = ?", email)
+}
+
+// BackfillEmailCanonical 按指定的规范化器重新计算全部用户（含已软删除）的邮箱规范形式，返回更新的用户数
+//
+// 启用或更换UserServiceConfig.EmailCanonicalizer后以同一个规范化器执行一次；传入nil时清空规范形式。
+// 已有用户的规范形式相同时不会合并，需另行处理。
+func BackfillEmailCanonical(db *gorm.DB, canonicalizer EmailCanonicalizer) (int64, error) {
+	var updated int64
+	var users []*User
+	err := db.Unscoped().Select("id", "email", "email_canonical").FindInBatches(&users, 500, func(tx *gorm.DB, batch int) error {
+		for _, user := range users {
+			canonical := canonicalEmail(canonicalizer, user.Email)
+			if canonical == user.EmailCanonical {
+				continue
+			}
+			if err := db.Unscoped().Model(&User{}).Where("id = ?", user.ID).UpdateColumn("email_canonical", canonical).Error; err != nil {
+				return err
+			}
+			updated++
+		}
+		return nil
+	}).Error
+	return updated, err
+}
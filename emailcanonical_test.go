@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGmailCanonicalizer(t *testing.T) {
+	canonicalizer := NewGmailCanonicalizer()
+	tests := []struct {
+		email string
+		want  string
+	}{
+		{"john.doe@gmail.com", "johndoe@gmail.com"},
+		{"John.Doe+shopping@Gmail.com", "johndoe@gmail.com"},
+		{"j.o.h.n.d.o.e+a+b@googlemail.com", "johndoe@gmail.com"},
+		{"  johndoe@gmail.com ", "johndoe@gmail.com"},
+		// 其他域名的本地部分不变，只将域名转为小写
+		{"john.doe+tag@example.com", "john.doe+tag@example.com"},
+		{"John.Doe@Example.COM", "John.Doe@example.com"},
+		{"john@gmail.com.evil.com", "john@gmail.com.evil.com"},
+		// 无法解析或规范化后为空的地址保持原样
+		{"not-an-email", "not-an-email"},
+		{"@gmail.com", "@gmail.com"},
+		{"john@", "john@"},
+		{"+tag@gmail.com", "+tag@gmail.com"},
+		{"...@Gmail.com", "...@gmail.com"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, canonicalizer.Canonicalize(tt.email), tt.email)
+	}
+}
+
+func TestCanonicalEmail(t *testing.T) {
+	assert.Equal(t, "", canonicalEmail(nil, "john.doe@gmail.com"), "默认不启用")
+	assert.Equal(t, "johndoe@gmail.com", canonicalEmail(NewGmailCanonicalizer(), "john.doe+1@gmail.com"))
+
+	user := &User{Email: "John.Doe+1@gmail.com"}
+	user.updateEmailCanonical(NewGmailCanonicalizer())
+	assert.Equal(t, "johndoe@gmail.com", user.EmailCanonical)
+	assert.Equal(t, "John.Doe+1@gmail.com", user.Email, "保存原始邮箱")
+
+	user.updateEmailCanonical(nil)
+	assert.Equal(t, "johndoe@gmail.com", user.EmailCanonical, "未配置规范化器时保留原值")
+}
+
+func TestUserServiceEmailCanonicalizerConfig(t *testing.T) {
+	assert.Nil(t, NewUserService(nil).(*userService).emailCanonicalizer, "默认不启用")
+
+	canonicalizer := NewGmailCanonicalizer()
+	service := NewUserServiceWithConfig(nil, &UserServiceConfig{EmailCanonicalizer: canonicalizer}).(*userService)
+	assert.Equal(t, canonicalizer, service.emailCanonicalizer)
+}
+
+func TestVerificationResendThrottleUsesCanonicalEmail(t *testing.T) {
+	newService := func(canonicalizer EmailCanonicalizer) *authService {
+		config := DefaultAuthConfig()
+		config.RateLimitStore = NewMemoryRateLimitStore()
+		config.EmailVerification.ResendLimit = 1
+		config.EmailCanonicalizer = canonicalizer
+		return &authService{config: config}
+	}
+
+	service := newService(NewGmailCanonicalizer())
+	assert.NoError(t, service.throttleVerificationResend("john.doe+1@gmail.com"))
+	assert.True(t, errors.Is(service.throttleVerificationResend("JohnDoe+2@gmail.com"), ErrVerificationResendThrottled), "别名共用次数")
+
+	service = newService(nil)
+	assert.NoError(t, service.throttleVerificationResend("john.doe+1@gmail.com"))
+	assert.NoError(t, service.throttleVerificationResend("JohnDoe+2@gmail.com"), "默认按原始邮箱计数")
+	assert.True(t, errors.Is(service.throttleVerificationResend(" John.Doe+1@Gmail.com "), ErrVerificationResendThrottled))
+}
+
+func TestEmailCanonicalizationWithDB(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	canonicalizer := NewGmailCanonicalizer()
+	userService := NewUserServiceWithConfig(testDB.DB, &UserServiceConfig{EmailCanonicalizer: canonicalizer})
+	createUser := func(t *testing.T, service UserService, username, email string) *User {
+		user := &User{Username: username, Email: email, PasswordHash: "Password123!", Status: 1}
+		assert.NoError(t, service.CreateUser(user))
+		return user
+	}
+
+	t.Run("规范形式相同的Gmail地址不能重复注册", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		user := createUser(t, userService, "johndoe", "John.Doe@gmail.com")
+		assert.Equal(t, "johndoe@gmail.com", user.EmailCanonical)
+
+		err := userService.CreateUser(&User{Username: "johndoe2", Email: "johndoe+2@gmail.com", PasswordHash: "Password123!", Status: 1})
+		assert.True(t, errors.Is(err, ErrEmailTaken))
+
+		found, err := userService.GetUserByEmail("j.o.h.n.doe+newsletter@googlemail.com")
+		assert.NoError(t, err)
+		assert.Equal(t, user.ID, found.ID)
+		assert.Equal(t, "John.Doe@gmail.com", found.Email)
+	})
+
+	t.Run("其他域名不受影响", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		createUser(t, userService, "alice1", "alice.smith@example.com")
+		createUser(t, userService, "alice2", "alicesmith@example.com")
+		createUser(t, userService, "alice3", "alice.smith+1@example.com")
+	})
+
+	t.Run("修改邮箱时检查规范形式", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		createUser(t, userService, "owner", "owner@gmail.com")
+		other := createUser(t, userService, "other", "other@gmail.com")
+
+		other.Email = "o.w.n.e.r+x@gmail.com"
+		assert.True(t, errors.Is(userService.UpdateUser(other), ErrEmailTaken))
+
+		// 改为自己邮箱的别名允许
+		other.Email = "o.t.h.e.r@gmail.com"
+		assert.NoError(t, userService.UpdateUser(other))
+	})
+
+	t.Run("未配置规范化器的服务不受影响", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		plain := NewUserService(testDB.DB)
+		createUser(t, userService, "johndoe", "John.Doe@gmail.com")
+		createUser(t, plain, "johndoe2", "johndoe+2@gmail.com")
+		_, err := plain.GetUserByEmail("j.o.h.n.doe@gmail.com")
+		assert.True(t, errors.Is(err, ErrUserNotFound))
+	})
+
+	t.Run("启用前创建的用户补齐规范形式", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		user := testDB.CreateTestUser("legacy", "Legacy.User@gmail.com", "Password123!")
+		assert.Equal(t, "", user.EmailCanonical)
+
+		// 补齐前按原始邮箱仍能找到
+		_, err := userService.GetUserByEmail("Legacy.User@gmail.com")
+		assert.NoError(t, err)
+
+		updated, err := BackfillEmailCanonical(testDB.DB, canonicalizer)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), updated)
+
+		found, err := userService.GetUserByEmail("legacyuser+1@gmail.com")
+		assert.NoError(t, err)
+		assert.Equal(t, user.ID, found.ID)
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+// 邮箱验证错误定义
+var (
+	ErrEmailVerificationNotEnabled = errors.New("未启用邮箱验证")
+	ErrVerificationResendThrottled = errors.New("验证邮件发送过于频繁，请稍后再试")
+)
+
+// EmailVerificationConfig 邮箱验证配置，需同时配置 AuthConfig.VerificationCodes 和 AuthConfig.Mailer
+type EmailVerificationConfig struct {
+	CodeTTL      time.Duration // 验证码有效期
+	CodeDigits   int           // 验证码位数
+	ResendLimit  int           // 每个邮箱在ResendWindow内最多请求的次数，0表示不限制
+	ResendWindow time.Duration // 重发限流窗口
+}
+
+// DefaultEmailVerificationConfig 默认邮箱验证配置
+func DefaultEmailVerificationConfig() EmailVerificationConfig {
+	return EmailVerificationConfig{
+		CodeTTL:      30 * time.Minute,
+		CodeDigits:   6,
+		ResendLimit:  3,
+		ResendWindow: time.Hour,
+	}
+}
+
+// ResendVerification 重新发送邮箱验证码
+//
+// 为防止通过该接口探测邮箱是否注册，邮箱不存在或已验证时同样返回nil，且都计入限流次数；
+// 新验证码替换该用户之前的验证码，邮件异步发送，失败只记录日志。
+func (s *authService) ResendVerification(email string) error {
+	if s.config.VerificationCodes == nil || s.config.Mailer == nil {
+		return ErrEmailVerificationNotEnabled
+	}
+	if err := s.throttleVerificationResend(email); err != nil {
+		return err
+	}
+
+	user, err := s.userService.GetUserByEmail(email)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return nil
+	}
+
+	go func() {
+		config := s.config.EmailVerification
+		code, err := s.config.VerificationCodes.Issue(user.ID, VerificationPurposeEmail, config.CodeTTL, config.CodeDigits)
+		if err != nil {
+			log.Printf("发送邮箱验证码失败: user_id=%d err=%v", user.ID, err)
+			return
+		}
+
+		message := MailMessage{To: user.Email, Template: MailTemplateEmailVerification, Data: map[string]string{"code": code}}
+		if err := s.config.Mailer.Send(message); err != nil {
+			log.Printf("发送邮箱验证码失败: user_id=%d err=%v", user.ID, err)
+		}
+	}()
+	return nil
+}
+
+// throttleVerificationResend 按邮箱限制重发次数，配置了邮箱规范化器时按规范形式计数，未配置限流存储时不限制
+func (s *authService) throttleVerificationResend(email string) error {
+	config := s.config.EmailVerification
+	if s.config.RateLimitStore == nil || config.ResendLimit <= 0 {
+		return nil
+	}
+
+	email = strings.TrimSpace(email)
+	if canonical := canonicalEmail(s.config.EmailCanonicalizer, email); canonical != "" {
+		email = canonical
+	}
+	key := "verification_resend:" + strings.ToLower(email)
+	count, err := s.config.RateLimitStore.Increment(key, config.ResendWindow)
+	if err != nil {
+		return err
+	}
+	if count > config.ResendLimit {
+		return ErrVerificationResendThrottled
+	}
+	return nil
+}
+
+// ConfirmEmailVerification 验证邮箱验证码并将邮箱标记为已验证
+func (s *authService) ConfirmEmailVerification(email, code string) error {
+	if s.config.VerificationCodes == nil {
+		return ErrEmailVerificationNotEnabled
+	}
+
+	user, err := s.userService.GetUserByEmail(email)
+	if errors.Is(err, ErrUserNotFound) {
+		return ErrVerificationCodeNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return nil
+	}
+
+	if err := s.config.VerificationCodes.Verify(user.ID, VerificationPurposeEmail, code); err != nil {
+		return err
+	}
+	if err := s.db.Model(&User{}).Where("id = ?", user.ID).UpdateColumn("email_verified", true).Error; err != nil {
+		return err
+	}
+	invalidateUserCache(s.userService, user.ID)
+	return nil
+}
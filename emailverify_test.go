@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmailVerification(t *testing.T) {
+	// 设置测试数据库
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	newService := func(mailer *CaptureMailer) AuthService {
+		config := DefaultAuthConfig()
+		config.Mailer = mailer
+		config.VerificationCodes = NewVerificationCodeService(NewMemoryVerificationCodeStorage(), nil)
+		config.RateLimitStore = NewMemoryRateLimitStore()
+		config.EmailVerification.ResendLimit = 2
+		userService := NewUserService(testDB.DB)
+		tokenService := NewTokenService("test-secret-key", time.Hour)
+		return NewAuthServiceWithConfig(testDB.DB, userService, tokenService, config)
+	}
+
+	// waitForCode 等待第n封验证邮件并返回其中的验证码
+	waitForCode := func(t *testing.T, mailer *CaptureMailer, n int) string {
+		assert.Eventually(t, func() bool { return len(mailer.Messages()) == n }, time.Second, 10*time.Millisecond)
+		message := mailer.Messages()[n-1]
+		assert.Equal(t, MailTemplateEmailVerification, message.Template)
+		return message.Data["code"]
+	}
+
+	t.Run("重发后旧验证码失效，新验证码完成验证", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		mailer := NewCaptureMailer()
+		service := newService(mailer)
+		user := testDB.CreateTestUser("testuser", "test@example.com", "password123")
+
+		assert.NoError(t, service.ResendVerification("test@example.com"))
+		oldCode := waitForCode(t, mailer, 1)
+		assert.NoError(t, service.ResendVerification("test@example.com"))
+		newCode := waitForCode(t, mailer, 2)
+		assert.Equal(t, "test@example.com", mailer.Messages()[1].To)
+
+		if oldCode != newCode {
+			err := service.ConfirmEmailVerification("test@example.com", oldCode)
+			assert.True(t, errors.Is(err, ErrVerificationCodeInvalid))
+		}
+		assert.NoError(t, service.ConfirmEmailVerification("test@example.com", newCode))
+
+		var saved User
+		assert.NoError(t, testDB.DB.First(&saved, user.ID).Error)
+		assert.True(t, saved.EmailVerified)
+	})
+
+	t.Run("已验证或不存在的邮箱静默返回", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		mailer := NewCaptureMailer()
+		service := newService(mailer)
+		user := testDB.CreateTestUser("verified", "verified@example.com", "password123")
+		assert.NoError(t, testDB.DB.Model(user).UpdateColumn("email_verified", true).Error)
+
+		assert.NoError(t, service.ResendVerification("verified@example.com"))
+		assert.NoError(t, service.ResendVerification("missing@example.com"))
+		time.Sleep(50 * time.Millisecond)
+		assert.Empty(t, mailer.Messages())
+	})
+
+	t.Run("按邮箱限流，不区分邮箱是否存在", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		mailer := NewCaptureMailer()
+		service := newService(mailer)
+		testDB.CreateTestUser("testuser", "test@example.com", "password123")
+
+		for _, email := range []string{"test@example.com", "missing@example.com"} {
+			assert.NoError(t, service.ResendVerification(email))
+			assert.NoError(t, service.ResendVerification(email))
+			err := service.ResendVerification(email)
+			assert.True(t, errors.Is(err, ErrVerificationResendThrottled))
+		}
+
+		// 限流按邮箱计数，不受大小写影响
+		err := service.ResendVerification("TEST@example.com")
+		assert.True(t, errors.Is(err, ErrVerificationResendThrottled))
+		waitForCode(t, mailer, 2)
+	})
+
+	t.Run("未配置验证码服务时返回错误", func(t *testing.T) {
+		userService := NewUserService(testDB.DB)
+		service := NewAuthService(testDB.DB, userService, NewTokenService("test-secret-key", time.Hour))
+
+		assert.True(t, errors.Is(service.ResendVerification("test@example.com"), ErrEmailVerificationNotEnabled))
+		assert.True(t, errors.Is(service.ConfirmEmailVerification("test@example.com", "123456"), ErrEmailVerificationNotEnabled))
+	})
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"aigo_service_auth/errorcodes"
+	"aigo_service_auth/migrations"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// errorCodeMapping 错误与错误码的对应关系
+type errorCodeMapping struct {
+	err  error
+	code string
+}
+
+// errorCodeMappings 全部哨兵错误的错误码，按顺序用errors.Is匹配，第一个匹配的生效
+//
+// 新增导出的哨兵错误时必须在此登记，TestSentinelErrorsHaveCodes会检查遗漏。
+var errorCodeMappings = []errorCodeMapping{
+	// 登录与账户状态
+	{ErrInvalidCredentials, errorcodes.ErrCodeInvalidCredentials},
+	{ErrUserDisabled, errorcodes.ErrCodeUserDisabled},
+	{ErrUserSuspended, errorcodes.ErrCodeUserSuspended},
+	{ErrAccountLocked, errorcodes.ErrCodeAccountLocked},
+	{ErrLoginDenied, errorcodes.ErrCodeLoginDenied},
+	{ErrChallengeRequired, errorcodes.ErrCodeChallengeRequired},
+	{ErrCaptchaInvalid, errorcodes.ErrCodeCaptchaInvalid},
+	{ErrTermsAcceptanceRequired, errorcodes.ErrCodeTermsAcceptanceRequired},
+	{ErrSeatLimitReached, errorcodes.ErrCodeSeatLimitReached},
+	{ErrSessionLimitReached, errorcodes.ErrCodeSessionLimitReached},
+	{ErrTOTPRequired, errorcodes.ErrCodeMFARequired},
+
+	// Token与会话
+	{ErrStaleCredentials, errorcodes.ErrCodeTokenRevoked},
+	{ErrTokenIssuedBeforeWatermark, errorcodes.ErrCodeTokenRevoked},
+	{ErrSessionLifetimeExceeded, errorcodes.ErrCodeSessionExpired},
+	{ErrInvalidSessionToken, errorcodes.ErrCodeTokenInvalid},
+	{ErrTokenTooLong, errorcodes.ErrCodeTokenInvalid},
+	{ErrMalformedToken, errorcodes.ErrCodeTokenInvalid},
+	{ErrInvalidJTI, errorcodes.ErrCodeInvalidArgument},
+	{ErrTokenQuotaExceeded, errorcodes.ErrCodeTokenQuotaExceeded},
+	{jwt.ErrTokenExpired, errorcodes.ErrCodeTokenExpired},
+	{jwt.ErrTokenMalformed, errorcodes.ErrCodeTokenInvalid},
+	{jwt.ErrTokenSignatureInvalid, errorcodes.ErrCodeTokenInvalid},
+	{jwt.ErrTokenNotValidYet, errorcodes.ErrCodeTokenInvalid},
+	{jwt.ErrTokenInvalidClaims, errorcodes.ErrCodeTokenInvalid},
+
+	// 操作确认
+	{ErrInvalidActionToken, errorcodes.ErrCodeInvalidConfirmation},
+	{ErrActionTokenExpired, errorcodes.ErrCodeInvalidConfirmation},
+	{ErrActionTokenUsed, errorcodes.ErrCodeInvalidConfirmation},
+	{ErrConfirmationRequired, errorcodes.ErrCodeConfirmationRequired},
+
+	// 用户资料与密码
+	{ErrValidation, errorcodes.ErrCodeValidationFailed},
+	{ErrUsernameTaken, errorcodes.ErrCodeDuplicateUsername},
+	{ErrEmailTaken, errorcodes.ErrCodeDuplicateEmail},
+	{ErrInvalidInvitationCode, errorcodes.ErrCodeInvalidInvitationCode},
+	{ErrOldPasswordIncorrect, errorcodes.ErrCodeIncorrectPassword},
+	{ErrPasswordEmpty, errorcodes.ErrCodePolicyViolation},
+	{ErrPasswordTooShort, errorcodes.ErrCodePolicyViolation},
+	{ErrPasswordTooLong, errorcodes.ErrCodePolicyViolation},
+	{ErrPasswordPolicyViolation, errorcodes.ErrCodePolicyViolation},
+	{ErrPasswordTooWeak, errorcodes.ErrCodePasswordTooWeak},
+	{ErrPasswordTooSimilar, errorcodes.ErrCodePasswordTooSimilar},
+	{ErrPasswordInHistory, errorcodes.ErrCodePasswordReused},
+	{ErrPasswordPolicyNotFound, errorcodes.ErrCodeInvalidArgument},
+
+	// 验证码与重置码
+	{ErrVerificationCodeNotFound, errorcodes.ErrCodeInvalidVerificationCode},
+	{ErrVerificationCodeInvalid, errorcodes.ErrCodeInvalidVerificationCode},
+	{ErrVerificationCodeExpired, errorcodes.ErrCodeVerificationCodeExpired},
+	{ErrVerificationAttemptsExceeded, errorcodes.ErrCodeVerificationAttemptsExceeded},
+	{ErrInvalidResetCode, errorcodes.ErrCodeInvalidResetCode},
+	{ErrResetCodeUsed, errorcodes.ErrCodeInvalidResetCode},
+	{ErrResetCodeExpired, errorcodes.ErrCodeResetCodeExpired},
+	{ErrInvalidTOTPCode, errorcodes.ErrCodeInvalidVerificationCode},
+	{ErrVerificationResendThrottled, errorcodes.ErrCodeRateLimited},
+	{ErrUnlockRequestThrottled, errorcodes.ErrCodeRateLimited},
+	{ErrLoginIPLocked, errorcodes.ErrCodeRateLimited},
+
+	// 资源不存在
+	{ErrUserNotFound, errorcodes.ErrCodeUserNotFound},
+	{ErrRoleNotFound, errorcodes.ErrCodeRoleNotFound},
+	{ErrPermissionNotFound, errorcodes.ErrCodePermissionNotFound},
+	{ErrDeviceNotFound, errorcodes.ErrCodeDeviceNotFound},
+
+	// 权限
+	{ErrReadDeletedDenied, errorcodes.ErrCodePermissionDenied},
+
+	// 功能未启用
+	{ErrChallengeNotEnabled, errorcodes.ErrCodeFeatureNotEnabled},
+	{ErrEmailVerificationNotEnabled, errorcodes.ErrCodeFeatureNotEnabled},
+	{ErrSelfUnlockNotEnabled, errorcodes.ErrCodeFeatureNotEnabled},
+	{ErrTokenSaltNotEnabled, errorcodes.ErrCodeFeatureNotEnabled},
+
+	// 调用参数
+	{ErrInvalidActionTTL, errorcodes.ErrCodeInvalidArgument},
+	{ErrTOTPNotEnabled, errorcodes.ErrCodeInvalidArgument},
+	{ErrTOTPAlreadyEnabled, errorcodes.ErrCodeInvalidArgument},
+	{ErrTOTPEnrollmentNotFound, errorcodes.ErrCodeInvalidArgument},
+	{ErrInvalidBackupCodeCount, errorcodes.ErrCodeInvalidArgument},
+	{ErrInvalidTermsVersion, errorcodes.ErrCodeInvalidArgument},
+	{ErrInvalidOptions, errorcodes.ErrCodeInvalidArgument},
+	{ErrInsufficientEntropy, errorcodes.ErrCodeInvalidArgument},
+	{ErrInvalidUserID, errorcodes.ErrCodeInvalidArgument},
+	{ErrReservedClaim, errorcodes.ErrCodeInvalidArgument},
+	{ErrInvalidPermissionName, errorcodes.ErrCodeInvalidArgument},
+	{ErrInvalidResourcePath, errorcodes.ErrCodeInvalidArgument},
+	{ErrUnknownCommand, errorcodes.ErrCodeInvalidArgument},
+	{ErrMissingArgument, errorcodes.ErrCodeInvalidArgument},
+	{ErrInvalidArgument, errorcodes.ErrCodeInvalidArgument},
+	{migrations.ErrInvalidSteps, errorcodes.ErrCodeInvalidArgument},
+
+	// 服务端故障，不应把细节返回给客户端
+	{ErrHashingFailed, errorcodes.ErrCodeInternal},
+	{ErrInvalidHash, errorcodes.ErrCodeInternal},
+	{ErrInvalidPasswordHash, errorcodes.ErrCodeInternal},
+	{ErrStorageError, errorcodes.ErrCodeInternal},
+	{ErrRevocationStoreFull, errorcodes.ErrCodeInternal},
+	{ErrFieldKeyNotFound, errorcodes.ErrCodeInternal},
+	{ErrFieldCiphertextInvalid, errorcodes.ErrCodeInternal},
+	{ErrFieldEncryptorMissing, errorcodes.ErrCodeInternal},
+	{ErrAuditWriterClosed, errorcodes.ErrCodeInternal},
+	{ErrInvalidConfiguration, errorcodes.ErrCodeInternal},
+	{ErrQueryBudgetExceeded, errorcodes.ErrCodeInternal},
+	{migrations.ErrMigrationOrder, errorcodes.ErrCodeInternal},
+	{migrations.ErrUnknownMigration, errorcodes.ErrCodeInternal},
+}
+
+// CodeOf 获取错误对应的错误码，err为nil时返回空字符串，无法识别的错误返回internal_error
+//
+// ValidationError按validation_failed处理，PasswordValidationError取最先发现的失败原因，
+// 其余错误按errorCodeMappings顺序用errors.Is匹配，包括实现了Is或Unwrap的类型化错误。
+func CodeOf(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return errorcodes.ErrCodeValidationFailed
+	}
+	var passwordErr *PasswordValidationError
+	if errors.As(err, &passwordErr) && len(passwordErr.Reasons) > 0 {
+		return CodeOf(passwordErr.Reasons[0])
+	}
+
+	for _, mapping := range errorCodeMappings {
+		if errors.Is(err, mapping.err) {
+			return mapping.code
+		}
+	}
+	return errorcodes.ErrCodeInternal
+}
+
+// errorResponse 错误响应体
+type errorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeErrorCode 以错误码对应的状态码写入JSON错误响应
+func writeErrorCode(w http.ResponseWriter, code, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(errorcodes.HTTPStatusOf(code))
+	json.NewEncoder(w).Encode(errorResponse{Code: code, Message: message})
+}
+
+// WriteError 按err的错误码写入JSON错误响应，供业务处理器返回服务层错误
+//
+// ValidationError按WriteValidationError的格式写入；内部错误只返回通用提示，不暴露错误细节。
+func WriteError(w http.ResponseWriter, err error) {
+	if WriteValidationError(w, err) {
+		return
+	}
+	code := CodeOf(err)
+	message := err.Error()
+	if code == errorcodes.ErrCodeInternal {
+		message = "服务器内部错误"
+	}
+	writeErrorCode(w, code, message)
+}
+
+// unauthorizedCode Token校验失败时的错误码，不是401类的错误码（如用户被禁用）统一按invalid_token处理
+//
+// 认证中间件对所有校验失败都返回401，客户端据此重新登录。
+func unauthorizedCode(err error) string {
+	if code := CodeOf(err); errorcodes.HTTPStatusOf(code) == http.StatusUnauthorized {
+		return code
+	}
+	return errorcodes.ErrCodeTokenInvalid
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"aigo_service_auth/errorcodes"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// sentinelErrors 解析dir中非测试文件声明的导出哨兵错误，名称带上qualifier前缀
+func sentinelErrors(t *testing.T, dir, qualifier string) []string {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info fs.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	assert.NoError(t, err)
+
+	var names []string
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.VAR {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					value := spec.(*ast.ValueSpec)
+					for i, name := range value.Names {
+						if !name.IsExported() || !strings.HasPrefix(name.Name, "Err") || i >= len(value.Values) {
+							continue
+						}
+						if _, ok := value.Values[i].(*ast.CallExpr); ok {
+							names = append(names, qualifier+name.Name)
+						}
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+func TestSentinelErrorsHaveCodes(t *testing.T) {
+	// 收集errorcode.go中登记的错误
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "errorcode.go", nil, 0)
+	assert.NoError(t, err)
+	mapped := make(map[string]bool)
+	ast.Inspect(file, func(node ast.Node) bool {
+		switch expr := node.(type) {
+		case *ast.SelectorExpr:
+			if pkg, ok := expr.X.(*ast.Ident); ok {
+				mapped[pkg.Name+"."+expr.Sel.Name] = true
+			}
+			return false
+		case *ast.Ident:
+			mapped[expr.Name] = true
+		}
+		return true
+	})
+
+	// testfixtures只在测试中使用，其错误不会返回给客户端，不需要错误码
+	sentinels := append(sentinelErrors(t, ".", ""), sentinelErrors(t, "migrations", "migrations.")...)
+	assert.NotEmpty(t, sentinels)
+	for _, name := range sentinels {
+		assert.True(t, mapped[name], "%s 没有错误码，请在errorCodeMappings中登记", name)
+	}
+
+	// 登记的错误码都在目录中
+	for _, mapping := range errorCodeMappings {
+		assert.True(t, errorcodes.Known(mapping.code), mapping.code)
+	}
+}
+
+func TestCodeOf(t *testing.T) {
+	t.Run("哨兵错误及其包装", func(t *testing.T) {
+		assert.Equal(t, "", CodeOf(nil))
+		assert.Equal(t, errorcodes.ErrCodeInvalidCredentials, CodeOf(ErrInvalidCredentials))
+		assert.Equal(t, errorcodes.ErrCodeUserDisabled, CodeOf(fmt.Errorf("登录失败: %w", ErrUserDisabled)))
+		assert.Equal(t, errorcodes.ErrCodeDuplicateUsername, CodeOf(ErrUsernameTaken))
+		assert.Equal(t, errorcodes.ErrCodeInternal, CodeOf(errors.New("数据库连接失败")))
+	})
+
+	t.Run("类型化错误", func(t *testing.T) {
+		assert.Equal(t, errorcodes.ErrCodeChallengeRequired, CodeOf(&ChallengeRequiredError{Challenge: ChallengeCaptcha}))
+		assert.Equal(t, errorcodes.ErrCodeTermsAcceptanceRequired, CodeOf(&TermsAcceptanceRequiredError{RequiredVersion: "v2"}))
+		assert.Equal(t, errorcodes.ErrCodeSeatLimitReached, CodeOf(&TenantLimitError{Err: ErrSeatLimitReached, TenantID: 1}))
+
+		passwordErr := &PasswordValidationError{}
+		passwordErr.add(ErrPasswordPolicyViolation, "密码长度至少8位")
+		passwordErr.add(ErrPasswordTooWeak)
+		assert.Equal(t, errorcodes.ErrCodePolicyViolation, CodeOf(passwordErr))
+
+		validationErr := &ValidationError{}
+		validationErr.addCause(FieldUsername, ValidationCodeTaken, ErrUsernameTaken)
+		assert.Equal(t, errorcodes.ErrCodeValidationFailed, CodeOf(validationErr))
+	})
+
+	t.Run("Token过期", func(t *testing.T) {
+		clock := NewFakeClock(time.Time{})
+		config := DefaultJWTConfig()
+		config.DefaultExpiration = time.Minute
+		config.Clock = clock
+		token, err := NewJWTService(config).GenerateToken(1)
+		assert.NoError(t, err)
+
+		clock.Advance(2 * time.Minute)
+		_, err = NewJWTService(config).ParseToken(token)
+		assert.True(t, errors.Is(err, jwt.ErrTokenExpired))
+		assert.Equal(t, errorcodes.ErrCodeTokenExpired, CodeOf(err))
+		assert.Equal(t, errorcodes.ErrCodeTokenExpired, unauthorizedCode(err))
+		assert.Equal(t, errorcodes.ErrCodeTokenInvalid, unauthorizedCode(ErrUserDisabled))
+	})
+}
+
+func TestWriteError(t *testing.T) {
+	decode := func(recorder *httptest.ResponseRecorder) map[string]any {
+		var body map[string]any
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+		return body
+	}
+
+	t.Run("按错误码写入状态码", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		WriteError(recorder, ErrAccountLocked)
+		assert.Equal(t, http.StatusLocked, recorder.Code)
+		assert.Equal(t, "application/json; charset=utf-8", recorder.Header().Get("Content-Type"))
+		body := decode(recorder)
+		assert.Equal(t, errorcodes.ErrCodeAccountLocked, body["code"])
+		assert.Equal(t, ErrAccountLocked.Error(), body["message"])
+	})
+
+	t.Run("内部错误不暴露细节", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		WriteError(recorder, errors.New("dial tcp 10.0.0.1:3306: connection refused"))
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+		body := decode(recorder)
+		assert.Equal(t, errorcodes.ErrCodeInternal, body["code"])
+		assert.NotContains(t, body["message"], "10.0.0.1")
+	})
+
+	t.Run("校验错误按字段写入", func(t *testing.T) {
+		validationErr := &ValidationError{}
+		validationErr.addCause(FieldEmail, ValidationCodeTaken, ErrEmailTaken)
+		recorder := httptest.NewRecorder()
+		WriteError(recorder, validationErr)
+		assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+		assert.Contains(t, decode(recorder)["errors"], FieldEmail)
+	})
+}
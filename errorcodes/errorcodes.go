@@ -0,0 +1,198 @@
+// Package errorcodes 对外稳定的错误码目录
+//
+// 错误码写入HTTP错误响应的code字段，前端据此展示提示或决定后续流程，不应解析message。
+// 已发布的错误码不得修改或删除；新增错误码时在catalog中登记HTTP状态码和说明，
+// 然后执行go generate ./errorcodes重新生成catalog.json和catalog.md。
+package errorcodes
+
+//go:generate go run ./gen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// 通用错误码
+const (
+	ErrCodeInternal          = "internal_error"
+	ErrCodeInvalidArgument   = "invalid_argument"
+	ErrCodeInvalidRequest    = "invalid_request"
+	ErrCodeMethodNotAllowed  = "method_not_allowed"
+	ErrCodeValidationFailed  = "validation_failed"
+	ErrCodeFeatureNotEnabled = "feature_not_enabled"
+	ErrCodeRateLimited       = "rate_limited"
+)
+
+// 认证与会话错误码
+const (
+	ErrCodeUnauthenticated         = "unauthenticated"
+	ErrCodeInvalidCredentials      = "invalid_credentials"
+	ErrCodeUserDisabled            = "user_disabled"
+	ErrCodeUserSuspended           = "user_suspended"
+	ErrCodeAccountLocked           = "account_locked"
+	ErrCodeLoginDenied             = "login_denied"
+	ErrCodeChallengeRequired       = "challenge_required"
+	ErrCodeCaptchaInvalid          = "captcha_invalid"
+	ErrCodeMFARequired             = "mfa_required"
+	ErrCodeEmailUnverified         = "email_unverified"
+	ErrCodeTermsAcceptanceRequired = "terms_acceptance_required"
+	ErrCodeTokenInvalid            = "invalid_token"
+	ErrCodeTokenExpired            = "token_expired"
+	ErrCodeTokenRevoked            = "token_revoked"
+	ErrCodeSessionExpired          = "session_expired"
+	ErrCodeTokenQuotaExceeded      = "token_quota_exceeded"
+	ErrCodeCSRFFailed              = "csrf_failed"
+)
+
+// 授权错误码
+const (
+	ErrCodePermissionDenied     = "permission_denied"
+	ErrCodeConfirmationRequired = "confirmation_required"
+	ErrCodeInvalidConfirmation  = "invalid_confirmation"
+	ErrCodeSeatLimitReached     = "tenant_seat_limit_reached"
+	ErrCodeSessionLimitReached  = "tenant_session_limit_reached"
+)
+
+// 用户资料与密码错误码
+const (
+	ErrCodeDuplicateUsername     = "duplicate_username"
+	ErrCodeDuplicateEmail        = "duplicate_email"
+	ErrCodeInvalidInvitationCode = "invalid_invitation_code"
+	ErrCodeIncorrectPassword     = "incorrect_password"
+	ErrCodePolicyViolation       = "password_policy_violation"
+	ErrCodePasswordTooWeak       = "password_too_weak"
+	ErrCodePasswordTooSimilar    = "password_too_similar"
+	ErrCodePasswordReused        = "password_reused"
+)
+
+// 验证码与重置码错误码
+const (
+	ErrCodeInvalidVerificationCode      = "invalid_verification_code"
+	ErrCodeVerificationCodeExpired      = "verification_code_expired"
+	ErrCodeVerificationAttemptsExceeded = "verification_attempts_exceeded"
+	ErrCodeInvalidResetCode             = "invalid_reset_code"
+	ErrCodeResetCodeExpired             = "reset_code_expired"
+)
+
+// 资源不存在错误码
+const (
+	ErrCodeUserNotFound       = "user_not_found"
+	ErrCodeRoleNotFound       = "role_not_found"
+	ErrCodePermissionNotFound = "permission_not_found"
+	ErrCodeDeviceNotFound     = "device_not_found"
+)
+
+// Entry 错误码目录条目
+type Entry struct {
+	Code        string `json:"code"`
+	HTTPStatus  int    `json:"http_status"`
+	Description string `json:"description"`
+}
+
+// catalog 全部错误码，按分组排列，生成的目录保持该顺序
+var catalog = []Entry{
+	{ErrCodeInternal, http.StatusInternalServerError, "服务器内部错误，message不含细节，可稍后重试"},
+	{ErrCodeInvalidArgument, http.StatusBadRequest, "参数无效"},
+	{ErrCodeInvalidRequest, http.StatusBadRequest, "请求体无法解析"},
+	{ErrCodeMethodNotAllowed, http.StatusMethodNotAllowed, "不支持的请求方法"},
+	{ErrCodeValidationFailed, http.StatusUnprocessableEntity, "输入校验未通过，errors字段按表单字段列出具体原因"},
+	{ErrCodeFeatureNotEnabled, http.StatusNotImplemented, "服务端未启用该功能"},
+	{ErrCodeRateLimited, http.StatusTooManyRequests, "请求过于频繁，请稍后再试"},
+
+	{ErrCodeUnauthenticated, http.StatusUnauthorized, "缺少认证信息或认证格式无效，需要登录"},
+	{ErrCodeInvalidCredentials, http.StatusUnauthorized, "用户名或密码错误"},
+	{ErrCodeUserDisabled, http.StatusForbidden, "用户已被禁用"},
+	{ErrCodeUserSuspended, http.StatusForbidden, "用户已被暂停使用"},
+	{ErrCodeAccountLocked, http.StatusLocked, "连续密码错误次数过多，账户已锁定"},
+	{ErrCodeLoginDenied, http.StatusForbidden, "登录存在异常，已被拒绝"},
+	{ErrCodeChallengeRequired, http.StatusUnauthorized, "需要完成人机验证或邮箱验证码后重新登录"},
+	{ErrCodeCaptchaInvalid, http.StatusBadRequest, "人机验证未通过"},
+	{ErrCodeMFARequired, http.StatusForbidden, "该操作需要完成多因素认证"},
+	{ErrCodeEmailUnverified, http.StatusForbidden, "邮箱未验证"},
+	{ErrCodeTermsAcceptanceRequired, http.StatusForbidden, "需要同意最新的服务条款，required_version字段为要求的版本"},
+	{ErrCodeTokenInvalid, http.StatusUnauthorized, "Token无效，需要重新登录"},
+	{ErrCodeTokenExpired, http.StatusUnauthorized, "Token已过期，可刷新Token或重新登录"},
+	{ErrCodeTokenRevoked, http.StatusUnauthorized, "Token已失效（如修改密码后），需要重新登录"},
+	{ErrCodeSessionExpired, http.StatusUnauthorized, "会话已超过最长有效期，需要重新登录"},
+	{ErrCodeTokenQuotaExceeded, http.StatusTooManyRequests, "Token签发次数超过上限，请稍后再试"},
+	{ErrCodeCSRFFailed, http.StatusForbidden, "缺少CSRF Token或CSRF Token不匹配"},
+
+	{ErrCodePermissionDenied, http.StatusForbidden, "权限不足"},
+	{ErrCodeConfirmationRequired, http.StatusForbidden, "该操作需要确认，需先获取操作确认Token"},
+	{ErrCodeInvalidConfirmation, http.StatusForbidden, "操作确认Token无效、已过期或已使用"},
+	{ErrCodeSeatLimitReached, http.StatusForbidden, "租户用户数已达上限"},
+	{ErrCodeSessionLimitReached, http.StatusForbidden, "租户活跃会话数已达上限"},
+
+	{ErrCodeDuplicateUsername, http.StatusConflict, "用户名已存在"},
+	{ErrCodeDuplicateEmail, http.StatusConflict, "邮箱已存在"},
+	{ErrCodeInvalidInvitationCode, http.StatusBadRequest, "邀请码无效"},
+	{ErrCodeIncorrectPassword, http.StatusBadRequest, "原密码错误"},
+	{ErrCodePolicyViolation, http.StatusUnprocessableEntity, "密码不符合策略要求（长度、字符类型等）"},
+	{ErrCodePasswordTooWeak, http.StatusUnprocessableEntity, "密码强度不足"},
+	{ErrCodePasswordTooSimilar, http.StatusUnprocessableEntity, "密码与用户名、邮箱等个人信息过于相似"},
+	{ErrCodePasswordReused, http.StatusUnprocessableEntity, "密码与历史密码重复"},
+
+	{ErrCodeInvalidVerificationCode, http.StatusBadRequest, "验证码错误、不存在或已使用"},
+	{ErrCodeVerificationCodeExpired, http.StatusBadRequest, "验证码已过期"},
+	{ErrCodeVerificationAttemptsExceeded, http.StatusTooManyRequests, "验证码错误次数过多，需重新获取"},
+	{ErrCodeInvalidResetCode, http.StatusBadRequest, "重置码无效或已使用"},
+	{ErrCodeResetCodeExpired, http.StatusBadRequest, "重置码已过期"},
+
+	{ErrCodeUserNotFound, http.StatusNotFound, "用户不存在"},
+	{ErrCodeRoleNotFound, http.StatusNotFound, "角色不存在"},
+	{ErrCodePermissionNotFound, http.StatusNotFound, "权限不存在"},
+	{ErrCodeDeviceNotFound, http.StatusNotFound, "设备不存在"},
+}
+
+// statuses 错误码到HTTP状态码的索引
+var statuses = func() map[string]int {
+	statuses := make(map[string]int, len(catalog))
+	for _, entry := range catalog {
+		statuses[entry.Code] = entry.HTTPStatus
+	}
+	return statuses
+}()
+
+// HTTPStatusOf 获取错误码对应的HTTP状态码，未登记的错误码按500处理
+func HTTPStatusOf(code string) int {
+	if status, ok := statuses[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// Known 检查错误码是否已登记
+func Known(code string) bool {
+	_, ok := statuses[code]
+	return ok
+}
+
+// Catalog 获取全部错误码条目的副本
+func Catalog() []Entry {
+	return append([]Entry(nil), catalog...)
+}
+
+// CatalogJSON 生成JSON格式的错误码目录
+func CatalogJSON() ([]byte, error) {
+	data, err := json.MarshalIndent(catalog, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// CatalogMarkdown 生成Markdown格式的错误码目录
+func CatalogMarkdown() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("# 错误码目录\n\n")
+	buf.WriteString("<!-- 由 go generate ./errorcodes 生成，请勿手动修改 -->\n\n")
+	buf.WriteString("HTTP错误响应体为 `{\"code\": \"...\", \"message\": \"...\"}`，客户端应按code处理，message仅用于展示。\n\n")
+	buf.WriteString("| code | HTTP状态码 | 说明 |\n")
+	buf.WriteString("| --- | --- | --- |\n")
+	for _, entry := range catalog {
+		fmt.Fprintf(&buf, "| `%s` | %d | %s |\n", entry.Code, entry.HTTPStatus, entry.Description)
+	}
+	return buf.Bytes()
+}
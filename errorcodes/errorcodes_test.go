@@ -0,0 +1,41 @@
+package errorcodes
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPStatusOf(t *testing.T) {
+	assert.Equal(t, http.StatusUnauthorized, HTTPStatusOf(ErrCodeInvalidCredentials))
+	assert.Equal(t, http.StatusUnprocessableEntity, HTTPStatusOf(ErrCodeValidationFailed))
+	assert.Equal(t, http.StatusConflict, HTTPStatusOf(ErrCodeDuplicateUsername))
+	assert.Equal(t, http.StatusInternalServerError, HTTPStatusOf("no_such_code"))
+	assert.False(t, Known("no_such_code"))
+}
+
+func TestCatalog(t *testing.T) {
+	t.Run("错误码唯一且均有说明", func(t *testing.T) {
+		seen := make(map[string]bool)
+		for _, entry := range Catalog() {
+			assert.False(t, seen[entry.Code], "重复的错误码: %s", entry.Code)
+			seen[entry.Code] = true
+			assert.NotEmpty(t, entry.Description, entry.Code)
+			assert.NotZero(t, entry.HTTPStatus, entry.Code)
+		}
+	})
+
+	t.Run("生成的目录与代码一致", func(t *testing.T) {
+		want, err := CatalogJSON()
+		assert.NoError(t, err)
+		got, err := os.ReadFile("catalog.json")
+		assert.NoError(t, err)
+		assert.Equal(t, string(want), string(got), "请执行 go generate ./errorcodes")
+
+		got, err = os.ReadFile("catalog.md")
+		assert.NoError(t, err)
+		assert.Equal(t, string(CatalogMarkdown()), string(got), "请执行 go generate ./errorcodes")
+	})
+}
@@ -0,0 +1,22 @@
+// 生成错误码目录catalog.json和catalog.md，由errorcodes包的go:generate调用，在errorcodes目录中执行
+package main
+
+import (
+	"log"
+	"os"
+
+	"aigo_service_auth/errorcodes"
+)
+
+func main() {
+	data, err := errorcodes.CatalogJSON()
+	if err != nil {
+		log.Fatalf("生成JSON目录失败: %v", err)
+	}
+	if err := os.WriteFile("catalog.json", data, 0o644); err != nil {
+		log.Fatalf("写入catalog.json失败: %v", err)
+	}
+	if err := os.WriteFile("catalog.md", errorcodes.CatalogMarkdown(), 0o644); err != nil {
+		log.Fatalf("写入catalog.md失败: %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"time"
 
+	"aigo_service_auth/migrations"
 	"gorm.io/gorm"
 )
 
@@ -33,44 +34,14 @@ func Example(db *gorm.DB) {
 	roleService.CreateRole(userRole)
 
 	// 创建权限
-	permissions := []*Permission{
-		{
-			Name:        "user.create",
-			DisplayName: "创建用户",
-			Resource:    "user",
-			Action:      "create",
-			Description: "创建新用户的权限",
-		},
-		{
-			Name:        "user.read",
-			DisplayName: "查看用户",
-			Resource:    "user",
-			Action:      "read",
-			Description: "查看用户信息的权限",
-		},
-		{
-			Name:        "user.update",
-			DisplayName: "更新用户",
-			Resource:    "user",
-			Action:      "update",
-			Description: "更新用户信息的权限",
-		},
-		{
-			Name:        "user.delete",
-			DisplayName: "删除用户",
-			Resource:    "user",
-			Action:      "delete",
-			Description: "删除用户的权限",
-		},
-	}
-
+	permissions := DefaultPermissions()
 	for _, permission := range permissions {
 		roleService.CreatePermission(permission)
 	}
 
 	// 3. 为角色分配权限
 	// 管理员拥有所有权限
-	for i := uint(1); i <= 4; i++ {
+	for i := uint(1); i <= uint(len(permissions)); i++ {
 		roleService.AssignPermissionToRole(adminRole.ID, i)
 	}
 
@@ -114,14 +85,7 @@ func Example(db *gorm.DB) {
 	fmt.Printf("用户是否是管理员: %v\n", hasRole)
 }
 
-// InitDatabase 初始化数据库表
+// InitDatabase 初始化数据库表，按版本顺序执行未执行的迁移
 func InitDatabase(db *gorm.DB) error {
-	// 自动迁移所有表
-	return db.AutoMigrate(
-		&User{},
-		&Role{},
-		&Permission{},
-		&UserRole{},
-		&RolePermission{},
-	)
+	return migrations.Migrate(db)
 }
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"aigo_service_auth/errorcodes"
+)
+
+// UserDataExportFormatVersion 用户数据导出包的格式版本，字段有不兼容变化时递增
+const UserDataExportFormatVersion = 1
+
+// redactedValue 导出包中代替密码哈希等机密字段的值，只表明字段存在
+const redactedValue = "[REDACTED]"
+
+// LinkedIdentity 用户关联的外部身份，如第三方登录账号
+type LinkedIdentity struct {
+	Provider string    `json:"provider"`
+	Subject  string    `json:"subject"`
+	Email    string    `json:"email,omitempty"`
+	LinkedAt time.Time `json:"linked_at"`
+}
+
+// LinkedIdentitySource 关联身份查询接口，由接入第三方登录的系统实现
+type LinkedIdentitySource interface {
+	LinkedIdentities(userID uint) ([]LinkedIdentity, error)
+}
+
+// UserDataExportConfig 用户数据导出的数据来源，为nil的来源在导出包中输出为空列表
+type UserDataExportConfig struct {
+	RoleService     RoleService          // 角色和权限
+	Devices         KnownDeviceStorage   // 已知设备及登录记录
+	Sessions        JWTService           // 已签发Token的元数据
+	PasswordManager PasswordManager      // 密码修改历史，只导出时间
+	Identities      LinkedIdentitySource // 关联的外部身份
+	AuditEvents     AuditEventSource     // 与用户相关的审计事件
+	AuditLogger     AuditLogger          // 记录导出操作本身
+	Clock           Clock                // 导出时间来源，为nil时使用系统时间
+}
+
+// UserDataExporter 用户数据导出器，汇总各存储中与用户相关的全部数据，用于响应数据主体访问请求
+type UserDataExporter struct {
+	userService UserService
+	config      *UserDataExportConfig
+}
+
+// NewUserDataExporter 创建用户数据导出器
+func NewUserDataExporter(us UserService, config *UserDataExportConfig) *UserDataExporter {
+	if config == nil {
+		config = &UserDataExportConfig{}
+	}
+	if config.AuditLogger == nil {
+		config.AuditLogger = noopAuditLogger{}
+	}
+	config.Clock = clockOrDefault(config.Clock)
+
+	return &UserDataExporter{userService: us, config: config}
+}
+
+// ExportedProfile 导出包中的用户资料，机密字段只标记是否存在
+type ExportedProfile struct {
+	UserDetail
+	InvitationCode       string     `json:"invitation_code,omitempty"`
+	InvitedBy            uint       `json:"invited_by,omitempty"`
+	SuspensionReason     string     `json:"suspension_reason,omitempty"`
+	PasswordChangedAt    *time.Time `json:"password_changed_at,omitempty"`
+	AcceptedTermsVersion string     `json:"accepted_terms_version,omitempty"`
+	AcceptedTermsAt      *time.Time `json:"accepted_terms_at,omitempty"`
+	TenantID             uint       `json:"tenant_id,omitempty"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+	PasswordHash         string     `json:"password_hash,omitempty"`
+	PhoneHash            string     `json:"phone_hash,omitempty"`
+	TokenSalt            string     `json:"token_salt,omitempty"`
+}
+
+// ExportedRole 导出包中的角色及其权限
+type ExportedRole struct {
+	Name        string               `json:"name"`
+	DisplayName string               `json:"display_name"`
+	Permissions []ExportedPermission `json:"permissions"`
+}
+
+// ExportedPermission 导出包中的权限
+type ExportedPermission struct {
+	Name     string `json:"name"`
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+}
+
+// ExportedLoginActivity 导出包中的登录状态
+type ExportedLoginActivity struct {
+	LastLoginAt         *time.Time `json:"last_login_at,omitempty"`
+	FailedLoginAttempts int        `json:"failed_login_attempts"`
+	LastFailedLoginAt   *time.Time `json:"last_failed_login_at,omitempty"`
+	LockedUntil         *time.Time `json:"locked_until,omitempty"`
+}
+
+// ExportedPasswordChange 导出包中的密码修改记录，只包含时间
+type ExportedPasswordChange struct {
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// exportedProfile 构造导出的用户资料
+func exportedProfile(user *User) ExportedProfile {
+	profile := ExportedProfile{
+		UserDetail:           user.WithPII(),
+		InvitationCode:       user.InvitationCode,
+		InvitedBy:            user.InvitedBy,
+		SuspensionReason:     user.SuspensionReason,
+		PasswordChangedAt:    user.PasswordChangedAt,
+		AcceptedTermsVersion: user.AcceptedTermsVersion,
+		AcceptedTermsAt:      user.AcceptedTermsAt,
+		TenantID:             user.TenantID,
+		UpdatedAt:            user.UpdatedAt,
+	}
+	if user.PasswordHash != "" {
+		profile.PasswordHash = redactedValue
+	}
+	if user.PhoneHash != "" {
+		profile.PhoneHash = redactedValue
+	}
+	if user.TokenSalt != "" {
+		profile.TokenSalt = redactedValue
+	}
+	return profile
+}
+
+// ExportUserData 将用户的全部数据以JSON写入w
+//
+// 导出包依次包含profile、roles、login_attempts、devices、sessions、password_history、
+// linked_identities和audit_events，逐段查询和写入，不在内存中汇总全部数据。
+// 用户不存在时返回ErrUserNotFound且不写入任何内容；开始写入后出错时w中的内容不完整，调用方应丢弃。
+// 导出不包含密码哈希、Token和设备指纹；完成后记录user.data_exported审计事件，
+// ctx中有当前用户时记录为操作人。
+func (e *UserDataExporter) ExportUserData(ctx context.Context, userID uint, w io.Writer) error {
+	user, err := e.userService.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	bundle := newJSONObjectWriter(w)
+	sections := []struct {
+		name  string
+		write func() error
+	}{
+		{"format_version", func() error { return bundle.value(UserDataExportFormatVersion) }},
+		{"exported_at", func() error { return bundle.value(e.config.Clock.Now()) }},
+		{"user_id", func() error { return bundle.value(user.ID) }},
+		{"profile", func() error { return bundle.value(exportedProfile(user)) }},
+		{"roles", func() error { return e.writeRoles(bundle, user.ID) }},
+		{"login_attempts", func() error {
+			return bundle.value(ExportedLoginActivity{
+				LastLoginAt:         user.LastLoginAt,
+				FailedLoginAttempts: user.FailedLoginAttempts,
+				LastFailedLoginAt:   user.LastFailedLoginAt,
+				LockedUntil:         user.LockedUntil,
+			})
+		}},
+		{"devices", func() error { return e.writeDevices(bundle, user.ID) }},
+		{"sessions", func() error { return e.writeSessions(bundle, user.ID) }},
+		{"password_history", func() error { return e.writePasswordHistory(bundle, user.ID) }},
+		{"linked_identities", func() error { return e.writeLinkedIdentities(bundle, user.ID) }},
+		{"audit_events", func() error { return e.writeAuditEvents(bundle, user.ID) }},
+	}
+	for _, section := range sections {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := bundle.key(section.name); err != nil {
+			return err
+		}
+		if err := section.write(); err != nil {
+			return fmt.Errorf("导出%s失败: %w", section.name, err)
+		}
+	}
+	if err := bundle.close(); err != nil {
+		return err
+	}
+
+	detail := "user_id=" + strconv.FormatUint(uint64(user.ID), 10)
+	if actor, ok := GetUserFromContext(ctx); ok {
+		detail += " actor=" + strconv.FormatUint(uint64(actor.ID), 10)
+	}
+	return e.config.AuditLogger.Log(AuditEvent{
+		Type:      AuditEventUserDataExported,
+		UserID:    user.ID,
+		Detail:    detail,
+		CreatedAt: e.config.Clock.Now(),
+	})
+}
+
+// writeRoles 写入用户的角色及权限
+func (e *UserDataExporter) writeRoles(bundle *jsonObjectWriter, userID uint) error {
+	list := bundle.array()
+	if e.config.RoleService == nil {
+		return list.close()
+	}
+
+	roles, err := e.config.RoleService.GetUserRoles(userID)
+	if err != nil {
+		return err
+	}
+	roleIDs := make([]uint, 0, len(roles))
+	for _, role := range roles {
+		roleIDs = append(roleIDs, role.ID)
+	}
+	rolePermissions, err := e.config.RoleService.GetPermissionsForRoles(roleIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, role := range roles {
+		exported := ExportedRole{
+			Name:        role.Name,
+			DisplayName: role.DisplayName,
+			Permissions: make([]ExportedPermission, 0, len(rolePermissions[role.ID])),
+		}
+		for _, permission := range rolePermissions[role.ID] {
+			exported.Permissions = append(exported.Permissions, ExportedPermission{
+				Name:     permission.Name,
+				Resource: permission.Resource,
+				Action:   permission.Action,
+			})
+		}
+		if err := list.item(exported); err != nil {
+			return err
+		}
+	}
+	return list.close()
+}
+
+// writeDevices 写入用户的已知设备，设备指纹不导出
+func (e *UserDataExporter) writeDevices(bundle *jsonObjectWriter, userID uint) error {
+	list := bundle.array()
+	if e.config.Devices != nil {
+		devices, err := e.config.Devices.List(userID)
+		if err != nil {
+			return err
+		}
+		for _, device := range devices {
+			if err := list.item(device); err != nil {
+				return err
+			}
+		}
+	}
+	return list.close()
+}
+
+// writeSessions 写入用户Token的JTI和时间
+func (e *UserDataExporter) writeSessions(bundle *jsonObjectWriter, userID uint) error {
+	list := bundle.array()
+	if e.config.Sessions != nil {
+		for _, session := range e.config.Sessions.ListUserSessions(userID) {
+			if err := list.item(session); err != nil {
+				return err
+			}
+		}
+	}
+	return list.close()
+}
+
+// writePasswordHistory 写入密码修改时间，不导出历史密码哈希
+func (e *UserDataExporter) writePasswordHistory(bundle *jsonObjectWriter, userID uint) error {
+	list := bundle.array()
+	if e.config.PasswordManager != nil {
+		history, err := e.config.PasswordManager.GetPasswordHistory(userID, 0)
+		if err != nil {
+			return err
+		}
+		for _, entry := range history {
+			if err := list.item(ExportedPasswordChange{ChangedAt: entry.CreatedAt}); err != nil {
+				return err
+			}
+		}
+	}
+	return list.close()
+}
+
+// writeLinkedIdentities 写入用户关联的外部身份
+func (e *UserDataExporter) writeLinkedIdentities(bundle *jsonObjectWriter, userID uint) error {
+	list := bundle.array()
+	if e.config.Identities != nil {
+		identities, err := e.config.Identities.LinkedIdentities(userID)
+		if err != nil {
+			return err
+		}
+		for _, identity := range identities {
+			if err := list.item(identity); err != nil {
+				return err
+			}
+		}
+	}
+	return list.close()
+}
+
+// writeAuditEvents 写入与用户相关的审计事件
+func (e *UserDataExporter) writeAuditEvents(bundle *jsonObjectWriter, userID uint) error {
+	list := bundle.array()
+	if e.config.AuditEvents != nil {
+		events, err := e.config.AuditEvents.EventsForUser(userID)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			if err := list.item(event); err != nil {
+				return err
+			}
+		}
+	}
+	return list.close()
+}
+
+// jsonObjectWriter 逐个字段写入JSON对象，字段值写完即输出，不缓存整个对象
+type jsonObjectWriter struct {
+	w       io.Writer
+	encoder *json.Encoder
+	fields  int
+}
+
+// newJSONObjectWriter 创建JSON对象写入器
+func newJSONObjectWriter(w io.Writer) *jsonObjectWriter {
+	return &jsonObjectWriter{w: w, encoder: json.NewEncoder(w)}
+}
+
+// key 写入字段名，首个字段前写入对象起始符
+func (o *jsonObjectWriter) key(name string) error {
+	prefix := ","
+	if o.fields == 0 {
+		prefix = "{"
+	}
+	o.fields++
+	_, err := fmt.Fprintf(o.w, "%s%q:", prefix, name)
+	return err
+}
+
+// value 写入字段值
+func (o *jsonObjectWriter) value(v any) error {
+	return o.encoder.Encode(v)
+}
+
+// array 开始写入数组类型的字段值
+func (o *jsonObjectWriter) array() *jsonArrayWriter {
+	return &jsonArrayWriter{object: o}
+}
+
+// close 写入对象结束符
+func (o *jsonObjectWriter) close() error {
+	if o.fields == 0 {
+		_, err := io.WriteString(o.w, "{}\n")
+		return err
+	}
+	_, err := io.WriteString(o.w, "}\n")
+	return err
+}
+
+// jsonArrayWriter 逐个元素写入JSON数组
+type jsonArrayWriter struct {
+	object *jsonObjectWriter
+	items  int
+}
+
+// item 写入数组元素
+func (a *jsonArrayWriter) item(v any) error {
+	prefix := ","
+	if a.items == 0 {
+		prefix = "["
+	}
+	a.items++
+	if _, err := io.WriteString(a.object.w, prefix); err != nil {
+		return err
+	}
+	return a.object.encoder.Encode(v)
+}
+
+// close 写入数组结束符
+func (a *jsonArrayWriter) close() error {
+	if a.items == 0 {
+		_, err := io.WriteString(a.object.w, "[]")
+		return err
+	}
+	_, err := io.WriteString(a.object.w, "]")
+	return err
+}
+
+// UserDataExportHandler 用户数据导出处理器，挂载为GET /admin/users/export?user_id=...
+//
+// 需要认证且拥有user.export权限，响应为附件形式的JSON导出包。
+func (m *AuthMiddleware) UserDataExportHandler(exporter *UserDataExporter, roleService RoleService) http.Handler {
+	return m.RequirePermission(PermissionResourceUser, PermissionActionExport, roleService)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeErrorCode(w, errorcodes.ErrCodeMethodNotAllowed, "不支持的请求方法")
+			return
+		}
+		userID, err := strconv.ParseUint(r.URL.Query().Get("user_id"), 10, 0)
+		if err != nil || userID == 0 {
+			writeErrorCode(w, errorcodes.ErrCodeInvalidArgument, "无效的用户ID")
+			return
+		}
+
+		// 先确认用户存在，开始写入响应后无法再返回错误状态码
+		if _, err := exporter.userService.GetUserByID(uint(userID)); err != nil {
+			WriteError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="user-%d-export.json"`, userID))
+		if err := exporter.ExportUserData(r.Context(), uint(userID), w); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("导出用户数据失败: user_id=%d: %v", userID, err)
+		}
+	}))
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubIdentitySource 测试用关联身份来源
+type stubIdentitySource struct {
+	identities []LinkedIdentity
+}
+
+func (s *stubIdentitySource) LinkedIdentities(userID uint) ([]LinkedIdentity, error) {
+	return s.identities, nil
+}
+
+// decodeExport 解析导出包，返回各段的原始JSON
+func decodeExport(t *testing.T, data []byte) map[string]json.RawMessage {
+	var bundle map[string]json.RawMessage
+	assert.NoError(t, json.Unmarshal(data, &bundle), string(data))
+	return bundle
+}
+
+func TestExportUserData(t *testing.T) {
+	clock := NewFakeClock(time.Time{})
+	now := clock.Now()
+
+	user := &User{
+		Username:          "alice",
+		Email:             "alice@example.com",
+		PasswordHash:      "$2a$10$secretpasswordhashvalue",
+		PhoneHash:         "phonehashvalue",
+		TokenSalt:         "tokensaltvalue",
+		Status:            1,
+		PasswordChangedAt: &now,
+	}
+	user.ID = 7
+
+	editor := &Role{Name: "editor", DisplayName: "编辑"}
+	editor.ID = 1
+	read := &Permission{Name: "article.read", Resource: "article", Action: "read"}
+	read.ID = 10
+
+	devices := NewMemoryKnownDeviceStorage()
+	_, err := devices.Record(&KnownDevice{UserID: 7, Fingerprint: "devicefingerprintvalue", UserAgent: "Firefox", LastIP: "192.0.2.1", FirstSeenAt: now, LastSeenAt: now})
+	assert.NoError(t, err)
+
+	jwtConfig := DefaultJWTConfig()
+	jwtConfig.Clock = clock
+	jwtService := NewJWTService(jwtConfig)
+	token, claims, err := jwtService.GenerateTokenDetailed(7)
+	assert.NoError(t, err)
+
+	pm := NewPasswordManager(DefaultPasswordManagerConfig())
+	assert.NoError(t, pm.AddToHistory(7, "$2a$10$oldpasswordhashvalue"))
+
+	auditLogger := NewMemoryAuditLogger()
+	auditLogger.Log(AuditEvent{Type: AuditEventPasswordChanged, UserID: 7, CreatedAt: now})
+	auditLogger.Log(AuditEvent{Type: AuditEventPasswordChanged, UserID: 8, CreatedAt: now})
+
+	newExporter := func() *UserDataExporter {
+		return NewUserDataExporter(&stubUserLookup{user: user}, &UserDataExportConfig{
+			RoleService:     &stubRoleService{roles: []*Role{editor}, permissions: map[uint][]*Permission{1: {read}}},
+			Devices:         devices,
+			Sessions:        jwtService,
+			PasswordManager: pm,
+			Identities:      &stubIdentitySource{identities: []LinkedIdentity{{Provider: "github", Subject: "12345", LinkedAt: now}}},
+			AuditEvents:     auditLogger,
+			AuditLogger:     auditLogger,
+			Clock:           clock,
+		})
+	}
+
+	t.Run("导出包结构", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, newExporter().ExportUserData(context.Background(), 7, &buf))
+
+		bundle := decodeExport(t, buf.Bytes())
+		for _, section := range []string{"format_version", "exported_at", "user_id", "profile", "roles", "login_attempts",
+			"devices", "sessions", "password_history", "linked_identities", "audit_events"} {
+			assert.Contains(t, bundle, section)
+		}
+
+		var profile map[string]any
+		assert.NoError(t, json.Unmarshal(bundle["profile"], &profile))
+		assert.Equal(t, "alice@example.com", profile["email"])
+		assert.Equal(t, redactedValue, profile["password_hash"])
+		assert.Equal(t, redactedValue, profile["token_salt"])
+
+		var roles []ExportedRole
+		assert.NoError(t, json.Unmarshal(bundle["roles"], &roles))
+		assert.Equal(t, []ExportedRole{{Name: "editor", DisplayName: "编辑", Permissions: []ExportedPermission{{Name: "article.read", Resource: "article", Action: "read"}}}}, roles)
+
+		var sessions []SessionMetadata
+		assert.NoError(t, json.Unmarshal(bundle["sessions"], &sessions))
+		if assert.Len(t, sessions, 1) {
+			assert.Equal(t, claims.JTI, sessions[0].JTI)
+			assert.NotNil(t, sessions[0].ExpiresAt)
+		}
+
+		var history []map[string]any
+		assert.NoError(t, json.Unmarshal(bundle["password_history"], &history))
+		if assert.Len(t, history, 1) {
+			assert.Equal(t, []string{"changed_at"}, mapKeys(history[0]))
+		}
+
+		var devicesSection, identities, events []map[string]any
+		assert.NoError(t, json.Unmarshal(bundle["devices"], &devicesSection))
+		assert.Len(t, devicesSection, 1)
+		assert.NoError(t, json.Unmarshal(bundle["linked_identities"], &identities))
+		assert.Len(t, identities, 1)
+		assert.NoError(t, json.Unmarshal(bundle["audit_events"], &events))
+		assert.Len(t, events, 1, "只导出该用户的审计事件")
+	})
+
+	t.Run("不包含机密数据", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, newExporter().ExportUserData(context.Background(), 7, &buf))
+
+		for _, secret := range []string{user.PasswordHash, "$2a$10$oldpasswordhashvalue", user.PhoneHash, user.TokenSalt, token, "devicefingerprintvalue"} {
+			assert.NotContains(t, buf.String(), secret)
+		}
+	})
+
+	t.Run("记录导出审计事件", func(t *testing.T) {
+		logger := NewMemoryAuditLogger()
+		exporter := NewUserDataExporter(&stubUserLookup{user: user}, &UserDataExportConfig{AuditLogger: logger, Clock: clock})
+		admin := &User{Username: "admin"}
+		admin.ID = 1
+		ctx := context.WithValue(context.Background(), UserContextKey, admin)
+
+		var buf bytes.Buffer
+		assert.NoError(t, exporter.ExportUserData(ctx, 7, &buf))
+		events := logger.Events()
+		if assert.Len(t, events, 1) {
+			assert.Equal(t, AuditEventUserDataExported, events[0].Type)
+			assert.Equal(t, uint(7), events[0].UserID)
+			assert.Equal(t, "user_id=7 actor=1", events[0].Detail)
+		}
+
+		// 未配置的来源输出为空列表
+		bundle := decodeExport(t, buf.Bytes())
+		assert.JSONEq(t, "[]", string(bundle["roles"]))
+		assert.JSONEq(t, "[]", string(bundle["sessions"]))
+	})
+
+	t.Run("用户不存在时不写入内容", func(t *testing.T) {
+		exporter := NewUserDataExporter(&stubUserLookup{err: ErrUserNotFound}, nil)
+		var buf bytes.Buffer
+		err := exporter.ExportUserData(context.Background(), 99, &buf)
+		assert.True(t, errors.Is(err, ErrUserNotFound))
+		assert.Zero(t, buf.Len())
+	})
+}
+
+// mapKeys 获取map的全部键
+func mapKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestUserDataExportHandler(t *testing.T) {
+	admin := &User{Username: "admin"}
+	admin.ID = 1
+	user := &User{Username: "alice", Email: "alice@example.com", PasswordHash: "$2a$10$secretpasswordhashvalue"}
+	user.ID = 7
+
+	serve := func(handler http.Handler, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer valid-token")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+	middleware := NewAuthMiddleware(&stubAuthService{user: admin})
+
+	t.Run("需要导出权限", func(t *testing.T) {
+		auditLogger := NewMemoryAuditLogger()
+		exporter := NewUserDataExporter(&stubUserLookup{user: user}, &UserDataExportConfig{AuditLogger: auditLogger})
+		recorder := serve(middleware.UserDataExportHandler(exporter, &checkRoleService{allowed: false}), "/admin/users/export?user_id=7")
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+		assert.Empty(t, auditLogger.Events())
+	})
+
+	t.Run("导出为附件", func(t *testing.T) {
+		auditLogger := NewMemoryAuditLogger()
+		exporter := NewUserDataExporter(&stubUserLookup{user: user}, &UserDataExportConfig{AuditLogger: auditLogger})
+		recorder := serve(middleware.UserDataExportHandler(exporter, &checkRoleService{allowed: true}), "/admin/users/export?user_id=7")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "no-store", recorder.Header().Get("Cache-Control"))
+		assert.Contains(t, recorder.Header().Get("Content-Disposition"), "user-7-export.json")
+		assert.NotContains(t, recorder.Body.String(), user.PasswordHash)
+		assert.Contains(t, decodeExport(t, recorder.Body.Bytes()), "profile")
+
+		events := auditLogger.Events()
+		if assert.Len(t, events, 1) {
+			assert.Equal(t, "user_id=7 actor=1", events[0].Detail)
+		}
+	})
+
+	t.Run("无效的用户ID", func(t *testing.T) {
+		exporter := NewUserDataExporter(&stubUserLookup{err: ErrUserNotFound}, nil)
+		handler := middleware.UserDataExportHandler(exporter, &checkRoleService{allowed: true})
+		assert.Equal(t, http.StatusBadRequest, serve(handler, "/admin/users/export?user_id=abc").Code)
+		assert.Equal(t, http.StatusNotFound, serve(handler, "/admin/users/export?user_id=99").Code)
+	})
+}
+
+func TestExportUserDataWithDB(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	// 清理数据
+	testDB.ClearAllData()
+
+	user := testDB.CreateTestUser("exportuser", "export@example.com", "Password123!")
+	role := testDB.CreateTestRole("auditor", "审计员", "测试角色")
+	permission := testDB.CreateTestPermission("report.read", "查看报表", "report", "read")
+	roleService := NewRoleService(testDB.DB)
+	assert.NoError(t, roleService.AssignRoleToUser(user.ID, role.ID))
+	assert.NoError(t, roleService.AssignPermissionToRole(role.ID, permission.ID))
+
+	devices := NewGormKnownDeviceStorage(testDB.DB)
+	now := time.Now()
+	_, err := devices.Record(&KnownDevice{UserID: user.ID, Fingerprint: "dbdevicefingerprint", UserAgent: "Safari", LastIP: "198.51.100.7", FirstSeenAt: now, LastSeenAt: now})
+	assert.NoError(t, err)
+
+	exporter := NewUserDataExporter(NewUserService(testDB.DB), &UserDataExportConfig{
+		RoleService: roleService,
+		Devices:     devices,
+	})
+	var buf bytes.Buffer
+	assert.NoError(t, exporter.ExportUserData(context.Background(), user.ID, &buf))
+
+	bundle := decodeExport(t, buf.Bytes())
+	var roles []ExportedRole
+	assert.NoError(t, json.Unmarshal(bundle["roles"], &roles))
+	if assert.Len(t, roles, 1) {
+		assert.Equal(t, "auditor", roles[0].Name)
+		assert.Len(t, roles[0].Permissions, 1)
+	}
+	var exportedDevices []map[string]any
+	assert.NoError(t, json.Unmarshal(bundle["devices"], &exportedDevices))
+	assert.Len(t, exportedDevices, 1)
+
+	stored, err := NewUserService(testDB.DB).GetUserByID(user.ID)
+	assert.NoError(t, err)
+	assert.NotContains(t, buf.String(), stored.PasswordHash)
+	assert.NotContains(t, buf.String(), "dbdevicefingerprint")
+}
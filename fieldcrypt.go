@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// 字段加密错误定义
+var (
+	ErrFieldKeyNotFound       = errors.New("字段加密密钥不存在")
+	ErrFieldCiphertextInvalid = errors.New("字段密文无效")
+	ErrFieldEncryptorMissing  = errors.New("未配置字段加密密钥，无法解密")
+)
+
+// 密文格式：enc:<密钥ID>:<base64(nonce+密文)>
+const fieldCiphertextPrefix = "enc:"
+
+// FieldEncryptionConfig 字段加密配置
+type FieldEncryptionConfig struct {
+	ActiveKeyID string            // 加密新数据使用的密钥ID
+	Keys        map[string][]byte // 密钥ID -> AES密钥（16/24/32字节），轮换后旧密钥需保留用于解密
+	IndexKey    []byte            // 计算查询索引的HMAC密钥，更换后需重建索引列
+}
+
+// FieldEncryptor 字段加密器，使用AES-GCM加密，并以HMAC-SHA256生成可用于等值查询的确定性索引
+type FieldEncryptor struct {
+	activeKeyID string
+	ciphers     map[string]cipher.AEAD
+	indexKey    []byte
+}
+
+// NewFieldEncryptor 创建字段加密器
+func NewFieldEncryptor(config *FieldEncryptionConfig) (*FieldEncryptor, error) {
+	if config == nil || config.ActiveKeyID == "" {
+		return nil, errors.New("未指定加密密钥ID")
+	}
+	if len(config.IndexKey) < 16 {
+		return nil, errors.New("索引密钥长度至少为16字节")
+	}
+
+	ciphers := make(map[string]cipher.AEAD, len(config.Keys))
+	for keyID, key := range config.Keys {
+		if keyID == "" || strings.Contains(keyID, ":") {
+			return nil, fmt.Errorf("无效的密钥ID: %q", keyID)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("密钥%s无效: %w", keyID, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		ciphers[keyID] = aead
+	}
+	if _, exists := ciphers[config.ActiveKeyID]; !exists {
+		return nil, fmt.Errorf("%w: %s", ErrFieldKeyNotFound, config.ActiveKeyID)
+	}
+
+	return &FieldEncryptor{
+		activeKeyID: config.ActiveKeyID,
+		ciphers:     ciphers,
+		indexKey:    append([]byte(nil), config.IndexKey...),
+	}, nil
+}
+
+// Encrypt 使用当前密钥加密，空字符串不加密
+func (e *FieldEncryptor) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	aead := e.ciphers[e.activeKeyID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return fieldCiphertextPrefix + e.activeKeyID + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt 按密文中的密钥ID解密，未加密的值原样返回以兼容迁移前的数据
+func (e *FieldEncryptor) Decrypt(value string) (string, error) {
+	if !IsEncryptedField(value) {
+		return value, nil
+	}
+
+	keyID, encoded, ok := strings.Cut(strings.TrimPrefix(value, fieldCiphertextPrefix), ":")
+	if !ok {
+		return "", ErrFieldCiphertextInvalid
+	}
+	aead, exists := e.ciphers[keyID]
+	if !exists {
+		return "", fmt.Errorf("%w: %s", ErrFieldKeyNotFound, keyID)
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrFieldCiphertextInvalid
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", ErrFieldCiphertextInvalid
+	}
+	return string(plaintext), nil
+}
+
+// BlindIndex 计算用于等值查询的确定性索引，空字符串返回空字符串
+func (e *FieldEncryptor) BlindIndex(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, e.indexKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// IsEncryptedField 判断字段值是否为密文
+func IsEncryptedField(value string) bool {
+	return strings.HasPrefix(value, fieldCiphertextPrefix)
+}
+
+// fieldEncryptor 全局字段加密器，为nil时按明文读写
+var fieldEncryptor atomic.Pointer[FieldEncryptor]
+
+// SetFieldEncryptor 设置全局字段加密器，传入nil时关闭加密（已加密的数据将无法读取）
+func SetFieldEncryptor(encryptor *FieldEncryptor) {
+	fieldEncryptor.Store(encryptor)
+}
+
+// GetFieldEncryptor 获取全局字段加密器，未配置时返回nil
+func GetFieldEncryptor() *FieldEncryptor {
+	return fieldEncryptor.Load()
+}
+
+func init() {
+	schema.RegisterSerializer("encrypted", EncryptedSerializer{})
+}
+
+// EncryptedSerializer GORM序列化器，字段标签 serializer:encrypted 的字符串字段写入时加密、读取时解密
+//
+// 只对通过模型写入的值生效，Where条件和map更新中的值不会加密。
+type EncryptedSerializer struct{}
+
+// Scan 读取时解密
+func (EncryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var value string
+	switch v := dbValue.(type) {
+	case nil:
+	case []byte:
+		value = string(v)
+	case string:
+		value = v
+	default:
+		return fmt.Errorf("字段%s的类型不支持加密: %T", field.Name, dbValue)
+	}
+
+	if IsEncryptedField(value) {
+		encryptor := GetFieldEncryptor()
+		if encryptor == nil {
+			return ErrFieldEncryptorMissing
+		}
+		plaintext, err := encryptor.Decrypt(value)
+		if err != nil {
+			return err
+		}
+		value = plaintext
+	}
+
+	field.ReflectValueOf(ctx, dst).SetString(value)
+	return nil
+}
+
+// Value 写入时加密，未配置加密器时写入明文
+func (EncryptedSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	value, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("字段%s的类型不支持加密: %T", field.Name, fieldValue)
+	}
+
+	encryptor := GetFieldEncryptor()
+	if encryptor == nil {
+		return value, nil
+	}
+	return encryptor.Encrypt(value)
+}
+
+// EncryptExistingPhones 分批加密已有用户的明文手机号并填充查询索引，返回处理的行数
+//
+// 需先调用SetFieldEncryptor配置加密器。可重复执行，已加密的行会被跳过。
+func EncryptExistingPhones(db *gorm.DB, batchSize int) (int, error) {
+	encryptor := GetFieldEncryptor()
+	if encryptor == nil {
+		return 0, ErrFieldEncryptorMissing
+	}
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	type phoneRow struct {
+		ID    uint
+		Phone string
+	}
+
+	// 绕过模型直接读写原始列，避免序列化器重复处理
+	table := User{}.TableName()
+	encrypted := 0
+	var lastID uint
+	for {
+		var rows []phoneRow
+		if err := db.Table(table).Select("id, phone").
+			Where("id > ? AND phone <> ''", lastID).
+			Order("id").Limit(batchSize).
+			Find(&rows).Error; err != nil {
+			return encrypted, err
+		}
+		if len(rows) == 0 {
+			return encrypted, nil
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, row := range rows {
+				if IsEncryptedField(row.Phone) {
+					continue
+				}
+				ciphertext, err := encryptor.Encrypt(row.Phone)
+				if err != nil {
+					return err
+				}
+				if err := tx.Table(table).Where("id = ? AND phone = ?", row.ID, row.Phone).UpdateColumns(map[string]interface{}{
+					"phone":      ciphertext,
+					"phone_hash": encryptor.BlindIndex(row.Phone),
+				}).Error; err != nil {
+					return err
+				}
+				encrypted++
+			}
+			return nil
+		})
+		if err != nil {
+			return encrypted, err
+		}
+
+		lastID = rows[len(rows)-1].ID
+	}
+}
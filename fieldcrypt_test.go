@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestFieldEncryptor 创建测试用字段加密器
+func newTestFieldEncryptor(t *testing.T, activeKeyID string) *FieldEncryptor {
+	encryptor, err := NewFieldEncryptor(&FieldEncryptionConfig{
+		ActiveKeyID: activeKeyID,
+		Keys: map[string][]byte{
+			"k1": bytes.Repeat([]byte{1}, 32),
+			"k2": bytes.Repeat([]byte{2}, 32),
+		},
+		IndexKey: bytes.Repeat([]byte{9}, 32),
+	})
+	assert.NoError(t, err)
+	return encryptor
+}
+
+func TestFieldEncryptor(t *testing.T) {
+	t.Run("加密解密往返", func(t *testing.T) {
+		encryptor := newTestFieldEncryptor(t, "k1")
+
+		ciphertext, err := encryptor.Encrypt("+8613800001234")
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(ciphertext, "enc:k1:"))
+		assert.NotContains(t, ciphertext, "13800001234")
+
+		plaintext, err := encryptor.Decrypt(ciphertext)
+		assert.NoError(t, err)
+		assert.Equal(t, "+8613800001234", plaintext)
+
+		// 每次加密使用随机nonce
+		again, _ := encryptor.Encrypt("+8613800001234")
+		assert.NotEqual(t, ciphertext, again)
+
+		// 空值和未加密的值原样返回
+		empty, err := encryptor.Encrypt("")
+		assert.NoError(t, err)
+		assert.Empty(t, empty)
+		plaintext, err = encryptor.Decrypt("13800001234")
+		assert.NoError(t, err)
+		assert.Equal(t, "13800001234", plaintext)
+	})
+
+	t.Run("密钥轮换后仍可解密旧数据", func(t *testing.T) {
+		old, err := newTestFieldEncryptor(t, "k1").Encrypt("13800001234")
+		assert.NoError(t, err)
+
+		rotated := newTestFieldEncryptor(t, "k2")
+		plaintext, err := rotated.Decrypt(old)
+		assert.NoError(t, err)
+		assert.Equal(t, "13800001234", plaintext)
+
+		fresh, _ := rotated.Encrypt("13800001234")
+		assert.True(t, strings.HasPrefix(fresh, "enc:k2:"))
+	})
+
+	t.Run("篡改或未知密钥的密文", func(t *testing.T) {
+		encryptor := newTestFieldEncryptor(t, "k1")
+		ciphertext, _ := encryptor.Encrypt("13800001234")
+
+		tampered := ciphertext[:len(ciphertext)-2] + "AA"
+		_, err := encryptor.Decrypt(tampered)
+		assert.True(t, errors.Is(err, ErrFieldCiphertextInvalid))
+
+		_, err = encryptor.Decrypt(strings.Replace(ciphertext, "enc:k1:", "enc:k9:", 1))
+		assert.True(t, errors.Is(err, ErrFieldKeyNotFound))
+
+		_, err = encryptor.Decrypt("enc:garbage")
+		assert.True(t, errors.Is(err, ErrFieldCiphertextInvalid))
+	})
+
+	t.Run("查询索引确定且依赖密钥", func(t *testing.T) {
+		encryptor := newTestFieldEncryptor(t, "k1")
+		assert.Equal(t, encryptor.BlindIndex("13800001234"), encryptor.BlindIndex(" 13800001234 "))
+		assert.NotEqual(t, encryptor.BlindIndex("13800001234"), encryptor.BlindIndex("13800001235"))
+		assert.Len(t, encryptor.BlindIndex("13800001234"), 64)
+		assert.Empty(t, encryptor.BlindIndex(""))
+
+		// 轮换加密密钥不影响索引
+		assert.Equal(t, encryptor.BlindIndex("13800001234"), newTestFieldEncryptor(t, "k2").BlindIndex("13800001234"))
+	})
+
+	t.Run("无效配置", func(t *testing.T) {
+		_, err := NewFieldEncryptor(&FieldEncryptionConfig{
+			ActiveKeyID: "missing",
+			Keys:        map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)},
+			IndexKey:    bytes.Repeat([]byte{9}, 32),
+		})
+		assert.True(t, errors.Is(err, ErrFieldKeyNotFound))
+
+		_, err = NewFieldEncryptor(&FieldEncryptionConfig{
+			ActiveKeyID: "k1",
+			Keys:        map[string][]byte{"k1": []byte("short")},
+			IndexKey:    bytes.Repeat([]byte{9}, 32),
+		})
+		assert.Error(t, err)
+
+		_, err = NewFieldEncryptor(&FieldEncryptionConfig{
+			ActiveKeyID: "k1",
+			Keys:        map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)},
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestEncryptedPhone(t *testing.T) {
+	// 设置测试数据库
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+	defer SetFieldEncryptor(nil)
+
+	userService := NewUserService(testDB.DB)
+
+	rawPhone := func(id uint) (phone, phoneHash string) {
+		row := struct {
+			Phone     string
+			PhoneHash string
+		}{}
+		testDB.DB.Table("sys_users").Select("phone, phone_hash").Where("id = ?", id).Scan(&row)
+		return row.Phone, row.PhoneHash
+	}
+
+	t.Run("未配置密钥时明文存储", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+		SetFieldEncryptor(nil)
+
+		user := &User{Username: "plain", Email: "plain@example.com", PasswordHash: "password", Phone: "13800001234", Status: 1}
+		assert.NoError(t, userService.CreateUser(user))
+
+		phone, phoneHash := rawPhone(user.ID)
+		assert.Equal(t, "13800001234", phone)
+		assert.Empty(t, phoneHash)
+
+		found, err := userService.GetUserByPhone("13800001234")
+		assert.NoError(t, err)
+		assert.Equal(t, user.ID, found.ID)
+	})
+
+	t.Run("配置密钥后加密存储并可按手机号查询", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+		encryptor := newTestFieldEncryptor(t, "k1")
+		SetFieldEncryptor(encryptor)
+
+		user := &User{Username: "secret", Email: "secret@example.com", PasswordHash: "password", Phone: "13800001234", Status: 1}
+		assert.NoError(t, userService.CreateUser(user))
+		assert.Equal(t, "13800001234", user.Phone)
+
+		phone, phoneHash := rawPhone(user.ID)
+		assert.True(t, IsEncryptedField(phone))
+		assert.NotContains(t, phone, "13800001234")
+		assert.Equal(t, encryptor.BlindIndex("13800001234"), phoneHash)
+
+		found, err := userService.GetUserByPhone("13800001234")
+		assert.NoError(t, err)
+		assert.Equal(t, user.ID, found.ID)
+		assert.Equal(t, "13800001234", found.Phone)
+
+		// 更新手机号后索引同步更新
+		found.Phone = "13900005678"
+		assert.NoError(t, userService.UpdateUser(found))
+		_, err = userService.GetUserByPhone("13800001234")
+		assert.True(t, errors.Is(err, ErrUserNotFound))
+		found, err = userService.GetUserByPhone("13900005678")
+		assert.NoError(t, err)
+		assert.Equal(t, "13900005678", found.Phone)
+
+		_, err = userService.GetUserByPhone("")
+		assert.True(t, errors.Is(err, ErrUserNotFound))
+	})
+
+	t.Run("分批加密已有数据", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+		SetFieldEncryptor(nil)
+
+		var ids []uint
+		for i := 0; i < 5; i++ {
+			user := &User{
+				Username:     fmt.Sprintf("user%d", i),
+				Email:        fmt.Sprintf("user%d@example.com", i),
+				PasswordHash: "password",
+				Phone:        fmt.Sprintf("1380000000%d", i),
+				Status:       1,
+			}
+			assert.NoError(t, userService.CreateUser(user))
+			ids = append(ids, user.ID)
+		}
+		testDB.CreateTestUser("nophone", "nophone@example.com", "password")
+
+		_, err := EncryptExistingPhones(testDB.DB, 2)
+		assert.True(t, errors.Is(err, ErrFieldEncryptorMissing))
+
+		SetFieldEncryptor(newTestFieldEncryptor(t, "k1"))
+		count, err := EncryptExistingPhones(testDB.DB, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, 5, count)
+
+		for _, id := range ids {
+			phone, phoneHash := rawPhone(id)
+			assert.True(t, IsEncryptedField(phone))
+			assert.NotEmpty(t, phoneHash)
+		}
+
+		// 重复执行时跳过已加密的行
+		count, err = EncryptExistingPhones(testDB.DB, 2)
+		assert.NoError(t, err)
+		assert.Zero(t, count)
+
+		found, err := userService.GetUserByPhone("13800000003")
+		assert.NoError(t, err)
+		assert.Equal(t, ids[3], found.ID)
+		assert.Equal(t, "13800000003", found.Phone)
+	})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGinMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	user := &User{Username: "testuser"}
+	user.ID = 1
+
+	// newEngine 创建在受保护路由中返回当前用户名的Gin引擎
+	newEngine := func(middleware *AuthMiddleware, roleService RoleService) *gin.Engine {
+		engine := gin.New()
+		handler := func(c *gin.Context) {
+			current, ok := GetUserFromGinContext(c)
+			if !ok {
+				c.Status(http.StatusInternalServerError)
+				return
+			}
+			// 请求的context.Context中同样可以取到用户
+			if fromContext, ok := GetUserFromContext(c.Request.Context()); !ok || fromContext != current {
+				c.Status(http.StatusInternalServerError)
+				return
+			}
+			c.String(http.StatusOK, current.Username)
+		}
+		engine.GET("/auth", middleware.RequireAuthGin(), handler)
+		engine.GET("/permission", middleware.RequirePermissionGin("users", "read", roleService), handler)
+		engine.GET("/role", middleware.RequireRoleGin("admin", roleService), handler)
+		return engine
+	}
+
+	serve := func(engine *gin.Engine, path, authHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if authHeader != "" {
+			req.Header.Set("Authorization", authHeader)
+		}
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	t.Run("认证通过后保存用户", func(t *testing.T) {
+		engine := newEngine(NewAuthMiddleware(&stubAuthService{user: user}), &checkRoleService{allowed: true})
+		for _, path := range []string{"/auth", "/permission", "/role"} {
+			recorder := serve(engine, path, "Bearer valid-token")
+			assert.Equal(t, http.StatusOK, recorder.Code, path)
+			assert.Equal(t, "testuser", recorder.Body.String(), path)
+		}
+	})
+
+	t.Run("未认证返回401 JSON错误", func(t *testing.T) {
+		engine := newEngine(NewAuthMiddleware(&stubAuthService{user: user}), &checkRoleService{allowed: true})
+
+		recorder := serve(engine, "/auth", "")
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		assert.Contains(t, recorder.Header().Get("Content-Type"), "application/json")
+		assert.Contains(t, recorder.Body.String(), `"code":"unauthenticated"`)
+
+		for _, path := range []string{"/auth", "/permission", "/role"} {
+			recorder = serve(engine, path, "Bearer invalid-token")
+			assert.Equal(t, http.StatusUnauthorized, recorder.Code, path)
+			assert.NotContains(t, recorder.Body.String(), "testuser", path)
+		}
+
+		recorder = serve(engine, "/auth", "Basic dXNlcjpwYXNz")
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+
+	t.Run("权限不足返回403，检查出错返回500", func(t *testing.T) {
+		middleware := NewAuthMiddleware(&stubAuthService{user: user})
+
+		denied := newEngine(middleware, &checkRoleService{allowed: false})
+		for _, path := range []string{"/permission", "/role"} {
+			recorder := serve(denied, path, "Bearer valid-token")
+			assert.Equal(t, http.StatusForbidden, recorder.Code, path)
+			assert.Contains(t, recorder.Body.String(), `"code":"permission_denied"`, path)
+		}
+
+		failed := newEngine(middleware, &checkRoleService{err: errors.New("数据库不可用")})
+		for _, path := range []string{"/permission", "/role"} {
+			assert.Equal(t, http.StatusInternalServerError, serve(failed, path, "Bearer valid-token").Code, path)
+		}
+
+		missing := newEngine(middleware, nil)
+		assert.Equal(t, http.StatusInternalServerError, serve(missing, "/role", "Bearer valid-token").Code)
+	})
+
+	t.Run("使用自定义的响应钩子", func(t *testing.T) {
+		middleware := NewAuthMiddleware(&stubAuthService{user: user})
+		middleware.OnUnauthorized = func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/login", http.StatusFound)
+		}
+		middleware.OnForbidden = func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		engine := newEngine(middleware, &checkRoleService{allowed: false})
+
+		recorder := serve(engine, "/auth", "")
+		assert.Equal(t, http.StatusFound, recorder.Code)
+		assert.Equal(t, "/login", recorder.Header().Get("Location"))
+		assert.Equal(t, http.StatusNotFound, serve(engine, "/role", "Bearer valid-token").Code)
+	})
+
+	t.Run("未经过认证中间件时取不到用户", func(t *testing.T) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		_, ok := GetUserFromGinContext(c)
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 热点路径测试数据规模
+const (
+	hotPathUsers              = 10000
+	hotPathRoles              = 50
+	hotPathResources          = 50
+	hotPathActions            = 10 // 每个资源的操作数，共hotPathResources*hotPathActions个权限
+	hotPathPermissionsPerRole = 40
+	hotPathMaxRolesPerUser    = 3
+	hotPathTokens             = 1000 // 预先签发Token的用户数
+)
+
+// hotPathFixture 热点路径测试数据
+type hotPathFixture struct {
+	userIDs      []uint
+	permissions  []*Permission
+	tokens       []string
+	tokenService TokenService
+}
+
+// hotPathOperation 热点操作及每次操作允许的SQL数量
+type hotPathOperation struct {
+	name   string
+	budget int64
+	// setup 基于db构建操作，返回的函数执行第i次操作
+	setup func(f *hotPathFixture, db *gorm.DB) func(i int) error
+}
+
+// hotPathOperations 需要约束查询次数的热点路径，修改预算前请确认新增查询是必要的
+var hotPathOperations = []hotPathOperation{
+	{
+		name:   "HasPermission",
+		budget: 1,
+		setup: func(f *hotPathFixture, db *gorm.DB) func(i int) error {
+			roleService := NewRoleService(db)
+			return func(i int) error {
+				permission := f.permissions[i%len(f.permissions)]
+				_, err := roleService.HasPermission(f.userID(i), permission.Resource, permission.Action)
+				return err
+			}
+		},
+	},
+	{
+		// 获取用户全部权限：先查角色，再批量查角色的权限
+		name:   "用户权限",
+		budget: 2,
+		setup: func(f *hotPathFixture, db *gorm.DB) func(i int) error {
+			roleService := NewRoleService(db)
+			return func(i int) error {
+				roles, err := roleService.GetUserRoles(f.userID(i))
+				if err != nil {
+					return err
+				}
+				roleIDs := make([]uint, len(roles))
+				for j, role := range roles {
+					roleIDs[j] = role.ID
+				}
+				_, err = roleService.GetPermissionsForRoles(roleIDs)
+				return err
+			}
+		},
+	},
+	{
+		name:   "ValidateToken",
+		budget: 1,
+		setup: func(f *hotPathFixture, db *gorm.DB) func(i int) error {
+			authService := NewAuthService(db, NewUserService(db), f.tokenService)
+			return func(i int) error {
+				_, err := authService.ValidateToken(f.tokens[i%len(f.tokens)])
+				return err
+			}
+		},
+	},
+	{
+		name:   "RequirePermission中间件",
+		budget: 2,
+		setup: func(f *hotPathFixture, db *gorm.DB) func(i int) error {
+			middleware := NewAuthMiddleware(NewAuthService(db, NewUserService(db), f.tokenService))
+			roleService := NewRoleService(db)
+			ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			// 每个权限一个处理器，请求在不同权限间轮换
+			handlers := make([]http.Handler, len(f.permissions))
+			for j, permission := range f.permissions {
+				handlers[j] = middleware.RequirePermission(permission.Resource, permission.Action, roleService)(ok)
+			}
+
+			return func(i int) error {
+				req := httptest.NewRequest(http.MethodGet, "/resource", nil)
+				req.Header.Set("Authorization", "Bearer "+f.tokens[i%len(f.tokens)])
+				recorder := httptest.NewRecorder()
+				handlers[i%len(handlers)].ServeHTTP(recorder, req)
+
+				// 是否有权限取决于随机分配的角色，两种结果都正常
+				if recorder.Code != http.StatusOK && recorder.Code != http.StatusForbidden {
+					return fmt.Errorf("意外的状态码 %d: %s", recorder.Code, recorder.Body.String())
+				}
+				return nil
+			}
+		},
+	},
+}
+
+// userID 返回第i次操作使用的用户，与Token顺序错开以覆盖不同用户
+func (f *hotPathFixture) userID(i int) uint {
+	return f.userIDs[(i*7919)%len(f.userIDs)]
+}
+
+// seedHotPathDataset 以固定随机种子写入用户、角色、权限及其关联
+func seedHotPathDataset(tb testing.TB, db *gorm.DB) *hotPathFixture {
+	tb.Helper()
+	rng := rand.New(rand.NewSource(42))
+
+	// 哈希只计算一次，热点路径不校验密码
+	passwordHash, err := encodeArgon2Hash("password123", DefaultPasswordConfig)
+	if err != nil {
+		tb.Fatalf("哈希密码失败: %v", err)
+	}
+
+	users := make([]*User, hotPathUsers)
+	for i := range users {
+		users[i] = &User{
+			Username:     fmt.Sprintf("hotuser%05d", i),
+			Email:        fmt.Sprintf("hotuser%05d@example.com", i),
+			PasswordHash: passwordHash,
+			Status:       1,
+		}
+	}
+	if err := db.CreateInBatches(users, 1000).Error; err != nil {
+		tb.Fatalf("写入用户失败: %v", err)
+	}
+
+	roles := make([]*Role, hotPathRoles)
+	for i := range roles {
+		roles[i] = &Role{Name: fmt.Sprintf("hotrole%02d", i), DisplayName: fmt.Sprintf("角色%02d", i), Status: 1}
+	}
+	if err := db.Create(roles).Error; err != nil {
+		tb.Fatalf("写入角色失败: %v", err)
+	}
+
+	permissions := make([]*Permission, 0, hotPathResources*hotPathActions)
+	for r := 0; r < hotPathResources; r++ {
+		for a := 0; a < hotPathActions; a++ {
+			resource, action := fmt.Sprintf("res%02d", r), fmt.Sprintf("act%d", a)
+			permissions = append(permissions, &Permission{
+				Name:        resource + "." + action,
+				DisplayName: resource + "." + action,
+				Resource:    resource,
+				Action:      action,
+			})
+		}
+	}
+	if err := db.CreateInBatches(permissions, 500).Error; err != nil {
+		tb.Fatalf("写入权限失败: %v", err)
+	}
+
+	rolePermissions := make([]*RolePermission, 0, hotPathRoles*hotPathPermissionsPerRole)
+	for _, role := range roles {
+		for _, j := range rng.Perm(len(permissions))[:hotPathPermissionsPerRole] {
+			rolePermissions = append(rolePermissions, &RolePermission{RoleID: role.ID, PermissionID: permissions[j].ID})
+		}
+	}
+	if err := db.CreateInBatches(rolePermissions, 1000).Error; err != nil {
+		tb.Fatalf("写入角色权限失败: %v", err)
+	}
+
+	userRoles := make([]*UserRole, 0, hotPathUsers*2)
+	for _, user := range users {
+		for _, j := range rng.Perm(len(roles))[:1+rng.Intn(hotPathMaxRolesPerUser)] {
+			userRoles = append(userRoles, &UserRole{UserID: user.ID, RoleID: roles[j].ID})
+		}
+	}
+	if err := db.CreateInBatches(userRoles, 1000).Error; err != nil {
+		tb.Fatalf("写入用户角色失败: %v", err)
+	}
+
+	fixture := &hotPathFixture{
+		userIDs:      make([]uint, len(users)),
+		permissions:  permissions,
+		tokenService: NewTokenService("hot-path-secret", time.Hour),
+	}
+	for i, user := range users {
+		fixture.userIDs[i] = user.ID
+	}
+	for _, user := range users[:hotPathTokens] {
+		token, err := fixture.tokenService.GenerateToken(user.ID)
+		if err != nil {
+			tb.Fatalf("生成Token失败: %v", err)
+		}
+		fixture.tokens = append(fixture.tokens, token)
+	}
+	return fixture
+}
+
+// TestHotPathQueryBudget 并发执行热点路径，任何一次操作的SQL数量超过预算即失败
+func TestHotPathQueryBudget(t *testing.T) {
+	if testing.Short() {
+		t.Skip("short模式下跳过热点路径查询预算测试")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	// 清理数据
+	testDB.ClearAllData()
+	fixture := seedHotPathDataset(t, testDB.DB)
+
+	const workers, iterations = 8, 50
+	for _, op := range hotPathOperations {
+		t.Run(op.name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+
+					// 每个goroutine独立计数，互不干扰
+					counter := NewQueryCounter()
+					run := op.setup(fixture, counter.Wrap(testDB.DB))
+					for i := w * iterations; i < (w+1)*iterations; i++ {
+						var opErr error
+						if err := counter.CheckBudget(op.budget, func() { opErr = run(i) }); err != nil {
+							t.Errorf("第%d次操作: %v", i, err)
+							return
+						}
+						if opErr != nil {
+							t.Errorf("第%d次操作失败: %v", i, opErr)
+							return
+						}
+					}
+				}(w)
+			}
+			wg.Wait()
+		})
+	}
+}
+
+// BenchmarkHotPaths 在真实规模的数据上并发执行热点路径，同时报告每次操作的SQL数量
+func BenchmarkHotPaths(b *testing.B) {
+	testDB := SetupTestDB(b)
+	defer testDB.TeardownTestDB()
+
+	// 清理数据
+	testDB.ClearAllData()
+	fixture := seedHotPathDataset(b, testDB.DB)
+
+	for _, op := range hotPathOperations {
+		b.Run(op.name, func(b *testing.B) {
+			counter := NewQueryCounter()
+			run := op.setup(fixture, counter.Wrap(testDB.DB))
+
+			var next atomic.Int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := run(int(next.Add(1) - 1)); err != nil {
+						b.Errorf("操作失败: %v", err)
+						return
+					}
+				}
+			})
+			b.StopTimer()
+
+			b.ReportMetric(float64(counter.Count())/float64(b.N), "queries/op")
+		})
+	}
+}
@@ -14,7 +14,8 @@ func TestLoginRegisterIntegration(t *testing.T) {
 
 	// 创建服务实例
 	userService := NewUserService(testDB.DB)
-	tokenService := NewTokenService("test-secret-key", time.Hour)
+	clock := NewFakeClock(time.Time{})
+	tokenService := NewTokenServiceWithClock("test-secret-key", time.Hour, clock)
 	authService := NewAuthService(testDB.DB, userService, tokenService)
 	registerService := NewRegisterService(userService, tokenService)
 	loginService := NewLoginService(testDB.DB, userService, tokenService, authService)
@@ -59,8 +60,8 @@ func TestLoginRegisterIntegration(t *testing.T) {
 		assert.NoError(t, err)
 		assert.False(t, emailAvailable)
 
-		// 5. 等待1秒确保时间戳不同
-		time.Sleep(time.Second)
+		// 5. 推进1秒确保时间戳不同
+		clock.Advance(time.Second)
 
 		// 6. 使用注册的用户名和密码登录
 		loginUser, loginToken, err := loginService.Login(username, password)
@@ -80,7 +81,7 @@ func TestLoginRegisterIntegration(t *testing.T) {
 		assert.Equal(t, loginUser.ID, validatedUser.ID)
 
 		// 9. 刷新Token
-		time.Sleep(time.Second) // 确保时间戳不同
+		clock.Advance(time.Second) // 确保时间戳不同
 		newToken, err := loginService.RefreshToken(loginToken)
 		assert.NoError(t, err)
 		assert.NotEmpty(t, newToken)
@@ -103,7 +104,7 @@ func TestLoginRegisterIntegration(t *testing.T) {
 		// 1. 尝试使用无效邀请码注册
 		_, _, err := registerService.Register(username, email, password, invalidInvitationCode)
 		assert.Error(t, err)
-		assert.Equal(t, "邀请码无效", err.Error())
+		assertValidationCode(t, err, FieldInvitationCode, ValidationCodeInvalid)
 
 		// 2. 验证注册失败后无法登录
 		_, _, err = loginService.Login(username, password)
@@ -128,12 +129,12 @@ func TestLoginRegisterIntegration(t *testing.T) {
 		// 2. 尝试重复注册相同用户名
 		_, _, err = registerService.Register(username, "different@example.com", password, "")
 		assert.Error(t, err)
-		assert.Equal(t, "用户名已存在", err.Error())
+		assertValidationCode(t, err, FieldUsername, ValidationCodeTaken)
 
 		// 3. 尝试重复注册相同邮箱
 		_, _, err = registerService.Register("differentuser", email, password, "")
 		assert.Error(t, err)
-		assert.Equal(t, "邮箱已存在", err.Error())
+		assertValidationCode(t, err, FieldEmail, ValidationCodeTaken)
 
 		// 4. 验证原用户仍可正常登录
 		loginUser, loginToken, err := loginService.Login(username, password)
@@ -3,10 +3,13 @@ package main
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -16,12 +19,28 @@ import (
 type JWTService interface {
 	// 生成Token
 	GenerateToken(userID uint) (string, error)
+	// 生成Token并返回签入的Claims，避免调用方再次解析
+	GenerateTokenDetailed(userID uint) (string, *JWTClaims, error)
 	// 生成带自定义过期时间的Token
 	GenerateTokenWithExpiration(userID uint, expiration time.Duration) (string, error)
+	// 为指定渠道（如web、mobile）生成Token
+	GenerateTokenForChannel(userID uint, channel string) (string, error)
+	// 生成记录登录认证方式的Token，完成多因素认证时amr应包含AMRMFA
+	GenerateTokenWithAMR(userID uint, channel string, amr []string) (string, error)
+	// 生成携带自定义声明（如租户ID、角色名）的Token，自定义声明不能使用保留的声明名
+	GenerateTokenWithClaims(userID uint, extra map[string]interface{}, expiration time.Duration) (string, error)
 	// 验证Token
 	ValidateToken(tokenString string) (uint, error)
+	// 验证Token并返回剩余有效时间，只解析一次
+	ValidateTokenFull(tokenString string) (userID uint, remaining time.Duration, err error)
+	// 验证Token并判断是否属于指定用户
+	TokenBelongsToUser(tokenString string, userID uint) (bool, error)
 	// 解析Token获取Claims
 	ParseToken(tokenString string) (*JWTClaims, error)
+	// 验证Token并返回登录认证方式，供RequireMFA使用
+	ParseAMR(tokenString string) ([]string, error)
+	// 解析Token，接受过期不超过ExpiredTokenGracePeriod的Token并返回是否已过期，用于续期刚过期的Token
+	ParseTokenAllowExpired(tokenString string) (*JWTClaims, bool, error)
 	// 撤销Token
 	RevokeToken(tokenString string) error
 	// 检查Token是否被撤销
@@ -36,15 +55,146 @@ type JWTService interface {
 	GenerateJTI() string
 	// 批量撤销用户的所有Token
 	RevokeAllUserTokens(userID uint) error
+	// 撤销用户在指定渠道的所有Token
+	RevokeUserTokensForChannel(userID uint, channel string) error
+	// 按JTI批量撤销本实例签发的Token，返回撤销数量和未找到的JTI
+	RevokeByJTIs(jtis []string) (*JTIRevocationResult, error)
+	// 按JTI撤销Token，包括其他实例签发的Token
+	RevokeByJTI(jti string) error
+	// 获取本实例为用户签发且仍在跟踪的Token元数据，不包含Token本身
+	ListUserSessions(userID uint) []SessionMetadata
+	// 轮换用户的Token盐值，立即使该用户的所有Token失效，需配置JWTConfig.TokenSalts
+	RotateTokenSalt(userID uint) error
+	// 使用户在cutoff之前签发的所有Token失效，userID为0时对所有用户生效
+	RevokeTokensIssuedBefore(userID uint, cutoff time.Time) error
+	// 在duration内临时解除用户的Token签发配额，duration<=0时立即恢复
+	LiftTokenQuota(userID uint, duration time.Duration) error
+	// 获取用户当前窗口内的Token签发情况
+	TokenQuotaUsage(userID uint) (TokenQuotaUsage, error)
+	// 获取服务运行状态
+	Stats() JWTStats
 }
 
+// ErrSessionLifetimeExceeded 会话自首次登录起已超过最长有效期，刷新无法延长，需要重新登录
+var ErrSessionLifetimeExceeded = errors.New("会话已超过最长有效期，请重新登录")
+
+// ErrTokenIssuedBeforeWatermark Token签发时间早于撤销水位线
+var ErrTokenIssuedBeforeWatermark = errors.New("Token已失效，请重新登录")
+
+// ErrReservedClaim 自定义声明使用了保留的声明名
+var ErrReservedClaim = errors.New("自定义声明不能使用保留的声明名")
+
+// JWTStats JWT服务运行状态
+type JWTStats struct {
+	RevokedTokens    int `json:"revoked_tokens"`     // 当前撤销记录数，使用共享撤销存储时为0
+	MaxRevokedTokens int `json:"max_revoked_tokens"` // 撤销记录容量上限，使用共享撤销存储时为0
+	TrackedTokens    int `json:"tracked_tokens"`     // 已签发且仍在跟踪的Token数
+	// 以下计数只在配置了签发配额或异常阈值时统计，为本实例自启动以来的累计值
+	TokensIssued      int64 `json:"tokens_issued"`      // 计入配额的签发次数
+	QuotaRejections   int64 `json:"quota_rejections"`   // 因超过配额被拒绝的次数
+	IssuanceAnomalies int64 `json:"issuance_anomalies"` // 越过异常阈值的次数
+}
+
+// JTIRevocationResult 按JTI批量撤销的结果
+type JTIRevocationResult struct {
+	Revoked  int      `json:"revoked"`   // 撤销的Token数量
+	NotFound []string `json:"not_found"` // 未找到的JTI：不存在、已撤销或由其他实例签发
+}
+
+// SessionMetadata 已签发Token的元数据，用于展示和导出会话，不包含可用于认证的Token
+type SessionMetadata struct {
+	JTI       string     `json:"jti"`
+	Channel   string     `json:"channel,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"` // 会话首次签发时间
+	IssuedAt  *time.Time `json:"issued_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Token签发渠道
+const (
+	ChannelWeb    = "web"
+	ChannelMobile = "mobile"
+)
+
 // JWTClaims JWT声明
 type JWTClaims struct {
-	UserID uint   `json:"user_id"`
-	JTI    string `json:"jti"` // JWT ID，用于唯一标识Token
+	UserID  uint   `json:"user_id"`
+	JTI     string `json:"jti"`               // JWT ID，用于唯一标识Token
+	Channel string `json:"channel,omitempty"` // 签发渠道，如web、mobile
+	// 会话首次签发时间，刷新时原样保留，用于限制会话的最长有效期
+	OriginalIssuedAt *jwt.NumericDate `json:"orig_iat,omitempty"`
+	// 登录时使用的认证方式（RFC 8176），刷新时原样保留；未携带表示未完成多因素认证
+	AMR []string `json:"amr,omitempty"`
+	// 自定义声明，与其他声明平铺在同一层，刷新时原样保留；解析后数字为float64
+	Extra map[string]interface{} `json:"-"`
 	jwt.RegisteredClaims
 }
 
+// reservedJWTClaims JWTClaims自身使用的声明名，自定义声明不能覆盖
+var reservedJWTClaims = map[string]bool{
+	"user_id": true, "jti": true, "channel": true, "orig_iat": true, "amr": true,
+	"iss": true, "sub": true, "aud": true, "exp": true, "nbf": true, "iat": true,
+}
+
+// checkExtraClaims 检查自定义声明是否使用了保留的声明名
+func checkExtraClaims(extra map[string]interface{}) error {
+	for key := range extra {
+		if reservedJWTClaims[key] {
+			return fmt.Errorf("%w: %s", ErrReservedClaim, key)
+		}
+	}
+	return nil
+}
+
+// jwtClaimsJSON 不带自定义编解码的JWTClaims，用于编解码固定声明
+type jwtClaimsJSON JWTClaims
+
+// MarshalJSON 将Extra中的自定义声明与固定声明平铺编码
+func (c JWTClaims) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(jwtClaimsJSON(c))
+	if err != nil || len(c.Extra) == 0 {
+		return data, err
+	}
+	if err := checkExtraClaims(c.Extra); err != nil {
+		return nil, err
+	}
+
+	merged := make(map[string]interface{}, len(c.Extra)+8)
+	for key, value := range c.Extra {
+		merged[key] = value
+	}
+	var fixed map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fixed); err != nil {
+		return nil, err
+	}
+	for key, value := range fixed {
+		merged[key] = value
+	}
+	return json.Marshal(merged)
+}
+
+// UnmarshalJSON 解码固定声明，其余声明放入Extra
+func (c *JWTClaims) UnmarshalJSON(data []byte) error {
+	var claims jwtClaimsJSON
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return err
+	}
+	var all map[string]interface{}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+	for key := range all {
+		if reservedJWTClaims[key] {
+			delete(all, key)
+		}
+	}
+	if len(all) > 0 {
+		claims.Extra = all
+	}
+	*c = JWTClaims(claims)
+	return nil
+}
+
 // JWTConfig JWT配置
 type JWTConfig struct {
 	SecretKey         string
@@ -53,6 +203,35 @@ type JWTConfig struct {
 	Issuer            string
 	AllowRefresh      bool
 	MaxRefreshCount   int
+	SigningMethod     string // HMAC签名算法：HS256/HS384/HS512，默认HS256
+	MaxRevokedTokens  int    // 内存中最多保留的撤销记录数，写满且没有过期记录可清除时撤销返回ErrRevocationStoreFull；配置RevocationStore时不使用
+	MaxTokenLength    int    // 解析和撤销接受的Token最大长度，超过时在解析前拒绝；0表示DefaultMaxTokenLength
+	// 会话自首次签发起的最长有效期，无论刷新多少次，超过后都需要重新登录；0表示不限制
+	MaxSessionLifetime time.Duration
+	// Token签发时间水位线存储，为nil时使用内存存储；多实例部署时应使用共享存储
+	WatermarkStorage TokenWatermarkStorage
+	// Token撤销记录存储，为nil时使用容量为MaxRevokedTokens的内存存储；多实例部署时应使用共享存储
+	RevocationStore TokenRevocationStore
+	// 轮换前使用的密钥，只用于验证，新Token始终使用SecretKey签名；旧Token全部过期后即可移除
+	PreviousSecretKeys [][]byte
+	// 用户盐值存储，配置后每个用户的Token使用 HMAC(SecretKey, 用户盐值) 派生的密钥签名，
+	// 轮换盐值即可使该用户的全部Token失效；为nil时所有Token直接使用SecretKey签名。
+	// 两种方式签发的Token互不通用，开启或关闭时已签发的Token全部失效
+	TokenSalts TokenSaltStorage
+	// 盐值的本地缓存时间，0表示每次验证都读取存储；其他实例轮换后，本实例最多在该时间内仍接受旧Token
+	TokenSaltCacheTTL time.Duration
+	// 每个用户每小时最多开始的新会话数，刷新不计入；0表示不限制，超过时返回ErrTokenQuotaExceeded
+	MaxTokensIssuedPerUserPerHour int
+	// 用户每小时签发数越过该值时记录一次AuditEventTokenIssuanceAnomaly事件，0表示不告警
+	TokenIssueSoftThreshold int
+	// 签发计数和配额解除标记的存储，为nil时使用内存存储；多实例部署时应使用共享存储
+	RateLimitStore RateLimitStore
+	// 记录签发异常事件，为nil时不记录
+	AuditLogger AuditLogger
+	// 时间来源，用于签发、过期校验、刷新窗口和会话有效期，为nil时使用系统时间；测试中可使用FakeClock
+	Clock Clock
+	// ParseTokenAllowExpired接受的过期宽限期，0表示不接受已过期的Token；ParseToken和ValidateToken不受影响
+	ExpiredTokenGracePeriod time.Duration
 }
 
 // DefaultJWTConfig 默认JWT配置
@@ -64,6 +243,23 @@ func DefaultJWTConfig() *JWTConfig {
 		Issuer:            "aigo_service_auth",
 		AllowRefresh:      true,
 		MaxRefreshCount:   5,
+		SigningMethod:     jwt.SigningMethodHS256.Alg(),
+		MaxRevokedTokens:  defaultMaxRevokedTokens,
+		MaxTokenLength:    DefaultMaxTokenLength,
+	}
+}
+
+// resolveSigningMethod 根据配置解析HMAC签名算法，未配置时使用HS256，不支持的算法返回配置错误
+func resolveSigningMethod(name string) (*jwt.SigningMethodHMAC, error) {
+	switch name {
+	case "", jwt.SigningMethodHS256.Alg():
+		return jwt.SigningMethodHS256, nil
+	case jwt.SigningMethodHS384.Alg():
+		return jwt.SigningMethodHS384, nil
+	case jwt.SigningMethodHS512.Alg():
+		return jwt.SigningMethodHS512, nil
+	default:
+		return nil, fmt.Errorf("%w: 不支持的签名算法%q", ErrInvalidConfiguration, name)
 	}
 }
 
@@ -71,11 +267,26 @@ func DefaultJWTConfig() *JWTConfig {
 type jwtService struct {
 	config        *JWTConfig
 	secretKey     []byte
-	revokedTokens map[string]time.Time // Token -> 撤销时间
-	userTokens    map[uint][]string    // 用户ID -> Token列表
-	tokenUsers    map[string]uint      // Token -> 用户ID
-	refreshCounts map[string]int       // Token -> 刷新次数
-	mutex         sync.RWMutex         // 读写锁保护并发访问
+	verifyKey     interface{} // 验证签名的密钥，配置了PreviousSecretKeys时为依次尝试的密钥集合
+	signingMethod *jwt.SigningMethodHMAC
+	configErr     error                 // 配置错误，非nil时签发和验证都返回该错误
+	revocations   TokenRevocationStore  // 已撤销的JTI
+	userTokens    map[uint][]string     // 用户ID -> Token列表
+	tokenUsers    map[string]uint       // Token -> 用户ID
+	tokenChannels map[string]string     // Token -> 签发渠道
+	jtiTokens     map[string]string     // JTI -> Token
+	refreshCounts map[string]int        // Token -> 刷新次数
+	watermarks    TokenWatermarkStorage // Token签发时间水位线
+	salts         TokenSaltStorage      // 用户盐值，为nil时不按用户派生签名密钥
+	quotaStore    RateLimitStore        // 签发计数和配额解除标记
+	auditLogger   AuditLogger           // 签发异常事件
+	clock         Clock                 // 时间来源
+	mutex         sync.RWMutex          // 读写锁保护用户Token关系和刷新计数
+	parseCount    atomic.Int64          // 签名验证解析次数，用于基准测试观察
+
+	tokensIssued      atomic.Int64 // 计入配额的签发次数
+	quotaRejections   atomic.Int64 // 因超过配额被拒绝的次数
+	issuanceAnomalies atomic.Int64 // 越过异常阈值的次数
 }
 
 // NewJWTService 创建JWT服务实例
@@ -83,45 +294,228 @@ func NewJWTService(config *JWTConfig) JWTService {
 	if config == nil {
 		config = DefaultJWTConfig()
 	}
+	watermarks := config.WatermarkStorage
+	if watermarks == nil {
+		watermarks = NewMemoryTokenWatermarkStorage()
+	}
+	salts := config.TokenSalts
+	if salts != nil && config.TokenSaltCacheTTL > 0 {
+		salts = newCachedTokenSaltStorage(salts, config.TokenSaltCacheTTL)
+	}
+	clock := clockOrDefault(config.Clock)
+	revocations := config.RevocationStore
+	if revocations == nil {
+		revocations = NewMemoryTokenRevocationStore(config.MaxRevokedTokens, clock)
+	}
+	quotaStore := config.RateLimitStore
+	if quotaStore == nil {
+		quotaStore = NewMemoryRateLimitStoreWithClock(clock)
+	}
+	auditLogger := config.AuditLogger
+	if auditLogger == nil {
+		auditLogger = noopAuditLogger{}
+	}
+
+	// 不支持的签名算法不回退到HS256，服务签发和验证Token时都返回配置错误
+	signingMethod, configErr := resolveSigningMethod(config.SigningMethod)
 
 	return &jwtService{
 		config:        config,
 		secretKey:     []byte(config.SecretKey),
-		revokedTokens: make(map[string]time.Time),
+		verifyKey:     verificationKeys(config),
+		signingMethod: signingMethod,
+		configErr:     configErr,
+		revocations:   revocations,
 		userTokens:    make(map[uint][]string),
 		tokenUsers:    make(map[string]uint),
+		tokenChannels: make(map[string]string),
+		jtiTokens:     make(map[string]string),
 		refreshCounts: make(map[string]int),
+		watermarks:    watermarks,
+		salts:         salts,
+		quotaStore:    quotaStore,
+		auditLogger:   auditLogger,
+		clock:         clock,
+	}
+}
+
+// verificationKeys 返回验证签名使用的密钥，当前密钥优先，其后依次为轮换前的密钥
+func verificationKeys(config *JWTConfig) interface{} {
+	current := []byte(config.SecretKey)
+	if len(config.PreviousSecretKeys) == 0 {
+		return current
+	}
+
+	keys := jwt.VerificationKeySet{Keys: []jwt.VerificationKey{current}}
+	for _, key := range config.PreviousSecretKeys {
+		keys.Keys = append(keys.Keys, key)
+	}
+	return keys
+}
+
+// keyFunc 校验签名算法并返回验证密钥
+func (s *jwtService) keyFunc(token *jwt.Token) (interface{}, error) {
+	if s.configErr != nil {
+		return nil, s.configErr
+	}
+	// 只接受配置的HMAC算法，防止算法混淆
+	if token.Method.Alg() != s.signingMethod.Alg() {
+		return nil, fmt.Errorf("无效的签名方法: %v", token.Header["alg"])
+	}
+	if s.salts == nil {
+		return s.verifyKey, nil
+	}
+
+	// 按未验证的user_id读取盐值，user_id被篡改时派生出的密钥不同，签名无法通过
+	claims, ok := token.Claims.(*JWTClaims)
+	if !ok || claims.UserID == 0 {
+		return nil, errors.New("Token缺少用户ID")
+	}
+	salt, err := s.salts.Get(claims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("读取Token盐值失败: %w", err)
+	}
+	return userVerificationKeys(s.config, salt), nil
+}
+
+// signingKey 返回签发用户Token使用的密钥
+func (s *jwtService) signingKey(userID uint) ([]byte, error) {
+	if s.salts == nil {
+		return s.secretKey, nil
+	}
+	salt, err := s.salts.Get(userID)
+	if err != nil {
+		return nil, fmt.Errorf("读取Token盐值失败: %w", err)
 	}
+	return deriveUserKey(s.secretKey, salt), nil
+}
+
+// RotateTokenSalt 轮换用户的Token盐值，之前签发的Token立即无法通过签名验证
+func (s *jwtService) RotateTokenSalt(userID uint) error {
+	if s.salts == nil {
+		return ErrTokenSaltNotEnabled
+	}
+	if userID == 0 {
+		return errors.New("用户ID不能为0")
+	}
+	_, err := s.salts.Rotate(userID)
+	return err
 }
 
 // GenerateJTI 生成JWT ID
 func (s *jwtService) GenerateJTI() string {
-	bytes := make([]byte, 16)
+	bytes := make([]byte, jtiBytes)
 	rand.Read(bytes)
 	return hex.EncodeToString(bytes)
 }
 
+// jtiBytes GenerateJTI生成的JTI的随机字节数，编码为两倍长度的小写十六进制字符串
+const jtiBytes = 16
+
+// ErrInvalidJTI JTI不是GenerateJTI生成的格式
+var ErrInvalidJTI = errors.New("JTI格式无效")
+
+// isValidJTI 检查JTI是否为GenerateJTI生成的小写十六进制字符串
+func isValidJTI(jti string) bool {
+	if len(jti) != jtiBytes*2 {
+		return false
+	}
+	for i := 0; i < len(jti); i++ {
+		c := jti[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
 // GenerateToken 生成Token
 func (s *jwtService) GenerateToken(userID uint) (string, error) {
 	return s.GenerateTokenWithExpiration(userID, s.config.DefaultExpiration)
 }
 
+// GenerateTokenDetailed 生成Token并返回签入的Claims，调用方记录会话或审计时无需再解析Token
+func (s *jwtService) GenerateTokenDetailed(userID uint) (string, *JWTClaims, error) {
+	return s.generateSessionToken(userID, s.config.DefaultExpiration, "", time.Time{}, nil, nil)
+}
+
 // GenerateTokenWithExpiration 生成带自定义过期时间的Token
 func (s *jwtService) GenerateTokenWithExpiration(userID uint, expiration time.Duration) (string, error) {
+	return s.generateToken(userID, expiration, "")
+}
+
+// GenerateTokenForChannel 为指定渠道（如web、mobile）生成Token
+func (s *jwtService) GenerateTokenForChannel(userID uint, channel string) (string, error) {
+	if channel == "" {
+		return "", errors.New("渠道不能为空")
+	}
+	return s.generateToken(userID, s.config.DefaultExpiration, channel)
+}
+
+// generateToken 开始新会话，生成Token并记录用户及渠道关系
+func (s *jwtService) generateToken(userID uint, expiration time.Duration, channel string) (string, error) {
+	token, _, err := s.generateSessionToken(userID, expiration, channel, time.Time{}, nil, nil)
+	return token, err
+}
+
+// GenerateTokenWithAMR 生成记录登录认证方式的Token，channel可为空
+func (s *jwtService) GenerateTokenWithAMR(userID uint, channel string, amr []string) (string, error) {
+	token, _, err := s.generateSessionToken(userID, s.config.DefaultExpiration, channel, time.Time{}, amr, nil)
+	return token, err
+}
+
+// GenerateTokenWithClaims 生成携带自定义声明的Token，extra与固定声明平铺在同一层，ParseToken时放回JWTClaims.Extra
+//
+// extra使用保留的声明名（如exp、iss、jti、user_id）时返回ErrReservedClaim。值按JSON编码，解析后数字为float64。
+func (s *jwtService) GenerateTokenWithClaims(userID uint, extra map[string]interface{}, expiration time.Duration) (string, error) {
+	if err := checkExtraClaims(extra); err != nil {
+		return "", err
+	}
+	var copied map[string]interface{}
+	if len(extra) > 0 {
+		copied = make(map[string]interface{}, len(extra))
+		for key, value := range extra {
+			copied[key] = value
+		}
+	}
+	token, _, err := s.generateSessionToken(userID, expiration, "", time.Time{}, nil, copied)
+	return token, err
+}
+
+// generateSessionToken 生成Token并返回其Claims，originalIssuedAt为会话首次签发时间，零值表示新会话；amr为登录认证方式，extra为自定义声明
+func (s *jwtService) generateSessionToken(userID uint, expiration time.Duration, channel string, originalIssuedAt time.Time, amr []string, extra map[string]interface{}) (string, *JWTClaims, error) {
+	if s.configErr != nil {
+		return "", nil, s.configErr
+	}
 	if userID == 0 {
-		return "", errors.New("用户ID不能为0")
+		return "", nil, errors.New("用户ID不能为0")
 	}
 
 	if expiration <= 0 {
-		return "", errors.New("过期时间必须大于0")
+		return "", nil, errors.New("过期时间必须大于0")
 	}
 
-	now := time.Now()
+	// 只有新会话计入签发配额，刷新会撤销原Token，不会增加有效Token数
+	if originalIssuedAt.IsZero() {
+		if err := s.checkIssueQuota(userID); err != nil {
+			return "", nil, err
+		}
+	}
+
+	now := s.clock.Now()
 	jti := s.GenerateJTI()
 
+	if originalIssuedAt.IsZero() {
+		originalIssuedAt = now
+	}
+
 	claims := &JWTClaims{
-		UserID: userID,
-		JTI:    jti,
+		UserID:           userID,
+		JTI:              jti,
+		Channel:          channel,
+		OriginalIssuedAt: jwt.NewNumericDate(originalIssuedAt),
+		AMR:              amr,
+		Extra:            extra,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(now.Add(expiration)),
 			IssuedAt:  jwt.NewNumericDate(now),
@@ -131,38 +525,142 @@ func (s *jwtService) GenerateTokenWithExpiration(userID uint, expiration time.Du
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(s.secretKey)
+	key, err := s.signingKey(userID)
 	if err != nil {
-		return "", fmt.Errorf("生成Token失败: %w", err)
+		return "", nil, err
+	}
+
+	token := jwt.NewWithClaims(s.signingMethod, claims)
+	tokenString, err := token.SignedString(key)
+	if err != nil {
+		return "", nil, fmt.Errorf("生成Token失败: %w", err)
+	}
+
+	// 共享存储不可用时仍允许签发，只是其他实例的RevokeAllUserTokens无法撤销该Token
+	if err := s.revocations.Track(userID, jti, s.revocationExpiresAt(claims)); err != nil {
+		log.Printf("记录Token撤销索引失败: user_id=%d err=%v", userID, err)
 	}
 
 	// 记录用户Token关系
 	s.mutex.Lock()
 	s.userTokens[userID] = append(s.userTokens[userID], tokenString)
 	s.tokenUsers[tokenString] = userID
+	s.jtiTokens[jti] = tokenString
+	if channel != "" {
+		s.tokenChannels[tokenString] = channel
+	}
 	s.mutex.Unlock()
 
-	return tokenString, nil
+	return tokenString, claims, nil
 }
 
 // ValidateToken 验证Token
 func (s *jwtService) ValidateToken(tokenString string) (uint, error) {
-	if tokenString == "" {
-		return 0, errors.New("Token不能为空")
+	claims, _, err := s.validateToken(tokenString)
+	if err != nil {
+		return 0, err
 	}
+	return claims.UserID, nil
+}
 
-	// 检查Token是否被撤销
-	if s.IsTokenRevoked(tokenString) {
-		return 0, errors.New("Token已被撤销")
+// ValidateTokenFull 验证Token并返回剩余有效时间，中间件设置即将过期的提示头时无需再次解析
+func (s *jwtService) ValidateTokenFull(tokenString string) (uint, time.Duration, error) {
+	claims, now, err := s.validateToken(tokenString)
+	if err != nil {
+		return 0, 0, err
+	}
+	remaining, err := remainingTime(claims, now)
+	if err != nil {
+		return 0, 0, err
+	}
+	return claims.UserID, remaining, nil
+}
+
+// validateToken 验证Token并返回Claims和校验时使用的当前时间
+func (s *jwtService) validateToken(tokenString string) (*JWTClaims, time.Time, error) {
+	if tokenString == "" {
+		return nil, time.Time{}, errors.New("Token不能为空")
 	}
 
 	claims, err := s.ParseToken(tokenString)
 	if err != nil {
-		return 0, err
+		return nil, time.Time{}, err
 	}
 
-	return claims.UserID, nil
+	// 按验证后的JTI检查撤销记录，撤销记录不可用时拒绝
+	revoked, err := s.revocations.IsRevoked(revocationKey(tokenString, claims))
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("检查Token撤销状态失败: %w", err)
+	}
+	if revoked {
+		return nil, time.Time{}, errors.New("Token已被撤销")
+	}
+
+	// 刷新时已检查会话有效期，这里再检查一次，超过有效期的会话即使Token未过期也不能继续使用
+	now := s.clock.Now()
+	if err := s.checkSessionLifetime(claims, now); err != nil {
+		return nil, time.Time{}, err
+	}
+	if err := s.checkWatermark(claims); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return claims, now, nil
+}
+
+// TokenBelongsToUser 验证Token并判断是否属于指定用户，Token无效、过期或已撤销时返回错误
+func (s *jwtService) TokenBelongsToUser(tokenString string, userID uint) (bool, error) {
+	tokenUserID, err := s.ValidateToken(tokenString)
+	if err != nil {
+		return false, err
+	}
+	return userID != 0 && tokenUserID == userID, nil
+}
+
+// sessionIssuedAt 获取会话首次签发时间，未携带orig_iat的旧Token使用其签发时间
+func sessionIssuedAt(claims *JWTClaims) time.Time {
+	if claims.OriginalIssuedAt != nil {
+		return claims.OriginalIssuedAt.Time
+	}
+	if claims.IssuedAt != nil {
+		return claims.IssuedAt.Time
+	}
+	return time.Time{}
+}
+
+// checkSessionLifetime 检查会话是否已超过最长有效期
+func (s *jwtService) checkSessionLifetime(claims *JWTClaims, now time.Time) error {
+	if s.config.MaxSessionLifetime <= 0 {
+		return nil
+	}
+	issuedAt := sessionIssuedAt(claims)
+	if !issuedAt.IsZero() && now.Sub(issuedAt) >= s.config.MaxSessionLifetime {
+		return ErrSessionLifetimeExceeded
+	}
+	return nil
+}
+
+// checkWatermark 检查Token签发时间是否早于撤销水位线，水位线读取失败时拒绝Token
+func (s *jwtService) checkWatermark(claims *JWTClaims) error {
+	cutoff, err := s.watermarks.Get(claims.UserID)
+	if err != nil {
+		return fmt.Errorf("读取Token水位线失败: %w", err)
+	}
+	if cutoff.IsZero() {
+		return nil
+	}
+	if claims.IssuedAt == nil || claims.IssuedAt.Time.Before(cutoff) {
+		return ErrTokenIssuedBeforeWatermark
+	}
+	return nil
+}
+
+// RevokeTokensIssuedBefore 使用户在cutoff之前签发的所有Token失效，userID为0时对所有用户生效
+//
+// 只记录一条水位线，不需要枚举已签发的Token，对其他实例签发的Token同样生效。
+// iat精确到秒，与cutoff处于同一秒内签发的Token也可能失效。水位线只会提高，传入更早的时间不会恢复已失效的Token。
+func (s *jwtService) RevokeTokensIssuedBefore(userID uint, cutoff time.Time) error {
+	return s.watermarks.Raise(userID, cutoff)
 }
 
 // ParseToken 解析Token获取Claims
@@ -170,13 +668,62 @@ func (s *jwtService) ParseToken(tokenString string) (*JWTClaims, error) {
 	if tokenString == "" {
 		return nil, errors.New("Token不能为空")
 	}
+	if len(tokenString) > s.maxTokenLength() {
+		return nil, ErrTokenTooLong
+	}
 
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("无效的签名方法: %v", token.Header["alg"])
-		}
-		return s.secretKey, nil
-	})
+	return s.parseToken(tokenString)
+}
+
+// ParseAMR 验证Token并返回登录认证方式
+func (s *jwtService) ParseAMR(tokenString string) ([]string, error) {
+	claims, err := s.ParseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	return claims.AMR, nil
+}
+
+// ParseTokenAllowExpired 解析Token，过期不超过ExpiredTokenGracePeriod时仍返回Claims，expired表示是否已过期
+//
+// 用于让短暂离线的用户续期刚过期的Token，只应在受控的续期接口中使用；与ParseToken一样不检查撤销记录，
+// 续期前应检查IsTokenRevoked。撤销记录在过期后的宽限期内保留，已撤销的Token在宽限期内同样能被识别。
+func (s *jwtService) ParseTokenAllowExpired(tokenString string) (*JWTClaims, bool, error) {
+	if tokenString == "" {
+		return nil, false, errors.New("Token不能为空")
+	}
+	if len(tokenString) > s.maxTokenLength() {
+		return nil, false, ErrTokenTooLong
+	}
+
+	s.parseCount.Add(1)
+	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, s.keyFunc,
+		jwt.WithTimeFunc(s.clock.Now), jwt.WithLeeway(s.config.ExpiredTokenGracePeriod))
+	if err != nil {
+		return nil, false, fmt.Errorf("解析Token失败: %w", err)
+	}
+
+	claims, ok := token.Claims.(*JWTClaims)
+	if !ok || !token.Valid {
+		return nil, false, errors.New("无效的Token")
+	}
+	expired := claims.ExpiresAt != nil && !s.clock.Now().Before(claims.ExpiresAt.Time)
+	return claims, expired, nil
+}
+
+// maxTokenLength 接受的Token最大长度
+func (s *jwtService) maxTokenLength() int {
+	if s.config.MaxTokenLength <= 0 {
+		return DefaultMaxTokenLength
+	}
+	return s.config.MaxTokenLength
+}
+
+// parseToken 验证签名并解析Claims，每个高层操作最多调用一次
+func (s *jwtService) parseToken(tokenString string) (*JWTClaims, error) {
+	s.parseCount.Add(1)
+
+	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, s.keyFunc, jwt.WithTimeFunc(s.clock.Now))
 
 	if err != nil {
 		return nil, fmt.Errorf("解析Token失败: %w", err)
@@ -194,63 +741,142 @@ func (s *jwtService) RevokeToken(tokenString string) error {
 	if tokenString == "" {
 		return errors.New("Token不能为空")
 	}
+	// 超长的字符串不可能是本服务签发的Token，不解析也不记录
+	if len(tokenString) > s.maxTokenLength() {
+		return ErrTokenTooLong
+	}
+
+	// 只记录签名有效的Token，防止伪造Token占满撤销集合
+	claims, err := s.parseRevocableToken(tokenString)
+	if err != nil {
+		return fmt.Errorf("撤销Token失败: %w", err)
+	}
+
+	// 已过期的Token按其过期时间记录，撤销集合写满时最先被清除，不会挤占有效Token的记录
+	return s.revokeToken(tokenString, claims)
+}
+
+// parseRevocableToken 验证签名并解析Claims，不校验过期时间
+func (s *jwtService) parseRevocableToken(tokenString string) (*JWTClaims, error) {
+	s.parseCount.Add(1)
+
+	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, s.keyFunc, jwt.WithoutClaimsValidation())
+
+	if err != nil {
+		return nil, fmt.Errorf("解析Token失败: %w", err)
+	}
+
+	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
+		return claims, nil
+	}
+
+	return nil, errors.New("无效的Token")
+}
+
+// revokeToken 使用已解析的Claims撤销Token，不再重复验证签名
+func (s *jwtService) revokeToken(tokenString string, claims *JWTClaims) error {
+	if err := s.revocations.Revoke(revocationKey(tokenString, claims), s.revocationExpiresAt(claims)); err != nil {
+		return fmt.Errorf("写入撤销记录失败: %w", err)
+	}
+	s.forgetToken(tokenString)
+	return nil
+}
+
+// revocationKey 撤销记录的键，使用JTI，没有JTI的Token使用Token本身
+func revocationKey(tokenString string, claims *JWTClaims) string {
+	if claims == nil || claims.JTI == "" {
+		return tokenString
+	}
+	return claims.JTI
+}
+
+// revocationExpiresAt 撤销记录需要保留到的时间，过期宽限期内的Token仍可能被续期，记录保留到宽限期结束
+func (s *jwtService) revocationExpiresAt(claims *JWTClaims) time.Time {
+	return s.tokenExpiresAt(claims).Add(s.config.ExpiredTokenGracePeriod)
+}
+
+// tokenExpiresAt 获取Token的过期时间，未设置时按最长有效期处理
+func (s *jwtService) tokenExpiresAt(claims *JWTClaims) time.Time {
+	if claims == nil || claims.ExpiresAt == nil {
+		return s.clock.Now().Add(100 * 365 * 24 * time.Hour)
+	}
+	return claims.ExpiresAt.Time
+}
+
+// revokeTrackedToken 撤销本服务签发的Token，Token已通过签名验证，不再重复验证
+//
+// 撤销存储可能是Redis等远程存储，调用方不能持有s.mutex，避免网络I/O阻塞签发和验证
+func (s *jwtService) revokeTrackedToken(tokenString string) error {
+	claims, err := s.parseTokenUnsafe(tokenString)
+	if err != nil {
+		claims = nil
+	}
+	return s.revocations.Revoke(revocationKey(tokenString, claims), s.revocationExpiresAt(claims))
+}
 
+// revokeTrackedTokens 在锁外逐个撤销Token，撤销成功后再清理跟踪记录；
+// 遇到错误时停止，尚未撤销的Token仍保留在跟踪记录中，重试时继续撤销
+func (s *jwtService) revokeTrackedTokens(tokens []string) error {
+	for _, tokenString := range tokens {
+		if err := s.revokeTrackedToken(tokenString); err != nil {
+			return err
+		}
+		s.forgetToken(tokenString)
+	}
+	return nil
+}
+
+// forgetToken 清理Token的用户关系、渠道和刷新计数，返回Token此前是否仍在跟踪
+func (s *jwtService) forgetToken(tokenString string) bool {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	s.revokedTokens[tokenString] = time.Now()
-
 	// 从用户Token列表中移除
-	if userID, exists := s.tokenUsers[tokenString]; exists {
+	userID, tracked := s.tokenUsers[tokenString]
+	if tracked {
 		if tokens, ok := s.userTokens[userID]; ok {
-			newTokens := make([]string, 0, len(tokens))
-			for _, token := range tokens {
-				if token != tokenString {
-					newTokens = append(newTokens, token)
-				}
-			}
-			s.userTokens[userID] = newTokens
+			s.userTokens[userID] = removeToken(tokens, tokenString)
 		}
 		delete(s.tokenUsers, tokenString)
 	}
+	delete(s.tokenChannels, tokenString)
+	s.forgetJTI(tokenString)
 
 	// 清理刷新计数
 	delete(s.refreshCounts, tokenString)
+	return tracked
+}
 
-	return nil
+// forgetJTI 清理Token的JTI索引，调用方需持有写锁
+func (s *jwtService) forgetJTI(tokenString string) {
+	if claims, err := s.parseTokenUnsafe(tokenString); err == nil && s.jtiTokens[claims.JTI] == tokenString {
+		delete(s.jtiTokens, claims.JTI)
+	}
 }
 
-// IsTokenRevoked 检查Token是否被撤销
+// IsTokenRevoked 检查Token是否被撤销，撤销记录不可用时按已撤销处理
 func (s *jwtService) IsTokenRevoked(tokenString string) bool {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-
-	_, revoked := s.revokedTokens[tokenString]
+	revoked, err := s.isRevoked(tokenString)
+	if err != nil {
+		log.Printf("检查Token撤销状态失败: %v", err)
+		return true
+	}
 	return revoked
 }
 
-// CleanupExpiredTokens 清理过期的撤销Token
-func (s *jwtService) CleanupExpiredTokens() error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	now := time.Now()
-	expiredTokens := make([]string, 0)
-
-	// 找出过期的撤销Token
-	for tokenString := range s.revokedTokens {
-		claims, err := s.parseTokenUnsafe(tokenString)
-		if err != nil || (claims.ExpiresAt != nil && claims.ExpiresAt.Before(now)) {
-			expiredTokens = append(expiredTokens, tokenString)
-		}
-	}
-
-	// 清理过期的撤销Token
-	for _, tokenString := range expiredTokens {
-		delete(s.revokedTokens, tokenString)
+// isRevoked 按JTI查询撤销记录，不验证签名
+func (s *jwtService) isRevoked(tokenString string) (bool, error) {
+	claims, err := s.parseTokenUnsafe(tokenString)
+	if err != nil {
+		claims = nil
 	}
+	return s.revocations.IsRevoked(revocationKey(tokenString, claims))
+}
 
-	return nil
+// CleanupExpiredTokens 清理过期的撤销Token
+func (s *jwtService) CleanupExpiredTokens() error {
+	// 撤销记录按过期时间加宽限期写入，到期即可清除
+	return s.revocations.Cleanup()
 }
 
 // parseTokenUnsafe 不安全的Token解析（不验证签名，仅用于内部清理）
@@ -278,11 +904,16 @@ func (s *jwtService) GetTokenRemainingTime(tokenString string) (time.Duration, e
 		return 0, err
 	}
 
+	return remainingTime(claims, s.clock.Now())
+}
+
+// remainingTime 根据已解析的Claims计算在now时的剩余有效时间
+func remainingTime(claims *JWTClaims, now time.Time) (time.Duration, error) {
 	if claims.ExpiresAt == nil {
 		return 0, errors.New("Token没有过期时间")
 	}
 
-	remaining := time.Until(claims.ExpiresAt.Time)
+	remaining := claims.ExpiresAt.Time.Sub(now)
 	if remaining <= 0 {
 		return 0, errors.New("Token已过期")
 	}
@@ -300,12 +931,17 @@ func (s *jwtService) RefreshToken(tokenString string) (string, error) {
 		return "", errors.New("Token不能为空")
 	}
 
-	// 解析原Token
-	claims, err := s.ParseToken(tokenString)
+	// 解析原Token，后续步骤均复用此次解析结果
+	claims, err := s.parseToken(tokenString)
 	if err != nil {
 		return "", fmt.Errorf("解析原Token失败: %w", err)
 	}
 
+	return s.refreshWithClaims(tokenString, claims)
+}
+
+// refreshWithClaims 使用已解析的Claims刷新Token，不再重复验证签名
+func (s *jwtService) refreshWithClaims(tokenString string, claims *JWTClaims) (string, error) {
 	// 检查刷新次数
 	s.mutex.RLock()
 	refreshCount := s.refreshCounts[tokenString]
@@ -315,61 +951,259 @@ func (s *jwtService) RefreshToken(tokenString string) (string, error) {
 		return "", errors.New("Token刷新次数已达上限")
 	}
 
+	// 刷新不能延长会话的最长有效期
+	if err := s.checkSessionLifetime(claims, s.clock.Now()); err != nil {
+		return "", err
+	}
+	// 刷新会签发新的iat，必须先检查水位线，否则旧Token可以借刷新绕过撤销
+	if err := s.checkWatermark(claims); err != nil {
+		return "", err
+	}
+
 	// 检查是否在刷新期限内
 	if claims.ExpiresAt != nil {
 		refreshDeadline := claims.ExpiresAt.Add(-s.config.RefreshExpiration)
-		if time.Now().Before(refreshDeadline) {
+		if s.clock.Now().Before(refreshDeadline) {
 			return "", errors.New("Token还未到刷新时间")
 		}
 	}
 
-	// 生成新Token
-	newToken, err := s.GenerateToken(claims.UserID)
+	// 签发新Token前先消费原Token，检查与撤销是原子的：已撤销的Token不能刷新，并发刷新同一Token时只有一个成功
+	consumed, err := s.revocations.Consume(revocationKey(tokenString, claims), s.revocationExpiresAt(claims))
+	if err != nil {
+		return "", fmt.Errorf("撤销原Token失败: %w", err)
+	}
+	if !consumed {
+		return "", errors.New("Token已被撤销")
+	}
+	s.forgetToken(tokenString)
+
+	// 生成新Token，保留原Token的签发渠道、会话首次签发时间和认证方式；失败时原Token已失效，需要重新登录
+	newToken, _, err := s.generateSessionToken(claims.UserID, s.config.DefaultExpiration, claims.Channel, sessionIssuedAt(claims), claims.AMR, claims.Extra)
 	if err != nil {
 		return "", fmt.Errorf("生成新Token失败: %w", err)
 	}
 
-	// 更新刷新计数 - 在撤销原Token之前保存计数
 	s.mutex.Lock()
 	s.refreshCounts[newToken] = refreshCount + 1
 	s.mutex.Unlock()
 
-	// 撤销原Token
-	err = s.RevokeToken(tokenString)
-	if err != nil {
-		// 如果撤销失败，也要清理新Token的刷新计数
-		s.mutex.Lock()
-		delete(s.refreshCounts, newToken)
-		s.mutex.Unlock()
-		return "", fmt.Errorf("撤销原Token失败: %w", err)
-	}
-
 	return newToken, nil
 }
 
 // RevokeAllUserTokens 批量撤销用户的所有Token
+//
+// 同时把用户水位线提高到当前秒，刷新得到的后代Token即使不在本实例的记录中也无法继续使用或刷新；
+// 当前秒内签发的Token不受水位线影响，撤销后立即重新登录获得的Token仍然有效。
+// 配置了TokenSalts时同时轮换盐值，其他实例签发的Token同样失效。
 func (s *jwtService) RevokeAllUserTokens(userID uint) error {
 	if userID == 0 {
 		return errors.New("用户ID不能为0")
 	}
 
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	// iat精确到秒，水位线取整到秒，避免同一秒内稍后签发的新Token被误判失效
+	if err := s.watermarks.Raise(userID, s.clock.Now().Truncate(time.Second)); err != nil {
+		return fmt.Errorf("提高Token水位线失败: %w", err)
+	}
 
-	tokens, exists := s.userTokens[userID]
-	if !exists {
-		return nil // 用户没有Token，直接返回
+	if s.salts != nil {
+		if _, err := s.salts.Rotate(userID); err != nil {
+			return fmt.Errorf("轮换Token盐值失败: %w", err)
+		}
 	}
 
-	now := time.Now()
-	for _, tokenString := range tokens {
-		s.revokedTokens[tokenString] = now
-		delete(s.tokenUsers, tokenString)
-		delete(s.refreshCounts, tokenString)
+	// 撤销存储中记录的全部JTI，包括其他实例签发的Token
+	if err := s.revocations.RevokeAllForUser(userID); err != nil {
+		return fmt.Errorf("撤销用户Token失败: %w", err)
+	}
+
+	// 锁内只复制Token列表，撤销存储的调用在锁外进行
+	s.mutex.RLock()
+	tokens := append([]string(nil), s.userTokens[userID]...)
+	s.mutex.RUnlock()
+
+	// 签发时记录JTI失败的Token不在存储的用户记录中，逐个撤销
+	if err := s.revokeTrackedTokens(tokens); err != nil {
+		return fmt.Errorf("撤销用户Token失败: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeUserTokensForChannel 撤销用户在指定渠道的所有Token
+func (s *jwtService) RevokeUserTokensForChannel(userID uint, channel string) error {
+	if userID == 0 {
+		return errors.New("用户ID不能为0")
+	}
+
+	if channel == "" {
+		return errors.New("渠道不能为空")
+	}
+
+	// 锁内只收集该渠道的Token，撤销存储的调用在锁外进行
+	s.mutex.RLock()
+	var tokens []string
+	for _, tokenString := range s.userTokens[userID] {
+		if s.tokenChannels[tokenString] == channel {
+			tokens = append(tokens, tokenString)
+		}
+	}
+	s.mutex.RUnlock()
+
+	if err := s.revokeTrackedTokens(tokens); err != nil {
+		return fmt.Errorf("撤销渠道Token失败: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeByJTIs 按JTI批量撤销Token
+//
+// 锁内只查找JTI对应的Token，撤销存储的调用在锁外进行，Redis等远程存储的网络I/O不会阻塞签发和验证。
+// 只能撤销本实例签发且仍在跟踪的Token，不存在、已撤销或由其他实例签发的JTI计入NotFound；重复的JTI只处理一次。
+// 撤销失败时立即返回，尚未撤销的Token仍保留在跟踪记录中。
+func (s *jwtService) RevokeByJTIs(jtis []string) (*JTIRevocationResult, error) {
+	result := &JTIRevocationResult{NotFound: []string{}}
+	if len(jtis) == 0 {
+		return result, nil
+	}
+
+	type pendingJTI struct {
+		jti         string
+		tokenString string
+	}
+
+	s.mutex.RLock()
+	seen := make(map[string]bool, len(jtis))
+	pending := make([]pendingJTI, 0, len(jtis))
+	for _, jti := range jtis {
+		if seen[jti] {
+			continue
+		}
+		seen[jti] = true
+
+		tokenString, exists := s.jtiTokens[jti]
+		if !exists {
+			result.NotFound = append(result.NotFound, jti)
+			continue
+		}
+		pending = append(pending, pendingJTI{jti: jti, tokenString: tokenString})
 	}
+	s.mutex.RUnlock()
 
-	// 清空用户Token列表
-	delete(s.userTokens, userID)
+	for _, p := range pending {
+		if err := s.revokeTrackedToken(p.tokenString); err != nil {
+			return result, fmt.Errorf("撤销Token失败: jti=%s: %w", p.jti, err)
+		}
 
+		// 并发撤销同一JTI时只有先清理跟踪记录的调用计入Revoked
+		if s.forgetToken(p.tokenString) {
+			result.Revoked++
+		} else {
+			result.NotFound = append(result.NotFound, p.jti)
+		}
+	}
+	return result, nil
+}
+
+// RevokeByJTI 按JTI撤销Token
+//
+// 本实例签发的Token按其过期时间保留撤销记录；其他实例签发的Token无法得知过期时间，按DefaultExpiration保留，
+// 签发时指定了更长有效期的Token应使用RevokeToken撤销。已撤销的JTI不做处理。
+func (s *jwtService) RevokeByJTI(jti string) error {
+	if jti == "" {
+		return errors.New("JTI不能为空")
+	}
+	// 撤销记录按DefaultExpiration保留，不写入任意长度或格式的调用方输入
+	if !isValidJTI(jti) {
+		return ErrInvalidJTI
+	}
+
+	result, err := s.RevokeByJTIs([]string{jti})
+	if err != nil || result.Revoked > 0 {
+		return err
+	}
+
+	// 已有的撤销记录可能保留得更久，不能被较短的保留时间覆盖
+	revoked, err := s.revocations.IsRevoked(jti)
+	if err != nil {
+		return fmt.Errorf("检查Token撤销状态失败: %w", err)
+	}
+	if revoked {
+		return nil
+	}
+	expiresAt := s.clock.Now().Add(s.config.DefaultExpiration + s.config.ExpiredTokenGracePeriod)
+	if err := s.revocations.Revoke(jti, expiresAt); err != nil {
+		return fmt.Errorf("写入撤销记录失败: %w", err)
+	}
 	return nil
 }
+
+// removeToken 从Token列表中移除指定Token，返回新的列表
+func removeToken(tokens []string, tokenString string) []string {
+	remaining := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if token != tokenString {
+			remaining = append(remaining, token)
+		}
+	}
+	return remaining
+}
+
+// ListUserSessions 获取本实例为用户签发且仍在跟踪的Token元数据，按签发顺序排列
+//
+// 已撤销或已刷新的Token不再跟踪；其他实例签发的Token不包含在内。
+func (s *jwtService) ListUserSessions(userID uint) []SessionMetadata {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	sessions := make([]SessionMetadata, 0, len(s.userTokens[userID]))
+	for _, tokenString := range s.userTokens[userID] {
+		claims, err := s.parseTokenUnsafe(tokenString)
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, SessionMetadata{
+			JTI:       claims.JTI,
+			Channel:   s.tokenChannels[tokenString],
+			StartedAt: numericTime(claims.OriginalIssuedAt),
+			IssuedAt:  numericTime(claims.IssuedAt),
+			ExpiresAt: numericTime(claims.ExpiresAt),
+		})
+	}
+	return sessions
+}
+
+// numericTime 转换JWT时间声明，未设置时返回nil
+func numericTime(date *jwt.NumericDate) *time.Time {
+	if date == nil {
+		return nil
+	}
+	t := date.Time
+	return &t
+}
+
+// Stats 获取服务运行状态
+func (s *jwtService) Stats() JWTStats {
+	s.mutex.RLock()
+	trackedTokens := len(s.tokenUsers)
+	s.mutex.RUnlock()
+
+	// 共享存储的撤销记录数不在本实例统计，为0
+	var revokedTokens, maxRevokedTokens int
+	if sized, ok := s.revocations.(interface {
+		Len() int
+		Cap() int
+	}); ok {
+		revokedTokens, maxRevokedTokens = sized.Len(), sized.Cap()
+	}
+
+	return JWTStats{
+		RevokedTokens:     revokedTokens,
+		MaxRevokedTokens:  maxRevokedTokens,
+		TrackedTokens:     trackedTokens,
+		TokensIssued:      s.tokensIssued.Load(),
+		QuotaRejections:   s.quotaRejections.Load(),
+		IssuanceAnomalies: s.issuanceAnomalies.Load(),
+	}
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -39,6 +43,8 @@ func TestJWTService(t *testing.T) {
 		assert.Equal(t, "aigo_service_auth", defaultConfig.Issuer)
 		assert.True(t, defaultConfig.AllowRefresh)
 		assert.Equal(t, 5, defaultConfig.MaxRefreshCount)
+		assert.Equal(t, "HS256", defaultConfig.SigningMethod)
+		assert.Equal(t, defaultMaxRevokedTokens, defaultConfig.MaxRevokedTokens)
 	})
 
 	t.Run("生成JTI", func(t *testing.T) {
@@ -76,6 +82,29 @@ func TestJWTService(t *testing.T) {
 		assert.Equal(t, "用户ID不能为0", err.Error())
 	})
 
+	t.Run("生成Token并返回Claims", func(t *testing.T) {
+		service := NewJWTService(config).(*jwtService)
+
+		token, claims, err := service.GenerateTokenDetailed(123)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, token)
+		assert.Equal(t, int64(0), service.parseCount.Load())
+
+		// 返回的Claims与Token中的一致
+		parsed, err := service.ParseToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, parsed, claims)
+		assert.Equal(t, uint(123), claims.UserID)
+		assert.Len(t, claims.JTI, 32)
+		assert.Equal(t, "test-issuer", claims.Issuer)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), claims.ExpiresAt.Time, 2*time.Second)
+
+		token, claims, err = service.GenerateTokenDetailed(0)
+		assert.Error(t, err)
+		assert.Empty(t, token)
+		assert.Nil(t, claims)
+	})
+
 	t.Run("生成带自定义过期时间的Token", func(t *testing.T) {
 		service := NewJWTService(config)
 		userID := uint(123)
@@ -284,17 +313,18 @@ func TestJWTService(t *testing.T) {
 	})
 
 	t.Run("获取Token剩余时间失败-过期Token", func(t *testing.T) {
-		// 创建一个很短过期时间的Token
+		clock := NewFakeClock(time.Time{})
 		shortConfig := *config
-		shortConfig.DefaultExpiration = time.Millisecond
+		shortConfig.DefaultExpiration = time.Minute
+		shortConfig.Clock = clock
 		service := NewJWTService(&shortConfig)
 		userID := uint(123)
 
 		token, err := service.GenerateToken(userID)
 		assert.NoError(t, err)
 
-		// 等待Token过期
-		time.Sleep(10 * time.Millisecond)
+		// 推进时钟使Token过期
+		clock.Advance(2 * time.Minute)
 
 		remaining, err := service.GetTokenRemainingTime(token)
 		assert.Error(t, err)
@@ -302,11 +332,79 @@ func TestJWTService(t *testing.T) {
 		assert.Contains(t, err.Error(), "Token已过期")
 	})
 
+	t.Run("宽限期内解析已过期的Token", func(t *testing.T) {
+		clock := NewFakeClock(time.Time{})
+		graceConfig := *config
+		graceConfig.DefaultExpiration = time.Minute
+		graceConfig.ExpiredTokenGracePeriod = 5 * time.Minute
+		graceConfig.Clock = clock
+		service := NewJWTService(&graceConfig)
+
+		token, err := service.GenerateToken(123)
+		assert.NoError(t, err)
+
+		claims, expired, err := service.ParseTokenAllowExpired(token)
+		assert.NoError(t, err)
+		assert.False(t, expired)
+		assert.Equal(t, uint(123), claims.UserID)
+
+		// 过期后仍在宽限期内
+		clock.Advance(2 * time.Minute)
+		claims, expired, err = service.ParseTokenAllowExpired(token)
+		assert.NoError(t, err)
+		assert.True(t, expired)
+		assert.Equal(t, uint(123), claims.UserID)
+
+		// 普通解析和验证仍拒绝过期Token
+		_, err = service.ParseToken(token)
+		assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+		_, err = service.ValidateToken(token)
+		assert.Error(t, err)
+
+		// 宽限期内撤销记录不会被清理
+		assert.NoError(t, service.RevokeToken(token))
+		assert.NoError(t, service.CleanupExpiredTokens())
+		assert.True(t, service.IsTokenRevoked(token))
+
+		// 超过宽限期
+		clock.Advance(5 * time.Minute)
+		_, _, err = service.ParseTokenAllowExpired(token)
+		assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+		assert.NoError(t, service.CleanupExpiredTokens())
+		assert.False(t, service.IsTokenRevoked(token))
+
+		// 签名无效的Token不因宽限期被接受
+		otherConfig := graceConfig
+		otherConfig.SecretKey = "other-secret-key"
+		forged, err := NewJWTService(&otherConfig).GenerateToken(123)
+		assert.NoError(t, err)
+		_, _, err = service.ParseTokenAllowExpired(forged)
+		assert.ErrorIs(t, err, jwt.ErrTokenSignatureInvalid)
+	})
+
+	t.Run("未配置宽限期时不接受已过期的Token", func(t *testing.T) {
+		clock := NewFakeClock(time.Time{})
+		shortConfig := *config
+		shortConfig.DefaultExpiration = time.Minute
+		shortConfig.Clock = clock
+		service := NewJWTService(&shortConfig)
+
+		token, err := service.GenerateToken(123)
+		assert.NoError(t, err)
+		clock.Advance(2 * time.Minute)
+
+		_, expired, err := service.ParseTokenAllowExpired(token)
+		assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+		assert.False(t, expired)
+	})
+
 	t.Run("刷新Token成功", func(t *testing.T) {
 		// 创建允许立即刷新的配置
 		refreshConfig := *config
 		refreshConfig.DefaultExpiration = time.Hour
 		refreshConfig.RefreshExpiration = time.Hour // 允许在整个生命周期内刷新
+		clock := NewFakeClock(time.Time{})
+		refreshConfig.Clock = clock
 		service := NewJWTService(&refreshConfig)
 		userID := uint(123)
 
@@ -314,8 +412,8 @@ func TestJWTService(t *testing.T) {
 		originalToken, err := service.GenerateToken(userID)
 		assert.NoError(t, err)
 
-		// 等待一段时间，确保新Token的时间戳不同
-		time.Sleep(time.Second)
+		// 推进时钟，确保新Token的时间戳不同
+		clock.Advance(time.Second)
 
 		// 刷新Token
 		newToken, err := service.RefreshToken(originalToken)
@@ -370,6 +468,8 @@ func TestJWTService(t *testing.T) {
 		refreshConfig := *config
 		refreshConfig.DefaultExpiration = time.Hour
 		refreshConfig.RefreshExpiration = time.Hour // 允许在整个生命周期内刷新
+		clock := NewFakeClock(time.Time{})
+		refreshConfig.Clock = clock
 		service := NewJWTService(&refreshConfig)
 		userID := uint(123)
 
@@ -379,7 +479,7 @@ func TestJWTService(t *testing.T) {
 		// 刷新到最大次数
 		currentToken := token
 		for i := 0; i < refreshConfig.MaxRefreshCount; i++ {
-			time.Sleep(time.Millisecond) // 确保时间戳不同
+			clock.Advance(time.Second) // 确保时间戳不同
 			newToken, err := service.RefreshToken(currentToken)
 			assert.NoError(t, err)
 			currentToken = newToken
@@ -452,10 +552,115 @@ func TestJWTService(t *testing.T) {
 		assert.NoError(t, err) // 应该成功，即使用户没有Token
 	})
 
+	t.Run("按JTI批量撤销Token", func(t *testing.T) {
+		service := NewJWTService(config)
+
+		token1, claims1, err := service.GenerateTokenDetailed(1)
+		assert.NoError(t, err)
+		token2, claims2, err := service.GenerateTokenDetailed(2)
+		assert.NoError(t, err)
+		token3, _, err := service.GenerateTokenDetailed(1)
+		assert.NoError(t, err)
+
+		result, err := service.RevokeByJTIs([]string{claims1.JTI, claims2.JTI, claims1.JTI, "missing"})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, result.Revoked)
+		assert.Equal(t, []string{"missing"}, result.NotFound)
+
+		assert.True(t, service.IsTokenRevoked(token1))
+		assert.True(t, service.IsTokenRevoked(token2))
+		assert.False(t, service.IsTokenRevoked(token3))
+		assert.Equal(t, 1, service.Stats().TrackedTokens)
+
+		// 已撤销的JTI不再能找到
+		result, err = service.RevokeByJTIs([]string{claims1.JTI})
+		assert.NoError(t, err)
+		assert.Equal(t, 0, result.Revoked)
+		assert.Equal(t, []string{claims1.JTI}, result.NotFound)
+
+		// 以其他方式撤销后同样找不到
+		_, claims4, err := service.GenerateTokenDetailed(3)
+		assert.NoError(t, err)
+		assert.NoError(t, service.RevokeAllUserTokens(3))
+		result, err = service.RevokeByJTIs([]string{claims4.JTI})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{claims4.JTI}, result.NotFound)
+
+		result, err = service.RevokeByJTIs(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, result.Revoked)
+		assert.Empty(t, result.NotFound)
+	})
+
+	t.Run("按渠道生成和撤销Token", func(t *testing.T) {
+		service := NewJWTService(config)
+		userID := uint(123)
+
+		webToken, err := service.GenerateTokenForChannel(userID, ChannelWeb)
+		assert.NoError(t, err)
+		mobileToken1, err := service.GenerateTokenForChannel(userID, ChannelMobile)
+		assert.NoError(t, err)
+		mobileToken2, err := service.GenerateTokenForChannel(userID, ChannelMobile)
+		assert.NoError(t, err)
+		otherToken, err := service.GenerateTokenForChannel(456, ChannelMobile)
+		assert.NoError(t, err)
+
+		claims, err := service.ParseToken(mobileToken1)
+		assert.NoError(t, err)
+		assert.Equal(t, ChannelMobile, claims.Channel)
+
+		// 只撤销该用户的移动端Token
+		err = service.RevokeUserTokensForChannel(userID, ChannelMobile)
+		assert.NoError(t, err)
+
+		assert.True(t, service.IsTokenRevoked(mobileToken1))
+		assert.True(t, service.IsTokenRevoked(mobileToken2))
+		assert.False(t, service.IsTokenRevoked(webToken))
+		assert.False(t, service.IsTokenRevoked(otherToken))
+
+		_, err = service.ValidateToken(webToken)
+		assert.NoError(t, err)
+	})
+
+	t.Run("按渠道生成和撤销Token失败-无效参数", func(t *testing.T) {
+		service := NewJWTService(config)
+
+		_, err := service.GenerateTokenForChannel(123, "")
+		assert.Error(t, err)
+		assert.Equal(t, "渠道不能为空", err.Error())
+
+		err = service.RevokeUserTokensForChannel(0, ChannelWeb)
+		assert.Error(t, err)
+
+		err = service.RevokeUserTokensForChannel(123, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("刷新Token保留签发渠道", func(t *testing.T) {
+		refreshConfig := *config
+		refreshConfig.RefreshExpiration = time.Hour
+		service := NewJWTService(&refreshConfig)
+
+		token, err := service.GenerateTokenForChannel(123, ChannelMobile)
+		assert.NoError(t, err)
+
+		newToken, err := service.RefreshToken(token)
+		assert.NoError(t, err)
+
+		claims, err := service.ParseToken(newToken)
+		assert.NoError(t, err)
+		assert.Equal(t, ChannelMobile, claims.Channel)
+
+		err = service.RevokeUserTokensForChannel(123, ChannelMobile)
+		assert.NoError(t, err)
+		assert.True(t, service.IsTokenRevoked(newToken))
+	})
+
 	t.Run("清理过期的撤销Token", func(t *testing.T) {
-		// 创建一个很短过期时间的配置
+		clock := NewFakeClock(time.Time{})
 		shortConfig := *config
-		shortConfig.DefaultExpiration = 10 * time.Millisecond
+		shortConfig.DefaultExpiration = time.Minute
+		shortConfig.Clock = clock
 		service := NewJWTService(&shortConfig)
 		userID := uint(123)
 
@@ -467,15 +672,20 @@ func TestJWTService(t *testing.T) {
 		assert.NoError(t, err)
 		assert.True(t, service.IsTokenRevoked(token))
 
-		// 等待Token过期
-		time.Sleep(20 * time.Millisecond)
+		// 未过期时清理不影响撤销记录
+		assert.NoError(t, service.CleanupExpiredTokens())
+		assert.True(t, service.IsTokenRevoked(token))
 
-		// 清理过期Token
+		// 推进时钟使Token过期后清理
+		clock.Advance(2 * time.Minute)
 		err = service.CleanupExpiredTokens()
 		assert.NoError(t, err)
 
-		// 过期的撤销Token应该被清理，但IsTokenRevoked应该仍然返回false（因为Token本身已过期）
-		// 这里我们无法直接验证内部状态，但可以确保清理操作不会出错
+		// 过期的撤销记录被清理，Token本身已过期，仍然无法通过验证
+		assert.False(t, service.IsTokenRevoked(token))
+		assert.Equal(t, 0, service.Stats().RevokedTokens)
+		_, err = service.ValidateToken(token)
+		assert.Error(t, err)
 	})
 
 	t.Run("并发安全测试", func(t *testing.T) {
@@ -608,6 +818,69 @@ func TestJWTService(t *testing.T) {
 		assert.Contains(t, err.Error(), "解析Token失败")
 	})
 
+	t.Run("ParseToken拒绝非配置的HMAC算法", func(t *testing.T) {
+		service := NewJWTService(config)
+		jwtService := service.(*jwtService)
+
+		// 使用相同密钥但以HS512签名的Token
+		claims := &JWTClaims{
+			UserID: 123,
+			JTI:    "test-jti",
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+				IssuedAt:  jwt.NewNumericDate(time.Now()),
+				Issuer:    config.Issuer,
+			},
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
+		tokenString, err := token.SignedString(jwtService.secretKey)
+		assert.NoError(t, err)
+
+		parsed, err := service.ParseToken(tokenString)
+		assert.Error(t, err)
+		assert.Nil(t, parsed)
+		assert.Contains(t, err.Error(), "无效的签名方法")
+	})
+
+	t.Run("使用配置的HMAC算法生成和解析Token", func(t *testing.T) {
+		hs512Config := *config
+		hs512Config.SigningMethod = "HS512"
+		service := NewJWTService(&hs512Config)
+
+		token, err := service.GenerateToken(123)
+		assert.NoError(t, err)
+
+		parsed, _, err := new(jwt.Parser).ParseUnverified(token, &JWTClaims{})
+		assert.NoError(t, err)
+		assert.Equal(t, "HS512", parsed.Method.Alg())
+
+		claims, err := service.ParseToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, uint(123), claims.UserID)
+
+		// HS256服务不接受HS512签名的Token
+		_, err = NewJWTService(config).ParseToken(token)
+		assert.Error(t, err)
+	})
+
+	t.Run("不支持的签名算法不回退到HS256", func(t *testing.T) {
+		badConfig := *config
+		badConfig.SigningMethod = "RS256"
+		service := NewJWTService(&badConfig)
+
+		_, err := service.GenerateToken(123)
+		assert.True(t, errors.Is(err, ErrInvalidConfiguration))
+
+		// 不接受按HS256签名的Token
+		token, err := NewJWTService(config).GenerateToken(123)
+		assert.NoError(t, err)
+		_, err = service.ParseToken(token)
+		assert.True(t, errors.Is(err, ErrInvalidConfiguration))
+
+		_, err = NewJWTServiceWithConfigCheck(&badConfig, false)
+		assert.True(t, errors.Is(err, ErrInvalidConfiguration))
+	})
+
 	t.Run("GetTokenRemainingTime边界条件", func(t *testing.T) {
 		service := NewJWTService(config)
 
@@ -636,28 +909,73 @@ func TestJWTService(t *testing.T) {
 		assert.Empty(t, newToken)
 		assert.Contains(t, err.Error(), "解析原Token失败")
 
-		// 测试刷新被撤销的Token实际上会成功，因为ParseToken不检查撤销状态
-		// 但是生成的新Token会正常工作
+		// 已撤销的Token不能刷新，退出登录后刷新链随之结束
 		token, err := service.GenerateToken(userID)
 		assert.NoError(t, err)
 
 		err = service.RevokeToken(token)
 		assert.NoError(t, err)
 
-		// RefreshToken会成功，因为它只解析Token，不验证撤销状态
 		newToken, err = service.RefreshToken(token)
+		assert.Error(t, err)
+		assert.Empty(t, newToken)
+		assert.Equal(t, "Token已被撤销", err.Error())
+	})
+
+	t.Run("RefreshToken轮换后原Token不能再次刷新", func(t *testing.T) {
+		refreshConfig := *config
+		refreshConfig.DefaultExpiration = time.Hour
+		refreshConfig.RefreshExpiration = time.Hour
+		clock := NewFakeClock(time.Time{})
+		refreshConfig.Clock = clock
+		service := NewJWTService(&refreshConfig)
+
+		token, err := service.GenerateToken(123)
 		assert.NoError(t, err)
-		assert.NotEmpty(t, newToken)
+		clock.Advance(time.Second)
 
-		// 但是原Token确实被撤销了
-		assert.True(t, service.IsTokenRevoked(token))
-		// 新Token应该是有效的
-		_, err = service.ValidateToken(newToken)
+		first, err := service.RefreshToken(token)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, first)
+
+		second, err := service.RefreshToken(token)
+		assert.Error(t, err)
+		assert.Empty(t, second)
+
+		// 新Token不受影响
+		_, err = service.ValidateToken(first)
+		assert.NoError(t, err)
+	})
+
+	t.Run("RefreshToken并发刷新同一Token只有一个成功", func(t *testing.T) {
+		refreshConfig := *config
+		refreshConfig.DefaultExpiration = time.Hour
+		refreshConfig.RefreshExpiration = time.Hour
+		service := NewJWTService(&refreshConfig)
+
+		token, err := service.GenerateToken(123)
 		assert.NoError(t, err)
+
+		var wg sync.WaitGroup
+		var succeeded atomic.Int32
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := service.RefreshToken(token); err == nil {
+					succeeded.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int32(1), succeeded.Load())
 	})
 
 	t.Run("GenerateTokenWithExpiration边界条件", func(t *testing.T) {
-		service := NewJWTService(config)
+		clock := NewFakeClock(time.Time{})
+		clockConfig := *config
+		clockConfig.Clock = clock
+		service := NewJWTService(&clockConfig)
 
 		// 测试生成Token时签名失败的情况（通过修改密钥长度来模拟）
 		// 这个测试很难直接触发，因为HMAC签名很少失败
@@ -669,7 +987,7 @@ func TestJWTService(t *testing.T) {
 		assert.NotEmpty(t, token)
 
 		// 验证Token立即过期
-		time.Sleep(time.Millisecond)
+		clock.Advance(time.Second)
 		_, err = service.ValidateToken(token)
 		assert.Error(t, err)
 	})
@@ -681,8 +999,13 @@ func TestJWTService(t *testing.T) {
 		validToken, err := service.GenerateToken(123)
 		assert.NoError(t, err)
 
-		// 修改Token的最后一个字符来破坏签名
-		invalidToken := validToken[:len(validToken)-1] + "X"
+		// 修改签名的第一个字符来破坏签名；最后一个字符的低位是填充，修改后可能解码出相同的签名
+		sigStart := strings.LastIndex(validToken, ".") + 1
+		replacement := "A"
+		if validToken[sigStart] == 'A' {
+			replacement = "B"
+		}
+		invalidToken := validToken[:sigStart] + replacement + validToken[sigStart+1:]
 
 		claims, err := service.ParseToken(invalidToken)
 		assert.Error(t, err)
@@ -748,4 +1071,549 @@ func TestJWTService(t *testing.T) {
 		jwtService.mutex.RUnlock()
 		assert.Equal(t, 1, count)
 	})
+
+	t.Run("RefreshToken只解析一次Token", func(t *testing.T) {
+		refreshConfig := *config
+		refreshConfig.RefreshExpiration = time.Hour
+		service := NewJWTService(&refreshConfig).(*jwtService)
+
+		token, err := service.GenerateToken(123)
+		assert.NoError(t, err)
+
+		service.parseCount.Store(0)
+		_, err = service.RefreshToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), service.parseCount.Load())
+	})
+
+	t.Run("撤销伪造的Token不占用撤销集合", func(t *testing.T) {
+		service := NewJWTService(config)
+
+		// 攻击者提交大量随机或伪造签名的Token
+		for i := 0; i < 100; i++ {
+			err := service.RevokeToken(fmt.Sprintf("garbage.token.%d", i))
+			assert.Error(t, err)
+		}
+		forger := NewJWTService(&JWTConfig{SecretKey: "attacker-secret", DefaultExpiration: time.Hour})
+		forged, err := forger.GenerateToken(123)
+		assert.NoError(t, err)
+		assert.Error(t, service.RevokeToken(forged))
+		assert.False(t, service.IsTokenRevoked(forged))
+
+		assert.Equal(t, 0, service.Stats().RevokedTokens)
+	})
+
+	t.Run("已过期的撤销记录不挤占有效Token", func(t *testing.T) {
+		boundedConfig := *config
+		boundedConfig.MaxRevokedTokens = 1
+		clock := NewFakeClock(time.Time{})
+		boundedConfig.Clock = clock
+		service := NewJWTService(&boundedConfig)
+
+		expired, err := service.GenerateTokenWithExpiration(123, time.Minute)
+		assert.NoError(t, err)
+		clock.Advance(2 * time.Minute)
+		assert.NoError(t, service.RevokeToken(expired))
+
+		live, err := service.GenerateToken(456)
+		assert.NoError(t, err)
+		assert.NoError(t, service.RevokeToken(live))
+
+		// 攻击者重复提交已过期的Token，也只能替换已过期的记录
+		assert.NoError(t, service.RevokeToken(expired))
+		assert.True(t, service.IsTokenRevoked(live))
+		assert.Equal(t, 1, service.Stats().RevokedTokens)
+	})
+
+	t.Run("撤销记录数量受配置上限约束", func(t *testing.T) {
+		boundedConfig := *config
+		boundedConfig.MaxRevokedTokens = 5
+		service := NewJWTService(&boundedConfig)
+		assert.Equal(t, 5, service.Stats().MaxRevokedTokens)
+
+		for i := 0; i < 20; i++ {
+			token, err := service.GenerateToken(uint(i + 1))
+			assert.NoError(t, err)
+			err = service.RevokeToken(token)
+			if i < 5 {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrRevocationStoreFull)
+			}
+		}
+
+		stats := service.Stats()
+		assert.Equal(t, 5, stats.RevokedTokens)
+		assert.Equal(t, 15, stats.TrackedTokens, "未能撤销的Token保留在跟踪记录中")
+	})
+
+	t.Run("写满时已撤销的Token保持撤销", func(t *testing.T) {
+		boundedConfig := *config
+		boundedConfig.MaxRevokedTokens = 1
+		clock := NewFakeClock(time.Time{})
+		boundedConfig.Clock = clock
+		service := NewJWTService(&boundedConfig)
+
+		revoked, err := service.GenerateTokenWithExpiration(123, time.Minute)
+		assert.NoError(t, err)
+		assert.NoError(t, service.RevokeToken(revoked))
+
+		// 更晚过期的Token不能挤出尚未过期的撤销记录
+		longToken, err := service.GenerateTokenWithExpiration(456, 10*time.Minute)
+		assert.NoError(t, err)
+		assert.ErrorIs(t, service.RevokeToken(longToken), ErrRevocationStoreFull)
+		_, err = service.RefreshToken(longToken)
+		assert.ErrorIs(t, err, ErrRevocationStoreFull, "无法记录消费时拒绝刷新")
+
+		assert.True(t, service.IsTokenRevoked(revoked))
+		_, err = service.ValidateToken(revoked)
+		assert.Error(t, err)
+		assert.Equal(t, 1, service.Stats().RevokedTokens)
+
+		// 记录过期后腾出容量
+		clock.Advance(2 * time.Minute)
+		assert.NoError(t, service.RevokeToken(longToken))
+		assert.True(t, service.IsTokenRevoked(longToken))
+	})
+}
+
+func TestJWTSessionLifetime(t *testing.T) {
+	clock := NewFakeClock(time.Time{})
+	newService := func(lifetime time.Duration) *jwtService {
+		return NewJWTService(&JWTConfig{
+			SecretKey:          "test-secret-key",
+			DefaultExpiration:  time.Hour,
+			RefreshExpiration:  time.Hour, // 任何时候都可以刷新
+			Issuer:             "test-issuer",
+			AllowRefresh:       true,
+			MaxRefreshCount:    10,
+			MaxSessionLifetime: lifetime,
+			Clock:              clock,
+		}).(*jwtService)
+	}
+
+	// signClaims 使用服务密钥签发自定义Claims的Token
+	signClaims := func(service *jwtService, claims *JWTClaims) string {
+		token, err := jwt.NewWithClaims(service.signingMethod, claims).SignedString(service.secretKey)
+		assert.NoError(t, err)
+		return token
+	}
+
+	t.Run("多次刷新保留首次签发时间，超过有效期后拒绝刷新", func(t *testing.T) {
+		service := newService(2 * time.Second)
+
+		token, err := service.GenerateToken(123)
+		assert.NoError(t, err)
+		first, err := service.ParseToken(token)
+		assert.NoError(t, err)
+		assert.NotNil(t, first.OriginalIssuedAt)
+
+		for i := 0; i < 3; i++ {
+			token, err = service.RefreshToken(token)
+			assert.NoError(t, err)
+
+			claims, err := service.ParseToken(token)
+			assert.NoError(t, err)
+			assert.Equal(t, first.OriginalIssuedAt.Unix(), claims.OriginalIssuedAt.Unix())
+		}
+
+		clock.Advance(2100 * time.Millisecond)
+
+		_, err = service.RefreshToken(token)
+		assert.ErrorIs(t, err, ErrSessionLifetimeExceeded)
+
+		// Token本身未过期，但会话已超过有效期
+		_, err = service.ValidateToken(token)
+		assert.ErrorIs(t, err, ErrSessionLifetimeExceeded)
+		_, err = service.ParseToken(token)
+		assert.NoError(t, err)
+
+		// 重新登录后开始新会话
+		token, err = service.GenerateToken(123)
+		assert.NoError(t, err)
+		_, err = service.RefreshToken(token)
+		assert.NoError(t, err)
+	})
+
+	t.Run("零值不限制会话有效期", func(t *testing.T) {
+		service := newService(0)
+		now := clock.Now()
+
+		token := signClaims(service, &JWTClaims{
+			UserID:           123,
+			JTI:              service.GenerateJTI(),
+			OriginalIssuedAt: jwt.NewNumericDate(now.Add(-365 * 24 * time.Hour)),
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+				IssuedAt:  jwt.NewNumericDate(now),
+			},
+		})
+
+		_, err := service.ValidateToken(token)
+		assert.NoError(t, err)
+		_, err = service.RefreshToken(token)
+		assert.NoError(t, err)
+	})
+
+	t.Run("未携带首次签发时间的旧Token按签发时间计算", func(t *testing.T) {
+		service := newService(time.Hour)
+		now := clock.Now()
+
+		legacy := signClaims(service, &JWTClaims{
+			UserID: 123,
+			JTI:    service.GenerateJTI(),
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+				IssuedAt:  jwt.NewNumericDate(now.Add(-2 * time.Hour)),
+			},
+		})
+		_, err := service.ValidateToken(legacy)
+		assert.ErrorIs(t, err, ErrSessionLifetimeExceeded)
+		_, err = service.RefreshToken(legacy)
+		assert.ErrorIs(t, err, ErrSessionLifetimeExceeded)
+
+		recent := signClaims(service, &JWTClaims{
+			UserID: 123,
+			JTI:    service.GenerateJTI(),
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+				IssuedAt:  jwt.NewNumericDate(now.Add(-time.Minute)),
+			},
+		})
+		refreshed, err := service.RefreshToken(recent)
+		assert.NoError(t, err)
+		claims, err := service.ParseToken(refreshed)
+		assert.NoError(t, err)
+		assert.Equal(t, now.Add(-time.Minute).Unix(), claims.OriginalIssuedAt.Unix())
+	})
+}
+
+func BenchmarkJWTServiceRefreshToken(b *testing.B) {
+	config := &JWTConfig{
+		SecretKey:         "test-secret-key",
+		DefaultExpiration: time.Hour,
+		RefreshExpiration: time.Hour,
+		Issuer:            "test-issuer",
+		AllowRefresh:      true,
+		MaxRefreshCount:   b.N + 1,
+	}
+	service := NewJWTService(config).(*jwtService)
+
+	token, err := service.GenerateToken(123)
+	if err != nil {
+		b.Fatalf("生成Token失败: %v", err)
+	}
+
+	b.ResetTimer()
+	service.parseCount.Store(0)
+	for i := 0; i < b.N; i++ {
+		token, err = service.RefreshToken(token)
+		if err != nil {
+			b.Fatalf("刷新Token失败: %v", err)
+		}
+	}
+
+	// 每次刷新应只验证一次签名
+	b.ReportMetric(float64(service.parseCount.Load())/float64(b.N), "parses/op")
+}
+
+func TestJWTSecretRotation(t *testing.T) {
+	oldConfig := DefaultJWTConfig()
+	oldConfig.SecretKey = "old-secret-key"
+	oldService := NewJWTService(oldConfig)
+
+	rotatedConfig := DefaultJWTConfig()
+	rotatedConfig.SecretKey = "new-secret-key"
+	rotatedConfig.PreviousSecretKeys = [][]byte{[]byte("old-secret-key")}
+	rotatedService := NewJWTService(rotatedConfig)
+
+	t.Run("轮换前签发的Token在过期前仍可验证", func(t *testing.T) {
+		token, err := oldService.GenerateToken(123)
+		assert.NoError(t, err)
+
+		claims, err := rotatedService.ParseToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, uint(123), claims.UserID)
+
+		userID, err := rotatedService.ValidateToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, uint(123), userID)
+
+		// 轮换前的Token同样可以撤销
+		assert.NoError(t, rotatedService.RevokeToken(token))
+		_, err = rotatedService.ValidateToken(token)
+		assert.Error(t, err)
+	})
+
+	t.Run("新Token只使用当前密钥签名", func(t *testing.T) {
+		token, err := rotatedService.GenerateToken(123)
+		assert.NoError(t, err)
+
+		_, err = oldService.ParseToken(token)
+		assert.Error(t, err)
+
+		currentOnly := DefaultJWTConfig()
+		currentOnly.SecretKey = "new-secret-key"
+		_, err = NewJWTService(currentOnly).ParseToken(token)
+		assert.NoError(t, err)
+	})
+
+	t.Run("未配置的密钥签名的Token无效", func(t *testing.T) {
+		unknownConfig := DefaultJWTConfig()
+		unknownConfig.SecretKey = "unknown-secret-key"
+		token, err := NewJWTService(unknownConfig).GenerateToken(123)
+		assert.NoError(t, err)
+
+		_, err = rotatedService.ParseToken(token)
+		assert.Error(t, err)
+	})
+
+	t.Run("移除旧密钥后轮换前的Token失效", func(t *testing.T) {
+		token, err := oldService.GenerateToken(123)
+		assert.NoError(t, err)
+
+		retiredConfig := DefaultJWTConfig()
+		retiredConfig.SecretKey = "new-secret-key"
+		_, err = NewJWTService(retiredConfig).ParseToken(token)
+		assert.Error(t, err)
+	})
+
+	t.Run("旧密钥不能绕过签名算法校验", func(t *testing.T) {
+		hs512Config := DefaultJWTConfig()
+		hs512Config.SecretKey = "old-secret-key"
+		hs512Config.SigningMethod = "HS512"
+		token, err := NewJWTService(hs512Config).GenerateToken(123)
+		assert.NoError(t, err)
+
+		_, err = rotatedService.ParseToken(token)
+		assert.Error(t, err)
+	})
+}
+
+func TestJWTCustomClaims(t *testing.T) {
+	clock := NewFakeClock(time.Time{})
+	service := NewJWTService(&JWTConfig{
+		SecretKey:         "test-secret-key",
+		DefaultExpiration: time.Hour,
+		RefreshExpiration: time.Hour, // 任何时候都可以刷新
+		Issuer:            "test-issuer",
+		AllowRefresh:      true,
+		MaxRefreshCount:   10,
+		Clock:             clock,
+	})
+
+	t.Run("自定义声明可以解析回来", func(t *testing.T) {
+		extra := map[string]interface{}{
+			"tenant_id": 42,
+			"roles":     []string{"admin", "editor"},
+			"region":    "cn-east",
+		}
+		token, err := service.GenerateTokenWithClaims(7, extra, 30*time.Minute)
+		assert.NoError(t, err)
+
+		claims, err := service.ParseToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, uint(7), claims.UserID)
+		assert.Equal(t, "test-issuer", claims.Issuer)
+		assert.Equal(t, clock.Now().Add(30*time.Minute).Unix(), claims.ExpiresAt.Unix())
+		assert.Equal(t, map[string]interface{}{
+			"tenant_id": float64(42),
+			"roles":     []interface{}{"admin", "editor"},
+			"region":    "cn-east",
+		}, claims.Extra)
+
+		// 自定义声明与固定声明平铺在同一层
+		payload, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+		assert.NoError(t, err)
+		assert.Equal(t, "cn-east", payload.Claims.(jwt.MapClaims)["region"])
+
+		// 签发后修改调用方的map不影响Token
+		extra["region"] = "changed"
+		claims, _ = service.ParseToken(token)
+		assert.Equal(t, "cn-east", claims.Extra["region"])
+	})
+
+	t.Run("不能覆盖保留的声明", func(t *testing.T) {
+		for _, name := range []string{"exp", "iss", "jti", "user_id", "sub"} {
+			_, err := service.GenerateTokenWithClaims(7, map[string]interface{}{name: "forged"}, time.Hour)
+			assert.ErrorIs(t, err, ErrReservedClaim, name)
+			assert.Equal(t, "invalid_argument", CodeOf(err))
+		}
+	})
+
+	t.Run("没有自定义声明时Extra为nil", func(t *testing.T) {
+		token, err := service.GenerateTokenWithClaims(7, nil, time.Hour)
+		assert.NoError(t, err)
+		claims, err := service.ParseToken(token)
+		assert.NoError(t, err)
+		assert.Nil(t, claims.Extra)
+	})
+
+	t.Run("刷新时保留自定义声明", func(t *testing.T) {
+		token, err := service.GenerateTokenWithClaims(7, map[string]interface{}{"tenant_id": "t-1"}, time.Hour)
+		assert.NoError(t, err)
+
+		clock.Advance(time.Second)
+		refreshed, err := service.RefreshToken(token)
+		assert.NoError(t, err)
+		claims, err := service.ParseToken(refreshed)
+		assert.NoError(t, err)
+		assert.Equal(t, "t-1", claims.Extra["tenant_id"])
+	})
+}
+
+func TestJWTTokenBelongsToUser(t *testing.T) {
+	service := NewJWTService(&JWTConfig{
+		SecretKey:         "test-secret-key",
+		DefaultExpiration: time.Hour,
+		Issuer:            "test-issuer",
+	})
+
+	token, err := service.GenerateToken(7)
+	assert.NoError(t, err)
+
+	belongs, err := service.TokenBelongsToUser(token, 7)
+	assert.NoError(t, err)
+	assert.True(t, belongs)
+
+	belongs, err = service.TokenBelongsToUser(token, 8)
+	assert.NoError(t, err)
+	assert.False(t, belongs)
+
+	// 已撤销或无效的Token返回错误
+	assert.NoError(t, service.RevokeToken(token))
+	belongs, err = service.TokenBelongsToUser(token, 7)
+	assert.Error(t, err)
+	assert.False(t, belongs)
+
+	_, err = service.TokenBelongsToUser("not-a-token", 7)
+	assert.Error(t, err)
+}
+
+func TestJWTValidateTokenFull(t *testing.T) {
+	// JWT时间声明精确到秒
+	clock := NewFakeClock(time.Now().Truncate(time.Second))
+	service := NewJWTService(&JWTConfig{
+		SecretKey:         "test-secret-key",
+		DefaultExpiration: time.Hour,
+		Clock:             clock,
+	}).(*jwtService)
+
+	token, err := service.GenerateToken(7)
+	assert.NoError(t, err)
+
+	t.Run("返回用户ID和剩余有效时间", func(t *testing.T) {
+		clock.Advance(20 * time.Minute)
+		service.parseCount.Store(0)
+
+		userID, remaining, err := service.ValidateTokenFull(token)
+		assert.NoError(t, err)
+		assert.Equal(t, uint(7), userID)
+		assert.Equal(t, 40*time.Minute, remaining)
+		assert.Equal(t, int64(1), service.parseCount.Load(), "只验证一次签名")
+	})
+
+	t.Run("与ValidateToken拒绝相同的Token", func(t *testing.T) {
+		_, _, err := service.ValidateTokenFull("")
+		assert.Error(t, err)
+		_, _, err = service.ValidateTokenFull("not-a-token")
+		assert.Error(t, err)
+
+		revoked, err := service.GenerateToken(8)
+		assert.NoError(t, err)
+		assert.NoError(t, service.RevokeToken(revoked))
+		userID, remaining, err := service.ValidateTokenFull(revoked)
+		assert.Error(t, err)
+		assert.Zero(t, userID)
+		assert.Zero(t, remaining)
+
+		clock.Advance(time.Hour)
+		_, _, err = service.ValidateTokenFull(token)
+		assert.Error(t, err)
+	})
+}
+
+func TestJWTRevokeByJTI(t *testing.T) {
+	clock := NewFakeClock(time.Time{})
+	store := NewMemoryTokenRevocationStore(0, clock)
+	newService := func() *jwtService {
+		return NewJWTService(&JWTConfig{
+			SecretKey:         "test-secret-key",
+			DefaultExpiration: time.Hour,
+			Clock:             clock,
+			RevocationStore:   store,
+		}).(*jwtService)
+	}
+	service := newService()
+
+	t.Run("撤销本实例签发的Token", func(t *testing.T) {
+		token, claims, err := service.GenerateTokenDetailed(1)
+		assert.NoError(t, err)
+
+		assert.NoError(t, service.RevokeByJTI(claims.JTI))
+		_, err = service.ValidateToken(token)
+		assert.Equal(t, "Token已被撤销", err.Error())
+		assert.Empty(t, service.ListUserSessions(1))
+	})
+
+	t.Run("撤销其他实例签发的Token", func(t *testing.T) {
+		other := newService()
+		token, claims, err := other.GenerateTokenDetailed(2)
+		assert.NoError(t, err)
+
+		assert.NoError(t, service.RevokeByJTI(claims.JTI))
+		_, err = other.ValidateToken(token)
+		assert.Error(t, err)
+	})
+
+	t.Run("不缩短已有撤销记录的保留时间", func(t *testing.T) {
+		token, err := service.GenerateTokenWithExpiration(3, 24*time.Hour)
+		assert.NoError(t, err)
+		claims, err := service.ParseToken(token)
+		assert.NoError(t, err)
+		assert.NoError(t, service.RevokeToken(token))
+
+		assert.NoError(t, service.RevokeByJTI(claims.JTI))
+		clock.Advance(2 * time.Hour)
+		assert.NoError(t, service.CleanupExpiredTokens())
+		_, err = service.ValidateToken(token)
+		assert.Error(t, err)
+	})
+
+	t.Run("JTI不能为空", func(t *testing.T) {
+		assert.Error(t, service.RevokeByJTI(""))
+	})
+
+	t.Run("拒绝格式无效的JTI且不写入撤销记录", func(t *testing.T) {
+		isolated := NewMemoryTokenRevocationStore(0, clock)
+		other := NewJWTService(&JWTConfig{
+			SecretKey:         "test-secret-key",
+			DefaultExpiration: time.Hour,
+			Clock:             clock,
+			RevocationStore:   isolated,
+		}).(*jwtService)
+		for _, jti := range []string{
+			"not-a-jti",
+			strings.Repeat("a", 31),
+			strings.Repeat("a", 33),
+			strings.Repeat("A", 32),
+			strings.Repeat("a", DefaultMaxTokenLength+1),
+		} {
+			assert.ErrorIs(t, other.RevokeByJTI(jti), ErrInvalidJTI)
+			revoked, err := isolated.IsRevoked(jti)
+			assert.NoError(t, err)
+			assert.False(t, revoked)
+		}
+		assert.NoError(t, other.RevokeByJTI(strings.Repeat("a", 32)))
+	})
+
+	t.Run("验证时只解析一次Token", func(t *testing.T) {
+		token, err := service.GenerateToken(4)
+		assert.NoError(t, err)
+
+		service.parseCount.Store(0)
+		_, err = service.ValidateToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), service.parseCount.Load())
+	})
 }
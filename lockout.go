@@ -0,0 +1,501 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 账户锁定错误定义
+var (
+	ErrAccountLocked          = errors.New("连续密码错误次数过多，账户已锁定")
+	ErrSelfUnlockNotEnabled   = errors.New("未启用自助解锁")
+	ErrUnlockRequestThrottled = errors.New("解锁验证码请求过于频繁，请稍后再试")
+	ErrLoginIPLocked          = errors.New("该IP登录失败次数过多，请稍后再试")
+)
+
+// VerificationPurposeAccountUnlock 自助解锁验证码的用途
+const VerificationPurposeAccountUnlock = "account_unlock"
+
+// LockoutMode 账户锁定后的解锁方式
+type LockoutMode string
+
+// 账户解锁方式
+const (
+	LockoutHard        LockoutMode = "hard"         // 只能由管理员解锁
+	LockoutSelfService LockoutMode = "self_service" // 用户可通过邮箱验证码自助解锁，管理员同样可以解锁
+)
+
+// indefiniteLockUntil 未配置锁定时长时使用的锁定截止时间，即直到解锁
+var indefiniteLockUntil = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// AccountLockoutConfig 账户锁定配置，自助解锁需同时配置 AuthConfig.VerificationCodes 和 AuthConfig.Mailer
+type AccountLockoutConfig struct {
+	MaxFailedAttempts int           // 连续密码错误达到该次数后锁定
+	FailureWindow     time.Duration // 距上一次密码错误超过该时长后重新计数；0表示只在登录成功或解锁后清零
+	LockDuration      time.Duration // 锁定时长，到期后自动解锁；0表示直到解锁
+	Mode              LockoutMode   // 解锁方式
+	UnlockCodeTTL     time.Duration // 解锁验证码有效期
+	UnlockCodeDigits  int           // 解锁验证码位数
+	// 每个用户名在UnlockRequestWindow内最多请求解锁验证码的次数，0表示不限制
+	UnlockRequestLimit  int
+	UnlockRequestWindow time.Duration
+	// 不存在的用户名没有用户记录可写，其密码错误记录在该存储中，使锁定行为与真实账户一致，避免据此探测用户名；
+	// 为nil时创建认证服务时使用进程内的MemoryLockoutStore，多实例部署时可换成共享存储
+	Store LockoutStore
+	// 同一IP在FailureWindow内登录失败（无论用户名是否存在）达到该次数后，IPLockDuration内拒绝该IP的所有登录；
+	// 0表示不按IP限制。登录成功不清除IP的失败记录，避免攻击者用自己的账户重置计数
+	MaxFailedAttemptsPerIP int
+	IPLockDuration         time.Duration // 按IP锁定的时长，0表示15分钟
+	// 按IP的失败记录，为nil时创建认证服务时使用进程内的MemoryLockoutStore
+	IPStore LockoutStore
+}
+
+// defaultIPLockDuration 未配置IPLockDuration时按IP锁定的时长，IP锁定不能是永久的
+const defaultIPLockDuration = 15 * time.Minute
+
+// DefaultAccountLockoutConfig 默认账户锁定配置：一小时内连续5次密码错误后锁定，直到通过邮箱验证码或管理员解锁
+func DefaultAccountLockoutConfig() *AccountLockoutConfig {
+	return &AccountLockoutConfig{
+		MaxFailedAttempts:   5,
+		FailureWindow:       time.Hour,
+		Mode:                LockoutSelfService,
+		UnlockCodeTTL:       15 * time.Minute,
+		UnlockCodeDigits:    6,
+		UnlockRequestLimit:  3,
+		UnlockRequestWindow: time.Hour,
+	}
+}
+
+// LockoutStore 按键记录密码错误次数和锁定状态的存储
+type LockoutStore interface {
+	// 记录一次失败，返回窗口内的失败次数
+	RecordFailure(key string) int
+	// 清除失败记录和锁定状态
+	Reset(key string)
+	// 检查是否处于锁定期，返回剩余锁定时长；锁定直到Reset时剩余时长为0。
+	// 共享存储不可用时返回错误，调用方按锁定处理，不会放行
+	IsLocked(key string) (bool, time.Duration, error)
+}
+
+// lockoutEntry 单个键的失败时间和锁定截止时间
+type lockoutEntry struct {
+	failures    []time.Time
+	lockedUntil time.Time
+}
+
+// lockoutSweepInterval 每记录多少次失败清理一次过期的键
+const lockoutSweepInterval = 1024
+
+// MemoryLockoutStore 内存锁定存储，使用互斥锁保证并发登录下计数准确，只适用于单实例部署
+type MemoryLockoutStore struct {
+	maxFailures  int
+	window       time.Duration
+	lockDuration time.Duration
+	clock        Clock
+	entries      map[string]*lockoutEntry
+	records      int
+	mutex        sync.Mutex
+}
+
+// NewMemoryLockoutStore 按锁定配置创建内存锁定存储，clock为nil时使用系统时间
+//
+// 窗口内失败次数达到MaxFailedAttempts时锁定LockDuration；FailureWindow为0时失败记录只在Reset时清除，
+// LockDuration为0时锁定直到Reset。
+func NewMemoryLockoutStore(config *AccountLockoutConfig, clock Clock) *MemoryLockoutStore {
+	if config == nil {
+		config = DefaultAccountLockoutConfig()
+	}
+
+	return &MemoryLockoutStore{
+		maxFailures:  config.MaxFailedAttempts,
+		window:       config.FailureWindow,
+		lockDuration: config.LockDuration,
+		clock:        clockOrDefault(clock),
+		entries:      make(map[string]*lockoutEntry),
+	}
+}
+
+// RecordFailure 记录一次失败，返回窗口内的失败次数，达到上限时锁定
+func (s *MemoryLockoutStore) RecordFailure(key string) int {
+	now := s.clock.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.records++
+	if s.records%lockoutSweepInterval == 0 {
+		s.sweep(now)
+	}
+
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &lockoutEntry{}
+		s.entries[key] = entry
+	}
+
+	// 上一次锁定已到期，重新计数
+	if !entry.lockedUntil.IsZero() && !now.Before(entry.lockedUntil) {
+		entry.failures = entry.failures[:0]
+		entry.lockedUntil = time.Time{}
+	}
+	entry.failures = append(s.activeFailures(entry, now), now)
+
+	count := len(entry.failures)
+	if s.maxFailures > 0 && count >= s.maxFailures && entry.lockedUntil.IsZero() {
+		entry.lockedUntil = indefiniteLockUntil
+		if s.lockDuration > 0 {
+			entry.lockedUntil = now.Add(s.lockDuration)
+		}
+	}
+	return count
+}
+
+// Reset 清除失败记录和锁定状态
+func (s *MemoryLockoutStore) Reset(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.entries, key)
+}
+
+// IsLocked 检查是否处于锁定期，返回剩余锁定时长，内存存储不会返回错误
+func (s *MemoryLockoutStore) IsLocked(key string) (bool, time.Duration, error) {
+	now := s.clock.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok || entry.lockedUntil.IsZero() || !now.Before(entry.lockedUntil) {
+		return false, 0, nil
+	}
+	if entry.lockedUntil.Equal(indefiniteLockUntil) {
+		return true, 0, nil
+	}
+	return true, entry.lockedUntil.Sub(now), nil
+}
+
+// activeFailures 去除窗口外的失败记录，调用方需持有锁
+func (s *MemoryLockoutStore) activeFailures(entry *lockoutEntry, now time.Time) []time.Time {
+	if s.window <= 0 {
+		return entry.failures
+	}
+
+	cutoff := now.Add(-s.window)
+	active := entry.failures[:0]
+	for _, failure := range entry.failures {
+		if failure.After(cutoff) {
+			active = append(active, failure)
+		}
+	}
+	return active
+}
+
+// sweep 删除未锁定且没有窗口内失败记录的键，调用方需持有锁
+func (s *MemoryLockoutStore) sweep(now time.Time) {
+	for key, entry := range s.entries {
+		if !entry.lockedUntil.IsZero() {
+			if !now.Before(entry.lockedUntil) {
+				delete(s.entries, key)
+			}
+			continue
+		}
+		if entry.failures = s.activeFailures(entry, now); len(entry.failures) == 0 {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// checkAccountLock 检查账户是否处于锁定期，锁定期内即使密码正确也拒绝登录
+func checkAccountLock(config *AuthConfig, user *User) error {
+	if config.AccountLockout == nil || !user.IsLocked(config.now()) {
+		return nil
+	}
+	return ErrAccountLocked
+}
+
+// recordFailedLogin 记录一次密码错误，达到上限时锁定账户并记录审计事件
+func recordFailedLogin(db *gorm.DB, config *AuthConfig, user *User) error {
+	lockout := config.AccountLockout
+	if lockout == nil || lockout.MaxFailedAttempts <= 0 {
+		return nil
+	}
+
+	now := config.now()
+	users := func() *gorm.DB {
+		return db.Model(&User{}).Where("id = ?", user.ID)
+	}
+
+	// 上一次锁定已到期，重新计数
+	if user.LockedUntil != nil && !user.IsLocked(now) {
+		if err := users().UpdateColumns(map[string]interface{}{
+			"failed_login_attempts": 0,
+			"locked_until":          nil,
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	// 在数据库中累加，并发的错误尝试不会相互覆盖；距上一次错误超过FailureWindow时从1重新计数。
+	// GORM按列名排序生成SET子句，计数列在前，MySQL按顺序赋值时CASE读取的仍是上一次错误的时间
+	attemptsExpr := gorm.Expr("failed_login_attempts + 1")
+	if lockout.FailureWindow > 0 {
+		attemptsExpr = gorm.Expr("CASE WHEN last_failed_login_at IS NULL OR last_failed_login_at < ? THEN 1 ELSE failed_login_attempts + 1 END",
+			now.Add(-lockout.FailureWindow))
+	}
+	if err := users().UpdateColumns(map[string]interface{}{
+		"failed_login_attempts": attemptsExpr,
+		"last_failed_login_at":  now,
+	}).Error; err != nil {
+		return err
+	}
+	var attempts []int
+	if err := users().Pluck("failed_login_attempts", &attempts).Error; err != nil {
+		return err
+	}
+	if len(attempts) == 0 || attempts[0] < lockout.MaxFailedAttempts {
+		return nil
+	}
+
+	lockedUntil := indefiniteLockUntil
+	if lockout.LockDuration > 0 {
+		lockedUntil = now.Add(lockout.LockDuration)
+	}
+	if err := users().UpdateColumn("locked_until", lockedUntil).Error; err != nil {
+		return err
+	}
+
+	return config.AuditLogger.Log(AuditEvent{
+		Type:      AuditEventAccountLocked,
+		UserID:    user.ID,
+		Detail:    fmt.Sprintf("failed_attempts=%d mode=%s", attempts[0], lockout.Mode),
+		CreatedAt: now,
+	})
+}
+
+// unknownUserLockoutKey 不存在的用户名在锁定存储中的键
+func unknownUserLockoutKey(username string) string {
+	return "login:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+// recordUnknownUserFailure 记录对不存在用户名的登录失败，已锁定时返回ErrAccountLocked
+//
+// 与真实账户相同：达到上限的那次失败仍返回密码错误，之后的尝试返回账户已锁定。
+func recordUnknownUserFailure(config *AuthConfig, username string) error {
+	lockout := config.AccountLockout
+	if lockout == nil || lockout.Store == nil || lockout.MaxFailedAttempts <= 0 {
+		return nil
+	}
+
+	key := unknownUserLockoutKey(username)
+	locked, _, err := lockout.Store.IsLocked(key)
+	if err != nil {
+		return fmt.Errorf("检查锁定状态失败: %w", err)
+	}
+	if locked {
+		return ErrAccountLocked
+	}
+	lockout.Store.RecordFailure(key)
+	return nil
+}
+
+// newIPLockoutStore 按IP限制的配置创建内存锁定存储
+func newIPLockoutStore(config *AccountLockoutConfig, clock Clock) *MemoryLockoutStore {
+	lockDuration := config.IPLockDuration
+	if lockDuration <= 0 {
+		lockDuration = defaultIPLockDuration
+	}
+	return NewMemoryLockoutStore(&AccountLockoutConfig{
+		MaxFailedAttempts: config.MaxFailedAttemptsPerIP,
+		FailureWindow:     config.FailureWindow,
+		LockDuration:      lockDuration,
+	}, clock)
+}
+
+// ipLockoutKey IP在锁定存储中的键
+func ipLockoutKey(ip string) string {
+	return "ip:" + ip
+}
+
+// checkIPLock 检查客户端IP是否因登录失败过多被锁定，未启用或IP未知时不检查；存储出错时返回错误，拒绝本次登录
+func checkIPLock(config *AuthConfig, ip string) error {
+	lockout := config.AccountLockout
+	if lockout == nil || lockout.IPStore == nil || lockout.MaxFailedAttemptsPerIP <= 0 || ip == "" {
+		return nil
+	}
+	locked, _, err := lockout.IPStore.IsLocked(ipLockoutKey(ip))
+	if err != nil {
+		return fmt.Errorf("检查IP锁定状态失败: %w", err)
+	}
+	if locked {
+		return ErrLoginIPLocked
+	}
+	return nil
+}
+
+// recordIPFailure 记录客户端IP的一次登录失败
+func recordIPFailure(config *AuthConfig, ip string) {
+	lockout := config.AccountLockout
+	if lockout == nil || lockout.IPStore == nil || lockout.MaxFailedAttemptsPerIP <= 0 || ip == "" {
+		return
+	}
+	lockout.IPStore.RecordFailure(ipLockoutKey(ip))
+}
+
+// activeFailedAttempts 计入锁定的连续密码错误次数，与recordFailedLogin的重新计数规则一致
+func activeFailedAttempts(config *AuthConfig, user *User) int {
+	now := config.now()
+	if user.IsLocked(now) {
+		return user.FailedLoginAttempts
+	}
+	// 锁定已到期，下一次错误重新计数
+	if user.LockedUntil != nil {
+		return 0
+	}
+	if lockout := config.AccountLockout; lockout != nil && lockout.FailureWindow > 0 &&
+		(user.LastFailedLoginAt == nil || user.LastFailedLoginAt.Before(now.Add(-lockout.FailureWindow))) {
+		return 0
+	}
+	return user.FailedLoginAttempts
+}
+
+// GetFailedAttempts 获取用户当前计入锁定的连续密码错误次数，超出失败窗口或锁定已到期的错误不计入
+//
+// 直接读取数据库，不受用户缓存影响。
+func (s *authService) GetFailedAttempts(userID uint) (int, error) {
+	var user User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return 0, wrapNotFound(err, ErrUserNotFound)
+	}
+	return activeFailedAttempts(s.config, &user), nil
+}
+
+// clearFailedLogins 登录成功后清除密码错误计数
+func clearFailedLogins(db *gorm.DB, config *AuthConfig, user *User) error {
+	if config.AccountLockout == nil || (user.FailedLoginAttempts == 0 && user.LockedUntil == nil) {
+		return nil
+	}
+	return resetAccountLock(db, user.ID)
+}
+
+// resetAccountLock 清除密码错误计数和锁定状态
+func resetAccountLock(db *gorm.DB, userID uint) error {
+	return db.Model(&User{}).Where("id = ?", userID).UpdateColumns(map[string]interface{}{
+		"failed_login_attempts": 0,
+		"locked_until":          nil,
+	}).Error
+}
+
+// RequestUnlockCode 向锁定账户的邮箱发送自助解锁验证码
+//
+// 为防止通过该接口探测用户名，用户不存在或未锁定时同样返回nil，且都计入限流次数；
+// 新验证码替换之前的验证码，邮件异步发送，失败只记录日志。
+func (s *authService) RequestUnlockCode(username string) error {
+	if err := s.checkSelfUnlockEnabled(); err != nil {
+		return err
+	}
+	if err := s.throttleUnlockRequest(username); err != nil {
+		return err
+	}
+
+	user, err := s.userService.GetUserByUsername(username)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !user.IsLocked(s.config.now()) {
+		return nil
+	}
+
+	go func() {
+		lockout := s.config.AccountLockout
+		code, err := s.config.VerificationCodes.Issue(user.ID, VerificationPurposeAccountUnlock, lockout.UnlockCodeTTL, lockout.UnlockCodeDigits)
+		if err != nil {
+			log.Printf("发送解锁验证码失败: user_id=%d err=%v", user.ID, err)
+			return
+		}
+
+		message := MailMessage{To: user.Email, Template: MailTemplateAccountUnlock, Data: map[string]string{"code": code}}
+		if err := s.config.Mailer.Send(message); err != nil {
+			log.Printf("发送解锁验证码失败: user_id=%d err=%v", user.ID, err)
+		}
+	}()
+	return nil
+}
+
+// UnlockWithCode 验证解锁验证码，清除密码错误计数和锁定状态
+func (s *authService) UnlockWithCode(username, code string) error {
+	if err := s.checkSelfUnlockEnabled(); err != nil {
+		return err
+	}
+
+	user, err := s.userService.GetUserByUsername(username)
+	if errors.Is(err, ErrUserNotFound) {
+		return ErrVerificationCodeNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.config.VerificationCodes.Verify(user.ID, VerificationPurposeAccountUnlock, code); err != nil {
+		return err
+	}
+	return s.unlockAccount(user.ID, "email_code")
+}
+
+// UnlockUser 管理员直接解锁账户，任何锁定模式下都可用
+func (s *authService) UnlockUser(userID uint) error {
+	if _, err := s.userService.GetUserByID(userID); err != nil {
+		return err
+	}
+	return s.unlockAccount(userID, "admin")
+}
+
+// unlockAccount 解锁账户并记录审计事件
+func (s *authService) unlockAccount(userID uint, method string) error {
+	if err := resetAccountLock(s.db, userID); err != nil {
+		return err
+	}
+
+	return s.config.AuditLogger.Log(AuditEvent{
+		Type:      AuditEventAccountUnlocked,
+		UserID:    userID,
+		Detail:    "method=" + method,
+		CreatedAt: s.config.now(),
+	})
+}
+
+// checkSelfUnlockEnabled 检查是否启用了自助解锁
+func (s *authService) checkSelfUnlockEnabled() error {
+	lockout := s.config.AccountLockout
+	if lockout == nil || lockout.Mode != LockoutSelfService || s.config.VerificationCodes == nil || s.config.Mailer == nil {
+		return ErrSelfUnlockNotEnabled
+	}
+	return nil
+}
+
+// throttleUnlockRequest 按用户名限制解锁验证码请求次数，未配置限流存储时不限制
+func (s *authService) throttleUnlockRequest(username string) error {
+	lockout := s.config.AccountLockout
+	if s.config.RateLimitStore == nil || lockout.UnlockRequestLimit <= 0 {
+		return nil
+	}
+
+	key := "unlock_request:" + strings.ToLower(strings.TrimSpace(username))
+	count, err := s.config.RateLimitStore.Increment(key, lockout.UnlockRequestWindow)
+	if err != nil {
+		return err
+	}
+	if count > lockout.UnlockRequestLimit {
+		return ErrUnlockRequestThrottled
+	}
+	return nil
+}
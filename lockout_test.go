@@ -0,0 +1,483 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccountLockout(t *testing.T) {
+	// 设置测试数据库
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	password := "testpassword123"
+
+	// newService 创建启用账户锁定的认证服务
+	newService := func(mode LockoutMode, mailer *CaptureMailer, auditLogger AuditLogger) AuthService {
+		config := DefaultAuthConfig()
+		config.AccountLockout = DefaultAccountLockoutConfig()
+		config.AccountLockout.MaxFailedAttempts = 3
+		config.AccountLockout.Mode = mode
+		config.AccountLockout.UnlockRequestLimit = 2
+		config.Mailer = mailer
+		config.VerificationCodes = NewVerificationCodeService(NewMemoryVerificationCodeStorage(), nil)
+		config.RateLimitStore = NewMemoryRateLimitStore()
+		config.AuditLogger = auditLogger
+		userService := NewUserService(testDB.DB)
+		tokenService := NewTokenService("test-secret-key", time.Hour)
+		return NewAuthServiceWithConfig(testDB.DB, userService, tokenService, config)
+	}
+
+	// lock 连续输错密码直到账户锁定
+	lock := func(t *testing.T, service AuthService) {
+		for i := 0; i < 3; i++ {
+			_, _, err := service.Login("testuser", "wrongpassword")
+			assert.Error(t, err)
+		}
+		_, _, err := service.Login("testuser", password)
+		assert.True(t, errors.Is(err, ErrAccountLocked))
+	}
+
+	// waitForCode 等待第n封解锁邮件并返回其中的验证码
+	waitForCode := func(t *testing.T, mailer *CaptureMailer, n int) string {
+		assert.Eventually(t, func() bool { return len(mailer.Messages()) == n }, time.Second, 10*time.Millisecond)
+		message := mailer.Messages()[n-1]
+		assert.Equal(t, MailTemplateAccountUnlock, message.Template)
+		return message.Data["code"]
+	}
+
+	t.Run("锁定后通过邮箱验证码自助解锁并登录", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		mailer := NewCaptureMailer()
+		auditLogger := NewMemoryAuditLogger()
+		service := newService(LockoutSelfService, mailer, auditLogger)
+		user := testDB.CreateTestUser("testuser", "test@example.com", password)
+
+		lock(t, service)
+
+		assert.NoError(t, service.RequestUnlockCode("testuser"))
+		code := waitForCode(t, mailer, 1)
+		assert.Equal(t, "test@example.com", mailer.Messages()[0].To)
+
+		assert.NoError(t, service.UnlockWithCode("testuser", code))
+
+		var saved User
+		assert.NoError(t, testDB.DB.First(&saved, user.ID).Error)
+		assert.Zero(t, saved.FailedLoginAttempts)
+		assert.Nil(t, saved.LockedUntil)
+
+		_, token, err := service.Login("testuser", password)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, token)
+
+		var types []string
+		for _, event := range auditLogger.Events() {
+			types = append(types, event.Type)
+		}
+		assert.Equal(t, []string{AuditEventAccountLocked, AuditEventAccountUnlocked}, types)
+		assert.Equal(t, "method=email_code", auditLogger.Events()[1].Detail)
+	})
+
+	t.Run("错误、已使用或其他用户的验证码不能解锁", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		mailer := NewCaptureMailer()
+		service := newService(LockoutSelfService, mailer, nil)
+		testDB.CreateTestUser("testuser", "test@example.com", password)
+		testDB.CreateTestUser("otheruser", "other@example.com", password)
+
+		lock(t, service)
+		assert.NoError(t, service.RequestUnlockCode("testuser"))
+		code := waitForCode(t, mailer, 1)
+
+		wrong := "000000"
+		if code == wrong {
+			wrong = "111111"
+		}
+		assert.True(t, errors.Is(service.UnlockWithCode("testuser", wrong), ErrVerificationCodeInvalid))
+		assert.Error(t, service.UnlockWithCode("otheruser", code))
+		assert.True(t, errors.Is(service.UnlockWithCode("nonexistent", code), ErrVerificationCodeNotFound))
+
+		// 仍处于锁定状态
+		_, _, err := service.Login("testuser", password)
+		assert.True(t, errors.Is(err, ErrAccountLocked))
+
+		assert.NoError(t, service.UnlockWithCode("testuser", code))
+		assert.True(t, errors.Is(service.UnlockWithCode("testuser", code), ErrVerificationCodeNotFound))
+	})
+
+	t.Run("不存在或未锁定的用户静默返回并计入限流", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		mailer := NewCaptureMailer()
+		service := newService(LockoutSelfService, mailer, nil)
+		testDB.CreateTestUser("testuser", "test@example.com", password)
+
+		assert.NoError(t, service.RequestUnlockCode("nonexistent"))
+		assert.NoError(t, service.RequestUnlockCode("testuser"))
+		assert.NoError(t, service.RequestUnlockCode("TestUser"))
+		assert.True(t, errors.Is(service.RequestUnlockCode("testuser"), ErrUnlockRequestThrottled))
+
+		time.Sleep(50 * time.Millisecond)
+		assert.Empty(t, mailer.Messages())
+	})
+
+	t.Run("硬锁定只能由管理员解锁", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		auditLogger := NewMemoryAuditLogger()
+		service := newService(LockoutHard, NewCaptureMailer(), auditLogger)
+		user := testDB.CreateTestUser("testuser", "test@example.com", password)
+
+		lock(t, service)
+		assert.True(t, errors.Is(service.RequestUnlockCode("testuser"), ErrSelfUnlockNotEnabled))
+		assert.True(t, errors.Is(service.UnlockWithCode("testuser", "123456"), ErrSelfUnlockNotEnabled))
+
+		assert.NoError(t, service.UnlockUser(user.ID))
+		_, _, err := service.Login("testuser", password)
+		assert.NoError(t, err)
+
+		events := auditLogger.Events()
+		assert.Equal(t, "method=admin", events[len(events)-1].Detail)
+	})
+
+	t.Run("登录成功清除失败计数，锁定到期后重新计数", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		service := newService(LockoutSelfService, NewCaptureMailer(), nil)
+		user := testDB.CreateTestUser("testuser", "test@example.com", password)
+
+		for i := 0; i < 2; i++ {
+			service.Login("testuser", "wrongpassword")
+		}
+		_, _, err := service.Login("testuser", password)
+		assert.NoError(t, err)
+
+		var saved User
+		assert.NoError(t, testDB.DB.First(&saved, user.ID).Error)
+		assert.Zero(t, saved.FailedLoginAttempts)
+
+		// 模拟已到期的锁定
+		expired := time.Now().Add(-time.Minute)
+		assert.NoError(t, testDB.DB.Model(&User{}).Where("id = ?", user.ID).UpdateColumns(map[string]interface{}{
+			"failed_login_attempts": 3,
+			"locked_until":          expired,
+		}).Error)
+
+		_, _, err = service.Login("testuser", "wrongpassword")
+		assert.False(t, errors.Is(err, ErrAccountLocked))
+		assert.NoError(t, testDB.DB.First(&saved, user.ID).Error)
+		assert.Equal(t, 1, saved.FailedLoginAttempts)
+		assert.Nil(t, saved.LockedUntil)
+	})
+
+	t.Run("间隔超过失败窗口的错误不会触发锁定", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		service := newService(LockoutHard, NewCaptureMailer(), nil)
+		user := testDB.CreateTestUser("testuser", "test@example.com", password)
+		window := DefaultAccountLockoutConfig().FailureWindow
+
+		// age 将最近一次错误的时间提前到窗口之外
+		age := func() {
+			assert.NoError(t, testDB.DB.Model(&User{}).Where("id = ?", user.ID).
+				UpdateColumn("last_failed_login_at", time.Now().Add(-window-time.Minute)).Error)
+		}
+
+		var saved User
+		for i := 0; i < 10; i++ {
+			_, _, err := service.Login("testuser", "wrongpassword")
+			assert.False(t, errors.Is(err, ErrAccountLocked))
+			assert.NoError(t, testDB.DB.First(&saved, user.ID).Error)
+			assert.Equal(t, 1, saved.FailedLoginAttempts)
+			assert.Nil(t, saved.LockedUntil)
+			age()
+		}
+		_, _, err := service.Login("testuser", password)
+		assert.NoError(t, err)
+
+		// 窗口内的错误照常累计
+		lock(t, service)
+	})
+
+	t.Run("失败窗口为0时错误一直累计", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		service := newService(LockoutHard, NewCaptureMailer(), nil)
+		service.(*authService).config.AccountLockout.FailureWindow = 0
+		user := testDB.CreateTestUser("testuser", "test@example.com", password)
+
+		for i := 0; i < 3; i++ {
+			service.Login("testuser", "wrongpassword")
+			assert.NoError(t, testDB.DB.Model(&User{}).Where("id = ?", user.ID).
+				UpdateColumn("last_failed_login_at", time.Now().Add(-24*time.Hour)).Error)
+		}
+		_, _, err := service.Login("testuser", password)
+		assert.True(t, errors.Is(err, ErrAccountLocked))
+	})
+
+	t.Run("查询计入锁定的失败次数", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		service := newService(LockoutHard, NewCaptureMailer(), nil)
+		user := testDB.CreateTestUser("testuser", "test@example.com", password)
+
+		for i := 1; i <= 3; i++ {
+			service.Login("testuser", "wrongpassword")
+			attempts, err := service.GetFailedAttempts(user.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, i, attempts)
+		}
+
+		assert.NoError(t, service.UnlockUser(user.ID))
+		attempts, err := service.GetFailedAttempts(user.ID)
+		assert.NoError(t, err)
+		assert.Zero(t, attempts)
+
+		_, err = service.GetFailedAttempts(user.ID + 1000)
+		assert.True(t, errors.Is(err, ErrUserNotFound))
+	})
+
+	t.Run("未配置时不锁定", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		userService := NewUserService(testDB.DB)
+		service := NewAuthService(testDB.DB, userService, NewTokenService("test-secret-key", time.Hour))
+		testDB.CreateTestUser("testuser", "test@example.com", password)
+
+		for i := 0; i < 10; i++ {
+			service.Login("testuser", "wrongpassword")
+		}
+		_, _, err := service.Login("testuser", password)
+		assert.NoError(t, err)
+		assert.True(t, errors.Is(service.RequestUnlockCode("testuser"), ErrSelfUnlockNotEnabled))
+	})
+}
+
+func TestMemoryLockoutStore(t *testing.T) {
+	newStore := func(window, lockDuration time.Duration) (*MemoryLockoutStore, *FakeClock) {
+		clock := NewFakeClock(time.Time{})
+		config := DefaultAccountLockoutConfig()
+		config.MaxFailedAttempts = 3
+		config.FailureWindow = window
+		config.LockDuration = lockDuration
+		return NewMemoryLockoutStore(config, clock), clock
+	}
+
+	t.Run("达到上限后锁定", func(t *testing.T) {
+		store, clock := newStore(time.Hour, 15*time.Minute)
+		assert.Equal(t, 1, store.RecordFailure("alice"))
+		assert.Equal(t, 2, store.RecordFailure("alice"))
+		locked, _, _ := store.IsLocked("alice")
+		assert.False(t, locked)
+
+		assert.Equal(t, 3, store.RecordFailure("alice"))
+		locked, remaining, _ := store.IsLocked("alice")
+		assert.True(t, locked)
+		assert.Equal(t, 15*time.Minute, remaining)
+
+		// 其他键不受影响
+		locked, _, _ = store.IsLocked("bob")
+		assert.False(t, locked)
+
+		// 锁定到期后自动解锁并重新计数
+		clock.Advance(15 * time.Minute)
+		locked, _, _ = store.IsLocked("alice")
+		assert.False(t, locked)
+		assert.Equal(t, 1, store.RecordFailure("alice"))
+	})
+
+	t.Run("窗口外的失败不计数", func(t *testing.T) {
+		store, clock := newStore(time.Hour, 0)
+		store.RecordFailure("alice")
+		store.RecordFailure("alice")
+		clock.Advance(time.Hour)
+		assert.Equal(t, 1, store.RecordFailure("alice"))
+	})
+
+	t.Run("未配置锁定时长时锁定直到重置", func(t *testing.T) {
+		store, clock := newStore(0, 0)
+		for i := 0; i < 3; i++ {
+			store.RecordFailure("alice")
+		}
+		clock.Advance(24 * 365 * time.Hour)
+		locked, remaining, _ := store.IsLocked("alice")
+		assert.True(t, locked)
+		assert.Zero(t, remaining)
+
+		store.Reset("alice")
+		locked, _, _ = store.IsLocked("alice")
+		assert.False(t, locked)
+		assert.Equal(t, 1, store.RecordFailure("alice"))
+	})
+
+	t.Run("清理过期的键", func(t *testing.T) {
+		store, clock := newStore(time.Minute, time.Minute)
+		for i := 0; i < lockoutSweepInterval-1; i++ {
+			store.RecordFailure(fmt.Sprintf("user%d", i))
+		}
+		clock.Advance(time.Minute)
+		store.RecordFailure("alice")
+		assert.Len(t, store.entries, 1)
+	})
+
+	// 使用 go test -race 运行以检查数据竞争
+	t.Run("并发记录同一个键", func(t *testing.T) {
+		clock := NewFakeClock(time.Time{})
+		config := DefaultAccountLockoutConfig()
+		config.MaxFailedAttempts = 1000
+		store := NewMemoryLockoutStore(config, clock)
+
+		const goroutines, perGoroutine = 50, 20
+		var wg sync.WaitGroup
+		for i := 0; i < goroutines; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < perGoroutine; j++ {
+					store.RecordFailure("alice")
+					store.IsLocked("alice")
+				}
+			}()
+		}
+		wg.Wait()
+
+		locked, _, _ := store.IsLocked("alice")
+		assert.True(t, locked)
+		assert.Equal(t, goroutines*perGoroutine+1, store.RecordFailure("alice"))
+	})
+}
+
+func TestUnknownUserLockout(t *testing.T) {
+	config := DefaultAuthConfig()
+	config.AccountLockout = DefaultAccountLockoutConfig()
+	config.AccountLockout.MaxFailedAttempts = 3
+	config.Clock = NewFakeClock(time.Time{})
+	service := NewAuthServiceWithConfig(nil, &stubUserService{err: ErrUserNotFound}, nil, config)
+	assert.IsType(t, &MemoryLockoutStore{}, config.AccountLockout.Store, "未配置存储时默认使用内存存储")
+
+	// 与真实账户一致：前3次返回密码错误，之后返回账户已锁定
+	for i := 0; i < 3; i++ {
+		_, _, err := service.Login("nobody", "wrong")
+		assert.True(t, errors.Is(err, ErrInvalidCredentials))
+	}
+	_, _, err := service.Login("Nobody ", "wrong")
+	assert.True(t, errors.Is(err, ErrAccountLocked))
+
+	// 未启用账户锁定时不记录
+	plain := NewAuthServiceWithConfig(nil, &stubUserService{err: ErrUserNotFound}, nil, nil)
+	for i := 0; i < 10; i++ {
+		_, _, err := plain.Login("nobody", "wrong")
+		assert.True(t, errors.Is(err, ErrInvalidCredentials))
+	}
+}
+
+func TestActiveFailedAttempts(t *testing.T) {
+	clock := NewFakeClock(time.Time{})
+	config := DefaultAuthConfig()
+	config.AccountLockout = DefaultAccountLockoutConfig()
+	config.Clock = clock
+	now := clock.Now()
+
+	recent := now.Add(-time.Minute)
+	stale := now.Add(-config.AccountLockout.FailureWindow - time.Minute)
+	future := now.Add(time.Hour)
+
+	assert.Equal(t, 2, activeFailedAttempts(config, &User{FailedLoginAttempts: 2, LastFailedLoginAt: &recent}))
+	assert.Zero(t, activeFailedAttempts(config, &User{FailedLoginAttempts: 2, LastFailedLoginAt: &stale}), "超出失败窗口")
+	assert.Zero(t, activeFailedAttempts(config, &User{FailedLoginAttempts: 5, LastFailedLoginAt: &recent, LockedUntil: &recent}), "锁定已到期")
+	assert.Equal(t, 5, activeFailedAttempts(config, &User{FailedLoginAttempts: 5, LastFailedLoginAt: &stale, LockedUntil: &future}), "锁定期内")
+
+	config.AccountLockout.FailureWindow = 0
+	assert.Equal(t, 2, activeFailedAttempts(config, &User{FailedLoginAttempts: 2, LastFailedLoginAt: &stale}))
+}
+
+// errLockoutStoreDown failingLockoutStore返回的错误
+var errLockoutStoreDown = errors.New("lockout store down")
+
+// failingLockoutStore 测试用锁定存储，模拟共享存储不可用
+type failingLockoutStore struct{}
+
+func (failingLockoutStore) RecordFailure(key string) int { return 0 }
+
+func (failingLockoutStore) Reset(key string) {}
+
+func (failingLockoutStore) IsLocked(key string) (bool, time.Duration, error) {
+	return false, 0, errLockoutStoreDown
+}
+
+func TestLoginIPLockout(t *testing.T) {
+	clock := NewFakeClock(time.Time{})
+	config := DefaultAuthConfig()
+	config.AccountLockout = DefaultAccountLockoutConfig()
+	config.AccountLockout.MaxFailedAttempts = 100
+	config.AccountLockout.MaxFailedAttemptsPerIP = 3
+	config.Clock = clock
+	service := NewAuthServiceWithConfig(nil, &stubUserService{err: ErrUserNotFound}, nil, config)
+	assert.IsType(t, &MemoryLockoutStore{}, config.AccountLockout.IPStore, "未配置存储时默认使用内存存储")
+
+	attacker := ClientInfo{IP: "203.0.113.7"}
+
+	t.Run("同一IP对不同用户名的失败累计", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			_, _, err := service.LoginWithClient(fmt.Sprintf("user%d", i), "wrong", attacker)
+			assert.True(t, errors.Is(err, ErrInvalidCredentials))
+		}
+		_, _, err := service.LoginWithClient("another", "wrong", attacker)
+		assert.True(t, errors.Is(err, ErrLoginIPLocked))
+	})
+
+	t.Run("其他IP和未知IP不受影响", func(t *testing.T) {
+		_, _, err := service.LoginWithClient("user0", "wrong", ClientInfo{IP: "198.51.100.1"})
+		assert.True(t, errors.Is(err, ErrInvalidCredentials))
+		_, _, err = service.Login("user0", "wrong")
+		assert.True(t, errors.Is(err, ErrInvalidCredentials))
+	})
+
+	t.Run("锁定到期后恢复", func(t *testing.T) {
+		clock.Advance(defaultIPLockDuration)
+		_, _, err := service.LoginWithClient("another", "wrong", attacker)
+		assert.True(t, errors.Is(err, ErrInvalidCredentials))
+	})
+
+	t.Run("存储出错时拒绝登录", func(t *testing.T) {
+		failingConfig := DefaultAuthConfig()
+		failingConfig.AccountLockout = DefaultAccountLockoutConfig()
+		failingConfig.AccountLockout.MaxFailedAttempts = 100
+		failingConfig.AccountLockout.MaxFailedAttemptsPerIP = 3
+		failingConfig.AccountLockout.IPStore = failingLockoutStore{}
+		failing := NewAuthServiceWithConfig(nil, &stubUserService{err: ErrUserNotFound}, nil, failingConfig)
+
+		_, _, err := failing.LoginWithClient("user0", "wrong", attacker)
+		assert.Error(t, err)
+		assert.False(t, errors.Is(err, ErrInvalidCredentials), "IP锁定状态未知时不继续验证密码")
+		assert.True(t, errors.Is(err, errLockoutStoreDown))
+	})
+
+	t.Run("未配置时不按IP限制", func(t *testing.T) {
+		plainConfig := DefaultAuthConfig()
+		plainConfig.AccountLockout = DefaultAccountLockoutConfig()
+		plainConfig.AccountLockout.MaxFailedAttempts = 100
+		plain := NewAuthServiceWithConfig(nil, &stubUserService{err: ErrUserNotFound}, nil, plainConfig)
+		assert.Nil(t, plainConfig.AccountLockout.IPStore)
+		for i := 0; i < 10; i++ {
+			_, _, err := plain.LoginWithClient(fmt.Sprintf("user%d", i), "wrong", attacker)
+			assert.True(t, errors.Is(err, ErrInvalidCredentials))
+		}
+	})
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"errors"
-	"time"
 
 	"gorm.io/gorm"
 )
@@ -11,12 +10,26 @@ import (
 type LoginService interface {
 	// 用户登录
 	Login(username, password string) (*User, string, error)
+	// 携带客户端信息登录，用于识别新设备
+	LoginWithClient(username, password string, client ClientInfo) (*User, string, error)
+	// 使用TOTP验证码或恢复码完成二次验证登录
+	LoginWithTOTP(username, password, code string) (*User, string, error)
 	// 验证Token
 	ValidateToken(token string) (*User, error)
+	// 用户登录，只返回可安全对外的用户信息
+	LoginPublic(username, password string) (PublicUser, string, error)
+	// 验证Token，只返回可安全对外的用户信息
+	ValidateTokenPublic(token string) (PublicUser, error)
 	// 刷新Token
 	RefreshToken(token string) (string, error)
 	// 用户登出
 	Logout(token string) error
+	// 完成人机验证挑战
+	VerifyCaptchaChallenge(username, captchaToken string) error
+	// 签发邮箱验证码挑战，返回的验证码由调用方发送到用户邮箱
+	IssueEmailChallenge(username string) (string, error)
+	// 完成邮箱验证码挑战
+	VerifyEmailChallenge(username, code string) error
 }
 
 // loginService 登录服务实现
@@ -25,32 +38,70 @@ type loginService struct {
 	userService  UserService
 	tokenService TokenService
 	authService  AuthService
+	challenger   *LoginChallenger // 登录挑战管理器，为nil时不启用
 }
 
 // NewLoginService 创建登录服务实例
 func NewLoginService(db *gorm.DB, userService UserService, tokenService TokenService, authService AuthService) LoginService {
+	return NewLoginServiceWithChallenger(db, userService, tokenService, authService, nil)
+}
+
+// NewLoginServiceWithChallenger 创建启用登录挑战的登录服务实例
+func NewLoginServiceWithChallenger(db *gorm.DB, userService UserService, tokenService TokenService, authService AuthService, challenger *LoginChallenger) LoginService {
 	return &loginService{
 		db:           db,
 		userService:  userService,
 		tokenService: tokenService,
 		authService:  authService,
+		challenger:   challenger,
 	}
 }
 
 // Login 用户登录
 func (s *loginService) Login(username, password string) (*User, string, error) {
+	return s.LoginWithClient(username, password, ClientInfo{})
+}
+
+// LoginWithClient 携带客户端信息登录
+func (s *loginService) LoginWithClient(username, password string, client ClientInfo) (*User, string, error) {
+	return s.login(username, password, "", client)
+}
+
+// LoginWithTOTP 使用TOTP验证码或恢复码登录，用户未启用二次验证时忽略验证码
+func (s *loginService) LoginWithTOTP(username, password, code string) (*User, string, error) {
+	return s.login(username, password, code, ClientInfo{})
+}
+
+// login 执行登录流程，totpCode为空且用户启用了二次验证时返回ErrTOTPRequired
+func (s *loginService) login(username, password, totpCode string, client ClientInfo) (*User, string, error) {
+	// 在查询用户之前检查，IP锁定的结果与用户名是否存在无关
+	if err := checkIPLock(s.authConfig(), client.IP); err != nil {
+		return nil, "", err
+	}
+
+	// 连续失败过多时需要先完成挑战
+	if s.challenger != nil {
+		if err := s.challenger.CheckChallenge(username); err != nil {
+			return nil, "", err
+		}
+	}
+
 	// 获取用户
 	user, err := s.userService.GetUserByUsername(username)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, "", errors.New("用户名或密码错误")
+		if errors.Is(err, ErrUserNotFound) {
+			recordIPFailure(s.authConfig(), client.IP)
+			if err := recordUnknownUserFailure(s.authConfig(), username); err != nil {
+				return nil, "", err
+			}
+			return nil, "", s.loginFailed(username)
 		}
 		return nil, "", err
 	}
 
-	// 检查用户状态
-	if user.Status != 1 {
-		return nil, "", errors.New("用户已被禁用")
+	config := s.authConfig()
+	if err := checkAccountLock(config, user); err != nil {
+		return nil, "", err
 	}
 
 	// 验证密码
@@ -59,65 +110,209 @@ func (s *loginService) Login(username, password string) (*User, string, error) {
 		return nil, "", errors.New("认证服务类型错误")
 	}
 
-	valid, err := authServiceImpl.VerifyPassword(password, user.PasswordHash)
+	valid, needsRehash, err := authServiceImpl.verifyPassword(password, user.PasswordHash)
 	if err != nil {
 		return nil, "", err
 	}
 	if !valid {
-		return nil, "", errors.New("用户名或密码错误")
+		recordIPFailure(config, client.IP)
+		if err := recordFailedLogin(s.db, config, user); err != nil {
+			return nil, "", err
+		}
+		return nil, "", s.loginFailed(username)
+	}
+
+	// 密码正确后才检查用户状态，不知道密码的调用方无法得知账户是否被禁用或暂停
+	if err := checkUserStatus(user, config.ShowSuspensionExpiry, config.now()); err != nil {
+		return nil, "", err
+	}
+	if needsRehash {
+		authServiceImpl.upgradePasswordHash(user, password)
+	}
+	amr, err := checkTwoFactor(s.db, config, user, totpCode, client)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// 评估登录风险，要求挑战时需先完成邮箱验证码挑战再重新登录
+	action, err := assessLoginRisk(config, user, client)
+	if err != nil {
+		return nil, "", err
+	}
+	if action == RiskChallenge {
+		if err := s.checkRiskChallenge(username); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := checkTermsAcceptance(s.userService, config.RequiredTermsVersion, user, client.AcceptedTermsVersion); err != nil {
+		return nil, "", err
+	}
+	if err := checkTenantSessions(config.TenantLimits, user); err != nil {
+		return nil, "", err
 	}
 
-	// 生成Token
-	token, err := s.tokenService.GenerateToken(user.ID)
+	// 生成Token，记录本次登录完成的认证方式，通过二次验证的会话可以通过RequireMFA
+	token, err := s.tokenService.GenerateTokenForUserWithAMR(user, amr)
 	if err != nil {
 		return nil, "", err
 	}
 
+	if s.challenger != nil {
+		if err := s.challenger.RecordSuccess(username); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := clearFailedLogins(s.db, config, user); err != nil {
+		return nil, "", err
+	}
+
 	// 更新最后登录时间
-	now := time.Now()
+	now := config.now()
 	user.LastLoginAt = &now
-	s.userService.UpdateUser(user)
+	s.userService.UpdateLastLogin(user.ID, now)
+
+	recordLoginDevice(config.DeviceTracker, user, client)
 
 	return user, token, nil
 }
 
+// checkRiskChallenge 检查是否已完成风险评估要求的邮箱验证码挑战
+func (s *loginService) checkRiskChallenge(username string) error {
+	required := &ChallengeRequiredError{Challenge: ChallengeEmailCode}
+	if s.challenger == nil {
+		return required
+	}
+
+	passed, err := s.challenger.ChallengePassed(username, ChallengeEmailCode)
+	if err != nil {
+		return err
+	}
+	if !passed {
+		return required
+	}
+	return nil
+}
+
+// loginFailed 记录登录失败并返回统一的错误信息
+func (s *loginService) loginFailed(username string) error {
+	if s.challenger != nil {
+		if err := s.challenger.RecordFailure(username); err != nil {
+			return err
+		}
+	}
+	return ErrInvalidCredentials
+}
+
+// VerifyCaptchaChallenge 完成人机验证挑战
+func (s *loginService) VerifyCaptchaChallenge(username, captchaToken string) error {
+	if s.challenger == nil {
+		return ErrChallengeNotEnabled
+	}
+	return s.challenger.VerifyCaptcha(username, captchaToken)
+}
+
+// IssueEmailChallenge 签发邮箱验证码挑战
+func (s *loginService) IssueEmailChallenge(username string) (string, error) {
+	if s.challenger == nil {
+		return "", ErrChallengeNotEnabled
+	}
+
+	user, err := s.userService.GetUserByUsername(username)
+	if err != nil {
+		return "", err
+	}
+	return s.challenger.IssueEmailCode(user.ID)
+}
+
+// VerifyEmailChallenge 完成邮箱验证码挑战
+func (s *loginService) VerifyEmailChallenge(username, code string) error {
+	if s.challenger == nil {
+		return ErrChallengeNotEnabled
+	}
+
+	user, err := s.userService.GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	return s.challenger.VerifyEmailCode(username, user.ID, code)
+}
+
 // ValidateToken 验证Token
 func (s *loginService) ValidateToken(token string) (*User, error) {
-	userID, err := s.tokenService.ValidateToken(token)
+	claims, err := s.tokenService.ParseClaims(token)
 	if err != nil {
 		return nil, err
 	}
 
-	user, err := s.userService.GetUserByID(userID)
+	user, err := s.userService.GetUserByID(claims.UserID)
 	if err != nil {
 		return nil, err
 	}
 
 	// 检查用户状态
-	if user.Status != 1 {
-		return nil, errors.New("用户已被禁用")
+	config := s.authConfig()
+	if err := checkUserStatus(user, config.ShowSuspensionExpiry, config.now()); err != nil {
+		return nil, err
+	}
+
+	// 检查Token是否早于最近一次修改密码
+	if config.RejectStaleCredentials {
+		if err := checkCredentialFreshness(claims, user); err != nil {
+			return nil, err
+		}
 	}
 
 	return user, nil
 }
 
+// LoginPublic 用户登录，只返回可安全对外的用户信息
+func (s *loginService) LoginPublic(username, password string) (PublicUser, string, error) {
+	user, token, err := s.Login(username, password)
+	if err != nil {
+		return PublicUser{}, "", err
+	}
+	return user.Public(), token, nil
+}
+
+// ValidateTokenPublic 验证Token，只返回可安全对外的用户信息
+func (s *loginService) ValidateTokenPublic(token string) (PublicUser, error) {
+	user, err := s.ValidateToken(token)
+	if err != nil {
+		return PublicUser{}, err
+	}
+	return user.Public(), nil
+}
+
 // RefreshToken 刷新Token
 func (s *loginService) RefreshToken(token string) (string, error) {
-	userID, err := s.tokenService.ValidateToken(token)
+	user, err := s.ValidateToken(token)
+	if err != nil {
+		return "", err
+	}
+	claims, err := s.tokenService.ParseClaims(token)
 	if err != nil {
 		return "", err
 	}
 
-	// 生成新Token
-	newToken, err := s.tokenService.GenerateToken(userID)
+	// 签发新Token前先消费旧Token，并发刷新同一Token时只有一个成功
+	consumed, err := s.tokenService.ConsumeToken(token)
 	if err != nil {
 		return "", err
 	}
+	if !consumed {
+		return "", errors.New("Token已被撤销")
+	}
 
-	// 使旧Token失效
-	s.tokenService.RevokeToken(token)
+	// 生成新Token，保留登录时完成的认证方式；失败时旧Token已失效，需要重新登录
+	return s.tokenService.GenerateTokenForUserWithAMR(user, claims.AMR)
+}
 
-	return newToken, nil
+// authConfig 沿用认证服务的配置
+func (s *loginService) authConfig() *AuthConfig {
+	if authServiceImpl, ok := s.authService.(*authService); ok {
+		return authServiceImpl.config
+	}
+	return DefaultAuthConfig()
 }
 
 // Logout 用户登出
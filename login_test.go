@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -14,8 +15,11 @@ func TestLoginService(t *testing.T) {
 
 	// 创建服务实例
 	userService := NewUserService(testDB.DB)
-	tokenService := NewTokenService("test-secret-key", time.Hour)
-	authService := NewAuthService(testDB.DB, userService, tokenService)
+	clock := NewFakeClock(time.Time{})
+	tokenService := NewTokenServiceWithClock("test-secret-key", time.Hour, clock)
+	authConfig := DefaultAuthConfig()
+	authConfig.Clock = clock
+	authService := NewAuthServiceWithConfig(testDB.DB, userService, tokenService, authConfig)
 	loginService := NewLoginService(testDB.DB, userService, tokenService, authService)
 
 	t.Run("用户登录成功", func(t *testing.T) {
@@ -34,6 +38,25 @@ func TestLoginService(t *testing.T) {
 		assert.NotNil(t, loginUser.LastLoginAt)
 	})
 
+	t.Run("登录和验证Token只返回可安全对外的用户信息", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		password := "testpassword123"
+		user := testDB.CreateTestUser("testuser", "test@example.com", password)
+
+		public, token, err := loginService.LoginPublic("testuser", password)
+		assert.NoError(t, err)
+		assert.Equal(t, PublicUser{ID: user.ID, Username: "testuser", Status: user.Status}, public)
+
+		public, err = loginService.ValidateTokenPublic(token)
+		assert.NoError(t, err)
+		assert.Equal(t, user.ID, public.ID)
+
+		_, _, err = loginService.LoginPublic("testuser", "wrongpassword")
+		assert.Error(t, err)
+	})
+
 	t.Run("用户登录失败-错误密码", func(t *testing.T) {
 		// 清理数据
 		testDB.ClearAllData()
@@ -112,8 +135,8 @@ func TestLoginService(t *testing.T) {
 		_, token, err := loginService.Login("testuser", password)
 		assert.NoError(t, err)
 
-		// 等待1秒确保时间戳不同
-		time.Sleep(time.Second)
+		// 推进1秒确保时间戳不同
+		clock.Advance(time.Second)
 
 		// 测试Token刷新
 		newToken, err := loginService.RefreshToken(token)
@@ -161,8 +184,8 @@ func TestLoginService(t *testing.T) {
 		// 记录登录前的时间
 		originalLastLogin := user.LastLoginAt
 
-		// 等待一小段时间确保时间不同
-		time.Sleep(100 * time.Millisecond)
+		// 推进时钟确保时间不同
+		clock.Advance(time.Second)
 
 		// 登录
 		loginUser, _, err := loginService.Login("testuser", password)
@@ -174,4 +197,58 @@ func TestLoginService(t *testing.T) {
 			assert.True(t, loginUser.LastLoginAt.After(*originalLastLogin))
 		}
 	})
+
+	t.Run("连续失败后逐级要求挑战", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		codes := NewVerificationCodeService(NewMemoryVerificationCodeStorage(), nil)
+		challenger := NewLoginChallenger(nil, NewMemoryRateLimitStore(), &stubCaptchaVerifier{validToken: "human"}, codes)
+		service := NewLoginServiceWithChallenger(testDB.DB, userService, tokenService, authService, challenger)
+
+		password := "testpassword123"
+		testDB.CreateTestUser("testuser", "test@example.com", password)
+
+		// 前3次失败只返回密码错误
+		for i := 0; i < 3; i++ {
+			_, _, err := service.Login("testuser", "wrongpassword")
+			assert.Equal(t, "用户名或密码错误", err.Error())
+		}
+
+		// 之后需要人机验证，正确的密码也不能直接登录
+		_, _, err := service.Login("testuser", password)
+		var challengeErr *ChallengeRequiredError
+		assert.True(t, errors.As(err, &challengeErr))
+		assert.Equal(t, ChallengeCaptcha, challengeErr.Challenge)
+
+		for i := 3; i < 10; i++ {
+			assert.NoError(t, service.VerifyCaptchaChallenge("testuser", "human"))
+			_, _, err = service.Login("testuser", "wrongpassword")
+			assert.Equal(t, "用户名或密码错误", err.Error())
+		}
+
+		// 10次失败后需要邮箱验证码
+		_, _, err = service.Login("testuser", password)
+		assert.True(t, errors.As(err, &challengeErr))
+		assert.Equal(t, ChallengeEmailCode, challengeErr.Challenge)
+
+		code, err := service.IssueEmailChallenge("testuser")
+		assert.NoError(t, err)
+		assert.NoError(t, service.VerifyEmailChallenge("testuser", code))
+
+		_, token, err := service.Login("testuser", password)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, token)
+
+		// 登录成功后重置，再次失败不会立即要求挑战
+		_, _, err = service.Login("testuser", "wrongpassword")
+		assert.Equal(t, "用户名或密码错误", err.Error())
+		_, _, err = service.Login("testuser", password)
+		assert.NoError(t, err)
+	})
+
+	t.Run("未启用登录挑战", func(t *testing.T) {
+		err := loginService.VerifyCaptchaChallenge("testuser", "human")
+		assert.True(t, errors.Is(err, ErrChallengeNotEnabled))
+	})
 }
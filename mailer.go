@@ -0,0 +1,57 @@
+package main
+
+import (
+	"sync"
+)
+
+// 邮件模板
+const (
+	MailTemplateNewDeviceLogin    = "new_device_login"
+	MailTemplatePasswordChanged   = "password_changed"
+	MailTemplatePasswordReset     = "password_reset"
+	MailTemplateEmailVerification = "email_verification" // Data中的code为验证码
+	MailTemplateAccountUnlock     = "account_unlock"     // Data中的code为解锁验证码
+	MailTemplateDormancyWarning   = "dormancy_warning"   // Data中的disable_at为账号将被禁用的日期
+)
+
+// MailMessage 待发送的邮件，由邮件实现按模板名渲染内容
+type MailMessage struct {
+	To       string            `json:"to"`
+	Template string            `json:"template"`
+	Data     map[string]string `json:"data,omitempty"`
+}
+
+// AuthMailer 认证相关通知邮件发送接口，由接入方对接具体的邮件服务
+type AuthMailer interface {
+	Send(message MailMessage) error
+}
+
+// CaptureMailer 只记录邮件而不发送的实现，用于测试和本地开发
+type CaptureMailer struct {
+	messages []MailMessage
+	mutex    sync.RWMutex
+}
+
+// NewCaptureMailer 创建记录邮件的发送器
+func NewCaptureMailer() *CaptureMailer {
+	return &CaptureMailer{}
+}
+
+// Send 记录邮件
+func (m *CaptureMailer) Send(message MailMessage) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+// Messages 获取已记录的邮件
+func (m *CaptureMailer) Messages() []MailMessage {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	result := make([]MailMessage, len(m.messages))
+	copy(result, m.messages)
+	return result
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// UserDetail 含邮箱、手机号等个人信息的用户详情，不包含密码、邀请码、暂停原因等敏感字段
+//
+// 只能通过WithPII（未脱敏）或Masked（已脱敏）获得，WithPII仅用于有权查看个人信息的调用方。
+type UserDetail struct {
+	ID             uint       `json:"id"`
+	Username       string     `json:"username"`
+	Email          string     `json:"email"`
+	Phone          string     `json:"phone,omitempty"`
+	Avatar         string     `json:"avatar,omitempty"`
+	Status         uint8      `json:"status"`
+	EmailVerified  bool       `json:"email_verified"`
+	LastLoginAt    *time.Time `json:"last_login_at,omitempty"`
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
+}
+
+// WithPII 返回未脱敏的用户详情，仅用于有权查看个人信息的调用方，如本人数据导出和管理命令
+func (u *User) WithPII() UserDetail {
+	detail := UserDetail{
+		ID:             u.ID,
+		Username:       u.Username,
+		Email:          u.Email,
+		Phone:          u.Phone,
+		Avatar:         u.Avatar,
+		Status:         u.Status,
+		EmailVerified:  u.EmailVerified,
+		LastLoginAt:    u.LastLoginAt,
+		SuspendedUntil: u.SuspendedUntil,
+		CreatedAt:      u.CreatedAt,
+	}
+	if u.DeletedAt.Valid {
+		deletedAt := u.DeletedAt.Time
+		detail.DeletedAt = &deletedAt
+	}
+	return detail
+}
+
+// PublicUser 可安全返回给任何调用方的最小用户信息，不包含邮箱、手机号、邀请关系等字段
+//
+// 接口响应默认应使用该结构；需要展示个人信息时按权限使用WithPII或Masked。
+type PublicUser struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+	Avatar   string `json:"avatar,omitempty"`
+	Status   uint8  `json:"status"`
+}
+
+// Public 返回可安全对外返回的最小用户信息
+func (u *User) Public() PublicUser {
+	return PublicUser{
+		ID:       u.ID,
+		Username: u.Username,
+		Avatar:   u.Avatar,
+		Status:   u.Status,
+	}
+}
+
+// Masked 返回邮箱和手机号已脱敏的对外用户信息
+func (u *User) Masked() UserDetail {
+	detail := u.WithPII()
+	detail.Email = MaskEmail(u.Email)
+	detail.Phone = MaskPhone(u.Phone)
+	return detail
+}
+
+// PresentUsers 按查看者权限返回用户信息，没有user.read_pii权限时邮箱和手机号脱敏
+func PresentUsers(rs RoleService, viewerID uint, users []*User) ([]UserDetail, error) {
+	canReadPII, err := rs.HasPermission(viewerID, PermissionResourceUser, PermissionActionReadPII)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]UserDetail, 0, len(users))
+	for _, user := range users {
+		if canReadPII {
+			result = append(result, user.WithPII())
+		} else {
+			result = append(result, user.Masked())
+		}
+	}
+	return result, nil
+}
+
+// MaskEmail 邮箱脱敏，如 alice@example.com -> a***e@exa***.com
+//
+// 本地部分保留首尾字符，两个字符以内只保留首字符；域名保留前三个字符和顶级域名。
+func MaskEmail(email string) string {
+	if email == "" {
+		return ""
+	}
+
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok {
+		return maskKeepEnds(email, 1, 0)
+	}
+
+	maskedLocal := maskKeepEnds(local, 1, 1)
+	if domain == "" {
+		return maskedLocal + "@"
+	}
+
+	name, tld := domain, ""
+	if dot := strings.LastIndex(domain, "."); dot > 0 {
+		name, tld = domain[:dot], domain[dot:]
+	}
+	return maskedLocal + "@" + maskKeepEnds(name, 3, 0) + tld
+}
+
+// MaskPhone 手机号脱敏，如 +8613800001234 -> +86****1234
+//
+// 保留前三个字符和后四位，号码过短时只保留最后两位或全部隐藏。
+func MaskPhone(phone string) string {
+	phone = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, phone)
+
+	runes := []rune(phone)
+	switch {
+	case len(runes) == 0:
+		return ""
+	case len(runes) <= 4:
+		return "****"
+	case len(runes) < 8:
+		return "****" + string(runes[len(runes)-2:])
+	default:
+		return string(runes[:3]) + "****" + string(runes[len(runes)-4:])
+	}
+}
+
+// maskKeepEnds 保留开头head个和结尾tail个字符，其余替换为***
+//
+// 字符数不足以在保留后仍隐藏至少一个字符时，只保留第一个字符。
+func maskKeepEnds(s string, head, tail int) string {
+	runes := []rune(s)
+	if len(runes) == 0 {
+		return "***"
+	}
+	if len(runes) <= head+tail {
+		return string(runes[:1]) + "***"
+	}
+	return string(runes[:head]) + "***" + string(runes[len(runes)-tail:])
+}
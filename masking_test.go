@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// piiRoleService 测试用角色服务，只实现权限检查
+type piiRoleService struct {
+	RoleService
+	allowed map[uint]bool
+	err     error
+}
+
+func (s *piiRoleService) HasPermission(userID uint, resource, action string) (bool, error) {
+	if s.err != nil {
+		return false, s.err
+	}
+	return resource == PermissionResourceUser && action == PermissionActionReadPII && s.allowed[userID], nil
+}
+
+func TestMaskEmail(t *testing.T) {
+	cases := map[string]string{
+		"alice@example.com":      "a***e@exa***.com",
+		"bob.smith@mail.corp.cn": "b***h@mai***.cn",
+		"ab@example.com":         "a***@exa***.com",
+		"a@ex.io":                "a***@e***.io",
+		"张三丰@例子.中国":              "张***丰@例***.中国",
+		"alice@localhost":        "a***e@loc***",
+		"alice@":                 "a***e@",
+		"@example.com":           "***@exa***.com",
+		"not-an-email":           "n***",
+		"":                       "",
+	}
+	for input, expected := range cases {
+		assert.Equal(t, expected, MaskEmail(input), input)
+	}
+}
+
+func TestMaskPhone(t *testing.T) {
+	cases := map[string]string{
+		"+8613800001234":    "+86****1234",
+		"13800001234":       "138****1234",
+		"+86 138-0000-1234": "+86****1234",
+		"12345678":          "123****5678",
+		"1234567":           "****67",
+		"12345":             "****45",
+		"1234":              "****",
+		"1":                 "****",
+		"":                  "",
+	}
+	for input, expected := range cases {
+		assert.Equal(t, expected, MaskPhone(input), input)
+	}
+}
+
+func TestUserMasked(t *testing.T) {
+	lastLogin := time.Now()
+	user := &User{
+		Username:         "alice",
+		Email:            "alice@example.com",
+		Phone:            "+8613800001234",
+		PhoneHash:        "phone-hash",
+		PasswordHash:     "password-hash",
+		InvitationCode:   "INVITE",
+		SuspensionReason: "spam",
+		Status:           1,
+		LastLoginAt:      &lastLogin,
+	}
+	user.ID = 7
+
+	masked := user.Masked()
+	assert.Equal(t, uint(7), masked.ID)
+	assert.Equal(t, "alice", masked.Username)
+	assert.Equal(t, "a***e@exa***.com", masked.Email)
+	assert.Equal(t, "+86****1234", masked.Phone)
+	assert.Equal(t, &lastLogin, masked.LastLoginAt)
+
+	// 敏感字段不出现在序列化结果中
+	data, err := json.Marshal(masked)
+	assert.NoError(t, err)
+	for _, secret := range []string{"password-hash", "phone-hash", "INVITE", "spam", "alice@example.com", "13800001234"} {
+		assert.NotContains(t, string(data), secret)
+	}
+
+	detail := user.WithPII()
+	assert.Equal(t, "alice@example.com", detail.Email)
+	assert.Equal(t, "+8613800001234", detail.Phone)
+	assert.Nil(t, detail.DeletedAt)
+}
+
+func TestUserPublic(t *testing.T) {
+	user := &User{
+		Username:       "alice",
+		Email:          "alice@example.com",
+		Phone:          "+8613800001234",
+		Avatar:         "https://example.com/alice.png",
+		InvitationCode: "INVITE",
+		InvitedBy:      3,
+		Status:         1,
+	}
+	user.ID = 7
+
+	data, err := json.Marshal(user.Public())
+	assert.NoError(t, err)
+
+	// 只包含约定的安全字段
+	var fields map[string]any
+	assert.NoError(t, json.Unmarshal(data, &fields))
+	assert.Equal(t, map[string]any{
+		"id":       float64(7),
+		"username": "alice",
+		"avatar":   "https://example.com/alice.png",
+		"status":   float64(1),
+	}, fields)
+	for _, secret := range []string{"alice@example.com", "13800001234", "INVITE", "invited_by"} {
+		assert.NotContains(t, string(data), secret)
+	}
+}
+
+func TestPresentUsers(t *testing.T) {
+	user := &User{Username: "alice", Email: "alice@example.com", Phone: "13800001234"}
+	user.ID = 7
+	rs := &piiRoleService{allowed: map[uint]bool{1: true}}
+
+	t.Run("有权限查看完整信息", func(t *testing.T) {
+		result, err := PresentUsers(rs, 1, []*User{user})
+		assert.NoError(t, err)
+		assert.Len(t, result, 1)
+		assert.Equal(t, "alice@example.com", result[0].Email)
+		assert.Equal(t, "13800001234", result[0].Phone)
+	})
+
+	t.Run("无权限返回脱敏信息", func(t *testing.T) {
+		result, err := PresentUsers(rs, 2, []*User{user})
+		assert.NoError(t, err)
+		assert.Len(t, result, 1)
+		assert.Equal(t, "a***e@exa***.com", result[0].Email)
+		assert.Equal(t, "138****1234", result[0].Phone)
+	})
+
+	t.Run("权限检查失败", func(t *testing.T) {
+		_, err := PresentUsers(&piiRoleService{err: errors.New("数据库不可用")}, 1, []*User{user})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+
+	"aigo_service_auth/errorcodes"
+)
+
+// 登录认证方式（RFC 8176），记录在JWTClaims.AMR中
+const (
+	AMRPassword = "pwd" // 密码
+	AMROTP      = "otp" // 一次性验证码
+	AMRMFA      = "mfa" // 完成了多因素认证
+)
+
+// MFATokenParser RequireMFA解析Token登录认证方式的服务，JWTService和TokenService都实现了该接口
+type MFATokenParser interface {
+	// 验证Token并返回登录认证方式
+	ParseAMR(tokenString string) ([]string, error)
+}
+
+// MFAVerified 检查会话登录时是否完成了多因素认证，未携带amr的Token视为未完成
+func (c *JWTClaims) MFAVerified() bool {
+	return slices.Contains(c.AMR, AMRMFA)
+}
+
+// MFAVerified 检查会话登录时是否完成了多因素认证，未携带amr的Token视为未完成
+func (c *Claims) MFAVerified() bool {
+	return slices.Contains(c.AMR, AMRMFA)
+}
+
+// RequireMFA 要求会话已完成多因素认证的中间件，用于敏感操作的升级认证，需在RequireAuth之后使用
+//
+// 从Authorization请求头读取Token并用tokens解析amr声明，Token须由该服务签发；AuthService和LoginService签发的Token
+// 使用其TokenService，JWTService签发的Token使用该JWTService。
+// 未完成多因素认证时返回403和mfa_required，客户端应引导用户完成第二因素后重新登录。
+func (m *AuthMiddleware) RequireMFA(tokens MFATokenParser) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				m.unauthorized(w, r, errorcodes.ErrCodeUnauthenticated, "缺少认证信息")
+				return
+			}
+
+			amr, err := tokens.ParseAMR(token)
+			if err != nil {
+				m.unauthorized(w, r, unauthorizedCode(err), "认证失败: "+err.Error())
+				return
+			}
+
+			if !slices.Contains(amr, AMRMFA) {
+				m.forbidden(w, r, errorcodes.ErrCodeMFARequired, "该操作需要完成多因素认证")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWTClaimsMFAVerified(t *testing.T) {
+	service := NewJWTService(nil)
+
+	t.Run("记录认证方式", func(t *testing.T) {
+		token, err := service.GenerateTokenWithAMR(1, ChannelWeb, []string{AMRPassword, AMROTP, AMRMFA})
+		assert.NoError(t, err)
+
+		claims, err := service.ParseToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{AMRPassword, AMROTP, AMRMFA}, claims.AMR)
+		assert.Equal(t, ChannelWeb, claims.Channel)
+		assert.True(t, claims.MFAVerified())
+	})
+
+	t.Run("只使用密码登录", func(t *testing.T) {
+		token, err := service.GenerateTokenWithAMR(1, "", []string{AMRPassword})
+		assert.NoError(t, err)
+
+		claims, err := service.ParseToken(token)
+		assert.NoError(t, err)
+		assert.False(t, claims.MFAVerified())
+	})
+
+	t.Run("未携带amr视为未完成", func(t *testing.T) {
+		token, err := service.GenerateToken(1)
+		assert.NoError(t, err)
+
+		claims, err := service.ParseToken(token)
+		assert.NoError(t, err)
+		assert.Nil(t, claims.AMR)
+		assert.False(t, claims.MFAVerified())
+	})
+
+	t.Run("刷新时保留认证方式", func(t *testing.T) {
+		config := DefaultJWTConfig()
+		config.DefaultExpiration = time.Hour
+		config.RefreshExpiration = 2 * time.Hour
+		refreshable := NewJWTService(config)
+
+		token, err := refreshable.GenerateTokenWithAMR(1, "", []string{AMRPassword, AMRMFA})
+		assert.NoError(t, err)
+		refreshed, err := refreshable.RefreshToken(token)
+		assert.NoError(t, err)
+
+		claims, err := refreshable.ParseToken(refreshed)
+		assert.NoError(t, err)
+		assert.True(t, claims.MFAVerified())
+	})
+}
+
+func TestRequireMFA(t *testing.T) {
+	service := NewJWTService(nil)
+	middleware := NewAuthMiddleware(nil)
+
+	called := false
+	handler := middleware.RequireMFA(service)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(authorization string) *httptest.ResponseRecorder {
+		called = false
+		req := httptest.NewRequest(http.MethodPost, "/account/delete", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	t.Run("完成多因素认证的会话通过", func(t *testing.T) {
+		token, err := service.GenerateTokenWithAMR(1, "", []string{AMRPassword, AMRMFA})
+		assert.NoError(t, err)
+
+		recorder := request("Bearer " + token)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.True(t, called)
+	})
+
+	t.Run("未完成多因素认证的会话被拒绝", func(t *testing.T) {
+		token, err := service.GenerateTokenWithAMR(1, "", []string{AMRPassword})
+		assert.NoError(t, err)
+
+		recorder := request("Bearer " + token)
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "mfa_required")
+		assert.False(t, called)
+	})
+
+	t.Run("未携带amr的会话被拒绝", func(t *testing.T) {
+		token, err := service.GenerateToken(1)
+		assert.NoError(t, err)
+
+		recorder := request("Bearer " + token)
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+		assert.False(t, called)
+	})
+
+	t.Run("缺少或无效的Token", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, request("").Code)
+		assert.Equal(t, http.StatusUnauthorized, request("Bearer invalid").Code)
+		assert.False(t, called)
+	})
+}
@@ -3,7 +3,10 @@ package main
 import (
 	"context"
 	"net/http"
-	"strings"
+	"strconv"
+	"time"
+
+	"aigo_service_auth/errorcodes"
 )
 
 // ContextKey 上下文键类型
@@ -16,39 +19,55 @@ const (
 
 // AuthMiddleware 认证中间件
 type AuthMiddleware struct {
-	authService AuthService
+	authService    AuthService
+	claimsCache    *authorizationCache // 实时角色权限缓存，为nil时每次请求都查询数据库
+	maxTokenLength int                 // Token最大长度，超过时在解析前拒绝
+
+	// OnUnauthorized 未认证（缺少Token、Token无效或已过期）时的响应，为nil时返回401 JSON错误，
+	// 服务端渲染的页面可以改为重定向到登录页
+	OnUnauthorized func(w http.ResponseWriter, r *http.Request)
+	// OnForbidden 已认证但权限或角色不足时的响应，为nil时返回403 JSON错误
+	OnForbidden func(w http.ResponseWriter, r *http.Request)
 }
 
 // NewAuthMiddleware 创建认证中间件
 func NewAuthMiddleware(authService AuthService) *AuthMiddleware {
 	return &AuthMiddleware{
-		authService: authService,
+		authService:    authService,
+		maxTokenLength: DefaultMaxTokenLength,
 	}
 }
 
-// RequireAuth 需要认证的中间件
-func (m *AuthMiddleware) RequireAuth(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// 从请求头获取Token
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "缺少认证信息", http.StatusUnauthorized)
-			return
-		}
+// SetMaxTokenLength 设置RequireAuth接受的Token最大长度，n<=0时使用DefaultMaxTokenLength
+func (m *AuthMiddleware) SetMaxTokenLength(n int) {
+	if n <= 0 {
+		n = DefaultMaxTokenLength
+	}
+	m.maxTokenLength = n
+}
 
-		// 解析Bearer Token
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, "无效的认证格式", http.StatusUnauthorized)
-			return
-		}
+// SetClaimsCacheTTL 设置RefreshClaimsFromDB的缓存有效期，ttl<=0时关闭缓存
+func (m *AuthMiddleware) SetClaimsCacheTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		m.claimsCache = nil
+		return
+	}
+	m.claimsCache = newAuthorizationCache(ttl)
+}
 
-		token := parts[1]
+// InvalidateClaims 清除用户的角色权限缓存，修改用户角色或角色权限后调用以立即生效
+func (m *AuthMiddleware) InvalidateClaims(userID uint) {
+	if m.claimsCache != nil {
+		m.claimsCache.Invalidate(userID)
+	}
+}
 
-		// 验证Token
-		user, err := m.authService.ValidateToken(token)
-		if err != nil {
-			http.Error(w, "认证失败: "+err.Error(), http.StatusUnauthorized)
+// RequireAuth 需要认证的中间件
+func (m *AuthMiddleware) RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, code, message := m.authenticate(r.Header.Get("Authorization"))
+		if user == nil {
+			m.unauthorized(w, r, code, message)
 			return
 		}
 
@@ -58,68 +77,219 @@ func (m *AuthMiddleware) RequireAuth(next http.Handler) http.Handler {
 	})
 }
 
+// authenticate 解析并验证Authorization请求头中的Bearer Token，失败时user为nil并返回错误码和说明
+func (m *AuthMiddleware) authenticate(authHeader string) (user *User, code, message string) {
+	if authHeader == "" {
+		return nil, errorcodes.ErrCodeUnauthenticated, "缺少认证信息"
+	}
+
+	// 超长的请求头在切分和解析之前拒绝
+	if len(authHeader) > len(bearerScheme)+1+m.maxTokenLength {
+		return nil, errorcodes.ErrCodeTokenInvalid, "认证失败: " + ErrTokenTooLong.Error()
+	}
+
+	// 解析Bearer Token
+	token, ok := parseBearerToken(authHeader)
+	if !ok {
+		return nil, errorcodes.ErrCodeUnauthenticated, "无效的认证格式"
+	}
+
+	// 明显无效的Token不进入签名验证和撤销记录查询
+	if err := checkTokenFormat(token, m.maxTokenLength); err != nil {
+		return nil, unauthorizedCode(err), "认证失败: " + err.Error()
+	}
+
+	// 验证Token
+	user, err := m.authService.ValidateToken(token)
+	if err != nil {
+		return nil, unauthorizedCode(err), "认证失败: " + err.Error()
+	}
+	return user, "", ""
+}
+
 // RequirePermission 需要特定权限的中间件
 func (m *AuthMiddleware) RequirePermission(resource, action string, roleService RoleService) func(http.Handler) http.Handler {
+	return m.requireAuthorized(roleService, "权限检查失败", "权限不足", func(user *User) (bool, error) {
+		return roleService.HasPermission(user.ID, resource, action)
+	})
+}
+
+// RequireRole 需要特定角色的中间件
+func (m *AuthMiddleware) RequireRole(roleName string, roleService RoleService) func(http.Handler) http.Handler {
+	return m.requireAuthorized(roleService, "角色检查失败", "角色权限不足", func(user *User) (bool, error) {
+		return roleService.HasRole(user.ID, roleName)
+	})
+}
+
+// requireAuthorized 先认证再执行授权检查，任何错误都拒绝请求，只有检查明确通过时才调用next
+//
+// 无法获取用户、角色服务未配置或检查出错时返回500，检查不通过时返回403。
+func (m *AuthMiddleware) requireAuthorized(roleService RoleService, checkFailed, denied string, check func(user *User) (bool, error)) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// 先进行认证
-			m.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				// 从上下文获取用户
-				user, ok := r.Context().Value(UserContextKey).(*User)
-				if !ok {
-					http.Error(w, "用户信息获取失败", http.StatusInternalServerError)
-					return
-				}
+		return m.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// 从上下文获取用户
+			user, ok := r.Context().Value(UserContextKey).(*User)
+			if !ok || user == nil {
+				writeErrorCode(w, errorcodes.ErrCodeInternal, "用户信息获取失败")
+				return
+			}
+			if roleService == nil {
+				writeErrorCode(w, errorcodes.ErrCodeInternal, checkFailed)
+				return
+			}
 
-				// 检查权限
-				hasPermission, err := roleService.HasPermission(user.ID, resource, action)
-				if err != nil {
-					http.Error(w, "权限检查失败", http.StatusInternalServerError)
-					return
-				}
+			allowed, err := check(user)
+			if err != nil {
+				writeErrorCode(w, errorcodes.ErrCodeInternal, checkFailed)
+				return
+			}
+			if !allowed {
+				m.forbidden(w, r, errorcodes.ErrCodePermissionDenied, denied)
+				return
+			}
 
-				if !hasPermission {
-					http.Error(w, "权限不足", http.StatusForbidden)
-					return
-				}
+			next.ServeHTTP(w, r)
+		}))
+	}
+}
+
+// RequireSelfOrPermission 要求路径中的用户ID为当前用户，或当前用户拥有指定权限的中间件
+//
+// paramName为路由模式中的路径参数名，如"/users/{id}/profile"中的id，通过r.PathValue读取。
+// 访问自己的资源时不检查权限；路径参数不是有效的用户ID时返回400。
+func (m *AuthMiddleware) RequireSelfOrPermission(paramName, resource, action string, roleService RoleService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return m.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := r.Context().Value(UserContextKey).(*User)
+			if !ok || user == nil {
+				writeErrorCode(w, errorcodes.ErrCodeInternal, "用户信息获取失败")
+				return
+			}
+
+			pathUserID, err := strconv.ParseUint(r.PathValue(paramName), 10, 0)
+			if err != nil || pathUserID == 0 {
+				writeErrorCode(w, errorcodes.ErrCodeInvalidArgument, "无效的用户ID")
+				return
+			}
+			if uint(pathUserID) == user.ID {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if roleService == nil {
+				writeErrorCode(w, errorcodes.ErrCodeInternal, "权限检查失败")
+				return
+			}
+			allowed, err := roleService.HasPermission(user.ID, resource, action)
+			if err != nil {
+				writeErrorCode(w, errorcodes.ErrCodeInternal, "权限检查失败")
+				return
+			}
+			if !allowed {
+				m.forbidden(w, r, errorcodes.ErrCodePermissionDenied, "权限不足")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}))
+	}
+}
+
+// RequireVerifiedEmail 要求邮箱已验证的中间件，需在RequireAuth之后使用
+//
+// 从数据库重新加载用户以获取最新的验证状态，allowedPaths中的路径（如重新发送验证邮件）不受限制。
+func (m *AuthMiddleware) RequireVerifiedEmail(us UserService, allowedPaths ...string) func(http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(allowedPaths))
+	for _, path := range allowedPaths {
+		allowed[path] = true
+	}
 
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if allowed[r.URL.Path] {
 				next.ServeHTTP(w, r)
-			})).ServeHTTP(w, r)
+				return
+			}
+
+			// 从上下文获取用户
+			user, ok := GetUserFromContext(r.Context())
+			if !ok {
+				m.unauthorized(w, r, errorcodes.ErrCodeUnauthenticated, "缺少认证信息")
+				return
+			}
+
+			current, err := us.GetUserByID(user.ID)
+			if err != nil {
+				writeErrorCode(w, errorcodes.ErrCodeInternal, "用户信息获取失败")
+				return
+			}
+
+			if !current.EmailVerified {
+				m.forbidden(w, r, errorcodes.ErrCodeEmailUnverified, "邮箱未验证")
+				return
+			}
+
+			next.ServeHTTP(w, r)
 		})
 	}
 }
 
-// RequireRole 需要特定角色的中间件
-func (m *AuthMiddleware) RequireRole(roleName string, roleService RoleService) func(http.Handler) http.Handler {
+// RefreshClaimsFromDB 从数据库加载实时角色权限并写入上下文的中间件，需在RequireAuth之后使用
+//
+// Token只用于确认身份，处理器通过GetAuthorizationFromContext读取的角色权限始终以数据库为准，
+// 覆盖上下文中已有的角色权限。通过SetClaimsCacheTTL开启缓存，缓存的角色权限为共享只读数据。
+func (m *AuthMiddleware) RefreshClaimsFromDB(rs RoleService) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// 先进行认证
-			m.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				// 从上下文获取用户
-				user, ok := r.Context().Value(UserContextKey).(*User)
-				if !ok {
-					http.Error(w, "用户信息获取失败", http.StatusInternalServerError)
-					return
-				}
+			// 从上下文获取用户
+			user, ok := GetUserFromContext(r.Context())
+			if !ok {
+				m.unauthorized(w, r, errorcodes.ErrCodeUnauthenticated, "缺少认证信息")
+				return
+			}
 
-				// 检查角色
-				hasRole, err := roleService.HasRole(user.ID, roleName)
+			cache := m.claimsCache
+			var claims *AuthorizationClaims
+			var cached bool
+			if cache != nil {
+				claims, cached = cache.Get(user.ID)
+			}
+			if !cached {
+				loaded, err := loadAuthorizationClaims(rs, user.ID)
 				if err != nil {
-					http.Error(w, "角色检查失败", http.StatusInternalServerError)
+					writeErrorCode(w, errorcodes.ErrCodeInternal, "权限信息获取失败")
 					return
 				}
-
-				if !hasRole {
-					http.Error(w, "角色权限不足", http.StatusForbidden)
-					return
+				claims = loaded
+				if cache != nil {
+					cache.Set(claims)
 				}
+			}
 
-				next.ServeHTTP(w, r)
-			})).ServeHTTP(w, r)
+			ctx := context.WithValue(r.Context(), AuthorizationContextKey, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// unauthorized 写入未认证响应，配置了OnUnauthorized时交给它处理
+func (m *AuthMiddleware) unauthorized(w http.ResponseWriter, r *http.Request, code, message string) {
+	if m.OnUnauthorized != nil {
+		m.OnUnauthorized(w, r)
+		return
+	}
+	writeErrorCode(w, code, message)
+}
+
+// forbidden 写入权限不足响应，配置了OnForbidden时交给它处理
+func (m *AuthMiddleware) forbidden(w http.ResponseWriter, r *http.Request, code, message string) {
+	if m.OnForbidden != nil {
+		m.OnForbidden(w, r)
+		return
+	}
+	writeErrorCode(w, code, message)
+}
+
 // GetUserFromContext 从上下文获取用户信息
 func GetUserFromContext(ctx context.Context) (*User, bool) {
 	user, ok := ctx.Value(UserContextKey).(*User)
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"aigo_service_auth/testfixtures"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	// 设置测试数据库
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	userService := NewUserService(testDB.DB)
+	tokenService := NewTokenService(testfixtures.DefaultSecretKey, time.Hour)
+	authService := NewAuthService(testDB.DB, userService, tokenService)
+	middleware := NewAuthMiddleware(authService)
+	fixture := testfixtures.NewFixture(testDB.DB)
+
+	handler := middleware.RequireAuth(
+		middleware.RequireVerifiedEmail(userService, "/resend-verification")(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}),
+		),
+	)
+
+	request := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	t.Run("未验证邮箱的用户被拒绝", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		// 夹具的密码哈希可直接用于登录
+		user := fixture.User("testuser").WithPassword("testpassword123").MustBuild(t)
+		_, token, err := authService.Login(user.User.Username, user.Password)
+		assert.NoError(t, err)
+
+		recorder := request("/profile", token)
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), `"code":"email_unverified"`)
+
+		// 白名单中的路由仍可访问
+		recorder = request("/resend-verification", token)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	})
+
+	t.Run("已验证邮箱的用户通过", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		user := fixture.User("testuser").MustBuild(t)
+
+		// Token签发后才完成验证，中间件应读取最新状态
+		err := testDB.DB.Model(&User{}).Where("id = ?", user.User.ID).Update("email_verified", true).Error
+		assert.NoError(t, err)
+
+		recorder := request("/profile", user.Token)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	})
+
+	t.Run("缺少认证上下文", func(t *testing.T) {
+		unauthenticated := middleware.RequireVerifiedEmail(userService)(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}),
+		)
+
+		recorder := httptest.NewRecorder()
+		unauthenticated.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/profile", nil))
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+}
+
+// stubAuthService 测试用认证服务，只接受固定的Token
+type stubAuthService struct {
+	AuthService
+	user  *User
+	calls int // ValidateToken调用次数
+}
+
+func (s *stubAuthService) ValidateToken(token string) (*User, error) {
+	s.calls++
+	if token != "valid-token" {
+		return nil, errors.New("无效的token")
+	}
+	return s.user, nil
+}
+
+// checkRoleService 测试用角色服务，权限和角色检查返回预设结果
+type checkRoleService struct {
+	RoleService
+	allowed bool
+	err     error
+}
+
+func (s *checkRoleService) HasPermission(userID uint, resource, action string) (bool, error) {
+	return s.allowed, s.err
+}
+
+func (s *checkRoleService) HasRole(userID uint, roleName string) (bool, error) {
+	return s.allowed, s.err
+}
+
+func TestAuthorizationMiddlewareFailClosed(t *testing.T) {
+	user := &User{Username: "testuser"}
+	user.ID = 1
+
+	// serve 使用指定的认证服务和角色服务请求两个中间件，返回响应码和处理器是否被调用
+	serve := func(authService AuthService, roleService RoleService, token string) map[string]int {
+		middleware := NewAuthMiddleware(authService)
+		codes := make(map[string]int)
+		for name, wrap := range map[string]func(http.Handler) http.Handler{
+			"permission": middleware.RequirePermission("users", "read", roleService),
+			"role":       middleware.RequireRole("admin", roleService),
+		} {
+			called := false
+			handler := wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			codes[name] = recorder.Code
+			if called != (recorder.Code == http.StatusOK) {
+				t.Errorf("%s: 响应码%d与处理器调用状态%v不一致", name, recorder.Code, called)
+			}
+		}
+		return codes
+	}
+
+	t.Run("检查通过时调用处理器", func(t *testing.T) {
+		codes := serve(&stubAuthService{user: user}, &checkRoleService{allowed: true}, "valid-token")
+		assert.Equal(t, map[string]int{"permission": http.StatusOK, "role": http.StatusOK}, codes)
+	})
+
+	t.Run("检查不通过时返回403", func(t *testing.T) {
+		codes := serve(&stubAuthService{user: user}, &checkRoleService{allowed: false}, "valid-token")
+		assert.Equal(t, map[string]int{"permission": http.StatusForbidden, "role": http.StatusForbidden}, codes)
+	})
+
+	t.Run("角色服务出错时返回500且不调用处理器", func(t *testing.T) {
+		// 即使出错时返回了true，也不能放行
+		roleService := &checkRoleService{allowed: true, err: errors.New("数据库连接失败")}
+		codes := serve(&stubAuthService{user: user}, roleService, "valid-token")
+		assert.Equal(t, map[string]int{"permission": http.StatusInternalServerError, "role": http.StatusInternalServerError}, codes)
+	})
+
+	t.Run("上下文中没有用户时返回500", func(t *testing.T) {
+		codes := serve(&stubAuthService{user: nil}, &checkRoleService{allowed: true}, "valid-token")
+		assert.Equal(t, map[string]int{"permission": http.StatusInternalServerError, "role": http.StatusInternalServerError}, codes)
+	})
+
+	t.Run("未配置角色服务时返回500", func(t *testing.T) {
+		codes := serve(&stubAuthService{user: user}, nil, "valid-token")
+		assert.Equal(t, map[string]int{"permission": http.StatusInternalServerError, "role": http.StatusInternalServerError}, codes)
+	})
+
+	t.Run("认证失败时返回401", func(t *testing.T) {
+		codes := serve(&stubAuthService{user: user}, &checkRoleService{allowed: true}, "bad-token")
+		assert.Equal(t, map[string]int{"permission": http.StatusUnauthorized, "role": http.StatusUnauthorized}, codes)
+	})
+}
+
+func TestRequireSelfOrPermission(t *testing.T) {
+	user := &User{Username: "testuser"}
+	user.ID = 7
+
+	// serve 通过路由请求/users/{id}/profile，返回响应码和处理器是否被调用
+	serve := func(roleService RoleService, target, token string) (int, bool) {
+		middleware := NewAuthMiddleware(&stubAuthService{user: user})
+		called := false
+		mux := http.NewServeMux()
+		mux.Handle("GET /users/{id}/profile", middleware.RequireSelfOrPermission("id", "user", "read", roleService)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			w.WriteHeader(http.StatusOK)
+		})))
+
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, req)
+		return recorder.Code, called
+	}
+
+	t.Run("访问自己的资源时不检查权限", func(t *testing.T) {
+		code, called := serve(nil, "/users/7/profile", "valid-token")
+		assert.Equal(t, http.StatusOK, code)
+		assert.True(t, called)
+	})
+
+	t.Run("访问他人的资源需要权限", func(t *testing.T) {
+		code, called := serve(&checkRoleService{allowed: true}, "/users/8/profile", "valid-token")
+		assert.Equal(t, http.StatusOK, code)
+		assert.True(t, called)
+
+		code, called = serve(&checkRoleService{allowed: false}, "/users/8/profile", "valid-token")
+		assert.Equal(t, http.StatusForbidden, code)
+		assert.False(t, called)
+	})
+
+	t.Run("权限检查出错时拒绝", func(t *testing.T) {
+		code, called := serve(&checkRoleService{allowed: true, err: errors.New("数据库连接失败")}, "/users/8/profile", "valid-token")
+		assert.Equal(t, http.StatusInternalServerError, code)
+		assert.False(t, called)
+
+		code, _ = serve(nil, "/users/8/profile", "valid-token")
+		assert.Equal(t, http.StatusInternalServerError, code)
+	})
+
+	t.Run("无效的用户ID", func(t *testing.T) {
+		for _, target := range []string{"/users/abc/profile", "/users/0/profile", "/users/-7/profile"} {
+			code, called := serve(&checkRoleService{allowed: true}, target, "valid-token")
+			assert.Equal(t, http.StatusBadRequest, code, target)
+			assert.False(t, called)
+		}
+	})
+
+	t.Run("认证失败时返回401", func(t *testing.T) {
+		code, called := serve(&checkRoleService{allowed: true}, "/users/7/profile", "bad-token")
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.False(t, called)
+	})
+}
+
+func TestRequireAuthTokenLimits(t *testing.T) {
+	user := &User{Username: "testuser"}
+	user.ID = 1
+
+	serve := func(middleware *AuthMiddleware, header string) int {
+		handler := middleware.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", header)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	t.Run("认证方案不区分大小写", func(t *testing.T) {
+		authService := &stubAuthService{user: user}
+		middleware := NewAuthMiddleware(authService)
+		for _, scheme := range []string{"Bearer", "bearer", "BEARER"} {
+			assert.Equal(t, http.StatusOK, serve(middleware, scheme+" valid-token"), scheme)
+		}
+		assert.Equal(t, http.StatusUnauthorized, serve(middleware, "Basic valid-token"))
+		assert.Equal(t, 3, authService.calls)
+	})
+
+	t.Run("超长Token在验证前拒绝", func(t *testing.T) {
+		authService := &stubAuthService{user: user}
+		middleware := NewAuthMiddleware(authService)
+
+		assert.Equal(t, http.StatusUnauthorized, serve(middleware, "Bearer "+strings.Repeat("a", 10<<20)))
+		assert.Equal(t, http.StatusUnauthorized, serve(middleware, "Bearer "+strings.Repeat("a", DefaultMaxTokenLength+1)))
+		assert.Equal(t, 0, authService.calls)
+
+		// 未超过上限的Token照常交给认证服务
+		assert.Equal(t, http.StatusUnauthorized, serve(middleware, "Bearer "+strings.Repeat("a", DefaultMaxTokenLength)))
+		assert.Equal(t, 1, authService.calls)
+
+		middleware.SetMaxTokenLength(16)
+		assert.Equal(t, http.StatusUnauthorized, serve(middleware, "Bearer "+strings.Repeat("a", 17)))
+		assert.Equal(t, 1, authService.calls)
+		assert.Equal(t, http.StatusOK, serve(middleware, "Bearer valid-token"))
+	})
+
+	t.Run("格式明显错误的Token在验证前拒绝", func(t *testing.T) {
+		authService := &stubAuthService{user: user}
+		middleware := NewAuthMiddleware(authService)
+
+		for _, token := range []string{"a.b", "a.b.c.d", "a..c", "a+b/c==", "valid token"} {
+			assert.Equal(t, http.StatusUnauthorized, serve(middleware, "Bearer "+token), token)
+		}
+		assert.Equal(t, 0, authService.calls)
+	})
+}
+
+func TestAuthMiddlewareResponseHooks(t *testing.T) {
+	user := &User{Username: "testuser"}
+	user.ID = 1
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	serve := func(handler http.Handler, authHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		if authHeader != "" {
+			req.Header.Set("Authorization", authHeader)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	t.Run("默认返回JSON错误", func(t *testing.T) {
+		middleware := NewAuthMiddleware(&stubAuthService{user: user})
+
+		recorder := serve(middleware.RequireAuth(ok), "")
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), `"code":"unauthenticated"`)
+
+		recorder = serve(middleware.RequireRole("admin", &checkRoleService{allowed: false})(ok), "Bearer valid-token")
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), `"code":"permission_denied"`)
+	})
+
+	t.Run("未认证时重定向到登录页", func(t *testing.T) {
+		middleware := NewAuthMiddleware(&stubAuthService{user: user})
+		middleware.OnUnauthorized = func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/login?next="+r.URL.Path, http.StatusFound)
+		}
+
+		for _, authHeader := range []string{"", "Basic abc", "Bearer bad-token"} {
+			recorder := serve(middleware.RequireAuth(ok), authHeader)
+			assert.Equal(t, http.StatusFound, recorder.Code, authHeader)
+			assert.Equal(t, "/login?next=/admin", recorder.Header().Get("Location"), authHeader)
+		}
+
+		// 权限检查前的认证失败同样使用该钩子
+		recorder := serve(middleware.RequirePermission("users", "read", &checkRoleService{allowed: true})(ok), "")
+		assert.Equal(t, http.StatusFound, recorder.Code)
+	})
+
+	t.Run("权限不足时使用自定义响应", func(t *testing.T) {
+		middleware := NewAuthMiddleware(&stubAuthService{user: user})
+		middleware.OnForbidden = func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("<h1>无权访问</h1>"))
+		}
+
+		for _, handler := range []http.Handler{
+			middleware.RequirePermission("users", "read", &checkRoleService{allowed: false})(ok),
+			middleware.RequireRole("admin", &checkRoleService{allowed: false})(ok),
+		} {
+			recorder := serve(handler, "Bearer valid-token")
+			assert.Equal(t, http.StatusForbidden, recorder.Code)
+			assert.Equal(t, "<h1>无权访问</h1>", recorder.Body.String())
+		}
+
+		// 检查出错仍返回500，不视为权限不足
+		roleService := &checkRoleService{err: errors.New("数据库连接失败")}
+		recorder := serve(middleware.RequireRole("admin", roleService)(ok), "Bearer valid-token")
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	})
+
+	t.Run("其他中间件和处理器同样使用钩子", func(t *testing.T) {
+		middleware := NewAuthMiddleware(&stubAuthService{user: user})
+		middleware.OnUnauthorized = func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}
+		middleware.OnForbidden = func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusPaymentRequired)
+		}
+		tokens := NewTokenService("test-secret-key", time.Hour)
+		passwordOnly, err := tokens.GenerateTokenForUser(user)
+		assert.NoError(t, err)
+		unverified := &stubUserLookup{user: &User{Username: "testuser"}}
+
+		// 上下文中没有用户、Token无效或用户已删除
+		for name, recorder := range map[string]*httptest.ResponseRecorder{
+			"RequireMFA缺少Token":    serve(middleware.RequireMFA(tokens)(ok), ""),
+			"RequireMFA无效Token":    serve(middleware.RequireMFA(tokens)(ok), "Bearer bad-token"),
+			"RequireTermsAccepted": serve(middleware.RequireTermsAccepted(unverified, "v2")(ok), ""),
+			"RequireActionToken":   serve(middleware.RequireActionToken(nil, "delete_account")(ok), ""),
+			"RequireVerifiedEmail": serve(middleware.RequireVerifiedEmail(unverified)(ok), ""),
+			"WhoAmIHandler缺少用户":    serve(middleware.WhoAmIHandler(unverified), ""),
+			"WhoAmIHandler用户已删除":   serve(middleware.RequireAuth(middleware.WhoAmIHandler(&stubUserLookup{err: ErrUserNotFound})), "Bearer valid-token"),
+		} {
+			assert.Equal(t, http.StatusTeapot, recorder.Code, name)
+		}
+
+		// 已认证但未完成多因素认证或邮箱未验证
+		for name, recorder := range map[string]*httptest.ResponseRecorder{
+			"RequireMFA":           serve(middleware.RequireMFA(tokens)(ok), "Bearer "+passwordOnly),
+			"RequireVerifiedEmail": serve(middleware.RequireAuth(middleware.RequireVerifiedEmail(unverified)(ok)), "Bearer valid-token"),
+		} {
+			assert.Equal(t, http.StatusPaymentRequired, recorder.Code, name)
+		}
+	})
+}
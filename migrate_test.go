@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"aigo_service_auth/migrations"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrations(t *testing.T) {
+	// 设置测试数据库，SetupTestDB在清空的数据库上执行全部迁移
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	applied := func() []migrations.SchemaMigration {
+		records, err := migrations.Applied(testDB.DB)
+		assert.NoError(t, err)
+		return records
+	}
+
+	t.Run("迁移创建全部表", func(t *testing.T) {
+		for _, model := range []interface{}{&User{}, &Role{}, &Permission{}, &UserRole{}, &RolePermission{},
+			&PasswordResetCode{}, &VerificationCode{}, &KnownDevice{}, &TokenWatermark{}, &Session{}, &TenantLimits{},
+			&UserTOTP{}, &RecoveryCode{}, &PasswordHistory{}} {
+			assert.True(t, testDB.DB.Migrator().HasTable(model))
+		}
+		for _, field := range []string{"FailedLoginAttempts", "LockedUntil", "TokenSalt", "AcceptedTermsVersion", "AcceptedTermsAt", "LastFailedLoginAt", "TenantID", "EmailCanonical", "DormancyExempt", "DormancyWarnedAt", "DormancyDisabledAt", "HashAlgo"} {
+			assert.True(t, testDB.DB.Migrator().HasColumn(&User{}, field))
+		}
+		assert.NotEmpty(t, applied())
+
+		// 重复执行不做任何操作
+		count := len(applied())
+		assert.NoError(t, InitDatabase(testDB.DB))
+		assert.Len(t, applied(), count)
+	})
+
+	t.Run("回滚一步后重新迁移", func(t *testing.T) {
+		count := len(applied())
+
+		assert.NoError(t, migrations.Rollback(testDB.DB, 1))
+		assert.Len(t, applied(), count-1)
+		if count == 1 {
+			assert.False(t, testDB.DB.Migrator().HasTable(&User{}))
+		}
+
+		assert.NoError(t, migrations.Migrate(testDB.DB))
+		assert.Len(t, applied(), count)
+		assert.True(t, testDB.DB.Migrator().HasTable(&User{}))
+
+		// 迁移后的表可以正常使用
+		user := testDB.CreateTestUser("migrated", "migrated@example.com", "password")
+		assert.NotZero(t, user.ID)
+	})
+
+	t.Run("无效的回滚步数", func(t *testing.T) {
+		assert.True(t, errors.Is(migrations.Rollback(testDB.DB, 0), migrations.ErrInvalidSteps))
+	})
+
+	t.Run("数据库中存在未知版本", func(t *testing.T) {
+		assert.NoError(t, testDB.DB.Create(&migrations.SchemaMigration{Version: 9999, Name: "from_newer_release"}).Error)
+		defer testDB.DB.Delete(&migrations.SchemaMigration{}, 9999)
+
+		assert.True(t, errors.Is(migrations.Migrate(testDB.DB), migrations.ErrUnknownMigration))
+		assert.True(t, errors.Is(migrations.Rollback(testDB.DB, 1), migrations.ErrUnknownMigration))
+	})
+}
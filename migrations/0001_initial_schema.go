@@ -0,0 +1,147 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// initialSchema 初始表结构，与引入迁移前InitDatabase的AutoMigrate结果一致
+//
+// 已由AutoMigrate创建的数据库执行该迁移时只补齐缺少的表、列和索引，不影响已有数据。
+var initialSchema = &Migration{
+	Version: 1,
+	Name:    "initial_schema",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(
+			&user0001{},
+			&role0001{},
+			&permission0001{},
+			&userRole0001{},
+			&rolePermission0001{},
+			&passwordResetCode0001{},
+			&verificationCode0001{},
+			&knownDevice0001{},
+		)
+	},
+	Down: func(tx *gorm.DB) error {
+		// 先删除关联表，再删除被引用的表
+		return tx.Migrator().DropTable(
+			&knownDevice0001{},
+			&verificationCode0001{},
+			&passwordResetCode0001{},
+			&rolePermission0001{},
+			&userRole0001{},
+			&permission0001{},
+			&role0001{},
+			&user0001{},
+		)
+	},
+}
+
+// user0001 用户表快照
+type user0001 struct {
+	gorm.Model
+	Username          string `gorm:"size:50;uniqueIndex;not null"`
+	Email             string `gorm:"size:100;uniqueIndex;not null"`
+	PasswordHash      string `gorm:"size:255;not null"`
+	Phone             string `gorm:"size:255"`
+	PhoneHash         string `gorm:"size:64;index"`
+	Avatar            string `gorm:"size:255"`
+	Status            uint8  `gorm:"default:1;comment:'1-正常,2-禁用'"`
+	LastLoginAt       *time.Time
+	InvitationCode    string `gorm:"size:50;index"`
+	InvitedBy         uint   `gorm:"index"`
+	EmailVerified     bool   `gorm:"default:false"`
+	SuspendedUntil    *time.Time
+	SuspensionReason  string `gorm:"size:255"`
+	PasswordChangedAt *time.Time
+}
+
+func (user0001) TableName() string { return "sys_users" }
+
+// role0001 角色表快照
+type role0001 struct {
+	gorm.Model
+	Name        string `gorm:"size:50;uniqueIndex;not null"`
+	DisplayName string `gorm:"size:100;not null"`
+	Description string `gorm:"size:255"`
+	Status      uint8  `gorm:"default:1;comment:'1-正常,2-禁用'"`
+}
+
+func (role0001) TableName() string { return "sys_roles" }
+
+// permission0001 权限表快照
+type permission0001 struct {
+	gorm.Model
+	Name        string `gorm:"size:100;uniqueIndex;not null"`
+	DisplayName string `gorm:"size:100;not null"`
+	Resource    string `gorm:"size:100;not null"`
+	Action      string `gorm:"size:50;not null"`
+	Description string `gorm:"size:255"`
+}
+
+func (permission0001) TableName() string { return "sys_permissions" }
+
+// userRole0001 用户角色关联表快照，关联字段用于生成外键
+type userRole0001 struct {
+	ID        uint `gorm:"primaryKey"`
+	UserID    uint `gorm:"not null;index"`
+	RoleID    uint `gorm:"not null;index"`
+	CreatedAt time.Time
+	User      user0001 `gorm:"foreignKey:UserID"`
+	Role      role0001 `gorm:"foreignKey:RoleID"`
+}
+
+func (userRole0001) TableName() string { return "sys_user_roles" }
+
+// rolePermission0001 角色权限关联表快照，关联字段用于生成外键
+type rolePermission0001 struct {
+	ID           uint `gorm:"primaryKey"`
+	RoleID       uint `gorm:"not null;index"`
+	PermissionID uint `gorm:"not null;index"`
+	CreatedAt    time.Time
+	Role         role0001       `gorm:"foreignKey:RoleID"`
+	Permission   permission0001 `gorm:"foreignKey:PermissionID"`
+}
+
+func (rolePermission0001) TableName() string { return "sys_role_permissions" }
+
+// passwordResetCode0001 密码重置码表快照
+type passwordResetCode0001 struct {
+	ID           uint      `gorm:"primaryKey"`
+	UserID       uint      `gorm:"not null;index"`
+	Selector     string    `gorm:"size:32;uniqueIndex;not null"`
+	VerifierHash string    `gorm:"size:64;not null"`
+	ExpiresAt    time.Time `gorm:"not null;index"`
+	UsedAt       *time.Time
+	CreatedAt    time.Time
+}
+
+func (passwordResetCode0001) TableName() string { return "sys_password_reset_codes" }
+
+// verificationCode0001 验证码表快照
+type verificationCode0001 struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_verification_user_purpose"`
+	Purpose   string    `gorm:"size:50;not null;uniqueIndex:idx_verification_user_purpose"`
+	CodeHash  string    `gorm:"size:64;not null"`
+	Attempts  int       `gorm:"not null;default:0"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+}
+
+func (verificationCode0001) TableName() string { return "sys_verification_codes" }
+
+// knownDevice0001 已知设备表快照
+type knownDevice0001 struct {
+	ID          uint      `gorm:"primaryKey"`
+	UserID      uint      `gorm:"not null;uniqueIndex:idx_known_device_user_fingerprint"`
+	Fingerprint string    `gorm:"size:64;not null;uniqueIndex:idx_known_device_user_fingerprint"`
+	UserAgent   string    `gorm:"size:512"`
+	LastIP      string    `gorm:"size:64"`
+	FirstSeenAt time.Time `gorm:"not null"`
+	LastSeenAt  time.Time `gorm:"not null"`
+}
+
+func (knownDevice0001) TableName() string { return "sys_known_devices" }
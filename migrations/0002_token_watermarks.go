@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// tokenWatermarks 新增Token签发时间水位线表
+var tokenWatermarks = &Migration{
+	Version: 2,
+	Name:    "token_watermarks",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&tokenWatermark0002{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&tokenWatermark0002{})
+	},
+}
+
+// tokenWatermark0002 Token水位线表快照
+type tokenWatermark0002 struct {
+	UserID    uint      `gorm:"primaryKey;autoIncrement:false"`
+	Cutoff    time.Time `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+func (tokenWatermark0002) TableName() string { return "sys_token_watermarks" }
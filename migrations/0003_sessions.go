@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// sessions 新增不透明会话Token使用的会话表
+var sessions = &Migration{
+	Version: 3,
+	Name:    "sessions",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&session0003{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&session0003{})
+	},
+}
+
+// session0003 会话表快照
+type session0003 struct {
+	ID                uint      `gorm:"primaryKey"`
+	TokenHash         string    `gorm:"size:64;uniqueIndex;not null"`
+	UserID            uint      `gorm:"not null;index"`
+	PasswordChangedAt int64     `gorm:"not null;default:0"`
+	ExpiresAt         time.Time `gorm:"not null;index"`
+	CreatedAt         time.Time
+}
+
+func (session0003) TableName() string { return "sys_sessions" }
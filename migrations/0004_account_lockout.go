@@ -0,0 +1,43 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// accountLockout 用户表新增连续登录失败次数和锁定截止时间
+var accountLockout = &Migration{
+	Version: 4,
+	Name:    "account_lockout",
+	Up: func(tx *gorm.DB) error {
+		for _, field := range userLockoutFields0004 {
+			if tx.Migrator().HasColumn(&userLockout0004{}, field) {
+				continue
+			}
+			if err := tx.Migrator().AddColumn(&userLockout0004{}, field); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		for _, field := range userLockoutFields0004 {
+			if err := tx.Migrator().DropColumn(&userLockout0004{}, field); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// userLockoutFields0004 该迁移新增的列
+var userLockoutFields0004 = []string{"FailedLoginAttempts", "LockedUntil"}
+
+// userLockout0004 用户表新增列快照
+type userLockout0004 struct {
+	FailedLoginAttempts int `gorm:"not null;default:0"`
+	LockedUntil         *time.Time
+}
+
+func (userLockout0004) TableName() string { return "sys_users" }
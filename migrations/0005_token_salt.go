@@ -0,0 +1,25 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// tokenSalt 用户表新增按用户派生JWT签名密钥的盐值
+var tokenSalt = &Migration{
+	Version: 5,
+	Name:    "token_salt",
+	Up: func(tx *gorm.DB) error {
+		if tx.Migrator().HasColumn(&userTokenSalt0005{}, "TokenSalt") {
+			return nil
+		}
+		return tx.Migrator().AddColumn(&userTokenSalt0005{}, "TokenSalt")
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropColumn(&userTokenSalt0005{}, "TokenSalt")
+	},
+}
+
+// userTokenSalt0005 用户表新增列快照
+type userTokenSalt0005 struct {
+	TokenSalt string `gorm:"size:64;not null;default:''"`
+}
+
+func (userTokenSalt0005) TableName() string { return "sys_users" }
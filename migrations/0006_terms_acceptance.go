@@ -0,0 +1,43 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// termsAcceptance 用户表新增已同意的服务条款版本和同意时间
+var termsAcceptance = &Migration{
+	Version: 6,
+	Name:    "terms_acceptance",
+	Up: func(tx *gorm.DB) error {
+		for _, field := range userTermsFields0006 {
+			if tx.Migrator().HasColumn(&userTerms0006{}, field) {
+				continue
+			}
+			if err := tx.Migrator().AddColumn(&userTerms0006{}, field); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		for _, field := range userTermsFields0006 {
+			if err := tx.Migrator().DropColumn(&userTerms0006{}, field); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// userTermsFields0006 该迁移新增的列
+var userTermsFields0006 = []string{"AcceptedTermsVersion", "AcceptedTermsAt"}
+
+// userTerms0006 用户表新增列快照
+type userTerms0006 struct {
+	AcceptedTermsVersion string `gorm:"size:50;not null;default:''"`
+	AcceptedTermsAt      *time.Time
+}
+
+func (userTerms0006) TableName() string { return "sys_users" }
@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// lastFailedLogin 用户表新增最近一次密码错误的时间，用于让错误计数在一段时间后重新开始
+var lastFailedLogin = &Migration{
+	Version: 7,
+	Name:    "last_failed_login",
+	Up: func(tx *gorm.DB) error {
+		if tx.Migrator().HasColumn(&userLastFailedLogin0007{}, "LastFailedLoginAt") {
+			return nil
+		}
+		return tx.Migrator().AddColumn(&userLastFailedLogin0007{}, "LastFailedLoginAt")
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropColumn(&userLastFailedLogin0007{}, "LastFailedLoginAt")
+	},
+}
+
+// userLastFailedLogin0007 用户表新增列快照
+type userLastFailedLogin0007 struct {
+	LastFailedLoginAt *time.Time
+}
+
+func (userLastFailedLogin0007) TableName() string { return "sys_users" }
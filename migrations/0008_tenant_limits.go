@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// tenantLimits 用户表新增租户ID，新增租户限额表
+var tenantLimits = &Migration{
+	Version: 8,
+	Name:    "tenant_limits",
+	Up: func(tx *gorm.DB) error {
+		if !tx.Migrator().HasColumn(&userTenant0008{}, "TenantID") {
+			if err := tx.Migrator().AddColumn(&userTenant0008{}, "TenantID"); err != nil {
+				return err
+			}
+		}
+		if !tx.Migrator().HasIndex(&userTenant0008{}, "TenantID") {
+			if err := tx.Migrator().CreateIndex(&userTenant0008{}, "TenantID"); err != nil {
+				return err
+			}
+		}
+		return tx.AutoMigrate(&tenantLimits0008{})
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropTable(&tenantLimits0008{}); err != nil {
+			return err
+		}
+		if err := tx.Migrator().DropIndex(&userTenant0008{}, "TenantID"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&userTenant0008{}, "TenantID")
+	},
+}
+
+// userTenant0008 用户表新增列快照
+type userTenant0008 struct {
+	TenantID uint `gorm:"not null;default:0;index"`
+}
+
+func (userTenant0008) TableName() string { return "sys_users" }
+
+// tenantLimits0008 租户限额表快照
+type tenantLimits0008 struct {
+	TenantID          uint `gorm:"primaryKey;autoIncrement:false"`
+	MaxUsers          int  `gorm:"not null;default:0"`
+	MaxActiveSessions int  `gorm:"not null;default:0"`
+	OverrideUntil     *time.Time
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+func (tenantLimits0008) TableName() string { return "sys_tenant_limits" }
@@ -0,0 +1,33 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// emailCanonical 用户表新增邮箱规范形式，用于启用邮箱规范化后的唯一性检查和查询
+var emailCanonical = &Migration{
+	Version: 9,
+	Name:    "email_canonical",
+	Up: func(tx *gorm.DB) error {
+		if !tx.Migrator().HasColumn(&userEmailCanonical0009{}, "EmailCanonical") {
+			if err := tx.Migrator().AddColumn(&userEmailCanonical0009{}, "EmailCanonical"); err != nil {
+				return err
+			}
+		}
+		if !tx.Migrator().HasIndex(&userEmailCanonical0009{}, "EmailCanonical") {
+			return tx.Migrator().CreateIndex(&userEmailCanonical0009{}, "EmailCanonical")
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropIndex(&userEmailCanonical0009{}, "EmailCanonical"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&userEmailCanonical0009{}, "EmailCanonical")
+	},
+}
+
+// userEmailCanonical0009 用户表新增列快照
+type userEmailCanonical0009 struct {
+	EmailCanonical string `gorm:"size:100;index;not null;default:''"`
+}
+
+func (userEmailCanonical0009) TableName() string { return "sys_users" }
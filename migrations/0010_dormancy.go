@@ -0,0 +1,44 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// dormancy 用户表新增长期未登录策略的豁免标记、预警时间和禁用时间
+var dormancy = &Migration{
+	Version: 10,
+	Name:    "dormancy",
+	Up: func(tx *gorm.DB) error {
+		for _, field := range userDormancyFields0010 {
+			if tx.Migrator().HasColumn(&userDormancy0010{}, field) {
+				continue
+			}
+			if err := tx.Migrator().AddColumn(&userDormancy0010{}, field); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		for _, field := range userDormancyFields0010 {
+			if err := tx.Migrator().DropColumn(&userDormancy0010{}, field); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// userDormancyFields0010 该迁移新增的列
+var userDormancyFields0010 = []string{"DormancyExempt", "DormancyWarnedAt", "DormancyDisabledAt"}
+
+// userDormancy0010 用户表新增列快照
+type userDormancy0010 struct {
+	DormancyExempt     bool `gorm:"not null;default:false"`
+	DormancyWarnedAt   *time.Time
+	DormancyDisabledAt *time.Time
+}
+
+func (userDormancy0010) TableName() string { return "sys_users" }
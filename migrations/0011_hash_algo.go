@@ -0,0 +1,40 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// hashAlgo 用户表新增密码哈希算法，按现有哈希的格式回填，无法识别的按旧格式记录
+var hashAlgo = &Migration{
+	Version: 11,
+	Name:    "hash_algo",
+	Up: func(tx *gorm.DB) error {
+		if !tx.Migrator().HasColumn(&userHashAlgo0011{}, "HashAlgo") {
+			if err := tx.Migrator().AddColumn(&userHashAlgo0011{}, "HashAlgo"); err != nil {
+				return err
+			}
+		}
+		if !tx.Migrator().HasIndex(&userHashAlgo0011{}, "HashAlgo") {
+			if err := tx.Migrator().CreateIndex(&userHashAlgo0011{}, "HashAlgo"); err != nil {
+				return err
+			}
+		}
+		// 只回填未记录的行，重复执行或与新版本实例并行时不会覆盖已记录的算法
+		return tx.Exec(`UPDATE sys_users SET hash_algo = CASE
+			WHEN password_hash LIKE '$argon2id$%' THEN 'argon2id'
+			WHEN password_hash LIKE '$2a$%' OR password_hash LIKE '$2b$%' OR password_hash LIKE '$2y$%' THEN 'bcrypt'
+			ELSE 'argon2_legacy' END
+			WHERE hash_algo = '' AND password_hash <> ''`).Error
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropIndex(&userHashAlgo0011{}, "HashAlgo"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&userHashAlgo0011{}, "HashAlgo")
+	},
+}
+
+// userHashAlgo0011 用户表新增列快照
+type userHashAlgo0011 struct {
+	HashAlgo string `gorm:"size:20;index;not null;default:''"`
+}
+
+func (userHashAlgo0011) TableName() string { return "sys_users" }
@@ -0,0 +1,43 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// userMFA 新增TOTP二次验证设置表和恢复码表
+var userMFA = &Migration{
+	Version: 12,
+	Name:    "user_mfa",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&userTOTP0012{}, &recoveryCode0012{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&recoveryCode0012{}, &userTOTP0012{})
+	},
+}
+
+// userTOTP0012 TOTP设置表快照
+type userTOTP0012 struct {
+	ID           uint   `gorm:"primaryKey"`
+	UserID       uint   `gorm:"not null;uniqueIndex"`
+	Secret       string `gorm:"size:255;not null"`
+	Enabled      bool   `gorm:"not null;default:false"`
+	LastUsedStep int64  `gorm:"not null;default:0"`
+	EnabledAt    *time.Time
+	CreatedAt    time.Time
+}
+
+func (userTOTP0012) TableName() string { return "sys_user_mfa" }
+
+// recoveryCode0012 恢复码表快照
+type recoveryCode0012 struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;uniqueIndex:idx_recovery_code_user_hash"`
+	CodeHash  string `gorm:"size:64;not null;uniqueIndex:idx_recovery_code_user_hash"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+func (recoveryCode0012) TableName() string { return "sys_user_recovery_codes" }
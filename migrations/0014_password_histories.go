@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// passwordHistories 新增密码历史表，替代只保存在内存中的历史记录
+var passwordHistories = &Migration{
+	Version: 14,
+	Name:    "password_histories",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&passwordHistory0014{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&passwordHistory0014{})
+	},
+}
+
+// passwordHistory0014 密码历史表快照
+type passwordHistory0014 struct {
+	ID           uint      `gorm:"primaryKey"`
+	UserID       uint      `gorm:"not null;index:idx_password_history_user_created"`
+	PasswordHash string    `gorm:"size:255;not null"`
+	CreatedAt    time.Time `gorm:"index:idx_password_history_user_created"`
+}
+
+func (passwordHistory0014) TableName() string { return "sys_password_histories" }
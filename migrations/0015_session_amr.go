@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+// sessionAMR 会话表新增登录认证方式，RequireMFA据此判断会话是否完成了多因素认证
+var sessionAMR = &Migration{
+	Version: 15,
+	Name:    "session_amr",
+	Up: func(tx *gorm.DB) error {
+		if tx.Migrator().HasColumn(&sessionAMR0015{}, "AMR") {
+			return nil
+		}
+		return tx.Migrator().AddColumn(&sessionAMR0015{}, "AMR")
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropColumn(&sessionAMR0015{}, "AMR")
+	},
+}
+
+// sessionAMR0015 会话表新增列快照
+type sessionAMR0015 struct {
+	AMR string `gorm:"column:amr;size:64;not null;default:''"`
+}
+
+func (sessionAMR0015) TableName() string { return "sys_sessions" }
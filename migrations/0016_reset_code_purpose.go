@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+// resetCodePurpose 重置码表新增用途，安全通知中的锁定码不能用于设置新密码
+var resetCodePurpose = &Migration{
+	Version: 16,
+	Name:    "reset_code_purpose",
+	Up: func(tx *gorm.DB) error {
+		if tx.Migrator().HasColumn(&resetCodePurpose0016{}, "Purpose") {
+			return nil
+		}
+		return tx.Migrator().AddColumn(&resetCodePurpose0016{}, "Purpose")
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropColumn(&resetCodePurpose0016{}, "Purpose")
+	},
+}
+
+// resetCodePurpose0016 重置码表新增列快照
+type resetCodePurpose0016 struct {
+	Purpose string `gorm:"size:32;not null;default:password"`
+}
+
+func (resetCodePurpose0016) TableName() string { return "sys_password_reset_codes" }
@@ -0,0 +1,182 @@
+// Package migrations 按版本顺序执行的数据库迁移
+//
+// 每个迁移包含Up和Down两个方向，执行记录保存在sys_schema_migrations表中。
+// 新增迁移时在migrations列表末尾追加版本号更大的迁移，已发布的迁移不得修改。
+// 迁移中使用的模型是当时表结构的快照，不引用业务模型，避免业务模型变化改写历史迁移。
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 迁移错误定义
+var (
+	ErrMigrationOrder   = errors.New("迁移版本号必须严格递增")
+	ErrUnknownMigration = errors.New("数据库中存在未知的迁移版本")
+	ErrInvalidSteps     = errors.New("回滚步数必须大于0")
+)
+
+// Migration 数据库迁移
+type Migration struct {
+	Version uint   // 版本号，严格递增
+	Name    string // 迁移名称
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration 已执行的迁移记录
+type SchemaMigration struct {
+	Version   uint      `gorm:"primaryKey;autoIncrement:false" json:"version"`
+	Name      string    `gorm:"size:255;not null" json:"name"`
+	AppliedAt time.Time `gorm:"not null" json:"applied_at"`
+}
+
+// TableName 设置表名
+func (SchemaMigration) TableName() string {
+	return "sys_schema_migrations"
+}
+
+// migrations 所有迁移，按版本号排列
+var migrations = []*Migration{
+	initialSchema,
+	tokenWatermarks,
+	sessions,
+	accountLockout,
+	tokenSalt,
+	termsAcceptance,
+	lastFailedLogin,
+	tenantLimits,
+	emailCanonical,
+	dormancy,
+	hashAlgo,
+	userMFA,
+	passwordHistories,
+	sessionAMR,
+	resetCodePurpose,
+}
+
+// Migrate 按版本顺序执行所有未执行的迁移
+func Migrate(db *gorm.DB) error {
+	return migrate(db, migrations)
+}
+
+// Rollback 按版本倒序回滚最近执行的steps个迁移
+func Rollback(db *gorm.DB, steps int) error {
+	return rollback(db, migrations, steps)
+}
+
+// Applied 返回已执行的迁移记录，按版本号排列
+func Applied(db *gorm.DB) ([]SchemaMigration, error) {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+
+	var applied []SchemaMigration
+	err := db.Order("version").Find(&applied).Error
+	return applied, err
+}
+
+// validate 检查迁移版本号严格递增
+func validate(list []*Migration) error {
+	for i := 1; i < len(list); i++ {
+		if list[i].Version <= list[i-1].Version {
+			return fmt.Errorf("%w: %d %s 在 %d %s 之后", ErrMigrationOrder,
+				list[i].Version, list[i].Name, list[i-1].Version, list[i-1].Name)
+		}
+	}
+	return nil
+}
+
+// appliedVersions 返回已执行的迁移版本，数据库中存在list之外的版本时返回错误
+func appliedVersions(db *gorm.DB, list []*Migration) (map[uint]bool, error) {
+	applied, err := Applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[uint]bool, len(list))
+	for _, migration := range list {
+		known[migration.Version] = true
+	}
+
+	versions := make(map[uint]bool, len(applied))
+	for _, record := range applied {
+		if !known[record.Version] {
+			// 数据库由更新版本的程序迁移过，继续执行可能破坏数据
+			return nil, fmt.Errorf("%w: %d %s", ErrUnknownMigration, record.Version, record.Name)
+		}
+		versions[record.Version] = true
+	}
+	return versions, nil
+}
+
+// migrate 执行list中未执行的迁移，每个迁移与其执行记录在同一事务中提交
+//
+// MySQL的DDL语句会隐式提交事务，迁移中途失败时可能需要手动清理已执行的部分。
+func migrate(db *gorm.DB, list []*Migration) error {
+	if err := validate(list); err != nil {
+		return err
+	}
+	applied, err := appliedVersions(db, list)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range list {
+		if applied[migration.Version] {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("执行迁移 %d %s 失败: %w", migration.Version, migration.Name, err)
+		}
+	}
+	return nil
+}
+
+// rollback 倒序回滚list中最近执行的steps个迁移
+func rollback(db *gorm.DB, list []*Migration, steps int) error {
+	if steps <= 0 {
+		return ErrInvalidSteps
+	}
+	if err := validate(list); err != nil {
+		return err
+	}
+	applied, err := appliedVersions(db, list)
+	if err != nil {
+		return err
+	}
+
+	for i := len(list) - 1; i >= 0 && steps > 0; i-- {
+		migration := list[i]
+		if !applied[migration.Version] {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("回滚迁移 %d %s 失败: %w", migration.Version, migration.Name, err)
+		}
+		steps--
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package migrations
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// 需要数据库的迁移测试位于根目录的migrate_test.go，与其他数据库测试顺序执行，避免并发修改同一数据库
+
+// noopMigration 创建不执行任何操作的测试迁移
+func noopMigration(version uint, name string) *Migration {
+	noop := func(tx *gorm.DB) error { return nil }
+	return &Migration{Version: version, Name: name, Up: noop, Down: noop}
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, validate(migrations))
+	assert.NoError(t, validate([]*Migration{noopMigration(1, "a"), noopMigration(2, "b"), noopMigration(5, "c")}))
+
+	err := validate([]*Migration{noopMigration(1, "a"), noopMigration(1, "b")})
+	assert.True(t, errors.Is(err, ErrMigrationOrder))
+
+	err = validate([]*Migration{noopMigration(2, "a"), noopMigration(1, "b")})
+	assert.True(t, errors.Is(err, ErrMigrationOrder))
+}
+
+func TestMigrationsComplete(t *testing.T) {
+	for _, migration := range migrations {
+		assert.NotEmpty(t, migration.Name, migration.Version)
+		assert.NotNil(t, migration.Up, migration.Name)
+		assert.NotNil(t, migration.Down, migration.Name)
+	}
+}
@@ -11,13 +11,39 @@ type User struct {
 	gorm.Model
 	Username       string     `gorm:"size:50;uniqueIndex;not null" json:"username"`
 	Email          string     `gorm:"size:100;uniqueIndex;not null" json:"email"`
-	PasswordHash   string     `gorm:"size:255;not null" json:"-"` // 不返回密码哈希
-	Phone          string     `gorm:"size:20;index" json:"phone,omitempty"`
+	EmailCanonical string     `gorm:"size:100;index;not null;default:''" json:"-"`          // 配置邮箱规范化器后保存的规范形式，用于唯一性检查和查询
+	PasswordHash   string     `gorm:"size:255;not null" json:"-"`                           // 不返回密码哈希
+	HashAlgo       string     `gorm:"size:20;index;not null;default:''" json:"-"`           // 密码哈希算法，保存时根据PasswordHash识别
+	Phone          string     `gorm:"size:255;serializer:encrypted" json:"phone,omitempty"` // 配置字段加密器后加密存储
+	PhoneHash      string     `gorm:"size:64;index" json:"-"`                               // 手机号的HMAC索引，用于加密后按手机号查询
 	Avatar         string     `gorm:"size:255" json:"avatar,omitempty"`
 	Status         uint8      `gorm:"default:1;comment:'1-正常,2-禁用'" json:"status"`
 	LastLoginAt    *time.Time `json:"last_login_at,omitempty"`
 	InvitationCode string     `gorm:"size:50;index" json:"invitation_code,omitempty"`
 	InvitedBy      uint       `gorm:"index" json:"invited_by,omitempty"`
+	EmailVerified  bool       `gorm:"default:false" json:"email_verified"`
+	// 临时暂停：在SuspendedUntil之前视为禁用，到期后自动恢复
+	SuspendedUntil   *time.Time `json:"suspended_until,omitempty"`
+	SuspensionReason string     `gorm:"size:255" json:"suspension_reason,omitempty"`
+	// 最近一次修改密码的时间，早于该时间签发的Token视为失效
+	PasswordChangedAt *time.Time `json:"password_changed_at,omitempty"`
+	// 连续密码错误次数和锁定截止时间，配置AuthConfig.AccountLockout后生效
+	FailedLoginAttempts int        `gorm:"not null;default:0" json:"-"`
+	LockedUntil         *time.Time `json:"locked_until,omitempty"`
+	// 最近一次密码错误的时间，超过AccountLockoutConfig.FailureWindow后错误计数重新开始
+	LastFailedLoginAt *time.Time `json:"-"`
+	// 派生JWT签名密钥的随机盐值，配置JWTConfig.TokenSalts后生效，轮换即可使该用户的全部Token失效
+	TokenSalt string `gorm:"size:64;not null;default:''" json:"-"`
+	// 用户最近同意的服务条款/隐私政策版本和同意时间，与AuthConfig.RequiredTermsVersion不同时需要重新同意
+	AcceptedTermsVersion string     `gorm:"size:50;not null;default:''" json:"accepted_terms_version,omitempty"`
+	AcceptedTermsAt      *time.Time `json:"accepted_terms_at,omitempty"`
+	// 所属租户，0表示不属于任何租户，不受租户限额约束
+	TenantID uint `gorm:"not null;default:0;index" json:"tenant_id,omitempty"`
+	// 服务账号或由外部系统管理的账号不受长期未登录策略约束
+	DormancyExempt bool `gorm:"not null;default:false" json:"dormancy_exempt,omitempty"`
+	// 长期未登录策略发出预警和禁用账号的时间，早于最近一次登录的记录视为已失效
+	DormancyWarnedAt   *time.Time `json:"-"`
+	DormancyDisabledAt *time.Time `json:"dormancy_disabled_at,omitempty"`
 }
 
 // TableName 设置表名
@@ -25,14 +51,57 @@ func (User) TableName() string {
 	return "sys_users"
 }
 
+// IsSuspended 检查用户在指定时间是否处于暂停期
+func (u *User) IsSuspended(now time.Time) bool {
+	return u.SuspendedUntil != nil && now.Before(*u.SuspendedUntil)
+}
+
+// IsLocked 检查用户在指定时间是否因连续密码错误处于锁定期
+func (u *User) IsLocked(now time.Time) bool {
+	return u.LockedUntil != nil && now.Before(*u.LockedUntil)
+}
+
+// LastActiveAt 最近一次活跃时间，从未登录时为注册时间
+func (u *User) LastActiveAt() time.Time {
+	if u.LastLoginAt != nil {
+		return *u.LastLoginAt
+	}
+	return u.CreatedAt
+}
+
 // BeforeCreate 创建前钩子 - 可以添加默认值或验证
 func (u *User) BeforeCreate(tx *gorm.DB) error {
 	// 可以在这里添加密码哈希处理或其他前置操作
+	u.updatePhoneHash()
+	u.updateHashAlgo()
 	return nil
 }
 
 // BeforeUpdate 更新前钩子
 func (u *User) BeforeUpdate(tx *gorm.DB) error {
 	// 可以在这里添加更新时的业务逻辑
+	u.updatePhoneHash()
+	u.updateHashAlgo()
 	return nil
 }
+
+// updatePhoneHash 配置字段加密器时根据手机号计算查询索引
+func (u *User) updatePhoneHash() {
+	if encryptor := GetFieldEncryptor(); encryptor != nil {
+		u.PhoneHash = encryptor.BlindIndex(u.Phone)
+	}
+}
+
+// updateHashAlgo 根据密码哈希记录算法，只按列更新密码的调用方需要同时更新hash_algo
+func (u *User) updateHashAlgo() {
+	if u.PasswordHash != "" {
+		u.HashAlgo = passwordHashAlgo(u.PasswordHash)
+	}
+}
+
+// updateEmailCanonical 配置邮箱规范化器时计算邮箱的规范形式，为nil时保留原值
+func (u *User) updateEmailCanonical(canonicalizer EmailCanonicalizer) {
+	if canonicalizer != nil {
+		u.EmailCanonical = canonicalEmail(canonicalizer, u.Email)
+	}
+}
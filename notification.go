@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/url"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SecurityNotificationConfig 安全通知配置，各类通知可单独开关，需同时配置 AuthConfig.Mailer
+type SecurityNotificationConfig struct {
+	PasswordChanged      bool          // 修改密码后通知
+	PasswordReset        bool          // 通过重置码重置密码后通知
+	SecureAccountURL     string        // "不是本人操作"链接地址，锁定码以code参数附加
+	SecureAccountCodeTTL time.Duration // 通知中锁定码的有效期，锁定后签发的重置码使用 AuthConfig.ResetCodeTTL
+}
+
+// DefaultSecurityNotificationConfig 默认安全通知配置
+func DefaultSecurityNotificationConfig() SecurityNotificationConfig {
+	return SecurityNotificationConfig{
+		PasswordChanged:      true,
+		PasswordReset:        true,
+		SecureAccountCodeTTL: 24 * time.Hour,
+	}
+}
+
+// notifySecurityChange 异步发送安全通知邮件，失败只记录日志，不影响已完成的操作
+//
+// 邮件附带一个只能用于 SecureAccount 的锁定码，不能直接用于 ConfirmPasswordReset。
+func (s *authService) notifySecurityChange(userID uint, template string, changedAt time.Time) {
+	if s.config.Mailer == nil {
+		return
+	}
+
+	go func() {
+		user, err := s.userService.GetUserByID(userID)
+		if err != nil {
+			log.Printf("发送安全通知失败: user_id=%d err=%v", userID, err)
+			return
+		}
+
+		code, _, err := s.issueResetCode(userID, ResetPurposeSecureAccount, s.config.SecurityNotifications.SecureAccountCodeTTL)
+		if err != nil {
+			log.Printf("发送安全通知失败: user_id=%d err=%v", userID, err)
+			return
+		}
+
+		data := map[string]string{
+			"time":        changedAt.Format(time.RFC3339),
+			"secure_code": code,
+		}
+		if base := s.config.SecurityNotifications.SecureAccountURL; base != "" {
+			data["secure_url"] = appendQuery(base, "code", code)
+		}
+
+		if err := s.config.Mailer.Send(MailMessage{To: user.Email, Template: template, Data: data}); err != nil {
+			log.Printf("发送安全通知失败: user_id=%d template=%s err=%v", userID, template, err)
+		}
+	}()
+}
+
+// SecureAccount 用户确认不是本人操作时用安全通知中的锁定码锁定账户
+//
+// 锁定码只能使用一次。撤销用户的所有Token，并将密码替换为随机值，
+// 返回有效期为 ResetCodeTTL 的新重置码，用户通过 ConfirmPasswordReset 设置新密码。
+func (s *authService) SecureAccount(secureCode string) (string, error) {
+	now := s.config.now()
+	record, err := s.findResetCode(secureCode, ResetPurposeSecureAccount, now)
+	if err != nil {
+		return "", err
+	}
+
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	scrambled, err := s.HashPassword(hex.EncodeToString(random))
+	if err != nil {
+		return "", err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := useResetCode(tx, record, now); err != nil {
+			return err
+		}
+		return tx.Model(&User{}).Where("id = ?", record.UserID).Updates(map[string]interface{}{
+			"password_hash":       scrambled,
+			"hash_algo":           passwordHashAlgo(scrambled),
+			"password_changed_at": now,
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	invalidateUserCache(s.userService, record.UserID)
+
+	if err := s.tokenService.RevokeAllUserTokens(record.UserID); err != nil {
+		return "", err
+	}
+
+	if err := s.config.AuditLogger.Log(AuditEvent{
+		Type:      AuditEventAccountSecured,
+		UserID:    record.UserID,
+		CreatedAt: now,
+	}); err != nil {
+		return "", err
+	}
+
+	code, _, err := s.issueResetCode(record.UserID, ResetPurposePassword, s.config.ResetCodeTTL)
+	return code, err
+}
+
+// appendQuery 在链接上追加查询参数
+func appendQuery(rawURL, key, value string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := parsed.Query()
+	query.Set(key, value)
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecurityNotifications(t *testing.T) {
+	// 设置测试数据库
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	newService := func(config *AuthConfig) AuthService {
+		userService := NewUserService(testDB.DB)
+		tokenService := NewTokenService("test-secret-key", time.Hour)
+		return NewAuthServiceWithConfig(testDB.DB, userService, tokenService, config)
+	}
+
+	t.Run("修改密码后通知并可锁定账户", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		mailer := NewCaptureMailer()
+		auditLogger := NewMemoryAuditLogger()
+		config := DefaultAuthConfig()
+		config.Mailer = mailer
+		config.AuditLogger = auditLogger
+		config.SecurityNotifications.SecureAccountURL = "https://example.com/secure?source=mail"
+		service := newService(config)
+
+		password := "testpassword123"
+		user := testDB.CreateTestUser("testuser", "test@example.com", password)
+		_, token, err := service.Login("testuser", password)
+		assert.NoError(t, err)
+
+		assert.NoError(t, service.ChangePassword(user.ID, password, "attackerpassword123"))
+		assert.Eventually(t, func() bool { return len(mailer.Messages()) == 1 }, time.Second, 10*time.Millisecond)
+
+		message := mailer.Messages()[0]
+		assert.Equal(t, "test@example.com", message.To)
+		assert.Equal(t, MailTemplatePasswordChanged, message.Template)
+		assert.NotEmpty(t, message.Data["time"])
+		assert.Contains(t, message.Data["secure_url"], "source=mail")
+		assert.Contains(t, message.Data["secure_url"], "code=")
+		assert.Equal(t, AuditEventPasswordChanged, auditLogger.Events()[0].Type)
+
+		// 锁定码不能直接用于设置新密码
+		secureCode := message.Data["secure_code"]
+		assert.ErrorIs(t, service.ConfirmPasswordReset(secureCode, "attackerpassword456"), ErrInvalidResetCode)
+
+		// 不是本人操作：锁定账户后旧Token和攻击者设置的密码都失效
+		code, err := service.SecureAccount(secureCode)
+		assert.NoError(t, err)
+		assert.NotEqual(t, secureCode, code)
+		_, err = service.ValidateToken(token)
+		assert.Error(t, err)
+		_, _, err = service.Login("testuser", "attackerpassword123")
+		assert.Error(t, err)
+
+		// 锁定码已使用，不能再次锁定，也不能设置新密码
+		_, err = service.SecureAccount(secureCode)
+		assert.ErrorIs(t, err, ErrResetCodeUsed)
+		assert.ErrorIs(t, service.ConfirmPasswordReset(secureCode, "attackerpassword456"), ErrInvalidResetCode)
+
+		// 新重置码使用普通重置码的有效期
+		var record PasswordResetCode
+		assert.NoError(t, testDB.DB.Where("user_id = ? AND purpose = ? AND used_at IS NULL", user.ID, ResetPurposePassword).First(&record).Error)
+		assert.WithinDuration(t, record.CreatedAt.Add(config.ResetCodeTTL), record.ExpiresAt, time.Second)
+
+		// 使用锁定后返回的重置码设置新密码，并收到重置通知
+		assert.NoError(t, service.ConfirmPasswordReset(code, "recoveredpassword123"))
+		_, _, err = service.Login("testuser", "recoveredpassword123")
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool { return len(mailer.Messages()) == 2 }, time.Second, 10*time.Millisecond)
+		assert.Equal(t, MailTemplatePasswordReset, mailer.Messages()[1].Template)
+		assert.Equal(t, "test@example.com", mailer.Messages()[1].To)
+
+		// 普通重置码不能用于锁定账户
+		_, err = service.SecureAccount(code)
+		assert.ErrorIs(t, err, ErrInvalidResetCode)
+	})
+
+	t.Run("按通知类型单独关闭", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		mailer := NewCaptureMailer()
+		config := DefaultAuthConfig()
+		config.Mailer = mailer
+		config.SecurityNotifications.PasswordChanged = false
+		service := newService(config)
+
+		password := "testpassword123"
+		user := testDB.CreateTestUser("testuser", "test@example.com", password)
+		assert.NoError(t, service.ChangePassword(user.ID, password, "newpassword123"))
+
+		code, err := service.ResetPassword("test@example.com")
+		assert.NoError(t, err)
+		assert.NoError(t, service.ConfirmPasswordReset(code, "anotherpassword123"))
+
+		assert.Eventually(t, func() bool { return len(mailer.Messages()) == 1 }, time.Second, 10*time.Millisecond)
+		time.Sleep(50 * time.Millisecond)
+		assert.Len(t, mailer.Messages(), 1)
+		assert.Equal(t, MailTemplatePasswordReset, mailer.Messages()[0].Template)
+	})
+
+	t.Run("发送失败不影响修改密码", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		config := DefaultAuthConfig()
+		config.Mailer = failingMailer{}
+		service := newService(config)
+
+		password := "testpassword123"
+		user := testDB.CreateTestUser("testuser", "test@example.com", password)
+		assert.NoError(t, service.ChangePassword(user.ID, password, "newpassword123"))
+		_, _, err := service.Login("testuser", "newpassword123")
+		assert.NoError(t, err)
+	})
+}
+
+func TestAppendQuery(t *testing.T) {
+	assert.Equal(t, "https://example.com/secure?code=abc.def", appendQuery("https://example.com/secure", "code", "abc.def"))
+	assert.Equal(t, "https://example.com/secure?code=a%2Bb&source=mail", appendQuery("https://example.com/secure?source=mail", "code", "a+b"))
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidSessionToken 会话Token不存在、已过期或已撤销
+var ErrInvalidSessionToken = errors.New("无效的会话token")
+
+// opaqueTokenBytes 会话Token的随机字节数
+const opaqueTokenBytes = 32
+
+// Session 会话，只保存Token的SHA-256哈希，数据库泄露时无法还原出可用的Token
+type Session struct {
+	ID                uint      `gorm:"primaryKey" json:"id"`
+	TokenHash         string    `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	UserID            uint      `gorm:"not null;index" json:"user_id"`
+	PasswordChangedAt int64     `gorm:"not null;default:0" json:"-"`                     // 签发时用户的密码修改时间（Unix秒）
+	AMR               string    `gorm:"column:amr;size:64;not null;default:''" json:"-"` // 登录认证方式，逗号分隔
+	ExpiresAt         time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// TableName 设置表名
+func (Session) TableName() string {
+	return "sys_sessions"
+}
+
+// OpaqueTokenConfig 不透明会话Token配置
+type OpaqueTokenConfig struct {
+	Expiration time.Duration // 会话有效期
+	// 验证结果在内存中的缓存时间，0表示不缓存
+	//
+	// 撤销会立即清除本实例的缓存，但其他实例最多在CacheTTL内仍会接受已撤销的Token；
+	// 需要所有实例立即生效时应关闭缓存。
+	CacheTTL  time.Duration
+	CacheSize int // 最多缓存的会话数
+	// 时间来源，用于会话过期和缓存过期的判断，为nil时使用系统时间；测试中可使用FakeClock
+	Clock Clock
+}
+
+// DefaultOpaqueTokenConfig 默认不透明会话Token配置
+func DefaultOpaqueTokenConfig() *OpaqueTokenConfig {
+	return &OpaqueTokenConfig{
+		Expiration: 24 * time.Hour,
+		CacheTTL:   0,
+		CacheSize:  10000,
+	}
+}
+
+// cachedSession 缓存的会话验证结果
+type cachedSession struct {
+	claims    Claims
+	expiresAt time.Time // 缓存过期时间，不晚于会话本身的过期时间
+}
+
+// opaqueTokenService 不透明会话Token服务实现
+//
+// Token是32字节随机数，不携带任何信息，每次验证都查询sys_sessions表，撤销删除记录后立即生效。
+type opaqueTokenService struct {
+	db     *gorm.DB
+	config *OpaqueTokenConfig
+	cache  map[string]cachedSession // Token哈希 -> 验证结果
+	clock  Clock
+	mutex  sync.RWMutex
+}
+
+// NewOpaqueTokenService 创建基于数据库会话的Token服务，可替代JWT实现用于AuthService和LoginService
+func NewOpaqueTokenService(db *gorm.DB, config *OpaqueTokenConfig) TokenService {
+	if config == nil {
+		config = DefaultOpaqueTokenConfig()
+	}
+
+	return &opaqueTokenService{
+		db:     db,
+		config: config,
+		cache:  make(map[string]cachedSession),
+		clock:  clockOrDefault(config.Clock),
+	}
+}
+
+// hashOpaqueToken 计算会话Token的SHA-256哈希
+func hashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateToken 生成会话Token
+func (s *opaqueTokenService) GenerateToken(userID uint) (string, error) {
+	return s.createSession(&Session{UserID: userID})
+}
+
+// GenerateTokenForUser 根据用户记录生成会话Token，记录密码修改时间
+func (s *opaqueTokenService) GenerateTokenForUser(user *User) (string, error) {
+	return s.GenerateTokenForUserWithAMR(user, nil)
+}
+
+// GenerateTokenForUserWithAMR 根据用户记录生成会话Token，记录密码修改时间和登录认证方式
+func (s *opaqueTokenService) GenerateTokenForUserWithAMR(user *User, amr []string) (string, error) {
+	session := &Session{UserID: user.ID, AMR: strings.Join(amr, ",")}
+	if user.PasswordChangedAt != nil {
+		session.PasswordChangedAt = user.PasswordChangedAt.Unix()
+	}
+	return s.createSession(session)
+}
+
+// createSession 生成随机Token并保存会话
+func (s *opaqueTokenService) createSession(session *Session) (string, error) {
+	random := make([]byte, opaqueTokenBytes)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(random)
+
+	session.TokenHash = hashOpaqueToken(token)
+	now := s.clock.Now()
+	session.CreatedAt = now
+	session.ExpiresAt = now.Add(s.config.Expiration)
+	if err := s.db.Create(session).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ValidateToken 验证会话Token
+func (s *opaqueTokenService) ValidateToken(tokenString string) (uint, error) {
+	claims, err := s.ParseClaims(tokenString)
+	if err != nil {
+		return 0, err
+	}
+	return claims.UserID, nil
+}
+
+// ParseClaims 验证会话Token并返回由会话记录构造的Claims
+func (s *opaqueTokenService) ParseClaims(tokenString string) (*Claims, error) {
+	if len(tokenString) != opaqueTokenBytes*2 {
+		return nil, ErrInvalidSessionToken
+	}
+	tokenHash := hashOpaqueToken(tokenString)
+	now := s.clock.Now()
+
+	if claims, ok := s.cachedClaims(tokenHash, now); ok {
+		return claims, nil
+	}
+
+	var session Session
+	err := s.db.Where("token_hash = ? AND expires_at > ?", tokenHash, now).First(&session).Error
+	if err != nil {
+		return nil, wrapNotFound(err, ErrInvalidSessionToken)
+	}
+
+	claims := Claims{
+		UserID:            session.UserID,
+		PasswordChangedAt: session.PasswordChangedAt,
+		AMR:               splitAMR(session.AMR),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(session.ExpiresAt),
+			IssuedAt:  jwt.NewNumericDate(session.CreatedAt),
+		},
+	}
+	s.cacheClaims(tokenHash, claims, session.ExpiresAt, now)
+	return &claims, nil
+}
+
+// ParseAMR 验证会话Token并返回登录认证方式
+func (s *opaqueTokenService) ParseAMR(tokenString string) ([]string, error) {
+	claims, err := s.ParseClaims(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	return claims.AMR, nil
+}
+
+// splitAMR 解析会话记录中逗号分隔的登录认证方式
+func splitAMR(amr string) []string {
+	if amr == "" {
+		return nil
+	}
+	return strings.Split(amr, ",")
+}
+
+// cachedClaims 读取未过期的缓存验证结果
+func (s *opaqueTokenService) cachedClaims(tokenHash string, now time.Time) (*Claims, bool) {
+	if s.config.CacheTTL <= 0 {
+		return nil, false
+	}
+
+	s.mutex.RLock()
+	cached, ok := s.cache[tokenHash]
+	s.mutex.RUnlock()
+	if !ok || !now.Before(cached.expiresAt) {
+		return nil, false
+	}
+	claims := cached.claims
+	return &claims, true
+}
+
+// cacheClaims 缓存验证结果，缓存已满时先回收过期项，仍然满时不再缓存
+func (s *opaqueTokenService) cacheClaims(tokenHash string, claims Claims, sessionExpiresAt, now time.Time) {
+	if s.config.CacheTTL <= 0 {
+		return
+	}
+	expiresAt := now.Add(s.config.CacheTTL)
+	if sessionExpiresAt.Before(expiresAt) {
+		expiresAt = sessionExpiresAt
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.cache) >= s.config.CacheSize {
+		s.evictExpiredLocked(now)
+		if len(s.cache) >= s.config.CacheSize {
+			return
+		}
+	}
+	s.cache[tokenHash] = cachedSession{claims: claims, expiresAt: expiresAt}
+}
+
+// evictExpiredLocked 回收过期的缓存项，调用方需持有写锁
+func (s *opaqueTokenService) evictExpiredLocked(now time.Time) {
+	for tokenHash, cached := range s.cache {
+		if !now.Before(cached.expiresAt) {
+			delete(s.cache, tokenHash)
+		}
+	}
+}
+
+// RevokeToken 撤销会话Token，删除会话记录后立即失效
+func (s *opaqueTokenService) RevokeToken(tokenString string) error {
+	tokenHash := hashOpaqueToken(tokenString)
+
+	s.mutex.Lock()
+	delete(s.cache, tokenHash)
+	s.mutex.Unlock()
+
+	return s.db.Where("token_hash = ?", tokenHash).Delete(&Session{}).Error
+}
+
+// ConsumeToken 删除未过期的会话，并发消费同一Token时只有删除到记录的调用返回true
+func (s *opaqueTokenService) ConsumeToken(tokenString string) (bool, error) {
+	tokenHash := hashOpaqueToken(tokenString)
+
+	s.mutex.Lock()
+	delete(s.cache, tokenHash)
+	s.mutex.Unlock()
+
+	result := s.db.Where("token_hash = ? AND expires_at > ?", tokenHash, s.clock.Now()).Delete(&Session{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// RevokeAllUserTokens 撤销用户的所有会话
+func (s *opaqueTokenService) RevokeAllUserTokens(userID uint) error {
+	s.mutex.Lock()
+	for tokenHash, cached := range s.cache {
+		if cached.claims.UserID == userID {
+			delete(s.cache, tokenHash)
+		}
+	}
+	s.mutex.Unlock()
+
+	return s.db.Where("user_id = ?", userID).Delete(&Session{}).Error
+}
+
+// CleanupExpiredTokens 删除已过期的会话和缓存
+func (s *opaqueTokenService) CleanupExpiredTokens() error {
+	now := s.clock.Now()
+
+	s.mutex.Lock()
+	s.evictExpiredLocked(now)
+	s.mutex.Unlock()
+
+	return s.db.Where("expires_at <= ?", now).Delete(&Session{}).Error
+}
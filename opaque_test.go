@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpaqueTokenService(t *testing.T) {
+	// 设置测试数据库
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	newService := func(config *OpaqueTokenConfig) *opaqueTokenService {
+		return NewOpaqueTokenService(testDB.DB, config).(*opaqueTokenService)
+	}
+
+	t.Run("签发和验证会话Token", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		service := newService(nil)
+		token, err := service.GenerateToken(1)
+		assert.NoError(t, err)
+		assert.Len(t, token, opaqueTokenBytes*2)
+
+		userID, err := service.ValidateToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, uint(1), userID)
+
+		// 数据库中只保存Token的哈希
+		var session Session
+		assert.NoError(t, testDB.DB.First(&session).Error)
+		assert.Equal(t, hashOpaqueToken(token), session.TokenHash)
+		assert.NotEqual(t, token, session.TokenHash)
+
+		_, err = service.ValidateToken("not-a-token")
+		assert.True(t, errors.Is(err, ErrInvalidSessionToken))
+	})
+
+	t.Run("撤销后立即失效", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		service := newService(nil)
+		first, err := service.GenerateToken(1)
+		assert.NoError(t, err)
+		second, err := service.GenerateToken(1)
+		assert.NoError(t, err)
+		other, err := service.GenerateToken(2)
+		assert.NoError(t, err)
+
+		assert.NoError(t, service.RevokeToken(first))
+		_, err = service.ValidateToken(first)
+		assert.True(t, errors.Is(err, ErrInvalidSessionToken))
+		_, err = service.ValidateToken(second)
+		assert.NoError(t, err)
+
+		assert.NoError(t, service.RevokeAllUserTokens(1))
+		_, err = service.ValidateToken(second)
+		assert.True(t, errors.Is(err, ErrInvalidSessionToken))
+		_, err = service.ValidateToken(other)
+		assert.NoError(t, err)
+	})
+
+	t.Run("其他实例撤销后立即失效", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		issuer := newService(nil)
+		validator := newService(nil)
+		token, err := issuer.GenerateToken(1)
+		assert.NoError(t, err)
+		_, err = validator.ValidateToken(token)
+		assert.NoError(t, err)
+
+		assert.NoError(t, issuer.RevokeToken(token))
+		_, err = validator.ValidateToken(token)
+		assert.True(t, errors.Is(err, ErrInvalidSessionToken))
+	})
+
+	t.Run("缓存在本实例撤销时清除", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		config := DefaultOpaqueTokenConfig()
+		config.CacheTTL = time.Minute
+		service := newService(config)
+
+		token, err := service.GenerateToken(1)
+		assert.NoError(t, err)
+		_, err = service.ValidateToken(token)
+		assert.NoError(t, err)
+		assert.Len(t, service.cache, 1)
+
+		assert.NoError(t, service.RevokeToken(token))
+		assert.Empty(t, service.cache)
+		_, err = service.ValidateToken(token)
+		assert.True(t, errors.Is(err, ErrInvalidSessionToken))
+	})
+
+	t.Run("过期会话无法验证并被清理", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		config := DefaultOpaqueTokenConfig()
+		config.Expiration = -time.Minute
+		expired := newService(config)
+		token, err := expired.GenerateToken(1)
+		assert.NoError(t, err)
+		_, err = expired.ValidateToken(token)
+		assert.True(t, errors.Is(err, ErrInvalidSessionToken))
+
+		live, err := newService(nil).GenerateToken(2)
+		assert.NoError(t, err)
+
+		assert.NoError(t, expired.CleanupExpiredTokens())
+		var count int64
+		testDB.DB.Model(&Session{}).Count(&count)
+		assert.Equal(t, int64(1), count)
+		_, err = expired.ValidateToken(live)
+		assert.NoError(t, err)
+	})
+}
+
+func TestAuthServiceWithOpaqueTokens(t *testing.T) {
+	// 设置测试数据库
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	// 清理数据
+	testDB.ClearAllData()
+
+	userService := NewUserService(testDB.DB)
+	clock := NewFakeClock(time.Time{})
+	tokenConfig := DefaultOpaqueTokenConfig()
+	tokenConfig.Clock = clock
+	tokenService := NewOpaqueTokenService(testDB.DB, tokenConfig)
+	config := DefaultAuthConfig()
+	config.RejectStaleCredentials = true
+	config.Clock = clock
+	authService := NewAuthServiceWithConfig(testDB.DB, userService, tokenService, config)
+	loginService := NewLoginService(testDB.DB, userService, tokenService, authService)
+
+	user, token, err := authService.Register("opaqueuser", "opaque@example.com", "password123", "")
+	assert.NoError(t, err)
+
+	t.Run("登录、验证、刷新和登出", func(t *testing.T) {
+		_, loginToken, err := loginService.Login("opaqueuser", "password123")
+		assert.NoError(t, err)
+
+		validated, err := loginService.ValidateToken(loginToken)
+		assert.NoError(t, err)
+		assert.Equal(t, user.ID, validated.ID)
+
+		refreshed, err := authService.RefreshToken(loginToken)
+		assert.NoError(t, err)
+		_, err = authService.ValidateToken(loginToken)
+		assert.Error(t, err)
+		_, err = authService.ValidateToken(refreshed)
+		assert.NoError(t, err)
+
+		assert.NoError(t, authService.Logout(refreshed))
+		_, err = loginService.ValidateToken(refreshed)
+		assert.Error(t, err)
+	})
+
+	t.Run("修改密码前签发的会话被拒绝", func(t *testing.T) {
+		clock.Advance(time.Second) // 密码修改时间精确到秒
+		assert.NoError(t, authService.ChangePassword(user.ID, "password123", "newpassword456"))
+		_, err := authService.ValidateToken(token)
+		assert.True(t, errors.Is(err, ErrStaleCredentials))
+
+		_, freshToken, err := authService.Login("opaqueuser", "newpassword456")
+		assert.NoError(t, err)
+		_, err = authService.ValidateToken(freshToken)
+		assert.NoError(t, err)
+	})
+}
+
+// 验证开销对比：JWT只做签名校验；不透明Token每次查询数据库，启用缓存后命中时只读内存
+
+func BenchmarkTokenServiceValidateJWT(b *testing.B) {
+	service := NewTokenService("test-secret-key", time.Hour)
+	token, _ := service.GenerateToken(1)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		service.ValidateToken(token)
+	}
+}
+
+func BenchmarkOpaqueTokenServiceValidate(b *testing.B) {
+	testDB := SetupTestDB(b)
+	defer testDB.TeardownTestDB()
+
+	service := NewOpaqueTokenService(testDB.DB, nil)
+	token, err := service.GenerateToken(1)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		service.ValidateToken(token)
+	}
+}
+
+func BenchmarkOpaqueTokenServiceValidateCached(b *testing.B) {
+	testDB := SetupTestDB(b)
+	defer testDB.TeardownTestDB()
+
+	config := DefaultOpaqueTokenConfig()
+	config.CacheTTL = time.Minute
+	service := NewOpaqueTokenService(testDB.DB, config)
+	token, err := service.GenerateToken(1)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		service.ValidateToken(token)
+	}
+}
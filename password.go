@@ -1,16 +1,21 @@
 package main
 
 import (
+	"cmp"
+	"context"
 	"crypto/rand"
 	"errors"
 	"fmt"
 	"math"
+	"math/big"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 // 默认生成选项
@@ -43,6 +48,36 @@ const (
 	StrengthVeryStrong = "VeryStrong"
 )
 
+// 强度检测反馈码，与PasswordStrength.Feedback一一对应，前端可据此显示本地化提示
+const (
+	FeedbackEmpty           = "empty"
+	FeedbackTooShort        = "too_short"
+	FeedbackMissingLower    = "missing_lower"
+	FeedbackMissingUpper    = "missing_upper"
+	FeedbackMissingNumber   = "missing_number"
+	FeedbackMissingSymbol   = "missing_symbol"
+	FeedbackTooFewUnique    = "too_few_unique_chars"
+	FeedbackSequential      = "sequential_pattern"
+	FeedbackRepeatedPattern = "repeated_pattern"
+	FeedbackKeyboardPattern = "keyboard_pattern"
+	FeedbackCommonPassword  = "common_password"
+	FeedbackForbiddenTerm   = "forbidden_term"
+	FeedbackBreached        = "breached_password"
+)
+
+// 密码策略规则，用于PolicyResult.Rules
+const (
+	PolicyRuleMinLength        = "min_length"
+	PolicyRuleMaxLength        = "max_length"
+	PolicyRuleRequireLower     = "require_lower"
+	PolicyRuleRequireUpper     = "require_upper"
+	PolicyRuleRequireNumbers   = "require_numbers"
+	PolicyRuleRequireSymbols   = "require_symbols"
+	PolicyRuleMinUniqueChars   = "min_unique_chars"
+	PolicyRuleMaxRepeatedChars = "max_repeated_chars"
+	PolicyRuleForbiddenPattern = "forbidden_pattern"
+)
+
 // 常见密码列表（简化版，实际应用中应该使用更完整的列表）
 var commonPasswords = map[string]bool{
 	"password":    true,
@@ -74,6 +109,8 @@ var (
 // PasswordStrengthChecker 密码强度检测器
 type PasswordStrengthChecker struct {
 	enableDictionaryCheck bool
+	forbiddenTerms        []string              // 小写的禁用词，由密码管理器配置
+	breachCounter         PasswordBreachCounter // 泄露密码库查询，为nil时只使用本地字典
 }
 
 // NewPasswordStrengthChecker 创建密码强度检测器
@@ -83,25 +120,41 @@ func NewPasswordStrengthChecker(enableDictionaryCheck bool) *PasswordStrengthChe
 	}
 }
 
-// CheckStrength 检测密码强度
+// SetBreachCounter 设置泄露密码库查询，为nil时关闭
+func (c *PasswordStrengthChecker) SetBreachCounter(counter PasswordBreachCounter) {
+	c.breachCounter = counter
+}
+
+// CheckStrength 检测密码强度，配置了泄露密码库查询时不设截止时间
 func (c *PasswordStrengthChecker) CheckStrength(password string) PasswordStrength {
+	return c.CheckStrengthContext(context.Background(), password)
+}
+
+// CheckStrengthContext 检测密码强度，泄露密码库查询在ctx截止前未完成时按查询失败处理
+func (c *PasswordStrengthChecker) CheckStrengthContext(ctx context.Context, password string) PasswordStrength {
 	if password == "" {
 		return PasswordStrength{
-			Score:       0,
-			Level:       StrengthWeak,
-			Feedback:    []string{"密码不能为空"},
-			Entropy:     0,
-			TimeToCrack: "立即",
+			Score:         0,
+			Level:         StrengthWeak,
+			Feedback:      []string{"密码不能为空"},
+			FeedbackCodes: []string{FeedbackEmpty},
+			Entropy:       0,
+			TimeToCrack:   "立即",
 		}
 	}
 
 	score := 0
 	feedback := []string{}
+	codes := []string{}
+	addFeedback := func(code, message string) {
+		codes = append(codes, code)
+		feedback = append(feedback, message)
+	}
 
 	// 长度检查
 	length := len(password)
 	if length < 8 {
-		feedback = append(feedback, "密码长度至少需要8个字符")
+		addFeedback(FeedbackTooShort, "密码长度至少需要8个字符")
 	} else if length >= 8 && length < 12 {
 		score += 20
 	} else if length >= 12 && length < 16 {
@@ -120,25 +173,25 @@ func (c *PasswordStrengthChecker) CheckStrength(password string) PasswordStrengt
 	if hasLower {
 		charTypeCount++
 	} else {
-		feedback = append(feedback, "建议包含小写字母")
+		addFeedback(FeedbackMissingLower, "建议包含小写字母")
 	}
 
 	if hasUpper {
 		charTypeCount++
 	} else {
-		feedback = append(feedback, "建议包含大写字母")
+		addFeedback(FeedbackMissingUpper, "建议包含大写字母")
 	}
 
 	if hasNumbers {
 		charTypeCount++
 	} else {
-		feedback = append(feedback, "建议包含数字")
+		addFeedback(FeedbackMissingNumber, "建议包含数字")
 	}
 
 	if hasSymbols {
 		charTypeCount++
 	} else {
-		feedback = append(feedback, "建议包含特殊字符")
+		addFeedback(FeedbackMissingSymbol, "建议包含特殊字符")
 	}
 
 	// 根据字符类型数量加分
@@ -147,7 +200,7 @@ func (c *PasswordStrengthChecker) CheckStrength(password string) PasswordStrengt
 	// 唯一字符检查
 	uniqueChars := c.countUniqueChars(password)
 	if uniqueChars < length/2 {
-		feedback = append(feedback, "密码中重复字符过多")
+		addFeedback(FeedbackTooFewUnique, "密码中重复字符过多")
 	} else {
 		score += 10
 	}
@@ -155,23 +208,36 @@ func (c *PasswordStrengthChecker) CheckStrength(password string) PasswordStrengt
 	// 模式检查
 	if c.hasSequentialPattern(password) {
 		score -= 10
-		feedback = append(feedback, "避免使用连续字符")
+		addFeedback(FeedbackSequential, "避免使用连续字符")
 	}
 
 	if c.hasRepeatedPattern(password) {
 		score -= 10
-		feedback = append(feedback, "避免重复字符")
+		addFeedback(FeedbackRepeatedPattern, "避免重复字符")
 	}
 
 	if c.hasKeyboardPattern(password) {
 		score -= 10
-		feedback = append(feedback, "避免使用键盘模式")
+		addFeedback(FeedbackKeyboardPattern, "避免使用键盘模式")
+	}
+
+	// 泄露密码库检查，查询失败时只有本地字典检查生效
+	breachCount := c.checkBreach(ctx, password)
+	if breachCount > 0 {
+		score -= 50
+		addFeedback(FeedbackBreached, fmt.Sprintf("该密码已在数据泄露中出现%d次", breachCount))
 	}
 
 	// 字典检查
 	if c.enableDictionaryCheck && c.isCommonPassword(password) {
 		score -= 20
-		feedback = append(feedback, "避免使用常见密码")
+		addFeedback(FeedbackCommonPassword, "避免使用常见密码")
+	}
+
+	// 禁用词检查，包含禁用词的密码一律视为弱密码
+	if term, found := containsForbiddenTerm(password, c.forbiddenTerms); found {
+		score = 0
+		addFeedback(FeedbackForbiddenTerm, fmt.Sprintf("密码不能包含禁用词: %s", term))
 	}
 
 	// 确保分数在0-100范围内
@@ -192,12 +258,45 @@ func (c *PasswordStrengthChecker) CheckStrength(password string) PasswordStrengt
 	timeToCrack := c.estimateTimeToCrack(entropy)
 
 	return PasswordStrength{
-		Score:       score,
-		Level:       level,
-		Feedback:    feedback,
+		Score:         score,
+		Level:         level,
+		Feedback:      feedback,
+		FeedbackCodes: codes,
+		Composition: PasswordComposition{
+			Length:      length,
+			UniqueChars: uniqueChars,
+			HasLower:    hasLower,
+			HasUpper:    hasUpper,
+			HasNumbers:  hasNumbers,
+			HasSymbols:  hasSymbols,
+		},
 		Entropy:     entropy,
 		TimeToCrack: timeToCrack,
+		BreachCount: breachCount,
+	}
+}
+
+// checkBreach 在ctx截止前查询密码的泄露次数，未配置、查询失败或超时时返回0
+func (c *PasswordStrengthChecker) checkBreach(ctx context.Context, password string) int {
+	if c.breachCounter == nil {
+		return 0
 	}
+	count, ok := breachCountWithin(ctx, c.breachCounter, password)
+	if !ok {
+		return 0
+	}
+	return count
+}
+
+// CompareStrength 比较两个密码的强度，a更强返回1，更弱返回-1，相同返回0
+//
+// 先比较分数，分数相同时比较熵值。
+func (c *PasswordStrengthChecker) CompareStrength(a, b string) int {
+	strengthA, strengthB := c.CheckStrength(a), c.CheckStrength(b)
+	if strengthA.Score != strengthB.Score {
+		return cmp.Compare(strengthA.Score, strengthB.Score)
+	}
+	return cmp.Compare(strengthA.Entropy, strengthB.Entropy)
 }
 
 // countUniqueChars 计算唯一字符数量
@@ -312,6 +411,18 @@ func (g *PasswordGenerator) GeneratePassword(options GenerateOptions) (string, e
 		return "", ErrInvalidOptions
 	}
 
+	// 自定义字符集必须能够满足要求的字符类型
+	if !g.charsetCoversRequirements(charset, options) {
+		return "", ErrInvalidOptions
+	}
+
+	// 长度不足以达到最小熵时按选项加长或返回错误
+	length, err := g.lengthForEntropy(charset, options)
+	if err != nil {
+		return "", err
+	}
+	options.Length = length
+
 	// 生成密码
 	password := make([]byte, options.Length)
 	for i := 0; i < options.Length; i++ {
@@ -363,6 +474,42 @@ func (g *PasswordGenerator) validateOptions(options GenerateOptions) error {
 	return nil
 }
 
+// generationEntropy 计算从字符集中均匀随机选取length个字符生成的密码熵值
+//
+// 与calculateEntropy相同按 长度 * log2(字符集大小) 计算，字符集大小取去重后的字符数。
+func (g *PasswordGenerator) generationEntropy(charset string, length int) float64 {
+	unique := make(map[rune]struct{}, len(charset))
+	for _, char := range charset {
+		unique[char] = struct{}{}
+	}
+	if len(unique) <= 1 {
+		return 0
+	}
+	return float64(length) * math.Log2(float64(len(unique)))
+}
+
+// lengthForEntropy 返回满足MinEntropyBits的生成长度
+//
+// 设置ExtendToMinEntropy时加长到刚好达到最小熵，否则长度不足时返回ErrInsufficientEntropy。
+func (g *PasswordGenerator) lengthForEntropy(charset string, options GenerateOptions) (int, error) {
+	if options.MinEntropyBits <= 0 || g.generationEntropy(charset, options.Length) >= options.MinEntropyBits {
+		return options.Length, nil
+	}
+	if !options.ExtendToMinEntropy {
+		return 0, ErrInsufficientEntropy
+	}
+
+	bitsPerChar := g.generationEntropy(charset, 1)
+	if bitsPerChar == 0 {
+		return 0, ErrInsufficientEntropy
+	}
+	length := int(math.Ceil(options.MinEntropyBits / bitsPerChar))
+	if length > 256 {
+		return 0, ErrInsufficientEntropy
+	}
+	return length, nil
+}
+
 // buildCharset 构建字符集
 func (g *PasswordGenerator) buildCharset(options GenerateOptions) string {
 	if options.CustomCharset != "" {
@@ -410,95 +557,92 @@ func (g *PasswordGenerator) removeAmbiguousChars(charset string) string {
 	return result.String()
 }
 
-// secureRandomInt 生成安全的随机整数
+// secureRandomInt 生成[0, max)内均匀分布的安全随机整数
+//
+// rand.Int内部使用拒绝采样，每个值的概率相同，不会像直接取模那样偏向较小的值。
 func (g *PasswordGenerator) secureRandomInt(max int) (int, error) {
 	if max <= 0 {
 		return 0, ErrInvalidOptions
 	}
 
-	// 使用加密安全的随机数生成器
-	randomBytes := make([]byte, 4)
-	_, err := rand.Read(randomBytes)
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
 	if err != nil {
 		return 0, err
 	}
-
-	// 转换为整数并取模
-	randomInt := int(randomBytes[0])<<24 | int(randomBytes[1])<<16 | int(randomBytes[2])<<8 | int(randomBytes[3])
-	if randomInt < 0 {
-		randomInt = -randomInt
-	}
-
-	return randomInt % max, nil
+	return int(n.Int64()), nil
 }
 
-// meetsRequirements 检查密码是否满足要求
-func (g *PasswordGenerator) meetsRequirements(password string, options GenerateOptions) bool {
-	if options.CustomCharset != "" {
-		return true // 自定义字符集不需要额外检查
+// requiredClasses 返回选项要求包含的字符类型
+func (g *PasswordGenerator) requiredClasses(options GenerateOptions) []string {
+	classes := []string{}
+	if options.IncludeLower {
+		classes = append(classes, LowerChars)
 	}
-
-	if options.IncludeLower && !strings.ContainsAny(password, LowerChars) {
-		return false
+	if options.IncludeUpper {
+		classes = append(classes, UpperChars)
 	}
-
-	if options.IncludeUpper && !strings.ContainsAny(password, UpperChars) {
-		return false
+	if options.IncludeNumbers {
+		classes = append(classes, NumberChars)
 	}
-
-	if options.IncludeNumbers && !strings.ContainsAny(password, NumberChars) {
-		return false
+	if options.IncludeSymbols {
+		classes = append(classes, SymbolChars)
 	}
+	return classes
+}
 
-	if options.IncludeSymbols && !strings.ContainsAny(password, SymbolChars) {
-		return false
+// charsetCoversRequirements 检查字符集是否包含每种要求的字符类型
+func (g *PasswordGenerator) charsetCoversRequirements(charset string, options GenerateOptions) bool {
+	for _, class := range g.requiredClasses(options) {
+		if !strings.ContainsAny(charset, class) {
+			return false
+		}
 	}
+	return true
+}
 
+// meetsRequirements 检查密码是否满足要求
+func (g *PasswordGenerator) meetsRequirements(password string, options GenerateOptions) bool {
+	for _, class := range g.requiredClasses(options) {
+		if !strings.ContainsAny(password, class) {
+			return false
+		}
+	}
 	return true
 }
 
 // ensureRequirements 确保密码满足要求
 func (g *PasswordGenerator) ensureRequirements(password string, options GenerateOptions) string {
-	if options.CustomCharset != "" {
-		return password // 自定义字符集不需要调整
-	}
-
+	charset := g.buildCharset(options)
 	result := []rune(password)
 	position := 0
 
-	if options.IncludeLower && !strings.ContainsAny(password, LowerChars) {
-		if position < len(result) {
-			randomIndex, _ := g.secureRandomInt(len(LowerChars))
-			result[position] = rune(LowerChars[randomIndex])
-			position++
+	for _, class := range g.requiredClasses(options) {
+		if strings.ContainsAny(password, class) || position >= len(result) {
+			continue
 		}
-	}
 
-	if options.IncludeUpper && !strings.ContainsAny(password, UpperChars) {
-		if position < len(result) {
-			randomIndex, _ := g.secureRandomInt(len(UpperChars))
-			result[position] = rune(UpperChars[randomIndex])
-			position++
+		// 只从实际字符集中选取该类型的字符，避免引入字符集外的字符
+		available := g.filterCharset(charset, class)
+		if available == "" {
+			continue
 		}
+		randomIndex, _ := g.secureRandomInt(len(available))
+		result[position] = rune(available[randomIndex])
+		position++
 	}
 
-	if options.IncludeNumbers && !strings.ContainsAny(password, NumberChars) {
-		if position < len(result) {
-			randomIndex, _ := g.secureRandomInt(len(NumberChars))
-			result[position] = rune(NumberChars[randomIndex])
-			position++
-		}
-	}
+	return string(result)
+}
 
-	if options.IncludeSymbols && !strings.ContainsAny(password, SymbolChars) {
-		if position < len(result) {
-			randomIndex, _ := g.secureRandomInt(len(SymbolChars))
-			result[position] = rune(SymbolChars[randomIndex])
-			position++
+// filterCharset 返回字符集中属于指定字符类型的字符
+func (g *PasswordGenerator) filterCharset(charset, class string) string {
+	var result strings.Builder
+	for _, char := range charset {
+		if strings.ContainsRune(class, char) {
+			result.WriteRune(char)
 		}
 	}
-
-	return string(result)
+	return result.String()
 }
 
 // PasswordPolicyValidator 密码策略验证器
@@ -512,66 +656,63 @@ func NewPasswordPolicyValidator() *PasswordPolicyValidator {
 
 // ValidatePolicy 验证密码策略
 func (v *PasswordPolicyValidator) ValidatePolicy(password string, policy PasswordPolicy) PolicyResult {
-	violations := []string{}
+	failed := []PolicyRuleResult{}
+	rules := []PolicyRuleResult{}
 	score := 100
 
+	// check 记录一条规则的检查结果，未通过时扣分
+	check := func(rule string, passed bool, message string, penalty int) {
+		if passed {
+			rules = append(rules, PolicyRuleResult{Rule: rule, Passed: true, Severity: penalty})
+			return
+		}
+		result := PolicyRuleResult{Rule: rule, Message: message, Severity: penalty}
+		rules = append(rules, result)
+		failed = append(failed, result)
+		score -= penalty
+	}
+
 	// 长度检查
 	length := len(password)
-	if length < policy.MinLength {
-		violations = append(violations, fmt.Sprintf("密码长度不能少于%d个字符", policy.MinLength))
-		score -= 20
-	}
+	check(PolicyRuleMinLength, length >= policy.MinLength, fmt.Sprintf("密码长度不能少于%d个字符", policy.MinLength), 20)
 
-	if policy.MaxLength > 0 && length > policy.MaxLength {
-		violations = append(violations, fmt.Sprintf("密码长度不能超过%d个字符", policy.MaxLength))
-		score -= 10
+	if policy.MaxLength > 0 {
+		check(PolicyRuleMaxLength, length <= policy.MaxLength, fmt.Sprintf("密码长度不能超过%d个字符", policy.MaxLength), 10)
 	}
 
 	// 字符要求检查
-	if policy.RequireLower && !strings.ContainsAny(password, LowerChars) {
-		violations = append(violations, "密码必须包含小写字母")
-		score -= 15
+	if policy.RequireLower {
+		check(PolicyRuleRequireLower, strings.ContainsAny(password, LowerChars), "密码必须包含小写字母", 15)
 	}
 
-	if policy.RequireUpper && !strings.ContainsAny(password, UpperChars) {
-		violations = append(violations, "密码必须包含大写字母")
-		score -= 15
+	if policy.RequireUpper {
+		check(PolicyRuleRequireUpper, strings.ContainsAny(password, UpperChars), "密码必须包含大写字母", 15)
 	}
 
-	if policy.RequireNumbers && !strings.ContainsAny(password, NumberChars) {
-		violations = append(violations, "密码必须包含数字")
-		score -= 15
+	if policy.RequireNumbers {
+		check(PolicyRuleRequireNumbers, strings.ContainsAny(password, NumberChars), "密码必须包含数字", 15)
 	}
 
-	if policy.RequireSymbols && !strings.ContainsAny(password, SymbolChars) {
-		violations = append(violations, "密码必须包含特殊字符")
-		score -= 15
+	if policy.RequireSymbols {
+		check(PolicyRuleRequireSymbols, strings.ContainsAny(password, SymbolChars), "密码必须包含特殊字符", 15)
 	}
 
 	// 唯一字符检查
 	if policy.MinUniqueChars > 0 {
 		uniqueChars := v.countUniqueChars(password)
-		if uniqueChars < policy.MinUniqueChars {
-			violations = append(violations, fmt.Sprintf("密码至少需要%d个不同的字符", policy.MinUniqueChars))
-			score -= 10
-		}
+		check(PolicyRuleMinUniqueChars, uniqueChars >= policy.MinUniqueChars, fmt.Sprintf("密码至少需要%d个不同的字符", policy.MinUniqueChars), 10)
 	}
 
 	// 重复字符检查
 	if policy.MaxRepeatedChars > 0 {
 		maxRepeated := v.getMaxRepeatedChars(password)
-		if maxRepeated > policy.MaxRepeatedChars {
-			violations = append(violations, fmt.Sprintf("连续重复字符不能超过%d个", policy.MaxRepeatedChars))
-			score -= 15
-		}
+		check(PolicyRuleMaxRepeatedChars, maxRepeated <= policy.MaxRepeatedChars, fmt.Sprintf("连续重复字符不能超过%d个", policy.MaxRepeatedChars), 15)
 	}
 
-	// 禁用模式检查
+	// 禁用模式检查，每个模式单独记录一条规则结果
+	lower := strings.ToLower(password)
 	for _, pattern := range policy.ForbiddenPatterns {
-		if strings.Contains(strings.ToLower(password), strings.ToLower(pattern)) {
-			violations = append(violations, fmt.Sprintf("密码不能包含禁用模式: %s", pattern))
-			score -= 20
-		}
+		check(PolicyRuleForbiddenPattern, !strings.Contains(lower, strings.ToLower(pattern)), fmt.Sprintf("密码不能包含禁用模式: %s", pattern), 20)
 	}
 
 	// 确保分数不为负数
@@ -579,10 +720,21 @@ func (v *PasswordPolicyValidator) ValidatePolicy(password string, policy Passwor
 		score = 0
 	}
 
+	if policy.SortViolationsBySeverity {
+		sort.SliceStable(failed, func(i, j int) bool {
+			return failed[i].Severity > failed[j].Severity
+		})
+	}
+	violations := make([]string, 0, len(failed))
+	for _, result := range failed {
+		violations = append(violations, result.Message)
+	}
+
 	return PolicyResult{
 		Valid:      len(violations) == 0,
 		Violations: violations,
 		Score:      score,
+		Rules:      rules,
 	}
 }
 
@@ -621,13 +773,20 @@ func (v *PasswordPolicyValidator) getMaxRepeatedChars(password string) int {
 // MemoryHistoryStorage 内存密码历史存储实现
 type MemoryHistoryStorage struct {
 	histories map[uint][]PasswordHistory
+	clock     Clock
 	mutex     sync.RWMutex
 }
 
 // NewMemoryHistoryStorage 创建内存历史存储
 func NewMemoryHistoryStorage() *MemoryHistoryStorage {
+	return NewMemoryHistoryStorageWithClock(nil)
+}
+
+// NewMemoryHistoryStorageWithClock 创建按指定时钟记录时间的内存历史存储，clock为nil时使用系统时间
+func NewMemoryHistoryStorageWithClock(clock Clock) *MemoryHistoryStorage {
 	return &MemoryHistoryStorage{
 		histories: make(map[uint][]PasswordHistory),
+		clock:     clockOrDefault(clock),
 	}
 }
 
@@ -647,7 +806,7 @@ func (s *MemoryHistoryStorage) Add(userID uint, hash string) error {
 	history := PasswordHistory{
 		UserID:       userID,
 		PasswordHash: hash,
-		CreatedAt:    time.Now(),
+		CreatedAt:    s.clock.Now(),
 	}
 
 	s.histories[userID] = append(s.histories[userID], history)
@@ -712,6 +871,90 @@ func (s *MemoryHistoryStorage) Cleanup(userID uint, keepCount int) error {
 	return nil
 }
 
+// GormHistoryStorage 基于GORM的密码历史存储实现，重启后历史记录不丢失
+type GormHistoryStorage struct {
+	db    *gorm.DB
+	clock Clock
+}
+
+// NewGormHistoryStorage 创建数据库历史存储
+func NewGormHistoryStorage(db *gorm.DB) *GormHistoryStorage {
+	return NewGormHistoryStorageWithClock(db, nil)
+}
+
+// NewGormHistoryStorageWithClock 创建按指定时钟记录时间的数据库历史存储，clock为nil时使用系统时间
+func NewGormHistoryStorageWithClock(db *gorm.DB, clock Clock) *GormHistoryStorage {
+	return &GormHistoryStorage{
+		db:    db,
+		clock: clockOrDefault(clock),
+	}
+}
+
+// Add 添加密码历史记录
+func (s *GormHistoryStorage) Add(userID uint, hash string) error {
+	if userID == 0 {
+		return ErrInvalidUserID
+	}
+
+	if hash == "" {
+		return ErrInvalidHash
+	}
+
+	history := PasswordHistory{
+		UserID:       userID,
+		PasswordHash: hash,
+		CreatedAt:    s.clock.Now(),
+	}
+	return s.db.Create(&history).Error
+}
+
+// GetHistory 按时间倒序获取密码历史记录，limit<=0时返回全部
+func (s *GormHistoryStorage) GetHistory(userID uint, limit int) ([]PasswordHistory, error) {
+	if userID == 0 {
+		return nil, ErrInvalidUserID
+	}
+
+	// 同一时间的记录按ID倒序，保证最后添加的排在前面
+	query := s.db.Where("user_id = ?", userID).Order("created_at DESC").Order("id DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	histories := []PasswordHistory{}
+	if err := query.Find(&histories).Error; err != nil {
+		return nil, err
+	}
+	return histories, nil
+}
+
+// Cleanup 删除用户最新keepCount条以外的历史记录
+func (s *GormHistoryStorage) Cleanup(userID uint, keepCount int) error {
+	if userID == 0 {
+		return ErrInvalidUserID
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("user_id = ?", userID)
+		if keepCount > 0 {
+			// MySQL不支持在IN子查询中使用LIMIT，先查出要保留的ID
+			var keepIDs []uint
+			if err := tx.Model(&PasswordHistory{}).
+				Where("user_id = ?", userID).
+				Order("created_at DESC").Order("id DESC").
+				Limit(keepCount).
+				Pluck("id", &keepIDs).Error; err != nil {
+				return err
+			}
+			if len(keepIDs) < keepCount {
+				return nil
+			}
+			query = query.Where("id NOT IN ?", keepIDs)
+		}
+
+		return query.Delete(&PasswordHistory{}).Error
+	})
+}
+
 // PasswordHistoryManager 密码历史管理器
 type PasswordHistoryManager struct {
 	storage HistoryStorage
@@ -765,7 +1008,13 @@ type PasswordManager interface {
 
 	// 密码强度检测
 	CheckStrength(password string) PasswordStrength
+	// 检测密码强度，泄露密码库查询遵守ctx的截止时间
+	CheckStrengthContext(ctx context.Context, password string) PasswordStrength
 	IsPasswordStrong(password string) bool
+	// 按指定的最低分数检查密码强度，用于按角色要求不同强度，如管理员80分、普通用户60分
+	IsPasswordStrongForLevel(password string, minScore int) bool
+	// 比较两个密码的强度，a更强返回1，更弱返回-1，相同返回0
+	CompareStrength(a, b string) int
 
 	// 随机密码生成
 	GeneratePassword(options GenerateOptions) (string, error)
@@ -774,6 +1023,12 @@ type PasswordManager interface {
 	// 密码策略验证
 	ValidatePolicy(password string, policy PasswordPolicy) PolicyResult
 	ValidateWithDefaultPolicy(password string) PolicyResult
+	// 使用用户适用的策略验证密码，没有为用户或其角色分配策略时使用默认策略
+	ValidatePolicyForUser(userID uint, password string) (PolicyResult, error)
+	// 统一校验新密码：用户适用的策略、最低强度、与个人信息的相似度和历史密码，userID为0时使用默认策略且不检查历史
+	ValidatePassword(userID uint, password string, userInputs ...string) error
+	// 同ValidatePassword，但最低强度使用minScore而不是配置的MinStrengthScore
+	ValidatePasswordForLevel(userID uint, password string, minScore int, userInputs ...string) error
 
 	// 密码历史管理
 	AddToHistory(userID uint, passwordHash string) error
@@ -788,11 +1043,24 @@ type PasswordManager interface {
 
 // PasswordStrength 密码强度结果
 type PasswordStrength struct {
-	Score       int      `json:"score"`         // 0-100 分数
-	Level       string   `json:"level"`         // Weak/Medium/Strong/VeryStrong
-	Feedback    []string `json:"feedback"`      // 改进建议
-	Entropy     float64  `json:"entropy"`       // 熵值
-	TimeToCrack string   `json:"time_to_crack"` // 预估破解时间
+	Score         int                 `json:"score"`          // 0-100 分数
+	Level         string              `json:"level"`          // Weak/Medium/Strong/VeryStrong
+	Feedback      []string            `json:"feedback"`       // 改进建议
+	FeedbackCodes []string            `json:"feedback_codes"` // 与Feedback一一对应的反馈码
+	Composition   PasswordComposition `json:"composition"`    // 字符组成
+	Entropy       float64             `json:"entropy"`        // 熵值
+	TimeToCrack   string              `json:"time_to_crack"`  // 预估破解时间
+	BreachCount   int                 `json:"breach_count"`   // 在泄露密码库中出现的次数，未配置或查询失败时为0
+}
+
+// PasswordComposition 密码的字符组成
+type PasswordComposition struct {
+	Length      int  `json:"length"` // 字节长度
+	UniqueChars int  `json:"unique_chars"`
+	HasLower    bool `json:"has_lower"`
+	HasUpper    bool `json:"has_upper"`
+	HasNumbers  bool `json:"has_numbers"`
+	HasSymbols  bool `json:"has_symbols"`
 }
 
 // GenerateOptions 密码生成选项
@@ -804,6 +1072,10 @@ type GenerateOptions struct {
 	IncludeSymbols   bool   `json:"include_symbols"`
 	ExcludeAmbiguous bool   `json:"exclude_ambiguous"` // 排除易混淆字符
 	CustomCharset    string `json:"custom_charset"`
+	// 生成密码的最小熵值（位），按 长度 * log2(字符集大小) 计算，0表示不限制
+	MinEntropyBits float64 `json:"min_entropy_bits"`
+	// 长度不足以达到MinEntropyBits时自动加长，否则返回ErrInsufficientEntropy
+	ExtendToMinEntropy bool `json:"extend_to_min_entropy"`
 }
 
 // PasswordPolicy 密码策略
@@ -817,20 +1089,64 @@ type PasswordPolicy struct {
 	MinUniqueChars    int      `json:"min_unique_chars"`
 	ForbiddenPatterns []string `json:"forbidden_patterns"`
 	MaxRepeatedChars  int      `json:"max_repeated_chars"`
+	// 按严重程度从高到低排列Violations，严重程度相同时保持检查顺序；默认按检查顺序排列
+	SortViolationsBySeverity bool `json:"sort_violations_by_severity,omitempty"`
 }
 
 // PolicyResult 策略验证结果
 type PolicyResult struct {
-	Valid      bool     `json:"valid"`
-	Violations []string `json:"violations"`
-	Score      int      `json:"score"`
+	Valid      bool               `json:"valid"`
+	Violations []string           `json:"violations"`
+	Score      int                `json:"score"`
+	Rules      []PolicyRuleResult `json:"rules"` // 策略中启用的每条规则的检查结果
+}
+
+// PolicyRuleResult 单条策略规则的检查结果
+type PolicyRuleResult struct {
+	Rule     string `json:"rule"`              // 规则名，如min_length
+	Passed   bool   `json:"passed"`            // 是否通过
+	Message  string `json:"message,omitempty"` // 未通过时的说明，与Violations中的对应项相同
+	Severity int    `json:"severity"`          // 严重程度，即未通过时扣除的分数
+}
+
+// PasswordValidationError 密码校验失败的汇总错误，可用errors.Is匹配其中任一原因
+type PasswordValidationError struct {
+	Reasons    []error  // 失败原因，第一个为最先发现的失败
+	Violations []string // 面向用户的具体说明
+	details    [][]string
+}
+
+// Error 实现error接口
+func (e *PasswordValidationError) Error() string {
+	return e.Reasons[0].Error() + ": " + strings.Join(e.Violations, "; ")
+}
+
+// Unwrap 支持errors.Is匹配所有失败原因
+func (e *PasswordValidationError) Unwrap() []error {
+	return e.Reasons
+}
+
+// add 记录一个失败原因
+func (e *PasswordValidationError) add(reason error, violations ...string) {
+	e.Reasons = append(e.Reasons, reason)
+	e.details = append(e.details, violations)
+	if len(violations) == 0 {
+		violations = []string{reason.Error()}
+	}
+	e.Violations = append(e.Violations, violations...)
 }
 
 // PasswordHistory 密码历史记录
 type PasswordHistory struct {
-	UserID       uint      `json:"user_id"`
-	PasswordHash string    `json:"password_hash"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID           uint      `gorm:"primaryKey" json:"-"`
+	UserID       uint      `gorm:"not null;index:idx_password_history_user_created" json:"user_id"`
+	PasswordHash string    `gorm:"size:255;not null" json:"password_hash"`
+	CreatedAt    time.Time `gorm:"index:idx_password_history_user_created" json:"created_at"`
+}
+
+// TableName 设置表名
+func (PasswordHistory) TableName() string {
+	return "sys_password_histories"
 }
 
 // PasswordManagerConfig 密码管理配置
@@ -841,6 +1157,8 @@ type PasswordManagerConfig struct {
 	// 强度检测配置
 	MinStrengthScore      int  `json:"min_strength_score"`
 	EnableDictionaryCheck bool `json:"enable_dictionary_check"`
+	// 泄露密码库查询（如NewPwnedPasswordsChecker(nil)），为nil时只使用本地字典
+	BreachCounter PasswordBreachCounter `json:"-"`
 
 	// 生成配置
 	DefaultLength   int      `json:"default_length"`
@@ -848,10 +1166,16 @@ type PasswordManagerConfig struct {
 
 	// 策略配置
 	DefaultPolicy PasswordPolicy `json:"default_policy"`
+	// 按用户或角色分配的策略，为nil或未分配时使用DefaultPolicy
+	PolicyResolver PasswordPolicyResolver `json:"-"`
+	// 全局禁用词（如公司、产品名称），不区分大小写，合并到所有策略验证和强度检测中
+	GlobalForbiddenTerms []string `json:"global_forbidden_terms"`
 
 	// 历史配置
 	HistoryCount           int           `json:"history_count"`
 	HistoryCleanupInterval time.Duration `json:"history_cleanup_interval"`
+	// 密码历史记录时间的来源，为nil时使用系统时间
+	Clock Clock `json:"-"`
 }
 
 // HistoryStorage 密码历史存储接口
@@ -863,16 +1187,19 @@ type HistoryStorage interface {
 
 // 错误定义
 var (
-	ErrPasswordEmpty     = errors.New("密码不能为空")
-	ErrPasswordTooShort  = errors.New("密码长度不足")
-	ErrPasswordTooLong   = errors.New("密码长度过长")
-	ErrPasswordTooWeak   = errors.New("密码强度不足")
-	ErrPasswordInHistory = errors.New("密码与历史密码重复")
-	ErrInvalidOptions    = errors.New("生成选项无效")
-	ErrHashingFailed     = errors.New("密码加密失败")
-	ErrInvalidHash       = errors.New("无效的密码哈希")
-	ErrInvalidUserID     = errors.New("无效的用户ID")
-	ErrStorageError      = errors.New("存储操作失败")
+	ErrPasswordEmpty           = errors.New("密码不能为空")
+	ErrPasswordTooShort        = errors.New("密码长度不足")
+	ErrPasswordTooLong         = errors.New("密码长度过长")
+	ErrPasswordTooWeak         = errors.New("密码强度不足")
+	ErrPasswordInHistory       = errors.New("密码与历史密码重复")
+	ErrPasswordPolicyViolation = errors.New("密码不符合策略要求")
+	ErrPasswordTooSimilar      = errors.New("密码与个人信息过于相似")
+	ErrInvalidOptions          = errors.New("生成选项无效")
+	ErrInsufficientEntropy     = errors.New("生成长度不足以达到最小熵值")
+	ErrHashingFailed           = errors.New("密码加密失败")
+	ErrInvalidHash             = errors.New("无效的密码哈希")
+	ErrInvalidUserID           = errors.New("无效的用户ID")
+	ErrStorageError            = errors.New("存储操作失败")
 )
 
 // 默认配置
@@ -960,19 +1287,27 @@ type passwordManager struct {
 	historyManager  *PasswordHistoryManager
 }
 
-// NewPasswordManager 创建密码管理器
+// NewPasswordManager 创建密码管理器，密码历史保存在内存中
 func NewPasswordManager(config *PasswordManagerConfig) PasswordManager {
+	return NewPasswordManagerWithDB(config, nil)
+}
+
+// NewPasswordManagerWithDB 创建密码历史保存在数据库中的密码管理器，db为nil时与NewPasswordManager相同
+func NewPasswordManagerWithDB(config *PasswordManagerConfig, db *gorm.DB) PasswordManager {
 	if config == nil {
 		config = DefaultPasswordManagerConfig()
 	}
 
 	hasher := NewPasswordHasher(config.BcryptCost)
-	strengthChecker := NewPasswordStrengthChecker(config.EnableDictionaryCheck)
+	strengthChecker := newConfiguredStrengthChecker(config)
 	generator := NewPasswordGenerator()
 	policyValidator := NewPasswordPolicyValidator()
 
 	// 创建历史存储和管理器
-	historyStorage := NewMemoryHistoryStorage()
+	var historyStorage HistoryStorage = NewMemoryHistoryStorageWithClock(config.Clock)
+	if db != nil {
+		historyStorage = NewGormHistoryStorageWithClock(db, config.Clock)
+	}
 	historyManager := NewPasswordHistoryManager(historyStorage, hasher)
 
 	return &passwordManager{
@@ -985,6 +1320,40 @@ func NewPasswordManager(config *PasswordManagerConfig) PasswordManager {
 	}
 }
 
+// newConfiguredStrengthChecker 根据密码管理配置创建强度检测器
+func newConfiguredStrengthChecker(config *PasswordManagerConfig) *PasswordStrengthChecker {
+	checker := NewPasswordStrengthChecker(config.EnableDictionaryCheck)
+	checker.forbiddenTerms = normalizeForbiddenTerms(config.GlobalForbiddenTerms)
+	checker.breachCounter = config.BreachCounter
+	return checker
+}
+
+// normalizeForbiddenTerms 转为小写并去除空白和重复的禁用词
+func normalizeForbiddenTerms(terms []string) []string {
+	seen := make(map[string]bool, len(terms))
+	result := make([]string, 0, len(terms))
+	for _, term := range terms {
+		term = strings.ToLower(strings.TrimSpace(term))
+		if term == "" || seen[term] {
+			continue
+		}
+		seen[term] = true
+		result = append(result, term)
+	}
+	return result
+}
+
+// containsForbiddenTerm 检查密码是否包含禁用词，terms须为小写
+func containsForbiddenTerm(password string, terms []string) (string, bool) {
+	lower := strings.ToLower(password)
+	for _, term := range terms {
+		if strings.Contains(lower, term) {
+			return term, true
+		}
+	}
+	return "", false
+}
+
 // HashPassword 加密密码
 func (pm *passwordManager) HashPassword(password string) (string, error) {
 	return pm.hasher.Hash(password)
@@ -1000,6 +1369,16 @@ func (pm *passwordManager) CheckStrength(password string) PasswordStrength {
 	return pm.strengthChecker.CheckStrength(password)
 }
 
+// CheckStrengthContext 检测密码强度，泄露密码库查询遵守ctx的截止时间
+func (pm *passwordManager) CheckStrengthContext(ctx context.Context, password string) PasswordStrength {
+	return pm.strengthChecker.CheckStrengthContext(ctx, password)
+}
+
+// CompareStrength 比较两个密码的强度
+func (pm *passwordManager) CompareStrength(a, b string) int {
+	return pm.strengthChecker.CompareStrength(a, b)
+}
+
 // GeneratePassword 生成随机密码
 func (pm *passwordManager) GeneratePassword(options GenerateOptions) (string, error) {
 	return pm.generator.GeneratePassword(options)
@@ -1018,9 +1397,33 @@ func (pm *passwordManager) GenerateWithDefaults() (string, error) {
 	return pm.GeneratePassword(options)
 }
 
-// ValidatePolicy 验证密码策略
+// ValidatePolicy 验证密码策略，全局禁用词会合并到策略的禁用模式中
 func (pm *passwordManager) ValidatePolicy(password string, policy PasswordPolicy) PolicyResult {
-	return pm.policyValidator.ValidatePolicy(password, policy)
+	return pm.policyValidator.ValidatePolicy(password, pm.withGlobalForbiddenTerms(policy))
+}
+
+// withGlobalForbiddenTerms 返回合并了全局禁用词的策略副本，不修改调用方的策略
+func (pm *passwordManager) withGlobalForbiddenTerms(policy PasswordPolicy) PasswordPolicy {
+	terms := pm.strengthChecker.forbiddenTerms
+	if len(terms) == 0 {
+		return policy
+	}
+
+	// 策略中已有的模式不重复添加，避免同一违规被报告两次
+	existing := make(map[string]bool, len(policy.ForbiddenPatterns))
+	for _, pattern := range policy.ForbiddenPatterns {
+		existing[strings.ToLower(pattern)] = true
+	}
+
+	patterns := make([]string, 0, len(policy.ForbiddenPatterns)+len(terms))
+	patterns = append(patterns, policy.ForbiddenPatterns...)
+	for _, term := range terms {
+		if !existing[term] {
+			patterns = append(patterns, term)
+		}
+	}
+	policy.ForbiddenPatterns = patterns
+	return policy
 }
 
 // ValidateWithDefaultPolicy 使用默认策略验证密码
@@ -1028,6 +1431,86 @@ func (pm *passwordManager) ValidateWithDefaultPolicy(password string) PolicyResu
 	return pm.ValidatePolicy(password, pm.config.DefaultPolicy)
 }
 
+// ValidatePolicyForUser 使用用户适用的策略验证密码
+func (pm *passwordManager) ValidatePolicyForUser(userID uint, password string) (PolicyResult, error) {
+	policy := pm.config.DefaultPolicy
+	if pm.config.PolicyResolver != nil && userID != 0 {
+		resolved, ok, err := pm.config.PolicyResolver.ResolvePolicy(userID)
+		if err != nil {
+			return PolicyResult{}, err
+		}
+		if ok {
+			policy = resolved
+		}
+	}
+	return pm.ValidatePolicy(password, policy), nil
+}
+
+// ValidatePassword 统一校验新密码，注册、修改密码和重置密码都应调用此方法，避免规则分散
+func (pm *passwordManager) ValidatePassword(userID uint, password string, userInputs ...string) error {
+	return pm.ValidatePasswordForLevel(userID, password, pm.config.MinStrengthScore, userInputs...)
+}
+
+// ValidatePasswordForLevel 按指定的最低强度分数统一校验新密码
+func (pm *passwordManager) ValidatePasswordForLevel(userID uint, password string, minScore int, userInputs ...string) error {
+	if password == "" {
+		return ErrPasswordEmpty
+	}
+
+	result, err := pm.ValidatePolicyForUser(userID, password)
+	if err != nil {
+		return err
+	}
+
+	validationErr := &PasswordValidationError{}
+	if !result.Valid {
+		validationErr.add(ErrPasswordPolicyViolation, result.Violations...)
+	}
+	if !pm.IsPasswordStrongForLevel(password, minScore) {
+		validationErr.add(ErrPasswordTooWeak)
+	}
+	if similarToUserInputs(password, userInputs) {
+		validationErr.add(ErrPasswordTooSimilar, "密码不能包含用户名、邮箱等个人信息")
+	}
+	if userID != 0 {
+		inHistory, err := pm.CheckHistory(userID, password)
+		if err != nil {
+			return err
+		}
+		if inHistory {
+			validationErr.add(ErrPasswordInHistory)
+		}
+	}
+
+	if len(validationErr.Reasons) > 0 {
+		return validationErr
+	}
+	return nil
+}
+
+// similarToUserInputs 检查密码是否包含个人信息，或被个人信息包含；邮箱同时检查@之前的部分
+func similarToUserInputs(password string, userInputs []string) bool {
+	lower := strings.ToLower(password)
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		candidates := []string{input}
+		if local, _, ok := strings.Cut(input, "@"); ok {
+			candidates = append(candidates, local)
+		}
+
+		for _, candidate := range candidates {
+			// 过短的信息容易误判，不参与比较
+			if len([]rune(candidate)) < 3 {
+				continue
+			}
+			if strings.Contains(lower, candidate) || (len([]rune(lower)) >= 3 && strings.Contains(candidate, lower)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // AddToHistory 添加密码到历史记录
 func (pm *passwordManager) AddToHistory(userID uint, passwordHash string) error {
 	return pm.historyManager.AddToHistory(userID, passwordHash)
@@ -1043,6 +1526,11 @@ func (pm *passwordManager) CleanupHistory(userID uint, keepCount int) error {
 	return pm.historyManager.CleanupHistory(userID, keepCount)
 }
 
+// GetPasswordHistory 获取密码历史记录
+func (pm *passwordManager) GetPasswordHistory(userID uint, limit int) ([]PasswordHistory, error) {
+	return pm.historyManager.storage.GetHistory(userID, limit)
+}
+
 // GetConfig 获取配置
 func (pm *passwordManager) GetConfig() *PasswordManagerConfig {
 	return pm.config
@@ -1053,31 +1541,27 @@ func (pm *passwordManager) UpdateConfig(config *PasswordManagerConfig) {
 	if config != nil {
 		pm.config = config
 		pm.hasher.SetCost(config.BcryptCost)
-		pm.strengthChecker = NewPasswordStrengthChecker(config.EnableDictionaryCheck)
+		pm.strengthChecker = newConfiguredStrengthChecker(config)
 	}
 }
 
-// IsPasswordStrong 检查密码是否足够强
+// IsPasswordStrong 检查密码是否达到配置的最低强度分数
 func (pm *passwordManager) IsPasswordStrong(password string) bool {
+	return pm.IsPasswordStrongForLevel(password, pm.config.MinStrengthScore)
+}
+
+// IsPasswordStrongForLevel 检查密码是否达到minScore分
+func (pm *passwordManager) IsPasswordStrongForLevel(password string, minScore int) bool {
 	strength := pm.CheckStrength(password)
-	return strength.Score >= pm.config.MinStrengthScore
+	return strength.Score >= minScore
 }
 
 // ChangePassword 更改密码（包含历史检查）
 func (pm *passwordManager) ChangePassword(userID uint, newPassword string) (string, error) {
-	// 检查密码强度
-	if !pm.IsPasswordStrong(newPassword) {
-		return "", ErrPasswordTooWeak
-	}
-
-	// 检查历史记录
-	inHistory, err := pm.CheckHistory(userID, newPassword)
-	if err != nil {
+	// 校验策略、强度和历史记录
+	if err := pm.ValidatePassword(userID, newPassword); err != nil {
 		return "", err
 	}
-	if inHistory {
-		return "", ErrPasswordInHistory
-	}
 
 	// 加密新密码
 	hash, err := pm.HashPassword(newPassword)
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"testing"
+	"time"
 )
 
 func TestPasswordHasher(t *testing.T) {
@@ -112,3 +114,96 @@ func TestPasswordManager(t *testing.T) {
 		}
 	})
 }
+
+func TestGormHistoryStorage(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	storage := NewGormHistoryStorageWithClock(testDB.DB, clock)
+
+	t.Run("按时间倒序返回历史记录", func(t *testing.T) {
+		testDB.ClearAllData()
+
+		for _, hash := range []string{"hash-1", "hash-2", "hash-3"} {
+			if err := storage.Add(1, hash); err != nil {
+				t.Fatalf("添加历史记录失败: %v", err)
+			}
+			clock.Advance(time.Hour)
+		}
+		if err := storage.Add(2, "other-user"); err != nil {
+			t.Fatalf("添加历史记录失败: %v", err)
+		}
+
+		histories, err := storage.GetHistory(1, 2)
+		if err != nil {
+			t.Fatalf("获取历史记录失败: %v", err)
+		}
+		if len(histories) != 2 || histories[0].PasswordHash != "hash-3" || histories[1].PasswordHash != "hash-2" {
+			t.Errorf("应该按时间倒序返回最新的2条记录，实际: %+v", histories)
+		}
+	})
+
+	t.Run("清理时保留最新的记录", func(t *testing.T) {
+		testDB.ClearAllData()
+
+		for _, hash := range []string{"hash-1", "hash-2", "hash-3", "hash-4"} {
+			if err := storage.Add(1, hash); err != nil {
+				t.Fatalf("添加历史记录失败: %v", err)
+			}
+		}
+		if err := storage.Add(2, "other-user"); err != nil {
+			t.Fatalf("添加历史记录失败: %v", err)
+		}
+
+		if err := storage.Cleanup(1, 2); err != nil {
+			t.Fatalf("清理历史记录失败: %v", err)
+		}
+		histories, _ := storage.GetHistory(1, 0)
+		if len(histories) != 2 || histories[0].PasswordHash != "hash-4" || histories[1].PasswordHash != "hash-3" {
+			t.Errorf("应该只保留最新的2条记录，实际: %+v", histories)
+		}
+
+		if err := storage.Cleanup(1, 0); err != nil {
+			t.Fatalf("清理历史记录失败: %v", err)
+		}
+		if histories, _ := storage.GetHistory(1, 0); len(histories) != 0 {
+			t.Errorf("keepCount为0时应该删除全部记录，实际: %+v", histories)
+		}
+		if histories, _ := storage.GetHistory(2, 0); len(histories) != 1 {
+			t.Errorf("不应该影响其他用户的记录，实际: %+v", histories)
+		}
+	})
+
+	t.Run("无效参数", func(t *testing.T) {
+		if err := storage.Add(0, "hash"); !errors.Is(err, ErrInvalidUserID) {
+			t.Errorf("用户ID为0应该返回ErrInvalidUserID，实际: %v", err)
+		}
+		if err := storage.Add(1, ""); !errors.Is(err, ErrInvalidHash) {
+			t.Errorf("空哈希应该返回ErrInvalidHash，实际: %v", err)
+		}
+	})
+
+	t.Run("密码管理器使用数据库存储", func(t *testing.T) {
+		testDB.ClearAllData()
+
+		config := DefaultPasswordManagerConfig()
+		config.BcryptCost = 4
+		hash, err := NewPasswordManager(config).HashPassword("Tr0ub4dor&Zebra")
+		if err != nil {
+			t.Fatalf("加密密码失败: %v", err)
+		}
+		if err := NewPasswordManagerWithDB(config, testDB.DB).AddToHistory(1, hash); err != nil {
+			t.Fatalf("添加历史记录失败: %v", err)
+		}
+
+		// 新的管理器实例（如重启后）仍能检查到历史密码
+		inHistory, err := NewPasswordManagerWithDB(config, testDB.DB).CheckHistory(1, "Tr0ub4dor&Zebra")
+		if err != nil {
+			t.Fatalf("检查历史记录失败: %v", err)
+		}
+		if !inHistory {
+			t.Error("数据库中的历史密码应该在重启后仍然有效")
+		}
+	})
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"strings"
 	"testing"
 )
@@ -363,6 +366,60 @@ func TestPasswordGeneratorEdgeCases(t *testing.T) {
 		}
 	})
 
+	t.Run("自定义字符集满足字符类型要求", func(t *testing.T) {
+		customCharset := "abcdef23456789"
+		options := GenerateOptions{
+			Length:         6,
+			CustomCharset:  customCharset,
+			IncludeLower:   true,
+			IncludeNumbers: true,
+		}
+
+		for i := 0; i < 50; i++ {
+			password, err := generator.GeneratePassword(options)
+			if err != nil {
+				t.Fatalf("生成密码失败: %v", err)
+			}
+
+			if !strings.ContainsAny(password, LowerChars) || !strings.ContainsAny(password, NumberChars) {
+				t.Errorf("密码不满足字符类型要求: %s", password)
+			}
+
+			for _, char := range password {
+				if !strings.ContainsRune(customCharset, char) {
+					t.Errorf("密码包含自定义字符集外的字符: %c", char)
+				}
+			}
+		}
+	})
+
+	t.Run("自定义字符集无法满足字符类型要求", func(t *testing.T) {
+		options := GenerateOptions{
+			Length:         10,
+			CustomCharset:  "abcdefghijk",
+			IncludeNumbers: true,
+		}
+
+		_, err := generator.GeneratePassword(options)
+		if err != ErrInvalidOptions {
+			t.Errorf("期望返回 ErrInvalidOptions，实际为 %v", err)
+		}
+	})
+
+	t.Run("自定义字符集排除易混淆字符后无法满足要求", func(t *testing.T) {
+		options := GenerateOptions{
+			Length:           10,
+			CustomCharset:    "abcdef01",
+			IncludeNumbers:   true,
+			ExcludeAmbiguous: true,
+		}
+
+		_, err := generator.GeneratePassword(options)
+		if err != ErrInvalidOptions {
+			t.Errorf("期望返回 ErrInvalidOptions，实际为 %v", err)
+		}
+	})
+
 	t.Run("空自定义字符集", func(t *testing.T) {
 		options := GenerateOptions{
 			Length:         10,
@@ -397,3 +454,156 @@ func TestPasswordGeneratorEdgeCases(t *testing.T) {
 		}
 	})
 }
+
+func TestPasswordGeneratorMinEntropy(t *testing.T) {
+	generator := NewPasswordGenerator()
+
+	t.Run("长度足够时不改变长度", func(t *testing.T) {
+		// 小写字母：12 * log2(26) ≈ 56.4位
+		options := GenerateOptions{Length: 12, IncludeLower: true, MinEntropyBits: 56}
+
+		password, err := generator.GeneratePassword(options)
+		if err != nil {
+			t.Fatalf("生成密码失败: %v", err)
+		}
+		if len(password) != 12 {
+			t.Errorf("期望密码长度为 12，实际为 %d", len(password))
+		}
+	})
+
+	t.Run("长度不足时返回错误", func(t *testing.T) {
+		options := GenerateOptions{Length: 6, CustomCharset: "abcd", MinEntropyBits: 64}
+
+		_, err := generator.GeneratePassword(options)
+		if !errors.Is(err, ErrInsufficientEntropy) {
+			t.Errorf("期望返回 ErrInsufficientEntropy，实际为 %v", err)
+		}
+	})
+
+	t.Run("自动加长到最小熵", func(t *testing.T) {
+		// 4个字符每位2位熵，64位需要32个字符
+		options := GenerateOptions{Length: 6, CustomCharset: "abcd", MinEntropyBits: 64, ExtendToMinEntropy: true}
+
+		password, err := generator.GeneratePassword(options)
+		if err != nil {
+			t.Fatalf("生成密码失败: %v", err)
+		}
+		if len(password) != 32 {
+			t.Errorf("期望密码长度为 32，实际为 %d", len(password))
+		}
+	})
+
+	t.Run("按去重后的字符集计算", func(t *testing.T) {
+		options := GenerateOptions{Length: 6, CustomCharset: "aabbccdd", MinEntropyBits: 64, ExtendToMinEntropy: true}
+
+		password, err := generator.GeneratePassword(options)
+		if err != nil {
+			t.Fatalf("生成密码失败: %v", err)
+		}
+		if len(password) != 32 {
+			t.Errorf("期望密码长度为 32，实际为 %d", len(password))
+		}
+	})
+
+	t.Run("排除易混淆字符后重新计算", func(t *testing.T) {
+		// 排除0和1后只剩8个数字，每位3位熵
+		options := GenerateOptions{Length: 4, IncludeNumbers: true, ExcludeAmbiguous: true, MinEntropyBits: 30, ExtendToMinEntropy: true}
+
+		password, err := generator.GeneratePassword(options)
+		if err != nil {
+			t.Fatalf("生成密码失败: %v", err)
+		}
+		if len(password) != 10 {
+			t.Errorf("期望密码长度为 10，实际为 %d", len(password))
+		}
+	})
+
+	t.Run("单一字符无法达到最小熵", func(t *testing.T) {
+		options := GenerateOptions{Length: 8, CustomCharset: "aaaa", MinEntropyBits: 1, ExtendToMinEntropy: true}
+
+		_, err := generator.GeneratePassword(options)
+		if !errors.Is(err, ErrInsufficientEntropy) {
+			t.Errorf("期望返回 ErrInsufficientEntropy，实际为 %v", err)
+		}
+	})
+
+	t.Run("加长后超过最大长度", func(t *testing.T) {
+		options := GenerateOptions{Length: 8, CustomCharset: "ab", MinEntropyBits: 300, ExtendToMinEntropy: true}
+
+		_, err := generator.GeneratePassword(options)
+		if !errors.Is(err, ErrInsufficientEntropy) {
+			t.Errorf("期望返回 ErrInsufficientEntropy，实际为 %v", err)
+		}
+	})
+}
+
+func TestSecureRandomIntDistribution(t *testing.T) {
+	generator := NewPasswordGenerator()
+
+	for _, max := range []int{3, 7, 10} {
+		t.Run(fmt.Sprintf("max=%d时各值出现频率均匀", max), func(t *testing.T) {
+			const samples = 70000
+			counts := make([]int, max)
+			for i := 0; i < samples; i++ {
+				n, err := generator.secureRandomInt(max)
+				if err != nil {
+					t.Fatalf("生成随机数失败: %v", err)
+				}
+				if n < 0 || n >= max {
+					t.Fatalf("随机数 %d 超出范围 [0, %d)", n, max)
+				}
+				counts[n]++
+			}
+
+			// 允许偏离期望频率5%，至少为标准差的4倍，正常实现几乎不会误报
+			expected := float64(samples) / float64(max)
+			for value, count := range counts {
+				if math.Abs(float64(count)-expected) > expected*0.05 {
+					t.Errorf("值 %d 出现 %d 次，期望约 %.0f 次", value, count, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestSecureRandomIntBoundaries(t *testing.T) {
+	generator := NewPasswordGenerator()
+
+	t.Run("非正数返回错误", func(t *testing.T) {
+		for _, max := range []int{0, -1, math.MinInt32} {
+			if _, err := generator.secureRandomInt(max); !errors.Is(err, ErrInvalidOptions) {
+				t.Errorf("max=%d 期望返回 ErrInvalidOptions，实际为 %v", max, err)
+			}
+		}
+	})
+
+	t.Run("max为1时总是返回0", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			if n, err := generator.secureRandomInt(1); err != nil || n != 0 {
+				t.Fatalf("期望返回 0，实际为 %d, %v", n, err)
+			}
+		}
+	})
+
+	t.Run("接近int32边界的max", func(t *testing.T) {
+		for _, max := range []int{math.MaxInt32 - 1, math.MaxInt32, math.MaxInt32 + 1, 1 << 32, math.MaxInt64} {
+			sawUpperHalf := false
+			for i := 0; i < 200; i++ {
+				n, err := generator.secureRandomInt(max)
+				if err != nil {
+					t.Fatalf("max=%d 生成随机数失败: %v", max, err)
+				}
+				if n < 0 || n >= max {
+					t.Fatalf("随机数 %d 超出范围 [0, %d)", n, max)
+				}
+				if n >= max/2 {
+					sawUpperHalf = true
+				}
+			}
+			// 200次都落在下半区间的概率为2^-200
+			if !sawUpperHalf {
+				t.Errorf("max=%d 时从未生成上半区间的值", max)
+			}
+		}
+	})
+}
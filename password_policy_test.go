@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -244,6 +245,57 @@ func TestPasswordPolicyValidator(t *testing.T) {
 		// 应该能处理极长密码而不崩溃
 		_ = result
 	})
+
+	t.Run("违规严重程度测试", func(t *testing.T) {
+		policy := PasswordPolicy{
+			MinLength:        12,
+			RequireUpper:     true,
+			MaxRepeatedChars: 2,
+			MinUniqueChars:   8,
+		}
+
+		result := validator.ValidatePolicy("aaab", policy)
+		severities := map[string]int{}
+		for _, rule := range result.Rules {
+			severities[rule.Rule] = rule.Severity
+		}
+		if severities[PolicyRuleMinLength] != 20 || severities[PolicyRuleRequireUpper] != 15 || severities[PolicyRuleMinUniqueChars] != 10 {
+			t.Errorf("严重程度应等于扣除的分数，实际: %v", severities)
+		}
+		if 100-result.Score != 20+15+10+15 {
+			t.Errorf("扣除的分数应等于未通过规则的严重程度之和，实际分数: %d", result.Score)
+		}
+
+		// 默认按检查顺序排列
+		expected := []string{"密码长度不能少于12个字符", "密码必须包含大写字母", "密码至少需要8个不同的字符", "连续重复字符不能超过2个"}
+		if !equalStrings(result.Violations, expected) {
+			t.Errorf("默认应按检查顺序排列，实际: %v", result.Violations)
+		}
+
+		// 按严重程度排列，相同时保持检查顺序
+		policy.SortViolationsBySeverity = true
+		result = validator.ValidatePolicy("aaab", policy)
+		expected = []string{"密码长度不能少于12个字符", "密码必须包含大写字母", "连续重复字符不能超过2个", "密码至少需要8个不同的字符"}
+		if !equalStrings(result.Violations, expected) {
+			t.Errorf("应按严重程度从高到低排列，实际: %v", result.Violations)
+		}
+		if result.Rules[len(result.Rules)-2].Rule != PolicyRuleMinUniqueChars {
+			t.Errorf("Rules应保持检查顺序，实际: %v", result.Rules)
+		}
+	})
+}
+
+// equalStrings 比较两个字符串切片是否相同
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
 }
 
 func TestPasswordManagerPolicyIntegration(t *testing.T) {
@@ -342,6 +394,57 @@ func TestPasswordManagerPolicyIntegration(t *testing.T) {
 			t.Errorf("符合新策略的密码应该通过验证，违规信息: %v", result.Violations)
 		}
 	})
+
+	t.Run("全局禁用词合并到策略验证", func(t *testing.T) {
+		config := DefaultPasswordManagerConfig()
+		config.GlobalForbiddenTerms = []string{"Acme", " widget ", ""}
+		pm := NewPasswordManager(config)
+
+		// 不区分大小写，且合并到默认策略和自定义策略中
+		result := pm.ValidateWithDefaultPolicy("MyACMESecret123")
+		if result.Valid {
+			t.Error("包含全局禁用词的密码不应该通过默认策略验证")
+		}
+
+		policy := PasswordPolicy{MinLength: 8}
+		result = pm.ValidatePolicy("superWidget2024", policy)
+		if result.Valid {
+			t.Error("包含全局禁用词的密码不应该通过自定义策略验证")
+		}
+		if len(policy.ForbiddenPatterns) != 0 {
+			t.Errorf("不应该修改调用方的策略，实际禁用模式: %v", policy.ForbiddenPatterns)
+		}
+
+		// 策略中已有的模式不重复报告
+		result = pm.ValidatePolicy("AcmeSecret2024", PasswordPolicy{MinLength: 8, ForbiddenPatterns: []string{"ACME"}})
+		if len(result.Violations) != 1 {
+			t.Errorf("期望1条违规信息，实际为: %v", result.Violations)
+		}
+
+		// 不包含禁用词的密码仍然通过
+		result = pm.ValidateWithDefaultPolicy("MySecret123")
+		if !result.Valid {
+			t.Errorf("不包含禁用词的密码应该通过验证，违规信息: %v", result.Violations)
+		}
+	})
+
+	t.Run("更新配置后全局禁用词立即生效", func(t *testing.T) {
+		pm := NewPasswordManager(DefaultPasswordManagerConfig())
+
+		result := pm.ValidateWithDefaultPolicy("MyAcmeSecret123")
+		if !result.Valid {
+			t.Errorf("未配置禁用词时密码应该通过验证，违规信息: %v", result.Violations)
+		}
+
+		newConfig := DefaultPasswordManagerConfig()
+		newConfig.GlobalForbiddenTerms = []string{"acme"}
+		pm.UpdateConfig(newConfig)
+
+		result = pm.ValidateWithDefaultPolicy("MyAcmeSecret123")
+		if result.Valid {
+			t.Error("更新配置后包含禁用词的密码不应该通过验证")
+		}
+	})
 }
 
 func TestPasswordPolicyEdgeCases(t *testing.T) {
@@ -440,3 +543,213 @@ func TestPasswordPolicyEdgeCases(t *testing.T) {
 		}
 	})
 }
+
+func TestPasswordManagerValidatePassword(t *testing.T) {
+	newManager := func() PasswordManager {
+		config := DefaultPasswordManagerConfig()
+		config.BcryptCost = 4
+		return NewPasswordManager(config)
+	}
+
+	t.Run("合格密码通过校验", func(t *testing.T) {
+		pm := newManager()
+		if err := pm.ValidatePassword(1, "Tr0ub4dor&Zebra", "alice", "alice@example.com"); err != nil {
+			t.Errorf("合格密码应该通过校验，实际错误: %v", err)
+		}
+	})
+
+	t.Run("空密码", func(t *testing.T) {
+		pm := newManager()
+		if err := pm.ValidatePassword(1, ""); !errors.Is(err, ErrPasswordEmpty) {
+			t.Errorf("空密码应该返回ErrPasswordEmpty，实际: %v", err)
+		}
+	})
+
+	t.Run("汇总多个失败原因", func(t *testing.T) {
+		pm := newManager()
+		err := pm.ValidatePassword(1, "alice", "alice")
+
+		var validationErr *PasswordValidationError
+		if !errors.As(err, &validationErr) {
+			t.Fatalf("应该返回PasswordValidationError，实际: %v", err)
+		}
+		for _, reason := range []error{ErrPasswordPolicyViolation, ErrPasswordTooWeak, ErrPasswordTooSimilar} {
+			if !errors.Is(err, reason) {
+				t.Errorf("应该包含失败原因 %v，实际: %v", reason, err)
+			}
+		}
+		if validationErr.Reasons[0] != ErrPasswordPolicyViolation {
+			t.Errorf("第一个失败原因应该是策略违规，实际: %v", validationErr.Reasons[0])
+		}
+		if len(validationErr.Violations) < 3 {
+			t.Errorf("应该包含具体的违规说明，实际: %v", validationErr.Violations)
+		}
+	})
+
+	t.Run("与个人信息相似", func(t *testing.T) {
+		pm := newManager()
+
+		cases := []struct {
+			password string
+			inputs   []string
+		}{
+			{"Zebra#Alice2024", []string{"alice"}},
+			{"Zebra#Wonderland24", []string{"wonderland@example.com"}},
+			{"Zebra#2024Bob", []string{"  BOB  "}},
+		}
+		for _, c := range cases {
+			if err := pm.ValidatePassword(0, c.password, c.inputs...); !errors.Is(err, ErrPasswordTooSimilar) {
+				t.Errorf("密码 %s 与 %v 相似，应该返回ErrPasswordTooSimilar，实际: %v", c.password, c.inputs, err)
+			}
+		}
+
+		// 过短的个人信息不参与比较
+		if err := pm.ValidatePassword(0, "Tr0ub4dor&Zebra", "tr", ""); err != nil {
+			t.Errorf("过短的个人信息不应该导致校验失败，实际: %v", err)
+		}
+	})
+
+	t.Run("历史密码重复", func(t *testing.T) {
+		pm := newManager()
+		hash, err := pm.HashPassword("Tr0ub4dor&Zebra")
+		if err != nil {
+			t.Fatalf("加密密码失败: %v", err)
+		}
+		if err := pm.AddToHistory(1, hash); err != nil {
+			t.Fatalf("添加历史记录失败: %v", err)
+		}
+
+		if err := pm.ValidatePassword(1, "Tr0ub4dor&Zebra"); !errors.Is(err, ErrPasswordInHistory) {
+			t.Errorf("历史密码应该返回ErrPasswordInHistory，实际: %v", err)
+		}
+		// 其他用户和未指定用户时不检查历史
+		if err := pm.ValidatePassword(2, "Tr0ub4dor&Zebra"); err != nil {
+			t.Errorf("其他用户不应该受历史记录影响，实际: %v", err)
+		}
+		if err := pm.ValidatePassword(0, "Tr0ub4dor&Zebra"); err != nil {
+			t.Errorf("userID为0时不应该检查历史，实际: %v", err)
+		}
+	})
+
+	t.Run("按指定分数要求强度", func(t *testing.T) {
+		pm := newManager()
+		// 70分的密码满足默认的60分，不满足管理员的80分
+		if err := pm.ValidatePassword(0, "Blue7Horse!"); err != nil {
+			t.Errorf("默认强度要求下应该通过校验，实际: %v", err)
+		}
+		if err := pm.ValidatePasswordForLevel(0, "Blue7Horse!", 80); !errors.Is(err, ErrPasswordTooWeak) {
+			t.Errorf("未达到80分应该返回ErrPasswordTooWeak，实际: %v", err)
+		}
+		if err := pm.ValidatePasswordForLevel(0, "Kx9#mQ2$vL7p", 80); err != nil {
+			t.Errorf("达到80分的密码应该通过校验，实际: %v", err)
+		}
+	})
+}
+
+func TestStrictestPasswordPolicy(t *testing.T) {
+	merged := StrictestPasswordPolicy(
+		PasswordPolicy{MinLength: 8, MaxLength: 64, RequireLower: true, MaxRepeatedChars: 3, ForbiddenPatterns: []string{"acme"}},
+		PasswordPolicy{MinLength: 14, RequireSymbols: true, MinUniqueChars: 6, ForbiddenPatterns: []string{"ACME", "admin"}},
+		PasswordPolicy{MaxLength: 32},
+	)
+
+	if merged.MinLength != 14 || merged.MinUniqueChars != 6 {
+		t.Errorf("最小要求应该取最大值，实际: %+v", merged)
+	}
+	if merged.MaxLength != 32 || merged.MaxRepeatedChars != 3 {
+		t.Errorf("上限应该取非0的最小值，实际: %+v", merged)
+	}
+	if !merged.RequireLower || !merged.RequireSymbols || merged.RequireUpper {
+		t.Errorf("字符要求应该取并集，实际: %+v", merged)
+	}
+	if len(merged.ForbiddenPatterns) != 2 {
+		t.Errorf("禁用模式应该不区分大小写去重，实际: %v", merged.ForbiddenPatterns)
+	}
+}
+
+func TestPasswordManagerValidatePolicyForUser(t *testing.T) {
+	strict := PasswordPolicy{MinLength: 16, RequireUpper: true, RequireNumbers: true, RequireSymbols: true}
+	lenient := PasswordPolicy{MinLength: 6}
+
+	newManager := func(resolver PasswordPolicyResolver) PasswordManager {
+		config := DefaultPasswordManagerConfig()
+		config.BcryptCost = 4
+		config.PolicyResolver = resolver
+		return NewPasswordManager(config)
+	}
+
+	t.Run("没有分配策略时使用默认策略", func(t *testing.T) {
+		pm := newManager(NewPasswordPolicyAssignments(&stubRoleService{roles: []*Role{{Name: "user"}}}))
+		result, err := pm.ValidatePolicyForUser(1, "Tr0ub4dor&Zebra")
+		if err != nil || !result.Valid {
+			t.Errorf("符合默认策略的密码应该通过，实际: %v %v", result.Violations, err)
+		}
+	})
+
+	t.Run("按角色取最严格的策略", func(t *testing.T) {
+		assignments := NewPasswordPolicyAssignments(&stubRoleService{roles: []*Role{{Name: "user"}, {Name: "admin"}}})
+		assignments.SetRolePolicy("user", lenient)
+		assignments.SetRolePolicy("admin", strict)
+		pm := newManager(assignments)
+
+		result, err := pm.ValidatePolicyForUser(1, "Tr0ub4dor&Zebra")
+		if err != nil {
+			t.Fatalf("解析策略失败: %v", err)
+		}
+		if result.Valid {
+			t.Error("管理员的密码应该按16位的严格策略校验")
+		}
+		if err := pm.ValidatePassword(1, "Tr0ub4dor&Zebra"); !errors.Is(err, ErrPasswordPolicyViolation) {
+			t.Errorf("ValidatePassword应该使用用户适用的策略，实际: %v", err)
+		}
+	})
+
+	t.Run("用户策略优先于角色策略", func(t *testing.T) {
+		assignments := NewPasswordPolicyAssignments(&stubRoleService{roles: []*Role{{Name: "admin"}}})
+		assignments.SetRolePolicy("admin", strict)
+		assignments.DefinePolicy("service-account", lenient)
+		if err := assignments.AssignUserPolicy(2, "service-account"); err != nil {
+			t.Fatalf("分配命名策略失败: %v", err)
+		}
+		pm := newManager(assignments)
+
+		result, err := pm.ValidatePolicyForUser(2, "svc#key")
+		if err != nil || !result.Valid {
+			t.Errorf("服务账号应该使用宽松策略，实际: %v %v", result.Violations, err)
+		}
+
+		assignments.RemoveUserPolicy(2)
+		if result, _ := pm.ValidatePolicyForUser(2, "svc#key"); result.Valid {
+			t.Error("移除用户策略后应该回到角色策略")
+		}
+	})
+
+	t.Run("分配未定义的命名策略", func(t *testing.T) {
+		assignments := NewPasswordPolicyAssignments(nil)
+		if err := assignments.AssignRolePolicy("admin", "missing"); !errors.Is(err, ErrPasswordPolicyNotFound) {
+			t.Errorf("应该返回ErrPasswordPolicyNotFound，实际: %v", err)
+		}
+	})
+
+	t.Run("加载角色失败", func(t *testing.T) {
+		assignments := NewPasswordPolicyAssignments(&stubRoleService{err: errors.New("查询超时")})
+		assignments.SetRolePolicy("admin", strict)
+		pm := newManager(assignments)
+
+		if _, err := pm.ValidatePolicyForUser(1, "Tr0ub4dor&Zebra"); err == nil {
+			t.Error("加载角色失败时应该返回错误")
+		}
+		if err := pm.ValidatePassword(1, "Tr0ub4dor&Zebra"); err == nil {
+			t.Error("加载角色失败时ValidatePassword应该返回错误而不是放行")
+		}
+	})
+
+	t.Run("userID为0时使用默认策略", func(t *testing.T) {
+		assignments := NewPasswordPolicyAssignments(nil)
+		assignments.SetUserPolicy(0, strict)
+		pm := newManager(assignments)
+		if result, err := pm.ValidatePolicyForUser(0, "Tr0ub4dor&Zebra"); err != nil || !result.Valid {
+			t.Errorf("注册等没有userID的场景应该使用默认策略，实际: %v %v", result.Violations, err)
+		}
+	})
+}
@@ -257,6 +257,94 @@ func TestPasswordManagerStrengthIntegration(t *testing.T) {
 			t.Error("强密码应该被认为是强密码")
 		}
 	})
+
+	t.Run("IsPasswordStrongForLevel 方法测试", func(t *testing.T) {
+		password := "Blue7Horse!"
+		if !pm.IsPasswordStrongForLevel(password, 60) {
+			t.Error("密码应该达到60分")
+		}
+		if pm.IsPasswordStrongForLevel(password, 80) {
+			t.Error("密码不应该达到80分")
+		}
+		if pm.IsPasswordStrongForLevel(password, 60) != pm.IsPasswordStrong(password) {
+			t.Error("IsPasswordStrong应该使用配置的MinStrengthScore")
+		}
+	})
+
+	t.Run("全局禁用词使强度检测不通过", func(t *testing.T) {
+		password := "MyVeryStr0ngAcme2024!"
+		if !pm.IsPasswordStrong(password) {
+			t.Fatal("未配置禁用词时密码应该被认为是强密码")
+		}
+
+		newConfig := DefaultPasswordManagerConfig()
+		newConfig.GlobalForbiddenTerms = []string{"ACME"}
+		pm.UpdateConfig(newConfig)
+
+		result := pm.CheckStrength(password)
+		if result.Level != StrengthWeak {
+			t.Errorf("包含禁用词的密码应该被评为 %s，实际为 %s", StrengthWeak, result.Level)
+		}
+		if pm.IsPasswordStrong(password) {
+			t.Error("包含禁用词的密码不应该被认为是强密码")
+		}
+
+		found := false
+		for _, feedback := range result.Feedback {
+			if feedback == "密码不能包含禁用词: acme" {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("应该提示包含禁用词，实际反馈: %v", result.Feedback)
+		}
+	})
+}
+
+func TestCompareStrength(t *testing.T) {
+	checker := NewPasswordStrengthChecker(true)
+
+	t.Run("明显更强", func(t *testing.T) {
+		if result := checker.CompareStrength("MyStr0ngP@ssw0rd!", "password"); result != 1 {
+			t.Errorf("期望返回 1，实际为 %d", result)
+		}
+	})
+
+	t.Run("明显更弱", func(t *testing.T) {
+		if result := checker.CompareStrength("123", "MyStr0ngP@ssw0rd!"); result != -1 {
+			t.Errorf("期望返回 -1，实际为 %d", result)
+		}
+	})
+
+	t.Run("强度相同", func(t *testing.T) {
+		if result := checker.CompareStrength("MyStr0ngP@ssw0rd!", "MyStr0ngP@ssw0rd!"); result != 0 {
+			t.Errorf("期望返回 0，实际为 %d", result)
+		}
+		if result := checker.CompareStrength("", ""); result != 0 {
+			t.Errorf("期望两个空密码返回 0，实际为 %d", result)
+		}
+	})
+
+	t.Run("分数相同时比较熵值", func(t *testing.T) {
+		shorter, longer := "Xk9#mQ2$vL7@pR4!", "Xk9#mQ2$vL7@pR4!zT8&wN3^"
+		if checker.CheckStrength(shorter).Score != checker.CheckStrength(longer).Score {
+			t.Fatal("测试前提不成立：两个密码的分数应该相同")
+		}
+		if result := checker.CompareStrength(longer, shorter); result != 1 {
+			t.Errorf("期望熵值更高的密码返回 1，实际为 %d", result)
+		}
+		if result := checker.CompareStrength(shorter, longer); result != -1 {
+			t.Errorf("期望熵值更低的密码返回 -1，实际为 %d", result)
+		}
+	})
+
+	t.Run("密码管理器", func(t *testing.T) {
+		pm := NewPasswordManager(DefaultPasswordManagerConfig())
+		if result := pm.CompareStrength("password", "MyStr0ngP@ssw0rd!"); result != -1 {
+			t.Errorf("期望返回 -1，实际为 %d", result)
+		}
+	})
 }
 
 func TestPasswordStrengthEdgeCases(t *testing.T) {
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"aigo_service_auth/errorcodes"
+)
+
+// CaptchaTokenHeader 携带人机验证Token的请求头
+const CaptchaTokenHeader = "X-Captcha-Token"
+
+// 密码评估中可能因超出时间预算而未完成的检查
+const (
+	PasswordCheckBreach = "breach"
+)
+
+// PasswordBreachChecker 泄露密码检查接口，由接入方对接泄露密码库（如按哈希前缀查询的在线服务）
+//
+// 实现必须遵守ctx的截止时间，且不得记录或保存password。
+type PasswordBreachChecker interface {
+	IsBreached(ctx context.Context, password string) (bool, error)
+}
+
+// PasswordEvaluation 密码评估结果，用于注册表单在用户输入时给出反馈
+type PasswordEvaluation struct {
+	Strength   PasswordStrength `json:"strength"`
+	Policy     PolicyResult     `json:"policy"`               // 默认策略（含全局禁用词）的逐条检查结果
+	MinScore   int              `json:"min_score"`            // 要求的最低强度分数
+	TooSimilar bool             `json:"too_similar"`          // 与用户名、邮箱过于相似
+	Breached   *bool            `json:"breached"`             // 是否出现在泄露密码库中，未检查或未完成时为null
+	Acceptable bool             `json:"acceptable"`           // 已完成的检查是否全部通过
+	Partial    bool             `json:"partial"`              // 是否有检查未在时间预算内完成
+	Incomplete []string         `json:"incomplete,omitempty"` // 未完成的检查，如breach
+}
+
+// EvaluatePassword 按密码管理器的默认策略和最低强度评估密码，breach不为nil时在ctx截止前检查泄露密码库
+//
+// 与ValidatePassword使用相同的规则，但不检查密码历史，也不返回错误，便于逐条展示。
+// 泄露检查超时或出错时结果标记为Partial，Acceptable只反映已完成的检查。
+// 密码管理器配置了BreachCounter时，强度评分中的泄露查询同样受ctx的截止时间约束。
+func EvaluatePassword(ctx context.Context, pm PasswordManager, breach PasswordBreachChecker, password string, userInputs ...string) PasswordEvaluation {
+	evaluation := PasswordEvaluation{
+		Strength:   pm.CheckStrengthContext(ctx, password),
+		Policy:     pm.ValidateWithDefaultPolicy(password),
+		MinScore:   pm.GetConfig().MinStrengthScore,
+		TooSimilar: similarToUserInputs(password, userInputs),
+	}
+	evaluation.Acceptable = password != "" && evaluation.Policy.Valid &&
+		evaluation.Strength.Score >= evaluation.MinScore && !evaluation.TooSimilar
+
+	if breach != nil && password != "" {
+		if breached, ok := checkBreachWithin(ctx, breach, password); ok {
+			evaluation.Breached = &breached
+			evaluation.Acceptable = evaluation.Acceptable && !breached
+		} else {
+			evaluation.Partial = true
+			evaluation.Incomplete = append(evaluation.Incomplete, PasswordCheckBreach)
+		}
+	}
+	return evaluation
+}
+
+// checkBreachWithin 在ctx截止前完成泄露检查，超时或出错时ok为false
+//
+// 检查在单独的goroutine中执行，不遵守截止时间的实现也不会拖慢响应。
+func checkBreachWithin(ctx context.Context, breach PasswordBreachChecker, password string) (breached bool, ok bool) {
+	type result struct {
+		breached bool
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		breached, err := breach.IsBreached(ctx, password)
+		done <- result{breached, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.breached, r.err == nil
+	case <-ctx.Done():
+		return false, false
+	}
+}
+
+// PasswordEvaluateConfig 密码评估接口配置
+type PasswordEvaluateConfig struct {
+	RateLimitStore  RateLimitStore        // 按客户端IP限流的计数存储，为nil时使用内存存储
+	RateLimit       int                   // 每个IP在RateLimitWindow内最多的评估次数，0表示不限流
+	RateLimitWindow time.Duration         // 限流窗口
+	Captcha         CaptchaVerifier       // 配置后要求请求在X-Captcha-Token头中携带有效的人机验证Token
+	BreachChecker   PasswordBreachChecker // 泄露密码检查，为nil时不检查
+	TimeBudget      time.Duration         // 每个请求中泄露检查的时间预算，超出时返回部分结果
+	MaxBodyBytes    int64                 // 请求体最大字节数
+	AuditLogger     AuditLogger           // 记录被限流的请求（只含IP），为nil时不记录
+}
+
+// DefaultPasswordEvaluateConfig 默认密码评估接口配置
+func DefaultPasswordEvaluateConfig() *PasswordEvaluateConfig {
+	return &PasswordEvaluateConfig{
+		RateLimit:       60,
+		RateLimitWindow: time.Minute,
+		TimeBudget:      200 * time.Millisecond,
+		MaxBodyBytes:    4 << 10,
+	}
+}
+
+// passwordEvaluateRequest 密码评估请求体
+type passwordEvaluateRequest struct {
+	Password string `json:"password"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+// NewPasswordEvaluateHandler 创建密码评估处理器，挂载为POST /auth/password/evaluate，无需认证
+//
+// 请求体为{"password": "...", "username": "...", "email": "..."}，username和email可选，用于相似度检查；
+// 响应为PasswordEvaluation。提交的密码只在内存中参与计算，不写入日志、审计记录或任何存储，
+// 限流计数只以客户端IP为键。响应设置Cache-Control: no-store。
+func NewPasswordEvaluateHandler(pm PasswordManager, config *PasswordEvaluateConfig) http.HandlerFunc {
+	if config == nil {
+		config = DefaultPasswordEvaluateConfig()
+	}
+	store := config.RateLimitStore
+	if store == nil {
+		store = NewMemoryRateLimitStore()
+	}
+	auditLogger := config.AuditLogger
+	if auditLogger == nil {
+		auditLogger = noopAuditLogger{}
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeErrorCode(w, errorcodes.ErrCodeMethodNotAllowed, "不支持的请求方法")
+			return
+		}
+
+		// 限流在读取请求体之前进行，被限流的请求不解析密码
+		ip := remoteIP(r)
+		if config.RateLimit > 0 {
+			count, err := store.Increment("password_evaluate:"+ip, config.RateLimitWindow)
+			if err != nil {
+				writeErrorCode(w, errorcodes.ErrCodeInternal, "限流检查失败")
+				return
+			}
+			if count > config.RateLimit {
+				if count == config.RateLimit+1 {
+					auditLogger.Log(AuditEvent{Type: AuditEventPasswordEvaluateThrottled, Detail: "ip=" + ip})
+				}
+				writeErrorCode(w, errorcodes.ErrCodeRateLimited, "请求过于频繁，请稍后再试")
+				return
+			}
+		}
+
+		if config.Captcha != nil {
+			valid, err := config.Captcha.Verify(r.Header.Get(CaptchaTokenHeader))
+			if err != nil {
+				writeErrorCode(w, errorcodes.ErrCodeInternal, "人机验证失败")
+				return
+			}
+			if !valid {
+				writeErrorCode(w, errorcodes.ErrCodeCaptchaInvalid, ErrCaptchaInvalid.Error())
+				return
+			}
+		}
+
+		var request passwordEvaluateRequest
+		body := r.Body
+		if config.MaxBodyBytes > 0 {
+			body = http.MaxBytesReader(w, r.Body, config.MaxBodyBytes)
+		}
+		if err := json.NewDecoder(body).Decode(&request); err != nil {
+			writeErrorCode(w, errorcodes.ErrCodeInvalidRequest, "无效的请求体")
+			return
+		}
+
+		ctx := r.Context()
+		if config.TimeBudget > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, config.TimeBudget)
+			defer cancel()
+		}
+		evaluation := EvaluatePassword(ctx, pm, config.BreachChecker, request.Password, request.Username, request.Email)
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(evaluation)
+	}
+}
+
+// remoteIP 获取连接的客户端IP，不信任转发头
+func remoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"aigo_service_auth/errorcodes"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubBreachChecker 测试用泄露密码检查，delay大于0时等待delay或ctx结束
+type stubBreachChecker struct {
+	breached map[string]bool
+	delay    time.Duration
+}
+
+func (c *stubBreachChecker) IsBreached(ctx context.Context, password string) (bool, error) {
+	if c.delay > 0 {
+		select {
+		case <-time.After(c.delay):
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+	return c.breached[password], nil
+}
+
+func TestPasswordEvaluateHandler(t *testing.T) {
+	pm := NewPasswordManager(DefaultPasswordManagerConfig())
+
+	evaluate := func(handler http.Handler, body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/auth/password/evaluate", strings.NewReader(body))
+		req.RemoteAddr = "192.0.2.10:4321"
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	t.Run("返回强度和策略逐条结果", func(t *testing.T) {
+		handler := NewPasswordEvaluateHandler(pm, nil)
+		recorder := evaluate(handler, `{"password":"abc"}`)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "no-store", recorder.Header().Get("Cache-Control"))
+
+		var evaluation PasswordEvaluation
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &evaluation))
+		assert.False(t, evaluation.Acceptable)
+		assert.False(t, evaluation.Partial)
+		assert.Nil(t, evaluation.Breached)
+		assert.Equal(t, 3, evaluation.Strength.Composition.Length)
+		assert.True(t, evaluation.Strength.Composition.HasLower)
+		assert.False(t, evaluation.Strength.Composition.HasUpper)
+		assert.Contains(t, evaluation.Strength.FeedbackCodes, FeedbackTooShort)
+		assert.Contains(t, evaluation.Strength.FeedbackCodes, FeedbackMissingUpper)
+		assert.Equal(t, DefaultPasswordManagerConfig().MinStrengthScore, evaluation.MinScore)
+
+		assert.False(t, evaluation.Policy.Valid)
+		rules := make(map[string]bool)
+		for _, rule := range evaluation.Policy.Rules {
+			rules[rule.Rule] = rule.Passed
+		}
+		assert.Contains(t, rules, PolicyRuleMinLength)
+		assert.False(t, rules[PolicyRuleMinLength])
+
+		// 原始JSON字段名
+		var raw map[string]any
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &raw))
+		for _, field := range []string{"strength", "policy", "min_score", "too_similar", "breached", "acceptable", "partial"} {
+			assert.Contains(t, raw, field)
+		}
+		assert.NotContains(t, recorder.Body.String(), `"abc"`)
+	})
+
+	t.Run("强密码可接受", func(t *testing.T) {
+		handler := NewPasswordEvaluateHandler(pm, nil)
+		var evaluation PasswordEvaluation
+		assert.NoError(t, json.Unmarshal(evaluate(handler, `{"password":"Kx9#mQ2$vL7p"}`).Body.Bytes(), &evaluation))
+		assert.True(t, evaluation.Acceptable)
+		assert.True(t, evaluation.Policy.Valid)
+		assert.Empty(t, evaluation.Strength.FeedbackCodes)
+	})
+
+	t.Run("与用户名相似", func(t *testing.T) {
+		handler := NewPasswordEvaluateHandler(pm, nil)
+		var evaluation PasswordEvaluation
+		body := `{"password":"Alexander2024!","username":"alexander","email":"alexander@example.com"}`
+		assert.NoError(t, json.Unmarshal(evaluate(handler, body).Body.Bytes(), &evaluation))
+		assert.True(t, evaluation.TooSimilar)
+		assert.False(t, evaluation.Acceptable)
+	})
+
+	t.Run("按IP限流且不写审计日志", func(t *testing.T) {
+		auditLogger := NewMemoryAuditLogger()
+		config := DefaultPasswordEvaluateConfig()
+		config.RateLimit = 2
+		config.AuditLogger = auditLogger
+		handler := NewPasswordEvaluateHandler(pm, config)
+
+		assert.Equal(t, http.StatusOK, evaluate(handler, `{"password":"Blue7Horse!"}`).Code)
+		assert.Equal(t, http.StatusOK, evaluate(handler, `{"password":"Blue7Horse!"}`).Code)
+		assert.Empty(t, auditLogger.Events(), "评估请求不应写入审计日志")
+
+		recorder := evaluate(handler, `{"password":"Blue7Horse!"}`)
+		assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), errorcodes.ErrCodeRateLimited)
+		evaluate(handler, `{"password":"Blue7Horse!"}`)
+
+		// 只记录一次限流事件，且不含密码
+		events := auditLogger.Events()
+		if assert.Len(t, events, 1) {
+			assert.Equal(t, AuditEventPasswordEvaluateThrottled, events[0].Type)
+			assert.Equal(t, "ip=192.0.2.10", events[0].Detail)
+			assert.NotContains(t, events[0].Detail, "Blue7Horse!")
+		}
+	})
+
+	t.Run("要求人机验证", func(t *testing.T) {
+		config := DefaultPasswordEvaluateConfig()
+		config.Captcha = &stubCaptchaVerifier{validToken: "human"}
+		handler := NewPasswordEvaluateHandler(pm, config)
+
+		recorder := evaluate(handler, `{"password":"Blue7Horse!"}`)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), errorcodes.ErrCodeCaptchaInvalid)
+		assert.Equal(t, http.StatusOK, evaluate(handler, `{"password":"Blue7Horse!"}`, CaptchaTokenHeader, "human").Code)
+	})
+
+	t.Run("泄露检查", func(t *testing.T) {
+		config := DefaultPasswordEvaluateConfig()
+		config.BreachChecker = &stubBreachChecker{breached: map[string]bool{"Kx9#mQ2$vL7p": true}}
+		handler := NewPasswordEvaluateHandler(pm, config)
+
+		var evaluation PasswordEvaluation
+		assert.NoError(t, json.Unmarshal(evaluate(handler, `{"password":"Kx9#mQ2$vL7p"}`).Body.Bytes(), &evaluation))
+		if assert.NotNil(t, evaluation.Breached) {
+			assert.True(t, *evaluation.Breached)
+		}
+		assert.False(t, evaluation.Acceptable)
+		assert.False(t, evaluation.Partial)
+	})
+
+	t.Run("泄露检查超出时间预算时返回部分结果", func(t *testing.T) {
+		config := DefaultPasswordEvaluateConfig()
+		config.BreachChecker = &stubBreachChecker{delay: time.Second}
+		config.TimeBudget = 20 * time.Millisecond
+		handler := NewPasswordEvaluateHandler(pm, config)
+
+		start := time.Now()
+		recorder := evaluate(handler, `{"password":"Kx9#mQ2$vL7p"}`)
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+
+		var evaluation PasswordEvaluation
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &evaluation))
+		assert.True(t, evaluation.Partial)
+		assert.Equal(t, []string{PasswordCheckBreach}, evaluation.Incomplete)
+		assert.Nil(t, evaluation.Breached)
+		assert.True(t, evaluation.Acceptable)
+	})
+
+	t.Run("强度评分中的泄露查询同样受时间预算约束", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		pmConfig := DefaultPasswordManagerConfig()
+		pmConfig.BreachCounter = blockingBreachCounter(release)
+		config := DefaultPasswordEvaluateConfig()
+		config.TimeBudget = 20 * time.Millisecond
+		handler := NewPasswordEvaluateHandler(NewPasswordManager(pmConfig), config)
+
+		start := time.Now()
+		recorder := evaluate(handler, `{"password":"Kx9#mQ2$vL7p"}`)
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	})
+
+	t.Run("无效请求", func(t *testing.T) {
+		handler := NewPasswordEvaluateHandler(pm, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/auth/password/evaluate", nil)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+
+		assert.Equal(t, http.StatusBadRequest, evaluate(handler, `not json`).Code)
+		assert.Equal(t, http.StatusBadRequest, evaluate(handler, `{"password":"`+strings.Repeat("a", 8<<10)+`"}`).Code)
+	})
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2PHCPrefix PHC格式argon2id哈希的前缀
+const argon2PHCPrefix = "$argon2id$"
+
+// 密码哈希算法，记录在User.HashAlgo中，用于统计迁移进度
+const (
+	HashAlgoArgon2id     = "argon2id"      // PHC格式，记录了参数
+	HashAlgoArgon2Legacy = "argon2_legacy" // 旧的salt$hash格式，未记录参数
+	HashAlgoBcrypt       = "bcrypt"
+)
+
+// passwordHashAlgo 根据哈希格式识别算法，无法识别的按旧格式处理，空哈希返回空字符串
+func passwordHashAlgo(encoded string) string {
+	switch {
+	case encoded == "":
+		return ""
+	case strings.HasPrefix(encoded, argon2PHCPrefix):
+		return HashAlgoArgon2id
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return HashAlgoBcrypt
+	default:
+		return HashAlgoArgon2Legacy
+	}
+}
+
+// ErrInvalidPasswordHash 密码哈希格式无效
+var ErrInvalidPasswordHash = errors.New("密码哈希格式无效")
+
+// argon2Hash 解析后的argon2id哈希
+type argon2Hash struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	hash    []byte
+	legacy  bool // 旧的salt$hash格式，未记录参数
+}
+
+// encodeArgon2Hash 使用指定参数哈希密码，编码为PHC格式：
+//
+//	$argon2id$v=19$m=65536,t=1,p=4$<salt>$<hash>
+//
+// 参数随哈希一起保存，修改PasswordConfig后已有的哈希仍可验证。配置了Pepper时对加pepper后的密码哈希。
+func encodeArgon2Hash(password string, config *PasswordConfig) (string, error) {
+	salt := make([]byte, config.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	hash := argon2.IDKey(pepperPassword(password, config.Pepper), salt, config.Time, config.Memory, config.Threads, config.KeyLen)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2PHCPrefix, argon2.Version, config.Memory, config.Time, config.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+// decodeArgon2Hash 解析PHC格式或旧的salt$hash格式的哈希
+//
+// 旧格式没有记录参数，使用legacy中的参数，即迁移前一直使用的配置。
+func decodeArgon2Hash(encoded string, legacy *PasswordConfig) (*argon2Hash, error) {
+	if !strings.HasPrefix(encoded, argon2PHCPrefix) {
+		saltPart, hashPart, ok := strings.Cut(encoded, "$")
+		if !ok {
+			return nil, ErrInvalidPasswordHash
+		}
+		salt, err := base64.RawStdEncoding.DecodeString(saltPart)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidPasswordHash, err)
+		}
+		hash, err := base64.RawStdEncoding.DecodeString(hashPart)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidPasswordHash, err)
+		}
+		return &argon2Hash{
+			memory:  legacy.Memory,
+			time:    legacy.Time,
+			threads: legacy.Threads,
+			salt:    salt,
+			hash:    hash,
+			legacy:  true,
+		}, nil
+	}
+
+	// 去掉前缀后依次为：版本、参数、盐、哈希
+	parts := strings.Split(strings.TrimPrefix(encoded, argon2PHCPrefix), "$")
+	if len(parts) != 4 {
+		return nil, ErrInvalidPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[0], "v=%d", &version); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPasswordHash, err)
+	}
+	if version != argon2.Version {
+		return nil, fmt.Errorf("%w: 不支持的argon2版本 %d", ErrInvalidPasswordHash, version)
+	}
+
+	decoded := &argon2Hash{}
+	if _, err := fmt.Sscanf(parts[1], "m=%d,t=%d,p=%d", &decoded.memory, &decoded.time, &decoded.threads); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPasswordHash, err)
+	}
+	if decoded.memory == 0 || decoded.time == 0 || decoded.threads == 0 {
+		return nil, fmt.Errorf("%w: 参数不能为0", ErrInvalidPasswordHash)
+	}
+
+	var err error
+	if decoded.salt, err = base64.RawStdEncoding.DecodeString(parts[2]); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPasswordHash, err)
+	}
+	if decoded.hash, err = base64.RawStdEncoding.DecodeString(parts[3]); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPasswordHash, err)
+	}
+	if len(decoded.hash) == 0 {
+		return nil, ErrInvalidPasswordHash
+	}
+	return decoded, nil
+}
+
+// verifyArgon2Hash 使用哈希中记录的参数验证密码，依次尝试当前和轮换前的pepper
+func verifyArgon2Hash(password, encoded string, config *PasswordConfig) (bool, error) {
+	valid, _, err := verifyArgon2HashWithPeppers(password, encoded, config)
+	return valid, err
+}
+
+// verifyArgon2HashWithPeppers 验证密码，previousPepper表示通过验证的是轮换前的pepper，需要重新哈希
+func verifyArgon2HashWithPeppers(password, encoded string, config *PasswordConfig) (valid, previousPepper bool, err error) {
+	decoded, err := decodeArgon2Hash(encoded, config)
+	if err != nil {
+		return false, false, err
+	}
+
+	peppers := append([][]byte{config.Pepper}, config.PreviousPeppers...)
+	for i, pepper := range peppers {
+		computed := argon2.IDKey(pepperPassword(password, pepper), decoded.salt, decoded.time, decoded.memory, decoded.threads, uint32(len(decoded.hash)))
+
+		// 使用constant time比较防止时序攻击
+		if subtle.ConstantTimeCompare(decoded.hash, computed) == 1 {
+			return true, i > 0, nil
+		}
+	}
+	return false, false, nil
+}
+
+// pepperPassword 返回参与哈希的密码，pepper为空时为原密码，否则为 HMAC-SHA256(pepper, 密码)
+func pepperPassword(password string, pepper []byte) []byte {
+	if len(pepper) == 0 {
+		return []byte(password)
+	}
+	mac := hmac.New(sha256.New, pepper)
+	mac.Write([]byte(password))
+	return mac.Sum(nil)
+}
+
+// argon2NeedsRehash 检查哈希是否为旧格式或参数与当前配置不同，需要在下次登录时重新哈希
+func argon2NeedsRehash(encoded string, config *PasswordConfig) bool {
+	decoded, err := decodeArgon2Hash(encoded, config)
+	if err != nil {
+		return false
+	}
+	return decoded.legacy ||
+		decoded.memory != config.Memory ||
+		decoded.time != config.Time ||
+		decoded.threads != config.Threads ||
+		uint32(len(decoded.hash)) != config.KeyLen ||
+		uint32(len(decoded.salt)) != config.SaltLen
+}
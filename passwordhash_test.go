@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/argon2"
+)
+
+// testPasswordConfig 测试用的低开销argon2参数
+func testPasswordConfig(memory uint32) *PasswordConfig {
+	return &PasswordConfig{Time: 1, Memory: memory, Threads: 1, KeyLen: 32, SaltLen: 16}
+}
+
+// legacyArgon2Hash 生成迁移前salt$hash格式的哈希
+func legacyArgon2Hash(password string, config *PasswordConfig) string {
+	salt := []byte("0123456789abcdef")
+	hash := argon2.IDKey([]byte(password), salt, config.Time, config.Memory, config.Threads, config.KeyLen)
+	return base64.RawStdEncoding.EncodeToString(salt) + "$" + base64.RawStdEncoding.EncodeToString(hash)
+}
+
+func TestArgon2Hash(t *testing.T) {
+	t.Run("PHC格式记录参数", func(t *testing.T) {
+		encoded, err := encodeArgon2Hash("Secret#123", testPasswordConfig(1024))
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+		valid, err := verifyArgon2Hash("Secret#123", encoded, testPasswordConfig(1024))
+		assert.NoError(t, err)
+		assert.True(t, valid)
+
+		valid, err = verifyArgon2Hash("Secret#124", encoded, testPasswordConfig(1024))
+		assert.NoError(t, err)
+		assert.False(t, valid)
+	})
+
+	t.Run("修改参数后已有哈希仍可验证", func(t *testing.T) {
+		encoded, err := encodeArgon2Hash("Secret#123", testPasswordConfig(1024))
+		assert.NoError(t, err)
+
+		valid, err := verifyArgon2Hash("Secret#123", encoded, testPasswordConfig(2048))
+		assert.NoError(t, err)
+		assert.True(t, valid)
+		assert.True(t, argon2NeedsRehash(encoded, testPasswordConfig(2048)))
+		assert.False(t, argon2NeedsRehash(encoded, testPasswordConfig(1024)))
+	})
+
+	t.Run("兼容旧格式", func(t *testing.T) {
+		legacy := legacyArgon2Hash("Secret#123", testPasswordConfig(1024))
+
+		valid, err := verifyArgon2Hash("Secret#123", legacy, testPasswordConfig(1024))
+		assert.NoError(t, err)
+		assert.True(t, valid)
+		assert.True(t, argon2NeedsRehash(legacy, testPasswordConfig(1024)))
+
+		valid, err = verifyArgon2Hash("Secret#124", legacy, testPasswordConfig(1024))
+		assert.NoError(t, err)
+		assert.False(t, valid)
+	})
+
+	t.Run("无效格式", func(t *testing.T) {
+		for _, encoded := range []string{
+			"",
+			"no-separator",
+			"!!!$???",
+			"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA",
+			"$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$aGFzaA",
+			"$argon2id$v=19$m=0,t=1,p=1$c2FsdA$aGFzaA",
+			"$argon2id$v=19$garbage$c2FsdA$aGFzaA",
+			"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA$",
+		} {
+			_, err := verifyArgon2Hash("Secret#123", encoded, testPasswordConfig(1024))
+			assert.True(t, errors.Is(err, ErrInvalidPasswordHash), encoded)
+			assert.False(t, argon2NeedsRehash(encoded, testPasswordConfig(1024)), encoded)
+		}
+	})
+}
+
+func TestArgon2HashPepperRotation(t *testing.T) {
+	oldPepper, newPepper := []byte("old-pepper"), []byte("new-pepper")
+	oldConfig := testPasswordConfig(1024)
+	oldConfig.Pepper = oldPepper
+
+	rotated := testPasswordConfig(1024)
+	rotated.Pepper = newPepper
+	rotated.PreviousPeppers = [][]byte{oldPepper}
+
+	t.Run("旧pepper的哈希仍可验证并需要重新哈希", func(t *testing.T) {
+		encoded, err := encodeArgon2Hash("Secret#123", oldConfig)
+		assert.NoError(t, err)
+
+		valid, previousPepper, err := verifyArgon2HashWithPeppers("Secret#123", encoded, rotated)
+		assert.NoError(t, err)
+		assert.True(t, valid)
+		assert.True(t, previousPepper)
+
+		valid, _, err = verifyArgon2HashWithPeppers("Secret#124", encoded, rotated)
+		assert.NoError(t, err)
+		assert.False(t, valid)
+	})
+
+	t.Run("当前pepper的哈希无需重新哈希", func(t *testing.T) {
+		encoded, err := encodeArgon2Hash("Secret#123", rotated)
+		assert.NoError(t, err)
+
+		valid, previousPepper, err := verifyArgon2HashWithPeppers("Secret#123", encoded, rotated)
+		assert.NoError(t, err)
+		assert.True(t, valid)
+		assert.False(t, previousPepper)
+
+		// 不同pepper的哈希互不通用
+		valid, err = verifyArgon2Hash("Secret#123", encoded, oldConfig)
+		assert.NoError(t, err)
+		assert.False(t, valid)
+		valid, err = verifyArgon2Hash("Secret#123", encoded, testPasswordConfig(1024))
+		assert.NoError(t, err)
+		assert.False(t, valid)
+	})
+
+	t.Run("首次启用pepper时用空值兼容已有哈希", func(t *testing.T) {
+		encoded, err := encodeArgon2Hash("Secret#123", testPasswordConfig(1024))
+		assert.NoError(t, err)
+
+		config := testPasswordConfig(1024)
+		config.Pepper = newPepper
+		valid, err := verifyArgon2Hash("Secret#123", encoded, config)
+		assert.NoError(t, err)
+		assert.False(t, valid)
+
+		config.PreviousPeppers = [][]byte{nil}
+		valid, previousPepper, err := verifyArgon2HashWithPeppers("Secret#123", encoded, config)
+		assert.NoError(t, err)
+		assert.True(t, valid)
+		assert.True(t, previousPepper)
+	})
+
+	t.Run("验证通过后提示重新哈希", func(t *testing.T) {
+		service := &authService{passwordConfig: rotated}
+		encoded, err := encodeArgon2Hash("Secret#123", oldConfig)
+		assert.NoError(t, err)
+
+		valid, needsRehash, err := service.verifyPassword("Secret#123", encoded)
+		assert.NoError(t, err)
+		assert.True(t, valid)
+		assert.True(t, needsRehash)
+
+		upgraded, err := service.HashPassword("Secret#123")
+		assert.NoError(t, err)
+		valid, needsRehash, err = service.verifyPassword("Secret#123", upgraded)
+		assert.NoError(t, err)
+		assert.True(t, valid)
+		assert.False(t, needsRehash)
+	})
+
+	t.Run("NeedsRehash按当前配置检查参数", func(t *testing.T) {
+		service := &authService{passwordConfig: testPasswordConfig(2048)}
+		encoded, err := encodeArgon2Hash("Secret#123", testPasswordConfig(1024))
+		assert.NoError(t, err)
+		assert.True(t, service.NeedsRehash(encoded))
+		assert.True(t, service.NeedsRehash(legacyArgon2Hash("Secret#123", service.passwordConfig)))
+
+		upgraded, err := service.HashPassword("Secret#123")
+		assert.NoError(t, err)
+		assert.False(t, service.NeedsRehash(upgraded))
+	})
+}
+
+func TestLoginUpgradesPasswordHash(t *testing.T) {
+	// 设置测试数据库
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	userService := NewUserService(testDB.DB)
+	authService := NewAuthService(testDB.DB, userService, NewTokenService("test-secret-key", time.Hour))
+
+	// 迁移前使用当前默认参数生成的旧格式哈希
+	user := &User{
+		Username:     "legacy",
+		Email:        "legacy@example.com",
+		PasswordHash: legacyArgon2Hash("Legacy#Passw0rd", DefaultPasswordConfig),
+		Status:       1,
+	}
+	assert.NoError(t, userService.CreateUser(user))
+
+	_, _, err := authService.Login("legacy", "Legacy#Passw0rd")
+	assert.NoError(t, err)
+
+	upgraded, err := userService.GetUserByID(user.ID)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(upgraded.PasswordHash, argon2PHCPrefix))
+	assert.False(t, argon2NeedsRehash(upgraded.PasswordHash, DefaultPasswordConfig))
+
+	// 升级后仍可登录
+	_, _, err = authService.Login("legacy", "Legacy#Passw0rd")
+	assert.NoError(t, err)
+}
+
+func TestLoginUpgradesPepperedPasswordHash(t *testing.T) {
+	// 设置测试数据库
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	userService := NewUserService(testDB.DB)
+	service := NewAuthService(testDB.DB, userService, NewTokenService("test-secret-key", time.Hour))
+
+	// 轮换后的配置：当前pepper为new-pepper，旧pepper仍可验证
+	oldConfig := *DefaultPasswordConfig
+	oldConfig.Pepper = []byte("old-pepper")
+	rotated := *DefaultPasswordConfig
+	rotated.Pepper = []byte("new-pepper")
+	rotated.PreviousPeppers = [][]byte{oldConfig.Pepper}
+	service.(*authService).passwordConfig = &rotated
+
+	hash, err := encodeArgon2Hash("Pepper#Passw0rd", &oldConfig)
+	assert.NoError(t, err)
+	user := &User{Username: "peppered", Email: "peppered@example.com", PasswordHash: hash, Status: 1}
+	assert.NoError(t, userService.CreateUser(user))
+
+	_, _, err = service.Login("peppered", "Pepper#Passw0rd")
+	assert.NoError(t, err)
+
+	// 登录后改用当前pepper重新哈希
+	upgraded, err := userService.GetUserByID(user.ID)
+	assert.NoError(t, err)
+	assert.NotEqual(t, hash, upgraded.PasswordHash)
+	_, previousPepper, err := verifyArgon2HashWithPeppers("Pepper#Passw0rd", upgraded.PasswordHash, &rotated)
+	assert.NoError(t, err)
+	assert.False(t, previousPepper)
+
+	// 移除旧pepper后仍可登录
+	rotated.PreviousPeppers = nil
+	_, _, err = service.Login("peppered", "Pepper#Passw0rd")
+	assert.NoError(t, err)
+}
+
+func TestPasswordHashAlgo(t *testing.T) {
+	encoded, err := encodeArgon2Hash("Secret#123", testPasswordConfig(1024))
+	assert.NoError(t, err)
+
+	assert.Equal(t, HashAlgoArgon2id, passwordHashAlgo(encoded))
+	assert.Equal(t, HashAlgoArgon2Legacy, passwordHashAlgo(legacyArgon2Hash("Secret#123", testPasswordConfig(1024))))
+	assert.Equal(t, HashAlgoBcrypt, passwordHashAlgo("$2a$10$abcdefghijklmnopqrstuv"))
+	assert.Equal(t, HashAlgoArgon2Legacy, passwordHashAlgo("unrecognized"), "无法识别的按旧格式处理")
+	assert.Equal(t, "", passwordHashAlgo(""))
+}
+
+func TestHashAlgoStatsWithDB(t *testing.T) {
+	// 设置测试数据库
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	// 清理数据
+	testDB.ClearAllData()
+
+	userService := NewUserService(testDB.DB)
+	authService := NewAuthService(testDB.DB, userService, NewTokenService("test-secret-key", time.Hour))
+
+	legacy := &User{
+		Username:     "legacy",
+		Email:        "legacy@example.com",
+		PasswordHash: legacyArgon2Hash("Legacy#Passw0rd", DefaultPasswordConfig),
+		Status:       1,
+	}
+	assert.NoError(t, userService.CreateUser(legacy))
+	assert.Equal(t, HashAlgoArgon2Legacy, legacy.HashAlgo)
+
+	current := testDB.CreateTestUser("current", "current@example.com", "Current#Passw0rd")
+	assert.Equal(t, HashAlgoArgon2id, current.HashAlgo)
+
+	// 迁移前由旧版本写入、未记录算法的行
+	unrecorded := testDB.CreateTestUser("unrecorded", "unrecorded@example.com", "Unrecorded#Passw0rd")
+	testDB.DB.Model(&User{}).Where("id = ?", unrecorded.ID).UpdateColumn("hash_algo", "")
+
+	stats, err := userService.HashAlgoStats()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{HashAlgoArgon2id: 1, HashAlgoArgon2Legacy: 2}, stats)
+
+	t.Run("登录升级哈希后更新算法", func(t *testing.T) {
+		_, _, err := authService.Login("legacy", "Legacy#Passw0rd")
+		assert.NoError(t, err)
+
+		upgraded, err := userService.GetUserByID(legacy.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, HashAlgoArgon2id, upgraded.HashAlgo)
+
+		stats, err := userService.HashAlgoStats()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int64{HashAlgoArgon2id: 2, HashAlgoArgon2Legacy: 1}, stats)
+	})
+
+	t.Run("修改密码时更新算法", func(t *testing.T) {
+		user, err := userService.GetUserByID(unrecorded.ID)
+		assert.NoError(t, err)
+		assert.Empty(t, user.HashAlgo)
+
+		assert.NoError(t, authService.ChangePassword(user.ID, "Unrecorded#Passw0rd", "Changed#Passw0rd1"))
+		user, err = userService.GetUserByID(unrecorded.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, HashAlgoArgon2id, user.HashAlgo)
+	})
+
+	t.Run("已删除的用户不计入", func(t *testing.T) {
+		assert.NoError(t, userService.DeleteUser(current.ID))
+		stats, err := userService.HashAlgoStats()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int64{HashAlgoArgon2id: 2}, stats)
+	})
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrPasswordPolicyNotFound 按名称分配的密码策略未定义
+var ErrPasswordPolicyNotFound = errors.New("密码策略不存在")
+
+// PasswordPolicyResolver 按用户解析适用的密码策略
+type PasswordPolicyResolver interface {
+	// ResolvePolicy 返回用户适用的策略，没有为用户或其角色分配策略时ok为false
+	ResolvePolicy(userID uint) (policy PasswordPolicy, ok bool, err error)
+}
+
+// PasswordPolicyAssignments 将命名策略或内联策略分配给用户和角色的内存实现
+//
+// 用户自己的策略优先，如为服务账号单独放宽；否则合并用户所有角色的策略，取每条规则中最严格的要求。
+type PasswordPolicyAssignments struct {
+	roleService RoleService
+	mutex       sync.RWMutex
+	policies    map[string]PasswordPolicy
+	users       map[uint]PasswordPolicy
+	roles       map[string]PasswordPolicy
+}
+
+// NewPasswordPolicyAssignments 创建密码策略分配，rs为nil时只按用户解析
+func NewPasswordPolicyAssignments(rs RoleService) *PasswordPolicyAssignments {
+	return &PasswordPolicyAssignments{
+		roleService: rs,
+		policies:    make(map[string]PasswordPolicy),
+		users:       make(map[uint]PasswordPolicy),
+		roles:       make(map[string]PasswordPolicy),
+	}
+}
+
+// DefinePolicy 定义命名策略，之后可按名称分配；已分配的策略不受重新定义影响
+func (a *PasswordPolicyAssignments) DefinePolicy(name string, policy PasswordPolicy) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.policies[name] = policy
+}
+
+// AssignUserPolicy 将命名策略分配给用户
+func (a *PasswordPolicyAssignments) AssignUserPolicy(userID uint, name string) error {
+	policy, err := a.namedPolicy(name)
+	if err != nil {
+		return err
+	}
+	a.SetUserPolicy(userID, policy)
+	return nil
+}
+
+// SetUserPolicy 为用户设置内联策略
+func (a *PasswordPolicyAssignments) SetUserPolicy(userID uint, policy PasswordPolicy) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.users[userID] = policy
+}
+
+// RemoveUserPolicy 移除用户的策略，之后按角色或默认策略校验
+func (a *PasswordPolicyAssignments) RemoveUserPolicy(userID uint) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	delete(a.users, userID)
+}
+
+// AssignRolePolicy 将命名策略分配给角色
+func (a *PasswordPolicyAssignments) AssignRolePolicy(roleName, name string) error {
+	policy, err := a.namedPolicy(name)
+	if err != nil {
+		return err
+	}
+	a.SetRolePolicy(roleName, policy)
+	return nil
+}
+
+// SetRolePolicy 为角色设置内联策略
+func (a *PasswordPolicyAssignments) SetRolePolicy(roleName string, policy PasswordPolicy) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.roles[roleName] = policy
+}
+
+// RemoveRolePolicy 移除角色的策略
+func (a *PasswordPolicyAssignments) RemoveRolePolicy(roleName string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	delete(a.roles, roleName)
+}
+
+// namedPolicy 按名称查找已定义的策略
+func (a *PasswordPolicyAssignments) namedPolicy(name string) (PasswordPolicy, error) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	policy, ok := a.policies[name]
+	if !ok {
+		return PasswordPolicy{}, ErrPasswordPolicyNotFound
+	}
+	return policy, nil
+}
+
+// ResolvePolicy 解析用户适用的策略
+func (a *PasswordPolicyAssignments) ResolvePolicy(userID uint) (PasswordPolicy, bool, error) {
+	a.mutex.RLock()
+	policy, ok := a.users[userID]
+	hasRolePolicies := len(a.roles) > 0
+	a.mutex.RUnlock()
+	if ok {
+		return policy, true, nil
+	}
+	if a.roleService == nil || !hasRolePolicies {
+		return PasswordPolicy{}, false, nil
+	}
+
+	roles, err := a.roleService.GetUserRoles(userID)
+	if err != nil {
+		return PasswordPolicy{}, false, err
+	}
+
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	var matched []PasswordPolicy
+	for _, role := range roles {
+		if rolePolicy, ok := a.roles[role.Name]; ok {
+			matched = append(matched, rolePolicy)
+		}
+	}
+	if len(matched) == 0 {
+		return PasswordPolicy{}, false, nil
+	}
+	return StrictestPasswordPolicy(matched...), true, nil
+}
+
+// StrictestPasswordPolicy 合并多个策略，每条规则取最严格的要求，禁用模式取并集
+func StrictestPasswordPolicy(policies ...PasswordPolicy) PasswordPolicy {
+	var merged PasswordPolicy
+	seen := make(map[string]bool)
+	for _, policy := range policies {
+		merged.MinLength = max(merged.MinLength, policy.MinLength)
+		merged.MaxLength = minLimit(merged.MaxLength, policy.MaxLength)
+		merged.RequireLower = merged.RequireLower || policy.RequireLower
+		merged.RequireUpper = merged.RequireUpper || policy.RequireUpper
+		merged.RequireNumbers = merged.RequireNumbers || policy.RequireNumbers
+		merged.RequireSymbols = merged.RequireSymbols || policy.RequireSymbols
+		merged.MinUniqueChars = max(merged.MinUniqueChars, policy.MinUniqueChars)
+		merged.MaxRepeatedChars = minLimit(merged.MaxRepeatedChars, policy.MaxRepeatedChars)
+		merged.SortViolationsBySeverity = merged.SortViolationsBySeverity || policy.SortViolationsBySeverity
+		for _, pattern := range policy.ForbiddenPatterns {
+			if key := strings.ToLower(pattern); !seen[key] {
+				seen[key] = true
+				merged.ForbiddenPatterns = append(merged.ForbiddenPatterns, pattern)
+			}
+		}
+	}
+	return merged
+}
+
+// minLimit 取两个上限中较小的一个，0表示不限制
+func minLimit(a, b int) int {
+	if a == 0 {
+		return b
+	}
+	if b == 0 {
+		return a
+	}
+	return min(a, b)
+}
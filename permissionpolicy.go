@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// ErrInvalidPermissionName 权限名不符合命名规范
+var ErrInvalidPermissionName = errors.New("权限名不符合命名规范")
+
+// DefaultPermissionNamePattern 默认权限命名模式：小写的资源.操作，如user.read_pii
+const DefaultPermissionNamePattern = `^[a-z][a-z0-9_]*\.[a-z][a-z0-9_]*$`
+
+// PermissionNamingPolicy 权限命名规范，在创建和更新权限时校验
+type PermissionNamingPolicy struct {
+	Pattern               *regexp.Regexp // 权限名须匹配的模式，为nil时不校验
+	RequireResourceAction bool           // 权限名必须等于Resource+"."+Action
+	// 通配符资源，该资源下的权限不校验Pattern，只要求符合RequireResourceAction
+	WildcardResource string
+}
+
+// DefaultPermissionNamingPolicy 默认权限命名规范
+func DefaultPermissionNamingPolicy() *PermissionNamingPolicy {
+	return &PermissionNamingPolicy{
+		Pattern:               regexp.MustCompile(DefaultPermissionNamePattern),
+		RequireResourceAction: true,
+		WildcardResource:      PermissionResourceAll,
+	}
+}
+
+// Validate 校验权限名，不符合时返回包装ErrInvalidPermissionName的错误并说明原因
+func (p *PermissionNamingPolicy) Validate(permission *Permission) error {
+	if p == nil {
+		return nil
+	}
+
+	if p.RequireResourceAction {
+		if expected := permission.Resource + "." + permission.Action; permission.Name != expected {
+			return fmt.Errorf("%w: %q 应为资源.操作 %q", ErrInvalidPermissionName, permission.Name, expected)
+		}
+	}
+
+	wildcard := p.WildcardResource != "" && permission.Resource == p.WildcardResource
+	if p.Pattern != nil && !wildcard && !p.Pattern.MatchString(permission.Name) {
+		return fmt.Errorf("%w: %q 不匹配 %s", ErrInvalidPermissionName, permission.Name, p.Pattern.String())
+	}
+	return nil
+}
+
+// ResourceSummary 资源及其已定义的操作，用于构建权限选择器
+type ResourceSummary struct {
+	Resource string   `json:"resource"`
+	Actions  []string `json:"actions"`
+}
+
+// PermissionNamingViolation 不符合命名规范的已有权限
+type PermissionNamingViolation struct {
+	Permission *Permission `json:"permission"`
+	Reason     string      `json:"reason"`
+}
+
+// ListResources 按资源分组列出已有权限的操作，资源和操作均按字母排序
+func (s *roleService) ListResources() ([]ResourceSummary, error) {
+	var permissions []*Permission
+	if err := s.db.Select("resource", "action").Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+
+	actions := make(map[string]map[string]bool)
+	for _, permission := range permissions {
+		if actions[permission.Resource] == nil {
+			actions[permission.Resource] = make(map[string]bool)
+		}
+		actions[permission.Resource][permission.Action] = true
+	}
+
+	summaries := make([]ResourceSummary, 0, len(actions))
+	for resource, set := range actions {
+		summary := ResourceSummary{Resource: resource, Actions: make([]string, 0, len(set))}
+		for action := range set {
+			summary.Actions = append(summary.Actions, action)
+		}
+		sort.Strings(summary.Actions)
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Resource < summaries[j].Resource
+	})
+	return summaries, nil
+}
+
+// ValidateExistingPermissions 按命名规范检查已有权限，只返回不符合的记录，不做任何修改
+func (s *roleService) ValidateExistingPermissions() ([]PermissionNamingViolation, error) {
+	if s.namingPolicy == nil {
+		return nil, nil
+	}
+
+	var permissions []*Permission
+	if err := s.db.Order("id").Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+
+	var violations []PermissionNamingViolation
+	for _, permission := range permissions {
+		if err := s.namingPolicy.Validate(permission); err != nil {
+			violations = append(violations, PermissionNamingViolation{Permission: permission, Reason: err.Error()})
+		}
+	}
+	return violations, nil
+}
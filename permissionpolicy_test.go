@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPermissionNamingPolicy(t *testing.T) {
+	policy := DefaultPermissionNamingPolicy()
+
+	t.Run("符合规范的权限", func(t *testing.T) {
+		for _, permission := range append(DefaultPermissions(),
+			&Permission{Name: "order.export_csv", Resource: "order", Action: "export_csv"},
+			&Permission{Name: "*.view_all", Resource: PermissionResourceAll, Action: PermissionActionViewAll},
+		) {
+			assert.NoError(t, policy.Validate(permission), permission.Name)
+		}
+	})
+
+	t.Run("不符合规范的权限", func(t *testing.T) {
+		for _, permission := range []*Permission{
+			{Name: "users:read", Resource: "users", Action: "read"},
+			{Name: "CreateUser", Resource: "user", Action: "create"},
+			{Name: "User.Create", Resource: "User", Action: "Create"},
+			{Name: "user.create", Resource: "user", Action: "add"},
+			{Name: "user.read.all", Resource: "user.read", Action: "all"},
+		} {
+			err := policy.Validate(permission)
+			assert.True(t, errors.Is(err, ErrInvalidPermissionName), permission.Name)
+			assert.Contains(t, err.Error(), permission.Name)
+		}
+	})
+
+	t.Run("自定义规范", func(t *testing.T) {
+		custom := &PermissionNamingPolicy{Pattern: regexp.MustCompile(`^[a-z]+:[a-z]+$`)}
+		assert.NoError(t, custom.Validate(&Permission{Name: "users:read", Resource: "users", Action: "read"}))
+		assert.Error(t, custom.Validate(&Permission{Name: "user.read", Resource: "user", Action: "read"}))
+
+		// 未配置规范时不校验
+		var none *PermissionNamingPolicy
+		assert.NoError(t, none.Validate(&Permission{Name: "CreateUser"}))
+	})
+}
+
+func TestRoleServicePermissionCatalog(t *testing.T) {
+	// 设置测试数据库
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	roleService := NewRoleService(testDB.DB)
+
+	t.Run("创建和更新时校验命名规范", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		err := roleService.CreatePermission(&Permission{Name: "users:read", DisplayName: "查看用户", Resource: "users", Action: "read"})
+		assert.True(t, errors.Is(err, ErrInvalidPermissionName))
+
+		permission := &Permission{Name: "user.read", DisplayName: "查看用户", Resource: "user", Action: "read"}
+		assert.NoError(t, roleService.CreatePermission(permission))
+
+		permission.Name = "CreateUser"
+		assert.True(t, errors.Is(roleService.UpdatePermission(permission), ErrInvalidPermissionName))
+
+		permission.Name, permission.Action = "user.view", "view"
+		assert.NoError(t, roleService.UpdatePermission(permission))
+		saved, err := roleService.GetPermissionByID(permission.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "user.view", saved.Name)
+
+		// 不能改成其他权限已使用的名称
+		other := &Permission{Name: "user.create", DisplayName: "创建用户", Resource: "user", Action: "create"}
+		assert.NoError(t, roleService.CreatePermission(other))
+		other.Name, other.Action = "user.view", "view"
+		assert.Error(t, roleService.UpdatePermission(other))
+	})
+
+	t.Run("按资源分组列出操作", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		testDB.CreateTestPermission("user.read", "查看用户", "user", "read")
+		testDB.CreateTestPermission("user.create", "创建用户", "user", "create")
+		testDB.CreateTestPermission("order.export", "导出订单", "order", "export")
+
+		resources, err := roleService.ListResources()
+		assert.NoError(t, err)
+		assert.Equal(t, []ResourceSummary{
+			{Resource: "order", Actions: []string{"export"}},
+			{Resource: "user", Actions: []string{"create", "read"}},
+		}, resources)
+	})
+
+	t.Run("报告不符合规范的已有权限且不修改", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		testDB.CreateTestPermission("user.create", "创建用户", "user", "create")
+		legacy := testDB.CreateTestPermission("users:read", "查看用户", "users", "read")
+		camel := testDB.CreateTestPermission("CreateUser", "创建用户", "user", "create")
+
+		violations, err := roleService.ValidateExistingPermissions()
+		assert.NoError(t, err)
+		assert.Len(t, violations, 2)
+		assert.Equal(t, legacy.ID, violations[0].Permission.ID)
+		assert.Equal(t, camel.ID, violations[1].Permission.ID)
+		assert.NotEmpty(t, violations[0].Reason)
+
+		saved, err := roleService.GetPermissionByID(legacy.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "users:read", saved.Name)
+
+		// 未配置规范时不报告
+		violations, err = NewRoleServiceWithNamingPolicy(testDB.DB, nil).ValidateExistingPermissions()
+		assert.NoError(t, err)
+		assert.Empty(t, violations)
+	})
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPwnedRangeURL Have I Been Pwned的range API地址，后接5位SHA-1前缀
+const DefaultPwnedRangeURL = "https://api.pwnedpasswords.com/range/"
+
+// HTTPDoer 发送HTTP请求的接口，*http.Client实现了此接口，测试中可替换为桩实现
+type HTTPDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// PasswordBreachCounter 查询密码在泄露密码库中出现的次数，配置后CheckStrength对泄露过的密码大幅扣分
+type PasswordBreachCounter interface {
+	BreachCount(ctx context.Context, password string) (int, error)
+}
+
+// PwnedPasswordsChecker 按k-匿名模型查询HIBP泄露密码库
+//
+// 只发送密码SHA-1的前5位十六进制，在返回的后缀列表中本地匹配，密码和完整哈希都不会离开本机。
+// 同时实现PasswordBreachCounter和PasswordBreachChecker。
+type PwnedPasswordsChecker struct {
+	client  HTTPDoer
+	baseURL string
+	timeout time.Duration // 单次查询超时，ctx的截止时间更早时以ctx为准
+}
+
+// NewPwnedPasswordsChecker 创建HIBP查询器，client为nil时使用http.DefaultClient，单次查询默认2秒超时
+func NewPwnedPasswordsChecker(client HTTPDoer) *PwnedPasswordsChecker {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &PwnedPasswordsChecker{
+		client:  client,
+		baseURL: DefaultPwnedRangeURL,
+		timeout: 2 * time.Second,
+	}
+}
+
+// SetBaseURL 设置range API地址，用于自建的镜像服务
+func (c *PwnedPasswordsChecker) SetBaseURL(baseURL string) {
+	c.baseURL = baseURL
+}
+
+// SetTimeout 设置单次查询超时，timeout<=0时只使用ctx的截止时间
+func (c *PwnedPasswordsChecker) SetTimeout(timeout time.Duration) {
+	c.timeout = timeout
+}
+
+// BreachCount 返回密码在泄露密码库中出现的次数，未出现时返回0
+func (c *PwnedPasswordsChecker) BreachCount(ctx context.Context, password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+prefix, nil)
+	if err != nil {
+		return 0, err
+	}
+	// 填充响应使响应长度不暴露前缀对应的后缀数量，填充项的次数为0
+	req.Header.Set("Add-Padding", "true")
+	req.Header.Set("User-Agent", "aigo_service_auth")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("查询泄露密码库失败: HTTP %d", resp.StatusCode)
+	}
+
+	// 每行格式为 后缀:次数
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		candidate, count, found := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !found || !strings.EqualFold(candidate, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return 0, fmt.Errorf("解析泄露密码库响应失败: %w", err)
+		}
+		return n, nil
+	}
+	return 0, scanner.Err()
+}
+
+// IsBreached 检查密码是否出现在泄露密码库中，实现PasswordBreachChecker
+func (c *PwnedPasswordsChecker) IsBreached(ctx context.Context, password string) (bool, error) {
+	count, err := c.BreachCount(ctx, password)
+	return count > 0, err
+}
+
+// breachCountWithin 在ctx截止前完成泄露次数查询，超时或出错时ok为false
+//
+// 查询在单独的goroutine中执行，不遵守截止时间的实现也不会拖慢调用方。
+func breachCountWithin(ctx context.Context, counter PasswordBreachCounter, password string) (count int, ok bool) {
+	type result struct {
+		count int
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		count, err := counter.BreachCount(ctx, password)
+		done <- result{count, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.count, r.err == nil
+	case <-ctx.Done():
+		return 0, false
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubHTTPDoer 测试用HTTP客户端，记录请求并返回预设响应
+type stubHTTPDoer struct {
+	status   int
+	body     string
+	err      error
+	requests []*http.Request
+}
+
+func (d *stubHTTPDoer) Do(req *http.Request) (*http.Response, error) {
+	d.requests = append(d.requests, req)
+	if d.err != nil {
+		return nil, d.err
+	}
+	return &http.Response{
+		StatusCode: d.status,
+		Body:       io.NopCloser(strings.NewReader(d.body)),
+	}, nil
+}
+
+// "password"的SHA-1为5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+const pwnedRangeBody = "0018A45C4D1DEF81644B54AB7F969B88D65:0\r\n" +
+	"1E4C9B93F3F0682250B6CF8331B7EE68FD8:9659365\r\n" +
+	"1E4C9B93F3F0682250B6CF8331B7EE68FD9:0\r\n"
+
+func TestPwnedPasswordsChecker(t *testing.T) {
+	t.Run("只发送哈希前缀并在本地匹配后缀", func(t *testing.T) {
+		doer := &stubHTTPDoer{status: http.StatusOK, body: pwnedRangeBody}
+		checker := NewPwnedPasswordsChecker(doer)
+
+		count, err := checker.BreachCount(context.Background(), "password")
+		assert.NoError(t, err)
+		assert.Equal(t, 9659365, count)
+
+		if assert.Len(t, doer.requests, 1) {
+			req := doer.requests[0]
+			assert.Equal(t, DefaultPwnedRangeURL+"5BAA6", req.URL.String())
+			assert.Equal(t, "true", req.Header.Get("Add-Padding"))
+			assert.NotContains(t, req.URL.String(), "1E4C9B93")
+		}
+
+		breached, err := checker.IsBreached(context.Background(), "password")
+		assert.NoError(t, err)
+		assert.True(t, breached)
+	})
+
+	t.Run("未出现或只出现在填充项中", func(t *testing.T) {
+		checker := NewPwnedPasswordsChecker(&stubHTTPDoer{status: http.StatusOK, body: "1E4C9B93F3F0682250B6CF8331B7EE68FD8:0\r\n"})
+		count, err := checker.BreachCount(context.Background(), "password")
+		assert.NoError(t, err)
+		assert.Equal(t, 0, count)
+
+		breached, err := checker.IsBreached(context.Background(), "Tr0ub4dor&Zebra-unique")
+		assert.NoError(t, err)
+		assert.False(t, breached)
+	})
+
+	t.Run("查询失败", func(t *testing.T) {
+		for _, doer := range []*stubHTTPDoer{
+			{err: errors.New("网络不可达")},
+			{status: http.StatusServiceUnavailable},
+			{status: http.StatusOK, body: "1E4C9B93F3F0682250B6CF8331B7EE68FD8:many\r\n"},
+		} {
+			_, err := NewPwnedPasswordsChecker(doer).BreachCount(context.Background(), "password")
+			assert.Error(t, err)
+		}
+	})
+}
+
+func TestCheckStrengthBreachCount(t *testing.T) {
+	t.Run("泄露过的密码大幅扣分", func(t *testing.T) {
+		checker := NewPasswordStrengthChecker(true)
+		before := checker.CheckStrength("Tr0ub4dor&Zebra")
+		assert.Equal(t, 0, before.BreachCount)
+
+		checker.SetBreachCounter(NewPwnedPasswordsChecker(&stubHTTPDoer{
+			status: http.StatusOK,
+			body:   pwnedSuffix("Tr0ub4dor&Zebra") + ":42\r\n",
+		}))
+		after := checker.CheckStrength("Tr0ub4dor&Zebra")
+		assert.Equal(t, 42, after.BreachCount)
+		assert.Contains(t, after.FeedbackCodes, FeedbackBreached)
+		assert.LessOrEqual(t, after.Score, before.Score-50)
+	})
+
+	t.Run("查询失败时退回本地字典", func(t *testing.T) {
+		checker := NewPasswordStrengthChecker(true)
+		checker.SetBreachCounter(NewPwnedPasswordsChecker(&stubHTTPDoer{err: errors.New("网络不可达")}))
+
+		strength := checker.CheckStrength("password")
+		assert.Equal(t, 0, strength.BreachCount)
+		assert.Contains(t, strength.FeedbackCodes, FeedbackCommonPassword)
+		assert.NotContains(t, strength.FeedbackCodes, FeedbackBreached)
+	})
+
+	t.Run("查询成功且未泄露时仍检查本地字典", func(t *testing.T) {
+		checker := NewPasswordStrengthChecker(true)
+		checker.SetBreachCounter(NewPwnedPasswordsChecker(&stubHTTPDoer{status: http.StatusOK, body: pwnedRangeBody}))
+
+		strength := checker.CheckStrength("qwerty")
+		assert.Equal(t, 0, strength.BreachCount)
+		assert.Contains(t, strength.FeedbackCodes, FeedbackCommonPassword)
+	})
+
+	t.Run("查询在ctx截止时放弃", func(t *testing.T) {
+		checker := NewPasswordStrengthChecker(true)
+		release := make(chan struct{})
+		defer close(release)
+		checker.SetBreachCounter(blockingBreachCounter(release))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		strength := checker.CheckStrengthContext(ctx, "password")
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+		assert.Equal(t, 0, strength.BreachCount)
+		assert.Contains(t, strength.FeedbackCodes, FeedbackCommonPassword)
+	})
+
+	t.Run("密码管理器按配置启用", func(t *testing.T) {
+		config := DefaultPasswordManagerConfig()
+		config.BcryptCost = 4
+		config.BreachCounter = NewPwnedPasswordsChecker(&stubHTTPDoer{status: http.StatusOK, body: pwnedRangeBody})
+		pm := NewPasswordManager(config)
+
+		assert.Equal(t, 9659365, pm.CheckStrength("password").BreachCount)
+		assert.False(t, pm.IsPasswordStrong("password"))
+	})
+}
+
+// blockingBreachCounter 不遵守ctx的泄露次数查询，release关闭前一直阻塞
+type blockingBreachCounter chan struct{}
+
+func (c blockingBreachCounter) BreachCount(ctx context.Context, password string) (int, error) {
+	<-c
+	return 1, nil
+}
+
+// pwnedSuffix 返回密码SHA-1的后35位十六进制，用于构造range API响应
+func pwnedSuffix(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))[5:]
+}
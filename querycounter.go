@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ErrQueryBudgetExceeded 操作执行的SQL数量超过预算
+var ErrQueryBudgetExceeded = errors.New("SQL查询数量超过预算")
+
+// maxRecordedStatements 最多保留的最近SQL数量，用于超出预算时定位问题
+const maxRecordedStatements = 50
+
+// QueryCounter 统计经过GORM执行的SQL数量，用于在测试中约束热点路径的查询次数
+//
+// 通过Wrap得到的*gorm.DB执行的每条SQL都会计数，原有的日志输出不受影响。计数可并发使用。
+type QueryCounter struct {
+	count atomic.Int64
+
+	mu         sync.Mutex
+	statements []string
+}
+
+// NewQueryCounter 创建SQL计数器
+func NewQueryCounter() *QueryCounter {
+	return &QueryCounter{}
+}
+
+// Wrap 返回使用计数日志的数据库会话，由其派生的查询都会计入该计数器
+func (c *QueryCounter) Wrap(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{Logger: &countingLogger{Interface: db.Logger, counter: c}})
+}
+
+// Count 返回累计执行的SQL数量
+func (c *QueryCounter) Count() int64 {
+	return c.count.Load()
+}
+
+// Reset 清零计数并清空记录的SQL
+func (c *QueryCounter) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.count.Store(0)
+	c.statements = nil
+}
+
+// Statements 返回最近执行的SQL，最多保留maxRecordedStatements条
+func (c *QueryCounter) Statements() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.statements...)
+}
+
+// Measure 执行fn并返回期间执行的SQL数量，并发执行的其他查询也会计入
+func (c *QueryCounter) Measure(fn func()) int64 {
+	before := c.Count()
+	fn()
+	return c.Count() - before
+}
+
+// CheckBudget 清零后执行fn，SQL数量超过budget时返回ErrQueryBudgetExceeded并附带执行的SQL
+func (c *QueryCounter) CheckBudget(budget int64, fn func()) error {
+	c.Reset()
+	fn()
+	if count := c.Count(); count > budget {
+		return fmt.Errorf("%w: 预算%d，实际%d\n%s", ErrQueryBudgetExceeded, budget, count, strings.Join(c.Statements(), "\n"))
+	}
+	return nil
+}
+
+// record 记录一条已执行的SQL
+func (c *QueryCounter) record(sql string) {
+	c.count.Add(1)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.statements) >= maxRecordedStatements {
+		c.statements = c.statements[1:]
+	}
+	c.statements = append(c.statements, sql)
+}
+
+// countingLogger 计数SQL的GORM日志，其余日志转交原日志处理
+type countingLogger struct {
+	logger.Interface
+	counter *QueryCounter
+}
+
+// LogMode 调整原日志的级别，计数器保持不变
+func (l *countingLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return &countingLogger{Interface: l.Interface.LogMode(level), counter: l.counter}
+}
+
+// Trace GORM每执行一条SQL调用一次
+func (l *countingLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	sql, _ := fc()
+	l.counter.record(sql)
+	l.Interface.Trace(ctx, begin, fc, err)
+}
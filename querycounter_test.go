@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestQueryCounter(t *testing.T) {
+	// 只生成SQL，不连接数据库
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "dry:run@tcp(127.0.0.1:1)/dry", SkipInitializeWithVersion: true}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	assert.NoError(t, err)
+
+	t.Run("统计每条SQL", func(t *testing.T) {
+		counter := NewQueryCounter()
+		counted := counter.Wrap(db)
+
+		var user User
+		counted.First(&user, 1)
+		counted.Model(&Role{}).Where("status = ?", 1).Count(new(int64))
+
+		assert.Equal(t, int64(2), counter.Count())
+		statements := counter.Statements()
+		assert.Len(t, statements, 2)
+		assert.Contains(t, statements[0], "sys_users")
+		assert.Contains(t, statements[1], "sys_roles")
+
+		// 未包装的会话不计数
+		db.First(&user, 1)
+		assert.Equal(t, int64(2), counter.Count())
+	})
+
+	t.Run("调整日志级别后继续计数", func(t *testing.T) {
+		counter := NewQueryCounter()
+		counted := counter.Wrap(db)
+
+		var users []*User
+		counted.Find(&users)
+		counted.Session(&gorm.Session{Logger: counted.Logger.LogMode(logger.Silent)}).Find(&users)
+		assert.Equal(t, int64(2), counter.Count())
+	})
+
+	t.Run("Measure只统计期间的SQL", func(t *testing.T) {
+		counter := NewQueryCounter()
+		counted := counter.Wrap(db)
+
+		var users []*User
+		counted.Find(&users)
+		assert.Equal(t, int64(3), counter.Measure(func() {
+			for i := 0; i < 3; i++ {
+				counted.Find(&users)
+			}
+		}))
+	})
+
+	t.Run("超出预算时返回执行的SQL", func(t *testing.T) {
+		counter := NewQueryCounter()
+		counted := counter.Wrap(db)
+
+		var users []*User
+		assert.NoError(t, counter.CheckBudget(1, func() { counted.Find(&users) }))
+
+		err := counter.CheckBudget(1, func() {
+			counted.Find(&users)
+			counted.Model(&Role{}).Count(new(int64))
+		})
+		assert.True(t, errors.Is(err, ErrQueryBudgetExceeded))
+		assert.Contains(t, err.Error(), "sys_roles")
+	})
+
+	t.Run("并发计数", func(t *testing.T) {
+		counter := NewQueryCounter()
+		counted := counter.Wrap(db)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					var users []*User
+					counted.Find(&users)
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int64(800), counter.Count())
+		assert.Len(t, counter.Statements(), maxRecordedStatements)
+	})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimitStore 限流计数存储接口，计数在窗口期结束后自动清零
+type RateLimitStore interface {
+	// 计数加一并返回增加后的值，计数不存在或已过期时以window为有效期重新计数
+	Increment(key string, window time.Duration) (int, error)
+	// 获取当前计数，不存在或已过期时返回0
+	Get(key string) (int, error)
+	// 清除计数
+	Reset(key string) error
+}
+
+// rateLimitEntry 限流计数记录
+type rateLimitEntry struct {
+	count     int
+	expiresAt time.Time
+}
+
+// MemoryRateLimitStore 内存限流计数存储实现
+type MemoryRateLimitStore struct {
+	entries map[string]rateLimitEntry
+	clock   Clock
+	mutex   sync.Mutex
+}
+
+// NewMemoryRateLimitStore 创建内存限流计数存储
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return NewMemoryRateLimitStoreWithClock(nil)
+}
+
+// NewMemoryRateLimitStoreWithClock 创建按指定时钟判断窗口期的内存限流计数存储，clock为nil时使用系统时间
+func NewMemoryRateLimitStoreWithClock(clock Clock) *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		entries: make(map[string]rateLimitEntry),
+		clock:   clockOrDefault(clock),
+	}
+}
+
+// Increment 计数加一并返回增加后的值
+func (s *MemoryRateLimitStore) Increment(key string, window time.Duration) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.clock.Now()
+	entry, exists := s.entries[key]
+	if !exists || !now.Before(entry.expiresAt) {
+		entry = rateLimitEntry{expiresAt: now.Add(window)}
+	}
+	entry.count++
+	s.entries[key] = entry
+	return entry.count, nil
+}
+
+// Get 获取当前计数
+func (s *MemoryRateLimitStore) Get(key string) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, exists := s.entries[key]
+	if !exists {
+		return 0, nil
+	}
+	if !s.clock.Now().Before(entry.expiresAt) {
+		delete(s.entries, key)
+		return 0, nil
+	}
+	return entry.count, nil
+}
+
+// Reset 清除计数
+func (s *MemoryRateLimitStore) Reset(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"errors"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // RegisterService 注册服务接口
 type RegisterService interface {
 	// 用户注册
 	Register(username, email, password, invitationCode string) (*User, string, error)
+	// 按选项注册用户，记录用户同意的服务条款版本
+	RegisterWithOptions(username, email, password string, options RegisterOptions) (*User, string, error)
+	// 用户注册，只返回可安全对外的用户信息
+	RegisterPublic(username, email, password, invitationCode string) (PublicUser, string, error)
 	// 验证用户名是否可用
 	IsUsernameAvailable(username string) (bool, error)
 	// 验证邮箱是否可用
@@ -16,29 +23,65 @@ type RegisterService interface {
 	ValidateInvitationCode(code string) (bool, error)
 }
 
+// RegisterOptions 注册选项
+type RegisterOptions struct {
+	InvitationCode       string // 邀请码
+	AcceptedTermsVersion string // 用户注册时同意的服务条款版本，为空表示未同意
+}
+
+// newRegistrationUser 根据注册信息创建用户对象，同意了服务条款时记录版本和同意时间
+func newRegistrationUser(username, email, password string, options RegisterOptions) *User {
+	user := &User{
+		Username:       username,
+		Email:          email,
+		PasswordHash:   password, // UserService会自动哈希
+		Status:         1,
+		InvitationCode: options.InvitationCode,
+	}
+	if options.AcceptedTermsVersion != "" {
+		now := time.Now()
+		user.AcceptedTermsVersion = options.AcceptedTermsVersion
+		user.AcceptedTermsAt = &now
+	}
+	return user
+}
+
 // registerService 注册服务实现
 type registerService struct {
-	userService  UserService
-	tokenService TokenService
+	userService     UserService
+	tokenService    TokenService
+	passwordManager PasswordManager // 新密码校验规则，为nil时不校验
 }
 
 // NewRegisterService 创建注册服务实例
 func NewRegisterService(userService UserService, tokenService TokenService) RegisterService {
+	return NewRegisterServiceWithPasswordManager(userService, tokenService, nil)
+}
+
+// NewRegisterServiceWithPasswordManager 创建使用密码管理器校验密码的注册服务实例
+func NewRegisterServiceWithPasswordManager(userService UserService, tokenService TokenService, passwordManager PasswordManager) RegisterService {
 	return &registerService{
-		userService:  userService,
-		tokenService: tokenService,
+		userService:     userService,
+		tokenService:    tokenService,
+		passwordManager: passwordManager,
 	}
 }
 
 // Register 用户注册
 func (s *registerService) Register(username, email, password, invitationCode string) (*User, string, error) {
+	return s.RegisterWithOptions(username, email, password, RegisterOptions{InvitationCode: invitationCode})
+}
+
+// RegisterWithOptions 按选项注册用户
+//
+// 只记录用户同意的服务条款版本，不检查是否为要求的版本；需要强制同意时使用AuthService注册。
+func (s *registerService) RegisterWithOptions(username, email, password string, options RegisterOptions) (*User, string, error) {
 	// 创建用户对象
-	user := &User{
-		Username:       username,
-		Email:          email,
-		PasswordHash:   password, // UserService会自动哈希
-		Status:         1,
-		InvitationCode: invitationCode,
+	user := newRegistrationUser(username, email, password, options)
+
+	// 一次校验全部字段，CreateUser仍会再次检查以防并发注册
+	if err := validateRegistration(s.userService, s.passwordManager, user, password); err != nil {
+		return nil, "", err
 	}
 
 	// 创建用户
@@ -46,9 +89,10 @@ func (s *registerService) Register(username, email, password, invitationCode str
 	if err != nil {
 		return nil, "", err
 	}
+	recordPasswordHistory(s.passwordManager, user.ID, password)
 
 	// 生成Token
-	token, err := s.tokenService.GenerateToken(user.ID)
+	token, err := s.tokenService.GenerateTokenForUser(user)
 	if err != nil {
 		return nil, "", err
 	}
@@ -56,18 +100,30 @@ func (s *registerService) Register(username, email, password, invitationCode str
 	// 设置注册时间为最后登录时间
 	now := time.Now()
 	user.LastLoginAt = &now
-	s.userService.UpdateUser(user)
+	s.userService.UpdateLastLogin(user.ID, now)
 
 	return user, token, nil
 }
 
+// RegisterPublic 用户注册，只返回可安全对外的用户信息
+func (s *registerService) RegisterPublic(username, email, password, invitationCode string) (PublicUser, string, error) {
+	user, token, err := s.Register(username, email, password, invitationCode)
+	if err != nil {
+		return PublicUser{}, "", err
+	}
+	return user.Public(), token, nil
+}
+
 // IsUsernameAvailable 验证用户名是否可用
 func (s *registerService) IsUsernameAvailable(username string) (bool, error) {
 	_, err := s.userService.GetUserByUsername(username)
-	if err != nil {
+	if isUserNotFound(err) {
 		// 如果用户不存在，说明用户名可用
 		return true, nil
 	}
+	if err != nil {
+		return false, err
+	}
 	// 用户存在，用户名不可用
 	return false, nil
 }
@@ -75,14 +131,22 @@ func (s *registerService) IsUsernameAvailable(username string) (bool, error) {
 // IsEmailAvailable 验证邮箱是否可用
 func (s *registerService) IsEmailAvailable(email string) (bool, error) {
 	_, err := s.userService.GetUserByEmail(email)
-	if err != nil {
+	if isUserNotFound(err) {
 		// 如果用户不存在，说明邮箱可用
 		return true, nil
 	}
+	if err != nil {
+		return false, err
+	}
 	// 用户存在，邮箱不可用
 	return false, nil
 }
 
+// isUserNotFound 判断查询错误是否表示用户不存在，其他错误（如数据库连接失败）不能视为可用
+func isUserNotFound(err error) bool {
+	return errors.Is(err, ErrUserNotFound) || errors.Is(err, gorm.ErrRecordNotFound)
+}
+
 // ValidateInvitationCode 验证邀请码是否有效
 func (s *registerService) ValidateInvitationCode(code string) (bool, error) {
 	return s.userService.ValidateInvitationCode(code)
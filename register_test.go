@@ -1,10 +1,12 @@
 package main
 
 import (
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
 )
 
 func TestRegisterService(t *testing.T) {
@@ -63,7 +65,7 @@ func TestRegisterService(t *testing.T) {
 		// 尝试注册相同用户名的用户
 		_, _, err = registerService.Register("existinguser", "different@example.com", "password123", "")
 		assert.Error(t, err)
-		assert.Equal(t, "用户名已存在", err.Error())
+		assertValidationCode(t, err, FieldUsername, ValidationCodeTaken)
 	})
 
 	t.Run("用户注册失败-邮箱已存在", func(t *testing.T) {
@@ -77,7 +79,7 @@ func TestRegisterService(t *testing.T) {
 		// 尝试注册相同邮箱的用户
 		_, _, err = registerService.Register("user2", "same@example.com", "password123", "")
 		assert.Error(t, err)
-		assert.Equal(t, "邮箱已存在", err.Error())
+		assertValidationCode(t, err, FieldEmail, ValidationCodeTaken)
 	})
 
 	t.Run("用户注册失败-无效邀请码", func(t *testing.T) {
@@ -87,7 +89,7 @@ func TestRegisterService(t *testing.T) {
 		// 尝试使用无效邀请码注册
 		_, _, err := registerService.Register("user", "user@example.com", "password123", "invalid")
 		assert.Error(t, err)
-		assert.Equal(t, "邀请码无效", err.Error())
+		assertValidationCode(t, err, FieldInvitationCode, ValidationCodeInvalid)
 	})
 
 	t.Run("验证用户名可用性", func(t *testing.T) {
@@ -197,4 +199,69 @@ func TestRegisterService(t *testing.T) {
 		timeDiff := user.UpdatedAt.Sub(user.CreatedAt)
 		assert.True(t, timeDiff >= 0 && timeDiff < time.Second)
 	})
+
+	t.Run("配置密码管理器时校验密码", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		config := DefaultPasswordManagerConfig()
+		config.BcryptCost = 4
+		checked := NewRegisterServiceWithPasswordManager(userService, tokenService, NewPasswordManager(config))
+
+		// 弱密码和包含用户名的密码被拒绝，且不创建用户
+		_, _, err := checked.Register("newuser", "newuser@example.com", "password123", "")
+		assert.True(t, errors.Is(err, ErrPasswordPolicyViolation))
+		_, _, err = checked.Register("newuser", "newuser@example.com", "Newuser#Zebra42", "")
+		assert.True(t, errors.Is(err, ErrPasswordTooSimilar))
+		available, err := registerService.IsUsernameAvailable("newuser")
+		assert.NoError(t, err)
+		assert.True(t, available)
+
+		user, _, err := checked.Register("newuser", "newuser@example.com", "Tr0ub4dor&Zebra", "")
+		assert.NoError(t, err)
+		assert.NotZero(t, user.ID)
+	})
+}
+
+// stubUserService 测试用用户服务，只实现可用性检查所需的方法
+type stubUserService struct {
+	UserService
+	err error
+}
+
+func (s *stubUserService) GetUserByUsername(username string) (*User, error) {
+	return nil, s.err
+}
+
+func (s *stubUserService) GetUserByEmail(email string) (*User, error) {
+	return nil, s.err
+}
+
+func TestRegisterServiceAvailabilityErrors(t *testing.T) {
+	t.Run("用户不存在时可用", func(t *testing.T) {
+		for _, notFound := range []error{ErrUserNotFound, gorm.ErrRecordNotFound, wrapNotFound(gorm.ErrRecordNotFound, ErrUserNotFound)} {
+			registerService := NewRegisterService(&stubUserService{err: notFound}, nil)
+
+			available, err := registerService.IsUsernameAvailable("newuser")
+			assert.NoError(t, err)
+			assert.True(t, available)
+
+			available, err = registerService.IsEmailAvailable("new@example.com")
+			assert.NoError(t, err)
+			assert.True(t, available)
+		}
+	})
+
+	t.Run("查询失败时返回错误而不是可用", func(t *testing.T) {
+		dbErr := errors.New("数据库连接失败")
+		registerService := NewRegisterService(&stubUserService{err: dbErr}, nil)
+
+		available, err := registerService.IsUsernameAvailable("existinguser")
+		assert.True(t, errors.Is(err, dbErr))
+		assert.False(t, available)
+
+		available, err = registerService.IsEmailAvailable("existing@example.com")
+		assert.True(t, errors.Is(err, dbErr))
+		assert.False(t, available)
+	})
 }
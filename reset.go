@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 重置码错误定义
+var (
+	ErrInvalidResetCode = errors.New("无效的重置码")
+	ErrResetCodeExpired = errors.New("重置码已过期")
+	ErrResetCodeUsed    = errors.New("重置码已使用")
+)
+
+// 重置码格式：<selector>.<verifier>
+const (
+	resetSelectorBytes = 12 // 选择器用于查找记录，明文存储
+	resetVerifierBytes = 32 // 验证器只存储SHA-256哈希
+)
+
+// 重置码用途，不同用途的重置码不能互相替代
+const (
+	ResetPurposePassword      = "password"       // 设置新密码
+	ResetPurposeSecureAccount = "secure_account" // 安全通知中的链接，只能用于SecureAccount锁定账户
+)
+
+// PasswordResetCode 密码重置码
+//
+// 重置码拆分为选择器和验证器：按选择器索引查找记录，再以常量时间比较验证器哈希，
+// 数据库中从不保存完整的重置码。
+type PasswordResetCode struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	UserID       uint       `gorm:"not null;index" json:"user_id"`
+	Purpose      string     `gorm:"size:32;not null;default:password" json:"purpose"`
+	Selector     string     `gorm:"size:32;uniqueIndex;not null" json:"-"`
+	VerifierHash string     `gorm:"size:64;not null" json:"-"`
+	ExpiresAt    time.Time  `gorm:"not null;index" json:"expires_at"`
+	UsedAt       *time.Time `json:"used_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// TableName 设置表名
+func (PasswordResetCode) TableName() string {
+	return "sys_password_reset_codes"
+}
+
+// generateResetCode 生成重置码，返回完整重置码、选择器和验证器哈希
+func generateResetCode() (code, selector, verifierHash string, err error) {
+	selectorBytes := make([]byte, resetSelectorBytes)
+	if _, err := rand.Read(selectorBytes); err != nil {
+		return "", "", "", err
+	}
+	verifierBytes := make([]byte, resetVerifierBytes)
+	if _, err := rand.Read(verifierBytes); err != nil {
+		return "", "", "", err
+	}
+
+	selector = hex.EncodeToString(selectorBytes)
+	verifier := hex.EncodeToString(verifierBytes)
+	return selector + "." + verifier, selector, hashResetVerifier(verifier), nil
+}
+
+// splitResetCode 拆分重置码为选择器和验证器
+func splitResetCode(code string) (selector, verifier string, err error) {
+	selector, verifier, ok := strings.Cut(code, ".")
+	if !ok || len(selector) != resetSelectorBytes*2 || len(verifier) != resetVerifierBytes*2 {
+		return "", "", ErrInvalidResetCode
+	}
+	return selector, verifier, nil
+}
+
+// hashResetVerifier 计算验证器的SHA-256哈希
+func hashResetVerifier(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return hex.EncodeToString(sum[:])
+}
+
+// ResetPassword 为邮箱对应的用户签发密码重置码
+//
+// 每个用户最多保留 MaxOutstandingResetCodes 个未使用的重置码，新的请求会使较早的重置码失效。
+func (s *authService) ResetPassword(email string) (string, error) {
+	user, err := s.userService.GetUserByEmail(email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return "", errors.New("邮箱不存在")
+		}
+		return "", err
+	}
+
+	code, record, err := s.issueResetCode(user.ID, ResetPurposePassword, s.config.ResetCodeTTL)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.config.AuditLogger.Log(AuditEvent{
+		Type:      AuditEventResetCodeIssued,
+		UserID:    user.ID,
+		Detail:    fmt.Sprintf("expires_at=%s", record.ExpiresAt.Format(time.RFC3339)),
+		CreatedAt: record.CreatedAt,
+	}); err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// issueResetCode 为用户签发指定用途和有效期的重置码，同一用途超出 MaxOutstandingResetCodes 的较早重置码失效
+func (s *authService) issueResetCode(userID uint, purpose string, ttl time.Duration) (string, *PasswordResetCode, error) {
+	code, selector, verifierHash, err := generateResetCode()
+	if err != nil {
+		return "", nil, fmt.Errorf("生成重置码失败: %w", err)
+	}
+
+	now := s.config.now()
+	record := &PasswordResetCode{
+		UserID:       userID,
+		Purpose:      purpose,
+		Selector:     selector,
+		VerifierHash: verifierHash,
+		ExpiresAt:    now.Add(ttl),
+		CreatedAt:    now,
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// 只保留同一用途最新的 MaxOutstandingResetCodes-1 个未使用重置码，为新重置码腾出名额
+		var outstandingIDs []uint
+		if err := tx.Model(&PasswordResetCode{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", userID, purpose, now).
+			Order("created_at DESC").Order("id DESC").
+			Pluck("id", &outstandingIDs).Error; err != nil {
+			return err
+		}
+		if keep := s.config.MaxOutstandingResetCodes - 1; len(outstandingIDs) > keep {
+			if err := tx.Delete(&PasswordResetCode{}, outstandingIDs[keep:]).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(record).Error
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("保存重置码失败: %w", err)
+	}
+
+	return code, record, nil
+}
+
+// findResetCode 查找并校验指定用途、未使用且未过期的重置码，用途不符时视为无效的重置码
+func (s *authService) findResetCode(resetCode, purpose string, now time.Time) (*PasswordResetCode, error) {
+	selector, verifier, err := splitResetCode(resetCode)
+	if err != nil {
+		return nil, err
+	}
+
+	var record PasswordResetCode
+	if err := s.db.Where("selector = ?", selector).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidResetCode
+		}
+		return nil, err
+	}
+
+	// 使用constant time比较防止时序攻击
+	if subtle.ConstantTimeCompare([]byte(hashResetVerifier(verifier)), []byte(record.VerifierHash)) != 1 {
+		return nil, ErrInvalidResetCode
+	}
+	if record.Purpose != purpose {
+		return nil, ErrInvalidResetCode
+	}
+	if record.UsedAt != nil {
+		return nil, ErrResetCodeUsed
+	}
+	if !now.Before(record.ExpiresAt) {
+		return nil, ErrResetCodeExpired
+	}
+
+	return &record, nil
+}
+
+// ConfirmPasswordReset 验证重置码并设置新密码
+//
+// 重置码只能使用一次：通过带条件的UPDATE标记使用，并发提交同一重置码时只有一个请求成功。
+func (s *authService) ConfirmPasswordReset(resetCode, newPassword string) error {
+	if newPassword == "" {
+		return errors.New("新密码不能为空")
+	}
+
+	now := s.config.now()
+	record, err := s.findResetCode(resetCode, ResetPurposePassword, now)
+	if err != nil {
+		return err
+	}
+
+	if s.config.PasswordManager != nil {
+		user, err := s.userService.GetUserByID(record.UserID)
+		if err != nil {
+			return err
+		}
+		if err := s.validateUserPassword(user, newPassword); err != nil {
+			return err
+		}
+	}
+
+	// 在事务外完成耗时的哈希计算，缩短行锁持有时间
+	hashedPassword, err := s.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := useResetCode(tx, record, now); err != nil {
+			return err
+		}
+
+		return tx.Model(&User{}).Where("id = ?", record.UserID).Updates(map[string]interface{}{
+			"password_hash":       hashedPassword,
+			"hash_algo":           passwordHashAlgo(hashedPassword),
+			"password_changed_at": now,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+	invalidateUserCache(s.userService, record.UserID)
+
+	recordPasswordHistory(s.config.PasswordManager, record.UserID, newPassword)
+
+	// 密码已重置，撤销之前签发的Token
+	if err := s.tokenService.RevokeAllUserTokens(record.UserID); err != nil {
+		return err
+	}
+
+	if err := s.config.AuditLogger.Log(AuditEvent{
+		Type:      AuditEventResetCodeConsumed,
+		UserID:    record.UserID,
+		CreatedAt: now,
+	}); err != nil {
+		return err
+	}
+
+	if s.config.SecurityNotifications.PasswordReset {
+		s.notifySecurityChange(record.UserID, MailTemplatePasswordReset, now)
+	}
+	return nil
+}
+
+// useResetCode 通过带条件的UPDATE标记重置码已使用，已被其他请求使用或已过期时返回ErrResetCodeUsed
+func useResetCode(tx *gorm.DB, record *PasswordResetCode, now time.Time) error {
+	result := tx.Model(&PasswordResetCode{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", record.ID, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrResetCodeUsed
+	}
+	return nil
+}
+
+// CleanupResetCodes 删除已过期或已使用的重置码，返回删除的数量
+func (s *authService) CleanupResetCodes() (int, error) {
+	result := s.db.Where("expires_at <= ? OR used_at IS NOT NULL", s.config.now()).Delete(&PasswordResetCode{})
+	return int(result.RowsAffected), result.Error
+}
+
+// StartResetCodeCleaner 启动后台协程，每隔interval调用一次CleanupResetCodes，直到ctx取消
+//
+// 返回的通道在协程退出后关闭，服务退出时取消ctx并等待该通道即可确保清理已停止。
+// interval不大于0时不启动协程，返回已关闭的通道。多实例部署时只需在一个实例上启动。
+func StartResetCodeCleaner(ctx context.Context, service AuthService, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	if interval <= 0 {
+		close(done)
+		return done
+	}
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				// 清理失败只记录日志，下一周期重试
+				if removed, err := service.CleanupResetCodes(); err != nil {
+					log.Printf("清理重置码失败: %v", err)
+				} else if removed > 0 {
+					log.Printf("清理重置码: removed=%d", removed)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return done
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// ResourcePathSeparator 层级资源路径的分隔符，如project/123/doc/45
+const ResourcePathSeparator = "/"
+
+// ResourcePathPermissionNamePattern 允许层级资源路径的权限命名模式，如project/123.read
+//
+// 默认命名规范不允许路径资源，使用HasPermissionOnPath时通过NewRoleServiceWithNamingPolicy配置该模式。
+const ResourcePathPermissionNamePattern = `^[a-z][a-z0-9_]*(/[a-z0-9_-]+)*\.[a-z][a-z0-9_]*$`
+
+// ErrInvalidResourcePath 资源路径为空或包含空段、"."、".."
+var ErrInvalidResourcePath = errors.New("无效的资源路径")
+
+// resourcePathAncestors 返回路径本身及其所有上级路径，由具体到宽泛排列
+//
+// 首尾的分隔符会被忽略：/project/123/ 与 project/123 等价。
+func resourcePathAncestors(path string) ([]string, error) {
+	segments := strings.Split(strings.Trim(path, ResourcePathSeparator), ResourcePathSeparator)
+	for _, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return nil, ErrInvalidResourcePath
+		}
+	}
+
+	ancestors := make([]string, 0, len(segments))
+	for i := len(segments); i > 0; i-- {
+		ancestors = append(ancestors, strings.Join(segments[:i], ResourcePathSeparator))
+	}
+	return ancestors, nil
+}
+
+// HasPermissionOnPath 检查用户对层级资源是否有指定操作的权限
+//
+// 对路径本身或任一上级路径的授权都会生效，例如project/123上的read权限同样适用于project/123/doc/45。
+// 只匹配完整的路径段，project/12上的权限不适用于project/123。HasPermission仍按资源精确匹配。
+// 与HasPermission一样，路径和操作转为小写后匹配。
+func (s *roleService) HasPermissionOnPath(userID uint, path, action string) (bool, error) {
+	action = normalizePermissionPart(action)
+	ancestors, err := resourcePathAncestors(normalizePermissionPart(path))
+	if err != nil {
+		return false, err
+	}
+
+	// 排除已删除的角色
+	activeRoleIDs := s.db.Model(&Role{}).Select("id").Where("id IN (?)", s.userRoleIDs(userID))
+
+	var count int64
+	err = s.db.Model(&Permission{}).
+		Where("resource IN ? AND action = ?", ancestors, action).
+		Where("id IN (?)", s.rolePermissionIDs(activeRoleIDs)).
+		Count(&count).Error
+
+	return count > 0, err
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResourcePathAncestors(t *testing.T) {
+	t.Run("由具体到宽泛返回所有上级路径", func(t *testing.T) {
+		ancestors, err := resourcePathAncestors("/project/123/doc/45/")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"project/123/doc/45", "project/123/doc", "project/123", "project"}, ancestors)
+
+		ancestors, err = resourcePathAncestors("user")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"user"}, ancestors)
+	})
+
+	t.Run("拒绝无效路径", func(t *testing.T) {
+		for _, path := range []string{"", "/", "project//doc", "project/../admin", "project/./doc"} {
+			_, err := resourcePathAncestors(path)
+			assert.True(t, errors.Is(err, ErrInvalidResourcePath), path)
+		}
+	})
+}
+
+func TestRoleServiceHasPermissionOnPath(t *testing.T) {
+	// 设置测试数据库
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	policy := DefaultPermissionNamingPolicy()
+	policy.Pattern = regexp.MustCompile(ResourcePathPermissionNamePattern)
+	roleService := NewRoleServiceWithNamingPolicy(testDB.DB, policy)
+
+	t.Run("上级路径的授权适用于下级资源", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		user := testDB.CreateTestUser("testuser", "test@example.com", "password")
+		role := testDB.CreateTestRole("reader", "读者", "项目读者")
+		permission := &Permission{Name: "project/123.read", DisplayName: "查看项目123", Resource: "project/123", Action: "read"}
+		assert.NoError(t, roleService.CreatePermission(permission))
+		assert.NoError(t, roleService.AssignPermissionToRole(role.ID, permission.ID))
+		assert.NoError(t, roleService.AssignRoleToUser(user.ID, role.ID))
+
+		for path, expected := range map[string]bool{
+			"project/123":        true,
+			"project/123/doc/45": true,
+			"project":            false,
+			"project/1234":       false,
+			"project/12":         false,
+		} {
+			allowed, err := roleService.HasPermissionOnPath(user.ID, path, "read")
+			assert.NoError(t, err)
+			assert.Equal(t, expected, allowed, path)
+		}
+
+		// 操作必须一致
+		allowed, err := roleService.HasPermissionOnPath(user.ID, "project/123/doc/45", "delete")
+		assert.NoError(t, err)
+		assert.False(t, allowed)
+
+		// HasPermission仍然精确匹配
+		allowed, err = roleService.HasPermission(user.ID, "project/123/doc/45", "read")
+		assert.NoError(t, err)
+		assert.False(t, allowed)
+	})
+
+	t.Run("默认命名规范不允许路径资源", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		err := NewRoleService(testDB.DB).CreatePermission(&Permission{Name: "project/123.read", DisplayName: "查看项目123", Resource: "project/123", Action: "read"})
+		assert.True(t, errors.Is(err, ErrInvalidPermissionName))
+	})
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"container/heap"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const (
+	// revocationShardCount 撤销集合的分片数量
+	revocationShardCount = 32
+	// minEntriesPerShard 容量较小时不分片，避免单个分片容量过小
+	minEntriesPerShard = 64
+	// defaultMaxRevokedTokens 默认最多保留的撤销记录数
+	defaultMaxRevokedTokens = 100000
+)
+
+// revocationEntry 撤销记录
+type revocationEntry struct {
+	revokedAt time.Time // 撤销时间
+	expiresAt time.Time // Token过期时间，过期后记录不再需要
+}
+
+// expiryItem 过期时间堆中的元素
+type expiryItem struct {
+	tokenString string
+	expiresAt   time.Time
+}
+
+// expiryHeap 按过期时间排序的最小堆，最先过期的在堆顶
+type expiryHeap []expiryItem
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expiresAt.Before(h[j].expiresAt) }
+func (h expiryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x any)        { *h = append(*h, x.(expiryItem)) }
+func (h *expiryHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// revocationShard 撤销集合分片
+type revocationShard struct {
+	tokens     map[string]revocationEntry // Token -> 撤销记录
+	expiries   expiryHeap                 // 按过期时间排序，用于清除过期记录
+	maxEntries int
+	mutex      sync.RWMutex
+}
+
+// revocationSet 按Token哈希分片、容量有界的撤销集合
+//
+// 验证Token时只需获取单个分片的读锁，批量撤销也只逐个短暂持有分片写锁，
+// 避免高并发验证与RevokeAllUserTokens之间争用同一把锁。
+// 分片写满时先清除已过期的记录，仍然不足则拒绝写入未过期的记录并返回false，
+// 不会淘汰尚未过期的撤销记录，因此内存占用有上限且已撤销的Token不会重新生效。
+type revocationSet struct {
+	shards []*revocationShard
+}
+
+// newRevocationSet 创建最多保存maxEntries条记录的撤销集合
+func newRevocationSet(maxEntries int) *revocationSet {
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxRevokedTokens
+	}
+
+	shardCount := 1
+	if maxEntries >= revocationShardCount*minEntriesPerShard {
+		shardCount = revocationShardCount
+	}
+
+	set := &revocationSet{shards: make([]*revocationShard, shardCount)}
+	for i := range set.shards {
+		set.shards[i] = &revocationShard{
+			tokens:     make(map[string]revocationEntry),
+			maxEntries: maxEntries / shardCount,
+		}
+	}
+	return set
+}
+
+// shard 获取Token所在的分片
+func (r *revocationSet) shard(tokenString string) *revocationShard {
+	if len(r.shards) == 1 {
+		return r.shards[0]
+	}
+	hasher := fnv.New32a()
+	hasher.Write([]byte(tokenString))
+	return r.shards[hasher.Sum32()%uint32(len(r.shards))]
+}
+
+// Add 记录撤销的Token，expiresAt为Token的过期时间，分片已满且没有过期记录可清除时返回false
+func (r *revocationSet) Add(tokenString string, revokedAt, expiresAt time.Time) bool {
+	shard := r.shard(tokenString)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	return shard.add(tokenString, revokedAt, expiresAt)
+}
+
+// AddIfAbsent 记录尚未撤销的Token，检查与写入在同一把分片锁内完成
+//
+// added表示是否新写入，Token此前已撤销时为false；full表示分片已满而未能写入。
+func (r *revocationSet) AddIfAbsent(tokenString string, revokedAt, expiresAt time.Time) (added, full bool) {
+	shard := r.shard(tokenString)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	if _, exists := shard.tokens[tokenString]; exists {
+		return false, false
+	}
+	if !shard.add(tokenString, revokedAt, expiresAt) {
+		return false, true
+	}
+	return true, false
+}
+
+// add 写入撤销记录，调用方需持有分片写锁；分片已满且没有过期记录可清除时不写入并返回false
+func (s *revocationShard) add(tokenString string, revokedAt, expiresAt time.Time) bool {
+	existing, exists := s.tokens[tokenString]
+	if exists && existing.expiresAt.Equal(expiresAt) {
+		// 重复撤销同一Token，不向过期时间堆追加元素，避免堆无限增长
+		return true
+	}
+	if !exists && len(s.tokens) >= s.maxEntries {
+		s.purgeExpired(revokedAt)
+		if len(s.tokens) >= s.maxEntries {
+			// 已过期的新记录无需保存；未过期的记录不能淘汰，否则对应的Token会重新生效
+			return !expiresAt.After(revokedAt)
+		}
+	}
+
+	s.tokens[tokenString] = revocationEntry{revokedAt: revokedAt, expiresAt: expiresAt}
+	heap.Push(&s.expiries, expiryItem{tokenString: tokenString, expiresAt: expiresAt})
+	return true
+}
+
+// soonest 获取最先过期的记录，同时丢弃堆顶已删除或已被重新写入的元素
+func (s *revocationShard) soonest() (expiryItem, bool) {
+	for s.expiries.Len() > 0 {
+		item := s.expiries[0]
+		if entry, exists := s.tokens[item.tokenString]; exists && entry.expiresAt.Equal(item.expiresAt) {
+			return item, true
+		}
+		heap.Pop(&s.expiries)
+	}
+	return expiryItem{}, false
+}
+
+// purgeExpired 清除在now之前已过期的记录
+func (s *revocationShard) purgeExpired(now time.Time) {
+	for {
+		item, ok := s.soonest()
+		if !ok || item.expiresAt.After(now) {
+			return
+		}
+		heap.Pop(&s.expiries)
+		delete(s.tokens, item.tokenString)
+	}
+}
+
+// Contains 检查Token是否已撤销
+func (r *revocationSet) Contains(tokenString string) bool {
+	shard := r.shard(tokenString)
+	shard.mutex.RLock()
+	_, revoked := shard.tokens[tokenString]
+	shard.mutex.RUnlock()
+	return revoked
+}
+
+// DeleteFunc 删除满足条件的撤销记录，逐个分片加锁
+func (r *revocationSet) DeleteFunc(shouldDelete func(tokenString string, expiresAt time.Time) bool) {
+	for _, shard := range r.shards {
+		shard.mutex.Lock()
+		for tokenString, entry := range shard.tokens {
+			if shouldDelete(tokenString, entry.expiresAt) {
+				delete(shard.tokens, tokenString)
+			}
+		}
+
+		// 重建过期时间堆，丢弃已删除的元素
+		shard.expiries = shard.expiries[:0]
+		for tokenString, entry := range shard.tokens {
+			shard.expiries = append(shard.expiries, expiryItem{tokenString: tokenString, expiresAt: entry.expiresAt})
+		}
+		heap.Init(&shard.expiries)
+		shard.mutex.Unlock()
+	}
+}
+
+// Len 获取撤销记录数量
+func (r *revocationSet) Len() int {
+	count := 0
+	for _, shard := range r.shards {
+		shard.mutex.RLock()
+		count += len(shard.tokens)
+		shard.mutex.RUnlock()
+	}
+	return count
+}
+
+// Cap 获取撤销集合的容量
+func (r *revocationSet) Cap() int {
+	capacity := 0
+	for _, shard := range r.shards {
+		capacity += shard.maxEntries
+	}
+	return capacity
+}
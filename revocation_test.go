@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevocationSet(t *testing.T) {
+	t.Run("添加和检查撤销记录", func(t *testing.T) {
+		set := newRevocationSet(0)
+
+		assert.False(t, set.Contains("token-a"))
+		set.Add("token-a", time.Now(), time.Now().Add(time.Hour))
+		assert.True(t, set.Contains("token-a"))
+		assert.False(t, set.Contains("token-b"))
+		assert.Equal(t, 1, set.Len())
+	})
+
+	t.Run("按条件删除撤销记录", func(t *testing.T) {
+		set := newRevocationSet(0)
+		for i := 0; i < 100; i++ {
+			set.Add(fmt.Sprintf("token-%d", i), time.Now(), time.Now().Add(time.Hour))
+		}
+
+		set.DeleteFunc(func(tokenString string, expiresAt time.Time) bool {
+			return tokenString != "token-7"
+		})
+
+		assert.Equal(t, 1, set.Len())
+		assert.True(t, set.Contains("token-7"))
+	})
+
+	t.Run("写满时拒绝写入且不淘汰未过期的记录", func(t *testing.T) {
+		set := newRevocationSet(3)
+		now := time.Now()
+		assert.True(t, set.Add("token-late", now, now.Add(3*time.Hour)))
+		assert.True(t, set.Add("token-soon", now, now.Add(time.Hour)))
+		assert.True(t, set.Add("token-mid", now, now.Add(2*time.Hour)))
+
+		assert.False(t, set.Add("token-new", now, now.Add(4*time.Hour)))
+		assert.False(t, set.Add("token-sooner", now, now.Add(time.Minute)))
+		added, full := set.AddIfAbsent("token-new", now, now.Add(4*time.Hour))
+		assert.False(t, added)
+		assert.True(t, full)
+		added, full = set.AddIfAbsent("token-soon", now, now.Add(time.Hour))
+		assert.False(t, added)
+		assert.False(t, full, "已撤销的Token不算写满")
+
+		assert.Equal(t, 3, set.Len())
+		for _, token := range []string{"token-soon", "token-mid", "token-late"} {
+			assert.True(t, set.Contains(token), token)
+		}
+		assert.False(t, set.Contains("token-new"))
+	})
+
+	t.Run("写满时优先清除已过期的记录", func(t *testing.T) {
+		set := newRevocationSet(3)
+		now := time.Now()
+		set.Add("token-expired-1", now, now.Add(-time.Minute))
+		set.Add("token-expired-2", now, now.Add(-time.Second))
+		set.Add("token-valid", now, now.Add(time.Minute))
+
+		set.Add("token-new", now, now.Add(time.Hour))
+
+		assert.Equal(t, 2, set.Len())
+		assert.True(t, set.Contains("token-valid"))
+		assert.True(t, set.Contains("token-new"))
+	})
+
+	t.Run("重复添加不占用额外容量", func(t *testing.T) {
+		set := newRevocationSet(2)
+		now := time.Now()
+		set.Add("token-a", now, now.Add(time.Hour))
+		set.Add("token-b", now, now.Add(2*time.Hour))
+		set.Add("token-a", now, now.Add(time.Hour))
+
+		assert.Equal(t, 2, set.Len())
+		assert.True(t, set.Contains("token-a"))
+		assert.True(t, set.Contains("token-b"))
+		assert.Equal(t, 2, set.shards[0].expiries.Len())
+	})
+
+	t.Run("大容量时分片且总数不超过上限", func(t *testing.T) {
+		set := newRevocationSet(revocationShardCount * minEntriesPerShard)
+		assert.Len(t, set.shards, revocationShardCount)
+
+		now := time.Now()
+		for i := 0; i < 3*set.Cap(); i++ {
+			set.Add(fmt.Sprintf("token-%d", i), now, now.Add(time.Duration(i)*time.Second))
+		}
+		assert.LessOrEqual(t, set.Len(), set.Cap())
+	})
+
+	t.Run("并发读写", func(t *testing.T) {
+		// 配合 go test -race 验证分片锁的正确性
+		service := NewJWTService(&JWTConfig{
+			SecretKey:         "test-secret-key",
+			DefaultExpiration: time.Hour,
+		})
+
+		tokens := make([]string, 0, 50)
+		for i := 0; i < 50; i++ {
+			token, err := service.GenerateToken(uint(i%5 + 1))
+			assert.NoError(t, err)
+			tokens = append(tokens, token)
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for _, token := range tokens {
+					service.ValidateToken(token)
+				}
+			}()
+		}
+		for userID := uint(1); userID <= 5; userID++ {
+			wg.Add(1)
+			go func(userID uint) {
+				defer wg.Done()
+				assert.NoError(t, service.RevokeAllUserTokens(userID))
+			}(userID)
+		}
+		wg.Wait()
+
+		// 所有Token最终都应被撤销
+		for _, token := range tokens {
+			assert.True(t, service.IsTokenRevoked(token))
+			_, err := service.ValidateToken(token)
+			assert.Error(t, err)
+		}
+	})
+}
+
+// singleLockRevocationSet 单锁撤销集合，作为基准测试的对照
+type singleLockRevocationSet struct {
+	tokens map[string]time.Time
+	mutex  sync.RWMutex
+}
+
+func (r *singleLockRevocationSet) Add(tokenString string, revokedAt time.Time) {
+	r.mutex.Lock()
+	r.tokens[tokenString] = revokedAt
+	r.mutex.Unlock()
+}
+
+func (r *singleLockRevocationSet) Contains(tokenString string) bool {
+	r.mutex.RLock()
+	_, revoked := r.tokens[tokenString]
+	r.mutex.RUnlock()
+	return revoked
+}
+
+// benchmarkRevocationContains 并发检查撤销状态，同时后台持续批量撤销
+func benchmarkRevocationContains(b *testing.B, add func(string, time.Time), contains func(string) bool) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("token-%d", i)
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			// 模拟RevokeAllUserTokens的批量写入
+			now := time.Now()
+			for j := 0; j < 100; j++ {
+				add(fmt.Sprintf("revoked-%d-%d", i, j), now)
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			contains(keys[i%len(keys)])
+			i++
+		}
+	})
+	b.StopTimer()
+
+	close(stop)
+	wg.Wait()
+}
+
+func BenchmarkRevocationSetContains(b *testing.B) {
+	b.Run("分片锁", func(b *testing.B) {
+		set := newRevocationSet(0)
+		add := func(tokenString string, revokedAt time.Time) {
+			set.Add(tokenString, revokedAt, revokedAt.Add(time.Hour))
+		}
+		benchmarkRevocationContains(b, add, set.Contains)
+	})
+
+	b.Run("单锁", func(b *testing.B) {
+		set := &singleLockRevocationSet{tokens: make(map[string]time.Time)}
+		benchmarkRevocationContains(b, set.Add, set.Contains)
+	})
+}
+
+func BenchmarkJWTServiceValidateTokenParallel(b *testing.B) {
+	service := NewJWTService(&JWTConfig{
+		SecretKey:         "test-secret-key",
+		DefaultExpiration: time.Hour,
+	})
+
+	token, err := service.GenerateToken(1)
+	if err != nil {
+		b.Fatalf("生成Token失败: %v", err)
+	}
+
+	// 后台不断为其他用户签发并批量撤销Token
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			for i := 0; i < 20; i++ {
+				service.GenerateToken(2)
+			}
+			service.RevokeAllUserTokens(2)
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := service.ValidateToken(token); err != nil {
+				b.Errorf("验证Token失败: %v", err)
+			}
+		}
+	})
+	b.StopTimer()
+
+	close(stop)
+	wg.Wait()
+}
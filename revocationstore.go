@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRevocationStoreFull 内存撤销存储已满且没有过期记录可清除，撤销未能记录
+var ErrRevocationStoreFull = errors.New("撤销记录已达容量上限")
+
+// TokenRevocationStore Token撤销记录存储接口，多实例部署时应使用共享存储（如RedisTokenRevocationStore）
+//
+// 记录按JTI保存，expiresAt为记录需要保留到的时间（Token过期时间加过期宽限期），之后记录可以丢弃。
+type TokenRevocationStore interface {
+	// 撤销JTI，重复撤销不返回错误
+	Revoke(jti string, expiresAt time.Time) error
+	// 检查JTI是否已撤销
+	IsRevoked(jti string) (bool, error)
+	// 撤销尚未撤销的JTI，检查与写入是原子的，返回false表示此前已撤销；刷新Token时用于保证同一Token只能轮换一次
+	Consume(jti string, expiresAt time.Time) (bool, error)
+	// 签发Token时记录JTI所属用户，供RevokeAllForUser使用
+	Track(userID uint, jti string, expiresAt time.Time) error
+	// 撤销用户已记录的全部未过期JTI
+	RevokeAllForUser(userID uint) error
+	// 清除已过期的记录，自行按TTL过期的存储可以不做处理
+	Cleanup() error
+}
+
+// MemoryTokenRevocationStore 内存撤销记录存储，容量有界，只在单个实例内有效
+type MemoryTokenRevocationStore struct {
+	revoked  *revocationSet
+	clock    Clock
+	mutex    sync.Mutex
+	tracked  map[uint]map[string]time.Time // 用户ID -> 未撤销的JTI及其保留时间
+	jtiUsers map[string]uint               // JTI -> 用户ID
+}
+
+// NewMemoryTokenRevocationStore 创建最多保存maxEntries条撤销记录的内存存储，maxEntries不大于0时为默认值，clock为nil时使用系统时间
+func NewMemoryTokenRevocationStore(maxEntries int, clock Clock) *MemoryTokenRevocationStore {
+	return &MemoryTokenRevocationStore{
+		revoked:  newRevocationSet(maxEntries),
+		clock:    clockOrDefault(clock),
+		tracked:  make(map[uint]map[string]time.Time),
+		jtiUsers: make(map[string]uint),
+	}
+}
+
+// Revoke 撤销JTI，写满且没有过期记录可清除时返回ErrRevocationStoreFull，JTI仍保留在用户记录中
+func (s *MemoryTokenRevocationStore) Revoke(jti string, expiresAt time.Time) error {
+	if !s.revoked.Add(jti, s.clock.Now(), expiresAt) {
+		return ErrRevocationStoreFull
+	}
+
+	s.mutex.Lock()
+	s.untrack(jti)
+	s.mutex.Unlock()
+	return nil
+}
+
+// IsRevoked 检查JTI是否已撤销
+func (s *MemoryTokenRevocationStore) IsRevoked(jti string) (bool, error) {
+	return s.revoked.Contains(jti), nil
+}
+
+// Consume 撤销尚未撤销的JTI，返回是否由本次调用撤销，写满时返回ErrRevocationStoreFull
+func (s *MemoryTokenRevocationStore) Consume(jti string, expiresAt time.Time) (bool, error) {
+	added, full := s.revoked.AddIfAbsent(jti, s.clock.Now(), expiresAt)
+	if full {
+		return false, ErrRevocationStoreFull
+	}
+	if !added {
+		return false, nil
+	}
+
+	s.mutex.Lock()
+	s.untrack(jti)
+	s.mutex.Unlock()
+	return true, nil
+}
+
+// Track 记录JTI所属用户
+func (s *MemoryTokenRevocationStore) Track(userID uint, jti string, expiresAt time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.tracked[userID] == nil {
+		s.tracked[userID] = make(map[string]time.Time)
+	}
+	s.tracked[userID][jti] = expiresAt
+	s.jtiUsers[jti] = userID
+	return nil
+}
+
+// RevokeAllForUser 撤销用户已记录的全部JTI，写满时返回ErrRevocationStoreFull，未能撤销的JTI重新加入用户记录以便重试
+func (s *MemoryTokenRevocationStore) RevokeAllForUser(userID uint) error {
+	s.mutex.Lock()
+	jtis := s.tracked[userID]
+	delete(s.tracked, userID)
+	for jti := range jtis {
+		delete(s.jtiUsers, jti)
+	}
+	s.mutex.Unlock()
+
+	now := s.clock.Now()
+	dropped := make(map[string]time.Time)
+	for jti, expiresAt := range jtis {
+		if !s.revoked.Add(jti, now, expiresAt) {
+			dropped[jti] = expiresAt
+		}
+	}
+	if len(dropped) == 0 {
+		return nil
+	}
+
+	for jti, expiresAt := range dropped {
+		s.Track(userID, jti, expiresAt)
+	}
+	return ErrRevocationStoreFull
+}
+
+// Cleanup 清除已过期的撤销记录和用户JTI记录
+func (s *MemoryTokenRevocationStore) Cleanup() error {
+	now := s.clock.Now()
+	s.revoked.DeleteFunc(func(jti string, expiresAt time.Time) bool {
+		return expiresAt.Before(now)
+	})
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, jtis := range s.tracked {
+		for jti, expiresAt := range jtis {
+			if expiresAt.Before(now) {
+				s.untrack(jti)
+			}
+		}
+	}
+	return nil
+}
+
+// untrack 删除JTI的用户记录，调用方需持有锁
+func (s *MemoryTokenRevocationStore) untrack(jti string) {
+	userID, ok := s.jtiUsers[jti]
+	if !ok {
+		return
+	}
+	delete(s.jtiUsers, jti)
+	delete(s.tracked[userID], jti)
+	if len(s.tracked[userID]) == 0 {
+		delete(s.tracked, userID)
+	}
+}
+
+// Len 获取撤销记录数量
+func (s *MemoryTokenRevocationStore) Len() int {
+	return s.revoked.Len()
+}
+
+// Cap 获取撤销记录容量
+func (s *MemoryTokenRevocationStore) Cap() int {
+	return s.revoked.Cap()
+}
+
+// RedisRevocationClient RedisTokenRevocationStore需要的Redis命令，由接入方适配所用的Redis客户端
+type RedisRevocationClient interface {
+	RedisClient
+	// SET key value NX PX ttl，键已存在时不写入并返回false
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	// SADD key member，并把键的过期时间延长到至少ttl（如 PEXPIRE key ttl GT，键没有过期时间时直接设置）
+	SAdd(ctx context.Context, key, member string, ttl time.Duration) error
+	// SMEMBERS key，键不存在时返回空切片
+	SMembers(ctx context.Context, key string) ([]string, error)
+}
+
+// RedisTokenRevocationStore 基于Redis的撤销记录存储，多个实例共享，撤销对所有实例立即生效
+//
+// 撤销记录的TTL等于其剩余保留时间，由Redis自动过期，不需要定期清理。
+type RedisTokenRevocationStore struct {
+	client  RedisRevocationClient
+	prefix  string        // 键前缀，用于与其他应用共用Redis
+	timeout time.Duration // 单条命令超时
+	clock   Clock
+}
+
+// NewRedisTokenRevocationStore 创建Redis撤销记录存储，键前缀为prefix，单条命令超时为timeout（不大于0时为1秒），clock为nil时使用系统时间
+func NewRedisTokenRevocationStore(client RedisRevocationClient, prefix string, timeout time.Duration, clock Clock) *RedisTokenRevocationStore {
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	return &RedisTokenRevocationStore{client: client, prefix: prefix, timeout: timeout, clock: clockOrDefault(clock)}
+}
+
+// revokedKey 撤销记录键
+func (s *RedisTokenRevocationStore) revokedKey(jti string) string {
+	return s.prefix + "auth:revoked:" + jti
+}
+
+// userKey 用户JTI集合键
+func (s *RedisTokenRevocationStore) userKey(userID uint) string {
+	return fmt.Sprintf("%sauth:user_jtis:%d", s.prefix, userID)
+}
+
+// Revoke 写入撤销记录，已过期的记录不再写入
+func (s *RedisTokenRevocationStore) Revoke(jti string, expiresAt time.Time) error {
+	ttl := expiresAt.Sub(s.clock.Now())
+	if ttl <= 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	return s.client.Set(ctx, s.revokedKey(jti), []byte("1"), ttl)
+}
+
+// IsRevoked 检查撤销记录是否存在
+func (s *RedisTokenRevocationStore) IsRevoked(jti string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	_, found, err := s.client.Get(ctx, s.revokedKey(jti))
+	return found, err
+}
+
+// Consume 以SET NX写入撤销记录，多个实例同时消费同一JTI时只有一个成功；已过期的记录不再写入，视为已撤销
+func (s *RedisTokenRevocationStore) Consume(jti string, expiresAt time.Time) (bool, error) {
+	ttl := expiresAt.Sub(s.clock.Now())
+	if ttl <= 0 {
+		return false, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	return s.client.SetNX(ctx, s.revokedKey(jti), []byte("1"), ttl)
+}
+
+// Track 把JTI及其保留时间加入用户的JTI集合，集合随最晚过期的JTI一起过期
+func (s *RedisTokenRevocationStore) Track(userID uint, jti string, expiresAt time.Time) error {
+	ttl := expiresAt.Sub(s.clock.Now())
+	if ttl <= 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	member := jti + "|" + strconv.FormatInt(expiresAt.UnixNano(), 10)
+	return s.client.SAdd(ctx, s.userKey(userID), member, ttl)
+}
+
+// RevokeAllForUser 撤销用户集合中全部未过期的JTI
+func (s *RedisTokenRevocationStore) RevokeAllForUser(userID uint) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	members, err := s.client.SMembers(ctx, s.userKey(userID))
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		jti, nanos, ok := strings.Cut(member, "|")
+		if !ok {
+			continue
+		}
+		unixNano, err := strconv.ParseInt(nanos, 10, 64)
+		if err != nil {
+			continue
+		}
+		if err := s.Revoke(jti, time.Unix(0, unixNano)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Cleanup 撤销记录由Redis按TTL过期，不需要清理
+func (s *RedisTokenRevocationStore) Cleanup() error {
+	return nil
+}
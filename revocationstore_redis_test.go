@@ -0,0 +1,199 @@
+//go:build redis
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 需要真实Redis：REDIS_ADDR=localhost:6379 go test -tags redis -run Redis ./...
+
+// respClient 只实现测试所需命令的RESP客户端
+type respClient struct {
+	mutex  sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialRedis(t *testing.T) *respClient {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("未设置REDIS_ADDR，跳过Redis测试")
+	}
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		t.Skipf("无法连接Redis: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &respClient{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// do 发送命令并读取一个回复
+func (c *respClient) do(ctx context.Context, args ...string) (interface{}, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetDeadline(deadline)
+	}
+	command := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		command += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.conn.Write([]byte(command)); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+// readReply 读取一个RESP回复，空值返回nil
+func (c *respClient) readReply() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, errors.New("无效的RESP回复")
+	}
+	payload := line[1 : len(line)-2]
+	switch line[0] {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, errors.New(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(payload)
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(payload)
+		if err != nil || count < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, count)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("未知的RESP类型: %q", line[0])
+}
+
+func (c *respClient) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := c.do(ctx, "GET", key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	return []byte(reply.(string)), true, nil
+}
+
+func (c *respClient) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := c.do(ctx, "SET", key, string(value), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+func (c *respClient) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	reply, err := c.do(ctx, "SET", key, string(value), "NX", "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return reply != nil, err
+}
+
+func (c *respClient) Del(ctx context.Context, key string) error {
+	_, err := c.do(ctx, "DEL", key)
+	return err
+}
+
+func (c *respClient) SAdd(ctx context.Context, key, member string, ttl time.Duration) error {
+	if _, err := c.do(ctx, "SADD", key, member); err != nil {
+		return err
+	}
+	// 兼容不支持PEXPIRE GT的Redis 6：只在剩余时间更短时延长
+	reply, err := c.do(ctx, "PTTL", key)
+	if err != nil {
+		return err
+	}
+	if remaining := reply.(int64); remaining < 0 || remaining < ttl.Milliseconds() {
+		_, err = c.do(ctx, "PEXPIRE", key, strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	return err
+}
+
+func (c *respClient) SMembers(ctx context.Context, key string) ([]string, error) {
+	reply, err := c.do(ctx, "SMEMBERS", key)
+	if err != nil {
+		return nil, err
+	}
+	members := []string{}
+	for _, item := range reply.([]interface{}) {
+		members = append(members, item.(string))
+	}
+	return members, nil
+}
+
+func TestRedisTokenRevocationStoreIntegration(t *testing.T) {
+	client := dialRedis(t)
+	prefix := fmt.Sprintf("test:%d:", time.Now().UnixNano())
+	store := NewRedisTokenRevocationStore(client, prefix, 0, nil)
+
+	t.Run("撤销记录按剩余时间过期", func(t *testing.T) {
+		assert.NoError(t, store.Revoke("jti-1", time.Now().Add(200*time.Millisecond)))
+		revoked, err := store.IsRevoked("jti-1")
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+
+		time.Sleep(300 * time.Millisecond)
+		revoked, err = store.IsRevoked("jti-1")
+		assert.NoError(t, err)
+		assert.False(t, revoked)
+	})
+
+	t.Run("撤销用户全部JTI", func(t *testing.T) {
+		assert.NoError(t, store.Track(1, "a", time.Now().Add(time.Minute)))
+		assert.NoError(t, store.Track(1, "b", time.Now().Add(time.Minute)))
+		assert.NoError(t, store.RevokeAllForUser(1))
+
+		for _, jti := range []string{"a", "b"} {
+			revoked, err := store.IsRevoked(jti)
+			assert.NoError(t, err)
+			assert.True(t, revoked, jti)
+		}
+		client.Del(context.Background(), prefix+"auth:revoked:a")
+		client.Del(context.Background(), prefix+"auth:revoked:b")
+		client.Del(context.Background(), prefix+"auth:user_jtis:1")
+	})
+
+	t.Run("多个JWT服务实例共享撤销记录", func(t *testing.T) {
+		config := func() *JWTConfig {
+			return &JWTConfig{SecretKey: "shared-secret-key", DefaultExpiration: time.Minute, RevocationStore: store}
+		}
+		instanceA := NewJWTService(config())
+		instanceB := NewJWTService(config())
+
+		token, err := instanceA.GenerateToken(2)
+		assert.NoError(t, err)
+		assert.NoError(t, instanceB.RevokeAllUserTokens(2))
+		_, err = instanceA.ValidateToken(token)
+		assert.Error(t, err)
+	})
+}
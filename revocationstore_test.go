@@ -0,0 +1,465 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRevocationRedis 测试用内存Redis客户端，按FakeClock计算TTL
+type fakeRevocationRedis struct {
+	clock   *FakeClock
+	mutex   sync.Mutex
+	values  map[string][]byte
+	sets    map[string]map[string]bool
+	expires map[string]time.Time
+	down    bool // 为true时所有命令返回错误
+}
+
+func newFakeRevocationRedis(clock *FakeClock) *fakeRevocationRedis {
+	return &fakeRevocationRedis{
+		clock:   clock,
+		values:  make(map[string][]byte),
+		sets:    make(map[string]map[string]bool),
+		expires: make(map[string]time.Time),
+	}
+}
+
+// expire 删除已过期的键，调用方需持有锁
+func (c *fakeRevocationRedis) expire(key string) {
+	if expiresAt, ok := c.expires[key]; ok && !c.clock.Now().Before(expiresAt) {
+		delete(c.values, key)
+		delete(c.sets, key)
+		delete(c.expires, key)
+	}
+}
+
+func (c *fakeRevocationRedis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.down {
+		return nil, false, errors.New("redis down")
+	}
+	c.expire(key)
+	value, ok := c.values[key]
+	return value, ok, nil
+}
+
+func (c *fakeRevocationRedis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.down {
+		return errors.New("redis down")
+	}
+	c.values[key] = value
+	c.expires[key] = c.clock.Now().Add(ttl)
+	return nil
+}
+
+func (c *fakeRevocationRedis) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.down {
+		return false, errors.New("redis down")
+	}
+	c.expire(key)
+	if _, exists := c.values[key]; exists {
+		return false, nil
+	}
+	c.values[key] = value
+	c.expires[key] = c.clock.Now().Add(ttl)
+	return true, nil
+}
+
+func (c *fakeRevocationRedis) Del(ctx context.Context, key string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.values, key)
+	delete(c.sets, key)
+	delete(c.expires, key)
+	return nil
+}
+
+func (c *fakeRevocationRedis) SAdd(ctx context.Context, key, member string, ttl time.Duration) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.down {
+		return errors.New("redis down")
+	}
+	c.expire(key)
+	if c.sets[key] == nil {
+		c.sets[key] = make(map[string]bool)
+	}
+	c.sets[key][member] = true
+	if expiresAt := c.clock.Now().Add(ttl); expiresAt.After(c.expires[key]) {
+		c.expires[key] = expiresAt
+	}
+	return nil
+}
+
+func (c *fakeRevocationRedis) SMembers(ctx context.Context, key string) ([]string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.down {
+		return nil, errors.New("redis down")
+	}
+	c.expire(key)
+	members := []string{}
+	for member := range c.sets[key] {
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+func TestMemoryTokenRevocationStore(t *testing.T) {
+	t.Run("撤销和清理", func(t *testing.T) {
+		clock := NewFakeClock(time.Time{})
+		store := NewMemoryTokenRevocationStore(0, clock)
+		assert.NoError(t, store.Revoke("jti-1", clock.Now().Add(time.Minute)))
+
+		revoked, err := store.IsRevoked("jti-1")
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+		revoked, _ = store.IsRevoked("jti-2")
+		assert.False(t, revoked)
+
+		clock.Advance(time.Minute)
+		assert.NoError(t, store.Cleanup())
+		revoked, _ = store.IsRevoked("jti-1")
+		assert.True(t, revoked, "到期时刻仍保留")
+
+		clock.Advance(time.Second)
+		assert.NoError(t, store.Cleanup())
+		revoked, _ = store.IsRevoked("jti-1")
+		assert.False(t, revoked)
+		assert.Equal(t, 0, store.Len())
+	})
+
+	t.Run("消费JTI只成功一次", func(t *testing.T) {
+		clock := NewFakeClock(time.Time{})
+		store := NewMemoryTokenRevocationStore(0, clock)
+		expiresAt := clock.Now().Add(time.Hour)
+		store.Track(1, "a", expiresAt)
+
+		consumed, err := store.Consume("a", expiresAt)
+		assert.NoError(t, err)
+		assert.True(t, consumed)
+		assert.Empty(t, store.tracked)
+
+		consumed, err = store.Consume("a", expiresAt)
+		assert.NoError(t, err)
+		assert.False(t, consumed)
+
+		store.Revoke("b", expiresAt)
+		consumed, _ = store.Consume("b", expiresAt)
+		assert.False(t, consumed, "已撤销的JTI不能消费")
+	})
+
+	t.Run("撤销用户记录的全部JTI", func(t *testing.T) {
+		clock := NewFakeClock(time.Time{})
+		store := NewMemoryTokenRevocationStore(0, clock)
+		expiresAt := clock.Now().Add(time.Hour)
+		store.Track(1, "a", expiresAt)
+		store.Track(1, "b", expiresAt)
+		store.Track(2, "c", expiresAt)
+
+		assert.NoError(t, store.RevokeAllForUser(1))
+		for jti, want := range map[string]bool{"a": true, "b": true, "c": false} {
+			revoked, _ := store.IsRevoked(jti)
+			assert.Equal(t, want, revoked, jti)
+		}
+
+		// 已撤销的JTI不再保留用户记录
+		store.Revoke("c", expiresAt)
+		assert.Empty(t, store.tracked)
+		assert.Empty(t, store.jtiUsers)
+	})
+
+	t.Run("写满时撤销失败且已撤销的JTI保持撤销", func(t *testing.T) {
+		clock := NewFakeClock(time.Time{})
+		store := NewMemoryTokenRevocationStore(2, clock)
+		store.Track(1, "c", clock.Now().Add(3*time.Hour))
+		assert.NoError(t, store.Revoke("a", clock.Now().Add(time.Minute)))
+		assert.NoError(t, store.Revoke("b", clock.Now().Add(time.Hour)))
+
+		assert.ErrorIs(t, store.Revoke("c", clock.Now().Add(3*time.Hour)), ErrRevocationStoreFull)
+		consumed, err := store.Consume("c", clock.Now().Add(3*time.Hour))
+		assert.ErrorIs(t, err, ErrRevocationStoreFull)
+		assert.False(t, consumed)
+		assert.ErrorIs(t, store.RevokeAllForUser(1), ErrRevocationStoreFull)
+		assert.Contains(t, store.tracked[1], "c", "未能撤销的JTI保留在用户记录中以便重试")
+
+		for _, jti := range []string{"a", "b"} {
+			revoked, _ := store.IsRevoked(jti)
+			assert.True(t, revoked, jti)
+		}
+
+		// 最先过期的记录到期后腾出容量
+		clock.Advance(2 * time.Minute)
+		assert.NoError(t, store.RevokeAllForUser(1))
+		revoked, _ := store.IsRevoked("c")
+		assert.True(t, revoked)
+	})
+
+	t.Run("清理过期的用户记录", func(t *testing.T) {
+		clock := NewFakeClock(time.Time{})
+		store := NewMemoryTokenRevocationStore(0, clock)
+		store.Track(1, "a", clock.Now().Add(time.Minute))
+		store.Track(1, "b", clock.Now().Add(time.Hour))
+
+		clock.Advance(2 * time.Minute)
+		assert.NoError(t, store.Cleanup())
+		assert.Len(t, store.tracked[1], 1)
+		assert.NotContains(t, store.jtiUsers, "a")
+	})
+}
+
+func TestRedisTokenRevocationStore(t *testing.T) {
+	t.Run("撤销记录TTL等于剩余保留时间", func(t *testing.T) {
+		clock := NewFakeClock(time.Time{})
+		client := newFakeRevocationRedis(clock)
+		store := NewRedisTokenRevocationStore(client, "app:", 0, clock)
+
+		assert.NoError(t, store.Revoke("jti-1", clock.Now().Add(time.Minute)))
+		assert.Equal(t, clock.Now().Add(time.Minute), client.expires["app:auth:revoked:jti-1"])
+		revoked, err := store.IsRevoked("jti-1")
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+
+		clock.Advance(time.Minute)
+		revoked, _ = store.IsRevoked("jti-1")
+		assert.False(t, revoked)
+
+		// 已过期的记录不写入
+		assert.NoError(t, store.Revoke("jti-2", clock.Now().Add(-time.Second)))
+		assert.NotContains(t, client.values, "app:auth:revoked:jti-2")
+	})
+
+	t.Run("撤销用户集合中未过期的JTI", func(t *testing.T) {
+		clock := NewFakeClock(time.Time{})
+		client := newFakeRevocationRedis(clock)
+		store := NewRedisTokenRevocationStore(client, "", 0, clock)
+
+		assert.NoError(t, store.Track(1, "short", clock.Now().Add(time.Minute)))
+		assert.NoError(t, store.Track(1, "long", clock.Now().Add(time.Hour)))
+		assert.Equal(t, clock.Now().Add(time.Hour), client.expires["auth:user_jtis:1"], "集合随最晚过期的JTI过期")
+
+		clock.Advance(2 * time.Minute)
+		assert.NoError(t, store.RevokeAllForUser(1))
+		assert.NotContains(t, client.values, "auth:revoked:short")
+		revoked, _ := store.IsRevoked("long")
+		assert.True(t, revoked)
+		assert.Equal(t, clock.Now().Add(58*time.Minute), client.expires["auth:revoked:long"])
+	})
+
+	t.Run("消费JTI使用SET NX", func(t *testing.T) {
+		clock := NewFakeClock(time.Time{})
+		client := newFakeRevocationRedis(clock)
+		store := NewRedisTokenRevocationStore(client, "", 0, clock)
+
+		consumed, err := store.Consume("jti", clock.Now().Add(time.Minute))
+		assert.NoError(t, err)
+		assert.True(t, consumed)
+		assert.Equal(t, clock.Now().Add(time.Minute), client.expires["auth:revoked:jti"])
+
+		consumed, err = store.Consume("jti", clock.Now().Add(time.Minute))
+		assert.NoError(t, err)
+		assert.False(t, consumed)
+	})
+
+	t.Run("Redis不可用时返回错误", func(t *testing.T) {
+		client := newFakeRevocationRedis(NewFakeClock(time.Time{}))
+		client.down = true
+		store := NewRedisTokenRevocationStore(client, "", 0, client.clock)
+
+		_, err := store.IsRevoked("jti")
+		assert.Error(t, err)
+		assert.Error(t, store.RevokeAllForUser(1))
+	})
+}
+
+func TestJWTServiceSharedRevocationStore(t *testing.T) {
+	clock := NewFakeClock(time.Time{})
+	client := newFakeRevocationRedis(clock)
+	newInstance := func() JWTService {
+		return NewJWTService(&JWTConfig{
+			SecretKey:         "shared-secret-key",
+			DefaultExpiration: time.Hour,
+			AllowRefresh:      true,
+			RefreshExpiration: time.Hour,
+			MaxRefreshCount:   5,
+			Clock:             clock,
+			RevocationStore:   NewRedisTokenRevocationStore(client, "", 0, clock),
+		})
+	}
+	instanceA := newInstance()
+	instanceB := newInstance()
+
+	t.Run("一个实例撤销后其他实例立即拒绝", func(t *testing.T) {
+		token, err := instanceA.GenerateToken(1)
+		assert.NoError(t, err)
+		_, err = instanceB.ValidateToken(token)
+		assert.NoError(t, err)
+
+		assert.NoError(t, instanceB.RevokeToken(token))
+		_, err = instanceA.ValidateToken(token)
+		assert.Error(t, err)
+		assert.True(t, instanceA.IsTokenRevoked(token))
+	})
+
+	t.Run("撤销用户全部Token包括其他实例签发的", func(t *testing.T) {
+		tokenA, _ := instanceA.GenerateToken(2)
+		tokenB, _ := instanceB.GenerateToken(2)
+		other, _ := instanceB.GenerateToken(3)
+
+		assert.NoError(t, instanceA.RevokeAllUserTokens(2))
+		_, err := instanceB.ValidateToken(tokenA)
+		assert.Error(t, err)
+		_, err = instanceA.ValidateToken(tokenB)
+		assert.Error(t, err)
+		_, err = instanceA.ValidateToken(other)
+		assert.NoError(t, err)
+	})
+
+	t.Run("重启后撤销记录仍然有效", func(t *testing.T) {
+		revoked, _ := instanceA.GenerateToken(6)
+		live, _ := instanceA.GenerateToken(7)
+		assert.NoError(t, instanceA.RevokeToken(revoked))
+
+		restarted := newInstance()
+		_, err := restarted.ValidateToken(revoked)
+		assert.Error(t, err)
+		_, err = restarted.ValidateToken(live)
+		assert.NoError(t, err)
+
+		// 重启前签发的Token不在新实例的内存中，仍可按用户撤销
+		assert.NoError(t, restarted.RevokeAllUserTokens(7))
+		_, err = restarted.ValidateToken(live)
+		assert.Error(t, err)
+	})
+
+	t.Run("一个实例刷新后其他实例不能再刷新原Token", func(t *testing.T) {
+		token, err := instanceA.GenerateToken(8)
+		assert.NoError(t, err)
+
+		refreshed, err := instanceA.RefreshToken(token)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, refreshed)
+		_, err = instanceB.RefreshToken(token)
+		assert.Error(t, err)
+	})
+
+	t.Run("撤销记录随Token过期", func(t *testing.T) {
+		token, _ := instanceA.GenerateToken(4)
+		assert.NoError(t, instanceA.RevokeToken(token))
+		clock.Advance(time.Hour)
+		assert.False(t, instanceB.IsTokenRevoked(token))
+		assert.Equal(t, 0, instanceA.Stats().RevokedTokens)
+	})
+
+	t.Run("撤销存储不可用时拒绝Token", func(t *testing.T) {
+		client.mutex.Lock()
+		client.down = true
+		client.mutex.Unlock()
+		defer func() {
+			client.mutex.Lock()
+			client.down = false
+			client.mutex.Unlock()
+		}()
+
+		token, err := instanceA.GenerateToken(5)
+		assert.NoError(t, err, "记录用户JTI失败不影响签发")
+		_, err = instanceA.ValidateToken(token)
+		assert.Error(t, err)
+		assert.True(t, instanceA.IsTokenRevoked(token))
+		assert.Error(t, instanceA.RevokeToken(token))
+	})
+}
+
+// gatedRevocationStore 测试用撤销存储，Revoke在release关闭前阻塞，模拟较慢的远程存储
+type gatedRevocationStore struct {
+	TokenRevocationStore
+	entered chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (s *gatedRevocationStore) Revoke(jti string, expiresAt time.Time) error {
+	s.once.Do(func() { close(s.entered) })
+	<-s.release
+	return s.TokenRevocationStore.Revoke(jti, expiresAt)
+}
+
+func TestJWTServiceRevokeOutsideLock(t *testing.T) {
+	newService := func() (JWTService, *gatedRevocationStore) {
+		store := &gatedRevocationStore{
+			TokenRevocationStore: NewMemoryTokenRevocationStore(0, nil),
+			entered:              make(chan struct{}),
+			release:              make(chan struct{}),
+		}
+		return NewJWTService(&JWTConfig{
+			SecretKey:         "test-secret-key",
+			DefaultExpiration: time.Hour,
+			RevocationStore:   store,
+		}), store
+	}
+
+	// assertNotBlocked 撤销存储阻塞期间签发和验证仍能完成
+	assertNotBlocked := func(t *testing.T, service JWTService, live string) {
+		done := make(chan error, 1)
+		go func() {
+			if _, err := service.GenerateToken(99); err != nil {
+				done <- err
+				return
+			}
+			_, err := service.ValidateToken(live)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("撤销存储写入期间签发和验证被阻塞")
+		}
+	}
+
+	t.Run("RevokeAllUserTokens", func(t *testing.T) {
+		service, store := newService()
+		token, _ := service.GenerateToken(1)
+		live, _ := service.GenerateToken(2)
+
+		errCh := make(chan error, 1)
+		go func() { errCh <- service.RevokeAllUserTokens(1) }()
+		<-store.entered
+		assertNotBlocked(t, service, live)
+		close(store.release)
+
+		assert.NoError(t, <-errCh)
+		_, err := service.ValidateToken(token)
+		assert.Error(t, err)
+	})
+
+	t.Run("RevokeByJTIs", func(t *testing.T) {
+		service, store := newService()
+		token, _ := service.GenerateToken(1)
+		live, _ := service.GenerateToken(2)
+		claims, _ := service.ParseToken(token)
+
+		resultCh := make(chan *JTIRevocationResult, 1)
+		go func() {
+			result, _ := service.RevokeByJTIs([]string{claims.JTI})
+			resultCh <- result
+		}()
+		<-store.entered
+		assertNotBlocked(t, service, live)
+		close(store.release)
+
+		assert.Equal(t, 1, (<-resultCh).Revoked)
+		_, err := service.ValidateToken(token)
+		assert.Error(t, err)
+	})
+}
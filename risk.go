@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+// ErrLoginDenied 登录风险评估拒绝了本次登录，具体原因只记录在审计日志中
+var ErrLoginDenied = errors.New("登录存在异常，已被拒绝")
+
+// RiskAction 登录风险评估的处理方式
+type RiskAction string
+
+// 登录风险处理方式
+const (
+	RiskAllow     RiskAction = "allow"     // 允许登录
+	RiskChallenge RiskAction = "challenge" // 需要先完成邮箱验证码挑战
+	RiskDeny      RiskAction = "deny"      // 拒绝登录
+)
+
+// RiskDecision 登录风险评估结果
+type RiskDecision struct {
+	Action RiskAction
+	Reason string // 判定原因，写入审计日志，不返回给用户
+}
+
+// LoginMetadata 本次登录的客户端信息
+type LoginMetadata struct {
+	ClientInfo
+	At time.Time // 登录时间
+}
+
+// LoginAttempt 用户此前的登录记录
+type LoginAttempt struct {
+	IP        string
+	UserAgent string
+	At        time.Time
+}
+
+// LoginRiskAssessor 登录风险评估接口，在密码验证通过后、签发Token前调用，接入方可替换为自己的风控引擎
+type LoginRiskAssessor interface {
+	// history为用户此前的登录记录，按时间倒序
+	Assess(ctx context.Context, user *User, meta LoginMetadata, history []LoginAttempt) RiskDecision
+}
+
+// GeoPoint 地理坐标
+type GeoPoint struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// GeoCoordinateResolver IP地理坐标解析接口，无法解析的IP（如内网地址）返回错误
+//
+// 与GeoResolver分开定义，同一个GeoIP数据库的封装可以同时实现两者。
+type GeoCoordinateResolver interface {
+	Coordinates(ip string) (GeoPoint, error)
+}
+
+// ImpossibleTravelConfig 不可能的旅行检测配置
+type ImpossibleTravelConfig struct {
+	MaxSpeedKmh   float64    // 两次登录之间允许的最大移动速度
+	MinDistanceKm float64    // 低于该距离不判定，容忍GeoIP定位误差
+	Action        RiskAction // 超过速度时的处理方式
+}
+
+// DefaultImpossibleTravelConfig 默认不可能的旅行检测配置：超过民航客机速度时要求挑战
+func DefaultImpossibleTravelConfig() *ImpossibleTravelConfig {
+	return &ImpossibleTravelConfig{
+		MaxSpeedKmh:   1000,
+		MinDistanceKm: 300,
+		Action:        RiskChallenge,
+	}
+}
+
+// ImpossibleTravelAssessor 根据与上一次登录之间的距离和间隔检测不可能的旅行
+//
+// IP无法解析或没有带IP的历史记录时允许登录，风控数据缺失不应阻止正常用户。
+type ImpossibleTravelAssessor struct {
+	resolver GeoCoordinateResolver
+	config   *ImpossibleTravelConfig
+}
+
+// NewImpossibleTravelAssessor 创建不可能的旅行检测器
+func NewImpossibleTravelAssessor(resolver GeoCoordinateResolver, config *ImpossibleTravelConfig) *ImpossibleTravelAssessor {
+	if config == nil {
+		config = DefaultImpossibleTravelConfig()
+	}
+
+	return &ImpossibleTravelAssessor{
+		resolver: resolver,
+		config:   config,
+	}
+}
+
+// Assess 比较本次登录与最近一次带IP的登录记录
+func (a *ImpossibleTravelAssessor) Assess(ctx context.Context, user *User, meta LoginMetadata, history []LoginAttempt) RiskDecision {
+	if meta.IP == "" {
+		return RiskDecision{Action: RiskAllow}
+	}
+
+	var previous *LoginAttempt
+	for i := range history {
+		if history[i].IP != "" && history[i].IP != meta.IP {
+			previous = &history[i]
+			break
+		}
+		if history[i].IP == meta.IP {
+			// 最近一次登录就在同一IP，不需要判定
+			return RiskDecision{Action: RiskAllow}
+		}
+	}
+	if previous == nil {
+		return RiskDecision{Action: RiskAllow}
+	}
+
+	current, err := a.resolver.Coordinates(meta.IP)
+	if err != nil {
+		return RiskDecision{Action: RiskAllow, Reason: fmt.Sprintf("无法解析IP %s: %v", meta.IP, err)}
+	}
+	last, err := a.resolver.Coordinates(previous.IP)
+	if err != nil {
+		return RiskDecision{Action: RiskAllow, Reason: fmt.Sprintf("无法解析IP %s: %v", previous.IP, err)}
+	}
+
+	distance := haversineKm(last, current)
+	if distance < a.config.MinDistanceKm {
+		return RiskDecision{Action: RiskAllow}
+	}
+
+	// 间隔不足一分钟按一分钟计算，避免除以零
+	elapsed := meta.At.Sub(previous.At)
+	if elapsed < time.Minute {
+		elapsed = time.Minute
+	}
+	speed := distance / elapsed.Hours()
+	if speed <= a.config.MaxSpeedKmh {
+		return RiskDecision{Action: RiskAllow}
+	}
+
+	return RiskDecision{
+		Action: a.config.Action,
+		Reason: fmt.Sprintf("不可能的旅行: %s -> %s 相距%.0fkm，间隔%s，速度%.0fkm/h",
+			previous.IP, meta.IP, distance, elapsed.Round(time.Minute), speed),
+	}
+}
+
+// haversineKm 计算两个坐标之间的球面距离（公里）
+func haversineKm(a, b GeoPoint) float64 {
+	const earthRadiusKm = 6371.0
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(b.Latitude - a.Latitude)
+	dLon := toRad(b.Longitude - a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(a.Latitude))*math.Cos(toRad(b.Latitude))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// loginHistory 从已知设备记录构造登录历史，未配置设备跟踪时返回空
+func loginHistory(tracker *DeviceTracker, userID uint) []LoginAttempt {
+	if tracker == nil {
+		return nil
+	}
+
+	devices, err := tracker.ListKnownDevices(userID)
+	if err != nil {
+		log.Printf("读取登录历史失败: user_id=%d err=%v", userID, err)
+		return nil
+	}
+
+	history := make([]LoginAttempt, 0, len(devices))
+	for _, device := range devices {
+		history = append(history, LoginAttempt{IP: device.LastIP, UserAgent: device.UserAgent, At: device.LastSeenAt})
+	}
+	return history
+}
+
+// assessLoginRisk 评估登录风险并记录审计事件，未配置评估器时返回RiskAllow
+func assessLoginRisk(config *AuthConfig, user *User, client ClientInfo) (RiskAction, error) {
+	if config.RiskAssessor == nil {
+		return RiskAllow, nil
+	}
+
+	meta := LoginMetadata{ClientInfo: client, At: time.Now()}
+	decision := config.RiskAssessor.Assess(context.Background(), user, meta, loginHistory(config.DeviceTracker, user.ID))
+	if decision.Action == "" {
+		decision.Action = RiskAllow
+	}
+
+	detail := fmt.Sprintf("decision=%s ip=%s", decision.Action, client.IP)
+	if decision.Reason != "" {
+		detail += " reason=" + decision.Reason
+	}
+	if err := config.AuditLogger.Log(AuditEvent{
+		Type:      AuditEventLoginRiskAssessed,
+		UserID:    user.ID,
+		Detail:    detail,
+		CreatedAt: meta.At,
+	}); err != nil {
+		return "", err
+	}
+
+	switch decision.Action {
+	case RiskAllow, RiskChallenge:
+		return decision.Action, nil
+	default:
+		// 无法识别的处理方式按拒绝处理
+		return RiskDeny, ErrLoginDenied
+	}
+}
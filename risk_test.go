@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubCoordinateResolver 按IP返回预设坐标的解析器
+type stubCoordinateResolver map[string]GeoPoint
+
+func (r stubCoordinateResolver) Coordinates(ip string) (GeoPoint, error) {
+	point, ok := r[ip]
+	if !ok {
+		return GeoPoint{}, errors.New("未知IP")
+	}
+	return point, nil
+}
+
+// scriptedRiskAssessor 返回预设结果并记录收到的登录历史
+type scriptedRiskAssessor struct {
+	decision RiskDecision
+	history  []LoginAttempt
+}
+
+func (a *scriptedRiskAssessor) Assess(ctx context.Context, user *User, meta LoginMetadata, history []LoginAttempt) RiskDecision {
+	a.history = history
+	return a.decision
+}
+
+func TestImpossibleTravelAssessor(t *testing.T) {
+	resolver := stubCoordinateResolver{
+		"198.51.100.1": {Latitude: 31.23, Longitude: 121.47}, // 上海
+		"198.51.100.2": {Latitude: 31.30, Longitude: 121.50}, // 上海附近
+		"203.0.113.9":  {Latitude: 40.71, Longitude: -74.01}, // 纽约
+	}
+	assessor := NewImpossibleTravelAssessor(resolver, nil)
+	user := &User{}
+	now := time.Now()
+	meta := LoginMetadata{ClientInfo: ClientInfo{IP: "203.0.113.9"}, At: now}
+
+	t.Run("没有历史记录时允许", func(t *testing.T) {
+		decision := assessor.Assess(context.Background(), user, meta, nil)
+		assert.Equal(t, RiskAllow, decision.Action)
+	})
+
+	t.Run("一小时内从上海到纽约要求挑战", func(t *testing.T) {
+		history := []LoginAttempt{{IP: "198.51.100.1", At: now.Add(-time.Hour)}}
+		decision := assessor.Assess(context.Background(), user, meta, history)
+		assert.Equal(t, RiskChallenge, decision.Action)
+		assert.Contains(t, decision.Reason, "198.51.100.1")
+	})
+
+	t.Run("间隔足够长时允许", func(t *testing.T) {
+		history := []LoginAttempt{{IP: "198.51.100.1", At: now.Add(-20 * time.Hour)}}
+		decision := assessor.Assess(context.Background(), user, meta, history)
+		assert.Equal(t, RiskAllow, decision.Action)
+	})
+
+	t.Run("距离低于定位误差时允许", func(t *testing.T) {
+		nearby := LoginMetadata{ClientInfo: ClientInfo{IP: "198.51.100.2"}, At: now}
+		history := []LoginAttempt{{IP: "198.51.100.1", At: now.Add(-time.Minute)}}
+		decision := assessor.Assess(context.Background(), user, nearby, history)
+		assert.Equal(t, RiskAllow, decision.Action)
+	})
+
+	t.Run("无法解析IP时允许并记录原因", func(t *testing.T) {
+		unknown := LoginMetadata{ClientInfo: ClientInfo{IP: "192.0.2.1"}, At: now}
+		history := []LoginAttempt{{IP: "198.51.100.1", At: now.Add(-time.Hour)}}
+		decision := assessor.Assess(context.Background(), user, unknown, history)
+		assert.Equal(t, RiskAllow, decision.Action)
+		assert.NotEmpty(t, decision.Reason)
+	})
+
+	t.Run("可配置为直接拒绝", func(t *testing.T) {
+		config := DefaultImpossibleTravelConfig()
+		config.Action = RiskDeny
+		strict := NewImpossibleTravelAssessor(resolver, config)
+
+		history := []LoginAttempt{{IP: "198.51.100.1", At: now.Add(-time.Hour)}}
+		decision := strict.Assess(context.Background(), user, meta, history)
+		assert.Equal(t, RiskDeny, decision.Action)
+	})
+}
+
+func TestLoginRiskAssessment(t *testing.T) {
+	// 设置测试数据库
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	userService := NewUserService(testDB.DB)
+	tokenService := NewTokenService("test-secret-key", time.Hour)
+	password := "testpassword123"
+	client := ClientInfo{IP: "203.0.113.9", UserAgent: "Mozilla/5.0", DeviceID: "device-2"}
+
+	// newServices 创建使用指定评估器并启用登录挑战的服务
+	newServices := func(assessor LoginRiskAssessor, auditLogger AuditLogger) (AuthService, LoginService) {
+		config := DefaultAuthConfig()
+		config.RiskAssessor = assessor
+		config.AuditLogger = auditLogger
+		config.DeviceTracker = NewDeviceTracker(NewMemoryKnownDeviceStorage(), nil, nil, nil)
+		authService := NewAuthServiceWithConfig(testDB.DB, userService, tokenService, config)
+
+		codes := NewVerificationCodeService(NewMemoryVerificationCodeStorage(), nil)
+		challenger := NewLoginChallenger(nil, NewMemoryRateLimitStore(), nil, codes)
+		return authService, NewLoginServiceWithChallenger(testDB.DB, userService, tokenService, authService, challenger)
+	}
+
+	// riskEvent 返回最后一条风险评估审计事件
+	riskEvent := func(t *testing.T, auditLogger *MemoryAuditLogger) AuditEvent {
+		var found AuditEvent
+		for _, event := range auditLogger.Events() {
+			if event.Type == AuditEventLoginRiskAssessed {
+				found = event
+			}
+		}
+		assert.Equal(t, AuditEventLoginRiskAssessed, found.Type)
+		return found
+	}
+
+	t.Run("允许时正常登录并传入登录历史", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		assessor := &scriptedRiskAssessor{decision: RiskDecision{Action: RiskAllow}}
+		auditLogger := NewMemoryAuditLogger()
+		_, service := newServices(assessor, auditLogger)
+		user := testDB.CreateTestUser("testuser", "test@example.com", password)
+
+		_, token, err := service.LoginWithClient("testuser", password, client)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, token)
+		assert.Empty(t, assessor.history)
+
+		// 第二次登录时收到上一次登录的记录
+		_, _, err = service.LoginWithClient("testuser", password, client)
+		assert.NoError(t, err)
+		assert.Len(t, assessor.history, 1)
+		assert.Equal(t, client.IP, assessor.history[0].IP)
+
+		event := riskEvent(t, auditLogger)
+		assert.Equal(t, user.ID, event.UserID)
+		assert.Contains(t, event.Detail, "decision=allow")
+	})
+
+	t.Run("拒绝时返回统一错误，原因只写入审计日志", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		assessor := &scriptedRiskAssessor{decision: RiskDecision{Action: RiskDeny, Reason: "黑名单IP"}}
+		auditLogger := NewMemoryAuditLogger()
+		authService, service := newServices(assessor, auditLogger)
+		testDB.CreateTestUser("testuser", "test@example.com", password)
+
+		_, token, err := service.LoginWithClient("testuser", password, client)
+		assert.True(t, errors.Is(err, ErrLoginDenied))
+		assert.Empty(t, token)
+		assert.False(t, strings.Contains(err.Error(), "黑名单IP"))
+
+		_, _, err = authService.LoginWithClient("testuser", password, client)
+		assert.True(t, errors.Is(err, ErrLoginDenied))
+
+		event := riskEvent(t, auditLogger)
+		assert.Contains(t, event.Detail, "decision=deny")
+		assert.Contains(t, event.Detail, "reason=黑名单IP")
+	})
+
+	t.Run("要求挑战时完成邮箱验证码后才能登录", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		assessor := &scriptedRiskAssessor{decision: RiskDecision{Action: RiskChallenge, Reason: "不可能的旅行"}}
+		auditLogger := NewMemoryAuditLogger()
+		authService, service := newServices(assessor, auditLogger)
+		testDB.CreateTestUser("testuser", "test@example.com", password)
+
+		_, _, err := service.LoginWithClient("testuser", password, client)
+		var challengeErr *ChallengeRequiredError
+		assert.True(t, errors.As(err, &challengeErr))
+		assert.Equal(t, ChallengeEmailCode, challengeErr.Challenge)
+
+		// AuthService没有挑战流程，同样要求挑战
+		_, _, err = authService.LoginWithClient("testuser", password, client)
+		assert.True(t, errors.Is(err, ErrChallengeRequired))
+
+		code, err := service.IssueEmailChallenge("testuser")
+		assert.NoError(t, err)
+		assert.NoError(t, service.VerifyEmailChallenge("testuser", code))
+
+		_, token, err := service.LoginWithClient("testuser", password, client)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, token)
+
+		// 完成的挑战只能使用一次
+		_, _, err = service.LoginWithClient("testuser", password, client)
+		assert.True(t, errors.Is(err, ErrChallengeRequired))
+
+		event := riskEvent(t, auditLogger)
+		assert.Contains(t, event.Detail, "decision=challenge")
+		assert.Contains(t, event.Detail, "reason=不可能的旅行")
+	})
+}
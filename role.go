@@ -2,9 +2,11 @@ package main
 
 import (
 	"errors"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // Role 角色模型
@@ -63,6 +65,26 @@ func (RolePermission) TableName() string {
 	return "sys_role_permissions"
 }
 
+// 用户管理权限
+const (
+	// PermissionResourceUser 用户资源
+	PermissionResourceUser = "user"
+	// PermissionActionRead 查看用户信息的操作，管理后台用户列表需要该权限
+	PermissionActionRead = "read"
+	// PermissionActionReadDeleted 查看已删除用户的操作，管理后台列出软删除用户时需要该权限
+	PermissionActionReadDeleted = "read_deleted"
+	// PermissionActionReadPII 查看用户完整邮箱和手机号的操作，没有该权限时返回脱敏数据
+	PermissionActionReadPII = "read_pii"
+	// PermissionActionExport 导出用户全部个人数据的操作，用于响应数据主体访问请求
+	PermissionActionExport = "export"
+)
+
+// 角色错误定义，同时匹配gorm.ErrRecordNotFound以兼容已有调用方
+var (
+	ErrRoleNotFound       = errors.New("角色不存在")
+	ErrPermissionNotFound = errors.New("权限不存在")
+)
+
 // RoleService 角色服务接口
 type RoleService interface {
 	// 角色管理
@@ -72,16 +94,21 @@ type RoleService interface {
 	UpdateRole(role *Role) error
 	DeleteRole(id uint) error
 	ListRoles(page, pageSize int) ([]*Role, int64, error)
+	SearchRoles(filter RoleFilter, page, pageSize int) (*Page[*Role], error)
 
 	// 权限管理
 	CreatePermission(permission *Permission) error
+	UpdatePermission(permission *Permission) error
 	GetPermissionByID(id uint) (*Permission, error)
 	ListPermissions(page, pageSize int) ([]*Permission, int64, error)
+	ListResources() ([]ResourceSummary, error)
+	ValidateExistingPermissions() ([]PermissionNamingViolation, error)
 
 	// 角色权限关联
 	AssignPermissionToRole(roleID, permissionID uint) error
 	RemovePermissionFromRole(roleID, permissionID uint) error
 	GetRolePermissions(roleID uint) ([]*Permission, error)
+	GetPermissionsForRoles(roleIDs []uint) (map[uint][]*Permission, error)
 
 	// 用户角色关联
 	AssignRoleToUser(userID, roleID uint) error
@@ -89,19 +116,32 @@ type RoleService interface {
 	GetUserRoles(userID uint) ([]*Role, error)
 	GetUsersWithRole(roleID uint) ([]*User, error)
 
-	// 权限验证
+	// 权限验证，资源和操作不区分大小写
 	HasPermission(userID uint, resource, action string) (bool, error)
+	HasPermissionOnPath(userID uint, path, action string) (bool, error)
 	HasRole(userID uint, roleName string) (bool, error)
 }
 
+// RoleFilter 角色列表过滤条件，零值表示不过滤
+type RoleFilter struct {
+	NameContains string // 角色名或显示名包含的关键字
+	Status       *uint8 // 角色状态，为nil时不限
+}
+
 // roleService 角色服务实现
 type roleService struct {
-	db *gorm.DB
+	db           *gorm.DB
+	namingPolicy *PermissionNamingPolicy // 权限命名规范，为nil时不校验
 }
 
-// NewRoleService 创建角色服务实例
+// NewRoleService 创建角色服务实例，使用默认权限命名规范
 func NewRoleService(db *gorm.DB) RoleService {
-	return &roleService{db: db}
+	return NewRoleServiceWithNamingPolicy(db, DefaultPermissionNamingPolicy())
+}
+
+// NewRoleServiceWithNamingPolicy 创建使用指定权限命名规范的角色服务实例，policy为nil时不校验
+func NewRoleServiceWithNamingPolicy(db *gorm.DB, policy *PermissionNamingPolicy) RoleService {
+	return &roleService{db: db, namingPolicy: policy}
 }
 
 // CreateRole 创建角色
@@ -122,7 +162,7 @@ func (s *roleService) CreateRole(role *Role) error {
 func (s *roleService) GetRoleByID(id uint) (*Role, error) {
 	var role Role
 	if err := s.db.First(&role, id).Error; err != nil {
-		return nil, err
+		return nil, wrapNotFound(err, ErrRoleNotFound)
 	}
 	return &role, nil
 }
@@ -131,7 +171,7 @@ func (s *roleService) GetRoleByID(id uint) (*Role, error) {
 func (s *roleService) GetRoleByName(name string) (*Role, error) {
 	var role Role
 	if err := s.db.Where("name = ?", name).First(&role).Error; err != nil {
-		return nil, err
+		return nil, wrapNotFound(err, ErrRoleNotFound)
 	}
 	return &role, nil
 }
@@ -143,22 +183,37 @@ func (s *roleService) UpdateRole(role *Role) error {
 
 // DeleteRole 删除角色
 func (s *roleService) DeleteRole(id uint) error {
-	// 检查是否有用户使用该角色
-	var count int64
-	s.db.Model(&UserRole{}).Where("role_id = ?", id).Count(&count)
-	if count > 0 {
-		return errors.New("该角色正在被使用，无法删除")
-	}
-
-	// 删除角色权限关联
-	s.db.Where("role_id = ?", id).Delete(&RolePermission{})
-
-	// 删除角色
-	return s.db.Delete(&Role{}, id).Error
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// 检查是否有用户使用该角色
+		var count int64
+		if err := tx.Model(&UserRole{}).Where("role_id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errors.New("该角色正在被使用，无法删除")
+		}
+
+		// 删除角色权限关联
+		if err := tx.Where("role_id = ?", id).Delete(&RolePermission{}).Error; err != nil {
+			return err
+		}
+
+		// 删除角色
+		return tx.Delete(&Role{}, id).Error
+	})
 }
 
 // ListRoles 分页获取角色列表
 func (s *roleService) ListRoles(page, pageSize int) ([]*Role, int64, error) {
+	result, err := s.SearchRoles(RoleFilter{}, page, pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	return result.Items, result.Total, nil
+}
+
+// SearchRoles 按过滤条件分页获取角色列表，总数与过滤条件一致
+func (s *roleService) SearchRoles(filter RoleFilter, page, pageSize int) (*Page[*Role], error) {
 	if page <= 0 {
 		page = 1
 	}
@@ -169,20 +224,55 @@ func (s *roleService) ListRoles(page, pageSize int) ([]*Role, int64, error) {
 	var roles []*Role
 	var total int64
 
-	if err := s.db.Model(&Role{}).Count(&total).Error; err != nil {
-		return nil, 0, err
+	// 获取总数
+	if err := s.roleFilterQuery(filter).Model(&Role{}).Count(&total).Error; err != nil {
+		return nil, err
 	}
 
+	// 分页查询
 	offset := (page - 1) * pageSize
-	if err := s.db.Offset(offset).Limit(pageSize).Find(&roles).Error; err != nil {
-		return nil, 0, err
+	if err := s.roleFilterQuery(filter).Order("id").Offset(offset).Limit(pageSize).Find(&roles).Error; err != nil {
+		return nil, err
 	}
 
-	return roles, total, nil
+	return &Page[*Role]{Items: roles, Total: total, Page: page, PageSize: pageSize}, nil
+}
+
+// roleFilterQuery 根据过滤条件构建角色查询
+func (s *roleService) roleFilterQuery(filter RoleFilter) *gorm.DB {
+	query := s.db
+	if keyword := strings.TrimSpace(filter.NameContains); keyword != "" {
+		pattern := "%" + likeEscaper.Replace(keyword) + "%"
+		query = query.Where("(name LIKE ? OR display_name LIKE ?)", pattern, pattern)
+	}
+	if filter.Status != nil {
+		query = query.Where("status = ?", *filter.Status)
+	}
+	return query
 }
 
-// CreatePermission 创建权限
+// likeEscaper 转义LIKE通配符，关键字按字面匹配
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// normalizePermissionPart 规范化权限的资源或操作名，统一为小写
+func normalizePermissionPart(part string) string {
+	return strings.ToLower(part)
+}
+
+// normalizePermission 将权限名、资源和操作统一为小写，创建和更新时调用，避免大小写不同导致检查时误拒绝
+func normalizePermission(permission *Permission) {
+	permission.Name = strings.ToLower(permission.Name)
+	permission.Resource = normalizePermissionPart(permission.Resource)
+	permission.Action = normalizePermissionPart(permission.Action)
+}
+
+// CreatePermission 创建权限，权限名、资源和操作保存为小写
 func (s *roleService) CreatePermission(permission *Permission) error {
+	normalizePermission(permission)
+	if err := s.namingPolicy.Validate(permission); err != nil {
+		return err
+	}
+
 	// 检查权限名是否已存在
 	var existingPermission Permission
 	err := s.db.Where("name = ?", permission.Name).First(&existingPermission).Error
@@ -195,11 +285,30 @@ func (s *roleService) CreatePermission(permission *Permission) error {
 	return s.db.Create(permission).Error
 }
 
+// UpdatePermission 更新权限，权限名、资源和操作保存为小写
+func (s *roleService) UpdatePermission(permission *Permission) error {
+	normalizePermission(permission)
+	if err := s.namingPolicy.Validate(permission); err != nil {
+		return err
+	}
+
+	// 检查权限名是否被其他权限使用
+	var existingPermission Permission
+	err := s.db.Where("name = ? AND id <> ?", permission.Name, permission.ID).First(&existingPermission).Error
+	if err == nil {
+		return errors.New("权限名已存在")
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	return s.db.Save(permission).Error
+}
+
 // GetPermissionByID 根据ID获取权限
 func (s *roleService) GetPermissionByID(id uint) (*Permission, error) {
 	var permission Permission
 	if err := s.db.First(&permission, id).Error; err != nil {
-		return nil, err
+		return nil, wrapNotFound(err, ErrPermissionNotFound)
 	}
 	return &permission, nil
 }
@@ -256,13 +365,64 @@ func (s *roleService) RemovePermissionFromRole(roleID, permissionID uint) error
 // GetRolePermissions 获取角色的所有权限
 func (s *roleService) GetRolePermissions(roleID uint) ([]*Permission, error) {
 	var permissions []*Permission
-	err := s.db.Table("sys_permissions p").
-		Joins("JOIN sys_role_permissions rp ON p.id = rp.permission_id").
-		Where("rp.role_id = ?", roleID).
+	err := s.db.Where("id IN (?)", s.db.Model(&RolePermission{}).Select("permission_id").Where("role_id = ?", roleID)).
 		Find(&permissions).Error
 	return permissions, err
 }
 
+// GetPermissionsForRoles 一次查询获取多个角色的权限，按角色ID分组
+//
+// 每个角色内的权限按ID排序且不重复，没有权限的角色不出现在结果中。
+func (s *roleService) GetPermissionsForRoles(roleIDs []uint) (map[uint][]*Permission, error) {
+	result := make(map[uint][]*Permission, len(roleIDs))
+	if len(roleIDs) == 0 {
+		return result, nil
+	}
+
+	var rows []struct {
+		RoleID uint
+		Permission
+	}
+	roleIDColumn := clause.Column{Table: RolePermission{}.TableName(), Name: "role_id"}
+	err := s.db.Model(&Permission{}).
+		Select("?.*, ?", clause.Table{Name: clause.CurrentTable}, roleIDColumn).
+		Joins("JOIN ? ON ? = ?",
+			clause.Table{Name: RolePermission{}.TableName()},
+			clause.Column{Table: RolePermission{}.TableName(), Name: "permission_id"},
+			clause.Column{Table: clause.CurrentTable, Name: "id"}).
+		Where(clause.IN{Column: roleIDColumn, Values: uintsToValues(roleIDs)}).
+		Order(clause.OrderBy{Columns: []clause.OrderByColumn{
+			{Column: roleIDColumn},
+			{Column: clause.Column{Table: clause.CurrentTable, Name: "id"}},
+		}}).
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// 关联表可能存在重复记录，同一角色内按权限ID去重
+	seen := make(map[[2]uint]bool, len(rows))
+	for i := range rows {
+		key := [2]uint{rows[i].RoleID, rows[i].Permission.ID}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		permission := rows[i].Permission
+		result[rows[i].RoleID] = append(result[rows[i].RoleID], &permission)
+	}
+	return result, nil
+}
+
+// uintsToValues 将ID列表转换为clause.IN所需的值列表
+func uintsToValues(ids []uint) []interface{} {
+	values := make([]interface{}, len(ids))
+	for i, id := range ids {
+		values[i] = id
+	}
+	return values
+}
+
 // AssignRoleToUser 为用户分配角色
 func (s *roleService) AssignRoleToUser(userID, roleID uint) error {
 	// 检查是否已经分配
@@ -291,30 +451,30 @@ func (s *roleService) RemoveRoleFromUser(userID, roleID uint) error {
 // GetUserRoles 获取用户的所有角色
 func (s *roleService) GetUserRoles(userID uint) ([]*Role, error) {
 	var roles []*Role
-	err := s.db.Table("sys_roles r").
-		Joins("JOIN sys_user_roles ur ON r.id = ur.role_id").
-		Where("ur.user_id = ?", userID).
-		Find(&roles).Error
+	err := s.db.Where("id IN (?)", s.userRoleIDs(userID)).Find(&roles).Error
 	return roles, err
 }
 
-// GetUsersWithRole 获取拥有指定角色的所有用户
+// GetUsersWithRole 获取拥有指定角色的所有用户，不包含已软删除的用户
 func (s *roleService) GetUsersWithRole(roleID uint) ([]*User, error) {
+	// 软删除的用户由User模型的默认作用域排除，即使残留旧的角色分配记录也不会返回
 	var users []*User
-	err := s.db.Table("sys_users u").
-		Joins("JOIN sys_user_roles ur ON u.id = ur.user_id").
-		Where("ur.role_id = ?", roleID).
+	err := s.db.Where("id IN (?)", s.db.Model(&UserRole{}).Select("user_id").Where("role_id = ?", roleID)).
 		Find(&users).Error
 	return users, err
 }
 
-// HasPermission 检查用户是否有指定权限
+// HasPermission 检查用户是否有指定权限，资源和操作转为小写后匹配
 func (s *roleService) HasPermission(userID uint, resource, action string) (bool, error) {
+	resource, action = normalizePermissionPart(resource), normalizePermissionPart(action)
+
+	// 排除已删除的角色
+	activeRoleIDs := s.db.Model(&Role{}).Select("id").Where("id IN (?)", s.userRoleIDs(userID))
+
 	var count int64
-	err := s.db.Table("sys_permissions p").
-		Joins("JOIN sys_role_permissions rp ON p.id = rp.permission_id").
-		Joins("JOIN sys_user_roles ur ON rp.role_id = ur.role_id").
-		Where("ur.user_id = ? AND p.resource = ? AND p.action = ?", userID, resource, action).
+	err := s.db.Model(&Permission{}).
+		Where("resource = ? AND action = ?", resource, action).
+		Where("id IN (?)", s.rolePermissionIDs(activeRoleIDs)).
 		Count(&count).Error
 
 	return count > 0, err
@@ -323,10 +483,68 @@ func (s *roleService) HasPermission(userID uint, resource, action string) (bool,
 // HasRole 检查用户是否有指定角色
 func (s *roleService) HasRole(userID uint, roleName string) (bool, error) {
 	var count int64
-	err := s.db.Table("sys_roles r").
-		Joins("JOIN sys_user_roles ur ON r.id = ur.role_id").
-		Where("ur.user_id = ? AND r.name = ?", userID, roleName).
+	err := s.db.Model(&Role{}).
+		Where("name = ? AND id IN (?)", roleName, s.userRoleIDs(userID)).
 		Count(&count).Error
 
 	return count > 0, err
 }
+
+// userRoleIDs 构建用户所分配角色ID的子查询
+// 使用子查询而非带别名的JOIN，表名由模型的TableName()决定，标识符由GORM按方言引用
+func (s *roleService) userRoleIDs(userID uint) *gorm.DB {
+	return s.db.Model(&UserRole{}).Select("role_id").Where("user_id = ?", userID)
+}
+
+// rolePermissionIDs 构建角色ID子查询所关联权限ID的子查询
+func (s *roleService) rolePermissionIDs(roleIDs *gorm.DB) *gorm.DB {
+	return s.db.Model(&RolePermission{}).Select("permission_id").Where("role_id IN (?)", roleIDs)
+}
+
+// DefaultPermissions 系统内置权限，管理员角色默认拥有全部权限
+func DefaultPermissions() []*Permission {
+	return []*Permission{
+		{
+			Name:        "user.create",
+			DisplayName: "创建用户",
+			Resource:    "user",
+			Action:      "create",
+			Description: "创建新用户的权限",
+		},
+		{
+			Name:        "user.read",
+			DisplayName: "查看用户",
+			Resource:    "user",
+			Action:      "read",
+			Description: "查看用户信息的权限",
+		},
+		{
+			Name:        "user.update",
+			DisplayName: "更新用户",
+			Resource:    "user",
+			Action:      "update",
+			Description: "更新用户信息的权限",
+		},
+		{
+			Name:        "user.delete",
+			DisplayName: "删除用户",
+			Resource:    "user",
+			Action:      "delete",
+			Description: "删除用户的权限",
+		},
+		{
+			Name:        "user.read_deleted",
+			DisplayName: "查看已删除用户",
+			Resource:    PermissionResourceUser,
+			Action:      PermissionActionReadDeleted,
+			Description: "在用户列表中查看已软删除用户的权限",
+		},
+		{
+			Name:        "user.read_pii",
+			DisplayName: "查看用户个人信息",
+			Resource:    PermissionResourceUser,
+			Action:      PermissionActionReadPII,
+			Description: "查看用户完整邮箱和手机号的权限",
+		},
+	}
+}
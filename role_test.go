@@ -1,10 +1,13 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
+	"aigo_service_auth/testfixtures"
 	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
 )
 
 func TestRoleService(t *testing.T) {
@@ -12,6 +15,20 @@ func TestRoleService(t *testing.T) {
 	testDB := SetupTestDB(t)
 	defer testDB.TeardownTestDB()
 
+	runRoleServiceTests(t, testDB)
+}
+
+// TestRoleServicePostgres 在PostgreSQL上运行相同的角色服务测试，验证与MySQL行为一致
+// 例如：docker run -d -e POSTGRES_USER=test -e POSTGRES_PASSWORD=test -p 15432:5432 postgres:16
+// POSTGRES_DSN="host=127.0.0.1 port=15432 user=test password=test dbname=test sslmode=disable" go test -run TestRoleService
+func TestRoleServicePostgres(t *testing.T) {
+	testDB := SetupPostgresTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	runRoleServiceTests(t, testDB)
+}
+
+func runRoleServiceTests(t *testing.T, testDB *TestDB) {
 	// 创建服务实例
 	roleService := NewRoleService(testDB.DB)
 
@@ -70,6 +87,22 @@ func TestRoleService(t *testing.T) {
 		assert.Equal(t, role.ID, foundRoleByName.ID)
 	})
 
+	t.Run("获取不存在的角色和权限", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		_, err := roleService.GetRoleByID(99999)
+		assert.True(t, errors.Is(err, ErrRoleNotFound))
+		assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+		_, err = roleService.GetRoleByName("missing")
+		assert.True(t, errors.Is(err, ErrRoleNotFound))
+
+		_, err = roleService.GetPermissionByID(99999)
+		assert.True(t, errors.Is(err, ErrPermissionNotFound))
+		assert.False(t, errors.Is(err, ErrRoleNotFound))
+	})
+
 	t.Run("创建权限", func(t *testing.T) {
 		// 清理数据
 		testDB.ClearAllData()
@@ -136,13 +169,7 @@ func TestRoleService(t *testing.T) {
 		// 清理数据
 		testDB.ClearAllData()
 
-		user := testDB.CreateTestUser("testuser", "test@example.com", "password")
-		role := testDB.CreateTestRole("admin", "管理员", "系统管理员")
-		permission := testDB.CreateTestPermission("user.create", "创建用户", "user", "create")
-
-		// 分配权限和角色
-		roleService.AssignPermissionToRole(role.ID, permission.ID)
-		roleService.AssignRoleToUser(user.ID, role.ID)
+		user := testfixtures.NewFixture(testDB.DB).User("testuser").WithRole("admin").WithPermissions("user.create").MustBuild(t).User
 
 		// 测试权限检查
 		hasPermission, err := roleService.HasPermission(user.ID, "user", "create")
@@ -154,6 +181,29 @@ func TestRoleService(t *testing.T) {
 		assert.False(t, hasPermission)
 	})
 
+	t.Run("权限检查不区分大小写", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		user := testfixtures.NewFixture(testDB.DB).User("testuser").WithRole("viewer").WithPermissions("user.read").MustBuild(t).User
+
+		hasPermission, err := roleService.HasPermission(user.ID, "User", "Read")
+		assert.NoError(t, err)
+		assert.True(t, hasPermission)
+
+		// 创建时统一保存为小写
+		permission := &Permission{Name: "Order.Export", DisplayName: "导出订单", Resource: "Order", Action: "Export"}
+		assert.NoError(t, roleService.CreatePermission(permission))
+		saved, err := roleService.GetPermissionByID(permission.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "order.export", saved.Name)
+		assert.Equal(t, "order", saved.Resource)
+		assert.Equal(t, "export", saved.Action)
+
+		// 大小写不同的同名权限视为重复
+		assert.Error(t, roleService.CreatePermission(&Permission{Name: "order.EXPORT", DisplayName: "导出订单", Resource: "order", Action: "EXPORT"}))
+	})
+
 	t.Run("角色检查", func(t *testing.T) {
 		// 清理数据
 		testDB.ClearAllData()
@@ -174,6 +224,87 @@ func TestRoleService(t *testing.T) {
 		assert.False(t, hasRole)
 	})
 
+	t.Run("已删除的角色和权限不参与检查", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		user := testDB.CreateTestUser("testuser", "test@example.com", "password")
+		role := testDB.CreateTestRole("admin", "管理员", "系统管理员")
+		permission := testDB.CreateTestPermission("user.create", "创建用户", "user", "create")
+
+		roleService.AssignPermissionToRole(role.ID, permission.ID)
+		roleService.AssignRoleToUser(user.ID, role.ID)
+
+		// 软删除权限
+		assert.NoError(t, testDB.DB.Delete(permission).Error)
+		hasPermission, err := roleService.HasPermission(user.ID, "user", "create")
+		assert.NoError(t, err)
+		assert.False(t, hasPermission)
+
+		permissions, err := roleService.GetRolePermissions(role.ID)
+		assert.NoError(t, err)
+		assert.Len(t, permissions, 0)
+
+		// 软删除角色
+		assert.NoError(t, testDB.DB.Delete(role).Error)
+		hasRole, err := roleService.HasRole(user.ID, "admin")
+		assert.NoError(t, err)
+		assert.False(t, hasRole)
+
+		roles, err := roleService.GetUserRoles(user.ID)
+		assert.NoError(t, err)
+		assert.Len(t, roles, 0)
+	})
+
+	t.Run("删除角色", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		role := testDB.CreateTestRole("admin", "管理员", "系统管理员")
+		permission := testDB.CreateTestPermission("user.create", "创建用户", "user", "create")
+		roleService.AssignPermissionToRole(role.ID, permission.ID)
+
+		err := roleService.DeleteRole(role.ID)
+		assert.NoError(t, err)
+
+		_, err = roleService.GetRoleByID(role.ID)
+		assert.True(t, errors.Is(err, ErrRoleNotFound))
+
+		var count int64
+		testDB.DB.Model(&RolePermission{}).Where("role_id = ?", role.ID).Count(&count)
+		assert.Equal(t, int64(0), count)
+	})
+
+	t.Run("删除角色失败时回滚", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		role := testDB.CreateTestRole("admin", "管理员", "系统管理员")
+		permission := testDB.CreateTestPermission("user.create", "创建用户", "user", "create")
+		roleService.AssignPermissionToRole(role.ID, permission.ID)
+
+		// 模拟删除角色时失败（角色权限关联已删除之后）
+		callbackName := "test:fail_role_delete"
+		err := testDB.DB.Callback().Delete().Before("gorm:delete").Register(callbackName, func(db *gorm.DB) {
+			if db.Statement.Table == (Role{}).TableName() {
+				db.AddError(errors.New("模拟删除失败"))
+			}
+		})
+		assert.NoError(t, err)
+		defer testDB.DB.Callback().Delete().Remove(callbackName)
+
+		err = roleService.DeleteRole(role.ID)
+		assert.Error(t, err)
+
+		// 角色和角色权限关联都应保留
+		_, err = roleService.GetRoleByID(role.ID)
+		assert.NoError(t, err)
+
+		permissions, err := roleService.GetRolePermissions(role.ID)
+		assert.NoError(t, err)
+		assert.Len(t, permissions, 1)
+	})
+
 	t.Run("移除用户角色", func(t *testing.T) {
 		// 清理数据
 		testDB.ClearAllData()
@@ -199,6 +330,41 @@ func TestRoleService(t *testing.T) {
 		assert.False(t, hasRole)
 	})
 
+	t.Run("已删除的用户不出现在角色成员中", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		userService := NewUserService(testDB.DB)
+		role := testDB.CreateTestRole("admin", "管理员", "系统管理员")
+		kept := testDB.CreateTestUser("kept", "kept@example.com", "password")
+		softDeleted := testDB.CreateTestUser("soft", "soft@example.com", "password")
+		hardDeleted := testDB.CreateTestUser("hard", "hard@example.com", "password")
+		for _, user := range []*User{kept, softDeleted, hardDeleted} {
+			assert.NoError(t, roleService.AssignRoleToUser(user.ID, role.ID))
+		}
+
+		assert.NoError(t, userService.DeleteUser(softDeleted.ID))
+		assert.NoError(t, userService.DeleteUserHard(hardDeleted.ID))
+
+		users, err := roleService.GetUsersWithRole(role.ID)
+		assert.NoError(t, err)
+		assert.Len(t, users, 1)
+		assert.Equal(t, kept.ID, users[0].ID)
+
+		// 两种删除都会清理角色分配
+		var count int64
+		testDB.DB.Model(&UserRole{}).Where("user_id IN ?", []uint{softDeleted.ID, hardDeleted.ID}).Count(&count)
+		assert.Zero(t, count)
+
+		// 永久删除后无法再找到用户，已软删除的用户也可以永久删除
+		_, err = userService.GetUserByUsernameUnscoped("hard")
+		assert.True(t, errors.Is(err, ErrUserNotFound))
+		assert.NoError(t, userService.DeleteUserHard(softDeleted.ID))
+		_, err = userService.GetUserByUsernameUnscoped("soft")
+		assert.True(t, errors.Is(err, ErrUserNotFound))
+		assert.True(t, errors.Is(userService.DeleteUserHard(softDeleted.ID), ErrUserNotFound))
+	})
+
 	t.Run("移除角色权限", func(t *testing.T) {
 		// 清理数据
 		testDB.ClearAllData()
@@ -224,6 +390,41 @@ func TestRoleService(t *testing.T) {
 		assert.Len(t, permissions, 0)
 	})
 
+	t.Run("批量获取多个角色的权限", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		admin := testDB.CreateTestRole("admin", "管理员", "系统管理员")
+		editor := testDB.CreateTestRole("editor", "编辑", "内容编辑")
+		empty := testDB.CreateTestRole("empty", "无权限", "没有权限的角色")
+		create := testDB.CreateTestPermission("user.create", "创建用户", "user", "create")
+		read := testDB.CreateTestPermission("user.read", "查看用户", "user", "read")
+		deleted := testDB.CreateTestPermission("user.delete", "删除用户", "user", "delete")
+
+		assert.NoError(t, roleService.AssignPermissionToRole(admin.ID, create.ID))
+		assert.NoError(t, roleService.AssignPermissionToRole(admin.ID, read.ID))
+		assert.NoError(t, roleService.AssignPermissionToRole(admin.ID, deleted.ID))
+		assert.NoError(t, roleService.AssignPermissionToRole(editor.ID, read.ID))
+		// 关联表中的重复记录不产生重复权限
+		assert.NoError(t, testDB.DB.Create(&RolePermission{RoleID: editor.ID, PermissionID: read.ID}).Error)
+		// 已删除的权限不返回
+		assert.NoError(t, testDB.DB.Delete(deleted).Error)
+
+		result, err := roleService.GetPermissionsForRoles([]uint{admin.ID, editor.ID, empty.ID})
+		assert.NoError(t, err)
+		assert.Len(t, result, 2)
+		assert.Len(t, result[admin.ID], 2)
+		assert.Equal(t, create.ID, result[admin.ID][0].ID)
+		assert.Equal(t, read.ID, result[admin.ID][1].ID)
+		assert.Len(t, result[editor.ID], 1)
+		assert.Equal(t, "user.read", result[editor.ID][0].Name)
+		assert.Empty(t, result[empty.ID])
+
+		result, err = roleService.GetPermissionsForRoles(nil)
+		assert.NoError(t, err)
+		assert.Empty(t, result)
+	})
+
 	t.Run("角色分页列表", func(t *testing.T) {
 		// 清理数据
 		testDB.ClearAllData()
@@ -249,6 +450,59 @@ func TestRoleService(t *testing.T) {
 		assert.Len(t, rolesPage2, 5)
 	})
 
+	t.Run("按名称和状态搜索角色", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		for i := 0; i < 12; i++ {
+			testDB.CreateTestRole(fmt.Sprintf("editor%d", i), fmt.Sprintf("编辑%d", i), "")
+		}
+		testDB.CreateTestRole("viewer", "只读编辑", "")
+		testDB.CreateTestRole("admin", "管理员", "")
+		disabled := testDB.CreateTestRole("editor_disabled", "停用编辑", "")
+		assert.NoError(t, testDB.DB.Model(disabled).Update("status", 2).Error)
+
+		// 匹配角色名或显示名，总数与过滤条件一致
+		result, err := roleService.SearchRoles(RoleFilter{NameContains: "editor"}, 1, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(13), result.Total)
+		assert.Len(t, result.Items, 10)
+		assert.Equal(t, 1, result.Page)
+		assert.Equal(t, 10, result.PageSize)
+
+		result, err = roleService.SearchRoles(RoleFilter{NameContains: "editor"}, 2, 10)
+		assert.NoError(t, err)
+		assert.Len(t, result.Items, 3)
+
+		result, err = roleService.SearchRoles(RoleFilter{NameContains: "编辑"}, 1, 20)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(14), result.Total)
+
+		// 按状态过滤
+		active := uint8(1)
+		result, err = roleService.SearchRoles(RoleFilter{NameContains: "editor", Status: &active}, 1, 20)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(12), result.Total)
+		assert.Len(t, result.Items, 12)
+
+		inactive := uint8(2)
+		result, err = roleService.SearchRoles(RoleFilter{Status: &inactive}, 1, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), result.Total)
+		assert.Equal(t, disabled.ID, result.Items[0].ID)
+
+		// 通配符按字面匹配
+		result, err = roleService.SearchRoles(RoleFilter{NameContains: "r_"}, 1, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), result.Total)
+
+		// 无匹配时返回空列表
+		result, err = roleService.SearchRoles(RoleFilter{NameContains: "nobody"}, 1, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), result.Total)
+		assert.Empty(t, result.Items)
+	})
+
 	t.Run("权限分页列表", func(t *testing.T) {
 		// 清理数据
 		testDB.ClearAllData()
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// ownedDocument 测试用的按用户归属的数据
+type ownedDocument struct {
+	ID      uint `gorm:"primarykey"`
+	OwnerID uint `gorm:"index"`
+	Title   string
+	Status  int
+}
+
+// TableName 指定表名
+func (ownedDocument) TableName() string {
+	return "test_owned_documents"
+}
+
+// ownershipContext 构造带有用户和实时权限的上下文
+func ownershipContext(userID uint, permissions map[string][]string) context.Context {
+	user := &User{Username: "user"}
+	user.ID = userID
+	ctx := context.WithValue(context.Background(), UserContextKey, user)
+	if permissions != nil {
+		ctx = context.WithValue(ctx, AuthorizationContextKey, &AuthorizationClaims{UserID: userID, Permissions: permissions})
+	}
+	return ctx
+}
+
+func TestOwnedScopeSQL(t *testing.T) {
+	// 只生成SQL，不连接数据库
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "dry:run@tcp(127.0.0.1:1)/dry", SkipInitializeWithVersion: true}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	assert.NoError(t, err)
+
+	toSQL := func(ctx context.Context, scope func(context.Context) func(*gorm.DB) *gorm.DB) string {
+		return db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+			var docs []ownedDocument
+			return tx.Where("status = ?", 1).Scopes(scope(ctx)).Find(&docs)
+		})
+	}
+
+	t.Run("按当前用户过滤并与其他条件组合", func(t *testing.T) {
+		sql := toSQL(ownershipContext(7, nil), OwnedScope)
+		assert.Equal(t, "SELECT * FROM `test_owned_documents` WHERE status = 1 AND `test_owned_documents`.`owner_id` = 7", sql)
+	})
+
+	t.Run("没有用户时不返回数据", func(t *testing.T) {
+		sql := toSQL(context.Background(), OwnedScope)
+		assert.Contains(t, sql, "1 = 0")
+	})
+
+	t.Run("拥有查看全部权限时不过滤", func(t *testing.T) {
+		ctx := ownershipContext(1, map[string][]string{PermissionResourceAll: {PermissionActionViewAll}})
+		assert.Equal(t, "SELECT * FROM `test_owned_documents` WHERE status = 1", toSQL(ctx, OwnedScope))
+	})
+
+	t.Run("按资源判断查看全部权限", func(t *testing.T) {
+		ctx := ownershipContext(1, map[string][]string{"document": {PermissionActionViewAll}})
+		documents := func(ctx context.Context) func(*gorm.DB) *gorm.DB { return AdminOrOwner(ctx, "document") }
+		orders := func(ctx context.Context) func(*gorm.DB) *gorm.DB { return AdminOrOwner(ctx, "order") }
+
+		assert.NotContains(t, toSQL(ctx, documents), "owner_id")
+		assert.Contains(t, toSQL(ctx, orders), "`owner_id` = 1")
+		// 资源权限不等同于全局权限
+		assert.Contains(t, toSQL(ctx, OwnedScope), "`owner_id` = 1")
+	})
+
+	t.Run("忽略其他用户的权限", func(t *testing.T) {
+		ctx := ownershipContext(7, nil)
+		ctx = context.WithValue(ctx, AuthorizationContextKey, &AuthorizationClaims{
+			UserID:      1,
+			Permissions: map[string][]string{PermissionResourceAll: {PermissionActionViewAll}},
+		})
+		assert.Contains(t, toSQL(ctx, OwnedScope), "`owner_id` = 7")
+	})
+
+	t.Run("自定义归属列", func(t *testing.T) {
+		defer func(config *OwnershipConfig) { OwnershipScopeConfig = config }(OwnershipScopeConfig)
+		OwnershipScopeConfig = &OwnershipConfig{Column: "created_by", ViewAllResource: PermissionResourceAll, ViewAllAction: "audit"}
+
+		assert.Contains(t, toSQL(ownershipContext(7, nil), OwnedScope), "`created_by` = 7")
+		ctx := ownershipContext(1, map[string][]string{PermissionResourceAll: {"audit"}})
+		assert.NotContains(t, toSQL(ctx, OwnedScope), "created_by")
+	})
+}
+
+func TestOwnedScope(t *testing.T) {
+	// 设置测试数据库
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	assert.NoError(t, testDB.DB.AutoMigrate(&ownedDocument{}))
+	defer testDB.DB.Migrator().DropTable(&ownedDocument{})
+
+	assert.NoError(t, testDB.DB.Create([]*ownedDocument{
+		{OwnerID: 7, Title: "a", Status: 1},
+		{OwnerID: 7, Title: "b", Status: 0},
+		{OwnerID: 8, Title: "c", Status: 1},
+	}).Error)
+
+	find := func(ctx context.Context) []ownedDocument {
+		var docs []ownedDocument
+		assert.NoError(t, testDB.DB.Scopes(AdminOrOwner(ctx, "document")).Order("id").Find(&docs).Error)
+		return docs
+	}
+
+	t.Run("所有者只能看到自己的数据", func(t *testing.T) {
+		docs := find(ownershipContext(7, nil))
+		assert.Len(t, docs, 2)
+		for _, doc := range docs {
+			assert.Equal(t, uint(7), doc.OwnerID)
+		}
+	})
+
+	t.Run("其他用户看不到", func(t *testing.T) {
+		assert.Empty(t, find(ownershipContext(9, nil)))
+		assert.Empty(t, find(context.Background()))
+	})
+
+	t.Run("管理员看到全部数据", func(t *testing.T) {
+		docs := find(ownershipContext(1, map[string][]string{"document": {PermissionActionViewAll}}))
+		assert.Len(t, docs, 3)
+	})
+}
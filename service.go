@@ -1,13 +1,11 @@
 package main
 
 import (
-	"crypto/rand"
-	"encoding/base64"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
-	"golang.org/x/crypto/argon2"
 	"gorm.io/gorm"
 )
 
@@ -21,56 +19,115 @@ type UserService interface {
 	GetUserByUsername(username string) (*User, error)
 	// 根据邮箱获取用户
 	GetUserByEmail(email string) (*User, error)
+	// 根据手机号获取用户
+	GetUserByPhone(phone string) (*User, error)
+	// 根据用户名获取用户（包含已软删除的用户）
+	GetUserByUsernameUnscoped(username string) (*User, error)
+	// 根据邮箱获取用户（包含已软删除的用户）
+	GetUserByEmailUnscoped(email string) (*User, error)
 	// 更新用户
 	UpdateUser(user *User) error
-	// 删除用户
+	// 仅更新用户最后登录时间
+	UpdateLastLogin(userID uint, t time.Time) error
+	// 删除用户（软删除）
 	DeleteUser(id uint) error
+	// 永久删除用户及其关联数据，已软删除的用户也可永久删除
+	DeleteUserHard(id uint) error
 	// 分页获取用户列表
 	ListUsers(page, pageSize int) ([]*User, int64, error)
+	// 按过滤条件分页获取用户列表
+	ListUsersWithFilter(filter UserFilter, page, pageSize int) ([]*User, int64, error)
+	// 分页获取自since起未登录的用户，从未登录的用户按注册时间判断
+	ListInactiveUsers(since time.Time, page, pageSize int) ([]*User, int64, error)
 	// 验证邀请码是否有效
 	ValidateInvitationCode(code string) (bool, error)
+	// 暂停用户直到指定时间
+	SuspendUser(id uint, until time.Time, reason string) error
+	// 解除用户暂停
+	LiftSuspension(id uint) error
+	// 记录用户同意了指定版本的服务条款
+	AcceptTerms(userID uint, version string) error
+	// 按密码哈希算法统计用户数
+	HashAlgoStats() (map[string]int64, error)
+}
+
+// ErrUserNotFound 用户不存在，同时匹配gorm.ErrRecordNotFound以兼容已有调用方
+var ErrUserNotFound = errors.New("用户不存在")
+
+// wrapNotFound 将GORM的记录不存在错误包装为业务错误，调用方无需依赖GORM即可判断
+func wrapNotFound(err, notFound error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%w: %w", notFound, err)
+	}
+	return err
+}
+
+// UserFilter 用户列表过滤条件
+type UserFilter struct {
+	IncludeDeleted bool // 包含已软删除的用户
+	DeletedOnly    bool // 仅返回已软删除的用户
+}
+
+// Page 分页查询结果
+type Page[T any] struct {
+	Items    []T   `json:"items"`
+	Total    int64 `json:"total"` // 满足过滤条件的总数
+	Page     int   `json:"page"`
+	PageSize int   `json:"page_size"`
 }
 
 // userService 用户服务实现
 type userService struct {
-	db *gorm.DB
+	db                 *gorm.DB
+	tenantLimits       TenantLimitService // 为nil时不检查租户用户数上限
+	emailCanonicalizer EmailCanonicalizer // 为nil时按原始邮箱判断唯一性和查询
+}
+
+// UserServiceConfig 用户服务配置
+type UserServiceConfig struct {
+	// 租户限额，设置后租户达到用户数上限时CreateUser返回ErrSeatLimitReached
+	TenantLimits TenantLimitService
+	// 邮箱规范化器，为nil时不启用。启用后创建和修改用户时保存邮箱的规范形式，GetUserByEmail按规范形式查询，
+	// 规范形式相同的邮箱不能重复注册；对已有数据启用时应以同一个规范化器调用BackfillEmailCanonical
+	EmailCanonicalizer EmailCanonicalizer
 }
 
 // NewUserService 创建用户服务实例
 func NewUserService(db *gorm.DB) UserService {
+	return NewUserServiceWithConfig(db, nil)
+}
+
+// NewUserServiceWithTenantLimits 创建检查租户用户数上限的用户服务实例，租户达到上限时CreateUser返回ErrSeatLimitReached
+func NewUserServiceWithTenantLimits(db *gorm.DB, tenantLimits TenantLimitService) UserService {
+	return NewUserServiceWithConfig(db, &UserServiceConfig{TenantLimits: tenantLimits})
+}
+
+// NewUserServiceWithConfig 使用自定义配置创建用户服务实例，config为nil时使用默认配置
+func NewUserServiceWithConfig(db *gorm.DB, config *UserServiceConfig) UserService {
+	if config == nil {
+		config = &UserServiceConfig{}
+	}
 	return &userService{
-		db: db,
+		db:                 db,
+		tenantLimits:       config.TenantLimits,
+		emailCanonicalizer: config.EmailCanonicalizer,
 	}
 }
 
 // CreateUser 创建用户
 func (s *userService) CreateUser(user *User) error {
-	// 检查用户名是否已存在
-	var existingUser User
-	err := s.db.Where("username = ?", user.Username).First(&existingUser).Error
-	if err == nil {
-		return errors.New("用户名已存在")
-	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+	// 检查用户名、邮箱和邀请码，一次返回全部字段错误
+	validationErr := &ValidationError{}
+	if err := validateNewUser(s, user, validationErr); err != nil {
 		return err
 	}
-
-	// 检查邮箱是否已存在
-	err = s.db.Where("email = ?", user.Email).First(&existingUser).Error
-	if err == nil {
-		return errors.New("邮箱已存在")
-	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+	if err := validationErr.Err(); err != nil {
 		return err
 	}
-
-	// 如果提供了邀请码，验证邀请码
-	if user.InvitationCode != "" {
-		valid, err := s.ValidateInvitationCode(user.InvitationCode)
-		if err != nil {
+	if s.tenantLimits != nil {
+		if err := s.tenantLimits.CheckSeat(user.TenantID); err != nil {
 			return err
 		}
-		if !valid {
-			return errors.New("邀请码无效")
-		}
 	}
 
 	// 如果密码未哈希，则进行哈希处理
@@ -82,6 +139,8 @@ func (s *userService) CreateUser(user *User) error {
 		user.PasswordHash = hashedPassword
 	}
 
+	user.updateEmailCanonical(s.emailCanonicalizer)
+
 	// 设置创建时间
 	now := time.Now()
 	user.CreatedAt = now
@@ -95,7 +154,7 @@ func (s *userService) CreateUser(user *User) error {
 func (s *userService) GetUserByID(id uint) (*User, error) {
 	var user User
 	if err := s.db.First(&user, id).Error; err != nil {
-		return nil, err
+		return nil, wrapNotFound(err, ErrUserNotFound)
 	}
 	return &user, nil
 }
@@ -104,7 +163,7 @@ func (s *userService) GetUserByID(id uint) (*User, error) {
 func (s *userService) GetUserByUsername(username string) (*User, error) {
 	var user User
 	if err := s.db.Where("username = ?", username).First(&user).Error; err != nil {
-		return nil, err
+		return nil, wrapNotFound(err, ErrUserNotFound)
 	}
 	return &user, nil
 }
@@ -112,8 +171,44 @@ func (s *userService) GetUserByUsername(username string) (*User, error) {
 // GetUserByEmail 根据邮箱获取用户
 func (s *userService) GetUserByEmail(email string) (*User, error) {
 	var user User
-	if err := s.db.Where("email = ?", email).First(&user).Error; err != nil {
-		return nil, err
+	if err := whereEmail(s.db, s.emailCanonicalizer, email).First(&user).Error; err != nil {
+		return nil, wrapNotFound(err, ErrUserNotFound)
+	}
+	return &user, nil
+}
+
+// GetUserByPhone 根据手机号获取用户，配置字段加密器时按HMAC索引查询
+func (s *userService) GetUserByPhone(phone string) (*User, error) {
+	if strings.TrimSpace(phone) == "" {
+		return nil, wrapNotFound(gorm.ErrRecordNotFound, ErrUserNotFound)
+	}
+
+	query := s.db.Where("phone = ?", phone)
+	if encryptor := GetFieldEncryptor(); encryptor != nil {
+		query = s.db.Where("phone_hash = ?", encryptor.BlindIndex(phone))
+	}
+
+	var user User
+	if err := query.First(&user).Error; err != nil {
+		return nil, wrapNotFound(err, ErrUserNotFound)
+	}
+	return &user, nil
+}
+
+// GetUserByUsernameUnscoped 根据用户名获取用户（包含已软删除的用户）
+func (s *userService) GetUserByUsernameUnscoped(username string) (*User, error) {
+	var user User
+	if err := s.db.Unscoped().Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, wrapNotFound(err, ErrUserNotFound)
+	}
+	return &user, nil
+}
+
+// GetUserByEmailUnscoped 根据邮箱获取用户（包含已软删除的用户）
+func (s *userService) GetUserByEmailUnscoped(email string) (*User, error) {
+	var user User
+	if err := whereEmail(s.db.Unscoped(), s.emailCanonicalizer, email).First(&user).Error; err != nil {
+		return nil, wrapNotFound(err, ErrUserNotFound)
 	}
 	return &user, nil
 }
@@ -123,9 +218,22 @@ func (s *userService) UpdateUser(user *User) error {
 	// 检查用户是否存在
 	var existingUser User
 	if err := s.db.First(&existingUser, user.ID).Error; err != nil {
-		return err
+		return wrapNotFound(err, ErrUserNotFound)
 	}
 
+	// 启用邮箱规范化时，新邮箱不能与其他用户的邮箱规范形式相同
+	if user.Email != existingUser.Email && s.emailCanonicalizer != nil {
+		var count int64
+		if err := whereEmail(s.db.Unscoped().Model(&User{}), s.emailCanonicalizer, user.Email).Where("id <> ?", user.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrEmailTaken
+		}
+	}
+
+	user.updateEmailCanonical(s.emailCanonicalizer)
+
 	// 更新时间
 	user.UpdatedAt = time.Now()
 
@@ -133,20 +241,68 @@ func (s *userService) UpdateUser(user *User) error {
 	return s.db.Save(user).Error
 }
 
+// UpdateLastLogin 仅更新用户最后登录时间，不改写其他字段
+func (s *userService) UpdateLastLogin(userID uint, t time.Time) error {
+	result := s.db.Model(&User{}).Where("id = ?", userID).UpdateColumn("last_login_at", t)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	// 值未变化时MySQL不计入影响行数，需要确认用户是否存在
+	if result.RowsAffected == 0 {
+		var count int64
+		if err := s.db.Model(&User{}).Where("id = ?", userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return wrapNotFound(gorm.ErrRecordNotFound, ErrUserNotFound)
+		}
+	}
+
+	return nil
+}
+
 // DeleteUser 删除用户
 func (s *userService) DeleteUser(id uint) error {
 	// 检查用户是否存在
 	var user User
 	if err := s.db.First(&user, id).Error; err != nil {
-		return err
+		return wrapNotFound(err, ErrUserNotFound)
 	}
 
-	// 删除用户（软删除）
-	return s.db.Delete(&user).Error
+	// 删除用户（软删除），同时移除角色分配，避免角色成员查询返回已删除的用户
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&UserRole{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&user).Error
+	})
+}
+
+// DeleteUserHard 永久删除用户及其角色分配、重置码、验证码和已知设备
+func (s *userService) DeleteUserHard(id uint) error {
+	var user User
+	if err := s.db.Unscoped().First(&user, id).Error; err != nil {
+		return wrapNotFound(err, ErrUserNotFound)
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&UserRole{}, &PasswordResetCode{}, &VerificationCode{}, &KnownDevice{}} {
+			if err := tx.Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Delete(&user).Error
+	})
 }
 
 // ListUsers 分页获取用户列表
 func (s *userService) ListUsers(page, pageSize int) ([]*User, int64, error) {
+	return s.ListUsersWithFilter(UserFilter{}, page, pageSize)
+}
+
+// ListUsersWithFilter 按过滤条件分页获取用户列表
+func (s *userService) ListUsersWithFilter(filter UserFilter, page, pageSize int) ([]*User, int64, error) {
 	if page <= 0 {
 		page = 1
 	}
@@ -158,19 +314,124 @@ func (s *userService) ListUsers(page, pageSize int) ([]*User, int64, error) {
 	var total int64
 
 	// 获取总数
-	if err := s.db.Model(&User{}).Count(&total).Error; err != nil {
+	if err := s.filterQuery(filter).Model(&User{}).Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 
 	// 分页查询
 	offset := (page - 1) * pageSize
-	if err := s.db.Offset(offset).Limit(pageSize).Find(&users).Error; err != nil {
+	if err := s.filterQuery(filter).Offset(offset).Limit(pageSize).Find(&users).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+// HashAlgoStats 按密码哈希算法统计未删除的用户数，未记录算法的用户计入旧格式
+func (s *userService) HashAlgoStats() (map[string]int64, error) {
+	var rows []struct {
+		HashAlgo string
+		Count    int64
+	}
+	if err := s.db.Model(&User{}).Select("hash_algo, COUNT(*) AS count").Group("hash_algo").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		algo := row.HashAlgo
+		if algo == "" {
+			algo = HashAlgoArgon2Legacy
+		}
+		stats[algo] += row.Count
+	}
+	return stats, nil
+}
+
+// ListInactiveUsers 分页获取自since起未登录（最近一次登录不晚于since）的用户，从未登录的用户按注册时间判断，按ID排列
+func (s *userService) ListInactiveUsers(since time.Time, page, pageSize int) ([]*User, int64, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 10
+	}
+
+	query := func() *gorm.DB {
+		return s.db.Model(&User{}).Where("COALESCE(last_login_at, created_at) <= ?", since)
+	}
+
+	var total int64
+	if err := query().Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 
+	var users []*User
+	if err := query().Order("id").Offset((page - 1) * pageSize).Limit(pageSize).Find(&users).Error; err != nil {
+		return nil, 0, err
+	}
 	return users, total, nil
 }
 
+// SuspendUser 暂停用户直到指定时间
+func (s *userService) SuspendUser(id uint, until time.Time, reason string) error {
+	if !until.After(time.Now()) {
+		return errors.New("暂停截止时间必须晚于当前时间")
+	}
+
+	user, err := s.GetUserByID(id)
+	if err != nil {
+		return err
+	}
+
+	user.SuspendedUntil = &until
+	user.SuspensionReason = reason
+	return s.UpdateUser(user)
+}
+
+// LiftSuspension 解除用户暂停
+func (s *userService) LiftSuspension(id uint) error {
+	user, err := s.GetUserByID(id)
+	if err != nil {
+		return err
+	}
+
+	user.SuspendedUntil = nil
+	user.SuspensionReason = ""
+	return s.UpdateUser(user)
+}
+
+// AcceptTerms 记录用户同意了指定版本的服务条款，同意时间为当前时间
+func (s *userService) AcceptTerms(userID uint, version string) error {
+	if version == "" {
+		return ErrInvalidTermsVersion
+	}
+
+	result := s.db.Model(&User{}).Where("id = ?", userID).UpdateColumns(map[string]interface{}{
+		"accepted_terms_version": version,
+		"accepted_terms_at":      time.Now(),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return wrapNotFound(gorm.ErrRecordNotFound, ErrUserNotFound)
+	}
+	return nil
+}
+
+// filterQuery 根据过滤条件构建查询
+func (s *userService) filterQuery(filter UserFilter) *gorm.DB {
+	query := s.db
+	if filter.IncludeDeleted || filter.DeletedOnly {
+		query = query.Unscoped()
+	}
+	if filter.DeletedOnly {
+		query = query.Where("deleted_at IS NOT NULL")
+	}
+	return query
+}
+
 // ValidateInvitationCode 验证邀请码是否有效
 func (s *userService) ValidateInvitationCode(code string) (bool, error) {
 	// 这里应该实现邀请码验证逻辑
@@ -186,20 +447,15 @@ func (s *userService) ValidateInvitationCode(code string) (bool, error) {
 
 // hashPassword 哈希密码
 func (s *userService) hashPassword(password string) (string, error) {
-	salt := make([]byte, 16)
-	if _, err := rand.Read(salt); err != nil {
-		return "", err
-	}
-
-	hash := argon2.IDKey([]byte(password), salt, 1, 64*1024, 4, 32)
-
-	// 编码为base64字符串
-	encoded := base64.RawStdEncoding.EncodeToString(salt) + "$" + base64.RawStdEncoding.EncodeToString(hash)
-	return encoded, nil
+	// 与authService使用相同的参数和格式，保证哈希可被验证
+	return encodeArgon2Hash(password, DefaultPasswordConfig)
 }
 
 // isPasswordHashed 检查密码是否已经哈希
 func (s *userService) isPasswordHashed(password string) bool {
-	// 简单检查：哈希后的密码包含$分隔符且长度较长
+	if strings.HasPrefix(password, argon2PHCPrefix) {
+		return true
+	}
+	// 旧格式：哈希后的密码包含$分隔符且长度较长
 	return len(password) > 50 && strings.Contains(password, "$")
 }
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"gorm.io/gorm"
@@ -49,7 +50,7 @@ func TestUserService(t *testing.T) {
 
 		err := service.CreateUser(duplicateUser)
 		assert.Error(t, err)
-		assert.Equal(t, "用户名已存在", err.Error())
+		assertValidationCode(t, err, FieldUsername, ValidationCodeTaken)
 
 		// 验证原用户仍然存在
 		foundUser, err := service.GetUserByID(user1.ID)
@@ -73,7 +74,7 @@ func TestUserService(t *testing.T) {
 
 		err := service.CreateUser(duplicateEmailUser)
 		assert.Error(t, err)
-		assert.Equal(t, "邮箱已存在", err.Error())
+		assertValidationCode(t, err, FieldEmail, ValidationCodeTaken)
 
 		// 验证原用户仍然存在
 		foundUser, err := service.GetUserByID(user1.ID)
@@ -132,6 +133,40 @@ func TestUserService(t *testing.T) {
 		assert.Equal(t, "updateduser", updatedUser.Username)
 	})
 
+	t.Run("仅更新最后登录时间", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		user := testDB.CreateTestUser("testuser", "test@example.com", "password")
+
+		// 其他请求已修改了用户，内存中的user已过期
+		err := testDB.DB.Model(&User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"username":      "renameduser",
+			"password_hash": "new-hash",
+		}).Error
+		assert.NoError(t, err)
+
+		loginAt := time.Now().Truncate(time.Second)
+		err = service.UpdateLastLogin(user.ID, loginAt)
+		assert.NoError(t, err)
+
+		// 重复写入相同时间不应报错
+		err = service.UpdateLastLogin(user.ID, loginAt)
+		assert.NoError(t, err)
+
+		updatedUser, err := service.GetUserByID(user.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "renameduser", updatedUser.Username)
+		assert.Equal(t, "new-hash", updatedUser.PasswordHash)
+		assert.NotNil(t, updatedUser.LastLoginAt)
+		assert.True(t, loginAt.Equal(*updatedUser.LastLoginAt))
+
+		// 用户不存在
+		err = service.UpdateLastLogin(99999, loginAt)
+		assert.True(t, errors.Is(err, ErrUserNotFound))
+		assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+	})
+
 	t.Run("删除用户", func(t *testing.T) {
 		// 清理数据
 		testDB.ClearAllData()
@@ -146,6 +181,11 @@ func TestUserService(t *testing.T) {
 		_, err = service.GetUserByID(user.ID)
 		assert.Error(t, err)
 		assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+		assert.True(t, errors.Is(err, ErrUserNotFound))
+
+		// 删除不存在的用户
+		err = service.DeleteUser(user.ID)
+		assert.True(t, errors.Is(err, ErrUserNotFound))
 	})
 
 	t.Run("分页获取用户列表", func(t *testing.T) {
@@ -173,6 +213,64 @@ func TestUserService(t *testing.T) {
 		assert.Len(t, usersPage2, 5)
 	})
 
+	t.Run("分页获取用户列表-包含已删除用户", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		for i := 0; i < 3; i++ {
+			testDB.CreateTestUser(
+				fmt.Sprintf("user%d", i),
+				fmt.Sprintf("user%d@example.com", i),
+				"password",
+			)
+		}
+		deleted := testDB.CreateTestUser("deleteduser", "deleted@example.com", "password")
+		assert.NoError(t, service.DeleteUser(deleted.ID))
+
+		// 默认不包含已删除用户
+		_, total, err := service.ListUsers(1, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), total)
+
+		// 包含已删除用户
+		users, total, err := service.ListUsersWithFilter(UserFilter{IncludeDeleted: true}, 1, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(4), total)
+		assert.Len(t, users, 4)
+
+		// 仅已删除用户
+		users, total, err = service.ListUsersWithFilter(UserFilter{DeletedOnly: true}, 1, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), total)
+		assert.Len(t, users, 1)
+		assert.Equal(t, deleted.ID, users[0].ID)
+		assert.True(t, users[0].DeletedAt.Valid)
+	})
+
+	t.Run("根据邮箱和用户名获取已删除用户", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+
+		user := testDB.CreateTestUser("deleteduser", "deleted@example.com", "password")
+		assert.NoError(t, service.DeleteUser(user.ID))
+
+		_, err := service.GetUserByEmail(user.Email)
+		assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+		assert.True(t, errors.Is(err, ErrUserNotFound))
+
+		_, err = service.GetUserByUsername(user.Username)
+		assert.True(t, errors.Is(err, ErrUserNotFound))
+
+		foundByEmail, err := service.GetUserByEmailUnscoped(user.Email)
+		assert.NoError(t, err)
+		assert.Equal(t, user.ID, foundByEmail.ID)
+		assert.True(t, foundByEmail.DeletedAt.Valid)
+
+		foundByUsername, err := service.GetUserByUsernameUnscoped(user.Username)
+		assert.NoError(t, err)
+		assert.Equal(t, user.ID, foundByUsername.ID)
+	})
+
 	t.Run("邀请码验证", func(t *testing.T) {
 		// 清理数据
 		testDB.ClearAllData()
@@ -188,3 +286,21 @@ func TestUserService(t *testing.T) {
 		assert.False(t, invalid)
 	})
 }
+
+func TestWrapNotFound(t *testing.T) {
+	t.Run("包装记录不存在错误", func(t *testing.T) {
+		err := wrapNotFound(fmt.Errorf("查询失败: %w", gorm.ErrRecordNotFound), ErrUserNotFound)
+		assert.True(t, errors.Is(err, ErrUserNotFound))
+		assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+		assert.False(t, errors.Is(err, ErrRoleNotFound))
+	})
+
+	t.Run("其他错误保持不变", func(t *testing.T) {
+		dbErr := errors.New("connection refused")
+		err := wrapNotFound(dbErr, ErrUserNotFound)
+		assert.Equal(t, dbErr, err)
+		assert.False(t, errors.Is(err, ErrUserNotFound))
+
+		assert.NoError(t, wrapNotFound(nil, ErrUserNotFound))
+	})
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 租户限额错误定义
+var (
+	ErrSeatLimitReached    = errors.New("租户用户数已达上限")
+	ErrSessionLimitReached = errors.New("租户活跃会话数已达上限")
+)
+
+// TenantLimitError 租户超出限额，可用errors.Is匹配ErrSeatLimitReached或ErrSessionLimitReached
+type TenantLimitError struct {
+	Err      error // ErrSeatLimitReached或ErrSessionLimitReached
+	TenantID uint
+	Limit    int
+	Count    int64
+}
+
+// Error 实现error接口
+func (e *TenantLimitError) Error() string {
+	return fmt.Sprintf("%s: tenant=%d limit=%d", e.Err.Error(), e.TenantID, e.Limit)
+}
+
+// Unwrap 支持errors.Is匹配具体的限额错误
+func (e *TenantLimitError) Unwrap() error {
+	return e.Err
+}
+
+// TenantLimits 租户限额，未设置的租户不受限制
+type TenantLimits struct {
+	TenantID          uint       `gorm:"primaryKey;autoIncrement:false" json:"tenant_id"`
+	MaxUsers          int        `gorm:"not null;default:0" json:"max_users"`           // 未删除用户数上限，0表示不限制
+	MaxActiveSessions int        `gorm:"not null;default:0" json:"max_active_sessions"` // 未过期会话数上限，0表示不限制
+	OverrideUntil     *time.Time `json:"override_until,omitempty"`                      // 管理员临时解除限额的截止时间
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// TableName 设置表名
+func (TenantLimits) TableName() string {
+	return "sys_tenant_limits"
+}
+
+// OverrideActive 检查管理员临时解除限额是否在指定时间生效
+func (l *TenantLimits) OverrideActive(now time.Time) bool {
+	return l.OverrideUntil != nil && now.Before(*l.OverrideUntil)
+}
+
+// TenantUsage 租户当前用量
+type TenantUsage struct {
+	Limits         TenantLimits `json:"limits"`
+	Users          int64        `json:"users"`
+	ActiveSessions int64        `json:"active_sessions"`
+}
+
+// TenantLimitConfig 租户限额配置
+type TenantLimitConfig struct {
+	// 计数的缓存时间，0表示每次检查都查询；缓存期内通过的检查会计入缓存的计数，并发注册或登录不会越过上限
+	CountCacheTTL time.Duration
+	AuditLogger   AuditLogger // 达到限额时记录事件，为nil时不记录
+}
+
+// DefaultTenantLimitConfig 默认租户限额配置
+func DefaultTenantLimitConfig() *TenantLimitConfig {
+	return &TenantLimitConfig{
+		CountCacheTTL: 5 * time.Second,
+	}
+}
+
+// TenantLimitService 租户限额服务接口
+type TenantLimitService interface {
+	// 设置租户的用户数和活跃会话数上限，0表示不限制
+	SetTenantLimits(tenantID uint, maxUsers, maxActiveSessions int) error
+	// 获取租户限额，未设置时返回不限制的限额
+	GetTenantLimits(tenantID uint) (*TenantLimits, error)
+	// 在until之前临时解除租户的全部限额，until为零值时立即恢复
+	OverrideTenantLimits(tenantID uint, until time.Time) error
+	// 获取租户当前用量，不使用缓存
+	TenantUsage(tenantID uint) (TenantUsage, error)
+	// 检查租户是否还能新增用户，达到上限时返回ErrSeatLimitReached
+	CheckSeat(tenantID uint) error
+	// 检查租户是否还能新增会话，达到上限时返回ErrSessionLimitReached
+	CheckSessions(tenantID uint) error
+}
+
+// tenantCountKind 租户计数类型
+type tenantCountKind int
+
+const (
+	tenantCountUsers tenantCountKind = iota
+	tenantCountSessions
+)
+
+// tenantCountKey 租户计数缓存键
+type tenantCountKey struct {
+	tenantID uint
+	kind     tenantCountKind
+}
+
+// tenantCount 缓存的租户计数
+type tenantCount struct {
+	count     int64
+	expiresAt time.Time
+}
+
+// tenantLimitService 租户限额服务实现
+type tenantLimitService struct {
+	db          *gorm.DB
+	config      *TenantLimitConfig
+	auditLogger AuditLogger
+	counts      map[tenantCountKey]tenantCount
+	mutex       sync.Mutex
+}
+
+// NewTenantLimitService 创建租户限额服务
+//
+// 用户数按sys_users.tenant_id统计未删除的用户；活跃会话数按sys_sessions统计未过期的会话，
+// 只适用于NewOpaqueTokenService签发的会话Token。两个计数都走索引。
+func NewTenantLimitService(db *gorm.DB, config *TenantLimitConfig) TenantLimitService {
+	if config == nil {
+		config = DefaultTenantLimitConfig()
+	}
+	auditLogger := config.AuditLogger
+	if auditLogger == nil {
+		auditLogger = noopAuditLogger{}
+	}
+
+	return &tenantLimitService{
+		db:          db,
+		config:      config,
+		auditLogger: auditLogger,
+		counts:      make(map[tenantCountKey]tenantCount),
+	}
+}
+
+// SetTenantLimits 设置租户限额
+func (s *tenantLimitService) SetTenantLimits(tenantID uint, maxUsers, maxActiveSessions int) error {
+	if tenantID == 0 {
+		return errors.New("租户ID不能为0")
+	}
+	if maxUsers < 0 || maxActiveSessions < 0 {
+		return errors.New("限额不能为负数")
+	}
+
+	limits := &TenantLimits{TenantID: tenantID}
+	err := s.db.Where(TenantLimits{TenantID: tenantID}).
+		Assign(map[string]interface{}{"max_users": maxUsers, "max_active_sessions": maxActiveSessions}).
+		FirstOrCreate(limits).Error
+	if err != nil {
+		return err
+	}
+	s.invalidate(tenantID)
+	return nil
+}
+
+// GetTenantLimits 获取租户限额
+func (s *tenantLimitService) GetTenantLimits(tenantID uint) (*TenantLimits, error) {
+	var limits TenantLimits
+	err := s.db.Where("tenant_id = ?", tenantID).First(&limits).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &TenantLimits{TenantID: tenantID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &limits, nil
+}
+
+// OverrideTenantLimits 临时解除租户限额
+func (s *tenantLimitService) OverrideTenantLimits(tenantID uint, until time.Time) error {
+	if tenantID == 0 {
+		return errors.New("租户ID不能为0")
+	}
+
+	var overrideUntil interface{}
+	if !until.IsZero() {
+		overrideUntil = until
+	}
+	limits := &TenantLimits{TenantID: tenantID}
+	return s.db.Where(TenantLimits{TenantID: tenantID}).
+		Assign(map[string]interface{}{"override_until": overrideUntil}).
+		FirstOrCreate(limits).Error
+}
+
+// TenantUsage 获取租户当前用量
+func (s *tenantLimitService) TenantUsage(tenantID uint) (TenantUsage, error) {
+	limits, err := s.GetTenantLimits(tenantID)
+	if err != nil {
+		return TenantUsage{}, err
+	}
+	users, err := s.queryCount(tenantID, tenantCountUsers)
+	if err != nil {
+		return TenantUsage{}, err
+	}
+	sessions, err := s.queryCount(tenantID, tenantCountSessions)
+	if err != nil {
+		return TenantUsage{}, err
+	}
+	return TenantUsage{Limits: *limits, Users: users, ActiveSessions: sessions}, nil
+}
+
+// CheckSeat 检查租户是否还能新增用户
+func (s *tenantLimitService) CheckSeat(tenantID uint) error {
+	return s.check(tenantID, tenantCountUsers)
+}
+
+// CheckSessions 检查租户是否还能新增会话
+func (s *tenantLimitService) CheckSessions(tenantID uint) error {
+	return s.check(tenantID, tenantCountSessions)
+}
+
+// check 检查租户的计数是否已达上限，未达上限时在缓存中预占一个名额
+func (s *tenantLimitService) check(tenantID uint, kind tenantCountKind) error {
+	if tenantID == 0 {
+		return nil
+	}
+
+	limits, err := s.GetTenantLimits(tenantID)
+	if err != nil {
+		return err
+	}
+	limit, limitErr, event := limits.MaxUsers, ErrSeatLimitReached, AuditEventTenantSeatLimitReached
+	if kind == tenantCountSessions {
+		limit, limitErr, event = limits.MaxActiveSessions, ErrSessionLimitReached, AuditEventTenantSessionLimitReached
+	}
+	now := time.Now()
+	if limit <= 0 || limits.OverrideActive(now) {
+		return nil
+	}
+
+	count, err := s.reserve(tenantCountKey{tenantID: tenantID, kind: kind}, int64(limit), now)
+	if err != nil {
+		return err
+	}
+	if count < int64(limit) {
+		return nil
+	}
+
+	if err := s.auditLogger.Log(AuditEvent{
+		Type:   event,
+		Detail: fmt.Sprintf("tenant_id=%d limit=%d count=%d", tenantID, limit, count),
+	}); err != nil {
+		return err
+	}
+	return &TenantLimitError{Err: limitErr, TenantID: tenantID, Limit: limit, Count: count}
+}
+
+// reserve 返回预占前的计数，计数小于limit时在缓存中加一
+//
+// 缓存过期或未开启缓存时查询数据库。查询在锁外执行，缓存失效瞬间的并发检查可能各自查询，以最后写入的结果为准。
+func (s *tenantLimitService) reserve(key tenantCountKey, limit int64, now time.Time) (int64, error) {
+	s.mutex.Lock()
+	cached, ok := s.counts[key]
+	if ok && now.Before(cached.expiresAt) {
+		count := cached.count
+		if count < limit {
+			cached.count++
+			s.counts[key] = cached
+		}
+		s.mutex.Unlock()
+		return count, nil
+	}
+	s.mutex.Unlock()
+
+	count, err := s.queryCount(key.tenantID, key.kind)
+	if err != nil {
+		return 0, err
+	}
+	if s.config.CountCacheTTL > 0 {
+		reserved := count
+		if count < limit {
+			reserved++
+		}
+		s.mutex.Lock()
+		s.counts[key] = tenantCount{count: reserved, expiresAt: now.Add(s.config.CountCacheTTL)}
+		s.mutex.Unlock()
+	}
+	return count, nil
+}
+
+// queryCount 查询租户的用户数或未过期会话数
+func (s *tenantLimitService) queryCount(tenantID uint, kind tenantCountKind) (int64, error) {
+	var count int64
+	var err error
+	switch kind {
+	case tenantCountUsers:
+		err = s.db.Model(&User{}).Where("tenant_id = ?", tenantID).Count(&count).Error
+	case tenantCountSessions:
+		err = s.db.Model(&Session{}).
+			Joins("JOIN sys_users ON sys_users.id = sys_sessions.user_id").
+			Where("sys_users.tenant_id = ? AND sys_users.deleted_at IS NULL AND sys_sessions.expires_at > ?", tenantID, time.Now()).
+			Count(&count).Error
+	}
+	return count, err
+}
+
+// invalidate 清除租户的计数缓存
+func (s *tenantLimitService) invalidate(tenantID uint) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.counts, tenantCountKey{tenantID: tenantID, kind: tenantCountUsers})
+	delete(s.counts, tenantCountKey{tenantID: tenantID, kind: tenantCountSessions})
+}
+
+// checkTenantSessions 登录时检查用户所属租户的活跃会话数，tenantLimits为nil时不检查
+func checkTenantSessions(tenantLimits TenantLimitService, user *User) error {
+	if tenantLimits == nil {
+		return nil
+	}
+	return tenantLimits.CheckSessions(user.TenantID)
+}
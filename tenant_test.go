@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestTenantLimitError(t *testing.T) {
+	var err error = &TenantLimitError{Err: ErrSeatLimitReached, TenantID: 3, Limit: 10, Count: 10}
+	assert.True(t, errors.Is(err, ErrSeatLimitReached))
+	assert.False(t, errors.Is(err, ErrSessionLimitReached))
+	assert.Contains(t, err.Error(), "tenant=3")
+
+	limits := &TenantLimits{}
+	assert.False(t, limits.OverrideActive(time.Now()))
+	until := time.Now().Add(time.Hour)
+	limits.OverrideUntil = &until
+	assert.True(t, limits.OverrideActive(time.Now()))
+	assert.False(t, limits.OverrideActive(until.Add(time.Second)))
+}
+
+func TestTenantCountReserve(t *testing.T) {
+	// 只生成SQL，不连接数据库，查询的计数总是0
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "dry:run@tcp(127.0.0.1:1)/dry", SkipInitializeWithVersion: true}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	assert.NoError(t, err)
+
+	service := NewTenantLimitService(db, &TenantLimitConfig{CountCacheTTL: time.Minute}).(*tenantLimitService)
+	key := tenantCountKey{tenantID: 1, kind: tenantCountUsers}
+	now := time.Now()
+
+	// 缓存期内通过的检查计入缓存的计数
+	for want := int64(0); want < 2; want++ {
+		count, err := service.reserve(key, 2, now)
+		assert.NoError(t, err)
+		assert.Equal(t, want, count)
+	}
+	count, err := service.reserve(key, 2, now)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	// 缓存过期后重新查询
+	count, err = service.reserve(key, 2, now.Add(2*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+
+	// 修改限额时清除缓存
+	service.invalidate(1)
+	_, ok := service.counts[key]
+	assert.False(t, ok)
+}
+
+func TestTenantLimits(t *testing.T) {
+	// 设置测试数据库
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	newUser := func(username string, tenantID uint) *User {
+		return &User{Username: username, Email: username + "@example.com", PasswordHash: "password123", Status: 1, TenantID: tenantID}
+	}
+
+	t.Run("用户数达到上限时拒绝创建", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+		auditLogger := NewMemoryAuditLogger()
+		limits := NewTenantLimitService(testDB.DB, &TenantLimitConfig{AuditLogger: auditLogger})
+		userService := NewUserServiceWithTenantLimits(testDB.DB, limits)
+		assert.NoError(t, limits.SetTenantLimits(1, 2, 0))
+
+		assert.NoError(t, userService.CreateUser(newUser("alice", 1)))
+		assert.NoError(t, userService.CreateUser(newUser("bob", 1)))
+
+		err := userService.CreateUser(newUser("carol", 1))
+		var limitErr *TenantLimitError
+		assert.True(t, errors.As(err, &limitErr))
+		assert.True(t, errors.Is(err, ErrSeatLimitReached))
+		assert.Equal(t, int64(2), limitErr.Count)
+
+		events := auditLogger.Events()
+		if assert.Len(t, events, 1) {
+			assert.Equal(t, AuditEventTenantSeatLimitReached, events[0].Type)
+		}
+
+		// 其他租户和无租户用户不受影响
+		assert.NoError(t, userService.CreateUser(newUser("dave", 2)))
+		assert.NoError(t, userService.CreateUser(newUser("erin", 0)))
+
+		// 删除用户后释放名额
+		bob, err := userService.GetUserByUsername("bob")
+		assert.NoError(t, err)
+		assert.NoError(t, userService.DeleteUser(bob.ID))
+		assert.NoError(t, userService.CreateUser(newUser("carol", 1)))
+
+		usage, err := limits.TenantUsage(1)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), usage.Users)
+		assert.Equal(t, 2, usage.Limits.MaxUsers)
+	})
+
+	t.Run("活跃会话数达到上限时拒绝登录", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+		auditLogger := NewMemoryAuditLogger()
+		limits := NewTenantLimitService(testDB.DB, &TenantLimitConfig{AuditLogger: auditLogger})
+		assert.NoError(t, limits.SetTenantLimits(1, 0, 2))
+
+		userService := NewUserService(testDB.DB)
+		assert.NoError(t, userService.CreateUser(newUser("alice", 1)))
+		config := DefaultAuthConfig()
+		config.TenantLimits = limits
+		service := NewAuthServiceWithConfig(testDB.DB, userService, NewOpaqueTokenService(testDB.DB, nil), config)
+
+		for i := 0; i < 2; i++ {
+			_, _, err := service.Login("alice", "password123")
+			assert.NoError(t, err)
+		}
+
+		_, token, err := service.Login("alice", "password123")
+		assert.True(t, errors.Is(err, ErrSessionLimitReached))
+		assert.Empty(t, token)
+
+		events := auditLogger.Events()
+		if assert.Len(t, events, 1) {
+			assert.Equal(t, AuditEventTenantSessionLimitReached, events[0].Type)
+		}
+
+		// 过期的会话不计入
+		assert.NoError(t, testDB.DB.Model(&Session{}).Where("1 = 1").Update("expires_at", time.Now().Add(-time.Minute)).Error)
+		_, _, err = service.Login("alice", "password123")
+		assert.NoError(t, err)
+	})
+
+	t.Run("管理员临时解除限额", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+		limits := NewTenantLimitService(testDB.DB, &TenantLimitConfig{})
+		userService := NewUserServiceWithTenantLimits(testDB.DB, limits)
+		assert.NoError(t, limits.SetTenantLimits(1, 1, 0))
+		assert.NoError(t, userService.CreateUser(newUser("alice", 1)))
+		assert.True(t, errors.Is(userService.CreateUser(newUser("bob", 1)), ErrSeatLimitReached))
+
+		assert.NoError(t, limits.OverrideTenantLimits(1, time.Now().Add(time.Hour)))
+		assert.NoError(t, userService.CreateUser(newUser("bob", 1)))
+
+		// 恢复后限额重新生效
+		assert.NoError(t, limits.OverrideTenantLimits(1, time.Time{}))
+		assert.True(t, errors.Is(userService.CreateUser(newUser("carol", 1)), ErrSeatLimitReached))
+
+		stored, err := limits.GetTenantLimits(1)
+		assert.NoError(t, err)
+		assert.Nil(t, stored.OverrideUntil)
+	})
+
+	t.Run("参数校验", func(t *testing.T) {
+		limits := NewTenantLimitService(testDB.DB, nil)
+		assert.Error(t, limits.SetTenantLimits(0, 1, 1))
+		assert.Error(t, limits.SetTenantLimits(1, -1, 1))
+		assert.Error(t, limits.OverrideTenantLimits(0, time.Now()))
+
+		// 未设置限额的租户不受限制
+		stored, err := limits.GetTenantLimits(99)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, stored.MaxUsers)
+		assert.NoError(t, limits.CheckSeat(99))
+	})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"aigo_service_auth/errorcodes"
+)
+
+// 服务条款错误定义
+var (
+	ErrTermsAcceptanceRequired = errors.New("需要同意最新的服务条款")
+	ErrInvalidTermsVersion     = errors.New("服务条款版本不能为空")
+)
+
+// TermsAcceptanceRequiredError 用户未同意当前要求的服务条款版本，可用errors.Is匹配ErrTermsAcceptanceRequired
+type TermsAcceptanceRequiredError struct {
+	RequiredVersion string // 当前要求的版本
+	AcceptedVersion string // 用户已同意的版本，从未同意时为空
+}
+
+// Error 实现error接口
+func (e *TermsAcceptanceRequiredError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrTermsAcceptanceRequired.Error(), e.RequiredVersion)
+}
+
+// Is 支持errors.Is(err, ErrTermsAcceptanceRequired)
+func (e *TermsAcceptanceRequiredError) Is(target error) bool {
+	return target == ErrTermsAcceptanceRequired
+}
+
+// NeedsTermsAcceptance 检查用户是否需要同意required版本的服务条款，required为空时不要求
+//
+// 版本只做字符串比较，与required不同即需要重新同意，不区分新旧。
+func (u *User) NeedsTermsAcceptance(required string) bool {
+	return required != "" && u.AcceptedTermsVersion != required
+}
+
+// checkTermsAcceptance 登录时检查服务条款，accepted为本次登录同意的版本
+//
+// 用户已同意要求的版本时直接通过；本次登录同意了要求的版本时记录同意后通过；否则返回TermsAcceptanceRequiredError。
+func checkTermsAcceptance(us UserService, required string, user *User, accepted string) error {
+	if !user.NeedsTermsAcceptance(required) {
+		return nil
+	}
+	if accepted != required {
+		return &TermsAcceptanceRequiredError{RequiredVersion: required, AcceptedVersion: user.AcceptedTermsVersion}
+	}
+	if err := us.AcceptTerms(user.ID, accepted); err != nil {
+		return err
+	}
+	user.AcceptedTermsVersion = accepted
+	return nil
+}
+
+// termsRequiredResponse 未同意服务条款的响应体
+type termsRequiredResponse struct {
+	Code            string `json:"code"`
+	Message         string `json:"message"`
+	RequiredVersion string `json:"required_version"`
+}
+
+// RequireTermsAccepted 要求用户已同意requiredVersion版本服务条款的中间件，需在RequireAuth之后使用
+//
+// 从数据库重新加载用户以获取最新的同意状态，未同意时返回403和terms_acceptance_required；
+// allowedPaths中的路径（如同意条款的接口）不受限制。requiredVersion为空时不做限制。
+func (m *AuthMiddleware) RequireTermsAccepted(us UserService, requiredVersion string, allowedPaths ...string) func(http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(allowedPaths))
+	for _, path := range allowedPaths {
+		allowed[path] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if requiredVersion == "" || allowed[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// 从上下文获取用户
+			user, ok := GetUserFromContext(r.Context())
+			if !ok {
+				m.unauthorized(w, r, errorcodes.ErrCodeUnauthenticated, "缺少认证信息")
+				return
+			}
+
+			current, err := us.GetUserByID(user.ID)
+			if err != nil {
+				writeErrorCode(w, errorcodes.ErrCodeInternal, "用户信息获取失败")
+				return
+			}
+
+			if current.NeedsTermsAcceptance(requiredVersion) {
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				w.WriteHeader(errorcodes.HTTPStatusOf(errorcodes.ErrCodeTermsAcceptanceRequired))
+				json.NewEncoder(w).Encode(termsRequiredResponse{
+					Code:            errorcodes.ErrCodeTermsAcceptanceRequired,
+					Message:         ErrTermsAcceptanceRequired.Error(),
+					RequiredVersion: requiredVersion,
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTermsAcceptanceRequiredError(t *testing.T) {
+	var err error = &TermsAcceptanceRequiredError{RequiredVersion: "2024-06", AcceptedVersion: "2024-01"}
+	assert.True(t, errors.Is(err, ErrTermsAcceptanceRequired))
+	assert.Contains(t, err.Error(), "2024-06")
+
+	var termsErr *TermsAcceptanceRequiredError
+	assert.True(t, errors.As(err, &termsErr))
+	assert.Equal(t, "2024-01", termsErr.AcceptedVersion)
+}
+
+func TestNeedsTermsAcceptance(t *testing.T) {
+	user := &User{AcceptedTermsVersion: "v2"}
+	assert.False(t, user.NeedsTermsAcceptance(""))
+	assert.False(t, user.NeedsTermsAcceptance("v2"))
+	assert.True(t, user.NeedsTermsAcceptance("v3"))
+	// 只比较是否相同，不区分新旧
+	assert.True(t, user.NeedsTermsAcceptance("v1"))
+	assert.True(t, (&User{}).NeedsTermsAcceptance("v1"))
+}
+
+// stubTermsUserService 测试用用户服务，记录AcceptTerms调用
+type stubTermsUserService struct {
+	UserService
+	accepted map[uint]string
+}
+
+func (s *stubTermsUserService) AcceptTerms(userID uint, version string) error {
+	s.accepted[userID] = version
+	return nil
+}
+
+func TestCheckTermsAcceptance(t *testing.T) {
+	us := &stubTermsUserService{accepted: make(map[uint]string)}
+	user := &User{AcceptedTermsVersion: "v1"}
+	user.ID = 7
+
+	assert.NoError(t, checkTermsAcceptance(us, "", user, ""))
+	assert.NoError(t, checkTermsAcceptance(us, "v1", user, ""))
+	assert.Empty(t, us.accepted)
+
+	err := checkTermsAcceptance(us, "v2", user, "v1")
+	assert.Equal(t, &TermsAcceptanceRequiredError{RequiredVersion: "v2", AcceptedVersion: "v1"}, err)
+	assert.Empty(t, us.accepted)
+
+	assert.NoError(t, checkTermsAcceptance(us, "v2", user, "v2"))
+	assert.Equal(t, map[uint]string{7: "v2"}, us.accepted)
+	assert.Equal(t, "v2", user.AcceptedTermsVersion)
+}
+
+func TestTermsAcceptance(t *testing.T) {
+	// 设置测试数据库
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	newService := func(required string) (AuthService, *AuthConfig) {
+		config := DefaultAuthConfig()
+		config.RequiredTermsVersion = required
+		userService := NewUserService(testDB.DB)
+		tokenService := NewTokenService("test-secret-key", time.Hour)
+		return NewAuthServiceWithConfig(testDB.DB, userService, tokenService, config), config
+	}
+
+	t.Run("注册时记录同意的版本", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+		service, _ := newService("2024-06")
+
+		_, _, err := service.Register("alice", "alice@example.com", "password123", "")
+		var termsErr *TermsAcceptanceRequiredError
+		assert.True(t, errors.As(err, &termsErr))
+		assert.Equal(t, "2024-06", termsErr.RequiredVersion)
+
+		_, _, err = service.RegisterWithOptions("alice", "alice@example.com", "password123", RegisterOptions{AcceptedTermsVersion: "2024-01"})
+		assert.True(t, errors.Is(err, ErrTermsAcceptanceRequired))
+
+		user, token, err := service.RegisterWithOptions("alice", "alice@example.com", "password123", RegisterOptions{AcceptedTermsVersion: "2024-06"})
+		assert.NoError(t, err)
+		assert.NotEmpty(t, token)
+
+		stored, err := NewUserService(testDB.DB).GetUserByID(user.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "2024-06", stored.AcceptedTermsVersion)
+		if assert.NotNil(t, stored.AcceptedTermsAt) {
+			assert.WithinDuration(t, time.Now(), *stored.AcceptedTermsAt, time.Minute)
+		}
+	})
+
+	t.Run("注册服务只记录不强制", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+		registerService := NewRegisterService(NewUserService(testDB.DB), NewTokenService("test-secret-key", time.Hour))
+
+		user, _, err := registerService.RegisterWithOptions("bob", "bob@example.com", "password123", RegisterOptions{AcceptedTermsVersion: "v1"})
+		assert.NoError(t, err)
+		assert.Equal(t, "v1", user.AcceptedTermsVersion)
+
+		user, _, err = registerService.Register("carol", "carol@example.com", "password123", "")
+		assert.NoError(t, err)
+		assert.Empty(t, user.AcceptedTermsVersion)
+		assert.Nil(t, user.AcceptedTermsAt)
+	})
+
+	t.Run("版本更新后登录需要重新同意", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+		service, config := newService("v1")
+		_, _, err := service.RegisterWithOptions("alice", "alice@example.com", "password123", RegisterOptions{AcceptedTermsVersion: "v1"})
+		assert.NoError(t, err)
+
+		_, _, err = service.Login("alice", "password123")
+		assert.NoError(t, err)
+
+		config.RequiredTermsVersion = "v2"
+		_, token, err := service.Login("alice", "password123")
+		var termsErr *TermsAcceptanceRequiredError
+		assert.True(t, errors.As(err, &termsErr))
+		assert.Equal(t, TermsAcceptanceRequiredError{RequiredVersion: "v2", AcceptedVersion: "v1"}, *termsErr)
+		assert.Empty(t, token)
+
+		// 密码错误时不提示条款
+		_, _, err = service.Login("alice", "wrongpassword")
+		assert.False(t, errors.Is(err, ErrTermsAcceptanceRequired))
+
+		// 同意其他版本无效
+		_, _, err = service.LoginWithClient("alice", "password123", ClientInfo{AcceptedTermsVersion: "v1"})
+		assert.True(t, errors.Is(err, ErrTermsAcceptanceRequired))
+
+		// 登录时同意当前版本
+		user, token, err := service.LoginWithClient("alice", "password123", ClientInfo{AcceptedTermsVersion: "v2"})
+		assert.NoError(t, err)
+		assert.NotEmpty(t, token)
+		assert.Equal(t, "v2", user.AcceptedTermsVersion)
+
+		_, _, err = service.Login("alice", "password123")
+		assert.NoError(t, err)
+	})
+
+	t.Run("AcceptTerms记录版本和时间", func(t *testing.T) {
+		// 清理数据
+		testDB.ClearAllData()
+		userService := NewUserService(testDB.DB)
+		user := testDB.CreateTestUser("alice", "alice@example.com", "password123")
+
+		assert.NoError(t, userService.AcceptTerms(user.ID, "v3"))
+		stored, err := userService.GetUserByID(user.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "v3", stored.AcceptedTermsVersion)
+		assert.NotNil(t, stored.AcceptedTermsAt)
+
+		assert.True(t, errors.Is(userService.AcceptTerms(user.ID, ""), ErrInvalidTermsVersion))
+		assert.True(t, errors.Is(userService.AcceptTerms(user.ID+100, "v3"), ErrUserNotFound))
+	})
+}
+
+func TestRequireTermsAccepted(t *testing.T) {
+	user := &User{Username: "alice", AcceptedTermsVersion: "v1"}
+	user.ID = 7
+
+	serve := func(handler func(http.Handler) http.Handler, path string, withUser bool) (*httptest.ResponseRecorder, bool) {
+		called := false
+		wrapped := handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			w.WriteHeader(http.StatusOK)
+		}))
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if withUser {
+			req = req.WithContext(context.WithValue(req.Context(), UserContextKey, user))
+		}
+		recorder := httptest.NewRecorder()
+		wrapped.ServeHTTP(recorder, req)
+		return recorder, called
+	}
+	middleware := NewAuthMiddleware(nil)
+
+	t.Run("已同意当前版本时放行", func(t *testing.T) {
+		recorder, called := serve(middleware.RequireTermsAccepted(&stubUserLookup{user: user}, "v1"), "/api/profile", true)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.True(t, called)
+	})
+
+	t.Run("版本更新后阻止访问", func(t *testing.T) {
+		recorder, called := serve(middleware.RequireTermsAccepted(&stubUserLookup{user: user}, "v2", "/api/terms/accept"), "/api/profile", true)
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+		assert.False(t, called)
+
+		var body map[string]string
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+		assert.Equal(t, "terms_acceptance_required", body["code"])
+		assert.Equal(t, "v2", body["required_version"])
+
+		// 同意条款的接口不受限制
+		recorder, called = serve(middleware.RequireTermsAccepted(&stubUserLookup{user: user}, "v2", "/api/terms/accept"), "/api/terms/accept", true)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.True(t, called)
+	})
+
+	t.Run("未配置版本时不限制", func(t *testing.T) {
+		recorder, called := serve(middleware.RequireTermsAccepted(&stubUserLookup{err: errors.New("不应查询")}, ""), "/api/profile", false)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.True(t, called)
+	})
+
+	t.Run("缺少用户或加载失败", func(t *testing.T) {
+		recorder, called := serve(middleware.RequireTermsAccepted(&stubUserLookup{user: user}, "v2"), "/api/profile", false)
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		assert.False(t, called)
+
+		recorder, called = serve(middleware.RequireTermsAccepted(&stubUserLookup{err: errors.New("数据库连接失败")}, "v2"), "/api/profile", true)
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+		assert.False(t, called)
+	})
+}
@@ -5,10 +5,16 @@ import (
 	"os"
 	"testing"
 
+	"aigo_service_auth/migrations"
+	"aigo_service_auth/testfixtures"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
+// testTables 测试使用的表，按删除顺序排列以避免外键约束问题
+var testTables = testfixtures.Tables
+
 // TestDB 测试数据库管理器
 type TestDB struct {
 	DB       *gorm.DB
@@ -16,7 +22,7 @@ type TestDB struct {
 }
 
 // SetupTestDB 设置测试数据库
-func SetupTestDB(t *testing.T) *TestDB {
+func SetupTestDB(t testing.TB) *TestDB {
 	// 获取数据库连接信息
 	dsn := os.Getenv("MYSQL_DSN")
 	if dsn == "" {
@@ -29,6 +35,26 @@ func SetupTestDB(t *testing.T) *TestDB {
 		t.Skipf("无法连接到MySQL数据库: %v。请确保MySQL服务器正在运行并可以访问。", err)
 	}
 
+	return setupTestDB(t, db)
+}
+
+// SetupPostgresTestDB 设置PostgreSQL测试数据库，未设置POSTGRES_DSN时跳过
+func SetupPostgresTestDB(t testing.TB) *TestDB {
+	dsn := os.Getenv("POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("未设置POSTGRES_DSN，跳过PostgreSQL测试")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Skipf("无法连接到PostgreSQL数据库: %v。请确保PostgreSQL服务器正在运行并可以访问。", err)
+	}
+
+	return setupTestDB(t, db)
+}
+
+// setupTestDB 验证连接、清理并迁移测试数据库
+func setupTestDB(t testing.TB, db *gorm.DB) *TestDB {
 	// 验证数据库连接
 	sqlDB, err := db.DB()
 	if err != nil {
@@ -46,29 +72,29 @@ func SetupTestDB(t *testing.T) *TestDB {
 	// 清理数据库
 	testDB.CleanupDB()
 
-	// 自动迁移表结构
-	err = db.AutoMigrate(&User{}, &Role{}, &Permission{}, &UserRole{}, &RolePermission{})
-	if err != nil {
+	// 执行数据库迁移
+	if err := migrations.Migrate(db); err != nil {
 		t.Fatalf("表迁移失败: %v", err)
 	}
 
 	return testDB
 }
 
-// CleanupDB 清理数据库
+// CleanupDB 清理数据库，同时删除迁移记录，使之后的迁移重新建表
 func (tdb *TestDB) CleanupDB() {
+	tables := append(append([]string{}, testTables...), migrations.SchemaMigration{}.TableName())
+
+	if tdb.isPostgres() {
+		for _, table := range tables {
+			tdb.DB.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s CASCADE", table))
+		}
+		return
+	}
+
 	// 禁用外键检查
 	tdb.DB.Exec("SET FOREIGN_KEY_CHECKS = 0")
 
 	// 按正确顺序删除表以避免外键约束问题
-	tables := []string{
-		"sys_user_roles",
-		"sys_role_permissions",
-		"sys_users",
-		"sys_roles",
-		"sys_permissions",
-	}
-
 	for _, table := range tables {
 		tdb.DB.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", table))
 	}
@@ -85,26 +111,14 @@ func (tdb *TestDB) TeardownTestDB() {
 
 // ClearAllData 清理所有数据但保留表结构
 func (tdb *TestDB) ClearAllData() {
-	// 禁用外键检查
-	tdb.DB.Exec("SET FOREIGN_KEY_CHECKS = 0")
-
-	// 清理所有表数据
-	tables := []string{
-		"sys_user_roles",
-		"sys_role_permissions",
-		"sys_users",
-		"sys_roles",
-		"sys_permissions",
-	}
-
-	for _, table := range tables {
-		tdb.DB.Exec(fmt.Sprintf("DELETE FROM %s", table))
-		// 重置自增ID
-		tdb.DB.Exec(fmt.Sprintf("ALTER TABLE %s AUTO_INCREMENT = 1", table))
+	if err := testfixtures.ClearAllData(tdb.DB); err != nil {
+		panic(fmt.Sprintf("清理测试数据失败: %v", err))
 	}
+}
 
-	// 重新启用外键检查
-	tdb.DB.Exec("SET FOREIGN_KEY_CHECKS = 1")
+// isPostgres 是否为PostgreSQL数据库
+func (tdb *TestDB) isPostgres() bool {
+	return tdb.DB.Dialector.Name() == "postgres"
 }
 
 // CreateTestUser 创建测试用户
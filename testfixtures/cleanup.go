@@ -0,0 +1,80 @@
+package testfixtures
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Tables 认证服务的全部数据表，按删除顺序排列以避免外键约束问题
+var Tables = []string{
+	"sys_password_histories",
+	"sys_user_recovery_codes",
+	"sys_user_mfa",
+	"sys_password_reset_codes",
+	"sys_verification_codes",
+	"sys_known_devices",
+	"sys_token_watermarks",
+	"sys_sessions",
+	"sys_user_roles",
+	"sys_role_permissions",
+	"sys_users",
+	"sys_roles",
+	"sys_permissions",
+	"sys_tenant_limits",
+}
+
+// ClearAllData 清理Tables中的全部数据并重置自增ID，保留表结构
+//
+// 按数据库方言选择清理方式，支持MySQL、PostgreSQL和SQLite，其他数据库只删除数据。
+func ClearAllData(db *gorm.DB) error {
+	return ClearTables(db, Tables...)
+}
+
+// ClearTables 清理指定表的数据并重置自增ID，调用方可追加自己的表
+func ClearTables(db *gorm.DB, tables ...string) error {
+	switch db.Dialector.Name() {
+	case "postgres":
+		for _, table := range tables {
+			if err := db.Exec(fmt.Sprintf("TRUNCATE TABLE %s RESTART IDENTITY CASCADE", table)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "mysql":
+		// 禁用外键检查，清理后重新启用
+		if err := db.Exec("SET FOREIGN_KEY_CHECKS = 0").Error; err != nil {
+			return err
+		}
+		defer db.Exec("SET FOREIGN_KEY_CHECKS = 1")
+
+		for _, table := range tables {
+			if err := db.Exec(fmt.Sprintf("DELETE FROM %s", table)).Error; err != nil {
+				return err
+			}
+			if err := db.Exec(fmt.Sprintf("ALTER TABLE %s AUTO_INCREMENT = 1", table)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "sqlite":
+		for _, table := range tables {
+			if err := db.Exec(fmt.Sprintf("DELETE FROM %s", table)).Error; err != nil {
+				return err
+			}
+		}
+		// 没有AUTOINCREMENT列时sqlite_sequence不存在，忽略错误
+		db.Exec("DELETE FROM sqlite_sequence")
+		return nil
+
+	default:
+		for _, table := range tables {
+			if err := db.Exec(fmt.Sprintf("DELETE FROM %s", table)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
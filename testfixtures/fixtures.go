@@ -0,0 +1,303 @@
+// Package testfixtures 在测试中构建带角色、权限和Token的用户
+//
+// 用法：
+//
+//	fixture := testfixtures.NewFixture(db)
+//	alice := fixture.User("alice").WithPassword("pw").WithRole("admin").WithPermissions("user.create").MustBuild(t)
+//	req.Header.Set("Authorization", alice.BearerToken())
+//
+// 夹具直接写入认证服务的数据表，使用的模型是表结构的快照，不依赖业务代码。
+// 默认的密码哈希与Token与认证服务的默认配置兼容：密码可以直接登录，
+// Token可被以DefaultSecretKey为密钥的Token服务或JWT服务验证。
+package testfixtures
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/argon2"
+	"gorm.io/gorm"
+)
+
+// 夹具默认值
+const (
+	// DefaultSecretKey 默认Token签名密钥，被测服务应使用相同的密钥
+	DefaultSecretKey = "testfixtures-secret-key"
+	// DefaultPassword 未调用WithPassword时使用的密码
+	DefaultPassword = "password123"
+	// DefaultTokenExpiration 默认Token有效期
+	DefaultTokenExpiration = time.Hour
+)
+
+// 夹具错误定义
+var (
+	ErrInvalidPermissionName  = errors.New("权限名必须为 资源.操作 格式")
+	ErrPermissionsWithoutRole = errors.New("指定权限时必须同时指定角色")
+)
+
+// Fixture 测试夹具构建器，可在多个测试间复用
+type Fixture struct {
+	db           *gorm.DB
+	issueToken   func(userID uint) (string, error)
+	hashPassword func(password string) (string, error)
+}
+
+// NewFixture 创建测试夹具，使用DefaultSecretKey签发Token
+func NewFixture(db *gorm.DB) *Fixture {
+	f := &Fixture{db: db, hashPassword: hashArgon2}
+	return f.WithSecretKey(DefaultSecretKey)
+}
+
+// WithSecretKey 使用指定密钥签发HS256 Token
+func (f *Fixture) WithSecretKey(secretKey string) *Fixture {
+	f.issueToken = func(userID uint) (string, error) {
+		return signToken(secretKey, userID, DefaultTokenExpiration)
+	}
+	return f
+}
+
+// WithTokenIssuer 使用自定义方式签发Token，如被测应用的JWT服务的GenerateToken
+func (f *Fixture) WithTokenIssuer(issue func(userID uint) (string, error)) *Fixture {
+	f.issueToken = issue
+	return f
+}
+
+// WithPasswordHasher 使用自定义方式哈希密码，应用修改了默认哈希参数、算法或配置了pepper时使用
+func (f *Fixture) WithPasswordHasher(hash func(password string) (string, error)) *Fixture {
+	f.hashPassword = hash
+	return f
+}
+
+// ClearAllData 清理认证服务的全部数据
+func (f *Fixture) ClearAllData() error {
+	return ClearAllData(f.db)
+}
+
+// User 开始构建用户，默认邮箱为 用户名@example.com，密码为DefaultPassword
+func (f *Fixture) User(username string) *UserBuilder {
+	return &UserBuilder{
+		fixture:  f,
+		username: username,
+		email:    username + "@example.com",
+		password: DefaultPassword,
+		status:   1,
+	}
+}
+
+// UserBuilder 用户构建器
+type UserBuilder struct {
+	fixture       *Fixture
+	username      string
+	email         string
+	password      string
+	status        uint8
+	emailVerified bool
+	roles         []string
+	permissions   []string
+}
+
+// WithEmail 设置邮箱
+func (b *UserBuilder) WithEmail(email string) *UserBuilder {
+	b.email = email
+	return b
+}
+
+// WithPassword 设置密码
+func (b *UserBuilder) WithPassword(password string) *UserBuilder {
+	b.password = password
+	return b
+}
+
+// WithStatus 设置用户状态：1-正常，2-禁用
+func (b *UserBuilder) WithStatus(status uint8) *UserBuilder {
+	b.status = status
+	return b
+}
+
+// WithEmailVerified 将邮箱标记为已验证
+func (b *UserBuilder) WithEmailVerified() *UserBuilder {
+	b.emailVerified = true
+	return b
+}
+
+// WithRole 为用户分配角色，角色不存在时创建
+func (b *UserBuilder) WithRole(names ...string) *UserBuilder {
+	b.roles = append(b.roles, names...)
+	return b
+}
+
+// WithPermissions 为用户的每个角色分配权限，权限不存在时按 资源.操作 解析后创建
+func (b *UserBuilder) WithPermissions(names ...string) *UserBuilder {
+	b.permissions = append(b.permissions, names...)
+	return b
+}
+
+// UserFixture 构建出的用户及其关联记录
+type UserFixture struct {
+	User        *User
+	Password    string // 明文密码，用于测试登录
+	Roles       []*Role
+	Permissions []*Permission
+	Token       string
+}
+
+// BearerToken 返回Authorization请求头的值
+func (u *UserFixture) BearerToken() string {
+	return "Bearer " + u.Token
+}
+
+// Build 在一个事务中创建用户、角色、权限及其关联，并签发Token
+func (b *UserBuilder) Build() (*UserFixture, error) {
+	if len(b.permissions) > 0 && len(b.roles) == 0 {
+		return nil, ErrPermissionsWithoutRole
+	}
+
+	hash, err := b.fixture.hashPassword(b.password)
+	if err != nil {
+		return nil, fmt.Errorf("哈希密码失败: %w", err)
+	}
+
+	result := &UserFixture{
+		User: &User{
+			Username:      b.username,
+			Email:         b.email,
+			PasswordHash:  hash,
+			Status:        b.status,
+			EmailVerified: b.emailVerified,
+		},
+		Password: b.password,
+	}
+
+	err = b.fixture.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(result.User).Error; err != nil {
+			return fmt.Errorf("创建用户失败: %w", err)
+		}
+
+		for _, name := range b.permissions {
+			permission, err := findOrCreatePermission(tx, name)
+			if err != nil {
+				return err
+			}
+			result.Permissions = append(result.Permissions, permission)
+		}
+
+		for _, name := range b.roles {
+			role := &Role{}
+			if err := tx.Where(Role{Name: name}).Attrs(Role{DisplayName: name, Status: 1}).FirstOrCreate(role).Error; err != nil {
+				return fmt.Errorf("创建角色%s失败: %w", name, err)
+			}
+			result.Roles = append(result.Roles, role)
+
+			if err := tx.Create(&UserRole{UserID: result.User.ID, RoleID: role.ID}).Error; err != nil {
+				return fmt.Errorf("分配角色%s失败: %w", name, err)
+			}
+			for _, permission := range result.Permissions {
+				link := &RolePermission{}
+				if err := tx.Where(RolePermission{RoleID: role.ID, PermissionID: permission.ID}).FirstOrCreate(link).Error; err != nil {
+					return fmt.Errorf("为角色%s分配权限%s失败: %w", name, permission.Name, err)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Token, err = b.fixture.issueToken(result.User.ID); err != nil {
+		return nil, fmt.Errorf("签发Token失败: %w", err)
+	}
+	return result, nil
+}
+
+// MustBuild 构建用户，失败时终止测试
+func (b *UserBuilder) MustBuild(tb testing.TB) *UserFixture {
+	tb.Helper()
+	result, err := b.Build()
+	if err != nil {
+		tb.Fatalf("构建测试用户%s失败: %v", b.username, err)
+	}
+	return result
+}
+
+// findOrCreatePermission 按名称查找权限，不存在时解析 资源.操作 后创建
+func findOrCreatePermission(tx *gorm.DB, name string) (*Permission, error) {
+	resource, action, err := parsePermissionName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	permission := &Permission{}
+	err = tx.Where(Permission{Name: name}).
+		Attrs(Permission{DisplayName: name, Resource: resource, Action: action}).
+		FirstOrCreate(permission).Error
+	if err != nil {
+		return nil, fmt.Errorf("创建权限%s失败: %w", name, err)
+	}
+	return permission, nil
+}
+
+// parsePermissionName 将 资源.操作 拆分为资源和操作，资源本身可以包含点号
+func parsePermissionName(name string) (resource, action string, err error) {
+	i := strings.LastIndex(name, ".")
+	if i <= 0 || i == len(name)-1 {
+		return "", "", fmt.Errorf("%w: %q", ErrInvalidPermissionName, name)
+	}
+	return name[:i], name[i+1:], nil
+}
+
+// hashArgon2 使用认证服务默认参数的argon2id哈希密码，编码为PHC格式，登录时不会触发重新哈希
+func hashArgon2(password string) (string, error) {
+	const (
+		memory     = 64 * 1024
+		iterations = 1
+		threads    = 4
+		keyLen     = 32
+		saltLen    = 16
+	)
+
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	hash := argon2.IDKey([]byte(password), salt, iterations, memory, threads, keyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, memory, iterations, threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+// tokenClaims Token声明，同时满足Token服务和JWT服务的解析格式
+type tokenClaims struct {
+	UserID uint   `json:"user_id"`
+	JTI    string `json:"jti"`
+	jwt.RegisteredClaims
+}
+
+// signToken 使用HS256签发Token
+func signToken(secretKey string, userID uint, expiration time.Duration) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := &tokenClaims{
+		UserID: userID,
+		JTI:    hex.EncodeToString(jti),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiration)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Subject:   fmt.Sprintf("user:%d", userID),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secretKey))
+}
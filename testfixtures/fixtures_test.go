@@ -0,0 +1,62 @@
+package testfixtures
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePermissionName(t *testing.T) {
+	t.Run("按最后一个点号拆分", func(t *testing.T) {
+		resource, action, err := parsePermissionName("user.create")
+		assert.NoError(t, err)
+		assert.Equal(t, "user", resource)
+		assert.Equal(t, "create", action)
+
+		resource, action, err = parsePermissionName("project/123.doc.read")
+		assert.NoError(t, err)
+		assert.Equal(t, "project/123.doc", resource)
+		assert.Equal(t, "read", action)
+	})
+
+	t.Run("拒绝无效名称", func(t *testing.T) {
+		for _, name := range []string{"", "user", ".create", "user."} {
+			_, _, err := parsePermissionName(name)
+			assert.True(t, errors.Is(err, ErrInvalidPermissionName), name)
+		}
+	})
+}
+
+func TestSignToken(t *testing.T) {
+	token, err := signToken(DefaultSecretKey, 42, DefaultTokenExpiration)
+	assert.NoError(t, err)
+
+	claims := &tokenClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(DefaultSecretKey), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	assert.NoError(t, err)
+	assert.True(t, parsed.Valid)
+	assert.Equal(t, uint(42), claims.UserID)
+	assert.NotEmpty(t, claims.JTI)
+
+	// 每次签发的Token不同
+	other, err := signToken(DefaultSecretKey, 42, DefaultTokenExpiration)
+	assert.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func TestHashArgon2(t *testing.T) {
+	hash, err := hashArgon2(DefaultPassword)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=1,p=4$"))
+	assert.Len(t, strings.Split(hash, "$"), 6)
+}
+
+func TestBuildRequiresRoleForPermissions(t *testing.T) {
+	_, err := NewFixture(nil).User("alice").WithPermissions("user.create").Build()
+	assert.True(t, errors.Is(err, ErrPermissionsWithoutRole))
+}
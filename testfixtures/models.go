@@ -0,0 +1,71 @@
+package testfixtures
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// User 用户表中构建夹具需要的列，未列出的列使用数据库默认值
+type User struct {
+	gorm.Model
+	Username      string
+	Email         string
+	PasswordHash  string `json:"-"`
+	Status        uint8
+	EmailVerified bool
+}
+
+// Role 角色
+type Role struct {
+	gorm.Model
+	Name        string
+	DisplayName string
+	Status      uint8
+}
+
+// Permission 权限，名称为 资源.操作
+type Permission struct {
+	gorm.Model
+	Name        string
+	DisplayName string
+	Resource    string
+	Action      string
+}
+
+// UserRole 用户角色关联
+type UserRole struct {
+	ID        uint `gorm:"primaryKey"`
+	UserID    uint
+	RoleID    uint
+	CreatedAt time.Time
+}
+
+// RolePermission 角色权限关联
+type RolePermission struct {
+	ID           uint `gorm:"primaryKey"`
+	RoleID       uint
+	PermissionID uint
+	CreatedAt    time.Time
+}
+
+// TableName 设置表名
+func (User) TableName() string {
+	return "sys_users"
+}
+
+func (Role) TableName() string {
+	return "sys_roles"
+}
+
+func (Permission) TableName() string {
+	return "sys_permissions"
+}
+
+func (UserRole) TableName() string {
+	return "sys_user_roles"
+}
+
+func (RolePermission) TableName() string {
+	return "sys_role_permissions"
+}
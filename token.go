@@ -1,7 +1,12 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"log"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -11,86 +16,297 @@ import (
 type TokenService interface {
 	// 生成Token
 	GenerateToken(userID uint) (string, error)
+	// 根据用户记录生成Token，写入密码修改时间
+	GenerateTokenForUser(user *User) (string, error)
+	// 根据用户记录生成记录登录认证方式的Token，完成多因素认证时amr应包含AMRMFA
+	GenerateTokenForUserWithAMR(user *User, amr []string) (string, error)
 	// 验证Token
 	ValidateToken(tokenString string) (uint, error)
+	// 验证Token并返回Claims
+	ParseClaims(tokenString string) (*Claims, error)
+	// 验证Token并返回登录认证方式，供RequireMFA使用
+	ParseAMR(tokenString string) ([]string, error)
 	// 撤销Token
 	RevokeToken(tokenString string) error
+	// 撤销有效的Token并返回是否由本次调用撤销，检查与撤销是原子的，用于轮换刷新Token
+	ConsumeToken(tokenString string) (bool, error)
+	// 撤销用户的所有Token
+	RevokeAllUserTokens(userID uint) error
 	// 清理过期Token
 	CleanupExpiredTokens() error
 }
 
 // Claims JWT声明
 type Claims struct {
-	UserID uint `json:"user_id"`
+	UserID            uint     `json:"user_id"`
+	PasswordChangedAt int64    `json:"pwd_at,omitempty"` // 签发时用户的密码修改时间（Unix秒）
+	AMR               []string `json:"amr,omitempty"`    // 登录认证方式（RFC 8176），刷新时保留
 	jwt.RegisteredClaims
 }
 
+// issuedToken 已签发的Token及其过期时间
+type issuedToken struct {
+	token     string
+	expiresAt time.Time
+}
+
 // tokenService Token服务实现
 type tokenService struct {
 	secretKey     []byte
 	expiration    time.Duration
-	revokedTokens map[string]bool // 简化实现，实际应该使用Redis等
+	revokedTokens map[string]time.Time   // 已撤销的Token -> 过期时间，过期后由CleanupExpiredTokens回收；简化实现，实际应该使用Redis等
+	userTokens    map[uint][]issuedToken // 用户ID -> 已签发且未过期的Token列表
+	clock         Clock
+	mutex         sync.RWMutex
 }
 
 // NewTokenService 创建Token服务实例
 func NewTokenService(secretKey string, expiration time.Duration) TokenService {
+	return NewTokenServiceWithClock(secretKey, expiration, nil)
+}
+
+// NewTokenServiceWithClock 创建使用指定时钟签发和验证Token的服务实例，clock为nil时使用系统时间
+func NewTokenServiceWithClock(secretKey string, expiration time.Duration, clock Clock) TokenService {
 	return &tokenService{
 		secretKey:     []byte(secretKey),
 		expiration:    expiration,
-		revokedTokens: make(map[string]bool),
+		revokedTokens: make(map[string]time.Time),
+		userTokens:    make(map[uint][]issuedToken),
+		clock:         clockOrDefault(clock),
 	}
 }
 
 // GenerateToken 生成Token
 func (s *tokenService) GenerateToken(userID uint) (string, error) {
-	now := time.Now()
-	claims := &Claims{
-		UserID: userID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(now.Add(s.expiration)),
-			IssuedAt:  jwt.NewNumericDate(now),
-			NotBefore: jwt.NewNumericDate(now),
-		},
+	return s.generateToken(&Claims{UserID: userID})
+}
+
+// GenerateTokenForUser 根据用户记录生成Token，写入密码修改时间
+func (s *tokenService) GenerateTokenForUser(user *User) (string, error) {
+	return s.GenerateTokenForUserWithAMR(user, nil)
+}
+
+// GenerateTokenForUserWithAMR 根据用户记录生成Token，写入密码修改时间和登录认证方式
+func (s *tokenService) GenerateTokenForUserWithAMR(user *User, amr []string) (string, error) {
+	claims := &Claims{UserID: user.ID, AMR: amr}
+	if user.PasswordChangedAt != nil {
+		claims.PasswordChangedAt = user.PasswordChangedAt.Unix()
+	}
+	return s.generateToken(claims)
+}
+
+// generateToken 补全时间声明和随机JTI并签发Token
+//
+// JTI保证同一秒内为同一用户签发的Token也各不相同，刷新时撤销旧Token不会误伤新Token。
+func (s *tokenService) generateToken(claims *Claims) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	now := s.clock.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        hex.EncodeToString(jti),
+		ExpiresAt: jwt.NewNumericDate(now.Add(s.expiration)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.secretKey)
+	tokenString, err := token.SignedString(s.secretKey)
+	if err != nil {
+		return "", err
+	}
+
+	// 记录用户Token关系，用于批量撤销；顺便移除该用户已过期的Token
+	s.mutex.Lock()
+	s.userTokens[claims.UserID] = append(unexpiredTokens(s.userTokens[claims.UserID], now), issuedToken{
+		token:     tokenString,
+		expiresAt: claims.ExpiresAt.Time,
+	})
+	s.mutex.Unlock()
+
+	return tokenString, nil
 }
 
 // ValidateToken 验证Token
 func (s *tokenService) ValidateToken(tokenString string) (uint, error) {
+	claims, err := s.ParseClaims(tokenString)
+	if err != nil {
+		return 0, err
+	}
+	return claims.UserID, nil
+}
+
+// ParseClaims 验证Token并返回Claims
+func (s *tokenService) ParseClaims(tokenString string) (*Claims, error) {
+	if len(tokenString) > DefaultMaxTokenLength {
+		return nil, ErrTokenTooLong
+	}
+
 	// 检查Token是否被撤销
-	if s.revokedTokens[tokenString] {
-		return 0, errors.New("token已被撤销")
+	s.mutex.RLock()
+	_, revoked := s.revokedTokens[tokenString]
+	s.mutex.RUnlock()
+	if revoked {
+		return nil, errors.New("token已被撤销")
 	}
 
+	return s.verifyToken(tokenString)
+}
+
+// ParseAMR 验证Token并返回登录认证方式
+func (s *tokenService) ParseAMR(tokenString string) ([]string, error) {
+	claims, err := s.ParseClaims(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	return claims.AMR, nil
+}
+
+// verifyToken 验证签名和时间声明并返回Claims，不检查撤销记录
+func (s *tokenService) verifyToken(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("无效的签名方法")
 		}
 		return s.secretKey, nil
-	})
+	}, jwt.WithTimeFunc(s.clock.Now), jwt.WithExpirationRequired())
 
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims.UserID, nil
+		return claims, nil
 	}
 
-	return 0, errors.New("无效的token")
+	return nil, errors.New("无效的token")
 }
 
-// RevokeToken 撤销Token
+// RevokeToken 撤销Token，未通过签名验证或已过期的Token本身就无法通过验证，不再记录
+//
+// 只记录验证通过的Token，伪造的Token无法写入撤销记录，撤销记录的过期时间来自已验证的Claims。
+// 超过DefaultMaxTokenLength的字符串返回ErrTokenTooLong，防止撤销记录被超长字符串撑大。
 func (s *tokenService) RevokeToken(tokenString string) error {
-	s.revokedTokens[tokenString] = true
+	if len(tokenString) > DefaultMaxTokenLength {
+		return ErrTokenTooLong
+	}
+
+	claims, err := s.verifyToken(tokenString)
+	if err != nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.revokedTokens[tokenString] = claims.ExpiresAt.Time
 	return nil
 }
 
-// CleanupExpiredTokens 清理过期Token
+// ConsumeToken 撤销有效的Token，Token无效、已过期或已撤销时返回false，并发消费同一Token时只有一个返回true
+func (s *tokenService) ConsumeToken(tokenString string) (bool, error) {
+	if len(tokenString) > DefaultMaxTokenLength {
+		return false, ErrTokenTooLong
+	}
+
+	claims, err := s.verifyToken(tokenString)
+	if err != nil {
+		return false, nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, revoked := s.revokedTokens[tokenString]; revoked {
+		return false, nil
+	}
+	s.revokedTokens[tokenString] = claims.ExpiresAt.Time
+	return true, nil
+}
+
+// RevokeAllUserTokens 撤销用户的所有Token，已过期的Token不再记录
+func (s *tokenService) RevokeAllUserTokens(userID uint) error {
+	now := s.clock.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, issued := range unexpiredTokens(s.userTokens[userID], now) {
+		s.revokedTokens[issued.token] = issued.expiresAt
+	}
+	delete(s.userTokens, userID)
+
+	return nil
+}
+
+// CleanupExpiredTokens 回收已过期的撤销记录和签发记录
 func (s *tokenService) CleanupExpiredTokens() error {
-	// 简化实现，实际应该定期清理过期的撤销Token
-	// 这里可以解析每个撤销的token，检查是否过期，如果过期则从map中删除
+	now := s.clock.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for tokenString, expiresAt := range s.revokedTokens {
+		if !now.Before(expiresAt) {
+			delete(s.revokedTokens, tokenString)
+		}
+	}
+	for userID, tokens := range s.userTokens {
+		if remaining := unexpiredTokens(tokens, now); len(remaining) > 0 {
+			s.userTokens[userID] = remaining
+		} else {
+			delete(s.userTokens, userID)
+		}
+	}
+
 	return nil
 }
+
+// TokenCleanupStarter 支持在后台定期回收过期记录的Token服务
+type TokenCleanupStarter interface {
+	StartCleanup(ctx context.Context, interval time.Duration) <-chan struct{}
+}
+
+// StartCleanup 启动后台协程，每隔interval调用一次CleanupExpiredTokens，直到ctx取消
+//
+// 返回的通道在协程退出后关闭，服务退出时取消ctx并等待该通道即可确保清理已停止。
+// interval不大于0时不启动协程，返回已关闭的通道。
+func (s *tokenService) StartCleanup(ctx context.Context, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	if interval <= 0 {
+		close(done)
+		return done
+	}
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.CleanupExpiredTokens(); err != nil {
+					log.Printf("清理过期Token失败: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return done
+}
+
+// unexpiredTokens 过滤掉已过期的Token，复用原切片的底层数组
+func unexpiredTokens(tokens []issuedToken, now time.Time) []issuedToken {
+	remaining := tokens[:0]
+	for _, issued := range tokens {
+		if now.Before(issued.expiresAt) {
+			remaining = append(remaining, issued)
+		}
+	}
+	return remaining
+}
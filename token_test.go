@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenServiceRevocationStorage(t *testing.T) {
+	t.Run("撤销后验证失败", func(t *testing.T) {
+		clock := NewFakeClock(time.Time{})
+		service := NewTokenServiceWithClock("test-secret-key", time.Hour, clock).(*tokenService)
+
+		first, err := service.GenerateToken(1)
+		assert.NoError(t, err)
+		clock.Advance(time.Second) // Token的签发时间精确到秒，确保两个Token不同
+		second, err := service.GenerateToken(1)
+		assert.NoError(t, err)
+
+		assert.NoError(t, service.RevokeAllUserTokens(1))
+		_, err = service.ParseClaims(first)
+		assert.Error(t, err)
+		_, err = service.ParseClaims(second)
+		assert.Error(t, err)
+		assert.Len(t, service.revokedTokens, 2)
+		assert.Empty(t, service.userTokens)
+	})
+
+	t.Run("已过期的Token不记录", func(t *testing.T) {
+		service := NewTokenService("test-secret-key", -time.Minute).(*tokenService)
+
+		token, err := service.GenerateToken(1)
+		assert.NoError(t, err)
+
+		assert.NoError(t, service.RevokeToken(token))
+		assert.NoError(t, service.RevokeAllUserTokens(1))
+		assert.Empty(t, service.revokedTokens)
+
+		// 无法解析的Token同样不记录
+		assert.NoError(t, service.RevokeToken("not-a-token"))
+		assert.Empty(t, service.revokedTokens)
+	})
+
+	t.Run("签名无效的Token不记录", func(t *testing.T) {
+		service := NewTokenService("test-secret-key", time.Hour).(*tokenService)
+		forger := NewTokenService("attacker-key", 100*365*24*time.Hour)
+
+		forged, err := forger.GenerateToken(1)
+		assert.NoError(t, err)
+		assert.NoError(t, service.RevokeToken(forged))
+		assert.Empty(t, service.revokedTokens)
+	})
+
+	t.Run("ConsumeToken只成功一次", func(t *testing.T) {
+		service := NewTokenService("test-secret-key", time.Hour)
+		token, err := service.GenerateToken(1)
+		assert.NoError(t, err)
+
+		consumed, err := service.ConsumeToken(token)
+		assert.NoError(t, err)
+		assert.True(t, consumed)
+
+		consumed, err = service.ConsumeToken(token)
+		assert.NoError(t, err)
+		assert.False(t, consumed)
+
+		_, err = service.ValidateToken(token)
+		assert.Error(t, err)
+
+		consumed, err = service.ConsumeToken("invalid")
+		assert.NoError(t, err)
+		assert.False(t, consumed)
+	})
+
+	t.Run("按时钟判断过期", func(t *testing.T) {
+		clock := NewFakeClock(time.Time{})
+		service := NewTokenServiceWithClock("test-secret-key", time.Hour, clock)
+
+		token, err := service.GenerateToken(1)
+		assert.NoError(t, err)
+		_, err = service.ValidateToken(token)
+		assert.NoError(t, err)
+
+		clock.Advance(time.Hour + time.Second)
+		_, err = service.ValidateToken(token)
+		assert.Error(t, err)
+
+		// 已过期的Token不再记录撤销
+		assert.NoError(t, service.RevokeToken(token))
+		assert.Empty(t, service.(*tokenService).revokedTokens)
+	})
+
+	t.Run("签发时移除该用户已过期的Token", func(t *testing.T) {
+		service := NewTokenService("test-secret-key", time.Hour).(*tokenService)
+		service.userTokens[1] = []issuedToken{{token: "expired", expiresAt: time.Now().Add(-time.Second)}}
+
+		_, err := service.GenerateToken(1)
+		assert.NoError(t, err)
+		assert.Len(t, service.userTokens[1], 1)
+		assert.NotEqual(t, "expired", service.userTokens[1][0].token)
+	})
+
+	t.Run("清理回收已过期的记录", func(t *testing.T) {
+		service := NewTokenService("test-secret-key", time.Hour).(*tokenService)
+
+		live, err := service.GenerateToken(1)
+		assert.NoError(t, err)
+		assert.NoError(t, service.RevokeToken(live))
+		_, err = service.GenerateToken(2)
+		assert.NoError(t, err)
+
+		service.revokedTokens["expired"] = time.Now().Add(-time.Second)
+		service.userTokens[3] = []issuedToken{{token: "expired", expiresAt: time.Now().Add(-time.Second)}}
+
+		assert.NoError(t, service.CleanupExpiredTokens())
+		assert.Len(t, service.revokedTokens, 1)
+		assert.Contains(t, service.revokedTokens, live)
+		assert.Len(t, service.userTokens, 2)
+		assert.NotContains(t, service.userTokens, uint(3))
+	})
+}
+
+func TestTokenServiceStartCleanup(t *testing.T) {
+	t.Run("定期清理直到取消", func(t *testing.T) {
+		service := NewTokenService("test-secret-key", time.Hour)
+		impl := service.(*tokenService)
+		impl.mutex.Lock()
+		impl.revokedTokens["expired"] = time.Now().Add(-time.Second)
+		impl.mutex.Unlock()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := service.(TokenCleanupStarter).StartCleanup(ctx, 5*time.Millisecond)
+
+		assert.Eventually(t, func() bool {
+			impl.mutex.RLock()
+			defer impl.mutex.RUnlock()
+			return len(impl.revokedTokens) == 0
+		}, time.Second, 5*time.Millisecond)
+
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("取消后清理协程应退出")
+		}
+
+		// 退出后不再清理
+		impl.mutex.Lock()
+		impl.revokedTokens["expired"] = time.Now().Add(-time.Second)
+		impl.mutex.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		impl.mutex.RLock()
+		assert.Len(t, impl.revokedTokens, 1)
+		impl.mutex.RUnlock()
+	})
+
+	t.Run("间隔无效时不启动", func(t *testing.T) {
+		service := NewTokenService("test-secret-key", time.Hour).(*tokenService)
+		select {
+		case <-service.StartCleanup(context.Background(), 0):
+		default:
+			t.Fatal("应返回已关闭的通道")
+		}
+	})
+}
+
+func BenchmarkTokenServiceRevokeAllUserTokens(b *testing.B) {
+	const users = 5000
+
+	b.Run("未过期", func(b *testing.B) {
+		benchmarkRevokeAllUserTokens(b, time.Hour, users)
+	})
+
+	// 已过期的Token不会进入撤销集合，内存不随撤销次数增长
+	b.Run("已过期", func(b *testing.B) {
+		benchmarkRevokeAllUserTokens(b, -time.Minute, users)
+	})
+}
+
+// benchmarkRevokeAllUserTokens 为大量用户签发Token后批量撤销，报告撤销集合的大小
+func benchmarkRevokeAllUserTokens(b *testing.B, expiration time.Duration, users int) {
+	b.ReportAllocs()
+
+	var revoked int
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		service := NewTokenService("test-secret-key", expiration).(*tokenService)
+		for userID := 1; userID <= users; userID++ {
+			if _, err := service.GenerateToken(uint(userID)); err != nil {
+				b.Fatalf("生成Token失败: %v", err)
+			}
+		}
+		b.StartTimer()
+
+		for userID := 1; userID <= users; userID++ {
+			service.RevokeAllUserTokens(uint(userID))
+		}
+
+		b.StopTimer()
+		service.CleanupExpiredTokens()
+		revoked = len(service.revokedTokens)
+		b.StartTimer()
+	}
+
+	b.ReportMetric(float64(revoked), "revoked_entries")
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// DefaultMaxTokenLength 默认的Token最大长度（字节），本服务签发的Token远小于该值
+const DefaultMaxTokenLength = 4096
+
+// Token格式错误定义
+var (
+	ErrTokenTooLong   = errors.New("Token长度超过上限")
+	ErrMalformedToken = errors.New("Token格式无效")
+)
+
+// bearerScheme Authorization请求头的认证方案
+const bearerScheme = "Bearer"
+
+// parseBearerToken 从Authorization请求头的值中取出Bearer Token，认证方案不区分大小写（RFC 6750）
+func parseBearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, bearerScheme) || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// checkTokenFormat 在解析和查询撤销记录之前廉价地检查Token
+//
+// 长度不超过maxLength，只包含base64url字符，且为1段（不透明会话Token）或3段（JWT）且各段非空。
+// 只拒绝明显无效的Token，通过检查不代表Token有效。
+func checkTokenFormat(token string, maxLength int) error {
+	if len(token) > maxLength {
+		return ErrTokenTooLong
+	}
+
+	segments := 1
+	segmentLength := 0
+	for i := 0; i < len(token); i++ {
+		c := token[i]
+		switch {
+		case c == '.':
+			if segmentLength == 0 {
+				return ErrMalformedToken
+			}
+			segments++
+			segmentLength = 0
+			continue
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_':
+		default:
+			return ErrMalformedToken
+		}
+		segmentLength++
+	}
+	if segmentLength == 0 || (segments != 1 && segments != 3) {
+		return ErrMalformedToken
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBearerToken(t *testing.T) {
+	for header, want := range map[string]string{
+		"Bearer abc": "abc",
+		"bearer abc": "abc",
+		"BEARER abc": "abc",
+	} {
+		token, ok := parseBearerToken(header)
+		assert.True(t, ok, header)
+		assert.Equal(t, want, token)
+	}
+
+	for _, header := range []string{"", "Bearer", "Bearer ", "Basic abc", "Bearerabc", "Token abc"} {
+		_, ok := parseBearerToken(header)
+		assert.False(t, ok, header)
+	}
+}
+
+func TestCheckTokenFormat(t *testing.T) {
+	jwtToken, err := NewJWTService(nil).GenerateToken(1)
+	assert.NoError(t, err)
+
+	t.Run("接受JWT和不透明Token", func(t *testing.T) {
+		assert.NoError(t, checkTokenFormat(jwtToken, DefaultMaxTokenLength))
+		assert.NoError(t, checkTokenFormat(strings.Repeat("ab12", 16), DefaultMaxTokenLength))
+		assert.NoError(t, checkTokenFormat("valid-token_1", DefaultMaxTokenLength))
+	})
+
+	t.Run("拒绝超长Token", func(t *testing.T) {
+		assert.True(t, errors.Is(checkTokenFormat(strings.Repeat("a", 101), 100), ErrTokenTooLong))
+		assert.NoError(t, checkTokenFormat(strings.Repeat("a", 100), 100))
+	})
+
+	t.Run("拒绝格式明显错误的Token", func(t *testing.T) {
+		for _, token := range []string{
+			"",
+			"a.b",
+			"a.b.c.d",
+			"a..c",
+			".b.c",
+			"a.b.",
+			"a+b/c=",
+			"a.b.c=",
+			"abc def",
+			"令牌",
+		} {
+			assert.True(t, errors.Is(checkTokenFormat(token, DefaultMaxTokenLength), ErrMalformedToken), token)
+		}
+	})
+}
+
+func TestRevokeTokenLengthCap(t *testing.T) {
+	longSubject := strings.Repeat("x", DefaultMaxTokenLength)
+
+	t.Run("JWT服务拒绝记录超长Token", func(t *testing.T) {
+		config := DefaultJWTConfig()
+		service := NewJWTService(config).(*jwtService)
+
+		// 签名有效但超长的Token
+		claims := &JWTClaims{
+			UserID: 1,
+			JTI:    longSubject,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+		}
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(config.SecretKey))
+		assert.NoError(t, err)
+
+		assert.True(t, errors.Is(service.RevokeToken(token), ErrTokenTooLong))
+		assert.Equal(t, 0, service.Stats().RevokedTokens)
+		assert.Equal(t, int64(0), service.parseCount.Load())
+
+		_, err = service.ParseToken(token)
+		assert.True(t, errors.Is(err, ErrTokenTooLong))
+		assert.Equal(t, int64(0), service.parseCount.Load())
+
+		// 可配置上限
+		config.MaxTokenLength = 2 * DefaultMaxTokenLength
+		assert.NoError(t, NewJWTService(config).RevokeToken(token))
+	})
+
+	t.Run("Token服务拒绝记录超长Token", func(t *testing.T) {
+		service := NewTokenService("test-secret-key", time.Hour).(*tokenService)
+
+		claims := &Claims{
+			UserID: 1,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   longSubject,
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+		}
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(service.secretKey)
+		assert.NoError(t, err)
+
+		assert.True(t, errors.Is(service.RevokeToken(token), ErrTokenTooLong))
+		assert.Empty(t, service.revokedTokens)
+
+		_, err = service.ParseClaims(token)
+		assert.True(t, errors.Is(err, ErrTokenTooLong))
+	})
+}
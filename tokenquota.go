@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTokenQuotaExceeded 用户在一小时内签发的Token数量超过上限
+var ErrTokenQuotaExceeded = errors.New("Token签发次数超过上限，请稍后再试")
+
+// tokenQuotaWindow Token签发配额的统计窗口
+const tokenQuotaWindow = time.Hour
+
+// TokenQuotaUsage 用户当前窗口内的Token签发情况
+type TokenQuotaUsage struct {
+	Issued         int  `json:"issued"`          // 窗口内的签发次数，包含被拒绝的请求
+	Limit          int  `json:"limit"`           // 每小时上限，0表示不限制
+	SoftThreshold  int  `json:"soft_threshold"`  // 异常告警阈值，0表示不告警
+	OverrideActive bool `json:"override_active"` // 管理员是否临时解除了该用户的配额
+}
+
+// tokenIssueKey 用户签发次数的计数键
+func tokenIssueKey(userID uint) string {
+	return fmt.Sprintf("token_issue:%d", userID)
+}
+
+// tokenQuotaOverrideKey 管理员临时解除配额的标记键，计数大于0表示解除中
+func tokenQuotaOverrideKey(userID uint) string {
+	return fmt.Sprintf("token_quota_override:%d", userID)
+}
+
+// quotaEnabled 是否配置了签发配额或异常阈值
+func (s *jwtService) quotaEnabled() bool {
+	return s.config.MaxTokensIssuedPerUserPerHour > 0 || s.config.TokenIssueSoftThreshold > 0
+}
+
+// checkIssueQuota 记录一次签发并检查配额，越过异常阈值时记录审计事件
+//
+// 计数保存在限流存储中，多实例共享同一存储时配额在实例间合并计算。
+func (s *jwtService) checkIssueQuota(userID uint) error {
+	if !s.quotaEnabled() {
+		return nil
+	}
+
+	count, err := s.quotaStore.Increment(tokenIssueKey(userID), tokenQuotaWindow)
+	if err != nil {
+		return fmt.Errorf("记录Token签发次数失败: %w", err)
+	}
+	s.tokensIssued.Add(1)
+
+	// 只在越过阈值的那一次记录，避免每次签发都产生事件
+	if threshold := s.config.TokenIssueSoftThreshold; threshold > 0 && count == threshold+1 {
+		s.issuanceAnomalies.Add(1)
+		if err := s.auditLogger.Log(AuditEvent{
+			Type:   AuditEventTokenIssuanceAnomaly,
+			UserID: userID,
+			Detail: fmt.Sprintf("issued=%d threshold=%d window=%s", count, threshold, tokenQuotaWindow),
+		}); err != nil {
+			return err
+		}
+	}
+
+	limit := s.config.MaxTokensIssuedPerUserPerHour
+	if limit <= 0 || count <= limit {
+		return nil
+	}
+	override, err := s.quotaStore.Get(tokenQuotaOverrideKey(userID))
+	if err != nil {
+		return fmt.Errorf("读取Token配额解除状态失败: %w", err)
+	}
+	if override > 0 {
+		return nil
+	}
+	s.quotaRejections.Add(1)
+	return ErrTokenQuotaExceeded
+}
+
+// LiftTokenQuota 在duration内解除用户的Token签发配额，duration<=0时立即恢复配额
+//
+// 解除标记保存在限流存储中，对共享该存储的所有实例生效；窗口内的签发次数照常统计。
+func (s *jwtService) LiftTokenQuota(userID uint, duration time.Duration) error {
+	if userID == 0 {
+		return errors.New("用户ID不能为0")
+	}
+
+	key := tokenQuotaOverrideKey(userID)
+	if err := s.quotaStore.Reset(key); err != nil {
+		return err
+	}
+	if duration <= 0 {
+		return nil
+	}
+	_, err := s.quotaStore.Increment(key, duration)
+	return err
+}
+
+// TokenQuotaUsage 获取用户当前窗口内的Token签发情况
+func (s *jwtService) TokenQuotaUsage(userID uint) (TokenQuotaUsage, error) {
+	usage := TokenQuotaUsage{
+		Limit:         max(s.config.MaxTokensIssuedPerUserPerHour, 0),
+		SoftThreshold: max(s.config.TokenIssueSoftThreshold, 0),
+	}
+
+	issued, err := s.quotaStore.Get(tokenIssueKey(userID))
+	if err != nil {
+		return TokenQuotaUsage{}, err
+	}
+	override, err := s.quotaStore.Get(tokenQuotaOverrideKey(userID))
+	if err != nil {
+		return TokenQuotaUsage{}, err
+	}
+
+	usage.Issued = issued
+	usage.OverrideActive = override > 0
+	return usage, nil
+}
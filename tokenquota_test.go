@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenIssueQuota(t *testing.T) {
+	newService := func(store RateLimitStore, auditLogger AuditLogger) JWTService {
+		config := DefaultJWTConfig()
+		config.MaxTokensIssuedPerUserPerHour = 5
+		config.TokenIssueSoftThreshold = 3
+		config.RateLimitStore = store
+		config.AuditLogger = auditLogger
+		return NewJWTService(config)
+	}
+
+	t.Run("越过异常阈值记录一次事件，超过上限拒绝签发", func(t *testing.T) {
+		auditLogger := NewMemoryAuditLogger()
+		service := newService(nil, auditLogger)
+
+		for i := 0; i < 5; i++ {
+			_, err := service.GenerateToken(1)
+			assert.NoError(t, err)
+		}
+		events := auditLogger.Events()
+		assert.Len(t, events, 1)
+		assert.Equal(t, AuditEventTokenIssuanceAnomaly, events[0].Type)
+		assert.Equal(t, uint(1), events[0].UserID)
+
+		_, err := service.GenerateTokenWithExpiration(1, time.Hour)
+		assert.True(t, errors.Is(err, ErrTokenQuotaExceeded))
+		_, err = service.GenerateTokenWithAMR(1, ChannelWeb, []string{AMRPassword})
+		assert.True(t, errors.Is(err, ErrTokenQuotaExceeded))
+		assert.Len(t, auditLogger.Events(), 1)
+
+		// 配额按用户统计
+		_, err = service.GenerateToken(2)
+		assert.NoError(t, err)
+
+		usage, err := service.TokenQuotaUsage(1)
+		assert.NoError(t, err)
+		assert.Equal(t, TokenQuotaUsage{Issued: 7, Limit: 5, SoftThreshold: 3}, usage)
+
+		stats := service.Stats()
+		assert.Equal(t, int64(8), stats.TokensIssued)
+		assert.Equal(t, int64(2), stats.QuotaRejections)
+		assert.Equal(t, int64(1), stats.IssuanceAnomalies)
+		assert.Equal(t, 6, stats.TrackedTokens)
+	})
+
+	t.Run("刷新不计入配额", func(t *testing.T) {
+		config := DefaultJWTConfig()
+		config.DefaultExpiration = time.Hour
+		config.RefreshExpiration = 2 * time.Hour
+		config.MaxTokensIssuedPerUserPerHour = 1
+		service := NewJWTService(config)
+
+		token, err := service.GenerateToken(1)
+		assert.NoError(t, err)
+		_, err = service.RefreshToken(token)
+		assert.NoError(t, err)
+
+		_, err = service.GenerateToken(1)
+		assert.True(t, errors.Is(err, ErrTokenQuotaExceeded))
+	})
+
+	t.Run("管理员临时解除配额", func(t *testing.T) {
+		service := newService(nil, nil)
+		for i := 0; i < 5; i++ {
+			service.GenerateToken(1)
+		}
+		_, err := service.GenerateToken(1)
+		assert.True(t, errors.Is(err, ErrTokenQuotaExceeded))
+
+		assert.NoError(t, service.LiftTokenQuota(1, time.Hour))
+		_, err = service.GenerateToken(1)
+		assert.NoError(t, err)
+		usage, err := service.TokenQuotaUsage(1)
+		assert.NoError(t, err)
+		assert.True(t, usage.OverrideActive)
+
+		// 恢复配额
+		assert.NoError(t, service.LiftTokenQuota(1, 0))
+		_, err = service.GenerateToken(1)
+		assert.True(t, errors.Is(err, ErrTokenQuotaExceeded))
+
+		assert.Error(t, service.LiftTokenQuota(0, time.Hour))
+	})
+
+	t.Run("多实例共享计数", func(t *testing.T) {
+		store := NewMemoryRateLimitStore()
+		first, second := newService(store, nil), newService(store, nil)
+
+		for i := 0; i < 5; i++ {
+			_, err := first.GenerateToken(1)
+			assert.NoError(t, err)
+		}
+		_, err := second.GenerateToken(1)
+		assert.True(t, errors.Is(err, ErrTokenQuotaExceeded))
+
+		// 在一个实例上解除，另一个实例同样生效
+		assert.NoError(t, first.LiftTokenQuota(1, time.Hour))
+		_, err = second.GenerateToken(1)
+		assert.NoError(t, err)
+	})
+
+	t.Run("窗口结束后重新计数", func(t *testing.T) {
+		auditLogger := NewMemoryAuditLogger()
+		clock := NewFakeClock(time.Time{})
+		service := newService(NewMemoryRateLimitStoreWithClock(clock), auditLogger)
+
+		for i := 0; i < 5; i++ {
+			service.GenerateToken(1)
+		}
+		_, err := service.GenerateToken(1)
+		assert.True(t, errors.Is(err, ErrTokenQuotaExceeded))
+
+		clock.Advance(time.Hour)
+		for i := 0; i < 5; i++ {
+			_, err := service.GenerateToken(1)
+			assert.NoError(t, err)
+		}
+		_, err = service.GenerateToken(1)
+		assert.True(t, errors.Is(err, ErrTokenQuotaExceeded))
+
+		// 每个窗口越过阈值时各记录一次
+		assert.Len(t, auditLogger.Events(), 2)
+	})
+
+	t.Run("未配置时不限制也不计数", func(t *testing.T) {
+		service := NewJWTService(nil)
+		for i := 0; i < 20; i++ {
+			_, err := service.GenerateToken(1)
+			assert.NoError(t, err)
+		}
+
+		usage, err := service.TokenQuotaUsage(1)
+		assert.NoError(t, err)
+		assert.Equal(t, TokenQuotaUsage{}, usage)
+		assert.Equal(t, int64(0), service.Stats().TokensIssued)
+	})
+}
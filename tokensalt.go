@@ -0,0 +1,248 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// ErrTokenSaltNotEnabled 未配置JWTConfig.TokenSalts
+var ErrTokenSaltNotEnabled = errors.New("未启用按用户派生签名密钥")
+
+// tokenSaltBytes 盐值的随机字节数
+const tokenSaltBytes = 16
+
+// tokenSaltCacheSize 盐值缓存写满时先回收过期项
+const tokenSaltCacheSize = 10000
+
+// TokenSaltStorage 按用户派生JWT签名密钥的盐值存储接口
+type TokenSaltStorage interface {
+	// 获取用户的盐值，尚未生成时生成并保存
+	Get(userID uint) (string, error)
+	// 生成新的盐值替换旧值并返回，之前签发的Token全部无法通过验证
+	Rotate(userID uint) (string, error)
+}
+
+// generateTokenSalt 生成随机盐值
+func generateTokenSalt() (string, error) {
+	bytes := make([]byte, tokenSaltBytes)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// deriveUserKey 按 HMAC-SHA256(masterSecret, salt) 派生用户的签名密钥
+func deriveUserKey(masterSecret []byte, salt string) []byte {
+	mac := hmac.New(sha256.New, masterSecret)
+	mac.Write([]byte(salt))
+	return mac.Sum(nil)
+}
+
+// userVerificationKeys 返回验证用户Token的密钥，当前密钥派生的优先，其后依次为轮换前的密钥派生的
+func userVerificationKeys(config *JWTConfig, salt string) interface{} {
+	current := deriveUserKey([]byte(config.SecretKey), salt)
+	if len(config.PreviousSecretKeys) == 0 {
+		return current
+	}
+
+	keys := jwt.VerificationKeySet{Keys: []jwt.VerificationKey{current}}
+	for _, key := range config.PreviousSecretKeys {
+		keys.Keys = append(keys.Keys, deriveUserKey(key, salt))
+	}
+	return keys
+}
+
+// gormTokenSaltStorage 基于GORM的盐值存储实现，盐值保存在用户表的token_salt列
+type gormTokenSaltStorage struct {
+	db *gorm.DB
+}
+
+// NewGormTokenSaltStorage 创建基于用户表的盐值存储
+func NewGormTokenSaltStorage(db *gorm.DB) TokenSaltStorage {
+	return &gormTokenSaltStorage{db: db}
+}
+
+// Get 获取用户的盐值，用户不存在或已删除时返回ErrUserNotFound
+func (s *gormTokenSaltStorage) Get(userID uint) (string, error) {
+	salt, err := s.load(userID)
+	if err != nil || salt != "" {
+		return salt, err
+	}
+
+	// 首次使用时生成，并发生成时以先写入的为准
+	salt, err = generateTokenSalt()
+	if err != nil {
+		return "", err
+	}
+	if err := s.db.Model(&User{}).Where("id = ? AND token_salt = ?", userID, "").
+		UpdateColumn("token_salt", salt).Error; err != nil {
+		return "", err
+	}
+	return s.load(userID)
+}
+
+// Rotate 以一条UPDATE替换用户的盐值
+func (s *gormTokenSaltStorage) Rotate(userID uint) (string, error) {
+	salt, err := generateTokenSalt()
+	if err != nil {
+		return "", err
+	}
+
+	result := s.db.Model(&User{}).Where("id = ?", userID).UpdateColumn("token_salt", salt)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return "", ErrUserNotFound
+	}
+	return salt, nil
+}
+
+// load 读取用户表中的盐值
+func (s *gormTokenSaltStorage) load(userID uint) (string, error) {
+	var salts []string
+	if err := s.db.Model(&User{}).Where("id = ?", userID).Pluck("token_salt", &salts).Error; err != nil {
+		return "", err
+	}
+	if len(salts) == 0 {
+		return "", ErrUserNotFound
+	}
+	return salts[0], nil
+}
+
+// MemoryTokenSaltStorage 内存盐值存储实现，仅在单个服务实例内生效，重启后全部Token失效
+type MemoryTokenSaltStorage struct {
+	salts map[uint]string
+	mutex sync.Mutex
+}
+
+// NewMemoryTokenSaltStorage 创建内存盐值存储
+func NewMemoryTokenSaltStorage() *MemoryTokenSaltStorage {
+	return &MemoryTokenSaltStorage{
+		salts: make(map[uint]string),
+	}
+}
+
+// Get 获取用户的盐值
+func (s *MemoryTokenSaltStorage) Get(userID uint) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if salt, ok := s.salts[userID]; ok {
+		return salt, nil
+	}
+	salt, err := generateTokenSalt()
+	if err != nil {
+		return "", err
+	}
+	s.salts[userID] = salt
+	return salt, nil
+}
+
+// Rotate 替换用户的盐值
+func (s *MemoryTokenSaltStorage) Rotate(userID uint) (string, error) {
+	salt, err := generateTokenSalt()
+	if err != nil {
+		return "", err
+	}
+
+	s.mutex.Lock()
+	s.salts[userID] = salt
+	s.mutex.Unlock()
+	return salt, nil
+}
+
+// cachedTokenSalt 缓存的盐值
+type cachedTokenSalt struct {
+	salt      string
+	expiresAt time.Time
+}
+
+// cachedTokenSaltStorage 带本地缓存的盐值存储
+//
+// 本实例轮换时立即更新缓存；其他实例轮换后，本实例最多在ttl内仍接受旧Token。
+type cachedTokenSaltStorage struct {
+	storage TokenSaltStorage
+	ttl     time.Duration
+	cache   map[uint]cachedTokenSalt
+	version uint64 // 每次轮换加一，防止轮换前读到的旧盐值在轮换后写入缓存
+	mutex   sync.Mutex
+}
+
+// newCachedTokenSaltStorage 为盐值存储添加本地缓存
+func newCachedTokenSaltStorage(storage TokenSaltStorage, ttl time.Duration) *cachedTokenSaltStorage {
+	return &cachedTokenSaltStorage{
+		storage: storage,
+		ttl:     ttl,
+		cache:   make(map[uint]cachedTokenSalt),
+	}
+}
+
+// Get 优先读取未过期的缓存
+func (s *cachedTokenSaltStorage) Get(userID uint) (string, error) {
+	now := time.Now()
+
+	s.mutex.Lock()
+	cached, ok := s.cache[userID]
+	version := s.version
+	s.mutex.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.salt, nil
+	}
+
+	salt, err := s.storage.Get(userID)
+	if err != nil {
+		return "", err
+	}
+	s.put(userID, salt, version, now)
+	return salt, nil
+}
+
+// Rotate 轮换盐值并立即更新本地缓存
+func (s *cachedTokenSaltStorage) Rotate(userID uint) (string, error) {
+	s.mutex.Lock()
+	s.version++
+	delete(s.cache, userID)
+	s.mutex.Unlock()
+
+	salt, err := s.storage.Rotate(userID)
+	if err != nil {
+		return "", err
+	}
+
+	s.mutex.Lock()
+	s.version++
+	version := s.version
+	s.mutex.Unlock()
+	s.put(userID, salt, version, time.Now())
+	return salt, nil
+}
+
+// put 写入缓存，读取盐值期间发生过轮换时不写入；缓存已满时先回收过期项，仍然满时不再缓存
+func (s *cachedTokenSaltStorage) put(userID uint, salt string, version uint64, now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if version != s.version {
+		return
+	}
+	if len(s.cache) >= tokenSaltCacheSize {
+		for id, cached := range s.cache {
+			if !now.Before(cached.expiresAt) {
+				delete(s.cache, id)
+			}
+		}
+		if len(s.cache) >= tokenSaltCacheSize {
+			return
+		}
+	}
+	s.cache[userID] = cachedTokenSalt{salt: salt, expiresAt: now.Add(s.ttl)}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// saltedJWTConfig 启用按用户派生签名密钥的JWT配置
+func saltedJWTConfig(salts TokenSaltStorage) *JWTConfig {
+	config := DefaultJWTConfig()
+	config.SecretKey = "test-secret-key"
+	config.TokenSalts = salts
+	return config
+}
+
+func TestJWTTokenSalt(t *testing.T) {
+	t.Run("轮换盐值后旧Token立即失效", func(t *testing.T) {
+		service := NewJWTService(saltedJWTConfig(NewMemoryTokenSaltStorage()))
+
+		token, err := service.GenerateToken(1)
+		assert.NoError(t, err)
+		other, err := service.GenerateToken(2)
+		assert.NoError(t, err)
+
+		userID, err := service.ValidateToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, uint(1), userID)
+
+		assert.NoError(t, service.RotateTokenSalt(1))
+
+		_, err = service.ValidateToken(token)
+		assert.Error(t, err)
+		_, err = service.RefreshToken(token)
+		assert.Error(t, err)
+
+		// 其他用户不受影响，轮换后签发的Token可以使用
+		_, err = service.ValidateToken(other)
+		assert.NoError(t, err)
+		newToken, err := service.GenerateToken(1)
+		assert.NoError(t, err)
+		_, err = service.ValidateToken(newToken)
+		assert.NoError(t, err)
+	})
+
+	t.Run("其他实例轮换后同样失效", func(t *testing.T) {
+		salts := NewMemoryTokenSaltStorage()
+		issuer := NewJWTService(saltedJWTConfig(salts))
+		admin := NewJWTService(saltedJWTConfig(salts))
+
+		token, err := issuer.GenerateToken(1)
+		assert.NoError(t, err)
+
+		// 另一实例没有该Token的跟踪记录，撤销用户全部Token时通过轮换盐值使其失效
+		assert.NoError(t, admin.RevokeAllUserTokens(1))
+
+		_, err = issuer.ValidateToken(token)
+		assert.Error(t, err)
+	})
+
+	t.Run("与直接使用SecretKey签名的Token互不通用", func(t *testing.T) {
+		salted := NewJWTService(saltedJWTConfig(NewMemoryTokenSaltStorage()))
+		plain := NewJWTService(saltedJWTConfig(nil))
+
+		saltedToken, err := salted.GenerateToken(1)
+		assert.NoError(t, err)
+		plainToken, err := plain.GenerateToken(1)
+		assert.NoError(t, err)
+
+		_, err = plain.ValidateToken(saltedToken)
+		assert.Error(t, err)
+		_, err = salted.ValidateToken(plainToken)
+		assert.Error(t, err)
+	})
+
+	t.Run("未启用时不能轮换", func(t *testing.T) {
+		service := NewJWTService(saltedJWTConfig(nil))
+		assert.True(t, errors.Is(service.RotateTokenSalt(1), ErrTokenSaltNotEnabled))
+	})
+
+	t.Run("轮换签名密钥时使用旧密钥派生的密钥验证", func(t *testing.T) {
+		salts := NewMemoryTokenSaltStorage()
+		oldService := NewJWTService(saltedJWTConfig(salts))
+		token, err := oldService.GenerateToken(1)
+		assert.NoError(t, err)
+
+		config := saltedJWTConfig(salts)
+		config.SecretKey = "rotated-secret-key"
+		config.PreviousSecretKeys = [][]byte{[]byte("test-secret-key")}
+		newService := NewJWTService(config)
+
+		_, err = newService.ValidateToken(token)
+		assert.NoError(t, err)
+
+		assert.NoError(t, newService.RotateTokenSalt(1))
+		_, err = newService.ValidateToken(token)
+		assert.Error(t, err)
+	})
+
+	t.Run("缓存盐值时本实例轮换立即生效", func(t *testing.T) {
+		config := saltedJWTConfig(NewMemoryTokenSaltStorage())
+		config.TokenSaltCacheTTL = time.Hour
+		service := NewJWTService(config)
+
+		token, err := service.GenerateToken(1)
+		assert.NoError(t, err)
+		_, err = service.ValidateToken(token)
+		assert.NoError(t, err)
+
+		assert.NoError(t, service.RotateTokenSalt(1))
+		_, err = service.ValidateToken(token)
+		assert.Error(t, err)
+	})
+}
+
+func TestCachedTokenSaltStorage(t *testing.T) {
+	storage := NewMemoryTokenSaltStorage()
+	cached := newCachedTokenSaltStorage(storage, time.Hour)
+
+	salt, err := cached.Get(1)
+	assert.NoError(t, err)
+	assert.Len(t, salt, tokenSaltBytes*2)
+
+	t.Run("缓存期内不读取存储", func(t *testing.T) {
+		// 模拟其他实例直接在存储中轮换
+		_, err := storage.Rotate(1)
+		assert.NoError(t, err)
+
+		got, err := cached.Get(1)
+		assert.NoError(t, err)
+		assert.Equal(t, salt, got)
+	})
+
+	t.Run("轮换后更新缓存", func(t *testing.T) {
+		rotated, err := cached.Rotate(1)
+		assert.NoError(t, err)
+		assert.NotEqual(t, salt, rotated)
+
+		got, err := cached.Get(1)
+		assert.NoError(t, err)
+		assert.Equal(t, rotated, got)
+
+		stored, err := storage.Get(1)
+		assert.NoError(t, err)
+		assert.Equal(t, rotated, stored)
+	})
+
+	t.Run("缓存过期后重新读取", func(t *testing.T) {
+		shortLived := newCachedTokenSaltStorage(storage, time.Millisecond)
+		_, err := shortLived.Get(1)
+		assert.NoError(t, err)
+
+		rotated, err := storage.Rotate(1)
+		assert.NoError(t, err)
+		time.Sleep(5 * time.Millisecond)
+
+		got, err := shortLived.Get(1)
+		assert.NoError(t, err)
+		assert.Equal(t, rotated, got)
+	})
+}
+
+func TestGormTokenSaltStorage(t *testing.T) {
+	// 设置测试数据库
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	// 清理数据
+	testDB.ClearAllData()
+
+	storage := NewGormTokenSaltStorage(testDB.DB)
+	user := testDB.CreateTestUser("testuser", "test@example.com", "testpassword123")
+
+	t.Run("首次读取时生成并保存", func(t *testing.T) {
+		salt, err := storage.Get(user.ID)
+		assert.NoError(t, err)
+		assert.Len(t, salt, tokenSaltBytes*2)
+
+		again, err := storage.Get(user.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, salt, again)
+	})
+
+	t.Run("轮换替换盐值", func(t *testing.T) {
+		before, err := storage.Get(user.ID)
+		assert.NoError(t, err)
+
+		rotated, err := storage.Rotate(user.ID)
+		assert.NoError(t, err)
+		assert.NotEqual(t, before, rotated)
+
+		after, err := storage.Get(user.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, rotated, after)
+	})
+
+	t.Run("用户不存在", func(t *testing.T) {
+		_, err := storage.Get(99999)
+		assert.True(t, errors.Is(err, ErrUserNotFound))
+		_, err = storage.Rotate(99999)
+		assert.True(t, errors.Is(err, ErrUserNotFound))
+	})
+
+	t.Run("轮换后旧Token立即失效", func(t *testing.T) {
+		service := NewJWTService(saltedJWTConfig(storage))
+		token, err := service.GenerateToken(user.ID)
+		assert.NoError(t, err)
+		_, err = service.ValidateToken(token)
+		assert.NoError(t, err)
+
+		assert.NoError(t, service.RotateTokenSalt(user.ID))
+		_, err = service.ValidateToken(token)
+		assert.Error(t, err)
+	})
+}
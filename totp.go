@@ -0,0 +1,764 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 二次验证错误定义
+var (
+	ErrTOTPRequired           = errors.New("需要二次验证")
+	ErrInvalidTOTPCode        = errors.New("二次验证码错误")
+	ErrTOTPNotEnabled         = errors.New("未启用二次验证")
+	ErrTOTPAlreadyEnabled     = errors.New("已启用二次验证")
+	ErrTOTPEnrollmentNotFound = errors.New("没有待确认的二次验证设置")
+	ErrInvalidBackupCodeCount = errors.New("恢复码数量无效")
+)
+
+// TOTP参数（RFC 6238），与主流身份验证器应用的默认值一致
+const (
+	totpPeriod      = 30 * time.Second
+	totpDigits      = 6
+	totpModulus     = 1000000 // 10^totpDigits
+	totpSecretBytes = 20      // RFC 4226建议的160位密钥
+)
+
+// recoveryCodeBytes 每个恢复码的随机字节数，编码后取前10个base32字符（50位）
+const recoveryCodeBytes = 7
+
+// totpEncoding TOTP密钥的编码，身份验证器应用要求不带填充的大写base32
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// UserTOTP 用户的TOTP二次验证设置
+type UserTOTP struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	UserID       uint       `gorm:"not null;uniqueIndex" json:"user_id"`
+	Secret       string     `gorm:"size:255;not null;serializer:encrypted" json:"-"` // 配置字段加密器后加密存储
+	Enabled      bool       `gorm:"not null;default:false" json:"enabled"`           // 确认验证码后才启用
+	LastUsedStep int64      `gorm:"not null;default:0" json:"-"`                     // 最近一次验证通过的时间步，同一验证码不能重复使用
+	EnabledAt    *time.Time `json:"enabled_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// TableName 设置表名
+func (UserTOTP) TableName() string {
+	return "sys_user_mfa"
+}
+
+// RecoveryCode 二次验证恢复码（备用码），只保存哈希，每个只能使用一次
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;uniqueIndex:idx_recovery_code_user_hash" json:"user_id"`
+	CodeHash  string     `gorm:"size:64;not null;uniqueIndex:idx_recovery_code_user_hash" json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName 设置表名
+func (RecoveryCode) TableName() string {
+	return "sys_user_recovery_codes"
+}
+
+// TOTPEnrollment 开始启用TOTP时返回给用户的密钥
+type TOTPEnrollment struct {
+	Secret string `json:"secret"` // base32密钥，供无法扫码时手动输入
+	URI    string `json:"uri"`    // otpauth://格式的配置URI，通常生成二维码展示
+}
+
+// TwoFactorConfig 二次验证配置
+type TwoFactorConfig struct {
+	Issuer            string      // 身份验证器应用中显示的发行方名称
+	Skew              int         // 当前时间步前后各容许的时间步数，用于容忍客户端时钟偏差，0表示只接受当前时间步
+	RecoveryCodeCount int         // 启用时生成的恢复码数量
+	MaxBackupCodes    int         // GenerateBackupCodes单次最多生成的恢复码数量
+	AuditLogger       AuditLogger // 审计日志记录器，为nil时不记录
+	Clock             Clock       // 时钟，为nil时使用系统时间
+}
+
+// DefaultTwoFactorConfig 默认配置：容许前后各1个时间步（30秒），生成10个恢复码，重新生成时最多20个
+func DefaultTwoFactorConfig() *TwoFactorConfig {
+	return &TwoFactorConfig{
+		Issuer:            "aigo_service_auth",
+		Skew:              1,
+		RecoveryCodeCount: 10,
+		MaxBackupCodes:    20,
+	}
+}
+
+// TwoFactorService 二次验证服务接口
+type TwoFactorService interface {
+	// 开始启用TOTP，返回密钥和配置URI；确认前不生效，重复调用会替换未确认的密钥
+	EnableTOTP(userID uint) (*TOTPEnrollment, error)
+	// 用身份验证器应用生成的验证码确认启用，返回一次性恢复码（只在此时返回明文）
+	ConfirmTOTP(userID uint, code string) ([]string, error)
+	// 验证TOTP验证码或恢复码，恢复码使用后失效
+	ValidateTOTP(userID uint, code string) error
+	// 验证TOTP验证码或恢复码后关闭二次验证，同时删除恢复码
+	DisableTOTP(userID uint, code string) error
+	// 检查用户是否已启用TOTP
+	IsTOTPEnabled(userID uint) (bool, error)
+	// 为已启用TOTP的用户重新生成count个恢复码并替换之前的全部恢复码，明文只在此时返回
+	GenerateBackupCodes(userID uint, count int) ([]string, error)
+	// 验证恢复码并标记为已使用，恢复码不存在或已使用时返回false
+	ConsumeBackupCode(userID uint, code string) (bool, error)
+	// 获取用户剩余未使用的恢复码数量
+	RemainingBackupCodes(userID uint) (int, error)
+}
+
+// TOTPStorage TOTP设置和恢复码存储接口
+type TOTPStorage interface {
+	// 获取用户的TOTP设置，不存在时返回ErrTOTPNotEnabled
+	Get(userID uint) (*UserTOTP, error)
+	// 保存未确认的TOTP设置并替换之前未确认的设置，用户已启用时返回ErrTOTPAlreadyEnabled
+	SavePending(record *UserTOTP) error
+	// 启用未确认的TOTP设置，记录本次使用的时间步并替换恢复码；没有未确认的设置时返回ErrTOTPEnrollmentNotFound
+	Enable(userID uint, step int64, recoveryCodeHashes []string, now time.Time) error
+	// 记录验证通过的时间步，时间步不大于上次记录的时间步时返回false
+	UseStep(userID uint, step int64) (bool, error)
+	// 标记恢复码已使用，恢复码不存在或已使用时返回false
+	UseRecoveryCode(userID uint, codeHash string, now time.Time) (bool, error)
+	// 替换已启用TOTP的用户的全部恢复码，用户未启用时返回ErrTOTPNotEnabled
+	ReplaceRecoveryCodes(userID uint, codeHashes []string, now time.Time) error
+	// 统计用户未使用的恢复码数量
+	CountRecoveryCodes(userID uint) (int, error)
+	// 删除用户的TOTP设置和全部恢复码
+	Delete(userID uint) error
+}
+
+// twoFactorService 二次验证服务实现
+type twoFactorService struct {
+	storage     TOTPStorage
+	userService UserService
+	config      *TwoFactorConfig
+}
+
+// NewTwoFactorService 创建二次验证服务，config为nil时使用默认配置
+func NewTwoFactorService(storage TOTPStorage, userService UserService, config *TwoFactorConfig) TwoFactorService {
+	if config == nil {
+		config = DefaultTwoFactorConfig()
+	}
+	if config.Skew < 0 {
+		config.Skew = 0
+	}
+	if config.RecoveryCodeCount <= 0 {
+		config.RecoveryCodeCount = 10
+	}
+	if config.MaxBackupCodes <= 0 {
+		config.MaxBackupCodes = 20
+	}
+	if config.AuditLogger == nil {
+		config.AuditLogger = noopAuditLogger{}
+	}
+
+	return &twoFactorService{
+		storage:     storage,
+		userService: userService,
+		config:      config,
+	}
+}
+
+// EnableTOTP 为用户生成新的TOTP密钥
+func (s *twoFactorService) EnableTOTP(userID uint) (*TOTPEnrollment, error) {
+	user, err := s.userService.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, fmt.Errorf("生成TOTP密钥失败: %w", err)
+	}
+	if err := s.storage.SavePending(&UserTOTP{
+		UserID:    userID,
+		Secret:    secret,
+		CreatedAt: clockOrDefault(s.config.Clock).Now(),
+	}); err != nil {
+		return nil, err
+	}
+
+	account := user.Email
+	if account == "" {
+		account = user.Username
+	}
+	return &TOTPEnrollment{
+		Secret: secret,
+		URI:    TOTPProvisioningURI(s.config.Issuer, account, secret),
+	}, nil
+}
+
+// ConfirmTOTP 验证首个验证码后启用TOTP并生成恢复码
+func (s *twoFactorService) ConfirmTOTP(userID uint, code string) ([]string, error) {
+	record, err := s.storage.Get(userID)
+	if err != nil {
+		if errors.Is(err, ErrTOTPNotEnabled) {
+			return nil, ErrTOTPEnrollmentNotFound
+		}
+		return nil, err
+	}
+	if record.Enabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	now := clockOrDefault(s.config.Clock).Now()
+	step, ok := s.matchTOTP(record, normalizeOTP(code), now)
+	if !ok {
+		return nil, ErrInvalidTOTPCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes(s.config.RecoveryCodeCount)
+	if err != nil {
+		return nil, fmt.Errorf("生成恢复码失败: %w", err)
+	}
+	if err := s.storage.Enable(userID, step, hashes, now); err != nil {
+		return nil, err
+	}
+
+	if err := s.config.AuditLogger.Log(AuditEvent{
+		Type:      AuditEventTOTPEnabled,
+		UserID:    userID,
+		CreatedAt: now,
+	}); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// ValidateTOTP 验证TOTP验证码或恢复码
+//
+// 同一个时间步的验证码只能使用一次，已使用时间步之前的验证码同样拒绝，防止截获的验证码被重放。
+func (s *twoFactorService) ValidateTOTP(userID uint, code string) error {
+	record, err := s.enabledRecord(userID)
+	if err != nil {
+		return err
+	}
+	return s.verify(record, code)
+}
+
+// DisableTOTP 验证后关闭二次验证
+func (s *twoFactorService) DisableTOTP(userID uint, code string) error {
+	record, err := s.enabledRecord(userID)
+	if err != nil {
+		return err
+	}
+	if err := s.verify(record, code); err != nil {
+		return err
+	}
+	if err := s.storage.Delete(userID); err != nil {
+		return err
+	}
+
+	return s.config.AuditLogger.Log(AuditEvent{
+		Type:      AuditEventTOTPDisabled,
+		UserID:    userID,
+		CreatedAt: clockOrDefault(s.config.Clock).Now(),
+	})
+}
+
+// IsTOTPEnabled 检查用户是否已启用TOTP，未确认的设置不算启用
+func (s *twoFactorService) IsTOTPEnabled(userID uint) (bool, error) {
+	_, err := s.enabledRecord(userID)
+	if errors.Is(err, ErrTOTPNotEnabled) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// enabledRecord 获取已启用的TOTP设置，未启用时返回ErrTOTPNotEnabled
+func (s *twoFactorService) enabledRecord(userID uint) (*UserTOTP, error) {
+	record, err := s.storage.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !record.Enabled {
+		return nil, ErrTOTPNotEnabled
+	}
+	return record, nil
+}
+
+// verify 按格式区分TOTP验证码和恢复码并验证
+func (s *twoFactorService) verify(record *UserTOTP, code string) error {
+	normalized := normalizeOTP(code)
+	now := clockOrDefault(s.config.Clock).Now()
+
+	if isTOTPCode(normalized) {
+		step, ok := s.matchTOTP(record, normalized, now)
+		if !ok {
+			return ErrInvalidTOTPCode
+		}
+		used, err := s.storage.UseStep(record.UserID, step)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrInvalidTOTPCode
+		}
+		return nil
+	}
+
+	used, err := s.useRecoveryCode(record.UserID, normalized, now)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTOTPCode
+	}
+	return nil
+}
+
+// useRecoveryCode 标记规范化后的恢复码已使用并记录审计日志，恢复码不存在或已使用时返回false
+func (s *twoFactorService) useRecoveryCode(userID uint, normalized string, now time.Time) (bool, error) {
+	used, err := s.storage.UseRecoveryCode(userID, hashRecoveryCode(normalized), now)
+	if err != nil || !used {
+		return false, err
+	}
+	if err := s.config.AuditLogger.Log(AuditEvent{
+		Type:      AuditEventRecoveryCodeUsed,
+		UserID:    userID,
+		CreatedAt: now,
+	}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GenerateBackupCodes 重新生成恢复码，生成的恢复码与启用时返回的恢复码一样可以完成二次验证
+func (s *twoFactorService) GenerateBackupCodes(userID uint, count int) ([]string, error) {
+	if count <= 0 || count > s.config.MaxBackupCodes {
+		return nil, ErrInvalidBackupCodeCount
+	}
+	if _, err := s.enabledRecord(userID); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes(count)
+	if err != nil {
+		return nil, fmt.Errorf("生成恢复码失败: %w", err)
+	}
+	now := clockOrDefault(s.config.Clock).Now()
+	if err := s.storage.ReplaceRecoveryCodes(userID, hashes, now); err != nil {
+		return nil, err
+	}
+	if err := s.config.AuditLogger.Log(AuditEvent{
+		Type:      AuditEventBackupCodesGenerated,
+		UserID:    userID,
+		CreatedAt: now,
+	}); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// ConsumeBackupCode 验证并使用恢复码，用于二次验证之外的账号恢复流程，输入中的空格、连字符和大小写不影响匹配
+func (s *twoFactorService) ConsumeBackupCode(userID uint, code string) (bool, error) {
+	normalized := normalizeOTP(code)
+	if normalized == "" || isTOTPCode(normalized) {
+		return false, nil
+	}
+	return s.useRecoveryCode(userID, normalized, clockOrDefault(s.config.Clock).Now())
+}
+
+// RemainingBackupCodes 获取剩余恢复码数量，用于提示用户重新生成
+func (s *twoFactorService) RemainingBackupCodes(userID uint) (int, error) {
+	return s.storage.CountRecoveryCodes(userID)
+}
+
+// matchTOTP 按配置的时钟偏差匹配验证码，返回匹配的时间步
+func (s *twoFactorService) matchTOTP(record *UserTOTP, code string, now time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(record.Secret)
+	if err != nil {
+		return 0, false
+	}
+	return matchTOTP(key, code, now, s.config.Skew)
+}
+
+// checkTwoFactor 检查启用了TOTP的用户的二次验证，未配置或用户未启用时直接通过
+//
+// code为空时返回ErrTOTPRequired，客户端应提示输入验证码后调用LoginWithTOTP；验证码错误计入登录失败次数。
+// 返回本次登录完成的认证方式，通过二次验证时包含AMRMFA，签发的Token据此通过RequireMFA。
+func checkTwoFactor(db *gorm.DB, config *AuthConfig, user *User, code string, client ClientInfo) ([]string, error) {
+	passwordOnly := []string{AMRPassword}
+	if config.TwoFactor == nil {
+		return passwordOnly, nil
+	}
+	enabled, err := config.TwoFactor.IsTOTPEnabled(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return passwordOnly, nil
+	}
+	if code == "" {
+		return nil, ErrTOTPRequired
+	}
+
+	err = config.TwoFactor.ValidateTOTP(user.ID, code)
+	if errors.Is(err, ErrInvalidTOTPCode) {
+		recordIPFailure(config, client.IP)
+		if err := recordFailedLogin(db, config, user); err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []string{AMRPassword, AMROTP, AMRMFA}, nil
+}
+
+// TOTPProvisioningURI 生成身份验证器应用使用的otpauth://配置URI
+func TOTPProvisioningURI(issuer, account, secret string) string {
+	label := account
+	params := url.Values{}
+	params.Set("secret", secret)
+	if issuer != "" {
+		label = issuer + ":" + account
+		params.Set("issuer", issuer)
+	}
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", strconv.Itoa(totpDigits))
+	params.Set("period", strconv.Itoa(int(totpPeriod/time.Second)))
+
+	return "otpauth://totp/" + url.PathEscape(label) + "?" + params.Encode()
+}
+
+// generateTOTPSecret 生成base32编码的随机TOTP密钥
+func generateTOTPSecret() (string, error) {
+	key := make([]byte, totpSecretBytes)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(key), nil
+}
+
+// totpStep 计算时间所在的时间步
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(totpPeriod/time.Second)
+}
+
+// totpCode 按RFC 4226计算指定时间步的验证码
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// 动态截断
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%totpModulus)
+}
+
+// matchTOTP 检查验证码是否与now前后skew个时间步之一匹配，返回匹配的时间步
+func matchTOTP(key []byte, code string, now time.Time, skew int) (int64, bool) {
+	current := totpStep(now)
+	var matched int64
+	found := false
+	// 检查全部候选时间步，比较耗时与匹配位置无关
+	for offset := -int64(skew); offset <= int64(skew); offset++ {
+		step := current + offset
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 && !found {
+			matched, found = step, true
+		}
+	}
+	return matched, found
+}
+
+// isTOTPCode 检查是否为TOTP验证码格式（6位数字），其他格式按恢复码处理
+func isTOTPCode(code string) bool {
+	if len(code) != totpDigits {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeOTP 去掉用户输入中的空格和连字符并转为小写
+func normalizeOTP(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+}
+
+// generateRecoveryCodes 生成n个xxxxx-xxxxx格式的恢复码及其哈希
+func generateRecoveryCodes(n int) (codes, hashes []string, err error) {
+	buf := make([]byte, recoveryCodeBytes)
+	for i := 0; i < n; i++ {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(totpEncoding.EncodeToString(buf))[:10]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, hashRecoveryCode(raw))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode 计算规范化后恢复码的哈希，恢复码为随机生成，不需要慢哈希
+func hashRecoveryCode(normalized string) string {
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// gormTOTPStorage 基于GORM的TOTP存储实现
+type gormTOTPStorage struct {
+	db *gorm.DB
+}
+
+// NewGormTOTPStorage 创建基于数据库的TOTP存储
+func NewGormTOTPStorage(db *gorm.DB) TOTPStorage {
+	return &gormTOTPStorage{db: db}
+}
+
+// Get 获取用户的TOTP设置
+func (s *gormTOTPStorage) Get(userID uint) (*UserTOTP, error) {
+	var record UserTOTP
+	if err := s.db.Where("user_id = ?", userID).First(&record).Error; err != nil {
+		return nil, wrapNotFound(err, ErrTOTPNotEnabled)
+	}
+	return &record, nil
+}
+
+// SavePending 替换用户未确认的TOTP设置
+func (s *gormTOTPStorage) SavePending(record *UserTOTP) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var enabled int64
+		if err := tx.Model(&UserTOTP{}).Where("user_id = ? AND enabled = ?", record.UserID, true).Count(&enabled).Error; err != nil {
+			return err
+		}
+		if enabled > 0 {
+			return ErrTOTPAlreadyEnabled
+		}
+		if err := tx.Where("user_id = ?", record.UserID).Delete(&UserTOTP{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(record).Error
+	})
+}
+
+// Enable 启用TOTP并替换恢复码，通过带条件的UPDATE保证并发确认时只有一个请求成功
+func (s *gormTOTPStorage) Enable(userID uint, step int64, recoveryCodeHashes []string, now time.Time) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&UserTOTP{}).
+			Where("user_id = ? AND enabled = ?", userID, false).
+			Updates(map[string]interface{}{
+				"enabled":        true,
+				"enabled_at":     now,
+				"last_used_step": step,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTOTPEnrollmentNotFound
+		}
+		return replaceRecoveryCodes(tx, userID, recoveryCodeHashes, now)
+	})
+}
+
+// ReplaceRecoveryCodes 在事务中替换已启用TOTP的用户的恢复码
+func (s *gormTOTPStorage) ReplaceRecoveryCodes(userID uint, codeHashes []string, now time.Time) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var enabled int64
+		if err := tx.Model(&UserTOTP{}).Where("user_id = ? AND enabled = ?", userID, true).Count(&enabled).Error; err != nil {
+			return err
+		}
+		if enabled == 0 {
+			return ErrTOTPNotEnabled
+		}
+		return replaceRecoveryCodes(tx, userID, codeHashes, now)
+	})
+}
+
+// replaceRecoveryCodes 删除用户的全部恢复码并保存新的恢复码哈希，调用方需在事务中调用
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, codeHashes []string, now time.Time) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	codes := make([]RecoveryCode, 0, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes = append(codes, RecoveryCode{UserID: userID, CodeHash: hash, CreatedAt: now})
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return tx.Create(&codes).Error
+}
+
+// CountRecoveryCodes 统计未使用的恢复码
+func (s *gormTOTPStorage) CountRecoveryCodes(userID uint) (int, error) {
+	var count int64
+	err := s.db.Model(&RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return int(count), err
+}
+
+// UseStep 记录验证通过的时间步，并发使用同一验证码时只有一个请求成功
+func (s *gormTOTPStorage) UseStep(userID uint, step int64) (bool, error) {
+	result := s.db.Model(&UserTOTP{}).
+		Where("user_id = ? AND enabled = ? AND last_used_step < ?", userID, true, step).
+		Update("last_used_step", step)
+	return result.RowsAffected > 0, result.Error
+}
+
+// UseRecoveryCode 标记恢复码已使用，并发使用同一恢复码时只有一个请求成功
+func (s *gormTOTPStorage) UseRecoveryCode(userID uint, codeHash string, now time.Time) (bool, error) {
+	result := s.db.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", now)
+	return result.RowsAffected > 0, result.Error
+}
+
+// Delete 删除用户的TOTP设置和恢复码
+func (s *gormTOTPStorage) Delete(userID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&UserTOTP{}).Error
+	})
+}
+
+// MemoryTOTPStorage 内存TOTP存储实现
+type MemoryTOTPStorage struct {
+	records       map[uint]*UserTOTP
+	recoveryCodes map[uint]map[string]bool // 用户ID -> 恢复码哈希 -> 是否已使用
+	mutex         sync.Mutex
+}
+
+// NewMemoryTOTPStorage 创建内存TOTP存储
+func NewMemoryTOTPStorage() *MemoryTOTPStorage {
+	return &MemoryTOTPStorage{
+		records:       make(map[uint]*UserTOTP),
+		recoveryCodes: make(map[uint]map[string]bool),
+	}
+}
+
+// Get 获取用户的TOTP设置
+func (s *MemoryTOTPStorage) Get(userID uint) (*UserTOTP, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	record, exists := s.records[userID]
+	if !exists {
+		return nil, ErrTOTPNotEnabled
+	}
+	copied := *record
+	return &copied, nil
+}
+
+// SavePending 替换用户未确认的TOTP设置
+func (s *MemoryTOTPStorage) SavePending(record *UserTOTP) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if existing, exists := s.records[record.UserID]; exists && existing.Enabled {
+		return ErrTOTPAlreadyEnabled
+	}
+	stored := *record
+	s.records[record.UserID] = &stored
+	return nil
+}
+
+// Enable 启用TOTP并替换恢复码
+func (s *MemoryTOTPStorage) Enable(userID uint, step int64, recoveryCodeHashes []string, now time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	record, exists := s.records[userID]
+	if !exists || record.Enabled {
+		return ErrTOTPEnrollmentNotFound
+	}
+	record.Enabled = true
+	record.EnabledAt = &now
+	record.LastUsedStep = step
+	s.replaceRecoveryCodes(userID, recoveryCodeHashes)
+	return nil
+}
+
+// ReplaceRecoveryCodes 替换已启用TOTP的用户的恢复码
+func (s *MemoryTOTPStorage) ReplaceRecoveryCodes(userID uint, codeHashes []string, now time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if record, exists := s.records[userID]; !exists || !record.Enabled {
+		return ErrTOTPNotEnabled
+	}
+	s.replaceRecoveryCodes(userID, codeHashes)
+	return nil
+}
+
+// replaceRecoveryCodes 替换用户的恢复码，调用方需持有锁
+func (s *MemoryTOTPStorage) replaceRecoveryCodes(userID uint, codeHashes []string) {
+	codes := make(map[string]bool, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes[hash] = false
+	}
+	s.recoveryCodes[userID] = codes
+}
+
+// CountRecoveryCodes 统计未使用的恢复码
+func (s *MemoryTOTPStorage) CountRecoveryCodes(userID uint) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count := 0
+	for _, used := range s.recoveryCodes[userID] {
+		if !used {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// UseStep 记录验证通过的时间步
+func (s *MemoryTOTPStorage) UseStep(userID uint, step int64) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	record, exists := s.records[userID]
+	if !exists || !record.Enabled || step <= record.LastUsedStep {
+		return false, nil
+	}
+	record.LastUsedStep = step
+	return true, nil
+}
+
+// UseRecoveryCode 标记恢复码已使用
+func (s *MemoryTOTPStorage) UseRecoveryCode(userID uint, codeHash string, now time.Time) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	used, exists := s.recoveryCodes[userID][codeHash]
+	if !exists || used {
+		return false, nil
+	}
+	s.recoveryCodes[userID][codeHash] = true
+	return true, nil
+}
+
+// Delete 删除用户的TOTP设置和恢复码
+func (s *MemoryTOTPStorage) Delete(userID uint) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.records, userID)
+	delete(s.recoveryCodes, userID)
+	return nil
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// totpUserService 测试用用户服务，按用户名和ID返回预设用户
+type totpUserService struct {
+	UserService
+	user *User
+}
+
+func (s *totpUserService) GetUserByUsername(username string) (*User, error) {
+	if username != s.user.Username {
+		return nil, ErrUserNotFound
+	}
+	copied := *s.user
+	return &copied, nil
+}
+
+func (s *totpUserService) GetUserByID(id uint) (*User, error) {
+	if id != s.user.ID {
+		return nil, ErrUserNotFound
+	}
+	copied := *s.user
+	return &copied, nil
+}
+
+func (s *totpUserService) UpdateLastLogin(userID uint, t time.Time) error {
+	return nil
+}
+
+// currentTOTP 计算密钥在指定时间的验证码
+func currentTOTP(t *testing.T, secret string, now time.Time) string {
+	key, err := totpEncoding.DecodeString(secret)
+	assert.NoError(t, err)
+	return totpCode(key, totpStep(now))
+}
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 附录B的SHA1测试向量，取8位验证码的后6位
+	key := []byte("12345678901234567890")
+	for unix, want := range map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	} {
+		assert.Equal(t, want, totpCode(key, totpStep(time.Unix(unix, 0))), unix)
+	}
+}
+
+func TestMatchTOTPClockSkew(t *testing.T) {
+	key := []byte("12345678901234567890")
+	now := time.Unix(1234567890, 0)
+	step := totpStep(now)
+
+	t.Run("容许前后各一个时间步", func(t *testing.T) {
+		for _, offset := range []int64{-1, 0, 1} {
+			matched, ok := matchTOTP(key, totpCode(key, step+offset), now, 1)
+			assert.True(t, ok, offset)
+			assert.Equal(t, step+offset, matched, offset)
+		}
+	})
+
+	t.Run("超出容许范围的验证码被拒绝", func(t *testing.T) {
+		for _, offset := range []int64{-2, 2} {
+			_, ok := matchTOTP(key, totpCode(key, step+offset), now, 1)
+			assert.False(t, ok, offset)
+		}
+	})
+
+	t.Run("不容许偏差时只接受当前时间步", func(t *testing.T) {
+		_, ok := matchTOTP(key, totpCode(key, step), now, 0)
+		assert.True(t, ok)
+		_, ok = matchTOTP(key, totpCode(key, step-1), now, 0)
+		assert.False(t, ok)
+	})
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri, err := url.Parse(TOTPProvisioningURI("Example App", "alice@example.com", "JBSWY3DPEHPK3PXP"))
+	assert.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/Example App:alice@example.com", uri.Path)
+
+	query := uri.Query()
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", query.Get("secret"))
+	assert.Equal(t, "Example App", query.Get("issuer"))
+	assert.Equal(t, "6", query.Get("digits"))
+	assert.Equal(t, "30", query.Get("period"))
+
+	// 不设置发行方时标签只有账户名
+	assert.True(t, strings.HasPrefix(TOTPProvisioningURI("", "alice", "ABC"), "otpauth://totp/alice?"))
+}
+
+func TestTwoFactorService(t *testing.T) {
+	user := &User{Username: "alice", Email: "alice@example.com"}
+	user.ID = 1
+
+	// newService 创建使用内存存储和FakeClock的服务
+	newService := func() (TwoFactorService, *FakeClock, *MemoryAuditLogger) {
+		clock := NewFakeClock(time.Unix(1700000000, 0))
+		auditLogger := NewMemoryAuditLogger()
+		config := DefaultTwoFactorConfig()
+		config.Clock = clock
+		config.AuditLogger = auditLogger
+		return NewTwoFactorService(NewMemoryTOTPStorage(), &fixedUserService{user: user}, config), clock, auditLogger
+	}
+
+	// enable 启用TOTP并返回密钥和恢复码
+	enable := func(t *testing.T, service TwoFactorService, clock *FakeClock) (string, []string) {
+		enrollment, err := service.EnableTOTP(user.ID)
+		assert.NoError(t, err)
+		codes, err := service.ConfirmTOTP(user.ID, currentTOTP(t, enrollment.Secret, clock.Now()))
+		assert.NoError(t, err)
+		return enrollment.Secret, codes
+	}
+
+	t.Run("确认后才启用", func(t *testing.T) {
+		service, clock, auditLogger := newService()
+
+		enrollment, err := service.EnableTOTP(user.ID)
+		assert.NoError(t, err)
+		assert.Len(t, enrollment.Secret, 32)
+		assert.Contains(t, enrollment.URI, "aigo_service_auth:alice@example.com")
+
+		enabled, err := service.IsTOTPEnabled(user.ID)
+		assert.NoError(t, err)
+		assert.False(t, enabled)
+		assert.True(t, errors.Is(service.ValidateTOTP(user.ID, "123456"), ErrTOTPNotEnabled))
+
+		_, err = service.ConfirmTOTP(user.ID, "000000")
+		assert.True(t, errors.Is(err, ErrInvalidTOTPCode))
+
+		codes, err := service.ConfirmTOTP(user.ID, currentTOTP(t, enrollment.Secret, clock.Now()))
+		assert.NoError(t, err)
+		assert.Len(t, codes, 10)
+		enabled, _ = service.IsTOTPEnabled(user.ID)
+		assert.True(t, enabled)
+		assert.Equal(t, AuditEventTOTPEnabled, auditLogger.Events()[0].Type)
+
+		_, err = service.EnableTOTP(user.ID)
+		assert.True(t, errors.Is(err, ErrTOTPAlreadyEnabled))
+		_, err = service.ConfirmTOTP(user.ID, "000000")
+		assert.True(t, errors.Is(err, ErrTOTPAlreadyEnabled))
+	})
+
+	t.Run("未开始启用时不能确认", func(t *testing.T) {
+		service, _, _ := newService()
+		_, err := service.ConfirmTOTP(user.ID, "123456")
+		assert.True(t, errors.Is(err, ErrTOTPEnrollmentNotFound))
+	})
+
+	t.Run("重新开始启用会替换未确认的密钥", func(t *testing.T) {
+		service, clock, _ := newService()
+		first, _ := service.EnableTOTP(user.ID)
+		second, _ := service.EnableTOTP(user.ID)
+		assert.NotEqual(t, first.Secret, second.Secret)
+
+		_, err := service.ConfirmTOTP(user.ID, currentTOTP(t, first.Secret, clock.Now()))
+		assert.True(t, errors.Is(err, ErrInvalidTOTPCode))
+	})
+
+	t.Run("容许客户端时钟偏差一个时间步", func(t *testing.T) {
+		service, clock, _ := newService()
+		secret, _ := enable(t, service, clock)
+
+		// 确认时已使用当前时间步，从之后的时间步开始
+		clock.Advance(2 * totpPeriod)
+		// 客户端慢一个时间步
+		assert.NoError(t, service.ValidateTOTP(user.ID, currentTOTP(t, secret, clock.Now().Add(-totpPeriod))))
+		clock.Advance(3 * totpPeriod)
+		// 客户端快一个时间步
+		assert.NoError(t, service.ValidateTOTP(user.ID, currentTOTP(t, secret, clock.Now().Add(totpPeriod))))
+
+		clock.Advance(3 * totpPeriod)
+		err := service.ValidateTOTP(user.ID, currentTOTP(t, secret, clock.Now().Add(2*totpPeriod)))
+		assert.True(t, errors.Is(err, ErrInvalidTOTPCode), "偏差两个时间步时拒绝")
+	})
+
+	t.Run("验证码不能重复使用", func(t *testing.T) {
+		service, clock, _ := newService()
+		secret, _ := enable(t, service, clock)
+
+		// 确认时使用的验证码不能再用于登录
+		code := currentTOTP(t, secret, clock.Now())
+		assert.True(t, errors.Is(service.ValidateTOTP(user.ID, code), ErrInvalidTOTPCode))
+
+		clock.Advance(totpPeriod)
+		code = currentTOTP(t, secret, clock.Now())
+		assert.NoError(t, service.ValidateTOTP(user.ID, code))
+		assert.True(t, errors.Is(service.ValidateTOTP(user.ID, code), ErrInvalidTOTPCode))
+
+		// 已使用时间步之前的验证码同样拒绝
+		previous := currentTOTP(t, secret, clock.Now().Add(-totpPeriod))
+		assert.True(t, errors.Is(service.ValidateTOTP(user.ID, previous), ErrInvalidTOTPCode))
+	})
+
+	t.Run("恢复码只能使用一次", func(t *testing.T) {
+		service, clock, auditLogger := newService()
+		_, codes := enable(t, service, clock)
+
+		for _, code := range codes {
+			assert.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, code)
+		}
+
+		// 忽略大小写、空格和连字符
+		assert.NoError(t, service.ValidateTOTP(user.ID, " "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))+" "))
+		assert.True(t, errors.Is(service.ValidateTOTP(user.ID, codes[0]), ErrInvalidTOTPCode))
+		assert.NoError(t, service.ValidateTOTP(user.ID, codes[1]))
+		assert.True(t, errors.Is(service.ValidateTOTP(user.ID, "aaaaa-bbbbb"), ErrInvalidTOTPCode))
+
+		events := auditLogger.Events()
+		assert.Equal(t, AuditEventRecoveryCodeUsed, events[len(events)-1].Type)
+	})
+
+	t.Run("重新生成的恢复码用于二次验证和账号恢复", func(t *testing.T) {
+		service, clock, auditLogger := newService()
+		_, err := service.GenerateBackupCodes(user.ID, 5)
+		assert.True(t, errors.Is(err, ErrTOTPNotEnabled), "未启用二次验证时不能生成")
+
+		_, initial := enable(t, service, clock)
+		codes, err := service.GenerateBackupCodes(user.ID, 3)
+		assert.NoError(t, err)
+		assert.Len(t, codes, 3)
+		assert.Equal(t, AuditEventBackupCodesGenerated, auditLogger.Events()[len(auditLogger.Events())-1].Type)
+
+		// 重新生成使之前的恢复码失效
+		assert.True(t, errors.Is(service.ValidateTOTP(user.ID, initial[0]), ErrInvalidTOTPCode))
+
+		// 新恢复码可以完成二次验证，也可以单独消费，每个只能使用一次
+		assert.NoError(t, service.ValidateTOTP(user.ID, codes[0]))
+		ok, err := service.ConsumeBackupCode(user.ID, codes[0])
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		ok, err = service.ConsumeBackupCode(user.ID, " "+strings.ToUpper(strings.ReplaceAll(codes[1], "-", ""))+" ")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.True(t, errors.Is(service.ValidateTOTP(user.ID, codes[1]), ErrInvalidTOTPCode))
+
+		ok, err = service.ConsumeBackupCode(user.ID+1, codes[2])
+		assert.NoError(t, err)
+		assert.False(t, ok, "恢复码只对所属用户有效")
+		ok, err = service.ConsumeBackupCode(user.ID, "")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		remaining, err := service.RemainingBackupCodes(user.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, remaining)
+		assert.Equal(t, AuditEventRecoveryCodeUsed, auditLogger.Events()[len(auditLogger.Events())-1].Type)
+
+		for _, count := range []int{0, -1, 21} {
+			_, err := service.GenerateBackupCodes(user.ID, count)
+			assert.True(t, errors.Is(err, ErrInvalidBackupCodeCount), count)
+		}
+	})
+
+	t.Run("关闭需要有效的验证码", func(t *testing.T) {
+		service, clock, _ := newService()
+		secret, codes := enable(t, service, clock)
+
+		assert.True(t, errors.Is(service.DisableTOTP(user.ID, "000000"), ErrInvalidTOTPCode))
+
+		clock.Advance(totpPeriod)
+		assert.NoError(t, service.DisableTOTP(user.ID, currentTOTP(t, secret, clock.Now())))
+		enabled, _ := service.IsTOTPEnabled(user.ID)
+		assert.False(t, enabled)
+
+		// 关闭后恢复码一并失效
+		assert.True(t, errors.Is(service.ValidateTOTP(user.ID, codes[0]), ErrTOTPNotEnabled))
+		assert.True(t, errors.Is(service.DisableTOTP(user.ID, codes[0]), ErrTOTPNotEnabled))
+	})
+}
+
+func TestGormTOTPStorageRecoveryCodes(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	storage := NewGormTOTPStorage(testDB.DB)
+	now := time.Unix(1700000000, 0)
+	assert.True(t, errors.Is(storage.ReplaceRecoveryCodes(1, []string{"a"}, now), ErrTOTPNotEnabled))
+
+	assert.NoError(t, storage.SavePending(&UserTOTP{UserID: 1, Secret: "secret", CreatedAt: now}))
+	assert.NoError(t, storage.Enable(1, 1, []string{"a", "b"}, now))
+	assert.NoError(t, storage.ReplaceRecoveryCodes(1, []string{"c", "d", "e"}, now))
+
+	used, err := storage.UseRecoveryCode(1, "a", now)
+	assert.NoError(t, err)
+	assert.False(t, used, "替换后旧恢复码失效")
+	used, err = storage.UseRecoveryCode(1, "c", now)
+	assert.NoError(t, err)
+	assert.True(t, used)
+
+	remaining, err := storage.CountRecoveryCodes(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, remaining)
+}
+
+func TestLoginWithTOTP(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	config := DefaultAuthConfig()
+	config.Clock = clock
+
+	user := &User{Username: "alice", Email: "alice@example.com", Status: 1}
+	user.ID = 1
+	userService := &totpUserService{user: user}
+	twoFactorConfig := DefaultTwoFactorConfig()
+	twoFactorConfig.Clock = clock
+	twoFactor := NewTwoFactorService(NewMemoryTOTPStorage(), userService, twoFactorConfig)
+	config.TwoFactor = twoFactor
+
+	tokens := NewTokenServiceWithClock("test-secret-key", time.Hour, clock)
+	service := NewAuthServiceWithConfig(nil, userService, tokens, config)
+	loginService := NewLoginService(nil, userService, tokens, service)
+	hash, err := service.(*authService).HashPassword("password123")
+	assert.NoError(t, err)
+	user.PasswordHash = hash
+
+	// requireMFA 按RequireAuth、RequireMFA的顺序请求受保护的接口，返回响应码
+	middleware := NewAuthMiddleware(service)
+	protected := middleware.RequireAuth(middleware.RequireMFA(tokens)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+	requireMFA := func(token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/account/delete", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		recorder := httptest.NewRecorder()
+		protected.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	t.Run("未启用二次验证时直接登录", func(t *testing.T) {
+		_, token, err := service.Login("alice", "password123")
+		assert.NoError(t, err)
+		assert.NotEmpty(t, token)
+
+		// 只验证了密码的会话不能通过RequireMFA
+		amr, err := tokens.ParseAMR(token)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{AMRPassword}, amr)
+		assert.Equal(t, http.StatusForbidden, requireMFA(token))
+	})
+
+	enrollment, err := twoFactor.EnableTOTP(user.ID)
+	assert.NoError(t, err)
+	codes, err := twoFactor.ConfirmTOTP(user.ID, currentTOTP(t, enrollment.Secret, clock.Now()))
+	assert.NoError(t, err)
+	clock.Advance(totpPeriod)
+
+	t.Run("启用后密码正确也需要二次验证", func(t *testing.T) {
+		_, token, err := service.Login("alice", "password123")
+		assert.True(t, errors.Is(err, ErrTOTPRequired))
+		assert.Empty(t, token)
+		assert.Equal(t, "mfa_required", CodeOf(err))
+
+		// 密码错误时不提示需要二次验证
+		_, _, err = service.Login("alice", "wrong")
+		assert.True(t, errors.Is(err, ErrInvalidCredentials))
+	})
+
+	t.Run("使用验证码完成登录", func(t *testing.T) {
+		_, _, err := service.LoginWithTOTP("alice", "password123", "000000")
+		assert.True(t, errors.Is(err, ErrInvalidTOTPCode))
+
+		loggedIn, token, err := service.LoginWithTOTP("alice", "password123", currentTOTP(t, enrollment.Secret, clock.Now()))
+		assert.NoError(t, err)
+		assert.NotEmpty(t, token)
+		assert.Equal(t, user.ID, loggedIn.ID)
+		assert.Equal(t, http.StatusOK, requireMFA(token), "通过二次验证登录的会话可以通过RequireMFA")
+
+		// 刷新后仍保留多因素认证状态
+		refreshed, err := service.RefreshToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, requireMFA(refreshed))
+
+		// 验证码正确但密码错误时仍拒绝
+		clock.Advance(totpPeriod)
+		_, _, err = service.LoginWithTOTP("alice", "wrong", currentTOTP(t, enrollment.Secret, clock.Now()))
+		assert.True(t, errors.Is(err, ErrInvalidCredentials))
+	})
+
+	t.Run("LoginService签发的Token同样通过RequireMFA", func(t *testing.T) {
+		clock.Advance(totpPeriod)
+		_, token, err := loginService.LoginWithTOTP("alice", "password123", currentTOTP(t, enrollment.Secret, clock.Now()))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, requireMFA(token))
+
+		refreshed, err := loginService.RefreshToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, requireMFA(refreshed))
+	})
+
+	t.Run("使用恢复码完成登录", func(t *testing.T) {
+		_, token, err := service.LoginWithTOTP("alice", "password123", codes[0])
+		assert.NoError(t, err)
+		assert.NotEmpty(t, token)
+
+		_, _, err = service.LoginWithTOTP("alice", "password123", codes[0])
+		assert.True(t, errors.Is(err, ErrInvalidTOTPCode))
+	})
+}
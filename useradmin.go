@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"aigo_service_auth/errorcodes"
+)
+
+// ErrReadDeletedDenied 没有user.read_deleted权限时查询已软删除的用户
+var ErrReadDeletedDenied = errors.New("没有查看已删除用户的权限")
+
+// CheckReadDeleted 检查查看者能否读取已软删除的用户，没有user.read_deleted权限时返回ErrReadDeletedDenied
+//
+// 调用UserService的Unscoped查询或IncludeDeleted、DeletedOnly过滤条件前必须先检查。
+func CheckReadDeleted(rs RoleService, viewerID uint) error {
+	allowed, err := rs.HasPermission(viewerID, PermissionResourceUser, PermissionActionReadDeleted)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrReadDeletedDenied
+	}
+	return nil
+}
+
+// UserListResponse 管理后台用户列表响应
+type UserListResponse struct {
+	Users []UserDetail `json:"users"`
+	Total int64        `json:"total"`
+}
+
+// UserListHandler 管理后台用户列表处理器，挂载为GET /admin/users
+//
+// 需要认证且拥有user.read权限，支持page、page_size分页，指定username或email时只查找该用户。
+// include_deleted=true或deleted_only=true时包含已软删除的用户，还需要user.read_deleted权限，否则返回403。
+// 邮箱和手机号按PresentUsers的规则脱敏，已删除用户带有deleted_at字段。
+func (m *AuthMiddleware) UserListHandler(userService UserService, roleService RoleService) http.Handler {
+	return m.RequirePermission(PermissionResourceUser, PermissionActionRead, roleService)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeErrorCode(w, errorcodes.ErrCodeMethodNotAllowed, "不支持的请求方法")
+			return
+		}
+		viewer, ok := GetUserFromContext(r.Context())
+		if !ok || viewer == nil {
+			writeErrorCode(w, errorcodes.ErrCodeInternal, "用户信息获取失败")
+			return
+		}
+
+		query := r.URL.Query()
+		var filter UserFilter
+		var err error
+		if filter.IncludeDeleted, err = parseBoolParam(query.Get("include_deleted")); err != nil {
+			writeErrorCode(w, errorcodes.ErrCodeInvalidArgument, "无效的include_deleted参数")
+			return
+		}
+		if filter.DeletedOnly, err = parseBoolParam(query.Get("deleted_only")); err != nil {
+			writeErrorCode(w, errorcodes.ErrCodeInvalidArgument, "无效的deleted_only参数")
+			return
+		}
+		withDeleted := filter.IncludeDeleted || filter.DeletedOnly
+		if withDeleted {
+			if err := CheckReadDeleted(roleService, viewer.ID); err != nil {
+				WriteError(w, err)
+				return
+			}
+		}
+
+		var users []*User
+		var total int64
+		switch username, email := query.Get("username"), query.Get("email"); {
+		case username != "" || email != "":
+			user, err := lookupUser(userService, username, email, withDeleted)
+			if err != nil {
+				WriteError(w, err)
+				return
+			}
+			users, total = []*User{user}, 1
+		default:
+			page, err := parseIntParam(query.Get("page"), 1)
+			if err != nil {
+				writeErrorCode(w, errorcodes.ErrCodeInvalidArgument, "无效的page参数")
+				return
+			}
+			pageSize, err := parseIntParam(query.Get("page_size"), 10)
+			if err != nil {
+				writeErrorCode(w, errorcodes.ErrCodeInvalidArgument, "无效的page_size参数")
+				return
+			}
+			if users, total, err = userService.ListUsersWithFilter(filter, page, pageSize); err != nil {
+				WriteError(w, err)
+				return
+			}
+		}
+
+		presented, err := PresentUsers(roleService, viewer.ID, users)
+		if err != nil {
+			writeErrorCode(w, errorcodes.ErrCodeInternal, "权限检查失败")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(UserListResponse{Users: presented, Total: total})
+	}))
+}
+
+// lookupUser 按用户名或邮箱查找用户，withDeleted为true时包含已软删除的用户，调用方需先检查权限
+func lookupUser(userService UserService, username, email string, withDeleted bool) (*User, error) {
+	switch {
+	case username != "" && withDeleted:
+		return userService.GetUserByUsernameUnscoped(username)
+	case username != "":
+		return userService.GetUserByUsername(username)
+	case withDeleted:
+		return userService.GetUserByEmailUnscoped(email)
+	default:
+		return userService.GetUserByEmail(email)
+	}
+}
+
+// parseBoolParam 解析布尔查询参数，为空时返回false
+func parseBoolParam(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// parseIntParam 解析正整数查询参数，为空时返回默认值
+func parseIntParam(value string, defaultValue int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, ErrInvalidArgument
+	}
+	return n, nil
+}
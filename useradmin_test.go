@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// actionRoleService 测试用角色服务，按操作名授予权限
+type actionRoleService struct {
+	RoleService
+	actions map[string]bool
+}
+
+func (s *actionRoleService) HasPermission(userID uint, resource, action string) (bool, error) {
+	return resource == PermissionResourceUser && s.actions[action], nil
+}
+
+// deletedUserService 测试用用户服务，记录查询是否包含已软删除的用户
+type deletedUserService struct {
+	UserService
+	active      *User
+	deleted     *User
+	lastFilter  *UserFilter
+	unscopedHit bool
+}
+
+func (s *deletedUserService) ListUsersWithFilter(filter UserFilter, page, pageSize int) ([]*User, int64, error) {
+	s.lastFilter = &filter
+	switch {
+	case filter.DeletedOnly:
+		return []*User{s.deleted}, 1, nil
+	case filter.IncludeDeleted:
+		return []*User{s.active, s.deleted}, 2, nil
+	default:
+		return []*User{s.active}, 1, nil
+	}
+}
+
+func (s *deletedUserService) GetUserByUsername(username string) (*User, error) {
+	if username == s.active.Username {
+		return s.active, nil
+	}
+	return nil, ErrUserNotFound
+}
+
+func (s *deletedUserService) GetUserByUsernameUnscoped(username string) (*User, error) {
+	s.unscopedHit = true
+	if username == s.deleted.Username {
+		return s.deleted, nil
+	}
+	return s.GetUserByUsername(username)
+}
+
+func (s *deletedUserService) GetUserByEmailUnscoped(email string) (*User, error) {
+	s.unscopedHit = true
+	return s.deleted, nil
+}
+
+func TestUserListHandler(t *testing.T) {
+	admin := &User{Username: "admin"}
+	admin.ID = 1
+	active := &User{Username: "alice", Email: "alice@example.com"}
+	active.ID = 7
+	deleted := &User{Username: "bob", Email: "bob@example.com"}
+	deleted.ID = 8
+	deleted.DeletedAt = gorm.DeletedAt{Time: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), Valid: true}
+
+	middleware := NewAuthMiddleware(&stubAuthService{user: admin})
+	serve := func(roleService RoleService, target string) (*httptest.ResponseRecorder, *deletedUserService) {
+		users := &deletedUserService{active: active, deleted: deleted}
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer valid-token")
+		recorder := httptest.NewRecorder()
+		middleware.UserListHandler(users, roleService).ServeHTTP(recorder, req)
+		return recorder, users
+	}
+	decode := func(t *testing.T, recorder *httptest.ResponseRecorder) UserListResponse {
+		var body UserListResponse
+		assert.NoError(t, json.NewDecoder(recorder.Body).Decode(&body))
+		return body
+	}
+	reader := &actionRoleService{actions: map[string]bool{PermissionActionRead: true}}
+	investigator := &actionRoleService{actions: map[string]bool{PermissionActionRead: true, PermissionActionReadDeleted: true}}
+
+	t.Run("需要查看用户权限", func(t *testing.T) {
+		recorder, _ := serve(&actionRoleService{}, "/admin/users")
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+	})
+
+	t.Run("默认不包含已删除用户", func(t *testing.T) {
+		recorder, users := serve(reader, "/admin/users")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		body := decode(t, recorder)
+		assert.Equal(t, int64(1), body.Total)
+		assert.Equal(t, UserFilter{}, *users.lastFilter)
+		assert.Equal(t, "a***e@exa***.com", body.Users[0].Email, "没有user.read_pii权限时脱敏")
+	})
+
+	t.Run("没有查看已删除用户权限时拒绝", func(t *testing.T) {
+		for _, target := range []string{
+			"/admin/users?include_deleted=true",
+			"/admin/users?deleted_only=1",
+			"/admin/users?username=bob&include_deleted=true",
+			"/admin/users?email=bob@example.com&deleted_only=true",
+		} {
+			recorder, users := serve(reader, target)
+			assert.Equal(t, http.StatusForbidden, recorder.Code, target)
+			assert.Contains(t, recorder.Body.String(), `"code":"permission_denied"`, target)
+			assert.Nil(t, users.lastFilter, target)
+			assert.False(t, users.unscopedHit, target)
+		}
+	})
+
+	t.Run("有权限时列出已删除用户", func(t *testing.T) {
+		recorder, users := serve(investigator, "/admin/users?include_deleted=true")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.True(t, users.lastFilter.IncludeDeleted)
+		body := decode(t, recorder)
+		assert.Equal(t, int64(2), body.Total)
+		if assert.Len(t, body.Users, 2) {
+			assert.Nil(t, body.Users[0].DeletedAt)
+			assert.NotNil(t, body.Users[1].DeletedAt)
+		}
+
+		recorder, users = serve(investigator, "/admin/users?deleted_only=true")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.True(t, users.lastFilter.DeletedOnly)
+		assert.Equal(t, int64(1), decode(t, recorder).Total)
+	})
+
+	t.Run("按用户名查找已删除用户", func(t *testing.T) {
+		recorder, _ := serve(reader, "/admin/users?username=bob")
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+		recorder, users := serve(investigator, "/admin/users?username=bob&include_deleted=true")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.True(t, users.unscopedHit)
+		body := decode(t, recorder)
+		if assert.Len(t, body.Users, 1) {
+			assert.Equal(t, "bob", body.Users[0].Username)
+			assert.NotNil(t, body.Users[0].DeletedAt)
+		}
+	})
+
+	t.Run("无效的参数", func(t *testing.T) {
+		recorder, _ := serve(investigator, "/admin/users?include_deleted=maybe")
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		recorder, _ = serve(reader, "/admin/users?page=0")
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+}
+
+func TestCheckReadDeleted(t *testing.T) {
+	assert.NoError(t, CheckReadDeleted(&actionRoleService{actions: map[string]bool{PermissionActionReadDeleted: true}}, 1))
+	assert.True(t, errors.Is(CheckReadDeleted(&actionRoleService{}, 1), ErrReadDeletedDenied))
+	assert.Error(t, CheckReadDeleted(&checkRoleService{err: errors.New("数据库不可用")}, 1))
+}
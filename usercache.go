@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheStore 键值缓存存储接口，多实例部署时应使用共享存储（如RedisCacheStore）
+type CacheStore interface {
+	// 读取缓存，不存在或已过期时found为false
+	Get(key string) (value []byte, found bool, err error)
+	// 写入缓存，ttl后过期
+	Set(key string, value []byte, ttl time.Duration) error
+	// 删除缓存，键不存在时不返回错误
+	Delete(key string) error
+}
+
+// memoryCacheEntry 内存缓存项
+type memoryCacheEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// MemoryCacheStore 按最近最少使用淘汰的内存缓存，只在单个实例内有效
+type MemoryCacheStore struct {
+	capacity int
+	clock    Clock
+	mutex    sync.Mutex
+	order    *list.List // 最近使用的在前
+	entries  map[string]*list.Element
+}
+
+// NewMemoryCacheStore 创建最多保存capacity项的内存缓存，capacity不大于0时为10000，clock为nil时使用系统时间
+func NewMemoryCacheStore(capacity int, clock Clock) *MemoryCacheStore {
+	if capacity <= 0 {
+		capacity = 10000
+	}
+	return &MemoryCacheStore{
+		capacity: capacity,
+		clock:    clockOrDefault(clock),
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Get 读取未过期的缓存项，过期项读取时删除
+func (s *MemoryCacheStore) Get(key string) ([]byte, bool, error) {
+	now := s.clock.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	element, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := element.Value.(*memoryCacheEntry)
+	if !now.Before(entry.expiresAt) {
+		s.order.Remove(element)
+		delete(s.entries, key)
+		return nil, false, nil
+	}
+	s.order.MoveToFront(element)
+	return entry.value, true, nil
+}
+
+// Set 写入缓存项，超出容量时淘汰最近最少使用的项
+func (s *MemoryCacheStore) Set(key string, value []byte, ttl time.Duration) error {
+	expiresAt := s.clock.Now().Add(ttl)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if element, ok := s.entries[key]; ok {
+		entry := element.Value.(*memoryCacheEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		s.order.MoveToFront(element)
+		return nil
+	}
+
+	s.entries[key] = s.order.PushFront(&memoryCacheEntry{key: key, value: value, expiresAt: expiresAt})
+	for s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryCacheEntry).key)
+	}
+	return nil
+}
+
+// Delete 删除缓存项
+func (s *MemoryCacheStore) Delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if element, ok := s.entries[key]; ok {
+		s.order.Remove(element)
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// Len 当前缓存项数（含尚未清除的过期项）
+func (s *MemoryCacheStore) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.order.Len()
+}
+
+// RedisClient RedisCacheStore需要的Redis命令，由接入方适配所用的Redis客户端（如go-redis）
+type RedisClient interface {
+	// GET，键不存在时found为false且不返回错误
+	Get(ctx context.Context, key string) (value []byte, found bool, err error)
+	// SET key value PX ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// DEL key
+	Del(ctx context.Context, key string) error
+}
+
+// RedisCacheStore 基于Redis的缓存存储，多个实例共享，失效对所有实例立即生效
+type RedisCacheStore struct {
+	client  RedisClient
+	prefix  string        // 键前缀，用于与其他应用共用Redis
+	timeout time.Duration // 单条命令超时
+}
+
+// NewRedisCacheStore 创建Redis缓存存储，键前缀为prefix，单条命令超时为timeout（不大于0时为1秒）
+func NewRedisCacheStore(client RedisClient, prefix string, timeout time.Duration) *RedisCacheStore {
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	return &RedisCacheStore{client: client, prefix: prefix, timeout: timeout}
+}
+
+// Get 读取缓存
+func (s *RedisCacheStore) Get(key string) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	return s.client.Get(ctx, s.prefix+key)
+}
+
+// Set 写入缓存
+func (s *RedisCacheStore) Set(key string, value []byte, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	return s.client.Set(ctx, s.prefix+key, value, ttl)
+}
+
+// Delete 删除缓存
+func (s *RedisCacheStore) Delete(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	return s.client.Del(ctx, s.prefix+key)
+}
+
+// UserCacheInvalidator 可按用户清除缓存的用户服务
+type UserCacheInvalidator interface {
+	InvalidateUser(id uint) error
+}
+
+// CachedUserService 按ID读取用户时先查缓存的用户服务
+//
+// 只缓存GetUserByID，ValidateToken每次请求都会调用；其他查询直接访问底层服务。
+// 通过本服务修改用户时在返回前清除缓存，禁用、暂停、删除对后续请求立即生效；
+// 绕过本服务直接写数据库的修改最多在ttl内读到旧数据，应在写入后调用InvalidateUser。
+type CachedUserService struct {
+	UserService
+	ttl   time.Duration
+	store CacheStore
+	// invalidations 清除缓存的次数，读取数据库期间发生清除时不回填，避免把禁用前读到的旧数据写回缓存
+	invalidations atomic.Uint64
+}
+
+// NewCachedUserService 包装用户服务，缓存ttl内的GetUserByID结果，store为nil时使用内存LRU缓存
+func NewCachedUserService(inner UserService, ttl time.Duration, store CacheStore) *CachedUserService {
+	if store == nil {
+		store = NewMemoryCacheStore(0, nil)
+	}
+	return &CachedUserService{UserService: inner, ttl: ttl, store: store}
+}
+
+// userCacheKey 用户缓存键
+func userCacheKey(id uint) string {
+	return fmt.Sprintf("auth:user:%d", id)
+}
+
+// GetUserByID 根据ID获取用户，缓存不可用时直接查询底层服务
+func (s *CachedUserService) GetUserByID(id uint) (*User, error) {
+	key := userCacheKey(id)
+	if data, found, err := s.store.Get(key); err != nil {
+		log.Printf("读取用户缓存失败: user_id=%d err=%v", id, err)
+	} else if found {
+		var user User
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&user); err == nil {
+			return &user, nil
+		}
+	}
+
+	generation := s.invalidations.Load()
+	user, err := s.UserService.GetUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if s.ttl <= 0 || s.invalidations.Load() != generation {
+		return user, nil
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(user); err != nil {
+		return user, nil
+	}
+	if err := s.store.Set(key, buf.Bytes(), s.ttl); err != nil {
+		log.Printf("写入用户缓存失败: user_id=%d err=%v", id, err)
+	}
+	return user, nil
+}
+
+// InvalidateUser 清除用户的缓存
+func (s *CachedUserService) InvalidateUser(id uint) error {
+	s.invalidations.Add(1)
+	if err := s.store.Delete(userCacheKey(id)); err != nil {
+		return fmt.Errorf("清除用户缓存失败: %w", err)
+	}
+	return nil
+}
+
+// UpdateUser 更新用户并清除缓存
+func (s *CachedUserService) UpdateUser(user *User) error {
+	if err := s.UserService.UpdateUser(user); err != nil {
+		return err
+	}
+	return s.InvalidateUser(user.ID)
+}
+
+// UpdateLastLogin 更新最后登录时间并清除缓存
+func (s *CachedUserService) UpdateLastLogin(userID uint, t time.Time) error {
+	if err := s.UserService.UpdateLastLogin(userID, t); err != nil {
+		return err
+	}
+	return s.InvalidateUser(userID)
+}
+
+// DeleteUser 软删除用户并清除缓存
+func (s *CachedUserService) DeleteUser(id uint) error {
+	if err := s.UserService.DeleteUser(id); err != nil {
+		return err
+	}
+	return s.InvalidateUser(id)
+}
+
+// DeleteUserHard 永久删除用户并清除缓存
+func (s *CachedUserService) DeleteUserHard(id uint) error {
+	if err := s.UserService.DeleteUserHard(id); err != nil {
+		return err
+	}
+	return s.InvalidateUser(id)
+}
+
+// SuspendUser 暂停用户并清除缓存
+func (s *CachedUserService) SuspendUser(id uint, until time.Time, reason string) error {
+	if err := s.UserService.SuspendUser(id, until, reason); err != nil {
+		return err
+	}
+	return s.InvalidateUser(id)
+}
+
+// LiftSuspension 解除暂停并清除缓存
+func (s *CachedUserService) LiftSuspension(id uint) error {
+	if err := s.UserService.LiftSuspension(id); err != nil {
+		return err
+	}
+	return s.InvalidateUser(id)
+}
+
+// AcceptTerms 记录同意服务条款并清除缓存
+func (s *CachedUserService) AcceptTerms(userID uint, version string) error {
+	if err := s.UserService.AcceptTerms(userID, version); err != nil {
+		return err
+	}
+	return s.InvalidateUser(userID)
+}
+
+// invalidateUserCache 绕过UserService直接修改用户后清除缓存，未启用缓存时不做处理
+func invalidateUserCache(userService UserService, id uint) {
+	if invalidator, ok := userService.(UserCacheInvalidator); ok {
+		if err := invalidator.InvalidateUser(id); err != nil {
+			log.Printf("%v: user_id=%d", err, id)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingUserService 测试用内存用户服务，记录GetUserByID的调用次数
+type countingUserService struct {
+	UserService
+	mutex  sync.Mutex
+	users  map[uint]User
+	loads  int
+	onLoad func() // 读取用户后、返回前调用，用于模拟读取期间的并发修改
+}
+
+func (s *countingUserService) GetUserByID(id uint) (*User, error) {
+	s.mutex.Lock()
+	s.loads++
+	user, ok := s.users[id]
+	s.mutex.Unlock()
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	if s.onLoad != nil {
+		s.onLoad()
+	}
+	return &user, nil
+}
+
+func (s *countingUserService) UpdateUser(user *User) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.users[user.ID] = *user
+	return nil
+}
+
+func (s *countingUserService) DeleteUser(id uint) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.users, id)
+	return nil
+}
+
+func (s *countingUserService) SuspendUser(id uint, until time.Time, reason string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	user := s.users[id]
+	user.SuspendedUntil = &until
+	s.users[id] = user
+	return nil
+}
+
+func newCountingUserService() *countingUserService {
+	user := User{Username: "alice", Email: "alice@example.com", PasswordHash: "$2a$10$hash", Status: 1}
+	user.ID = 1
+	return &countingUserService{users: map[uint]User{1: user}}
+}
+
+// fakeRedisClient 测试用内存Redis客户端
+type fakeRedisClient struct {
+	values map[string][]byte
+}
+
+func (c *fakeRedisClient) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, ok := c.values[key]
+	return value, ok, nil
+}
+
+func (c *fakeRedisClient) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.values[key] = value
+	return nil
+}
+
+func (c *fakeRedisClient) Del(ctx context.Context, key string) error {
+	delete(c.values, key)
+	return nil
+}
+
+// failingCacheStore 读写都失败的缓存存储
+type failingCacheStore struct{}
+
+func (failingCacheStore) Get(key string) ([]byte, bool, error) {
+	return nil, false, errors.New("cache down")
+}
+
+func (failingCacheStore) Set(key string, value []byte, ttl time.Duration) error {
+	return errors.New("cache down")
+}
+
+func (failingCacheStore) Delete(key string) error {
+	return errors.New("cache down")
+}
+
+func TestMemoryCacheStore(t *testing.T) {
+	t.Run("按TTL过期", func(t *testing.T) {
+		clock := NewFakeClock(time.Time{})
+		store := NewMemoryCacheStore(10, clock)
+		assert.NoError(t, store.Set("a", []byte("1"), time.Minute))
+
+		value, found, err := store.Get("a")
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, []byte("1"), value)
+
+		clock.Advance(time.Minute)
+		_, found, _ = store.Get("a")
+		assert.False(t, found)
+		assert.Equal(t, 0, store.Len())
+	})
+
+	t.Run("超出容量时淘汰最近最少使用的项", func(t *testing.T) {
+		store := NewMemoryCacheStore(2, nil)
+		store.Set("a", []byte("1"), time.Minute)
+		store.Set("b", []byte("2"), time.Minute)
+		store.Get("a")
+		store.Set("c", []byte("3"), time.Minute)
+
+		_, found, _ := store.Get("b")
+		assert.False(t, found)
+		_, found, _ = store.Get("a")
+		assert.True(t, found)
+		_, found, _ = store.Get("c")
+		assert.True(t, found)
+		assert.Equal(t, 2, store.Len())
+	})
+
+	t.Run("删除", func(t *testing.T) {
+		store := NewMemoryCacheStore(0, nil)
+		store.Set("a", []byte("1"), time.Minute)
+		assert.NoError(t, store.Delete("a"))
+		assert.NoError(t, store.Delete("missing"))
+		_, found, _ := store.Get("a")
+		assert.False(t, found)
+	})
+}
+
+func TestCachedUserService(t *testing.T) {
+	t.Run("缓存命中时不查询底层服务", func(t *testing.T) {
+		inner := newCountingUserService()
+		service := NewCachedUserService(inner, time.Minute, nil)
+
+		for i := 0; i < 3; i++ {
+			user, err := service.GetUserByID(1)
+			assert.NoError(t, err)
+			assert.Equal(t, "alice", user.Username)
+			assert.Equal(t, "$2a$10$hash", user.PasswordHash, "缓存保留不参与JSON序列化的字段")
+		}
+		assert.Equal(t, 1, inner.loads)
+
+		// 返回的是副本，修改不影响缓存
+		user, _ := service.GetUserByID(1)
+		user.Status = 2
+		user, _ = service.GetUserByID(1)
+		assert.Equal(t, uint8(1), user.Status)
+	})
+
+	t.Run("旧数据最多保留TTL", func(t *testing.T) {
+		clock := NewFakeClock(time.Time{})
+		inner := newCountingUserService()
+		service := NewCachedUserService(inner, time.Minute, NewMemoryCacheStore(0, clock))
+		service.GetUserByID(1)
+
+		// 绕过缓存直接修改
+		user := inner.users[1]
+		user.Username = "renamed"
+		inner.users[1] = user
+
+		cached, _ := service.GetUserByID(1)
+		assert.Equal(t, "alice", cached.Username)
+		clock.Advance(time.Minute)
+		cached, _ = service.GetUserByID(1)
+		assert.Equal(t, "renamed", cached.Username)
+	})
+
+	t.Run("修改用户时清除缓存", func(t *testing.T) {
+		inner := newCountingUserService()
+		service := NewCachedUserService(inner, time.Minute, nil)
+
+		user, _ := service.GetUserByID(1)
+		user.Status = 2
+		assert.NoError(t, service.UpdateUser(user))
+		user, _ = service.GetUserByID(1)
+		assert.Equal(t, uint8(2), user.Status)
+
+		until := time.Now().Add(time.Hour)
+		assert.NoError(t, service.SuspendUser(1, until, "abuse"))
+		user, _ = service.GetUserByID(1)
+		assert.NotNil(t, user.SuspendedUntil)
+
+		assert.NoError(t, service.DeleteUser(1))
+		_, err := service.GetUserByID(1)
+		assert.True(t, errors.Is(err, ErrUserNotFound))
+	})
+
+	t.Run("读取期间被清除时不回填旧数据", func(t *testing.T) {
+		inner := newCountingUserService()
+		service := NewCachedUserService(inner, time.Minute, nil)
+		inner.onLoad = func() {
+			inner.onLoad = nil
+			disabled := inner.users[1]
+			disabled.Status = 2
+			assert.NoError(t, service.UpdateUser(&disabled))
+		}
+
+		user, err := service.GetUserByID(1)
+		assert.NoError(t, err)
+		assert.Equal(t, uint8(1), user.Status, "读取开始时的数据")
+
+		user, _ = service.GetUserByID(1)
+		assert.Equal(t, uint8(2), user.Status)
+	})
+
+	t.Run("缓存不可用时直接查询", func(t *testing.T) {
+		inner := newCountingUserService()
+		service := NewCachedUserService(inner, time.Minute, failingCacheStore{})
+
+		user, err := service.GetUserByID(1)
+		assert.NoError(t, err)
+		assert.Equal(t, "alice", user.Username)
+
+		// 清除失败时返回错误，调用方不会误以为修改已对所有请求生效
+		user.Status = 2
+		assert.Error(t, service.UpdateUser(user))
+	})
+
+	t.Run("Redis存储", func(t *testing.T) {
+		client := &fakeRedisClient{values: map[string][]byte{}}
+		inner := newCountingUserService()
+		service := NewCachedUserService(inner, time.Minute, NewRedisCacheStore(client, "app:", 0))
+
+		service.GetUserByID(1)
+		assert.Contains(t, client.values, "app:auth:user:1")
+		service.GetUserByID(1)
+		assert.Equal(t, 1, inner.loads)
+
+		assert.NoError(t, service.InvalidateUser(1))
+		assert.NotContains(t, client.values, "app:auth:user:1")
+	})
+}
+
+func TestValidateTokenWithUserCache(t *testing.T) {
+	inner := newCountingUserService()
+	users := NewCachedUserService(inner, time.Hour, nil)
+	tokenService := NewTokenService("test-secret-key", time.Hour)
+	service := NewAuthService(nil, users, tokenService)
+
+	token, err := tokenService.GenerateToken(1)
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err := service.ValidateToken(token)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 1, inner.loads)
+
+	t.Run("禁用后立即拒绝", func(t *testing.T) {
+		user, _ := users.GetUserByID(1)
+		user.Status = 2
+		assert.NoError(t, users.UpdateUser(user))
+
+		_, err := service.ValidateToken(token)
+		assert.True(t, errors.Is(err, ErrUserDisabled))
+	})
+
+	t.Run("删除后立即拒绝", func(t *testing.T) {
+		assert.NoError(t, users.DeleteUser(1))
+
+		_, err := service.ValidateToken(token)
+		assert.True(t, errors.Is(err, ErrUserNotFound))
+	})
+}
+
+// ValidateToken开销对比：不启用缓存时每次请求查询一次用户表
+
+func BenchmarkAuthServiceValidateToken(b *testing.B) {
+	testDB := SetupTestDB(b)
+	defer testDB.TeardownTestDB()
+
+	// 清理数据
+	testDB.ClearAllData()
+	user := testDB.CreateTestUser("benchuser", "bench@example.com", "Password123!")
+	tokenService := NewTokenService("test-secret-key", time.Hour)
+	service := NewAuthService(testDB.DB, NewUserService(testDB.DB), tokenService)
+	token, err := tokenService.GenerateToken(user.ID)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		service.ValidateToken(token)
+	}
+}
+
+func BenchmarkAuthServiceValidateTokenCached(b *testing.B) {
+	testDB := SetupTestDB(b)
+	defer testDB.TeardownTestDB()
+
+	// 清理数据
+	testDB.ClearAllData()
+	user := testDB.CreateTestUser("benchuser", "bench@example.com", "Password123!")
+	tokenService := NewTokenService("test-secret-key", time.Hour)
+	users := NewCachedUserService(NewUserService(testDB.DB), time.Minute, nil)
+	service := NewAuthService(testDB.DB, users, tokenService)
+	token, err := tokenService.GenerateToken(user.ID)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		service.ValidateToken(token)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"aigo_service_auth/errorcodes"
+)
+
+// 输入校验错误定义
+var (
+	ErrValidation            = errors.New("输入校验未通过")
+	ErrUsernameTaken         = errors.New("用户名已存在")
+	ErrEmailTaken            = errors.New("邮箱已存在")
+	ErrInvalidInvitationCode = errors.New("邀请码无效")
+	ErrOldPasswordIncorrect  = errors.New("原密码错误")
+)
+
+// 字段校验错误码，前端按错误码展示，不应依赖错误信息文本
+const (
+	ValidationCodeRequired           = "required"
+	ValidationCodeTaken              = "taken"
+	ValidationCodeInvalid            = "invalid"
+	ValidationCodeIncorrect          = "incorrect"
+	ValidationCodePasswordPolicy     = "password_policy"
+	ValidationCodePasswordTooWeak    = "password_too_weak"
+	ValidationCodePasswordTooSimilar = "password_too_similar"
+	ValidationCodePasswordInHistory  = "password_in_history"
+)
+
+// 校验的字段名
+const (
+	FieldUsername       = "username"
+	FieldEmail          = "email"
+	FieldPassword       = "password"
+	FieldInvitationCode = "invitation_code"
+	FieldOldPassword    = "old_password"
+	FieldNewPassword    = "new_password"
+)
+
+// FieldError 单个字段的校验错误
+type FieldError struct {
+	Field   string         `json:"field"`
+	Code    string         `json:"code"`
+	Message string         `json:"message"` // 默认的中文提示
+	Params  map[string]any `json:"params,omitempty"`
+}
+
+// ValidationError 一次校验发现的全部字段错误
+//
+// 可用errors.As取出全部字段错误，也可用errors.Is匹配ErrValidation或具体原因，如ErrUsernameTaken、ErrPasswordTooWeak。
+type ValidationError struct {
+	Errors []FieldError
+	causes []error
+}
+
+// Error 实现error接口，按发现顺序拼接各字段的中文提示
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fieldErr := range e.Errors {
+		messages[i] = fieldErr.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap 支持errors.Is匹配ErrValidation和各字段错误的原因
+func (e *ValidationError) Unwrap() []error {
+	return append([]error{ErrValidation}, e.causes...)
+}
+
+// Add 记录一个字段错误
+func (e *ValidationError) Add(field, code, message string) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Code: code, Message: message})
+}
+
+// HasCode 检查字段是否存在指定错误码
+func (e *ValidationError) HasCode(field, code string) bool {
+	for _, fieldErr := range e.Errors {
+		if fieldErr.Field == field && fieldErr.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Fields 按字段分组的错误，用于渲染表单错误
+func (e *ValidationError) Fields() map[string][]FieldError {
+	fields := make(map[string][]FieldError)
+	for _, fieldErr := range e.Errors {
+		fields[fieldErr.Field] = append(fields[fieldErr.Field], fieldErr)
+	}
+	return fields
+}
+
+// addCause 记录由哨兵错误引起的字段错误，以其文本作为提示
+func (e *ValidationError) addCause(field, code string, cause error) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Code: code, Message: cause.Error()})
+	e.causes = append(e.causes, cause)
+}
+
+// addPasswordError 将新密码校验结果转换为字段错误，非校验类错误（如读取密码历史失败）原样返回
+func (e *ValidationError) addPasswordError(field string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, ErrPasswordEmpty) {
+		e.addCause(field, ValidationCodeRequired, ErrPasswordEmpty)
+		return nil
+	}
+
+	var passwordErr *PasswordValidationError
+	if !errors.As(err, &passwordErr) {
+		return err
+	}
+	for i, reason := range passwordErr.Reasons {
+		fieldErr := FieldError{Field: field, Code: passwordReasonCode(reason), Message: reason.Error()}
+		if details := passwordErr.details[i]; len(details) > 0 {
+			fieldErr.Message = strings.Join(details, "; ")
+			fieldErr.Params = map[string]any{"violations": details}
+		}
+		e.Errors = append(e.Errors, fieldErr)
+		e.causes = append(e.causes, reason)
+	}
+	return nil
+}
+
+// passwordReasonCode 返回密码校验失败原因对应的错误码
+func passwordReasonCode(reason error) string {
+	switch reason {
+	case ErrPasswordPolicyViolation:
+		return ValidationCodePasswordPolicy
+	case ErrPasswordTooWeak:
+		return ValidationCodePasswordTooWeak
+	case ErrPasswordTooSimilar:
+		return ValidationCodePasswordTooSimilar
+	case ErrPasswordInHistory:
+		return ValidationCodePasswordInHistory
+	default:
+		return ValidationCodeInvalid
+	}
+}
+
+// Err 没有字段错误时返回nil，否则返回自身
+func (e *ValidationError) Err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// validateNewUser 检查新用户的用户名、邮箱和邀请码，收集全部字段错误；查询失败时直接返回该错误
+func validateNewUser(us UserService, user *User, validationErr *ValidationError) error {
+	if user.Username == "" {
+		validationErr.Add(FieldUsername, ValidationCodeRequired, "用户名不能为空")
+	} else if _, err := us.GetUserByUsername(user.Username); err == nil {
+		validationErr.addCause(FieldUsername, ValidationCodeTaken, ErrUsernameTaken)
+	} else if !isUserNotFound(err) {
+		return err
+	}
+
+	if user.Email == "" {
+		validationErr.Add(FieldEmail, ValidationCodeRequired, "邮箱不能为空")
+	} else if _, err := us.GetUserByEmail(user.Email); err == nil {
+		validationErr.addCause(FieldEmail, ValidationCodeTaken, ErrEmailTaken)
+	} else if !isUserNotFound(err) {
+		return err
+	}
+
+	if user.InvitationCode != "" {
+		valid, err := us.ValidateInvitationCode(user.InvitationCode)
+		if err != nil {
+			return err
+		}
+		if !valid {
+			validationErr.addCause(FieldInvitationCode, ValidationCodeInvalid, ErrInvalidInvitationCode)
+		}
+	}
+	return nil
+}
+
+// validateRegistration 一次性校验注册信息和密码，全部通过时返回nil
+func validateRegistration(us UserService, pm PasswordManager, user *User, password string) error {
+	validationErr := &ValidationError{}
+	if err := validateNewUser(us, user, validationErr); err != nil {
+		return err
+	}
+	if password == "" {
+		validationErr.addCause(FieldPassword, ValidationCodeRequired, ErrPasswordEmpty)
+	} else if err := validationErr.addPasswordError(FieldPassword, validateNewPassword(pm, 0, password, user.Username, user.Email)); err != nil {
+		return err
+	}
+	return validationErr.Err()
+}
+
+// validationErrorResponse 校验错误的响应体
+type validationErrorResponse struct {
+	Code    string                  `json:"code"`
+	Message string                  `json:"message"`
+	Errors  map[string][]FieldError `json:"errors"`
+}
+
+// WriteValidationError err为ValidationError时以422和按字段分组的错误写入响应并返回true，否则不写入并返回false
+func WriteValidationError(w http.ResponseWriter, err error) bool {
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(errorcodes.HTTPStatusOf(errorcodes.ErrCodeValidationFailed))
+	json.NewEncoder(w).Encode(validationErrorResponse{
+		Code:    errorcodes.ErrCodeValidationFailed,
+		Message: ErrValidation.Error(),
+		Errors:  validationErr.Fields(),
+	})
+	return true
+}
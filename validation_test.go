@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// assertValidationCode 断言err为ValidationError且包含指定字段的错误码
+func assertValidationCode(t *testing.T, err error, field, code string) {
+	t.Helper()
+
+	var validationErr *ValidationError
+	if !assert.True(t, errors.As(err, &validationErr), "期望ValidationError，实际: %v", err) {
+		return
+	}
+	assert.True(t, validationErr.HasCode(field, code), "缺少字段错误 %s/%s，实际: %+v", field, code, validationErr.Errors)
+}
+
+// takenUserService 测试用用户服务，用户名和邮箱都已被占用，邀请码无效
+type takenUserService struct {
+	UserService
+}
+
+func (takenUserService) GetUserByUsername(username string) (*User, error) {
+	return &User{Username: username}, nil
+}
+
+func (takenUserService) GetUserByEmail(email string) (*User, error) {
+	return &User{Email: email}, nil
+}
+
+func (takenUserService) ValidateInvitationCode(code string) (bool, error) {
+	return false, nil
+}
+
+func TestValidationError(t *testing.T) {
+	t.Run("没有字段错误时Err返回nil", func(t *testing.T) {
+		validationErr := &ValidationError{}
+		assert.NoError(t, validationErr.Err())
+	})
+
+	t.Run("单个错误时保持原有中文提示", func(t *testing.T) {
+		validationErr := &ValidationError{}
+		validationErr.addCause(FieldUsername, ValidationCodeTaken, ErrUsernameTaken)
+
+		err := validationErr.Err()
+		assert.Equal(t, "用户名已存在", err.Error())
+		assert.True(t, errors.Is(err, ErrValidation))
+		assert.True(t, errors.Is(err, ErrUsernameTaken))
+		assert.False(t, errors.Is(err, ErrEmailTaken))
+	})
+
+	t.Run("按字段分组", func(t *testing.T) {
+		validationErr := &ValidationError{}
+		validationErr.Add(FieldUsername, ValidationCodeRequired, "用户名不能为空")
+		validationErr.addCause(FieldEmail, ValidationCodeTaken, ErrEmailTaken)
+		validationErr.Add(FieldEmail, ValidationCodeInvalid, "邮箱格式错误")
+
+		fields := validationErr.Fields()
+		assert.Len(t, fields[FieldUsername], 1)
+		assert.Len(t, fields[FieldEmail], 2)
+		assert.Equal(t, "用户名不能为空; 邮箱已存在; 邮箱格式错误", validationErr.Error())
+	})
+}
+
+func TestValidateRegistration(t *testing.T) {
+	config := DefaultPasswordManagerConfig()
+	config.BcryptCost = 4
+	pm := NewPasswordManager(config)
+
+	t.Run("收集全部字段错误", func(t *testing.T) {
+		user := &User{Username: "taken", Email: "taken@example.com", InvitationCode: "invalid"}
+		err := validateRegistration(takenUserService{}, pm, user, "password123")
+
+		assertValidationCode(t, err, FieldUsername, ValidationCodeTaken)
+		assertValidationCode(t, err, FieldEmail, ValidationCodeTaken)
+		assertValidationCode(t, err, FieldInvitationCode, ValidationCodeInvalid)
+		assertValidationCode(t, err, FieldPassword, ValidationCodePasswordPolicy)
+		assert.True(t, errors.Is(err, ErrPasswordPolicyViolation))
+	})
+
+	t.Run("必填字段", func(t *testing.T) {
+		err := validateRegistration(takenUserService{}, nil, &User{}, "")
+
+		assertValidationCode(t, err, FieldUsername, ValidationCodeRequired)
+		assertValidationCode(t, err, FieldEmail, ValidationCodeRequired)
+		assertValidationCode(t, err, FieldPassword, ValidationCodeRequired)
+	})
+
+	t.Run("策略违规明细放在参数中", func(t *testing.T) {
+		user := &User{Username: "newuser", Email: "newuser@example.com"}
+		err := validateRegistration(&stubUserService{err: ErrUserNotFound}, pm, user, "password123")
+
+		var validationErr *ValidationError
+		assert.True(t, errors.As(err, &validationErr))
+		for _, fieldErr := range validationErr.Errors {
+			assert.Equal(t, FieldPassword, fieldErr.Field)
+			if fieldErr.Code == ValidationCodePasswordPolicy {
+				assert.NotEmpty(t, fieldErr.Params["violations"])
+			}
+		}
+	})
+
+	t.Run("查询失败时返回原错误", func(t *testing.T) {
+		dbErr := errors.New("数据库连接失败")
+		err := validateRegistration(&stubUserService{err: dbErr}, nil, &User{Username: "newuser", Email: "new@example.com"}, "password123")
+		assert.True(t, errors.Is(err, dbErr))
+		assert.False(t, errors.Is(err, ErrValidation))
+	})
+}
+
+func TestWriteValidationError(t *testing.T) {
+	t.Run("渲染为422和按字段分组的错误", func(t *testing.T) {
+		validationErr := &ValidationError{}
+		validationErr.addCause(FieldUsername, ValidationCodeTaken, ErrUsernameTaken)
+		validationErr.addCause(FieldPassword, ValidationCodeRequired, ErrPasswordEmpty)
+
+		recorder := httptest.NewRecorder()
+		assert.True(t, WriteValidationError(recorder, validationErr))
+		assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+
+		var body validationErrorResponse
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+		assert.Equal(t, "validation_failed", body.Code)
+		assert.Equal(t, ValidationCodeTaken, body.Errors[FieldUsername][0].Code)
+		assert.Equal(t, "用户名已存在", body.Errors[FieldUsername][0].Message)
+		assert.Equal(t, ValidationCodeRequired, body.Errors[FieldPassword][0].Code)
+	})
+
+	t.Run("其他错误不写入", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		assert.False(t, WriteValidationError(recorder, errors.New("数据库连接失败")))
+		assert.Equal(t, 0, recorder.Body.Len())
+	})
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 验证码用途，同一用户不同用途的验证码互不影响
+const (
+	VerificationPurposeEmail         = "email_verification"
+	VerificationPurposePhone         = "phone_verification"
+	VerificationPurposeMagicLink     = "magic_link"
+	VerificationPurposeDeleteAccount = "delete_account"
+)
+
+// 验证码位数范围
+const (
+	minVerificationDigits = 4
+	maxVerificationDigits = 10
+)
+
+// 验证码错误定义
+var (
+	ErrVerificationCodeNotFound     = errors.New("验证码不存在或已使用")
+	ErrVerificationCodeInvalid      = errors.New("验证码错误")
+	ErrVerificationCodeExpired      = errors.New("验证码已过期")
+	ErrVerificationAttemptsExceeded = errors.New("验证码错误次数过多")
+)
+
+// VerificationCodeService 验证码服务接口
+//
+// 邮箱验证、手机验证码、魔法链接和敏感操作确认共用此服务，
+// 验证码绑定用户和用途，只能使用一次。
+type VerificationCodeService interface {
+	// 签发指定位数的数字验证码，替换同一用户和用途的旧验证码
+	Issue(userID uint, purpose string, ttl time.Duration, digits int) (string, error)
+	// 验证并消费验证码
+	Verify(userID uint, purpose, code string) error
+	// 使用户指定用途的验证码失效
+	Invalidate(userID uint, purpose string) error
+}
+
+// VerificationCode 验证码记录，只保存验证码的SHA-256哈希
+type VerificationCode struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_verification_user_purpose" json:"user_id"`
+	Purpose   string    `gorm:"size:50;not null;uniqueIndex:idx_verification_user_purpose" json:"purpose"`
+	CodeHash  string    `gorm:"size:64;not null" json:"-"`
+	Attempts  int       `gorm:"not null;default:0" json:"attempts"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName 设置表名
+func (VerificationCode) TableName() string {
+	return "sys_verification_codes"
+}
+
+// VerificationCodeConfig 验证码服务配置
+type VerificationCodeConfig struct {
+	MaxAttempts int // 最多允许的错误次数，达到后验证码失效
+}
+
+// DefaultVerificationCodeConfig 默认验证码服务配置
+func DefaultVerificationCodeConfig() *VerificationCodeConfig {
+	return &VerificationCodeConfig{
+		MaxAttempts: 5,
+	}
+}
+
+// VerificationCodeStorage 验证码存储接口
+type VerificationCodeStorage interface {
+	// 保存验证码，替换同一用户和用途的旧验证码
+	Save(code *VerificationCode) error
+	// 获取用户指定用途的验证码，不存在时返回ErrVerificationCodeNotFound
+	Get(userID uint, purpose string) (*VerificationCode, error)
+	// 增加错误次数，返回增加后的次数
+	IncrementAttempts(userID uint, purpose string) (int, error)
+	// 删除验证码，返回是否删除了记录，并发消费时只有一个调用返回true
+	Delete(userID uint, purpose string) (bool, error)
+}
+
+// verificationCodeService 验证码服务实现
+type verificationCodeService struct {
+	storage VerificationCodeStorage
+	config  *VerificationCodeConfig
+}
+
+// NewVerificationCodeService 创建验证码服务实例
+func NewVerificationCodeService(storage VerificationCodeStorage, config *VerificationCodeConfig) VerificationCodeService {
+	if config == nil {
+		config = DefaultVerificationCodeConfig()
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = DefaultVerificationCodeConfig().MaxAttempts
+	}
+
+	return &verificationCodeService{
+		storage: storage,
+		config:  config,
+	}
+}
+
+// Issue 签发指定位数的数字验证码
+func (s *verificationCodeService) Issue(userID uint, purpose string, ttl time.Duration, digits int) (string, error) {
+	if userID == 0 {
+		return "", ErrInvalidUserID
+	}
+	if purpose == "" {
+		return "", errors.New("验证码用途不能为空")
+	}
+	if ttl <= 0 {
+		return "", errors.New("有效期必须大于0")
+	}
+	if digits < minVerificationDigits || digits > maxVerificationDigits {
+		return "", fmt.Errorf("验证码位数必须在%d到%d之间", minVerificationDigits, maxVerificationDigits)
+	}
+
+	code, err := generateNumericCode(digits)
+	if err != nil {
+		return "", fmt.Errorf("生成验证码失败: %w", err)
+	}
+
+	err = s.storage.Save(&VerificationCode{
+		UserID:    userID,
+		Purpose:   purpose,
+		CodeHash:  hashVerificationCode(code),
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// Verify 验证并消费验证码
+func (s *verificationCodeService) Verify(userID uint, purpose, code string) error {
+	record, err := s.storage.Get(userID, purpose)
+	if err != nil {
+		return err
+	}
+
+	if !time.Now().Before(record.ExpiresAt) {
+		s.storage.Delete(userID, purpose)
+		return ErrVerificationCodeExpired
+	}
+
+	if record.Attempts >= s.config.MaxAttempts {
+		return ErrVerificationAttemptsExceeded
+	}
+
+	// 使用constant time比较防止时序攻击
+	if subtle.ConstantTimeCompare([]byte(hashVerificationCode(code)), []byte(record.CodeHash)) != 1 {
+		attempts, err := s.storage.IncrementAttempts(userID, purpose)
+		if err != nil {
+			return err
+		}
+		if attempts >= s.config.MaxAttempts {
+			return ErrVerificationAttemptsExceeded
+		}
+		return ErrVerificationCodeInvalid
+	}
+
+	// 删除成功才算消费，防止并发重复使用
+	deleted, err := s.storage.Delete(userID, purpose)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrVerificationCodeNotFound
+	}
+
+	return nil
+}
+
+// Invalidate 使用户指定用途的验证码失效
+func (s *verificationCodeService) Invalidate(userID uint, purpose string) error {
+	_, err := s.storage.Delete(userID, purpose)
+	return err
+}
+
+// generateNumericCode 生成指定位数的随机数字验证码
+func generateNumericCode(digits int) (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
+
+// hashVerificationCode 计算验证码的SHA-256哈希
+func hashVerificationCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// gormVerificationCodeStorage 基于GORM的验证码存储实现
+type gormVerificationCodeStorage struct {
+	db *gorm.DB
+}
+
+// NewGormVerificationCodeStorage 创建基于数据库的验证码存储
+func NewGormVerificationCodeStorage(db *gorm.DB) VerificationCodeStorage {
+	return &gormVerificationCodeStorage{db: db}
+}
+
+// Save 保存验证码，替换同一用户和用途的旧验证码
+func (s *gormVerificationCodeStorage) Save(code *VerificationCode) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND purpose = ?", code.UserID, code.Purpose).Delete(&VerificationCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(code).Error
+	})
+}
+
+// Get 获取用户指定用途的验证码
+func (s *gormVerificationCodeStorage) Get(userID uint, purpose string) (*VerificationCode, error) {
+	var code VerificationCode
+	if err := s.db.Where("user_id = ? AND purpose = ?", userID, purpose).First(&code).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrVerificationCodeNotFound
+		}
+		return nil, err
+	}
+	return &code, nil
+}
+
+// IncrementAttempts 增加错误次数
+func (s *gormVerificationCodeStorage) IncrementAttempts(userID uint, purpose string) (int, error) {
+	result := s.db.Model(&VerificationCode{}).
+		Where("user_id = ? AND purpose = ?", userID, purpose).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, ErrVerificationCodeNotFound
+	}
+
+	code, err := s.Get(userID, purpose)
+	if err != nil {
+		return 0, err
+	}
+	return code.Attempts, nil
+}
+
+// Delete 删除验证码
+func (s *gormVerificationCodeStorage) Delete(userID uint, purpose string) (bool, error) {
+	result := s.db.Where("user_id = ? AND purpose = ?", userID, purpose).Delete(&VerificationCode{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// verificationCodeKey 内存存储的键
+type verificationCodeKey struct {
+	userID  uint
+	purpose string
+}
+
+// MemoryVerificationCodeStorage 内存验证码存储实现
+type MemoryVerificationCodeStorage struct {
+	codes map[verificationCodeKey]VerificationCode
+	mutex sync.Mutex
+}
+
+// NewMemoryVerificationCodeStorage 创建内存验证码存储
+func NewMemoryVerificationCodeStorage() *MemoryVerificationCodeStorage {
+	return &MemoryVerificationCodeStorage{
+		codes: make(map[verificationCodeKey]VerificationCode),
+	}
+}
+
+// Save 保存验证码，替换同一用户和用途的旧验证码
+func (s *MemoryVerificationCodeStorage) Save(code *VerificationCode) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if code.CreatedAt.IsZero() {
+		code.CreatedAt = time.Now()
+	}
+	s.codes[verificationCodeKey{code.UserID, code.Purpose}] = *code
+	return nil
+}
+
+// Get 获取用户指定用途的验证码
+func (s *MemoryVerificationCodeStorage) Get(userID uint, purpose string) (*VerificationCode, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	code, exists := s.codes[verificationCodeKey{userID, purpose}]
+	if !exists {
+		return nil, ErrVerificationCodeNotFound
+	}
+	return &code, nil
+}
+
+// IncrementAttempts 增加错误次数
+func (s *MemoryVerificationCodeStorage) IncrementAttempts(userID uint, purpose string) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := verificationCodeKey{userID, purpose}
+	code, exists := s.codes[key]
+	if !exists {
+		return 0, ErrVerificationCodeNotFound
+	}
+	code.Attempts++
+	s.codes[key] = code
+	return code.Attempts, nil
+}
+
+// Delete 删除验证码
+func (s *MemoryVerificationCodeStorage) Delete(userID uint, purpose string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := verificationCodeKey{userID, purpose}
+	if _, exists := s.codes[key]; !exists {
+		return false, nil
+	}
+	delete(s.codes, key)
+	return true, nil
+}
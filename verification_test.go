@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerificationCodeService(t *testing.T) {
+	runVerificationCodeServiceTests(t, func() VerificationCodeStorage {
+		return NewMemoryVerificationCodeStorage()
+	})
+}
+
+func TestVerificationCodeServiceGorm(t *testing.T) {
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	runVerificationCodeServiceTests(t, func() VerificationCodeStorage {
+		testDB.ClearAllData()
+		return NewGormVerificationCodeStorage(testDB.DB)
+	})
+}
+
+// runVerificationCodeServiceTests 对不同存储实现运行相同的验证码测试
+func runVerificationCodeServiceTests(t *testing.T, newStorage func() VerificationCodeStorage) {
+	t.Run("签发和验证验证码", func(t *testing.T) {
+		service := NewVerificationCodeService(newStorage(), nil)
+
+		code, err := service.Issue(1, VerificationPurposeEmail, time.Minute, 6)
+		assert.NoError(t, err)
+		assert.Len(t, code, 6)
+
+		err = service.Verify(1, VerificationPurposeEmail, code)
+		assert.NoError(t, err)
+
+		// 只能使用一次
+		err = service.Verify(1, VerificationPurposeEmail, code)
+		assert.True(t, errors.Is(err, ErrVerificationCodeNotFound))
+	})
+
+	t.Run("签发参数校验", func(t *testing.T) {
+		service := NewVerificationCodeService(newStorage(), nil)
+
+		_, err := service.Issue(0, VerificationPurposeEmail, time.Minute, 6)
+		assert.True(t, errors.Is(err, ErrInvalidUserID))
+
+		_, err = service.Issue(1, "", time.Minute, 6)
+		assert.Error(t, err)
+
+		_, err = service.Issue(1, VerificationPurposeEmail, 0, 6)
+		assert.Error(t, err)
+
+		_, err = service.Issue(1, VerificationPurposeEmail, time.Minute, 3)
+		assert.Error(t, err)
+
+		_, err = service.Issue(1, VerificationPurposeEmail, time.Minute, 11)
+		assert.Error(t, err)
+	})
+
+	t.Run("错误次数用尽后验证码失效", func(t *testing.T) {
+		service := NewVerificationCodeService(newStorage(), &VerificationCodeConfig{MaxAttempts: 3})
+
+		code, err := service.Issue(1, VerificationPurposePhone, time.Minute, 6)
+		assert.NoError(t, err)
+		wrong := wrongVerificationCode(code)
+
+		err = service.Verify(1, VerificationPurposePhone, wrong)
+		assert.True(t, errors.Is(err, ErrVerificationCodeInvalid))
+		err = service.Verify(1, VerificationPurposePhone, wrong)
+		assert.True(t, errors.Is(err, ErrVerificationCodeInvalid))
+		err = service.Verify(1, VerificationPurposePhone, wrong)
+		assert.True(t, errors.Is(err, ErrVerificationAttemptsExceeded))
+
+		// 正确的验证码也不再被接受
+		err = service.Verify(1, VerificationPurposePhone, code)
+		assert.True(t, errors.Is(err, ErrVerificationAttemptsExceeded))
+
+		// 重新签发后恢复
+		code, err = service.Issue(1, VerificationPurposePhone, time.Minute, 6)
+		assert.NoError(t, err)
+		assert.NoError(t, service.Verify(1, VerificationPurposePhone, code))
+	})
+
+	t.Run("验证码过期", func(t *testing.T) {
+		service := NewVerificationCodeService(newStorage(), nil)
+
+		code, err := service.Issue(1, VerificationPurposeMagicLink, 100*time.Millisecond, 8)
+		assert.NoError(t, err)
+
+		time.Sleep(200 * time.Millisecond)
+		err = service.Verify(1, VerificationPurposeMagicLink, code)
+		assert.True(t, errors.Is(err, ErrVerificationCodeExpired))
+
+		// 过期的验证码被清除
+		err = service.Verify(1, VerificationPurposeMagicLink, code)
+		assert.True(t, errors.Is(err, ErrVerificationCodeNotFound))
+	})
+
+	t.Run("不同用途和用户互相隔离", func(t *testing.T) {
+		service := NewVerificationCodeService(newStorage(), nil)
+
+		emailCode, err := service.Issue(1, VerificationPurposeEmail, time.Minute, 6)
+		assert.NoError(t, err)
+		deleteCode, err := service.Issue(1, VerificationPurposeDeleteAccount, time.Minute, 6)
+		assert.NoError(t, err)
+		otherUserCode, err := service.Issue(2, VerificationPurposeEmail, time.Minute, 6)
+		assert.NoError(t, err)
+
+		// 其他用途的验证码不能通过
+		if emailCode != deleteCode {
+			err = service.Verify(1, VerificationPurposeDeleteAccount, emailCode)
+			assert.True(t, errors.Is(err, ErrVerificationCodeInvalid))
+		}
+		// 其他用户的验证码不能通过
+		if emailCode != otherUserCode {
+			err = service.Verify(1, VerificationPurposeEmail, otherUserCode)
+			assert.True(t, errors.Is(err, ErrVerificationCodeInvalid))
+		}
+
+		// 使用一个用途的验证码不影响其他用途
+		assert.NoError(t, service.Verify(1, VerificationPurposeEmail, emailCode))
+		assert.NoError(t, service.Verify(1, VerificationPurposeDeleteAccount, deleteCode))
+		assert.NoError(t, service.Verify(2, VerificationPurposeEmail, otherUserCode))
+	})
+
+	t.Run("重新签发使旧验证码失效", func(t *testing.T) {
+		service := NewVerificationCodeService(newStorage(), nil)
+
+		oldCode, err := service.Issue(1, VerificationPurposeEmail, time.Minute, 6)
+		assert.NoError(t, err)
+		newCode, err := service.Issue(1, VerificationPurposeEmail, time.Minute, 6)
+		assert.NoError(t, err)
+
+		if oldCode != newCode {
+			err = service.Verify(1, VerificationPurposeEmail, oldCode)
+			assert.True(t, errors.Is(err, ErrVerificationCodeInvalid))
+		}
+		assert.NoError(t, service.Verify(1, VerificationPurposeEmail, newCode))
+	})
+
+	t.Run("主动使验证码失效", func(t *testing.T) {
+		service := NewVerificationCodeService(newStorage(), nil)
+
+		code, err := service.Issue(1, VerificationPurposeDeleteAccount, time.Minute, 6)
+		assert.NoError(t, err)
+
+		assert.NoError(t, service.Invalidate(1, VerificationPurposeDeleteAccount))
+		err = service.Verify(1, VerificationPurposeDeleteAccount, code)
+		assert.True(t, errors.Is(err, ErrVerificationCodeNotFound))
+
+		// 不存在的验证码失效不报错
+		assert.NoError(t, service.Invalidate(1, VerificationPurposeDeleteAccount))
+	})
+
+	t.Run("并发验证同一验证码只有一次成功", func(t *testing.T) {
+		service := NewVerificationCodeService(newStorage(), nil)
+
+		code, err := service.Issue(1, VerificationPurposeEmail, time.Minute, 6)
+		assert.NoError(t, err)
+
+		var wg sync.WaitGroup
+		var succeeded atomic.Int32
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if service.Verify(1, VerificationPurposeEmail, code) == nil {
+					succeeded.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), succeeded.Load())
+	})
+}
+
+func TestGenerateNumericCode(t *testing.T) {
+	for digits := minVerificationDigits; digits <= maxVerificationDigits; digits++ {
+		code, err := generateNumericCode(digits)
+		assert.NoError(t, err)
+		assert.Len(t, code, digits)
+		for _, char := range code {
+			assert.Contains(t, NumberChars, string(char))
+		}
+	}
+}
+
+// wrongVerificationCode 构造与给定验证码不同的同长度验证码
+func wrongVerificationCode(code string) string {
+	wrong := []byte(code)
+	wrong[0] = '0' + (wrong[0]-'0'+1)%10
+	return string(wrong)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GlobalWatermarkUserID 全局水位线使用的用户ID，对所有用户生效
+const GlobalWatermarkUserID uint = 0
+
+// TokenWatermark Token签发时间水位线，签发时间早于水位线的Token一律无效
+type TokenWatermark struct {
+	UserID    uint      `gorm:"primaryKey;autoIncrement:false" json:"user_id"` // 0表示全局
+	Cutoff    time.Time `gorm:"not null" json:"cutoff"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName 设置表名
+func (TokenWatermark) TableName() string {
+	return "sys_token_watermarks"
+}
+
+// TokenWatermarkStorage Token水位线存储接口
+type TokenWatermarkStorage interface {
+	// 提高用户的水位线，userID为0时设置全局水位线；cutoff早于已有水位线时不做修改
+	Raise(userID uint, cutoff time.Time) error
+	// 获取对用户生效的水位线，即用户水位线与全局水位线中较晚的一个；都未设置时返回零值
+	Get(userID uint) (time.Time, error)
+}
+
+// gormTokenWatermarkStorage 基于GORM的水位线存储实现，多个服务实例共享同一份水位线
+type gormTokenWatermarkStorage struct {
+	db *gorm.DB
+}
+
+// NewGormTokenWatermarkStorage 创建基于数据库的水位线存储
+func NewGormTokenWatermarkStorage(db *gorm.DB) TokenWatermarkStorage {
+	return &gormTokenWatermarkStorage{db: db}
+}
+
+// Raise 提高水位线，在数据库中取较大值，并发调用时不会回退
+func (s *gormTokenWatermarkStorage) Raise(userID uint, cutoff time.Time) error {
+	watermark := &TokenWatermark{UserID: userID, Cutoff: cutoff}
+	return s.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "cutoff"}, Value: gorm.Expr("GREATEST(sys_token_watermarks.cutoff, ?)", cutoff)},
+			{Column: clause.Column{Name: "updated_at"}, Value: time.Now()},
+		},
+	}).Create(watermark).Error
+}
+
+// Get 获取对用户生效的水位线
+func (s *gormTokenWatermarkStorage) Get(userID uint) (time.Time, error) {
+	var watermarks []TokenWatermark
+	err := s.db.Where("user_id IN ?", []uint{GlobalWatermarkUserID, userID}).Find(&watermarks).Error
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var cutoff time.Time
+	for _, watermark := range watermarks {
+		if watermark.Cutoff.After(cutoff) {
+			cutoff = watermark.Cutoff
+		}
+	}
+	return cutoff, nil
+}
+
+// MemoryTokenWatermarkStorage 内存水位线存储实现，仅在单个服务实例内生效
+type MemoryTokenWatermarkStorage struct {
+	cutoffs map[uint]time.Time
+	mutex   sync.RWMutex
+}
+
+// NewMemoryTokenWatermarkStorage 创建内存水位线存储
+func NewMemoryTokenWatermarkStorage() *MemoryTokenWatermarkStorage {
+	return &MemoryTokenWatermarkStorage{
+		cutoffs: make(map[uint]time.Time),
+	}
+}
+
+// Raise 提高水位线
+func (s *MemoryTokenWatermarkStorage) Raise(userID uint, cutoff time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if cutoff.After(s.cutoffs[userID]) {
+		s.cutoffs[userID] = cutoff
+	}
+	return nil
+}
+
+// Get 获取对用户生效的水位线
+func (s *MemoryTokenWatermarkStorage) Get(userID uint) (time.Time, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	cutoff := s.cutoffs[GlobalWatermarkUserID]
+	if userCutoff := s.cutoffs[userID]; userCutoff.After(cutoff) {
+		cutoff = userCutoff
+	}
+	return cutoff, nil
+}
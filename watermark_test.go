@@ -0,0 +1,271 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingWatermarkStorage 读取总是失败的水位线存储
+type failingWatermarkStorage struct{}
+
+func (failingWatermarkStorage) Raise(userID uint, cutoff time.Time) error { return nil }
+func (failingWatermarkStorage) Get(userID uint) (time.Time, error) {
+	return time.Time{}, errors.New("存储不可用")
+}
+
+func TestMemoryTokenWatermarkStorage(t *testing.T) {
+	storage := NewMemoryTokenWatermarkStorage()
+	now := time.Now()
+
+	t.Run("未设置时返回零值", func(t *testing.T) {
+		cutoff, err := storage.Get(1)
+		assert.NoError(t, err)
+		assert.True(t, cutoff.IsZero())
+	})
+
+	t.Run("水位线只会提高", func(t *testing.T) {
+		assert.NoError(t, storage.Raise(1, now))
+		assert.NoError(t, storage.Raise(1, now.Add(-time.Hour)))
+
+		cutoff, err := storage.Get(1)
+		assert.NoError(t, err)
+		assert.True(t, cutoff.Equal(now))
+	})
+
+	t.Run("取用户水位线与全局水位线中较晚的一个", func(t *testing.T) {
+		assert.NoError(t, storage.Raise(GlobalWatermarkUserID, now.Add(-time.Minute)))
+
+		cutoff, err := storage.Get(1)
+		assert.NoError(t, err)
+		assert.True(t, cutoff.Equal(now))
+
+		cutoff, err = storage.Get(2)
+		assert.NoError(t, err)
+		assert.True(t, cutoff.Equal(now.Add(-time.Minute)))
+	})
+}
+
+func TestJWTRevokeTokensIssuedBefore(t *testing.T) {
+	newService := func(storage TokenWatermarkStorage) *jwtService {
+		return NewJWTService(&JWTConfig{
+			SecretKey:         "test-secret-key",
+			DefaultExpiration: time.Hour,
+			RefreshExpiration: time.Hour, // 任何时候都可以刷新
+			Issuer:            "test-issuer",
+			AllowRefresh:      true,
+			MaxRefreshCount:   10,
+			WatermarkStorage:  storage,
+		}).(*jwtService)
+	}
+
+	// signIssuedAt 签发指定签发时间的Token
+	signIssuedAt := func(service *jwtService, userID uint, issuedAt time.Time) string {
+		claims := &JWTClaims{
+			UserID: userID,
+			JTI:    service.GenerateJTI(),
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+				IssuedAt:  jwt.NewNumericDate(issuedAt),
+				Issuer:    service.config.Issuer,
+			},
+		}
+		token, err := jwt.NewWithClaims(service.signingMethod, claims).SignedString(service.secretKey)
+		assert.NoError(t, err)
+		return token
+	}
+
+	t.Run("水位线之前签发的Token失效，之后签发的不受影响", func(t *testing.T) {
+		service := newService(nil)
+		cutoff := time.Now()
+
+		oldToken := signIssuedAt(service, 1, cutoff.Add(-time.Minute))
+		newToken := signIssuedAt(service, 1, cutoff.Add(time.Minute))
+		otherToken := signIssuedAt(service, 2, cutoff.Add(-time.Minute))
+
+		assert.NoError(t, service.RevokeTokensIssuedBefore(1, cutoff))
+
+		_, err := service.ValidateToken(oldToken)
+		assert.True(t, errors.Is(err, ErrTokenIssuedBeforeWatermark))
+
+		userID, err := service.ValidateToken(newToken)
+		assert.NoError(t, err)
+		assert.Equal(t, uint(1), userID)
+
+		// 其他用户不受影响
+		_, err = service.ValidateToken(otherToken)
+		assert.NoError(t, err)
+	})
+
+	t.Run("全局水位线对所有用户生效", func(t *testing.T) {
+		service := newService(nil)
+		cutoff := time.Now()
+
+		first := signIssuedAt(service, 1, cutoff.Add(-time.Minute))
+		second := signIssuedAt(service, 2, cutoff.Add(-time.Minute))
+
+		assert.NoError(t, service.RevokeTokensIssuedBefore(GlobalWatermarkUserID, cutoff))
+
+		_, err := service.ValidateToken(first)
+		assert.True(t, errors.Is(err, ErrTokenIssuedBeforeWatermark))
+		_, err = service.ValidateToken(second)
+		assert.True(t, errors.Is(err, ErrTokenIssuedBeforeWatermark))
+
+		// 撤销后重新登录获得的Token可以正常使用
+		token := signIssuedAt(service, 1, cutoff.Add(time.Second))
+		_, err = service.ValidateToken(token)
+		assert.NoError(t, err)
+	})
+
+	t.Run("失效的Token不能通过刷新获得新Token", func(t *testing.T) {
+		service := newService(nil)
+		cutoff := time.Now()
+
+		token := signIssuedAt(service, 1, cutoff.Add(-time.Minute))
+		assert.NoError(t, service.RevokeTokensIssuedBefore(1, cutoff))
+
+		_, err := service.RefreshToken(token)
+		assert.True(t, errors.Is(err, ErrTokenIssuedBeforeWatermark))
+	})
+
+	t.Run("水位线存储共享时对其他实例签发的Token生效", func(t *testing.T) {
+		storage := NewMemoryTokenWatermarkStorage()
+		issuer := newService(storage)
+		validator := newService(storage)
+
+		token := signIssuedAt(issuer, 1, time.Now().Add(-time.Minute))
+		assert.NoError(t, issuer.RevokeTokensIssuedBefore(1, time.Now()))
+
+		_, err := validator.ValidateToken(token)
+		assert.True(t, errors.Is(err, ErrTokenIssuedBeforeWatermark))
+	})
+
+	t.Run("水位线读取失败时拒绝Token", func(t *testing.T) {
+		service := newService(failingWatermarkStorage{})
+
+		token, err := service.GenerateToken(1)
+		assert.NoError(t, err)
+
+		_, err = service.ValidateToken(token)
+		assert.Error(t, err)
+	})
+}
+
+func TestGormTokenWatermarkStorage(t *testing.T) {
+	// 设置测试数据库
+	testDB := SetupTestDB(t)
+	defer testDB.TeardownTestDB()
+
+	// 清理数据
+	testDB.ClearAllData()
+
+	storage := NewGormTokenWatermarkStorage(testDB.DB)
+	now := time.Now().Truncate(time.Second)
+
+	t.Run("未设置时返回零值", func(t *testing.T) {
+		cutoff, err := storage.Get(1)
+		assert.NoError(t, err)
+		assert.True(t, cutoff.IsZero())
+	})
+
+	t.Run("水位线只会提高", func(t *testing.T) {
+		assert.NoError(t, storage.Raise(1, now))
+		assert.NoError(t, storage.Raise(1, now.Add(-time.Hour)))
+
+		cutoff, err := storage.Get(1)
+		assert.NoError(t, err)
+		assert.True(t, cutoff.Equal(now))
+
+		assert.NoError(t, storage.Raise(1, now.Add(time.Minute)))
+		cutoff, err = storage.Get(1)
+		assert.NoError(t, err)
+		assert.True(t, cutoff.Equal(now.Add(time.Minute)))
+	})
+
+	t.Run("取用户水位线与全局水位线中较晚的一个", func(t *testing.T) {
+		assert.NoError(t, storage.Raise(GlobalWatermarkUserID, now.Add(time.Hour)))
+
+		cutoff, err := storage.Get(1)
+		assert.NoError(t, err)
+		assert.True(t, cutoff.Equal(now.Add(time.Hour)))
+
+		cutoff, err = storage.Get(2)
+		assert.NoError(t, err)
+		assert.True(t, cutoff.Equal(now.Add(time.Hour)))
+	})
+}
+
+func TestJWTRevokeAllUserTokensEndsRefreshChains(t *testing.T) {
+	newService := func(clock Clock, storage TokenWatermarkStorage) JWTService {
+		return NewJWTService(&JWTConfig{
+			SecretKey:         "test-secret-key",
+			DefaultExpiration: time.Hour,
+			RefreshExpiration: time.Hour, // 任何时候都可以刷新
+			AllowRefresh:      true,
+			MaxRefreshCount:   10,
+			Clock:             clock,
+			WatermarkStorage:  storage,
+		})
+	}
+
+	// refreshChain 签发Token并连续刷新，返回整条刷新链
+	refreshChain := func(service JWTService, userID uint, refreshes int) []string {
+		token, err := service.GenerateToken(userID)
+		assert.NoError(t, err)
+		chain := []string{token}
+		for i := 0; i < refreshes; i++ {
+			token, err = service.RefreshToken(token)
+			assert.NoError(t, err)
+			chain = append(chain, token)
+		}
+		return chain
+	}
+
+	t.Run("撤销后刷新链上的Token都不能继续刷新", func(t *testing.T) {
+		clock := NewFakeClock(time.Time{})
+		service := newService(clock, nil)
+		chain := refreshChain(service, 1, 3)
+		clock.Advance(time.Second)
+
+		assert.NoError(t, service.RevokeAllUserTokens(1))
+		for _, token := range chain {
+			_, err := service.RefreshToken(token)
+			assert.Error(t, err)
+			_, err = service.ValidateToken(token)
+			assert.Error(t, err)
+		}
+	})
+
+	t.Run("撤销对其他实例的刷新链生效", func(t *testing.T) {
+		clock := NewFakeClock(time.Time{})
+		storage := NewMemoryTokenWatermarkStorage()
+		phone := newService(clock, storage)
+		web := newService(clock, storage)
+
+		chain := refreshChain(phone, 1, 3)
+		clock.Advance(time.Second)
+
+		// web实例没有phone签发的Token记录，只能依靠共享水位线
+		assert.NoError(t, web.RevokeAllUserTokens(1))
+		latest := chain[len(chain)-1]
+		_, err := phone.RefreshToken(latest)
+		assert.True(t, errors.Is(err, ErrTokenIssuedBeforeWatermark))
+		_, err = phone.ValidateToken(latest)
+		assert.True(t, errors.Is(err, ErrTokenIssuedBeforeWatermark))
+	})
+
+	t.Run("撤销后立即重新登录的Token有效", func(t *testing.T) {
+		clock := NewFakeClock(time.Time{})
+		service := newService(clock, nil)
+		refreshChain(service, 1, 1)
+
+		assert.NoError(t, service.RevokeAllUserTokens(1))
+		token, err := service.GenerateToken(1)
+		assert.NoError(t, err)
+		_, err = service.ValidateToken(token)
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"aigo_service_auth/errorcodes"
+)
+
+// WhoAmIResponse 当前用户接口的响应体，未配置角色服务时不包含角色和权限
+type WhoAmIResponse struct {
+	PublicUser
+	Roles       []string            `json:"roles,omitempty"`
+	Permissions map[string][]string `json:"permissions,omitempty"`
+}
+
+// WhoAmIHandler 返回当前用户信息的处理器，用于 /me 接口，需在RequireAuth之后使用
+//
+// 从数据库重新加载用户，响应只包含PublicUser中的字段。未认证时总是返回401 JSON错误，
+// 需要OnUnauthorized钩子时使用AuthMiddleware的同名方法。
+func WhoAmIHandler(us UserService) http.HandlerFunc {
+	return WhoAmIHandlerWithRoles(us, nil)
+}
+
+// WhoAmIHandlerWithRoles 返回当前用户信息及其角色权限的处理器，需在RequireAuth之后使用
+//
+// 未认证时总是返回401 JSON错误，需要OnUnauthorized钩子时使用AuthMiddleware的同名方法。
+func WhoAmIHandlerWithRoles(us UserService, rs RoleService) http.HandlerFunc {
+	return new(AuthMiddleware).WhoAmIHandlerWithRoles(us, rs)
+}
+
+// WhoAmIHandler 返回当前用户信息的处理器，用于 /me 接口，需在RequireAuth之后使用
+//
+// 从数据库重新加载用户，响应只包含PublicUser中的字段；上下文中没有用户或用户已删除时按OnUnauthorized响应。
+func (m *AuthMiddleware) WhoAmIHandler(us UserService) http.HandlerFunc {
+	return m.WhoAmIHandlerWithRoles(us, nil)
+}
+
+// WhoAmIHandlerWithRoles 返回当前用户信息及其角色权限的处理器，需在RequireAuth之后使用
+//
+// 上下文中已有RefreshClaimsFromDB加载的角色权限时直接使用，否则通过rs加载；rs为nil时不返回角色权限。
+func (m *AuthMiddleware) WhoAmIHandlerWithRoles(us UserService, rs RoleService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// 从上下文获取用户
+		user, ok := GetUserFromContext(r.Context())
+		if !ok {
+			m.unauthorized(w, r, errorcodes.ErrCodeUnauthenticated, "缺少认证信息")
+			return
+		}
+
+		current, err := us.GetUserByID(user.ID)
+		if errors.Is(err, ErrUserNotFound) {
+			// Token签发后用户被删除
+			m.unauthorized(w, r, errorcodes.ErrCodeUnauthenticated, "缺少认证信息")
+			return
+		}
+		if err != nil {
+			writeErrorCode(w, errorcodes.ErrCodeInternal, "用户信息获取失败")
+			return
+		}
+
+		response := WhoAmIResponse{PublicUser: current.Public()}
+		if rs != nil {
+			claims, ok := GetAuthorizationFromContext(r.Context())
+			if !ok || claims.UserID != current.ID {
+				if claims, err = loadAuthorizationClaims(rs, current.ID); err != nil {
+					writeErrorCode(w, errorcodes.ErrCodeInternal, "权限信息获取失败")
+					return
+				}
+			}
+			response.Roles = claims.Roles
+			response.Permissions = claims.Permissions
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(response)
+	}
+}
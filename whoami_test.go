@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubUserLookup 测试用用户服务，只实现按ID获取用户
+type stubUserLookup struct {
+	UserService
+	user *User
+	err  error
+}
+
+func (s *stubUserLookup) GetUserByID(id uint) (*User, error) {
+	return s.user, s.err
+}
+
+func TestWhoAmIHandler(t *testing.T) {
+	user := &User{Username: "alice", Email: "alice@example.com", Phone: "13800138000", Avatar: "a.png", Status: 1}
+	user.ID = 7
+
+	editor := &Role{Name: "editor"}
+	editor.ID = 1
+	read := &Permission{Resource: "article", Action: "read"}
+	read.ID = 10
+
+	serve := func(handler http.Handler, ctx context.Context) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		if ctx != nil {
+			req = req.WithContext(ctx)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+	withUser := context.WithValue(context.Background(), UserContextKey, user)
+
+	t.Run("只返回公开字段", func(t *testing.T) {
+		recorder := serve(WhoAmIHandler(&stubUserLookup{user: user}), withUser)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "application/json; charset=utf-8", recorder.Header().Get("Content-Type"))
+		assert.Equal(t, "no-store", recorder.Header().Get("Cache-Control"))
+
+		var body map[string]any
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+		assert.Equal(t, map[string]any{"id": float64(7), "username": "alice", "avatar": "a.png", "status": float64(1)}, body)
+	})
+
+	t.Run("配置角色服务时返回角色权限", func(t *testing.T) {
+		rs := &stubRoleService{
+			roles:       []*Role{editor},
+			permissions: map[uint][]*Permission{1: {read}},
+		}
+		recorder := serve(WhoAmIHandlerWithRoles(&stubUserLookup{user: user}, rs), withUser)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+
+		var body WhoAmIResponse
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+		assert.Equal(t, user.Public(), body.PublicUser)
+		assert.Equal(t, []string{"editor"}, body.Roles)
+		assert.Equal(t, map[string][]string{"article": {"read"}}, body.Permissions)
+		assert.Equal(t, int32(1), rs.loads.Load())
+	})
+
+	t.Run("复用上下文中的角色权限", func(t *testing.T) {
+		rs := &stubRoleService{}
+		claims := &AuthorizationClaims{UserID: 7, Roles: []string{"admin"}, Permissions: map[string][]string{"user": {"delete"}}}
+		ctx := context.WithValue(withUser, AuthorizationContextKey, claims)
+
+		recorder := serve(WhoAmIHandlerWithRoles(&stubUserLookup{user: user}, rs), ctx)
+		var body WhoAmIResponse
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+		assert.Equal(t, []string{"admin"}, body.Roles)
+		assert.Equal(t, int32(0), rs.loads.Load())
+	})
+
+	t.Run("上下文中没有用户返回401", func(t *testing.T) {
+		recorder := serve(WhoAmIHandler(&stubUserLookup{user: user}), nil)
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+
+	t.Run("用户已删除返回401", func(t *testing.T) {
+		recorder := serve(WhoAmIHandler(&stubUserLookup{err: ErrUserNotFound}), withUser)
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+
+	t.Run("加载失败返回500", func(t *testing.T) {
+		recorder := serve(WhoAmIHandler(&stubUserLookup{err: errors.New("数据库连接失败")}), withUser)
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+
+		rs := &stubRoleService{err: errors.New("数据库连接失败")}
+		recorder = serve(WhoAmIHandlerWithRoles(&stubUserLookup{user: user}, rs), withUser)
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	})
+}